@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/ryansname/powerctl/internal/workers"
+)
+
+func main() {
+	os.Exit(workers.RunCommand(os.Args[1:]))
+}
@@ -5,8 +5,8 @@ pkgs.buildGoModule {
   version = "0.1.0";
   src = ./.;
 
-  vendorHash = "sha256-vl8ELHtVdMQrM5Ed56lLQr2u0AWZuXZUaL7VcPLxSvc=";
-  subPackages = [ "src" ];
+  vendorHash = "sha256-dprWEDTRHAYrIPJo7hw4Nj8Mrfs7A0eJyjWN0VcCz7I=";
+  subPackages = [ "cmd/powerctl" ];
 
   nativeBuildInputs = [ pkgs.golangci-lint ];
 
@@ -18,8 +18,4 @@ pkgs.buildGoModule {
     HOME=$(mktemp -d) golangci-lint run
     runHook postCheck
   '';
-
-  postInstall = ''
-    mv $out/bin/src $out/bin/powerctl
-  '';
 }
@@ -0,0 +1,46 @@
+package governor
+
+import "time"
+
+// Dwell holds a discrete value and only lets it change once a new proposed value
+// has been requested continuously for the dwell duration. Prevents flapping when
+// the input driving the proposal hovers around a boundary.
+type Dwell[T comparable] struct {
+	Current T
+
+	dwell        time.Duration
+	pending      T
+	pendingSince time.Time
+	hasPending   bool
+}
+
+// NewDwell creates a dwell governor starting at initial.
+func NewDwell[T comparable](initial T, dwell time.Duration) *Dwell[T] {
+	return &Dwell[T]{Current: initial, dwell: dwell}
+}
+
+// Update proposes a value at time now and returns the (possibly unchanged) current value.
+// A proposal equal to Current clears any pending change; a different proposal restarts
+// the dwell timer.
+func (d *Dwell[T]) Update(proposed T, now time.Time) T {
+	if proposed == d.Current {
+		d.hasPending = false
+		return d.Current
+	}
+	if !d.hasPending || proposed != d.pending {
+		d.pending = proposed
+		d.pendingSince = now
+		d.hasPending = true
+	}
+	if now.Sub(d.pendingSince) >= d.dwell {
+		d.Current = proposed
+		d.hasPending = false
+	}
+	return d.Current
+}
+
+// Force sets the current value immediately, discarding any pending change.
+func (d *Dwell[T]) Force(value T) {
+	d.Current = value
+	d.hasPending = false
+}
@@ -0,0 +1,55 @@
+package governor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDwell_ChangesAfterDwell(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	d := NewDwell("Standby", 2*time.Minute)
+
+	assert.Equal(t, "Standby", d.Update("Eco", start))
+	assert.Equal(t, "Standby", d.Update("Eco", start.Add(119*time.Second)))
+	assert.Equal(t, "Eco", d.Update("Eco", start.Add(2*time.Minute)))
+}
+
+func TestDwell_FlappingNeverCommits(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	d := NewDwell("Standby", 2*time.Minute)
+
+	for i := range 10 {
+		proposed := "Eco"
+		if i%2 == 1 {
+			proposed = "Standby"
+		}
+		assert.Equal(t, "Standby", d.Update(proposed, start.Add(time.Duration(i)*time.Minute)))
+	}
+}
+
+func TestDwell_NewProposalRestartsTimer(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	d := NewDwell("Standby", 2*time.Minute)
+
+	d.Update("Eco", start)
+	assert.Equal(t, "Standby", d.Update("Standard", start.Add(90*time.Second)))
+	assert.Equal(t, "Standby", d.Update("Standard", start.Add(3*time.Minute)))
+	assert.Equal(t, "Standard", d.Update("Standard", start.Add(210*time.Second)))
+}
+
+func TestDwell_Force(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	d := NewDwell("Super", 2*time.Minute)
+
+	d.Update("Eco", start)
+	d.Force("Standby")
+	assert.Equal(t, "Standby", d.Current)
+	assert.Equal(t, "Standby", d.Update("Standby", start.Add(3*time.Minute)))
+}
+
+func TestDwell_ZeroDwellIsImmediate(t *testing.T) {
+	d := NewDwell(0, 0)
+	assert.Equal(t, 3, d.Update(3, time.Now()))
+}
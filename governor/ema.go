@@ -0,0 +1,49 @@
+package governor
+
+import (
+	"math"
+	"time"
+)
+
+// EMA is a time-based exponential moving average that also tracks the smoothed rate
+// of change. Samples may arrive irregularly: each is weighted by the time since the
+// previous one, so a value that stood for a long time counts for more.
+type EMA struct {
+	Value float64 // Smoothed value
+	Rate  float64 // Smoothed rate of change, units per second
+
+	tau       time.Duration
+	lastValue float64
+	last      time.Time
+	started   bool
+}
+
+// NewEMA creates an average with time constant tau (≈63% of a step after tau).
+func NewEMA(tau time.Duration) *EMA {
+	return &EMA{tau: tau}
+}
+
+// Update feeds a sample observed at now. The first sample is adopted directly with
+// zero rate.
+func (e *EMA) Update(value float64, now time.Time) {
+	if !e.started {
+		e.started = true
+		e.Value = value
+		e.lastValue = value
+		e.last = now
+		return
+	}
+
+	dt := now.Sub(e.last).Seconds()
+	if dt <= 0 {
+		// Same instant: take the newer value for the next derivative, nothing to average
+		e.lastValue = value
+		return
+	}
+	alpha := 1 - math.Exp(-dt/e.tau.Seconds())
+
+	e.Value += alpha * (value - e.Value)
+	e.Rate += alpha * ((value-e.lastValue)/dt - e.Rate)
+	e.lastValue = value
+	e.last = now
+}
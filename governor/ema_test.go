@@ -0,0 +1,57 @@
+package governor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEMA_FirstSampleAdopted(t *testing.T) {
+	e := NewEMA(time.Minute)
+	e.Update(50, time.Now())
+	assert.Equal(t, 50.0, e.Value)
+	assert.Equal(t, 0.0, e.Rate)
+}
+
+func TestEMA_StepReachesTimeConstant(t *testing.T) {
+	e := NewEMA(time.Minute)
+	now := time.Now()
+	e.Update(0, now)
+	for range 60 {
+		now = now.Add(time.Second)
+		e.Update(100, now)
+	}
+	// 1 - e^-1 ≈ 63% of the step after one time constant
+	assert.InDelta(t, 63.2, e.Value, 0.5)
+}
+
+func TestEMA_CadenceIndependent(t *testing.T) {
+	fast, slow := NewEMA(time.Minute), NewEMA(time.Minute)
+	now := time.Now()
+	fast.Update(0, now)
+	slow.Update(0, now)
+	for i := 1; i <= 60; i++ {
+		fast.Update(100, now.Add(time.Duration(i)*time.Second))
+		if i%10 == 0 {
+			slow.Update(100, now.Add(time.Duration(i)*time.Second))
+		}
+	}
+	assert.InDelta(t, fast.Value, slow.Value, 0.01)
+}
+
+func TestEMA_RateTracksRamp(t *testing.T) {
+	e := NewEMA(10 * time.Second)
+	now := time.Now()
+	// Solar ramping up at 20 W/s
+	for i := range 120 {
+		e.Update(float64(i)*20, now.Add(time.Duration(i)*time.Second))
+	}
+	assert.InDelta(t, 20.0, e.Rate, 0.1)
+
+	// Flat afterwards: rate decays towards zero
+	for i := 120; i < 240; i++ {
+		e.Update(2380, now.Add(time.Duration(i)*time.Second))
+	}
+	assert.InDelta(t, 0.0, e.Rate, 0.1)
+}
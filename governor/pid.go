@@ -0,0 +1,79 @@
+package governor
+
+import "time"
+
+// PIDConfig holds the gains and output range for a PIDController.
+type PIDConfig struct {
+	Kp, Ki, Kd     float64 // Ki per second, Kd in seconds
+	OutMin, OutMax float64
+}
+
+// PIDController is a PID loop with output clamping and anti-windup. The integral is
+// kept as its contribution to the output (not the raw error sum), so SetGains can change
+// Ki without a jump in output. Derivative acts on the measurement, not the error, so a
+// setpoint change doesn't kick the output.
+type PIDController struct {
+	Output float64
+
+	config          PIDConfig
+	iTerm           float64
+	lastMeasurement float64
+	last            time.Time
+	started         bool
+}
+
+// NewPIDController creates a controller starting at zero output (clamped to the range).
+func NewPIDController(config PIDConfig) *PIDController {
+	p := &PIDController{config: config}
+	p.iTerm = p.clamp(0)
+	p.Output = p.iTerm
+	return p
+}
+
+func (p *PIDController) clamp(v float64) float64 {
+	return max(p.config.OutMin, min(v, p.config.OutMax))
+}
+
+// SetGains changes the gains. The integral contribution carries over unchanged, so the
+// output continues smoothly from where it was.
+func (p *PIDController) SetGains(kp, ki, kd float64) {
+	p.config.Kp, p.config.Ki, p.config.Kd = kp, ki, kd
+}
+
+// Update advances the loop to now and returns the clamped output. The first call only
+// sets the proportional term, as there is no elapsed time to integrate or differentiate.
+func (p *PIDController) Update(setpoint, measurement float64, now time.Time) float64 {
+	err := setpoint - measurement
+
+	var dt, derivative float64
+	if p.started {
+		dt = max(now.Sub(p.last).Seconds(), 0)
+		if dt > 0 {
+			derivative = -(measurement - p.lastMeasurement) / dt
+		}
+	}
+	p.started = true
+	p.last = now
+	p.lastMeasurement = measurement
+
+	// Anti-windup: the integral only grows as far as the output range can use, so it
+	// doesn't have to unwind before the output leaves a limit
+	pd := p.config.Kp*err + p.config.Kd*derivative
+	iTerm := p.iTerm + p.config.Ki*err*dt
+	if pd+iTerm > p.config.OutMax {
+		iTerm = max(p.iTerm, p.config.OutMax-pd)
+	} else if pd+iTerm < p.config.OutMin {
+		iTerm = min(p.iTerm, p.config.OutMin-pd)
+	}
+	p.iTerm = p.clamp(iTerm)
+
+	p.Output = p.clamp(pd + p.iTerm)
+	return p.Output
+}
+
+// Reset clears the integral and derivative history, e.g. after the loop was overridden.
+func (p *PIDController) Reset() {
+	p.iTerm = p.clamp(0)
+	p.Output = p.iTerm
+	p.started = false
+}
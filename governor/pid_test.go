@@ -0,0 +1,67 @@
+package governor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPID_ProportionalAndIntegral(t *testing.T) {
+	p := NewPIDController(PIDConfig{Kp: 0.5, Ki: 0.1, OutMin: -1000, OutMax: 1000})
+	start := time.Now()
+
+	// First update: proportional only
+	assert.InDelta(t, 50.0, p.Update(100, 0, start), 0.001)
+	// 10s of error 100 adds 0.1*100*10 = 100 of integral
+	assert.InDelta(t, 150.0, p.Update(100, 0, start.Add(10*time.Second)), 0.001)
+	// At setpoint the integral holds the output
+	assert.InDelta(t, 100.0, p.Update(100, 100, start.Add(11*time.Second)), 0.001)
+}
+
+func TestPID_DerivativeOnMeasurement(t *testing.T) {
+	p := NewPIDController(PIDConfig{Kd: 2, OutMin: -1000, OutMax: 1000})
+	start := time.Now()
+	p.Update(0, 0, start)
+
+	// Setpoint jump alone doesn't kick the output
+	assert.InDelta(t, 0.0, p.Update(500, 0, start.Add(time.Second)), 0.001)
+	// Measurement rising 10/s opposes itself
+	assert.InDelta(t, -20.0, p.Update(500, 10, start.Add(2*time.Second)), 0.001)
+}
+
+func TestPID_ClampAndAntiWindup(t *testing.T) {
+	p := NewPIDController(PIDConfig{Kp: 1, Ki: 1, OutMin: 0, OutMax: 300})
+	start := time.Now()
+	p.Update(1000, 0, start)
+
+	// Long saturation doesn't wind the integral up
+	for i := 1; i <= 60; i++ {
+		assert.InDelta(t, 300.0, p.Update(1000, 0, start.Add(time.Duration(i)*time.Second)), 0.001)
+	}
+	// Once the error reverses the output comes straight off the limit
+	assert.Less(t, p.Update(0, 100, start.Add(61*time.Second)), 300.0)
+	assert.GreaterOrEqual(t, p.Output, 0.0)
+}
+
+func TestPID_BumplessRetune(t *testing.T) {
+	p := NewPIDController(PIDConfig{Kp: 0, Ki: 1, OutMin: 0, OutMax: 1000})
+	start := time.Now()
+	p.Update(10, 0, start)
+	before := p.Update(10, 0, start.Add(20*time.Second))
+	assert.InDelta(t, 200.0, before, 0.001)
+
+	p.SetGains(0, 5, 0)
+	// At zero error the output is unchanged by the new Ki
+	assert.InDelta(t, before, p.Update(0, 0, start.Add(21*time.Second)), 0.001)
+}
+
+func TestPID_Reset(t *testing.T) {
+	p := NewPIDController(PIDConfig{Ki: 1, OutMin: 0, OutMax: 1000})
+	start := time.Now()
+	p.Update(10, 0, start)
+	p.Update(10, 0, start.Add(10*time.Second))
+	p.Reset()
+	assert.InDelta(t, 0.0, p.Output, 0.001)
+	assert.InDelta(t, 0.0, p.Update(0, 0, start.Add(11*time.Second)), 0.001)
+}
@@ -50,9 +50,10 @@ func newRollingMinMax(numBuckets int, bucketDivisor int64) RollingMinMax {
 	return r
 }
 
-// Update records a value at the current time
-func (r *RollingMinMax) Update(value float64) {
-	r.updateAt(value, time.Now().Unix()/r.bucketDivisor)
+// Update records a value observed at now. Callers pass the time rather than the window
+// reading the clock, so the bucket matches the data regardless of update cadence.
+func (r *RollingMinMax) Update(value float64, now time.Time) {
+	r.updateAt(value, now.Unix()/r.bucketDivisor)
 }
 
 // updateAt records a value at the specified absolute tick (for testing).
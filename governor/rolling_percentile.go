@@ -0,0 +1,90 @@
+package governor
+
+import (
+	"sort"
+	"time"
+)
+
+type timedSample struct {
+	value float64
+	at    time.Time
+}
+
+// RollingPercentile keeps timestamped values for up to maxWindow and answers
+// time-weighted percentile queries over any window up to that length. Each value is
+// weighted by how long it stood before the next one (or now), clipped to the window.
+type RollingPercentile struct {
+	maxWindow time.Duration
+	samples   []timedSample
+	head      int // index of the oldest retained sample; earlier entries are dead
+}
+
+// NewRollingPercentile creates a tracker retaining maxWindow of history.
+func NewRollingPercentile(maxWindow time.Duration) *RollingPercentile {
+	return &RollingPercentile{maxWindow: maxWindow}
+}
+
+// MaxWindow returns the longest window the tracker can answer for.
+func (r *RollingPercentile) MaxWindow() time.Duration {
+	return r.maxWindow
+}
+
+// Add records a value observed at now. Samples must arrive in time order.
+func (r *RollingPercentile) Add(value float64, now time.Time) {
+	r.samples = append(r.samples, timedSample{value: value, at: now})
+
+	// Drop samples that ended before the retention cutoff, keeping the one still in
+	// effect at the cutoff so the start of a full window has a value
+	cutoff := now.Add(-r.maxWindow)
+	for r.head+1 < len(r.samples) && !r.samples[r.head+1].at.After(cutoff) {
+		r.head++
+	}
+	if r.head > len(r.samples)/2 {
+		r.samples = append(r.samples[:0], r.samples[r.head:]...)
+		r.head = 0
+	}
+}
+
+// Percentile returns the time-weighted p-th percentile (0-100) over the last window
+// (capped at MaxWindow). ok is false when there are no samples.
+func (r *RollingPercentile) Percentile(p float64, window time.Duration, now time.Time) (float64, bool) {
+	live := r.samples[r.head:]
+	if len(live) == 0 {
+		return 0, false
+	}
+
+	cutoff := now.Add(-min(window, r.maxWindow))
+	type weighted struct{ value, seconds float64 }
+	var pairs []weighted
+	var total float64
+	for i, s := range live {
+		end := now
+		if i+1 < len(live) {
+			end = live[i+1].at
+		}
+		start := s.at
+		if start.Before(cutoff) {
+			start = cutoff
+		}
+		if !end.After(start) {
+			continue
+		}
+		seconds := end.Sub(start).Seconds()
+		pairs = append(pairs, weighted{s.value, seconds})
+		total += seconds
+	}
+	if len(pairs) == 0 {
+		return live[len(live)-1].value, true
+	}
+
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].value < pairs[j].value })
+	target := total * p / 100
+	var cumulative float64
+	for _, w := range pairs {
+		cumulative += w.seconds
+		if cumulative >= target {
+			return w.value, true
+		}
+	}
+	return pairs[len(pairs)-1].value, true
+}
@@ -0,0 +1,59 @@
+package governor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollingPercentile_Empty(t *testing.T) {
+	r := NewRollingPercentile(time.Hour)
+	_, ok := r.Percentile(50, time.Hour, time.Now())
+	assert.False(t, ok)
+}
+
+func TestRollingPercentile_TimeWeighted(t *testing.T) {
+	r := NewRollingPercentile(time.Hour)
+	start := time.Now()
+	r.Add(100, start)
+	r.Add(200, start.Add(10*time.Minute)) // 100 stood for 10m
+	now := start.Add(40 * time.Minute)    // 200 stood for 30m
+
+	p50, ok := r.Percentile(50, time.Hour, now)
+	assert.True(t, ok)
+	assert.Equal(t, 200.0, p50)
+	p20, _ := r.Percentile(20, time.Hour, now)
+	assert.Equal(t, 100.0, p20)
+}
+
+func TestRollingPercentile_WindowClipsOlderSamples(t *testing.T) {
+	r := NewRollingPercentile(time.Hour)
+	start := time.Now()
+	r.Add(100, start)
+	r.Add(200, start.Add(50*time.Minute))
+	now := start.Add(60 * time.Minute)
+
+	// Over 20 minutes: 100 for 10m, 200 for 10m
+	p1, _ := r.Percentile(1, 20*time.Minute, now)
+	assert.Equal(t, 100.0, p1)
+	p99, _ := r.Percentile(99, 20*time.Minute, now)
+	assert.Equal(t, 200.0, p99)
+
+	// Over 5 minutes only 200 is in effect
+	p1, _ = r.Percentile(1, 5*time.Minute, now)
+	assert.Equal(t, 200.0, p1)
+}
+
+func TestRollingPercentile_PrunesBeyondMaxWindow(t *testing.T) {
+	r := NewRollingPercentile(10 * time.Minute)
+	start := time.Now()
+	for i := range 100 {
+		r.Add(float64(i), start.Add(time.Duration(i)*time.Minute))
+	}
+	// Only the samples covering the last 10 minutes (plus the one in effect at the cutoff) remain
+	assert.LessOrEqual(t, len(r.samples)-r.head, 11)
+
+	p1, _ := r.Percentile(1, time.Hour, start.Add(99*time.Minute))
+	assert.Equal(t, 89.0, p1, "windows are capped at MaxWindow")
+}
@@ -0,0 +1,51 @@
+package governor
+
+import (
+	"math"
+	"time"
+)
+
+// SlowRampState smooths a target so brief spikes don't move the output. Pressure
+// integrates how far the target has been from the output over time (units·seconds);
+// once it reaches the threshold the output jumps to the target and pressure resets.
+// A large disagreement moves the output quickly, a small one only if it persists.
+// Pressure resets whenever the target crosses back over the output.
+type SlowRampState struct {
+	Output   float64
+	Pressure float64
+
+	threshold float64
+	last      time.Time
+	started   bool
+}
+
+// NewSlowRamp creates a smoother that moves once pressure reaches threshold (units·seconds).
+func NewSlowRamp(threshold float64) *SlowRampState {
+	return &SlowRampState{threshold: threshold}
+}
+
+// Update feeds the target at time now and returns the smoothed output. The first call
+// adopts the target directly.
+func (s *SlowRampState) Update(target float64, now time.Time) float64 {
+	if !s.started {
+		s.started = true
+		s.Output = target
+		s.last = now
+		return s.Output
+	}
+
+	dt := max(now.Sub(s.last).Seconds(), 0)
+	s.last = now
+
+	diff := target - s.Output
+	if diff == 0 || (s.Pressure != 0 && math.Signbit(diff) != math.Signbit(s.Pressure)) {
+		s.Pressure = 0
+	}
+	s.Pressure += diff * dt
+
+	if math.Abs(s.Pressure) >= s.threshold {
+		s.Output = target
+		s.Pressure = 0
+	}
+	return s.Output
+}
@@ -0,0 +1,75 @@
+package governor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlowRamp_FirstUpdateAdoptsTarget(t *testing.T) {
+	r := NewSlowRamp(1000)
+	assert.InDelta(t, 500.0, r.Update(500, time.Now()), 0.001)
+}
+
+func TestSlowRamp_BriefSpikeIgnored(t *testing.T) {
+	r := NewSlowRamp(255 * 60)
+	start := time.Now()
+	r.Update(0, start)
+
+	// 500W for 10s builds 5000 W·s, short of the threshold
+	for i := 1; i <= 10; i++ {
+		assert.InDelta(t, 0.0, r.Update(500, start.Add(time.Duration(i)*time.Second)), 0.001)
+	}
+	assert.InDelta(t, 5000.0, r.Pressure, 0.001)
+
+	// Target drops back: pressure resets rather than lingering
+	r.Update(0, start.Add(11*time.Second))
+	assert.InDelta(t, 0.0, r.Pressure, 0.001)
+}
+
+func TestSlowRamp_SustainedChangeFollows(t *testing.T) {
+	r := NewSlowRamp(255 * 60)
+	start := time.Now()
+	r.Update(0, start)
+
+	// 1020W (4 inverters) crosses 15300 W·s after 15s
+	assert.InDelta(t, 0.0, r.Update(1020, start.Add(14*time.Second)), 0.001)
+	assert.InDelta(t, 1020.0, r.Update(1020, start.Add(15*time.Second)), 0.001)
+	assert.InDelta(t, 0.0, r.Pressure, 0.001)
+
+	// Decreases build negative pressure the same way
+	assert.InDelta(t, 1020.0, r.Update(0, start.Add(20*time.Second)), 0.001)
+	assert.Negative(t, r.Pressure)
+	assert.InDelta(t, 0.0, r.Update(0, start.Add(30*time.Second)), 0.001)
+}
+
+func TestSlowRamp_ZeroThresholdFollowsImmediately(t *testing.T) {
+	r := NewSlowRamp(0)
+	start := time.Now()
+	r.Update(0, start)
+	assert.InDelta(t, 300.0, r.Update(300, start.Add(time.Second)), 0.001)
+}
+
+func TestSlowRamp_IndependentOfCadence(t *testing.T) {
+	// The same 15s of disagreement builds the same pressure whether it arrives
+	// every second or every 5 seconds
+	start := time.Now()
+	frequent := NewSlowRamp(10000)
+	frequent.Update(0, start)
+	for i := 1; i <= 15; i++ {
+		frequent.Update(300, start.Add(time.Duration(i)*time.Second))
+	}
+
+	sparse := NewSlowRamp(10000)
+	sparse.Update(0, start)
+	for i := 5; i <= 15; i += 5 {
+		sparse.Update(300, start.Add(time.Duration(i)*time.Second))
+	}
+
+	assert.InDelta(t, 4500.0, frequent.Pressure, 0.001)
+	assert.InDelta(t, frequent.Pressure, sparse.Pressure, 0.001)
+
+	// A single late update after a long gap moves the output straight away
+	assert.InDelta(t, 300.0, sparse.Update(300, start.Add(time.Minute)), 0.001)
+}
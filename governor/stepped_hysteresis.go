@@ -44,12 +44,26 @@ func NewSteppedHysteresis(
 // The step can only change when the value crosses a threshold; otherwise it stays
 // in the hysteresis zone and returns the previous value.
 func (s *SteppedHysteresis) Update(value float64) int {
+	return s.UpdateCompensated(value, 0)
+}
+
+// UpdateCompensated is Update with the decrease thresholds moved decreaseOffset further
+// from the increase thresholds (lower in Ascending mode, higher in Descending mode).
+// Used when the value is depressed by the load the current step itself causes.
+func (s *SteppedHysteresis) UpdateCompensated(value, decreaseOffset float64) int {
 	if s.steps <= 0 {
 		return s.Current
 	}
 
+	if s.ascending {
+		decreaseOffset = -decreaseOffset
+	}
 	increaseCount := countCrossed(value, s.steps, s.increaseStart, s.increaseEnd, s.ascending)
-	decreaseCount := countCrossed(value, s.steps, s.decreaseStart, s.decreaseEnd, s.ascending)
+	decreaseCount := countCrossed(
+		value, s.steps,
+		s.decreaseStart+decreaseOffset, s.decreaseEnd+decreaseOffset,
+		s.ascending,
+	)
 
 	switch {
 	case s.Current > decreaseCount:
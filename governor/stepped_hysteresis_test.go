@@ -266,3 +266,23 @@ func TestThreshold(t *testing.T) {
 	// Single step
 	assert.Equal(t, 50.0, threshold(50, 100, 1, 1))
 }
+
+func TestUpdateCompensated(t *testing.T) {
+	t.Run("ascending offset lowers decrease thresholds only", func(t *testing.T) {
+		h := newSOCLimitsHysteresis() // decrease 12.5, 17.5, 22.5
+		h.Current = 3
+
+		assert.Equal(t, 3, h.UpdateCompensated(21.0, 2.0), "21 is above 22.5-2")
+		assert.Equal(t, 2, h.UpdateCompensated(20.0, 2.0))
+		assert.Equal(t, 2, h.UpdateCompensated(21.0, 2.0), "increase thresholds unchanged")
+		assert.Equal(t, 3, h.UpdateCompensated(25.0, 2.0))
+	})
+
+	t.Run("descending offset raises decrease thresholds", func(t *testing.T) {
+		h := newPowerwallLowHysteresis() // decrease 28 → 44
+		h.Current = 9
+
+		assert.Equal(t, 9, h.UpdateCompensated(29.0, 2.0), "29 is below 28+2")
+		assert.Equal(t, 8, h.UpdateCompensated(31.0, 2.0))
+	})
+}
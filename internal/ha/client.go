@@ -0,0 +1,99 @@
+package ha
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RequestTimeout bounds each Home Assistant REST call.
+const RequestTimeout = 10 * time.Second
+
+// Client talks to the Home Assistant REST API with a long-lived access token.
+type Client struct {
+	BaseURL string
+	Token   string
+	client  *http.Client
+}
+
+// NewClient returns a client for the HA instance at baseURL (no trailing slash needed).
+func NewClient(baseURL, token string) *Client {
+	return &Client{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Token:   token,
+		client:  &http.Client{Timeout: RequestTimeout},
+	}
+}
+
+// EntityIDs returns the ID of every entity HA currently knows about.
+func (c *Client) EntityIDs(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/api/states", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("HA states request failed (%d): %s", resp.StatusCode, body)
+	}
+
+	var states []struct {
+		EntityID string `json:"entity_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&states); err != nil {
+		return nil, fmt.Errorf("decode states: %w", err)
+	}
+
+	ids := make([]string, len(states))
+	for i, s := range states {
+		ids[i] = s.EntityID
+	}
+	return ids, nil
+}
+
+// CallService calls a Home Assistant service via the REST API. entityID and data are
+// merged into the service data the same way the MQTT call_service proxy does.
+func (c *Client) CallService(ctx context.Context, domain, service, entityID string, data map[string]any) error {
+	serviceData := make(map[string]any, len(data)+1)
+	maps.Copy(serviceData, data)
+	if entityID != "" {
+		serviceData["entity_id"] = entityID
+	}
+	body, err := json.Marshal(serviceData)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/api/services/%s/%s", c.BaseURL, domain, service)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s.%s failed (%d): %s", domain, service, resp.StatusCode, respBody)
+	}
+	return nil
+}
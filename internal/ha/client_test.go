@@ -0,0 +1,49 @@
+package ha
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHAClientEntityIDs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/states", r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(`[{"entity_id":"sensor.solar_power","state":"1200"},{"entity_id":"switch.miner"}]`))
+	}))
+	defer server.Close()
+
+	ids, err := NewClient(server.URL+"/", "secret").EntityIDs(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sensor.solar_power", "switch.miner"}, ids)
+}
+
+func TestHAClientEntityIDsUnauthorized(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "401: Unauthorized", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	_, err := NewClient(server.URL, "bad").EntityIDs(context.Background())
+	assert.ErrorContains(t, err, "401")
+}
+
+func TestHAClientCallService(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/services/select/select_option", r.URL.Path)
+		var body map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, map[string]any{"entity_id": "select.miner", "option": "Eco"}, body)
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	err := NewClient(server.URL, "t").CallService(context.Background(),
+		"select", "select_option", "select.miner", map[string]any{"option": "Eco"})
+	assert.NoError(t, err)
+}
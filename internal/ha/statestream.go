@@ -0,0 +1,42 @@
+package ha
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Slugify converts a name to the id Home Assistant derives from it: lowercase, with
+// every run of other characters collapsed to one underscore ("Battery 10" →
+// "battery_10", "Solar 3/4" → "solar_3_4").
+func Slugify(name string) string {
+	var b strings.Builder
+	pending := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if pending && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			pending = false
+			b.WriteRune(r)
+			continue
+		}
+		pending = true
+	}
+	return b.String()
+}
+
+// StatestreamTopic returns the topic HA statestream publishes an entity's state (or,
+// with another attribute, that attribute) on.
+func StatestreamTopic(domain, objectID, attribute string) string {
+	return "homeassistant/" + domain + "/" + objectID + "/" + attribute
+}
+
+// EntityStateTopic returns the statestream state topic for an entity ID such as
+// "switch.inverter_1", or "" if it has no domain.
+func EntityStateTopic(entityID string) string {
+	domain, objectID, ok := strings.Cut(entityID, ".")
+	if !ok {
+		return ""
+	}
+	return StatestreamTopic(domain, objectID, "state")
+}
@@ -0,0 +1,24 @@
+package ha
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlugify(t *testing.T) {
+	for name, want := range map[string]string{
+		"Battery 2":         "battery_2",
+		"Battery 10":        "battery_10",
+		"Solar 3/4":         "solar_3_4",
+		"  Powerhouse  Inv": "powerhouse_inv",
+		"State of Charge!":  "state_of_charge",
+	} {
+		assert.Equal(t, want, Slugify(name), name)
+	}
+}
+
+func TestEntityStateTopic(t *testing.T) {
+	assert.Equal(t, "homeassistant/switch/inverter_1/state", EntityStateTopic("switch.inverter_1"))
+	assert.Equal(t, "", EntityStateTopic("inverter_1"))
+}
@@ -0,0 +1,139 @@
+package stats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// DefaultCounterStatePath is where counter offsets are kept unless --counter-state overrides it.
+const DefaultCounterStatePath = "powerctl-counters.json"
+
+// counterResetFraction splits drops: a counter falling below this fraction of its last
+// reading was reset; a smaller drop is noise, and the counter holds its value instead
+// of going backwards.
+const counterResetFraction = 0.5
+
+// counterFlushInterval is how often counter progress is saved between resets.
+const counterFlushInterval = time.Minute
+
+// CounterState is a counter's correction, persisted so offsets survive restarts (and
+// a reset while powerctl was down is still seen against LastRaw).
+type CounterState struct {
+	Offset    float64 `json:"offset"`     // Added to raw readings: the totals of earlier resets
+	LastRaw   float64 `json:"last_raw"`   // Latest raw reading
+	ResetFrom float64 `json:"reset_from"` // Raw reading before the latest reset, until confirmed
+}
+
+// EnergyCounters keeps cumulative energy counters monotonic. A Shelly that reboots
+// starts its counter again from zero, which would read as a huge negative flow; the
+// total before the reset is carried forward as an offset instead. A reading back at
+// the old level straight after a "reset" was a glitch (a transient 0) and undoes it;
+// the first increase from the new level confirms it. A nil *EnergyCounters passes
+// readings through. Used only by the stats worker.
+type EnergyCounters struct {
+	path   string // empty keeps offsets in memory only
+	topics map[string]bool
+	state  map[string]*CounterState
+	dirty  bool
+	saved  time.Time
+}
+
+// LoadEnergyCounters tracks topics, restoring offsets from path if it exists.
+func LoadEnergyCounters(path string, topics []string) (*EnergyCounters, error) {
+	c := &EnergyCounters{path: path, topics: make(map[string]bool), state: make(map[string]*CounterState)}
+	for _, topic := range topics {
+		c.topics[topic] = true
+	}
+	if path == "" {
+		return c, nil
+	}
+	raw, err := os.ReadFile(path) //nolint:gosec // operator-set state file path
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &c.state); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Correct returns the monotonic value for a raw reading on topic, and commit to record
+// the reading once it has been accepted: a rejected reading (see DataQuality) must not
+// move the counter, or the next good one would look like a reset.
+func (c *EnergyCounters) Correct(topic string, raw float64, now time.Time) (value float64, commit func()) {
+	if c == nil || !c.topics[topic] {
+		return raw, func() {}
+	}
+	prev, ok := c.state[topic]
+	if !ok {
+		return raw, func() { c.update(topic, CounterState{LastRaw: raw}, now, false) }
+	}
+
+	next := *prev
+	note := "" // logged once the reading is committed
+	switch {
+	case next.ResetFrom > 0 && raw >= next.ResetFrom*counterResetFraction:
+		note = fmt.Sprintf("%s back at %g, undoing the reset from %g", topic, raw, next.ResetFrom)
+		next.Offset -= next.ResetFrom
+		next.ResetFrom = 0
+	case raw < next.LastRaw*counterResetFraction:
+		note = fmt.Sprintf("%s reset from %g to %g, carrying %g forward", topic, next.LastRaw, raw, next.LastRaw)
+		next.Offset += next.LastRaw
+		next.ResetFrom = next.LastRaw
+	case raw < next.LastRaw:
+		return next.LastRaw + next.Offset, func() {} // jitter: hold rather than go backwards
+	case raw > next.LastRaw:
+		next.ResetFrom = 0 // counting up, so any reset from the new level was real
+	}
+	next.LastRaw = raw
+	return raw + next.Offset, func() {
+		if note != "" {
+			log.Printf("Energy counters: %s\n", note)
+		}
+		c.update(topic, next, now, note != "")
+	}
+}
+
+// update records a counter's new state, saving at once (offsets changed) if force is set.
+func (c *EnergyCounters) update(topic string, state CounterState, now time.Time, force bool) {
+	if prev, ok := c.state[topic]; ok && *prev == state {
+		return
+	}
+	c.state[topic] = &state
+	c.dirty = true
+	c.flush(now, force)
+}
+
+// Flush saves progress made since the last save, at most every counterFlushInterval.
+func (c *EnergyCounters) Flush(now time.Time) {
+	if c != nil {
+		c.flush(now, false)
+	}
+}
+
+// flush saves the state if it changed and force is set or counterFlushInterval has
+// passed. Write errors are logged; the next flush retries.
+func (c *EnergyCounters) flush(now time.Time, force bool) {
+	if c.path == "" || !c.dirty || (!force && now.Sub(c.saved) < counterFlushInterval) {
+		return
+	}
+	payload, err := json.Marshal(c.state)
+	if err == nil {
+		tmp := c.path + ".tmp"
+		if err = os.WriteFile(tmp, payload, 0o600); err == nil {
+			err = os.Rename(tmp, c.path)
+		}
+	}
+	if err != nil {
+		log.Printf("Energy counters: save %s: %v\n", c.path, err)
+		return
+	}
+	c.dirty, c.saved = false, now
+}
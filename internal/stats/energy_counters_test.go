@@ -0,0 +1,73 @@
+package stats
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// feed corrects and commits each raw reading, returning the corrected values.
+func feed(c *EnergyCounters, topic string, now time.Time, raws ...float64) []float64 {
+	var out []float64
+	for _, raw := range raws {
+		value, commit := c.Correct(topic, raw, now)
+		commit()
+		out = append(out, value)
+	}
+	return out
+}
+
+func TestEnergyCounters_Reset(t *testing.T) {
+	c, err := LoadEnergyCounters("", []string{"t/energy"})
+	assert.NoError(t, err)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// A reboot restarts the counter from zero; the old total is carried forward
+	assert.Equal(t, []float64{100, 100.5, 100.5, 100.7, 101}, feed(c, "t/energy", now, 100, 100.5, 0, 0.2, 0.5))
+	// Small drops are jitter and hold the value
+	assert.Equal(t, []float64{101, 101.1}, feed(c, "t/energy", now, 0.45, 0.6))
+	// Untracked topics pass through
+	assert.Equal(t, []float64{5, 1}, feed(c, "t/other", now, 5, 1))
+}
+
+func TestEnergyCounters_TransientZeroIsUndone(t *testing.T) {
+	c, _ := LoadEnergyCounters("", []string{"t/energy"})
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, []float64{100, 100, 100, 100.2}, feed(c, "t/energy", now, 100, 0, 100, 100.2))
+}
+
+func TestEnergyCounters_UncommittedReadingsDontMove(t *testing.T) {
+	c, _ := LoadEnergyCounters("", []string{"t/energy"})
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	feed(c, "t/energy", now, 100)
+
+	// A 10x jump rejected downstream must not make the next good reading a "reset"
+	value, _ := c.Correct("t/energy", 1000, now)
+	assert.Equal(t, 1000.0, value)
+	assert.Equal(t, []float64{100.1}, feed(c, "t/energy", now, 100.1))
+}
+
+func TestEnergyCounters_PersistsOffsets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counters.json")
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	c, err := LoadEnergyCounters(path, []string{"t/energy"})
+	assert.NoError(t, err)
+	feed(c, "t/energy", now, 100, 0.5) // the reset is saved at once
+
+	// Restarted: the offset carries on
+	c, err = LoadEnergyCounters(path, []string{"t/energy"})
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{100.5, 100.6}, feed(c, "t/energy", now.Add(time.Hour), 0.5, 0.6))
+	c.Flush(now.Add(2 * time.Hour))
+
+	// Restarted again, and the Shelly rebooted while powerctl was down
+	c, _ = LoadEnergyCounters(path, []string{"t/energy"})
+	assert.Equal(t, []float64{100.8}, feed(c, "t/energy", now.Add(3*time.Hour), 0.2))
+
+	assert.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+	_, err = LoadEnergyCounters(path, nil)
+	assert.Error(t, err)
+}
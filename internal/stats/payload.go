@@ -0,0 +1,43 @@
+package stats
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParsedPayload is a statestream payload as classified by ParsePayload.
+type ParsedPayload struct {
+	Raw     string // payload without surrounding whitespace
+	Float   float64
+	IsFloat bool
+	Bool    bool
+	IsBool  bool
+}
+
+// ParsePayload classifies a payload as a number, a boolean or a plain string. Surrounding
+// whitespace is ignored, numbers may use scientific notation or carry the topic's unit
+// as a suffix ("53.2 V" with unit "V", "80%" with unit "%"), and on/off/true/false match
+// in any case. A number with any other suffix, NaN and infinities are not numbers.
+func ParsePayload(value, unit string) ParsedPayload {
+	p := ParsedPayload{Raw: strings.TrimSpace(value)}
+
+	number := p.Raw
+	if unit != "" {
+		if n, ok := strings.CutSuffix(number, unit); ok {
+			number = strings.TrimSpace(n)
+		}
+	}
+	if f, err := strconv.ParseFloat(number, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+		p.Float, p.IsFloat = f, true
+		return p
+	}
+
+	switch strings.ToLower(p.Raw) {
+	case "on", "true":
+		p.Bool, p.IsBool = true, true
+	case "off", "false":
+		p.IsBool = true
+	}
+	return p
+}
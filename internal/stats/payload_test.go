@@ -0,0 +1,72 @@
+package stats
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePayload(t *testing.T) {
+	for _, tc := range []struct {
+		in    string
+		unit  string
+		float float64
+	}{
+		{"53.2", "", 53.2},
+		{" 53.2\n", "", 53.2},
+		{"1.5e3", "", 1500},
+		{"53.2", "V", 53.2},
+		{"53.2 V", "V", 53.2},
+		{"80%", "%", 80},
+		{"-1.2 kW", "kW", -1.2},
+	} {
+		p := ParsePayload(tc.in, tc.unit)
+		assert.True(t, p.IsFloat, tc.in)
+		assert.Equal(t, tc.float, p.Float, tc.in)
+	}
+
+	// A suffix other than the topic's unit would be read at the wrong scale
+	for _, tc := range []struct{ in, unit string }{
+		{"53.2 V", ""}, {"1200 W", "kW"}, {"5 kWh", "Wh"}, {"21.5 °C", "%"},
+	} {
+		p := ParsePayload(tc.in, tc.unit)
+		assert.False(t, p.IsFloat, tc.in)
+		assert.False(t, p.IsBool, tc.in)
+	}
+
+	for _, tc := range []struct {
+		in   string
+		want bool
+	}{
+		{"on", true}, {"ON", true}, {"true", true}, {" off ", false}, {"False", false},
+	} {
+		p := ParsePayload(tc.in, "")
+		assert.True(t, p.IsBool, tc.in)
+		assert.Equal(t, tc.want, p.Bool, tc.in)
+	}
+
+	for _, in := range []string{"Float Charging", "NaN", "-Inf", "", "[]", "1.2.3 V"} {
+		p := ParsePayload(in, "V")
+		assert.False(t, p.IsFloat, in)
+		assert.False(t, p.IsBool, in)
+	}
+}
+
+func FuzzParsePayload(f *testing.F) {
+	for _, seed := range []string{"53.2", " 1e-3 ", "53.2 V", "80%", "on", "FALSE", "NaN", "Bulk Charging", "[]", "°"} {
+		f.Add(seed, "V")
+	}
+	f.Fuzz(func(t *testing.T, in, unit string) {
+		p := ParsePayload(in, unit)
+		assert.False(t, p.IsFloat && p.IsBool, "both a number and a boolean")
+		assert.Equal(t, strings.TrimSpace(in), p.Raw)
+		if p.IsFloat {
+			assert.False(t, math.IsNaN(p.Float) || math.IsInf(p.Float, 0), "non-finite %v", p.Float)
+			again := ParsePayload(strconv.FormatFloat(p.Float, 'g', -1, 64), "")
+			assert.Equal(t, p.Float, again.Float, "round trip")
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package stats
+
+import (
+	"cmp"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Window constants for percentile lookups
+const (
+	Window1Min  = time.Minute
+	Window5Min  = 5 * time.Minute
+	Window15Min = 15 * time.Minute
+)
+
+// Percentile constants for percentile lookups
+const (
+	P1   = 1
+	P25  = 25
+	P50  = 50
+	P66  = 66
+	P75  = 75
+	P90  = 90
+	P99  = 99
+	P100 = 100
+)
+
+// WeightedValue represents a value with its duration weight for percentile calculation
+type WeightedValue struct {
+	value    float64
+	duration float64
+}
+
+// CalculateSelectedPercentile calculates a single time-weighted percentile for a window.
+// The percentile parameter should be 1, 50, 66, or 99.
+func CalculateSelectedPercentile(
+	pairs []WeightedValue,
+	totalDuration float64,
+	percentile int,
+	fallbackValue float64,
+) float64 {
+	if len(pairs) == 0 {
+		return fallbackValue
+	}
+	if len(pairs) == 1 {
+		return pairs[0].value
+	}
+
+	target := totalDuration * float64(percentile) / 100.0
+	var cumulative float64
+
+	for _, pair := range pairs {
+		cumulative += pair.duration
+		if cumulative >= target {
+			return pair.value
+		}
+	}
+
+	return pairs[len(pairs)-1].value
+}
+
+// PrepareWindowData filters readings for a time window and prepares sorted weighted pairs.
+// Readings are in time order, so the window is a suffix found by binary search. Pairs are
+// built in buf's storage (nil allocates). Returns the sorted pairs, total duration, and
+// fallback value for empty windows.
+func PrepareWindowData(
+	buf []WeightedValue,
+	readings Readings,
+	windowDuration time.Duration,
+	now time.Time,
+) (pairs []WeightedValue, totalDuration float64, fallbackValue float64) {
+	if len(readings) == 0 {
+		return nil, 0, 0
+	}
+
+	// Capture last reading for fallback
+	lastReading := readings[len(readings)-1]
+	fallbackValue = lastReading.Value
+
+	cutoff := now.Add(-windowDuration)
+
+	// Readings within the window
+	start := sort.Search(len(readings), func(i int) bool {
+		return readings[i].Timestamp.After(cutoff)
+	})
+	windowReadings := readings[start:]
+
+	// If 0 or 1 readings in window, use fallback
+	if len(windowReadings) <= 1 {
+		return nil, 0, fallbackValue
+	}
+
+	// Build weighted value pairs
+	pairs = buf[:0]
+	for i := 0; i < len(windowReadings); i++ {
+		value := windowReadings[i].Value
+
+		var duration float64
+		if i < len(windowReadings)-1 {
+			duration = windowReadings[i+1].Timestamp.Sub(windowReadings[i].Timestamp).Seconds()
+		} else {
+			duration = now.Sub(windowReadings[i].Timestamp).Seconds()
+		}
+
+		pairs = append(pairs, WeightedValue{value: value, duration: duration})
+		totalDuration += duration
+	}
+
+	// Sort pairs by value for percentile calculation
+	slices.SortFunc(pairs, func(a, b WeightedValue) int {
+		return cmp.Compare(a.value, b.value)
+	})
+
+	return pairs, totalDuration, fallbackValue
+}
@@ -0,0 +1,99 @@
+package stats
+
+import (
+	"time"
+)
+
+// ReadingsRetention is how long raw readings are kept. Percentile windows up to this
+// length are computed from them; longer windows use a governor.RollingPercentile.
+const ReadingsRetention = 15 * time.Minute
+
+// Reading represents a timestamped sensor reading
+type Reading struct {
+	Value     float64
+	Timestamp time.Time
+}
+
+// Readings is a collection of timestamped readings
+type Readings []Reading
+
+// ReadingRing holds a topic's last ReadingsRetention of readings in a circular buffer,
+// oldest first. Push evicts readings that have aged out, so storage is reused rather
+// than re-appended and periodically rebuilt; it only grows when a topic publishes
+// faster than it has before.
+type ReadingRing struct {
+	buf   []Reading
+	head  int // index of the oldest reading
+	count int
+}
+
+// Push adds a reading (timestamps must not go backwards) and evicts any older than
+// ReadingsRetention before it.
+func (r *ReadingRing) Push(reading Reading) {
+	cutoff := reading.Timestamp.Add(-ReadingsRetention)
+	for r.count > 0 && !r.buf[r.head].Timestamp.After(cutoff) {
+		r.head = (r.head + 1) % len(r.buf)
+		r.count--
+	}
+	if r.count == len(r.buf) {
+		buf := make([]Reading, max(16, 2*len(r.buf)))
+		r.AppendTo(buf[:0])
+		r.buf, r.head = buf, 0
+	}
+	r.buf[(r.head+r.count)%len(r.buf)] = reading
+	r.count++
+}
+
+// Len returns the number of readings held.
+func (r *ReadingRing) Len() int {
+	return r.count
+}
+
+// AppendTo appends the readings to dst, oldest first.
+func (r *ReadingRing) AppendTo(dst Readings) Readings {
+	end := r.head + r.count
+	if end <= len(r.buf) {
+		return append(dst, r.buf[r.head:end]...)
+	}
+	dst = append(dst, r.buf[r.head:]...)
+	return append(dst, r.buf[:end-len(r.buf)]...)
+}
+
+// Downsampler thins a topic's readings to at most three per interval: the first, then
+// the minimum and maximum of the rest in time order, so percentiles keep the extremes
+// without every sample. The first is stored at once, so a topic that publishes rarely is
+// unaffected; the rest are released by the first reading after the interval ends.
+type Downsampler struct {
+	Interval time.Duration
+	start    time.Time
+	lo, hi   Reading
+	held     bool // lo and hi hold readings after the first
+}
+
+// Add takes a reading and appends to out whatever should now be stored.
+func (d *Downsampler) Add(reading Reading, out []Reading) []Reading {
+	if !d.start.IsZero() && reading.Timestamp.Sub(d.start) < d.Interval {
+		switch {
+		case !d.held:
+			d.lo, d.hi, d.held = reading, reading, true
+		case reading.Value < d.lo.Value:
+			d.lo = reading
+		case reading.Value > d.hi.Value:
+			d.hi = reading
+		}
+		return out
+	}
+
+	if d.held {
+		switch {
+		case d.lo == d.hi:
+			out = append(out, d.lo)
+		case d.lo.Timestamp.Before(d.hi.Timestamp):
+			out = append(out, d.lo, d.hi)
+		default:
+			out = append(out, d.hi, d.lo)
+		}
+	}
+	d.start, d.held = reading.Timestamp, false
+	return append(out, reading)
+}
@@ -0,0 +1,66 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadingRing_EvictsAgedOutReadings(t *testing.T) {
+	now := time.Now()
+	ring := &ReadingRing{}
+	for i := range 20 {
+		ring.Push(Reading{Value: float64(i), Timestamp: now.Add(time.Duration(i) * time.Minute)})
+	}
+	// At minute 19 the retention keeps readings after minute 4
+	readings := ring.AppendTo(nil)
+	assert.Equal(t, 15, ring.Len())
+	assert.Equal(t, 5.0, readings[0].Value)
+	assert.Equal(t, 19.0, readings[len(readings)-1].Value)
+}
+
+func TestReadingRing_WrapsAndGrowsInOrder(t *testing.T) {
+	now := time.Now()
+	ring := &ReadingRing{}
+	for i := range 40 {
+		ring.Push(Reading{Value: float64(i), Timestamp: now.Add(time.Duration(i) * time.Minute)})
+	}
+	capacity := len(ring.buf)
+	// One reading a second: the ring grows past its wrapped-around capacity
+	for i := range 100 {
+		ring.Push(Reading{Value: float64(100 + i), Timestamp: now.Add(40*time.Minute + time.Duration(i)*time.Second)})
+	}
+	assert.Greater(t, len(ring.buf), capacity)
+
+	readings := ring.AppendTo(nil)
+	assert.Equal(t, ring.Len(), len(readings))
+	for i := 1; i < len(readings); i++ {
+		assert.True(t, readings[i].Timestamp.After(readings[i-1].Timestamp), "oldest first")
+	}
+	assert.Equal(t, 199.0, readings[len(readings)-1].Value)
+}
+
+func TestDownsampler_KeepsIntervalExtremesInOrder(t *testing.T) {
+	now := time.Now()
+	d := &Downsampler{Interval: 2 * time.Second}
+	at := func(ms int, value float64) Reading {
+		return Reading{Value: value, Timestamp: now.Add(time.Duration(ms) * time.Millisecond)}
+	}
+
+	stored := d.Add(at(0, 50), nil)
+	assert.Equal(t, []Reading{at(0, 50)}, stored, "an interval's first reading is stored at once")
+
+	stored = nil
+	for _, r := range []Reading{at(300, 52), at(600, 49), at(900, 50)} {
+		stored = d.Add(r, stored)
+	}
+	assert.Empty(t, stored, "interval still open")
+
+	stored = d.Add(at(2000, 50), nil)
+	assert.Equal(t, []Reading{at(300, 52), at(600, 49), at(2000, 50)}, stored,
+		"max then min, as they happened, then the next interval's first")
+
+	stored = d.Add(at(4500, 51), nil)
+	assert.Equal(t, []Reading{at(4500, 51)}, stored, "nothing held from a one-reading interval")
+}
@@ -0,0 +1,28 @@
+package stats
+
+// JSONTopicData holds a JSON document topic (e.g. an HA attribute published by
+// statestream), decoded once by the stats worker when it arrives rather than by every
+// reader on every broadcast.
+type JSONTopicData struct {
+	Raw   string
+	Value any // as returned by the topic's registered decoder
+}
+
+// FloatTopicData holds the current value for a float topic, plus its exponential
+// moving average and rate of change (units/s) as of the latest reading
+type FloatTopicData struct {
+	Current float64
+	EMA     float64 // Time constant set by the stats worker
+	Rate    float64 // Smoothed derivative; multiply by 60 for per-minute
+}
+
+// StringTopicData holds current value for a string topic
+type StringTopicData struct {
+	Current string
+}
+
+// BooleanTopicData holds current value for a boolean topic (on/off switches)
+type BooleanTopicData struct {
+	Current bool
+	Raw     string
+}
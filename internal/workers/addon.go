@@ -0,0 +1,222 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ryansname/powerctl/internal/ha"
+	"github.com/ryansname/powerctl/internal/stats"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// Paths and endpoints the Home Assistant Supervisor provides inside an add-on container.
+const (
+	addonOptionsPath   = "/data/options.json"
+	addonDataDir       = "/data"
+	supervisorURL      = "http://supervisor"
+	supervisorTokenEnv = "SUPERVISOR_TOKEN"
+)
+
+// runningAsAddon reports whether powerctl is running as a Home Assistant add-on: the
+// Supervisor injects SUPERVISOR_TOKEN into add-on containers.
+func runningAsAddon() bool {
+	return os.Getenv(supervisorTokenEnv) != ""
+}
+
+// AddonOptions is the add-on's options form (addon/config.yaml), written by the
+// Supervisor to /data/options.json. Args and Env map it onto the daemon's flags and
+// environment variables; empty options keep the daemon's defaults.
+type AddonOptions struct {
+	ForceEnable       bool   `json:"force_enable"`
+	WatchdogExit      bool   `json:"watchdog_exit"`
+	ServiceCalls      string `json:"service_calls"`
+	TeslaAPI          string `json:"tesla_api"`
+	Failsafe          string `json:"failsafe"`
+	FailsafeAfter     string `json:"failsafe_after"`
+	FailsafeNotify    string `json:"failsafe_notify"`
+	SummaryNotify     string `json:"summary_notify"`
+	DiscoverInverters string `json:"discover_inverters"`
+	ExcessPolicy      string `json:"excess_policy"`
+	TOUTariff         string `json:"tou_tariff"`
+	TOUSchedule       string `json:"tou_schedule"`
+	ThresholdProfiles string `json:"threshold_profiles"`
+	TopicQoS          string `json:"topic_qos"`
+	BatteryHardware   string `json:"battery_hardware"`
+	ExportPrice       string `json:"export_price"`
+	ChargePower       string `json:"charge_power"`
+	GridPower         string `json:"grid_power"`
+	ImportPrice       string `json:"import_price"`
+	StormWarning      string `json:"storm_warning"`
+	CurtailmentSignal string `json:"curtailment_signal"`
+	ExportLimit       *int   `json:"export_limit"` // W; nil keeps the run default
+
+	MQTTClientID      string `json:"mqtt_client_id"`
+	SolcastAPIKey     string `json:"solcast_api_key"`
+	SolcastResourceID string `json:"solcast_resource_id"`
+	MetricsWriteURL   string `json:"metrics_write_url"`
+	MetricsToken      string `json:"metrics_token"`
+	APIToken          string `json:"api_token"` // Enables the control API on port 8086
+	TeslaClientID     string `json:"tesla_client_id"`
+	TeslaRefreshToken string `json:"tesla_refresh_token"`
+}
+
+// loadAddonOptions reads the Supervisor's options file.
+func loadAddonOptions(path string) (AddonOptions, error) {
+	raw, err := os.ReadFile(path) //nolint:gosec // fixed Supervisor path
+	if err != nil {
+		return AddonOptions{}, err
+	}
+	var opts AddonOptions
+	if err := json.Unmarshal(raw, &opts); err != nil {
+		return AddonOptions{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return opts, nil
+}
+
+// Args returns the run flags for the options. State files go under /data, which the
+// Supervisor keeps across restarts and updates.
+func (o AddonOptions) Args() []string {
+	args := []string{
+		"--audit-log=" + addonDataDir + "/" + defaultAuditLogPath,
+		"--mqtt-session-dir=" + addonDataDir + "/mqtt-session",
+		"--counter-state=" + addonDataDir + "/" + stats.DefaultCounterStatePath,
+		"--crash-dir=" + addonDataDir + "/" + defaultCrashDir,
+	}
+	if o.ForceEnable {
+		args = append(args, "--force-enable")
+	}
+	if o.WatchdogExit {
+		args = append(args, "--watchdog-exit")
+	}
+	for _, f := range []struct{ flag, value string }{
+		{"service-calls", o.ServiceCalls},
+		{"tesla-api", o.TeslaAPI},
+		{"failsafe", o.Failsafe},
+		{"failsafe-after", o.FailsafeAfter},
+		{"failsafe-notify", o.FailsafeNotify},
+		{"summary-notify", o.SummaryNotify},
+		{"discover-inverters", o.DiscoverInverters},
+		{"excess-policy", o.ExcessPolicy},
+		{"tou-tariff", o.TOUTariff},
+		{"tou-schedule", o.TOUSchedule},
+		{"threshold-profiles", o.ThresholdProfiles},
+		{"topic-qos", o.TopicQoS},
+		{"battery-hardware", o.BatteryHardware},
+		{"export-price", o.ExportPrice},
+		{"charge-power", o.ChargePower},
+		{"grid-power", o.GridPower},
+		{"import-price", o.ImportPrice},
+		{"storm-warning", o.StormWarning},
+		{"curtailment-signal", o.CurtailmentSignal},
+	} {
+		if f.value != "" {
+			args = append(args, "--"+f.flag+"="+f.value)
+		}
+	}
+	if o.ExportLimit != nil {
+		args = append(args, "--export-limit="+strconv.Itoa(*o.ExportLimit))
+	}
+	return args
+}
+
+// Env returns the environment variables for the options' credentials and endpoints.
+func (o AddonOptions) Env() map[string]string {
+	env := map[string]string{
+		"TESLA_TOKEN_FILE": addonDataDir + "/tesla_refresh_token",
+	}
+	for name, value := range map[string]string{
+		"MQTT_CLIENT_ID":      o.MQTTClientID,
+		"SOLCAST_API_KEY":     o.SolcastAPIKey,
+		"SOLCAST_RESOURCE_ID": o.SolcastResourceID,
+		"METRICS_WRITE_URL":   o.MetricsWriteURL,
+		"METRICS_TOKEN":       o.MetricsToken,
+		"API_TOKEN":           o.APIToken,
+		"TESLA_CLIENT_ID":     o.TeslaClientID,
+		"TESLA_REFRESH_TOKEN": o.TeslaRefreshToken,
+	} {
+		if value != "" {
+			env[name] = value
+		}
+	}
+	if o.APIToken != "" {
+		env["API_ADDR"] = ":8086"
+	}
+	return env
+}
+
+// SupervisorMQTT is the broker the Supervisor's MQTT service (the Mosquitto add-on)
+// hands out to add-ons declaring `services: mqtt:need`.
+type SupervisorMQTT struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// fetchSupervisorMQTT asks the Supervisor for the MQTT service's connection details.
+func fetchSupervisorMQTT(ctx context.Context, baseURL, token string) (SupervisorMQTT, error) {
+	ctx, cancel := context.WithTimeout(ctx, ha.RequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/services/mqtt", nil)
+	if err != nil {
+		return SupervisorMQTT{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return SupervisorMQTT{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return SupervisorMQTT{}, fmt.Errorf("supervisor MQTT service request failed (%d): %s", resp.StatusCode, body)
+	}
+
+	var envelope struct {
+		Result string         `json:"result"`
+		Data   SupervisorMQTT `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return SupervisorMQTT{}, fmt.Errorf("decode supervisor MQTT service: %w", err)
+	}
+	if envelope.Result != "ok" || envelope.Data.Host == "" {
+		return SupervisorMQTT{}, fmt.Errorf("supervisor has no MQTT service (result %q)", envelope.Result)
+	}
+	return envelope.Data, nil
+}
+
+// setupAddon prepares the daemon to run as an add-on: it reads the options file and
+// the Supervisor's MQTT service, exports them (and the Supervisor's HA API proxy, for
+// --service-calls=native and sankey validation) as environment variables unless
+// already set, and returns the flags to put before the command line's own.
+func setupAddon(ctx context.Context) ([]string, error) {
+	opts, err := loadAddonOptions(addonOptionsPath)
+	if err != nil {
+		return nil, err
+	}
+	token := os.Getenv(supervisorTokenEnv)
+	broker, err := fetchSupervisorMQTT(ctx, supervisorURL, token)
+	if err != nil {
+		return nil, err
+	}
+
+	env := opts.Env()
+	env["MQTT_HOST"] = broker.Host
+	env["MQTT_PORT"] = strconv.Itoa(broker.Port)
+	env["MQTT_USERNAME"] = broker.Username
+	env["MQTT_PASSWORD"] = broker.Password
+	env["HA_URL"] = supervisorURL + "/core"
+	env["HA_TOKEN"] = token
+	for name, value := range env {
+		if _, set := os.LookupEnv(name); !set {
+			if err := os.Setenv(name, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return opts.Args(), nil
+}
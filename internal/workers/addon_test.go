@@ -0,0 +1,84 @@
+package workers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddonOptions_ArgsAndEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "options.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{
+		"force_enable": false,
+		"watchdog_exit": true,
+		"service_calls": "native",
+		"failsafe": "queue-off",
+		"summary_notify": "",
+		"threshold_profiles": "/config/profiles.json",
+		"battery_hardware": "/config/hardware.json",
+		"export_price": "sensor.amber_feed_in_price",
+		"charge_power": "sensor.solar_5_solar_power",
+		"grid_power": "sensor.home_sweet_home_site_power",
+		"import_price": "sensor.amber_general_price",
+		"storm_warning": "binary_sensor.bom_severe_weather",
+		"curtailment_signal": "binary_sensor.sapn_curtailment",
+		"export_limit": 3000,
+		"solcast_api_key": "key",
+		"api_token": "secret"
+	}`), 0o600))
+	opts, err := loadAddonOptions(path)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"--audit-log=/data/powerctl-audit.db",
+		"--mqtt-session-dir=/data/mqtt-session",
+		"--counter-state=/data/powerctl-counters.json",
+		"--crash-dir=/data/powerctl-crashes",
+		"--watchdog-exit",
+		"--service-calls=native",
+		"--failsafe=queue-off",
+		"--threshold-profiles=/config/profiles.json",
+		"--battery-hardware=/config/hardware.json",
+		"--export-price=sensor.amber_feed_in_price",
+		"--charge-power=sensor.solar_5_solar_power",
+		"--grid-power=sensor.home_sweet_home_site_power",
+		"--import-price=sensor.amber_general_price",
+		"--storm-warning=binary_sensor.bom_severe_weather",
+		"--curtailment-signal=binary_sensor.sapn_curtailment",
+		"--export-limit=3000",
+	}, opts.Args())
+	assert.Equal(t, map[string]string{
+		"TESLA_TOKEN_FILE": "/data/tesla_refresh_token",
+		"SOLCAST_API_KEY":  "key",
+		"API_TOKEN":        "secret",
+		"API_ADDR":         ":8086",
+	}, opts.Env())
+
+	// No options file (not really an add-on) is an error
+	_, err = loadAddonOptions(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestFetchSupervisorMQTT(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/services/mqtt", r.URL.Path)
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, `{"result":"error","message":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"result":"ok","data":{"host":"core-mosquitto","port":1883,"ssl":false,"protocol":"3.1.1","username":"addons","password":"pw"}}`))
+	}))
+	defer server.Close()
+
+	broker, err := fetchSupervisorMQTT(context.Background(), server.URL, "token")
+	assert.NoError(t, err)
+	assert.Equal(t, SupervisorMQTT{Host: "core-mosquitto", Port: 1883, Username: "addons", Password: "pw"}, broker)
+
+	_, err = fetchSupervisorMQTT(context.Background(), server.URL, "bad")
+	assert.ErrorContains(t, err, "401")
+}
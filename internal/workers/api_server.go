@@ -0,0 +1,327 @@
+package workers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ryansname/powerctl/internal/stats"
+	"log"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entity IDs HA gives the inverter mode entities created by CreateInverterModeEntities.
+const (
+	inverterModeEntity        = "select.powerctl_inverter_mode"
+	manualInverterCountEntity = "number.powerctl_manual_inverter_count"
+)
+
+// APIConfig configures the control API. It only runs with both an address and a token.
+type APIConfig struct {
+	Addr  string // Listen address, e.g. ":8086"
+	Token string // Every request must send "Authorization: Bearer <token>"
+}
+
+// workerPauser is the part of Supervisor the API drives.
+type workerPauser interface {
+	Pause(name string) error
+	Resume(name string) error
+}
+
+// APIServer serves current state and a few control verbs over HTTP, for automations
+// and UIs that would rather not go through MQTT topics:
+//
+//	GET    /api/state                       latest value of every topic
+//	GET    /api/workers                     supervised workers and their state
+//	GET    /api/decisions                   each controller's last decision
+//	POST   /api/workers/{name}/pause        stop a worker until resumed
+//	POST   /api/workers/{name}/resume
+//	PUT    /api/manual {"count": n}         switch to manual with n Battery 2 inverters
+//	DELETE /api/manual                      back to auto
+//	POST   /api/batteries/{name}/calibrate  mark the battery full now
+//
+// Manual mode goes through the HA inverter mode entities, so HA stays the source of truth.
+type APIServer struct {
+	token          string
+	status         *WorkerStatus
+	workers        workerPauser
+	sender         *MQTTSender
+	auditLog       *AuditLog
+	calib          map[string]BatteryCalibConfig // by battery name
+	maxManualCount int
+
+	mu     sync.Mutex
+	latest *DisplayData
+}
+
+// NewAPIServer creates the API. calib lists the batteries that can be calibrated.
+func NewAPIServer(
+	token string,
+	status *WorkerStatus,
+	workers workerPauser,
+	sender *MQTTSender,
+	auditLog *AuditLog,
+	calib []BatteryCalibConfig,
+	maxManualCount int,
+) *APIServer {
+	s := &APIServer{
+		token:          token,
+		status:         status,
+		workers:        workers,
+		sender:         sender,
+		auditLog:       auditLog,
+		calib:          make(map[string]BatteryCalibConfig, len(calib)),
+		maxManualCount: maxManualCount,
+	}
+	for _, c := range calib {
+		s.calib[c.Name] = c
+	}
+	return s
+}
+
+// Update stores the latest DisplayData for the state endpoint and calibration.
+func (s *APIServer) Update(data DisplayData) {
+	s.mu.Lock()
+	s.latest = &data
+	s.mu.Unlock()
+}
+
+func (s *APIServer) data() *DisplayData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.latest
+}
+
+// Handler returns the API's routes behind token auth.
+func (s *APIServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/state", s.handleState)
+	mux.HandleFunc("GET /api/workers", s.handleWorkers)
+	mux.HandleFunc("GET /api/decisions", s.handleDecisions)
+	mux.HandleFunc("POST /api/workers/{name}/pause", s.handlePause)
+	mux.HandleFunc("POST /api/workers/{name}/resume", s.handleResume)
+	mux.HandleFunc("PUT /api/manual", s.handleSetManual)
+	mux.HandleFunc("DELETE /api/manual", s.handleClearManual)
+	mux.HandleFunc("POST /api/batteries/{name}/calibrate", s.handleCalibrate)
+	return s.authorize(mux)
+}
+
+// authorize rejects requests without the bearer token.
+func (s *APIServer) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			writeAPIError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("API: encode response: %v\n", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// topicValue is a topic's current value as JSON: floats (null if not finite), strings,
+// booleans, or the raw JSON document.
+func topicValue(td any) any {
+	switch d := td.(type) {
+	case *stats.FloatTopicData:
+		if math.IsNaN(d.Current) || math.IsInf(d.Current, 0) {
+			return nil
+		}
+		return d.Current
+	case *stats.StringTopicData:
+		return strings.Trim(d.Current, "\"")
+	case *stats.BooleanTopicData:
+		return d.Current
+	case *stats.JSONTopicData:
+		if json.Valid([]byte(d.Raw)) {
+			return json.RawMessage(d.Raw)
+		}
+		return d.Raw
+	}
+	return nil
+}
+
+func (s *APIServer) handleState(w http.ResponseWriter, _ *http.Request) {
+	data := s.data()
+	if data == nil {
+		writeAPIError(w, http.StatusServiceUnavailable, errors.New("no data received yet"))
+		return
+	}
+	topics := make(map[string]any, len(data.TopicData))
+	for topic, td := range data.TopicData {
+		topics[topic] = topicValue(td)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"topics": topics})
+}
+
+// apiWorkerInfo is a worker in the /api/workers response.
+type apiWorkerInfo struct {
+	Name      string      `json:"name"`
+	State     WorkerState `json:"state"`
+	Since     time.Time   `json:"since"`
+	Started   time.Time   `json:"started,omitzero"`
+	Restarts  int         `json:"restarts"`
+	LastPanic string      `json:"last_panic,omitempty"`
+	Requires  []string    `json:"requires,omitempty"`
+}
+
+func (s *APIServer) handleWorkers(w http.ResponseWriter, _ *http.Request) {
+	infos := s.status.Workers()
+	workers := make([]apiWorkerInfo, len(infos))
+	for i, info := range infos {
+		workers[i] = apiWorkerInfo{
+			Name:      info.Name,
+			State:     info.State,
+			Since:     info.Since,
+			Started:   info.Started,
+			Restarts:  info.Restarts,
+			LastPanic: info.LastPanic,
+			Requires:  info.Requires,
+		}
+	}
+	writeJSON(w, http.StatusOK, workers)
+}
+
+// apiDecision is a controller's last decision in the /api/decisions response. Decisions
+// JSON can't hold (NaN inputs) are sent as Go syntax strings, as the REPL's why does.
+type apiDecision struct {
+	At      time.Time `json:"at"`
+	Inputs  any       `json:"inputs"`
+	Outputs any       `json:"outputs"`
+}
+
+func decisionJSON(v any) any {
+	if _, err := json.Marshal(v); err != nil {
+		return fmt.Sprintf("%+v", v)
+	}
+	return v
+}
+
+func (s *APIServer) handleDecisions(w http.ResponseWriter, _ *http.Request) {
+	decisions := make(map[string]apiDecision)
+	for _, worker := range s.status.DecisionWorkers() {
+		if d, ok := s.status.LastDecision(worker); ok {
+			decisions[worker] = apiDecision{At: d.At, Inputs: decisionJSON(d.Inputs), Outputs: decisionJSON(d.Outputs)}
+		}
+	}
+	writeJSON(w, http.StatusOK, decisions)
+}
+
+func (s *APIServer) handlePause(w http.ResponseWriter, r *http.Request) {
+	s.workerVerb(w, r, "paused", s.workers.Pause)
+}
+
+func (s *APIServer) handleResume(w http.ResponseWriter, r *http.Request) {
+	s.workerVerb(w, r, "resumed", s.workers.Resume)
+}
+
+func (s *APIServer) workerVerb(w http.ResponseWriter, r *http.Request, done string, verb func(string) error) {
+	name := r.PathValue("name")
+	if err := verb(name); err != nil {
+		status := http.StatusConflict
+		if errors.Is(err, errUnknownWorker) {
+			status = http.StatusNotFound
+		}
+		writeAPIError(w, status, err)
+		return
+	}
+	log.Printf("API: %s %s\n", done, name)
+	writeJSON(w, http.StatusOK, map[string]string{"worker": name, "result": done})
+}
+
+func (s *APIServer) handleSetManual(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Count *int `json:"count"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("decode body: %w", err))
+		return
+	}
+	if body.Count == nil || *body.Count < 0 || *body.Count > s.maxManualCount {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("count must be 0-%d", s.maxManualCount))
+		return
+	}
+	s.sender.CallService("number", "set_value", manualInverterCountEntity, map[string]any{"value": *body.Count})
+	s.sender.CallService("select", "select_option", inverterModeEntity, map[string]any{"option": InverterModeManual})
+	log.Printf("API: manual mode with %d inverters\n", *body.Count)
+	writeJSON(w, http.StatusOK, map[string]any{"mode": InverterModeManual, "count": *body.Count})
+}
+
+func (s *APIServer) handleClearManual(w http.ResponseWriter, _ *http.Request) {
+	s.sender.CallService("select", "select_option", inverterModeEntity, map[string]any{"option": InverterModeAuto})
+	log.Println("API: inverter mode back to auto")
+	writeJSON(w, http.StatusOK, map[string]string{"mode": InverterModeAuto})
+}
+
+// handleCalibrate records a manual full-charge calibration at the current energy
+// totals, as the battery's Calibrate Full button does.
+func (s *APIServer) handleCalibrate(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	config, ok := s.calib[name]
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("unknown battery %q (have: %s)",
+			name, strings.Join(slices.Sorted(maps.Keys(s.calib)), ", ")))
+		return
+	}
+	data := s.data()
+	if data == nil {
+		writeAPIError(w, http.StatusServiceUnavailable, errors.New("no data received yet"))
+		return
+	}
+	inflows := data.SumTopics(config.InflowEnergyTopics)
+	outflows := data.SumTopics(config.OutflowEnergyTopics)
+	recordCalibration(s.sender, s.auditLog, config, "manual", 100, inflows, outflows,
+		data.GetFloat(config.BatteryVoltageTopic).Current, time.Now())
+	log.Printf("API: %s calibrated to full\n", name)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"battery":              name,
+		"calibration_inflows":  inflows,
+		"calibration_outflows": outflows,
+	})
+}
+
+// apiServerWorker serves the API until ctx is cancelled, keeping it fed with DisplayData.
+// A listen failure is logged rather than retried: the API is optional.
+func apiServerWorker(ctx context.Context, dataChan <-chan DisplayData, config APIConfig, server *APIServer) {
+	httpServer := &http.Server{
+		Addr:              config.Addr,
+		Handler:           server.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- httpServer.ListenAndServe() }()
+	log.Printf("API listening on %s\n", config.Addr)
+
+	for {
+		select {
+		case data := <-dataChan:
+			server.Update(data)
+		case err := <-serveErr:
+			log.Printf("API server stopped: %v\n", err)
+			return
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = httpServer.Shutdown(shutdownCtx)
+			return
+		}
+	}
+}
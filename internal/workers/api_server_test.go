@@ -0,0 +1,141 @@
+package workers
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ryansname/powerctl/internal/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakePauser struct{ paused []string }
+
+func (f *fakePauser) Pause(name string) error {
+	switch name {
+	case "lights-worker":
+		f.paused = append(f.paused, name)
+		return nil
+	case "mqtt-sender-worker":
+		return errNotPausable
+	}
+	return errUnknownWorker
+}
+
+func (f *fakePauser) Resume(string) error { return nil }
+
+func newTestAPI(t *testing.T) (*APIServer, chan MQTTMessage, *fakePauser) {
+	t.Helper()
+	out := make(chan MQTTMessage, 10)
+	pauser := &fakePauser{}
+	calib := BatteryCalibConfig{
+		Name:                "battery2",
+		BatteryVoltageTopic: "volts/state",
+		InflowEnergyTopics:  []string{"in/state"},
+		OutflowEnergyTopics: []string{"out/state"},
+	}
+	return NewAPIServer("secret", NewWorkerStatus(), pauser, NewMQTTSender(out), nil, []BatteryCalibConfig{calib}, 4), out, pauser
+}
+
+func apiRequest(t *testing.T, h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAPIServer_RequiresToken(t *testing.T) {
+	api, _, _ := newTestAPI(t)
+	for _, auth := range []string{"", "Bearer wrong", "secret"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/workers", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		api.Handler().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, auth)
+	}
+}
+
+func TestAPIServer_State(t *testing.T) {
+	api, _, _ := newTestAPI(t)
+	h := api.Handler()
+	assert.Equal(t, http.StatusServiceUnavailable, apiRequest(t, h, http.MethodGet, "/api/state", "").Code)
+
+	api.Update(DisplayData{TopicData: map[string]any{
+		"soc/state":   &stats.FloatTopicData{Current: 55.5},
+		"nan/state":   &stats.FloatTopicData{Current: math.NaN()},
+		"mode/state":  &stats.StringTopicData{Current: `"auto"`},
+		"on/state":    &stats.BooleanTopicData{Current: true},
+		"attrs/state": &stats.JSONTopicData{Raw: `{"a":1}`},
+	}})
+	rec := apiRequest(t, h, http.MethodGet, "/api/state", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"topics":{"soc/state":55.5,"nan/state":null,"mode/state":"auto","on/state":true,"attrs/state":{"a":1}}}`, rec.Body.String())
+}
+
+func TestAPIServer_WorkersAndDecisions(t *testing.T) {
+	api, _, pauser := newTestAPI(t)
+	h := api.Handler()
+	api.status.Declared("baseline-inverter-control", []string{"ha-entities"})
+	api.status.RecordDecision("baseline-inverter-control", map[string]float64{"soc": math.NaN()}, 3)
+
+	var workers []map[string]any
+	assert.NoError(t, json.Unmarshal(apiRequest(t, h, http.MethodGet, "/api/workers", "").Body.Bytes(), &workers))
+	assert.Equal(t, "pending", workers[0]["state"])
+	assert.Equal(t, []any{"ha-entities"}, workers[0]["requires"])
+
+	var decisions map[string]map[string]any
+	assert.NoError(t, json.Unmarshal(apiRequest(t, h, http.MethodGet, "/api/decisions", "").Body.Bytes(), &decisions))
+	assert.Equal(t, "map[soc:NaN]", decisions["baseline-inverter-control"]["inputs"])
+	assert.Equal(t, 3.0, decisions["baseline-inverter-control"]["outputs"])
+
+	assert.Equal(t, http.StatusOK, apiRequest(t, h, http.MethodPost, "/api/workers/lights-worker/pause", "").Code)
+	assert.Equal(t, []string{"lights-worker"}, pauser.paused)
+	assert.Equal(t, http.StatusConflict, apiRequest(t, h, http.MethodPost, "/api/workers/mqtt-sender-worker/pause", "").Code)
+	assert.Equal(t, http.StatusNotFound, apiRequest(t, h, http.MethodPost, "/api/workers/nope/pause", "").Code)
+}
+
+func TestAPIServer_Manual(t *testing.T) {
+	api, out, _ := newTestAPI(t)
+	h := api.Handler()
+
+	assert.Equal(t, http.StatusBadRequest, apiRequest(t, h, http.MethodPut, "/api/manual", `{"count":5}`).Code)
+	assert.Equal(t, http.StatusBadRequest, apiRequest(t, h, http.MethodPut, "/api/manual", `{}`).Code)
+	assert.Empty(t, out)
+
+	assert.Equal(t, http.StatusOK, apiRequest(t, h, http.MethodPut, "/api/manual", `{"count":2}`).Code)
+	assert.JSONEq(t, `{"domain":"number","service":"set_value","entity_id":"number.powerctl_manual_inverter_count","data":{"value":2}}`,
+		string((<-out).Payload))
+	assert.JSONEq(t, `{"domain":"select","service":"select_option","entity_id":"select.powerctl_inverter_mode","data":{"option":"manual"}}`,
+		string((<-out).Payload))
+
+	assert.Equal(t, http.StatusOK, apiRequest(t, h, http.MethodDelete, "/api/manual", "").Code)
+	assert.Contains(t, string((<-out).Payload), `"option":"auto"`)
+}
+
+func TestAPIServer_Calibrate(t *testing.T) {
+	api, out, _ := newTestAPI(t)
+	h := api.Handler()
+	api.Update(DisplayData{TopicData: map[string]any{
+		"in/state":    &stats.FloatTopicData{Current: 120.5},
+		"out/state":   &stats.FloatTopicData{Current: 98.25},
+		"volts/state": &stats.FloatTopicData{Current: 54.1},
+	}})
+
+	assert.Equal(t, http.StatusNotFound, apiRequest(t, h, http.MethodPost, "/api/batteries/battery9/calibrate", "").Code)
+	assert.Equal(t, http.StatusOK, apiRequest(t, h, http.MethodPost, "/api/batteries/battery2/calibrate", "").Code)
+	msg := <-out
+	assert.Equal(t, NewTopicBuilder("battery2").Attributes("sensor", ""), msg.Topic)
+	assert.JSONEq(t, `{"calibration_inflows":120.5,"calibration_outflows":98.25}`, string(msg.Payload))
+	msg = <-out
+	assert.Equal(t, NewTopicBuilder("battery2").Attributes("sensor", "last_calibrated"), msg.Topic)
+	assert.JSONEq(t, `{"trigger":"manual","soc":100,"inflows":120.5,"outflows":98.25,"voltage":54.1}`, string(msg.Payload))
+	msg = <-out
+	assert.Equal(t, batteryDerivedStateTopic("battery2", "last_calibrated"), msg.Topic)
+}
@@ -0,0 +1,239 @@
+package workers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// defaultAuditLogPath is the SQLite database control decisions are written to unless
+// --audit-log overrides it.
+const defaultAuditLogPath = "powerctl-audit.db"
+
+// auditTimeFormat stores times in UTC at a fixed width, so they sort as text and
+// SQLite's date functions understand them.
+const auditTimeFormat = "2006-01-02T15:04:05.000Z"
+
+// auditSchema is the audit table: one row per decision, inputs as a JSON object of the
+// key topic values (queryable with SQLite's json functions).
+const auditSchema = `
+CREATE TABLE IF NOT EXISTS audit (
+	id     INTEGER PRIMARY KEY AUTOINCREMENT,
+	time   TEXT NOT NULL,
+	worker TEXT NOT NULL,
+	action TEXT NOT NULL,
+	inputs TEXT
+);
+CREATE INDEX IF NOT EXISTS audit_worker_time ON audit (worker, time);
+`
+
+// AuditEntry is one control decision: which worker acted, what it did, and the key
+// input values it acted on.
+type AuditEntry struct {
+	Time   time.Time
+	Worker string
+	Action string
+	Inputs map[string]float64
+}
+
+// AuditLog writes control decisions to the audit table of a local SQLite database,
+// which `powerctl audit` queries. A nil *AuditLog discards everything, so workers and
+// tests can run without one.
+type AuditLog struct {
+	path    string
+	entries chan AuditEntry
+}
+
+// NewAuditLog returns an audit log writing to the database at path, or nil if path is
+// empty.
+func NewAuditLog(path string) *AuditLog {
+	if path == "" {
+		return nil
+	}
+	return &AuditLog{path: path, entries: make(chan AuditEntry, 100)}
+}
+
+// openAuditDB opens (creating if needed) the audit database at path. WAL mode and a
+// busy timeout let `powerctl audit` read while the daemon writes.
+func openAuditDB(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(auditSchema); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("create audit table in %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// Record queues a decision for writing. Never blocks: control loops must not stall
+// on disk, so entries are dropped (and logged) if the writer falls behind.
+func (a *AuditLog) Record(worker, action string, inputs map[string]float64) {
+	if a == nil {
+		return
+	}
+	entry := AuditEntry{Time: time.Now(), Worker: worker, Action: action, Inputs: inputs}
+	select {
+	case a.entries <- entry:
+	default:
+		log.Printf("Audit log: writer behind, dropped %s %q\n", worker, action)
+	}
+}
+
+// Run writes queued entries to the audit table until ctx is cancelled.
+func (a *AuditLog) Run(ctx context.Context) {
+	db, err := openAuditDB(a.path)
+	if err != nil {
+		log.Printf("Audit log: cannot open %s, decisions will not be recorded: %v\n", a.path, err)
+		<-ctx.Done()
+		return
+	}
+	defer db.Close()
+	log.Printf("Audit log writing to %s\n", a.path)
+
+	for {
+		select {
+		case entry := <-a.entries:
+			if err := insertAuditEntry(db, entry); err != nil {
+				log.Printf("Audit log: write failed: %v\n", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// insertAuditEntry adds entry to the audit table.
+func insertAuditEntry(db *sql.DB, entry AuditEntry) error {
+	var inputs sql.NullString
+	if len(entry.Inputs) > 0 {
+		b, err := json.Marshal(entry.Inputs)
+		if err != nil {
+			return err
+		}
+		inputs = sql.NullString{String: string(b), Valid: true}
+	}
+	_, err := db.Exec(
+		"INSERT INTO audit (time, worker, action, inputs) VALUES (?, ?, ?, ?)",
+		entry.Time.UTC().Format(auditTimeFormat), entry.Worker, entry.Action, inputs,
+	)
+	return err
+}
+
+// AuditQuery selects decisions from the audit table. Zero fields don't filter.
+type AuditQuery struct {
+	Worker string    // Only this worker's decisions
+	Since  time.Time // Only decisions at or after this time
+	Limit  int       // Only the most recent this many
+}
+
+// queryAuditEntries returns the decisions matching q, oldest first.
+func queryAuditEntries(db *sql.DB, q AuditQuery) ([]AuditEntry, error) {
+	since, limit := "", -1 // SQLite reads a negative LIMIT as none
+	if !q.Since.IsZero() {
+		since = q.Since.UTC().Format(auditTimeFormat)
+	}
+	if q.Limit > 0 {
+		limit = q.Limit
+	}
+	rows, err := db.Query(`
+		SELECT time, worker, action, inputs FROM audit
+		WHERE (?1 = '' OR worker = ?1) AND (?2 = '' OR time >= ?2)
+		ORDER BY id DESC LIMIT ?3`,
+		q.Worker, since, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var (
+			entry  AuditEntry
+			at     string
+			inputs sql.NullString
+		)
+		if err := rows.Scan(&at, &entry.Worker, &entry.Action, &inputs); err != nil {
+			return nil, err
+		}
+		if entry.Time, err = time.Parse(auditTimeFormat, at); err != nil {
+			return nil, fmt.Errorf("audit entry time %q: %w", at, err)
+		}
+		if inputs.Valid {
+			if err := json.Unmarshal([]byte(inputs.String), &entry.Inputs); err != nil {
+				return nil, fmt.Errorf("audit entry inputs: %w", err)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	slices.Reverse(entries)
+	return entries, nil
+}
+
+// formatAuditEntry renders an entry as one line with inputs in sorted key order.
+func formatAuditEntry(entry AuditEntry) string {
+	keys := make([]string, 0, len(entry.Inputs))
+	for k := range entry.Inputs {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s=%.2f", k, entry.Inputs[k])
+	}
+	return fmt.Sprintf("%s  %-18s %s  %s",
+		entry.Time.Local().Format("2006-01-02 15:04:05"), entry.Worker, entry.Action, strings.Join(parts, " "))
+}
+
+// runAuditCommand implements `powerctl audit`: print recent decisions and exit.
+func runAuditCommand(args []string) int {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	path := fs.String("audit-log", defaultAuditLogPath, "Audit database to read")
+	limit := fs.Int("n", 50, "Number of most recent decisions to show (0 shows all)")
+	worker := fs.String("worker", "", "Only show decisions from this worker")
+	since := fs.Duration("since", 0, "Only show decisions from this long ago onwards (e.g. 24h)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	// Don't create an empty database for a mistyped path
+	if _, err := os.Stat(*path); err != nil {
+		fmt.Fprintf(os.Stderr, "audit: %v\n", err)
+		return 1
+	}
+	db, err := openAuditDB(*path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "audit: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	q := AuditQuery{Worker: *worker, Limit: *limit}
+	if *since > 0 {
+		q.Since = time.Now().Add(-*since)
+	}
+	entries, err := queryAuditEntries(db, q)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "audit: %v\n", err)
+		return 1
+	}
+	for _, entry := range entries {
+		fmt.Println(formatAuditEntry(entry))
+	}
+	return 0
+}
@@ -0,0 +1,99 @@
+package workers
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// openTestAuditDB returns a fresh audit database holding three decisions a minute apart.
+func openTestAuditDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := openAuditDB(filepath.Join(t.TempDir(), "audit.db"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { db.Close() })
+
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	for i, entry := range []AuditEntry{
+		{Worker: "baseline", Action: "inverters 0→2", Inputs: map[string]float64{"soc": 80}},
+		{Worker: "dump-load", Action: "Miner Standby→Eco"},
+		{Worker: "baseline", Action: "inverters 2→3"},
+	} {
+		entry.Time = start.Add(time.Duration(i) * time.Minute)
+		assert.NoError(t, insertAuditEntry(db, entry))
+	}
+	return db
+}
+
+func TestQueryAuditEntries(t *testing.T) {
+	entries, err := queryAuditEntries(openTestAuditDB(t), AuditQuery{})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, "inverters 0→2", entries[0].Action, "oldest first")
+	assert.Equal(t, time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC), entries[0].Time)
+	assert.InDelta(t, 80.0, entries[0].Inputs["soc"], 1e-9)
+	assert.Nil(t, entries[1].Inputs)
+}
+
+func TestQueryAuditEntries_FilterAndLimit(t *testing.T) {
+	db := openTestAuditDB(t)
+	entries, err := queryAuditEntries(db, AuditQuery{Worker: "baseline", Limit: 1})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "inverters 2→3", entries[0].Action, "limit keeps the most recent")
+
+	entries, err = queryAuditEntries(db, AuditQuery{Since: time.Date(2025, 6, 1, 12, 1, 0, 0, time.UTC)})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "Miner Standby→Eco", entries[0].Action)
+}
+
+func TestAuditLog_RunWritesRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.db")
+	a := NewAuditLog(path)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		a.Run(ctx)
+		close(done)
+	}()
+	a.Record("baseline", "inverters 0→1", map[string]float64{"soc": 55})
+
+	db, err := openAuditDB(path)
+	if !assert.NoError(t, err) {
+		cancel()
+		return
+	}
+	defer db.Close()
+	assert.Eventually(t, func() bool {
+		entries, err := queryAuditEntries(db, AuditQuery{})
+		return err == nil && len(entries) == 1 && entries[0].Action == "inverters 0→1"
+	}, 2*time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+}
+
+func TestAuditLog_NilDiscards(t *testing.T) {
+	var a *AuditLog
+	assert.NotPanics(t, func() { a.Record("baseline", "inverters 0→1", nil) })
+	assert.Nil(t, NewAuditLog(""))
+}
+
+func TestFormatAuditEntry(t *testing.T) {
+	entry := AuditEntry{
+		Time:   time.Date(2025, 6, 1, 12, 0, 0, 0, time.Local),
+		Worker: "baseline",
+		Action: "inverters 0→2",
+		Inputs: map[string]float64{"voltage": 51.5, "soc": 80},
+	}
+	line := formatAuditEntry(entry)
+	assert.Contains(t, line, "2025-06-01 12:00:00")
+	assert.True(t, strings.HasSuffix(line, "inverters 0→2  soc=80.00 voltage=51.50"))
+}
@@ -0,0 +1,217 @@
+package workers
+
+import (
+	"github.com/ryansname/powerctl/governor"
+	"github.com/ryansname/powerctl/internal/stats"
+)
+
+// BaselineInputConfig holds the topics needed to extract BaselineInput from DisplayData.
+type BaselineInputConfig struct {
+	Battery2SOCTopic         string
+	Battery2ChargeStateTopic string
+	Battery2VoltageTopic     string
+	Battery2EnergyTopic      string
+	Solar1PowerTopic         string
+	Solar2PowerTopic         string
+	HouseLoadTopic           string
+	GridStatusTopic          string
+	ACFrequencyTopic         string
+	ForecastRemainingTopic   string
+	DetailedForecastTopic    string
+	InverterStateTopics      []string
+	Battery3SOCTopic         string
+	PowerwallSOCTopic        string
+	ExpectingPowerCutsTopic  string
+	IslandModeTopic          string
+	StormModeTopic           string
+	CurtailmentTopic         string
+	ExportPriceTopic         string // Dynamic tariff export price ($/kWh); empty disables price rules
+	TomorrowForecastTopic    string // Tomorrow's Solcast total; empty keeps the fixed drawdown reserve
+	ChargePowerTopic         string // B2 charge controller output (W); empty sizes overflow from SOC
+	GridPowerTopic           string // Site grid power (W, positive = import); empty disables GridPID and the export limit
+	EVReservedPowerTopic     string
+	InverterModeTopic        string
+	ManualInverterCountTopic string
+	DischargeDerateTopic     string // B2 temperature derate (% of inverters); empty disables
+	CellUndervoltageTopic    string // B2 BMS cell undervoltage binary sensor; empty disables
+	InverterCapTopic         string // PW2 coordinator cap on B2 inverters; empty disables
+
+	// InverterPowerTopics are each B2 inverter's measured output (W), in the order of
+	// InverterStateTopics; empty disables output feedback and dead-inverter detection
+	InverterPowerTopics []string
+}
+
+// BaselineInput holds extracted values for the baseline inverter controller.
+type BaselineInput struct {
+	Battery2SOC              float64
+	Battery2ChargeState      string
+	Battery2Voltage          float64
+	Battery2VoltageP50_5Min  float64
+	Battery2EnergyWh         float64
+	Solar1Power              float64
+	Solar1P90_15Min          float64
+	Solar2Power              float64
+	HouseLoad                float64
+	GridAvailable            bool
+	ACFrequency              float64
+	ACFreqP100_5Min          float64
+	ForecastRemainingWh      float64
+	DetailedForecast         governor.ForecastPeriods
+	InverterStates           []bool
+	Battery3SOC              float64
+	PowerwallSOC             float64
+	ExpectingPowerCuts       bool
+	IslandMode               bool
+	StormMode                bool
+	Curtailed                bool
+	HasExportPrice           bool
+	ExportPrice              float64
+	HasTomorrowForecast      bool
+	TomorrowForecastWh       float64
+	HasChargePower           bool
+	Battery2ChargePower      float64
+	HasGridPower             bool
+	GridPower                float64
+	GridExportP99_1Min       float64
+	EVReservedWatts          float64
+	ManualMode               bool
+	ManualInverterCount      int
+	SelfConsumptionMode      bool
+	HasDischargeDerate       bool
+	Battery2DischargeDerate  float64
+	Battery2CellUndervoltage bool
+	HasInverterCap           bool
+	Battery2InverterCap      int
+	HasInverterOutput        bool
+	InverterOutputWatts      float64 // sum of InverterPowerTopics
+	InverterPowers           []float64
+}
+
+// Topics returns all MQTT topics needed by the baseline controller.
+func (c BaselineInputConfig) Topics() []string {
+	topics := []string{
+		c.Battery2SOCTopic,
+		c.Battery2ChargeStateTopic,
+		c.Battery2VoltageTopic,
+		c.Battery2EnergyTopic,
+		c.Solar1PowerTopic,
+		c.Solar2PowerTopic,
+		c.HouseLoadTopic,
+		c.GridStatusTopic,
+		c.ACFrequencyTopic,
+		c.ForecastRemainingTopic,
+		c.DetailedForecastTopic,
+		c.Battery3SOCTopic,
+		c.PowerwallSOCTopic,
+		c.ExpectingPowerCutsTopic,
+		c.IslandModeTopic,
+		c.StormModeTopic,
+		c.CurtailmentTopic,
+		c.EVReservedPowerTopic,
+		c.InverterModeTopic,
+		c.ManualInverterCountTopic,
+	}
+	topics = append(topics, c.InverterStateTopics...)
+	if c.ExportPriceTopic != "" {
+		topics = append(topics, c.ExportPriceTopic)
+	}
+	if c.TomorrowForecastTopic != "" {
+		topics = append(topics, c.TomorrowForecastTopic)
+	}
+	topics = append(topics, c.InverterPowerTopics...)
+	if c.ChargePowerTopic != "" {
+		topics = append(topics, c.ChargePowerTopic)
+	}
+	if c.GridPowerTopic != "" {
+		topics = append(topics, c.GridPowerTopic)
+	}
+	if c.DischargeDerateTopic != "" {
+		topics = append(topics, c.DischargeDerateTopic)
+	}
+	if c.CellUndervoltageTopic != "" {
+		topics = append(topics, c.CellUndervoltageTopic)
+	}
+	if c.InverterCapTopic != "" {
+		topics = append(topics, c.InverterCapTopic)
+	}
+	return topics
+}
+
+// ExtractBaselineInput extracts values from DisplayData for the baseline controller.
+func ExtractBaselineInput(data DisplayData, config BaselineInputConfig) BaselineInput {
+	forecast := data.GetForecastPeriods(config.DetailedForecastTopic)
+
+	states := make([]bool, len(config.InverterStateTopics))
+	for i, topic := range config.InverterStateTopics {
+		states[i] = data.GetBoolean(topic)
+	}
+
+	gridAvailable := data.GetBoolean(config.GridStatusTopic)
+	expectingPowerCuts := data.GetBoolean(config.ExpectingPowerCutsTopic)
+
+	input := BaselineInput{
+		Battery2SOC:             data.GetFloat(config.Battery2SOCTopic).Current,
+		Battery2ChargeState:     data.GetString(config.Battery2ChargeStateTopic),
+		Battery2Voltage:         data.GetFloat(config.Battery2VoltageTopic).Current,
+		Battery2VoltageP50_5Min: data.GetPercentile(config.Battery2VoltageTopic, stats.P50, stats.Window5Min),
+		Battery2EnergyWh:        data.GetFloat(config.Battery2EnergyTopic).Current,
+		Solar1Power:             data.GetFloat(config.Solar1PowerTopic).Current,
+		Solar1P90_15Min:         data.GetPercentile(config.Solar1PowerTopic, stats.P90, stats.Window15Min),
+		Solar2Power:             data.GetFloat(config.Solar2PowerTopic).Current,
+		HouseLoad:               data.GetFloat(config.HouseLoadTopic).Current,
+		GridAvailable:           gridAvailable,
+		ACFrequency:             data.GetFloat(config.ACFrequencyTopic).Current,
+		ACFreqP100_5Min:         data.GetPercentile(config.ACFrequencyTopic, stats.P100, stats.Window5Min),
+		ForecastRemainingWh:     data.GetFloat(config.ForecastRemainingTopic).Current,
+		DetailedForecast:        forecast,
+		InverterStates:          states,
+		Battery3SOC:             data.GetFloat(config.Battery3SOCTopic).Current,
+		PowerwallSOC:            data.GetFloat(config.PowerwallSOCTopic).Current,
+		ExpectingPowerCuts:      expectingPowerCuts,
+		IslandMode:              data.GetBoolean(config.IslandModeTopic),
+		StormMode:               data.GetBoolean(config.StormModeTopic),
+		Curtailed:               data.GetBoolean(config.CurtailmentTopic),
+		EVReservedWatts:         data.GetFloat(config.EVReservedPowerTopic).Current,
+		ManualMode:              data.GetString(config.InverterModeTopic) == InverterModeManual,
+		ManualInverterCount:     int(data.GetFloat(config.ManualInverterCountTopic).Current),
+		SelfConsumptionMode:     data.GetString(config.InverterModeTopic) == InverterModeSelfConsumption,
+	}
+	if config.ExportPriceTopic != "" {
+		input.HasExportPrice = true
+		input.ExportPrice = data.GetFloat(config.ExportPriceTopic).Current
+	}
+	if config.TomorrowForecastTopic != "" {
+		input.HasTomorrowForecast = true
+		input.TomorrowForecastWh = data.GetFloat(config.TomorrowForecastTopic).Current
+	}
+	if len(config.InverterPowerTopics) > 0 {
+		input.HasInverterOutput = true
+		input.InverterPowers = make([]float64, len(config.InverterPowerTopics))
+		for i, topic := range config.InverterPowerTopics {
+			input.InverterPowers[i] = data.GetFloat(topic).Current
+			input.InverterOutputWatts += input.InverterPowers[i]
+		}
+	}
+	if config.ChargePowerTopic != "" {
+		input.HasChargePower = true
+		input.Battery2ChargePower = data.GetFloat(config.ChargePowerTopic).Current
+	}
+	if config.GridPowerTopic != "" {
+		input.HasGridPower = true
+		input.GridPower = data.GetFloat(config.GridPowerTopic).Current
+		// Export is negative grid power, so its P99 is the negated P1
+		input.GridExportP99_1Min = -data.GetPercentile(config.GridPowerTopic, stats.P1, stats.Window1Min)
+	}
+	if config.DischargeDerateTopic != "" {
+		input.HasDischargeDerate = true
+		input.Battery2DischargeDerate = data.GetFloat(config.DischargeDerateTopic).Current
+	}
+	if config.CellUndervoltageTopic != "" {
+		input.Battery2CellUndervoltage = data.GetBoolean(config.CellUndervoltageTopic)
+	}
+	if config.InverterCapTopic != "" {
+		input.HasInverterCap = true
+		input.Battery2InverterCap = int(data.GetFloat(config.InverterCapTopic).Current)
+	}
+	return input
+}
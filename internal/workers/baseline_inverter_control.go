@@ -0,0 +1,865 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ryansname/powerctl/governor"
+)
+
+// BaselineInverterConfig holds configuration for the baseline inverter controller.
+type BaselineInverterConfig struct {
+	Input    BaselineInputConfig
+	Battery2 BatteryInverterGroup
+
+	WattsPerInverter float64
+	MaxTransferPower float64
+	MaxBaselineWatts float64
+
+	// PriceExportThreshold is the export price ($/kWh) above which all inverters are requested.
+	PriceExportThreshold float64
+
+	// TargetRampThreshold is the watt-seconds of disagreement the selected target must
+	// build up before the inverter count follows it (0 follows immediately).
+	TargetRampThreshold float64
+
+	// CountHysteresisWatts is how far past a multiple of WattsPerInverter the smoothed
+	// target must move before the count follows (0 rounds up with no hysteresis).
+	CountHysteresisWatts float64
+
+	// GridPID drives grid import toward zero (see Input.GridPowerTopic). Output is watts.
+	GridPID governor.PIDConfig
+
+	// OverflowProbeWatts is the charge controller output beyond the active inverters' draw
+	// at which power-based overflow tries another inverter (see Input.ChargePowerTopic).
+	OverflowProbeWatts float64
+
+	OverflowSOCTurnOffStart float64
+	OverflowSOCTurnOffEnd   float64
+	OverflowSOCTurnOnStart  float64
+	OverflowSOCTurnOnEnd    float64
+	LowVoltageTurnOnStart   float64
+	LowVoltageTurnOnEnd     float64
+	LowVoltageTurnOffStart  float64
+	LowVoltageTurnOffEnd    float64
+
+	// Once the low-voltage limit has cut inverters it only raises again after the 5m P50
+	// voltage has held at or above LowVoltageRecoveryVoltage for LowVoltageRecoveryTime,
+	// so a flat battery that bounces back at rest doesn't rapid-cycle.
+	LowVoltageRecoveryVoltage float64
+	LowVoltageRecoveryTime    time.Duration
+
+	// LowVoltageSagPerInverter lowers the low-voltage decrease thresholds by this many
+	// volts per inverter on, so the sag the inverters cause doesn't shed them early.
+	LowVoltageSagPerInverter float64
+
+	// LowVoltageFastTrip sheds every inverter on a single raw voltage reading below it
+	// (see LowVoltageFastPath); 0 disables
+	LowVoltageFastTrip float64
+
+	// SOCReserve limits Battery 2 inverters by SOC; IslandSOCReserve replaces it while
+	// islanded or in storm mode
+	SOCReserve       SOCReserve
+	IslandSOCReserve SOCReserve
+
+	// ExportLimitWatts caps measured export (1m P99, see Input.GridPowerTopic) ahead of
+	// every other request: inverters are cut at once to bring export under it, and come
+	// back one at a time once export has left room for another for ExportLimitRecovery.
+	// 0 disables.
+	ExportLimitWatts    float64
+	ExportLimitRecovery time.Duration
+
+	// MinOnTime and MinOffTime keep each inverter on (or off) for at least this long
+	// after it switches, unless a limit (SOC, transfer, temperature, coordinator, export,
+	// low voltage) or safety cuts it. 0 disables.
+	MinOnTime  time.Duration
+	MinOffTime time.Duration
+
+	// DrawdownReserveSOC is the Battery 2 SOC (%) the drawdown planner leaves for the
+	// night, exporting the rest over the last DrawdownWindow before the forecast solar
+	// end (see drawdownRequest). 0 disables.
+	DrawdownReserveSOC float64
+	DrawdownWindow     time.Duration
+
+	// OvernightReserve replaces DrawdownReserveSOC while tomorrow's forecast is known
+	// (see Input.TomorrowForecastTopic): more is kept before a cloudy day, less before a
+	// sunny one. Zero value disables.
+	OvernightReserve OvernightReserve
+
+	// BalanceDeadband and BalanceWattsPerPercent skew discharge toward the fuller battery
+	// (see balanceSkew): each SOC point Battery 2 leads Battery 3 by beyond the deadband
+	// requests this many watts from Battery 2, and each point it trails by takes as much
+	// off Baseline so the Multiplus covers the house instead. 0 BalanceWattsPerPercent
+	// disables.
+	BalanceDeadband        float64
+	BalanceWattsPerPercent float64
+
+	// OutputFeedbackTolerance and OutputFeedbackWindow correct the count by an inverter
+	// when measured output (Input.InverterPowerTopics) stays more than this fraction
+	// off the commanded watts for a window (see OutputFeedback). 0 disables.
+	OutputFeedbackTolerance float64
+	OutputFeedbackWindow    time.Duration
+
+	// An inverter switched on but under DeadInverterWatts for DeadInverterAfter is left
+	// out of the count and switched off until DeadInverterRetry (see DeadInverters). 0
+	// DeadInverterAfter disables.
+	DeadInverterWatts float64
+	DeadInverterAfter time.Duration
+	DeadInverterRetry time.Duration
+
+	// Profiles override the thresholds above by season and time of day
+	Profiles ThresholdProfiles
+}
+
+// BaselineInverterState holds runtime state for the baseline inverter controller.
+type BaselineInverterState struct {
+	overflow2      BatteryOverflowState
+	forecastExcess governor.ForecastExcessState
+
+	gridOffSolarMax    governor.RollingMinMax
+	battery2VoltageMin governor.RollingMinMax
+	houseLoadHourly    governor.RollingMinMax // 168-hour (7-day) window, hourly buckets
+	targetMinusSolar   governor.RollingMinMax // 60-minute window, 1-minute buckets
+
+	socLimit2       *governor.SteppedHysteresis
+	islandSOCLimit2 *governor.SteppedHysteresis // replaces socLimit2 while islanded or in storm mode
+	powerCutAllow2  *governor.SteppedHysteresis
+	lowVoltage2     *governor.SteppedHysteresis
+	lvRecovered2    *governor.Dwell[bool] // P50 voltage sustained above the recovery threshold
+	targetRamp      *governor.SlowRampState
+	countHyst       *governor.SteppedHysteresis // nil without CountHysteresisWatts
+	gridPID         *governor.PIDController
+
+	dwell InverterDwell // per-inverter minimum on/off times
+
+	exportCap  int                   // max inverters under the export limit
+	exportRoom *governor.Dwell[bool] // export sustained a whole inverter below the limit
+
+	output OutputFeedback // measured output correction, applied last
+	dead   DeadInverters  // inverters on but not producing
+
+	trimSetpoint float64 // last power limit sent to the trim inverter
+}
+
+// BaselineDebugInfo contains mode states for the baseline controller debug output.
+type BaselineDebugInfo struct {
+	Modes         []ModeState
+	SafetyReason  string
+	ACFreqCurrent float64
+	ACFreqP100    float64
+	PowerwallSOC  float64
+
+	Battery2LowVoltage    bool
+	Battery2VoltageMin    float64
+	Battery2VoltageMaxInv int
+	Battery2LVRecovering  bool // limit held until the recovery condition is met
+
+	BaselineTarget float64
+	BaselineUsed   float64
+	ReserveSOC     float64 // overnight reserve the drawdown planner leaves (%)
+
+	NegativePrice bool
+	Manual        bool // count forced from the manual inverter count entity
+
+	SelfConsumption bool // following house load minus rooftop solar instead of the modes
+	DwellHeld       bool // an inverter's minimum on/off time overrode the mode count
+
+	TemperatureLimited bool // temperature derating allows fewer than all inverters
+	TemperatureMaxInv  int
+
+	CoordinatorLimited bool // PW2 coordinator capped the count to keep out of the Powerwall
+	CoordinatorCap     int
+
+	ExportLimited bool // export limit capped the count
+	ExportMaxInv  int
+	ExportP99     float64
+
+	Curtailed bool // curtailment mode forced every inverter off
+
+	OutputCorrection int     // inverters added (or removed) for measured output
+	OutputRatio      float64 // measured/commanded watts over the last feedback window
+
+	DeadInverters int // inverters left out of the count for not producing
+
+	TargetWatts  float64 // smoothed watts the count was sized from
+	RampTarget   float64 // selected watts before smoothing
+	RampPressure float64
+}
+
+const (
+	modePriceExport = "PriceExport"
+	modeEV          = "EV"
+	modeGridPID     = "GridPID"
+	modeBalance     = "Balance"
+
+	modeSelfConsumption = "SelfConsumption"
+)
+
+// targetRampPressureSensorID is the debug sensor showing the baseline target smoother's
+// pressure (W·s; positive builds towards more inverters).
+const targetRampPressureSensorID = "powerctl_target_ramp_pressure"
+
+// overnightReserveSensorID is the sensor showing the drawdown planner's overnight
+// reserve, chosen from tomorrow's forecast when it's known.
+const overnightReserveSensorID = "powerctl_overnight_reserve"
+
+const (
+	// TopicInverterModeState is the HA statestream topic for the powerctl_inverter_mode select.
+	TopicInverterModeState = "homeassistant/select/powerctl_inverter_mode/state"
+	// TopicManualInverterCountCmd is the command topic for the manual inverter count number entity.
+	TopicManualInverterCountCmd = "powerctl/number/powerctl_manual_inverter_count/set"
+	// TopicManualInverterCountState is the HA statestream topic for the manual inverter count.
+	TopicManualInverterCountState = "homeassistant/number/powerctl_manual_inverter_count/state"
+
+	InverterModeAuto            = "auto"
+	InverterModeManual          = "manual"
+	InverterModeSelfConsumption = "self_consumption"
+)
+
+// priceExportRequest requests every inverter while the export price is above threshold.
+func priceExportRequest(input BaselineInput, config BaselineInverterConfig) PowerRequest {
+	if !input.HasExportPrice || input.ExportPrice <= config.PriceExportThreshold {
+		return PowerRequest{Name: modePriceExport, Watts: 0}
+	}
+	return PowerRequest{
+		Name:  modePriceExport,
+		Watts: float64(len(config.Battery2.Inverters)) * config.WattsPerInverter,
+	}
+}
+
+// balanceSkew returns how many SOC points Battery 2 leads Battery 3 by beyond deadband:
+// positive while Battery 2 is fuller, negative while Battery 3 is, 0 within it.
+func balanceSkew(battery2SOC, battery3SOC, deadband float64) float64 {
+	lead := battery2SOC - battery3SOC
+	switch {
+	case lead > deadband:
+		return lead - deadband
+	case lead < -deadband:
+		return lead + deadband
+	}
+	return 0
+}
+
+// balanceRequest runs Battery 2's inverters while it is fuller than Battery 3, so the
+// Multiplus discharges less and Battery 3's solar can catch up. Like self-consumption it
+// covers only the house load solar doesn't: beyond that it would export, not offload the
+// Multiplus.
+func balanceRequest(input BaselineInput, config BaselineInverterConfig) PowerRequest {
+	skew := balanceSkew(input.Battery2SOC, input.Battery3SOC, config.BalanceDeadband)
+	return PowerRequest{
+		Name: modeBalance,
+		Watts: min(
+			max(0, skew)*config.BalanceWattsPerPercent,
+			float64(len(config.Battery2.Inverters))*config.WattsPerInverter,
+			selfConsumptionRequest(input).Watts,
+		),
+	}
+}
+
+// selfConsumptionRequest covers the house load not met by rooftop solar, so the Battery 2
+// inverters never export.
+func selfConsumptionRequest(input BaselineInput) PowerRequest {
+	return PowerRequest{
+		Name:  modeSelfConsumption,
+		Watts: max(0, input.HouseLoad-input.Solar1Power-input.Solar2Power),
+	}
+}
+
+// calculateBaseline returns the baseline power request from the 7-day house load floor.
+// Updates the rolling windows in state as a side effect.
+func calculateBaseline(
+	houseLoad float64,
+	solar1 float64,
+	solar2 float64,
+	maxWatts float64,
+	state *BaselineInverterState,
+	now time.Time,
+) PowerRequest {
+	state.houseLoadHourly.Update(houseLoad, now)
+	baselineTarget := state.houseLoadHourly.BucketMinPercentile(2)
+
+	targetMinusSolar := baselineTarget - solar1 - solar2
+	state.targetMinusSolar.Update(targetMinusSolar, now)
+	usedBaseline := max(0.0, state.targetMinusSolar.Min())
+
+	return PowerRequest{
+		Name:  modeBaseline,
+		Watts: min(usedBaseline, maxWatts),
+	}
+}
+
+// selectBaselineMode computes the desired inverter count and debug info from a BaselineInput.
+func selectBaselineMode(
+	input BaselineInput,
+	config BaselineInverterConfig,
+	state *BaselineInverterState,
+	now time.Time,
+) (int, BaselineDebugInfo) {
+	if input.ACFreqP100_5Min > 52.75 {
+		return 0, BaselineDebugInfo{
+			SafetyReason:  "High frequency",
+			ACFreqCurrent: input.ACFrequency,
+			ACFreqP100:    input.ACFreqP100_5Min,
+			PowerwallSOC:  input.PowerwallSOC,
+		}
+	}
+
+	if input.Battery2CellUndervoltage {
+		return 0, BaselineDebugInfo{
+			SafetyReason:  "Cell undervoltage",
+			ACFreqCurrent: input.ACFrequency,
+			ACFreqP100:    input.ACFreqP100_5Min,
+			PowerwallSOC:  input.PowerwallSOC,
+		}
+	}
+
+	if !input.GridAvailable && input.PowerwallSOC > 90.0 {
+		return 0, BaselineDebugInfo{
+			SafetyReason:  "Grid off + high Powerwall",
+			ACFreqCurrent: input.ACFrequency,
+			ACFreqP100:    input.ACFreqP100_5Min,
+			PowerwallSOC:  input.PowerwallSOC,
+		}
+	}
+
+	overflow2 := checkBatteryOverflow(
+		input.Battery2ChargeState,
+		input.Battery2SOC,
+		config.WattsPerInverter,
+		&state.overflow2,
+	)
+	// With a charge power topic, size overflow from what the controller is producing once
+	// in float; the SOC hysteresis above still decides entry and is the fallback
+	if input.HasChargePower && state.overflow2.InFloat {
+		active := 0
+		for _, on := range input.InverterStates {
+			if on {
+				active++
+			}
+		}
+		overflow2 = overflowFromChargePower(
+			input.Battery2ChargePower,
+			active,
+			len(config.Battery2.Inverters),
+			config.WattsPerInverter,
+			config.OverflowProbeWatts,
+		)
+	}
+	forecastExcess2 := forecastExcessRequest(
+		input.ForecastRemainingWh,
+		input.DetailedForecast,
+		input.Battery2EnergyWh,
+		config.WattsPerInverter,
+		config.Battery2,
+		&state.forecastExcess,
+		now,
+	)
+
+	// Grid off: disable per-battery modes when solar is consistently high (≥3kW over 1h)
+	if !input.GridAvailable {
+		state.gridOffSolarMax.Update(input.Solar1Power+input.Solar2Power, now)
+		if state.gridOffSolarMax.Max() >= 3000 {
+			overflow2.Watts = 0
+			forecastExcess2.Watts = 0
+		}
+	}
+
+	reserveSOC := config.DrawdownReserveSOC
+	if input.HasTomorrowForecast && config.OvernightReserve.Enabled() {
+		reserveSOC = config.OvernightReserve.SOC(input.TomorrowForecastWh)
+	}
+	drawdown2 := drawdownRequest(
+		input.ForecastRemainingWh,
+		input.DetailedForecast,
+		input.Battery2EnergyWh,
+		reserveSOC,
+		config.DrawdownWindow,
+		config.WattsPerInverter,
+		config.Battery2,
+		now,
+	)
+	// Islanded or a storm is coming: the evening's surplus stays in the battery
+	if !input.GridAvailable || input.StormMode {
+		drawdown2.Watts = 0
+	}
+
+	perBattery := maxPowerRequest(maxPowerRequest(overflow2, forecastExcess2), drawdown2)
+	baseline := calculateBaseline(input.HouseLoad, input.Solar1Power, input.Solar2Power, config.MaxBaselineWatts, state, now)
+	baselineTarget := state.houseLoadHourly.BucketMinPercentile(2)
+
+	// Battery 3 fuller: leave more of the house to the Multiplus
+	balance := balanceRequest(input, config)
+	if skew := balanceSkew(input.Battery2SOC, input.Battery3SOC, config.BalanceDeadband); skew < 0 {
+		baseline.Watts = max(0, baseline.Watts+skew*config.BalanceWattsPerPercent)
+	}
+
+	priceExport := priceExportRequest(input, config)
+	ev := PowerRequest{Name: modeEV, Watts: input.EVReservedWatts}
+
+	// Setpoint 0 on export (negated import), so output rises while importing
+	gridPID := PowerRequest{Name: modeGridPID}
+	if input.HasGridPower {
+		gridPID.Watts = state.gridPID.Update(0, -input.GridPower, now)
+	}
+
+	selected := maxPowerRequest(
+		maxPowerRequest(maxPowerRequest(perBattery, balance), baseline),
+		maxPowerRequest(maxPowerRequest(priceExport, ev), gridPID),
+	)
+
+	// Negative export price: only cover the house (baseline), never export
+	negativePrice := input.HasExportPrice && input.ExportPrice < 0
+	if negativePrice {
+		selected = baseline
+	}
+	// Self-consumption replaces the threshold-based modes with the unmet load
+	selfConsumption := !input.ManualMode && input.SelfConsumptionMode
+	if selfConsumption {
+		selected = selfConsumptionRequest(input)
+	}
+	// Smooth the target so brief load/solar spikes don't flip inverters
+	rampTarget := selected.Watts
+	selected.Watts = state.targetRamp.Update(rampTarget, now)
+	selectedCount := calculateInverterCount(selected.Watts, config.WattsPerInverter)
+	if state.countHyst != nil {
+		selectedCount = inverterCountWithHysteresis(selected.Watts, state.countHyst)
+	}
+	if selfConsumption && trimInverterIndex(config.Battery2.Inverters) < 0 {
+		// Round down: a partial inverter would export the remainder. A trim inverter
+		// delivers just the remainder instead.
+		selectedCount = min(int(selected.Watts/config.WattsPerInverter), len(config.Battery2.Inverters))
+	}
+
+	// Manual override replaces the mode selection only; the safety returns above and
+	// the SOC, transfer and low-voltage limits below still apply.
+	if input.ManualMode {
+		selectedCount = max(0, min(input.ManualInverterCount, len(config.Battery2.Inverters)))
+	}
+
+	// Minimum on/off times per inverter; the limits below still cut at once
+	state.dwell.Observe(input.InverterStates, now)
+	dwellHeld := false
+	if !input.ManualMode {
+		held := state.dwell.Hold(selectedCount, config.MinOnTime, config.MinOffTime, now)
+		dwellHeld = held != selectedCount
+		selectedCount = held
+	}
+
+	// SOC-based limit; island mode holds a deeper reserve for the length of the outage,
+	// and storm mode holds the same reserve ahead of one
+	socLimit := state.socLimit2
+	if input.IslandMode || input.StormMode {
+		socLimit = state.islandSOCLimit2
+	}
+	maxB2 := maxInvertersForSOC(input.Battery2SOC, socLimit)
+	selectedCount = min(selectedCount, maxB2)
+
+	// Powerhouse transfer limit — skipped when Battery 3 SOC < 94% so the Multiplus can absorb
+	if input.Battery3SOC >= multiplusAbsorbSOC {
+		limit := powerhouseTransferLimit(input.Solar1P90_15Min, config.MaxTransferPower)
+		limitCount := int(limit.Watts / config.WattsPerInverter)
+		if limitCount < 0 {
+			limitCount = 0
+		}
+		selectedCount = min(selectedCount, limitCount)
+	}
+
+	// Temperature derating allows a share of the inverters
+	temperatureLimited := input.HasDischargeDerate && input.Battery2DischargeDerate < 100
+	temperatureMaxInv := len(config.Battery2.Inverters)
+	if temperatureLimited {
+		temperatureMaxInv = int(float64(len(config.Battery2.Inverters)) * max(0, input.Battery2DischargeDerate) / 100)
+		selectedCount = min(selectedCount, temperatureMaxInv)
+	}
+
+	// The PW2 coordinator caps the count while the inverters would charge the Powerwall
+	coordinatorLimited := input.HasInverterCap && selectedCount > input.Battery2InverterCap
+	if coordinatorLimited {
+		selectedCount = max(0, input.Battery2InverterCap)
+	}
+
+	// The export limit overrides everything above, manual included
+	exportLimited := false
+	if config.ExportLimitWatts > 0 && input.HasGridPower {
+		exportMaxInv := applyExportLimit(input, config, state, now)
+		exportLimited = selectedCount > exportMaxInv
+		selectedCount = min(selectedCount, exportMaxInv)
+	}
+
+	// Curtailment (negative price or a DNSP signal) turns every inverter off, manual included
+	if input.Curtailed {
+		selectedCount = 0
+	}
+
+	// Watts the trim inverter makes up (see applyTrimSetpoint); manual runs flat out
+	targetWatts := selected.Watts
+	if input.ManualMode {
+		selected = PowerRequest{Name: modeManual}
+		targetWatts = float64(selectedCount) * config.WattsPerInverter
+	}
+	overflowContrib := selectedCount > 0 && selected.Name == overflow2.Name
+	forecastContrib := selectedCount > 0 && selected.Name == forecastExcess2.Name
+	drawdownContrib := selectedCount > 0 && selected.Name == drawdown2.Name
+	balanceContrib := selectedCount > 0 && selected.Name == balance.Name
+	baselineContrib := selectedCount > 0 && selected.Name == baseline.Name
+	priceContrib := selectedCount > 0 && selected.Name == priceExport.Name
+	evContrib := selectedCount > 0 && selected.Name == ev.Name
+	pidContrib := selectedCount > 0 && selected.Name == gridPID.Name
+
+	debug := BaselineDebugInfo{
+		PowerwallSOC:  input.PowerwallSOC,
+		ACFreqCurrent: input.ACFrequency,
+		ACFreqP100:    input.ACFreqP100_5Min,
+		Modes: []ModeState{
+			{Name: overflow2.Name, Watts: overflow2.Watts, Contributing: overflowContrib},
+			{Name: forecastExcess2.Name, Watts: forecastExcess2.Watts, Contributing: forecastContrib},
+			{Name: drawdown2.Name, Watts: drawdown2.Watts, Contributing: drawdownContrib},
+			{Name: balance.Name, Watts: balance.Watts, Contributing: balanceContrib},
+			{Name: baseline.Name, Watts: baseline.Watts, Contributing: baselineContrib},
+			{Name: priceExport.Name, Watts: priceExport.Watts, Contributing: priceContrib},
+			{Name: ev.Name, Watts: ev.Watts, Contributing: evContrib},
+			{Name: gridPID.Name, Watts: gridPID.Watts, Contributing: pidContrib},
+		},
+		BaselineTarget: baselineTarget,
+		BaselineUsed:   baseline.Watts,
+		NegativePrice:  negativePrice,
+		ReserveSOC:     reserveSOC,
+		Manual:         input.ManualMode,
+		TargetWatts:    targetWatts,
+		RampTarget:     rampTarget,
+		RampPressure:   state.targetRamp.Pressure,
+
+		SelfConsumption: selfConsumption,
+		DwellHeld:       dwellHeld,
+
+		TemperatureLimited: temperatureLimited,
+		TemperatureMaxInv:  temperatureMaxInv,
+
+		CoordinatorLimited: coordinatorLimited,
+		CoordinatorCap:     input.Battery2InverterCap,
+
+		ExportLimited: exportLimited,
+		ExportMaxInv:  state.exportCap,
+		ExportP99:     input.GridExportP99_1Min,
+
+		Curtailed: input.Curtailed,
+	}
+
+	return selectedCount, debug
+}
+
+// applyExportLimit updates the export limit cap from the 1m P99 export and returns it.
+// Over the limit the cap drops at once to the inverters on less enough to cover the
+// excess; it rises by one each time there has been a whole inverter of room for
+// ExportLimitRecovery.
+func applyExportLimit(
+	input BaselineInput,
+	config BaselineInverterConfig,
+	state *BaselineInverterState,
+	now time.Time,
+) int {
+	export := input.GridExportP99_1Min
+	if export > config.ExportLimitWatts {
+		active := 0
+		for _, on := range input.InverterStates {
+			if on {
+				active++
+			}
+		}
+		excess := int(math.Ceil((export - config.ExportLimitWatts) / config.WattsPerInverter))
+		state.exportCap = max(0, min(state.exportCap, active-excess))
+		state.exportRoom.Force(false)
+		return state.exportCap
+	}
+
+	room := export <= config.ExportLimitWatts-config.WattsPerInverter
+	if !room {
+		state.exportRoom.Force(false)
+	}
+	if state.exportRoom.Update(room, now) && state.exportCap < len(config.Battery2.Inverters) {
+		state.exportCap++
+		state.exportRoom.Force(false)
+	}
+	return state.exportCap
+}
+
+// applyLowVoltageLimit updates the Battery 2 low-voltage limit from the 15m rolling
+// minimum voltage and returns the max inverters allowed. Cuts apply immediately; raises
+// are held (recovering=true) until the recovery condition has been met.
+func applyLowVoltageLimit(
+	input BaselineInput,
+	config BaselineInverterConfig,
+	state *BaselineInverterState,
+	now time.Time,
+) (maxInverters int, recovering bool) {
+	above := input.Battery2VoltageP50_5Min >= config.LowVoltageRecoveryVoltage
+	if !above {
+		state.lvRecovered2.Force(false)
+	}
+	recovered := state.lvRecovered2.Update(above, now)
+
+	state.battery2VoltageMin.Update(input.Battery2Voltage, now)
+	prev := state.lowVoltage2.Current
+	active := 0
+	for _, on := range input.InverterStates {
+		if on {
+			active++
+		}
+	}
+	sag := config.LowVoltageSagPerInverter * float64(active)
+	maxInverters = state.lowVoltage2.UpdateCompensated(state.battery2VoltageMin.Min(), sag)
+	if maxInverters > prev && !recovered {
+		state.lowVoltage2.Current = prev
+		return prev, true
+	}
+	return maxInverters, false
+}
+
+// FastTrip sheds every Battery 2 inverter on a raw voltage reading below
+// LowVoltageFastTrip, ahead of the next Decide. The low-voltage limit drops to zero and,
+// like any cut, is held until the recovery condition is met. Returns false if the limit
+// was already zero.
+func (c *baselineController) FastTrip(voltage float64, now time.Time) bool {
+	state := c.state
+	state.battery2VoltageMin.Update(voltage, now)
+	state.lvRecovered2.Force(false)
+	if state.lowVoltage2.Current == 0 {
+		return false
+	}
+	log.Printf("Battery 2: fast trip at %.2fV, voltage limit %d→0\n", voltage, state.lowVoltage2.Current)
+	c.audit.Record("baseline", fmt.Sprintf("B2 low-voltage fast trip %d→0", state.lowVoltage2.Current),
+		map[string]float64{"voltage": voltage})
+	state.lowVoltage2.Current = 0
+	return true
+}
+
+// applyThresholdProfile rebuilds the low-voltage and SOC limits from config's
+// thresholds, keeping their current steps so a profile change alone doesn't turn
+// inverters back on.
+func applyThresholdProfile(config BaselineInverterConfig, state *BaselineInverterState) {
+	b2Count := len(config.Battery2.Inverters)
+	current := state.lowVoltage2.Current
+	state.lowVoltage2 = governor.NewSteppedHysteresis(
+		b2Count, true,
+		config.LowVoltageTurnOnStart, config.LowVoltageTurnOnEnd,
+		config.LowVoltageTurnOffStart, config.LowVoltageTurnOffEnd,
+	)
+	state.lowVoltage2.Current = current
+
+	socCurrent, islandCurrent := state.socLimit2.Current, state.islandSOCLimit2.Current
+	state.socLimit2 = config.SOCReserve.Hysteresis(b2Count)
+	state.socLimit2.Current = socCurrent
+	state.islandSOCLimit2 = config.IslandSOCReserve.Hysteresis(b2Count)
+	state.islandSOCLimit2.Current = islandCurrent
+}
+
+// baselineController is the baseline controller's decision logic, kept apart from the
+// MQTT plumbing so `powerctl simulate` can drive it on simulated time.
+type baselineController struct {
+	config  BaselineInverterConfig
+	active  BaselineInverterConfig // config with the active profile's overrides
+	profile string
+	state   *BaselineInverterState
+	audit   *AuditLog
+}
+
+// newBaselineController creates a controller allowing every Battery 2 inverter.
+func newBaselineController(config BaselineInverterConfig, audit *AuditLog) *baselineController {
+	b2Count := len(config.Battery2.Inverters)
+
+	state := &BaselineInverterState{
+		overflow2: BatteryOverflowState{
+			Hysteresis: governor.NewSteppedHysteresis(
+				b2Count, true,
+				config.OverflowSOCTurnOnStart, config.OverflowSOCTurnOnEnd,
+				config.OverflowSOCTurnOffStart, config.OverflowSOCTurnOffEnd,
+			),
+		},
+		gridOffSolarMax:    governor.NewRollingMinMax(60),
+		battery2VoltageMin: governor.NewRollingMinMax(15),
+		houseLoadHourly:    governor.NewRollingMinMaxHours(168),
+		targetMinusSolar:   governor.NewRollingMinMax(60),
+		socLimit2:          config.SOCReserve.Hysteresis(b2Count),
+		islandSOCLimit2:    config.IslandSOCReserve.Hysteresis(b2Count),
+		powerCutAllow2:     governor.NewSteppedHysteresis(1, true, 53, 53, 47, 47),
+		lowVoltage2: governor.NewSteppedHysteresis(
+			b2Count, true,
+			config.LowVoltageTurnOnStart, config.LowVoltageTurnOnEnd,
+			config.LowVoltageTurnOffStart, config.LowVoltageTurnOffEnd,
+		),
+	}
+	state.lowVoltage2.Current = b2Count
+	state.lvRecovered2 = governor.NewDwell(false, config.LowVoltageRecoveryTime)
+	state.targetRamp = governor.NewSlowRamp(config.TargetRampThreshold)
+	if config.CountHysteresisWatts > 0 {
+		state.countHyst = newInverterCountHysteresis(b2Count, config.WattsPerInverter, config.CountHysteresisWatts)
+	}
+	state.gridPID = governor.NewPIDController(config.GridPID)
+	state.exportCap = b2Count
+	state.exportRoom = governor.NewDwell(false, config.ExportLimitRecovery)
+	state.output = OutputFeedback{Tolerance: config.OutputFeedbackTolerance, Window: config.OutputFeedbackWindow}
+	state.dead = DeadInverters{Watts: config.DeadInverterWatts, After: config.DeadInverterAfter, Retry: config.DeadInverterRetry}
+
+	return &baselineController{config: config, active: config, profile: defaultProfileName, state: state, audit: audit}
+}
+
+// Decide returns the Battery 2 inverter count for input at now: the active threshold
+// profile's mode selection, capped by the low-voltage and expecting-power-cuts limits.
+func (c *baselineController) Decide(input BaselineInput, now time.Time) (int, BaselineDebugInfo) {
+	state := c.state
+	if p := c.config.Profiles.Active(now); p.Name != c.profile {
+		log.Printf("Baseline inverter control: threshold profile %s→%s\n", c.profile, p.Name)
+		c.audit.Record("baseline", fmt.Sprintf("Threshold profile %s→%s", c.profile, p.Name), nil)
+		c.profile, c.active = p.Name, p.Overrides.Apply(c.config)
+		applyThresholdProfile(c.active, state)
+	}
+	desiredCount, debugInfo := selectBaselineMode(input, c.active, state, now)
+
+	// Low voltage limit using 15-minute rolling minimum
+	prevMaxInv := state.lowVoltage2.Current
+	maxByVoltage, recovering := applyLowVoltageLimit(input, c.active, state, now)
+	b2VoltMin := state.battery2VoltageMin.Min()
+	if maxByVoltage != prevMaxInv {
+		log.Printf("Battery 2: voltage limit changed %d→%d (15m min %.2fV, 5m P50 %.2fV)\n",
+			prevMaxInv, maxByVoltage, b2VoltMin, input.Battery2VoltageP50_5Min)
+		c.audit.Record("baseline", fmt.Sprintf("B2 low-voltage limit %d→%d", prevMaxInv, maxByVoltage),
+			map[string]float64{
+				"voltage_min_15m": b2VoltMin,
+				"voltage_p50_5m":  input.Battery2VoltageP50_5Min,
+				"voltage":         input.Battery2Voltage,
+			})
+	}
+	desiredCount = min(desiredCount, maxByVoltage)
+	debugInfo.Battery2LowVoltage = maxByVoltage < len(c.config.Battery2.Inverters)
+	debugInfo.Battery2VoltageMin = b2VoltMin
+	debugInfo.Battery2VoltageMaxInv = maxByVoltage
+	debugInfo.Battery2LVRecovering = recovering
+
+	// Expecting power cuts: conserve around 50% SOC, grid-on only
+	if input.ExpectingPowerCuts && input.GridAvailable {
+		blocked := state.powerCutAllow2.Update(input.Battery2SOC) == 0
+		if blocked {
+			desiredCount = 0
+			if debugInfo.SafetyReason == "" {
+				debugInfo.SafetyReason = "Expecting power cuts (battery < 50%)"
+			}
+		}
+	}
+
+	// Output feedback: compare with what the inverters actually produce, making up for
+	// one that is on but not producing. Only adjusts a count above zero, so safety and
+	// limits that turn everything off still do; not applied in Manual.
+	if input.HasInverterOutput && !input.ManualMode {
+		commanded := float64(desiredCount) * c.config.WattsPerInverter
+		if trimInverterIndex(c.config.Battery2.Inverters) >= 0 {
+			commanded = min(commanded, debugInfo.TargetWatts)
+		}
+		prevCorrection := state.output.Correction
+		correction := state.output.Update(desiredCount, commanded, input.InverterOutputWatts, now)
+		if state.output.Correction != prevCorrection {
+			log.Printf("Battery 2: output correction %+d→%+d (measured/commanded %.2f)\n",
+				prevCorrection, state.output.Correction, state.output.Ratio)
+			c.audit.Record("baseline", fmt.Sprintf("B2 output correction %+d→%+d", prevCorrection, state.output.Correction),
+				map[string]float64{"ratio": state.output.Ratio, "commanded": commanded, "measured": input.InverterOutputWatts})
+		}
+		desiredCount = max(0, min(desiredCount+correction, len(c.config.Battery2.Inverters)))
+		debugInfo.OutputCorrection = correction
+		debugInfo.OutputRatio = state.output.Ratio
+	}
+
+	// Dead inverters: the count is spread over the inverters still producing
+	deadChanged := input.HasInverterOutput && state.dead.Update(input.InverterStates, input.InverterPowers, now)
+	available, _, dead, _ := state.dead.Split(c.config.Battery2.Inverters, input.InverterStates)
+	if deadChanged {
+		deadIDs := strings.Join(inverterEntityIDs(dead), ", ")
+		log.Printf("Battery 2: dead inverters (on but not producing) now [%s]\n", deadIDs)
+		c.audit.Record("baseline", "B2 dead inverters ["+deadIDs+"]",
+			map[string]float64{"output": input.InverterOutputWatts})
+	}
+	desiredCount = min(desiredCount, len(available))
+	debugInfo.DeadInverters = len(dead)
+	return desiredCount, debugInfo
+}
+
+// baselineInverterControl manages Battery 2 inverters using baseline + overflow/forecast strategy.
+// Readings on tripChan (from LowVoltageFastPath; nil disables) turn every inverter off at once.
+func baselineInverterControl(
+	ctx context.Context,
+	inputChan <-chan BaselineInput,
+	tripChan <-chan float64,
+	config BaselineInverterConfig,
+	sender *MQTTSender,
+	debugChan chan<- BaselineDebugInfo,
+	audit *AuditLog,
+) {
+	log.Println("Baseline inverter control started")
+
+	controller := newBaselineController(config, audit)
+	lastDead := "-" // publish the dead inverters sensor on the first input
+	for {
+		select {
+		case voltage := <-tripChan:
+			if controller.FastTrip(voltage, time.Now()) {
+				// Every inverter, as the last reported states may already be stale
+				allOn := slices.Repeat([]bool{true}, len(config.Battery2.Inverters))
+				applyInverterChanges(allOn, config.Battery2.Inverters, sender, 0)
+			}
+
+		case input := <-inputChan:
+			desiredCount, debugInfo := controller.Decide(input, time.Now())
+			sender.PublishDebugSensor(targetRampPressureSensorID, debugInfo.RampPressure)
+			sender.PublishDebugSensor(overnightReserveSensorID, debugInfo.ReserveSOC)
+
+			if debugChan != nil {
+				select {
+				case debugChan <- debugInfo:
+				default:
+				}
+			}
+			workerStatus.RecordDecision("baseline-inverter-control", input, struct {
+				Count int
+				Debug BaselineDebugInfo
+			}{desiredCount, debugInfo})
+
+			available, availableStates, dead, deadStates := controller.state.dead.Split(config.Battery2.Inverters, input.InverterStates)
+			deadIDs := inverterEntityIDs(dead)
+			if key := strings.Join(deadIDs, ","); key != lastDead {
+				publishDeadInverters(sender, deadIDs)
+				lastDead = key
+			}
+			controller.state.trimSetpoint = applyTrimSetpoint(available, sender, desiredCount,
+				debugInfo.TargetWatts, config.WattsPerInverter, controller.state.trimSetpoint)
+			changed := applyInverterChanges(availableStates, available, sender, desiredCount)
+			if applyInverterChanges(deadStates, dead, sender, 0) {
+				changed = true
+			}
+			if changed {
+				log.Printf("Baseline inverter control: B2=%d (%.0fW)\n",
+					desiredCount, float64(desiredCount)*config.WattsPerInverter)
+				action := fmt.Sprintf("B2 inverters → %d", desiredCount)
+				if debugInfo.SafetyReason != "" {
+					action += " (" + debugInfo.SafetyReason + ")"
+				} else if debugInfo.Manual {
+					action += " (manual)"
+				} else if debugInfo.SelfConsumption {
+					action += " (self-consumption)"
+				}
+				audit.Record("baseline", action, map[string]float64{
+					"soc":        input.Battery2SOC,
+					"voltage":    input.Battery2Voltage,
+					"house_load": input.HouseLoad,
+					"solar1":     input.Solar1Power,
+				})
+			}
+
+		case <-ctx.Done():
+			log.Println("Baseline inverter control stopped")
+			return
+		}
+	}
+}
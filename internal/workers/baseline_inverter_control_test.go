@@ -0,0 +1,909 @@
+package workers
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ryansname/powerctl/governor"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeTestBaselineConfig() BaselineInverterConfig {
+	inverters := []InverterInfo{
+		{EntityID: "switch.inv1", StateTopic: "ha/switch/inv1/state"},
+		{EntityID: "switch.inv2", StateTopic: "ha/switch/inv2/state"},
+		{EntityID: "switch.inv3", StateTopic: "ha/switch/inv3/state"},
+	}
+	group := BatteryInverterGroup{
+		Name:                 "Battery 2",
+		Inverters:            inverters,
+		ChargeStateTopic:     testTopicB2Charge,
+		SOCTopic:             testTopicB2SOC,
+		BatteryVoltageTopic:  testTopicB2Volt,
+		CapacityWh:           9500,
+		SolarMultiplier:      3.9,
+		AvailableEnergyTopic: testTopicB2Energy,
+	}
+	return BaselineInverterConfig{
+		Battery2:                group,
+		WattsPerInverter:        255.0,
+		MaxTransferPower:        5000.0,
+		MaxBaselineWatts:        500.0,
+		OverflowSOCTurnOffStart: 98.5,
+		OverflowSOCTurnOffEnd:   95.0,
+		OverflowSOCTurnOnStart:  95.75,
+		OverflowSOCTurnOnEnd:    99.5,
+		LowVoltageTurnOnStart:   52.0,
+		LowVoltageTurnOnEnd:     53.0,
+		LowVoltageTurnOffStart:  50.75,
+		LowVoltageTurnOffEnd:    52.0,
+
+		LowVoltageRecoveryVoltage: 52.0,
+		LowVoltageRecoveryTime:    10 * time.Minute,
+
+		SOCReserve:       SOCReserve{TurnOnStart: 15, TurnOnEnd: 25, TurnOffStart: 12.5, TurnOffEnd: 22.5},
+		IslandSOCReserve: SOCReserve{TurnOnStart: 40, TurnOnEnd: 50, TurnOffStart: 37.5, TurnOffEnd: 47.5},
+	}
+}
+
+func makeBlankBaselineState(config BaselineInverterConfig) *BaselineInverterState {
+	b2Count := len(config.Battery2.Inverters)
+	state := &BaselineInverterState{
+		overflow2: BatteryOverflowState{
+			Hysteresis: governor.NewSteppedHysteresis(
+				b2Count, true,
+				config.OverflowSOCTurnOnStart, config.OverflowSOCTurnOnEnd,
+				config.OverflowSOCTurnOffStart, config.OverflowSOCTurnOffEnd,
+			),
+		},
+		gridOffSolarMax:    governor.NewRollingMinMax(60),
+		battery2VoltageMin: governor.NewRollingMinMax(15),
+		houseLoadHourly:    governor.NewRollingMinMaxHours(168),
+		targetMinusSolar:   governor.NewRollingMinMax(60),
+		socLimit2:          config.SOCReserve.Hysteresis(b2Count),
+		islandSOCLimit2:    config.IslandSOCReserve.Hysteresis(b2Count),
+		powerCutAllow2:     governor.NewSteppedHysteresis(1, true, 53, 53, 47, 47),
+		lowVoltage2: governor.NewSteppedHysteresis(
+			b2Count, true,
+			config.LowVoltageTurnOnStart, config.LowVoltageTurnOnEnd,
+			config.LowVoltageTurnOffStart, config.LowVoltageTurnOffEnd,
+		),
+	}
+	state.lowVoltage2.Current = b2Count
+	state.lvRecovered2 = governor.NewDwell(false, config.LowVoltageRecoveryTime)
+	state.targetRamp = governor.NewSlowRamp(config.TargetRampThreshold)
+	state.gridPID = governor.NewPIDController(config.GridPID)
+	state.exportCap = b2Count
+	state.exportRoom = governor.NewDwell(false, config.ExportLimitRecovery)
+	return state
+}
+
+// makeBaselineInput returns a sensible default BaselineInput for tests.
+// Individual fields can be overridden per-test.
+func makeBaselineInput() BaselineInput {
+	return BaselineInput{
+		Battery2SOC:         80.0,
+		Battery2ChargeState: "Bulk Charging",
+		Battery2Voltage:     51.5,
+		Battery2EnergyWh:    8000,
+		Solar1Power:         0,
+		Solar1P90_15Min:     0,
+		Solar2Power:         0,
+		HouseLoad:           0,
+		GridAvailable:       true,
+		ACFrequency:         50.0,
+		ACFreqP100_5Min:     50.0,
+		ForecastRemainingWh: 0,
+		DetailedForecast:    governor.ForecastPeriods{},
+		InverterStates:      []bool{false, false, false},
+		Battery3SOC:         90.0,
+		PowerwallSOC:        50.0,
+		ExpectingPowerCuts:  false,
+	}
+}
+
+// findMode returns the ModeState with the given name, or nil if not found.
+func findMode(modes []ModeState, name string) *ModeState {
+	for i := range modes {
+		if modes[i].Name == name {
+			return &modes[i]
+		}
+	}
+	return nil
+}
+
+// --- calculateBaseline tests ---
+
+func TestCalculateBaseline_ZeroHouseLoad(t *testing.T) {
+	config := makeTestBaselineConfig()
+	state := makeBlankBaselineState(config)
+
+	req := calculateBaseline(0, 0, 0, 500, state, time.Now())
+	assert.Equal(t, modeBaseline, req.Name)
+	assert.InDelta(t, 0.0, req.Watts, 0.001)
+}
+
+func TestCalculateBaseline_CapAt500W(t *testing.T) {
+	config := makeTestBaselineConfig()
+	state := makeBlankBaselineState(config)
+
+	req := calculateBaseline(2000, 0, 0, 500, state, time.Now())
+	assert.InDelta(t, 500.0, req.Watts, 0.001)
+}
+
+func TestCalculateBaseline_SolarOffsets(t *testing.T) {
+	config := makeTestBaselineConfig()
+	state := makeBlankBaselineState(config)
+
+	// House load 800W, solar covers 600W → baseline needed = 200W
+	req := calculateBaseline(800, 400, 200, 500, state, time.Now())
+	assert.InDelta(t, 200.0, req.Watts, 0.001)
+}
+
+func TestCalculateBaseline_SolarExceedsLoad(t *testing.T) {
+	config := makeTestBaselineConfig()
+	state := makeBlankBaselineState(config)
+
+	req := calculateBaseline(500, 400, 200, 500, state, time.Now())
+	assert.InDelta(t, 0.0, req.Watts, 0.001)
+}
+
+// --- selectBaselineMode tests ---
+
+func TestSelectBaselineMode_HighFrequencySafety(t *testing.T) {
+	config := makeTestBaselineConfig()
+	state := makeBlankBaselineState(config)
+	input := makeBaselineInput()
+	input.ACFreqP100_5Min = 53.0
+
+	count, debug := selectBaselineMode(input, config, state, time.Now())
+	assert.Equal(t, 0, count)
+	assert.Equal(t, "High frequency", debug.SafetyReason)
+}
+
+func TestSelectBaselineMode_GridOffHighPowerwall(t *testing.T) {
+	config := makeTestBaselineConfig()
+	state := makeBlankBaselineState(config)
+	input := makeBaselineInput()
+	input.GridAvailable = false
+	input.PowerwallSOC = 91.0
+
+	count, debug := selectBaselineMode(input, config, state, time.Now())
+	assert.Equal(t, 0, count)
+	assert.Equal(t, "Grid off + high Powerwall", debug.SafetyReason)
+}
+
+func TestSelectBaselineMode_BaselineContributes(t *testing.T) {
+	config := makeTestBaselineConfig()
+	state := makeBlankBaselineState(config)
+	input := makeBaselineInput()
+	input.HouseLoad = 1000 // 1000W capped at 500W → ceil(500/255) = 2 inverters
+
+	count, debug := selectBaselineMode(input, config, state, time.Now())
+	assert.Equal(t, 2, count)
+	assert.Empty(t, debug.SafetyReason)
+
+	baselineMode := findMode(debug.Modes, modeBaseline)
+	assert.NotNil(t, baselineMode)
+	assert.InDelta(t, 500.0, baselineMode.Watts, 0.001)
+	assert.True(t, baselineMode.Contributing)
+}
+
+func TestSelectBaselineMode_OverflowWins(t *testing.T) {
+	config := makeTestBaselineConfig()
+	state := makeBlankBaselineState(config)
+	input := makeBaselineInput()
+	input.Battery2ChargeState = floatChargingState
+	input.Battery2SOC = 100.0
+	input.HouseLoad = 200 // Low house load → baseline < overflow
+
+	count, debug := selectBaselineMode(input, config, state, time.Now())
+
+	// Overflow at 100% SOC → all 3 inverters = 765W
+	assert.Equal(t, 3, count)
+
+	overflowMode := findMode(debug.Modes, "Overflow")
+	assert.NotNil(t, overflowMode)
+	assert.True(t, overflowMode.Contributing)
+
+	baselineMode := findMode(debug.Modes, modeBaseline)
+	assert.NotNil(t, baselineMode)
+	assert.False(t, baselineMode.Contributing)
+}
+
+func TestSelectBaselineMode_TransferLimitApplied(t *testing.T) {
+	config := makeTestBaselineConfig()
+	state := makeBlankBaselineState(config)
+	input := makeBaselineInput()
+	input.Battery2ChargeState = floatChargingState
+	input.Battery2SOC = 100.0      // Overflow → 3 inverters desired
+	input.Battery3SOC = 100.0      // transfer limit applies
+	input.Solar1P90_15Min = 4500.0 // limit = 5000-4500 = 500W → int(500/255) = 1
+
+	count, _ := selectBaselineMode(input, config, state, time.Now())
+	assert.Equal(t, 1, count)
+}
+
+func TestSelectBaselineMode_TransferLimitSkipped(t *testing.T) {
+	config := makeTestBaselineConfig()
+	state := makeBlankBaselineState(config)
+	input := makeBaselineInput()
+	input.Battery2ChargeState = floatChargingState
+	input.Battery2SOC = 100.0      // Overflow → 3 inverters desired
+	input.Battery3SOC = 80.0       // <85% → transfer limit skipped
+	input.Solar1P90_15Min = 4500.0 // Would normally cap to 1, but skipped
+
+	count, _ := selectBaselineMode(input, config, state, time.Now())
+	assert.Equal(t, 3, count)
+}
+
+func TestSelectBaselineMode_PriceExportRequestsAll(t *testing.T) {
+	config := makeTestBaselineConfig()
+	config.PriceExportThreshold = 0.30
+	state := makeBlankBaselineState(config)
+	input := makeBaselineInput()
+	input.HasExportPrice = true
+	input.ExportPrice = 0.45
+
+	count, debug := selectBaselineMode(input, config, state, time.Now())
+	assert.Equal(t, 3, count)
+
+	priceMode := findMode(debug.Modes, modePriceExport)
+	assert.NotNil(t, priceMode)
+	assert.True(t, priceMode.Contributing)
+}
+
+func TestSelectBaselineMode_PriceBelowThresholdNoRequest(t *testing.T) {
+	config := makeTestBaselineConfig()
+	config.PriceExportThreshold = 0.30
+	state := makeBlankBaselineState(config)
+	input := makeBaselineInput()
+	input.HasExportPrice = true
+	input.ExportPrice = 0.10
+
+	count, _ := selectBaselineMode(input, config, state, time.Now())
+	assert.Equal(t, 0, count)
+}
+
+func TestSelectBaselineMode_NegativePriceClampsToBaseline(t *testing.T) {
+	config := makeTestBaselineConfig()
+	state := makeBlankBaselineState(config)
+	input := makeBaselineInput()
+	input.Battery2ChargeState = floatChargingState
+	input.Battery2SOC = 100.0 // Overflow wants all 3
+	input.HouseLoad = 200     // Baseline only needs 1
+	input.HasExportPrice = true
+	input.ExportPrice = -0.05
+
+	count, debug := selectBaselineMode(input, config, state, time.Now())
+	assert.Equal(t, 1, count)
+	assert.True(t, debug.NegativePrice)
+}
+
+func TestSelectBaselineMode_StormModeHoldsIslandReserve(t *testing.T) {
+	config := makeTestBaselineConfig()
+	input := makeBaselineInput()
+	input.HouseLoad = 1000 // 2 inverters
+	input.Battery2SOC = 41
+
+	count, _ := selectBaselineMode(input, config, makeBlankBaselineState(config), time.Now())
+	assert.Equal(t, 2, count)
+
+	input.StormMode = true
+	count, _ = selectBaselineMode(input, config, makeBlankBaselineState(config), time.Now())
+	assert.Equal(t, 1, count, "island SOC limits apply while a storm warning is in force")
+}
+
+func TestBalanceSkew(t *testing.T) {
+	assert.Zero(t, balanceSkew(60, 45, 20), "within the deadband")
+	assert.InDelta(t, 15.0, balanceSkew(95, 60, 20), 0.001)
+	assert.InDelta(t, -10.0, balanceSkew(40, 70, 20), 0.001)
+}
+
+func TestSelectBaselineMode_BalanceRunsFullerBattery2(t *testing.T) {
+	config := makeTestBaselineConfig()
+	config.BalanceDeadband = 20
+	config.BalanceWattsPerPercent = 25
+	input := makeBaselineInput()
+	input.HouseLoad = 1000
+	input.Battery2SOC = 95
+	input.Battery3SOC = 45 // 30 points past the deadband → 750W
+
+	count, debug := selectBaselineMode(input, config, makeBlankBaselineState(config), time.Now())
+	assert.Equal(t, 3, count)
+	balance := findMode(debug.Modes, modeBalance)
+	assert.InDelta(t, 750.0, balance.Watts, 0.001)
+	assert.True(t, balance.Contributing)
+
+	input.Battery3SOC = 80
+	count, debug = selectBaselineMode(input, config, makeBlankBaselineState(config), time.Now())
+	assert.Zero(t, findMode(debug.Modes, modeBalance).Watts, "within the deadband")
+	assert.Equal(t, 2, count, "baseline alone")
+}
+
+func TestSelectBaselineMode_BalanceNeverExports(t *testing.T) {
+	config := makeTestBaselineConfig()
+	config.BalanceDeadband = 20
+	config.BalanceWattsPerPercent = 25
+	input := makeBaselineInput()
+	input.Battery2SOC = 95
+	input.Battery3SOC = 45 // 750W of skew, but no load to cover
+
+	count, debug := selectBaselineMode(input, config, makeBlankBaselineState(config), time.Now())
+	assert.Equal(t, 0, count)
+	assert.Zero(t, findMode(debug.Modes, modeBalance).Watts)
+
+	// Capped at the house load solar leaves uncovered
+	input.HouseLoad = 900
+	input.Solar1Power = 300
+	input.Solar2Power = 200
+	_, debug = selectBaselineMode(input, config, makeBlankBaselineState(config), time.Now())
+	assert.InDelta(t, 400.0, findMode(debug.Modes, modeBalance).Watts, 0.001)
+}
+
+func TestSelectBaselineMode_BalanceLeavesHouseToFullerBattery3(t *testing.T) {
+	config := makeTestBaselineConfig()
+	config.BalanceDeadband = 20
+	config.BalanceWattsPerPercent = 25
+	input := makeBaselineInput()
+	input.HouseLoad = 1000 // baseline 500W → 2 inverters
+	input.Battery2SOC = 50
+	input.Battery3SOC = 80 // trails by 10 points past the deadband → 250W off baseline
+
+	count, debug := selectBaselineMode(input, config, makeBlankBaselineState(config), time.Now())
+	assert.Equal(t, 1, count)
+	assert.InDelta(t, 250.0, findMode(debug.Modes, modeBaseline).Watts, 0.001)
+	assert.Zero(t, findMode(debug.Modes, modeBalance).Watts)
+}
+
+// makeDrawdownForecast returns half-hour periods of 0.2kW from 13:00, the last
+// starting at 16:30 so solar ends at 17:00.
+func makeDrawdownForecast() governor.ForecastPeriods {
+	var periods governor.ForecastPeriods
+	for start := time.Date(2025, 6, 1, 13, 0, 0, 0, time.UTC); start.Hour() < 17; start = start.Add(30 * time.Minute) {
+		periods = append(periods, governor.ForecastPeriod{PeriodStart: start, PvEstimate: 0.2})
+	}
+	return periods
+}
+
+func TestDrawdownRequest_SpreadsSurplusAboveReserve(t *testing.T) {
+	config := makeTestBaselineConfig()
+	now := time.Date(2025, 6, 1, 15, 0, 0, 0, time.UTC)
+
+	// 7000Wh + 3.9×100Wh solar − 5700Wh reserve = 1690Wh over 2h, less half an inverter
+	req := drawdownRequest(100, makeDrawdownForecast(), 7000, 60, 3*time.Hour, config.WattsPerInverter, config.Battery2, now)
+	assert.InDelta(t, 845-127.5, req.Watts, 0.01)
+
+	req = drawdownRequest(100, makeDrawdownForecast(), 5000, 60, 3*time.Hour, config.WattsPerInverter, config.Battery2, now)
+	assert.Zero(t, req.Watts, "below the reserve")
+
+	req = drawdownRequest(100, makeDrawdownForecast(), 9500, 10, 3*time.Hour, config.WattsPerInverter, config.Battery2, now)
+	assert.Equal(t, 3*config.WattsPerInverter, req.Watts, "capped at every inverter")
+}
+
+func TestDrawdownRequest_OnlyWithinWindow(t *testing.T) {
+	config := makeTestBaselineConfig()
+	forecast := makeDrawdownForecast()
+
+	early := time.Date(2025, 6, 1, 13, 30, 0, 0, time.UTC)
+	assert.Zero(t, drawdownRequest(0, forecast, 9000, 60, 3*time.Hour, config.WattsPerInverter, config.Battery2, early).Watts)
+
+	after := time.Date(2025, 6, 1, 17, 30, 0, 0, time.UTC)
+	assert.Zero(t, drawdownRequest(0, forecast, 9000, 60, 3*time.Hour, config.WattsPerInverter, config.Battery2, after).Watts)
+
+	within := time.Date(2025, 6, 1, 14, 30, 0, 0, time.UTC)
+	assert.Positive(t, drawdownRequest(0, forecast, 9000, 60, 3*time.Hour, config.WattsPerInverter, config.Battery2, within).Watts)
+	assert.Zero(t, drawdownRequest(0, forecast, 9000, 0, 3*time.Hour, config.WattsPerInverter, config.Battery2, within).Watts,
+		"no reserve configured")
+}
+
+func TestOvernightReserve_FollowsTomorrowsForecast(t *testing.T) {
+	reserve := OvernightReserve{CloudyWh: 3000, CloudySOC: 80, SunnyWh: 10000, SunnySOC: 40}
+	assert.True(t, reserve.Enabled())
+	assert.Equal(t, 80.0, reserve.SOC(1000), "cloudy: keep more")
+	assert.Equal(t, 60.0, reserve.SOC(6500))
+	assert.Equal(t, 40.0, reserve.SOC(15000), "sunny: go deeper")
+	assert.False(t, OvernightReserve{}.Enabled())
+}
+
+func TestSelectBaselineMode_DrawdownReserveFromTomorrowsForecast(t *testing.T) {
+	config := makeTestBaselineConfig()
+	config.DrawdownReserveSOC = 60
+	config.DrawdownWindow = 3 * time.Hour
+	config.OvernightReserve = OvernightReserve{CloudyWh: 3000, CloudySOC: 80, SunnyWh: 10000, SunnySOC: 40}
+	input := makeBaselineInput()
+	input.DetailedForecast = makeDrawdownForecast()
+	input.Battery2EnergyWh = 7000
+	now := time.Date(2025, 6, 1, 15, 0, 0, 0, time.UTC)
+
+	_, debug := selectBaselineMode(input, config, makeBlankBaselineState(config), now)
+	assert.Equal(t, 60.0, debug.ReserveSOC, "fixed reserve without tomorrow's forecast")
+
+	input.HasTomorrowForecast = true
+	input.TomorrowForecastWh = 2000
+	_, debug = selectBaselineMode(input, config, makeBlankBaselineState(config), now)
+	assert.Equal(t, 80.0, debug.ReserveSOC)
+	assert.Zero(t, findMode(debug.Modes, "Drawdown").Watts, "7000Wh is below an 80% reserve")
+
+	input.TomorrowForecastWh = 12000
+	_, debug = selectBaselineMode(input, config, makeBlankBaselineState(config), now)
+	assert.Equal(t, 40.0, debug.ReserveSOC)
+	assert.Positive(t, findMode(debug.Modes, "Drawdown").Watts)
+}
+
+func TestSelectBaselineMode_DrawdownStandsDownWhenIslanded(t *testing.T) {
+	config := makeTestBaselineConfig()
+	config.DrawdownReserveSOC = 60
+	config.DrawdownWindow = 3 * time.Hour
+	input := makeBaselineInput()
+	input.DetailedForecast = makeDrawdownForecast()
+	input.Battery2EnergyWh = 9000
+	input.Battery2SOC = 95
+	now := time.Date(2025, 6, 1, 15, 0, 0, 0, time.UTC)
+
+	_, debug := selectBaselineMode(input, config, makeBlankBaselineState(config), now)
+	assert.Positive(t, findMode(debug.Modes, "Drawdown").Watts)
+
+	input.GridAvailable = false
+	_, debug = selectBaselineMode(input, config, makeBlankBaselineState(config), now)
+	assert.Zero(t, findMode(debug.Modes, "Drawdown").Watts)
+}
+
+func TestSelectBaselineMode_CurtailmentTurnsEverythingOff(t *testing.T) {
+	config := makeTestBaselineConfig()
+	input := makeBaselineInput()
+	input.HouseLoad = 1000 // 2 inverters
+	input.Curtailed = true
+
+	count, debug := selectBaselineMode(input, config, makeBlankBaselineState(config), time.Now())
+	assert.Equal(t, 0, count)
+	assert.True(t, debug.Curtailed)
+
+	input.ManualMode = true
+	input.ManualInverterCount = 3
+	count, _ = selectBaselineMode(input, config, makeBlankBaselineState(config), time.Now())
+	assert.Equal(t, 0, count, "curtailment overrides manual")
+}
+
+func TestSelectBaselineMode_ManualOverridesModes(t *testing.T) {
+	config := makeTestBaselineConfig()
+	state := makeBlankBaselineState(config)
+	input := makeBaselineInput()
+	input.HouseLoad = 1000 // baseline alone would want 2
+	input.ManualMode = true
+	input.ManualInverterCount = 3
+
+	count, debug := selectBaselineMode(input, config, state, time.Now())
+	assert.Equal(t, 3, count)
+	assert.True(t, debug.Manual)
+	assert.False(t, findMode(debug.Modes, modeBaseline).Contributing)
+
+	input.ManualInverterCount = 10
+	count, _ = selectBaselineMode(input, config, state, time.Now())
+	assert.Equal(t, 3, count, "clamped to the inverter count")
+}
+
+func TestSelectBaselineMode_SelfConsumptionFollowsUnmetLoad(t *testing.T) {
+	config := makeTestBaselineConfig()
+	state := makeBlankBaselineState(config)
+	input := makeBaselineInput()
+	input.SelfConsumptionMode = true
+	input.Battery2SOC = 99 // overflow would want every inverter
+	input.Battery2ChargeState = "Float Charging"
+	input.HouseLoad = 900
+	input.Solar1Power = 300
+
+	count, debug := selectBaselineMode(input, config, state, time.Now())
+	assert.Equal(t, 2, count, "600W unmet rounds down to 2 inverters, never exporting")
+	assert.True(t, debug.SelfConsumption)
+	assert.Equal(t, 600.0, debug.RampTarget)
+
+	input.Solar2Power = 1000
+	count, _ = selectBaselineMode(input, config, makeBlankBaselineState(config), time.Now())
+	assert.Equal(t, 0, count, "solar covers the load")
+}
+
+func TestSelectBaselineMode_SelfConsumptionSmoothed(t *testing.T) {
+	config := makeTestBaselineConfig()
+	config.TargetRampThreshold = 255 * 60
+	state := makeBlankBaselineState(config)
+	input := makeBaselineInput()
+	input.SelfConsumptionMode = true
+	input.HouseLoad = 600
+
+	now := time.Now()
+	count, _ := selectBaselineMode(input, config, state, now)
+	assert.Equal(t, 2, count)
+
+	// A brief spike doesn't build enough pressure to move the count
+	input.HouseLoad = 1000
+	count, _ = selectBaselineMode(input, config, state, now.Add(10*time.Second))
+	assert.Equal(t, 2, count)
+	input.HouseLoad = 600
+	count, _ = selectBaselineMode(input, config, state, now.Add(20*time.Second))
+	assert.Equal(t, 2, count)
+}
+
+func TestSelectBaselineMode_ManualBeatsSelfConsumption(t *testing.T) {
+	config := makeTestBaselineConfig()
+	input := makeBaselineInput()
+	input.SelfConsumptionMode = true
+	input.ManualMode = true
+	input.ManualInverterCount = 3
+
+	count, debug := selectBaselineMode(input, config, makeBlankBaselineState(config), time.Now())
+	assert.Equal(t, 3, count)
+	assert.False(t, debug.SelfConsumption)
+}
+
+func TestSelectBaselineMode_ManualRespectsSOCLimit(t *testing.T) {
+	config := makeTestBaselineConfig()
+	input := makeBaselineInput()
+	input.ManualMode = true
+	input.ManualInverterCount = 3
+	input.Battery2SOC = 5
+
+	count, _ := selectBaselineMode(input, config, makeBlankBaselineState(config), time.Now())
+	assert.Equal(t, 0, count)
+
+	input.ACFreqP100_5Min = 53.0
+	input.Battery2SOC = 80
+	count, debug := selectBaselineMode(input, config, makeBlankBaselineState(config), time.Now())
+	assert.Equal(t, 0, count)
+	assert.Equal(t, "High frequency", debug.SafetyReason)
+}
+
+func TestSelectBaselineMode_TemperatureDerateCapsCount(t *testing.T) {
+	config := makeTestBaselineConfig()
+	input := makeBaselineInput()
+	input.ManualMode = true
+	input.ManualInverterCount = 3
+	input.HasDischargeDerate = true
+	input.Battery2DischargeDerate = 50
+
+	count, debug := selectBaselineMode(input, config, makeBlankBaselineState(config), time.Now())
+	assert.Equal(t, 1, count, "half of 3 inverters, rounded down")
+	assert.True(t, debug.TemperatureLimited)
+
+	input.Battery2DischargeDerate = 100
+	count, debug = selectBaselineMode(input, config, makeBlankBaselineState(config), time.Now())
+	assert.Equal(t, 3, count)
+	assert.False(t, debug.TemperatureLimited)
+}
+
+func TestSelectBaselineMode_CellUndervoltageSuspendsDischarge(t *testing.T) {
+	config := makeTestBaselineConfig()
+	input := makeBaselineInput()
+	input.ManualMode = true
+	input.ManualInverterCount = 3
+	input.Battery2CellUndervoltage = true
+
+	count, debug := selectBaselineMode(input, config, makeBlankBaselineState(config), time.Now())
+	assert.Equal(t, 0, count)
+	assert.Equal(t, "Cell undervoltage", debug.SafetyReason)
+}
+
+func TestSelectBaselineMode_CoordinatorCapsCount(t *testing.T) {
+	config := makeTestBaselineConfig()
+	input := makeBaselineInput()
+	input.ManualMode = true
+	input.ManualInverterCount = 3
+	input.HasInverterCap = true
+	input.Battery2InverterCap = 1
+
+	count, debug := selectBaselineMode(input, config, makeBlankBaselineState(config), time.Now())
+	assert.Equal(t, 1, count)
+	assert.True(t, debug.CoordinatorLimited)
+
+	input.Battery2InverterCap = 3
+	count, debug = selectBaselineMode(input, config, makeBlankBaselineState(config), time.Now())
+	assert.Equal(t, 3, count)
+	assert.False(t, debug.CoordinatorLimited)
+}
+
+func TestApplyLowVoltageLimit_HoldsUntilSustainedRecovery(t *testing.T) {
+	config := makeTestBaselineConfig()
+	state := makeBlankBaselineState(config)
+	input := makeBaselineInput()
+	start := time.Now()
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+
+	// Trip: a sag below the turn-off range cuts every inverter immediately
+	input.Battery2Voltage = 50.0
+	input.Battery2VoltageP50_5Min = 50.5
+	limit, recovering := applyLowVoltageLimit(input, config, state, at(0))
+	assert.Equal(t, 0, limit)
+	assert.False(t, recovering)
+
+	// Voltage rebounds at rest, but the sag is still the 15m window's minimum
+	input.Battery2Voltage = 53.5
+	input.Battery2VoltageP50_5Min = 53.5
+	limit, recovering = applyLowVoltageLimit(input, config, state, at(10*time.Minute))
+	assert.Equal(t, 0, limit)
+	assert.False(t, recovering)
+
+	// Once the sag ages out of the window the hysteresis would re-arm, but P50 must
+	// hold above the recovery voltage first
+	limit, recovering = applyLowVoltageLimit(input, config, state, at(17*time.Minute))
+	assert.Equal(t, 0, limit)
+	assert.True(t, recovering)
+
+	// A dip below the recovery voltage restarts the clock
+	input.Battery2VoltageP50_5Min = 51.5
+	limit, _ = applyLowVoltageLimit(input, config, state, at(22*time.Minute))
+	assert.Equal(t, 0, limit)
+	input.Battery2VoltageP50_5Min = 53.5
+	limit, _ = applyLowVoltageLimit(input, config, state, at(23*time.Minute))
+	assert.Equal(t, 0, limit)
+	limit, _ = applyLowVoltageLimit(input, config, state, at(28*time.Minute))
+	assert.Equal(t, 0, limit)
+
+	limit, recovering = applyLowVoltageLimit(input, config, state, at(33*time.Minute))
+	assert.Equal(t, 3, limit)
+	assert.False(t, recovering)
+}
+
+func TestApplyLowVoltageLimit_SagCompensation(t *testing.T) {
+	config := makeTestBaselineConfig() // decrease thresholds 50.75, 51.375, 52.0
+	config.LowVoltageSagPerInverter = 0.25
+	input := makeBaselineInput()
+	input.InverterStates = []bool{true, true, true}
+	input.Battery2Voltage = 51.5
+	input.Battery2VoltageP50_5Min = 52.5
+
+	limit, _ := applyLowVoltageLimit(input, config, makeBlankBaselineState(config), time.Now())
+	assert.Equal(t, 3, limit, "0.75V of sag compensation keeps 51.5V above 52.0V-0.75V")
+
+	config.LowVoltageSagPerInverter = 0
+	limit, _ = applyLowVoltageLimit(input, config, makeBlankBaselineState(config), time.Now())
+	assert.Equal(t, 2, limit)
+}
+
+func TestOverflowFromChargePower(t *testing.T) {
+	// Float current alone holds the count
+	assert.InDelta(t, 510.0, overflowFromChargePower(560, 2, 3, 255, 127.5).Watts, 0.001)
+	// Headroom tries one more
+	assert.InDelta(t, 765.0, overflowFromChargePower(700, 2, 3, 255, 127.5).Watts, 0.001)
+	// Capped at the inverter count
+	assert.InDelta(t, 765.0, overflowFromChargePower(1000, 3, 3, 255, 127.5).Watts, 0.001)
+	// Battery covering 300W of the draw drops two
+	assert.InDelta(t, 255.0, overflowFromChargePower(465, 3, 3, 255, 127.5).Watts, 0.001)
+}
+
+func TestSelectBaselineMode_OverflowFromChargePower(t *testing.T) {
+	config := makeTestBaselineConfig()
+	config.OverflowProbeWatts = 127.5
+	state := makeBlankBaselineState(config)
+	input := makeBaselineInput()
+	input.Battery2ChargeState = floatChargingState
+	input.Battery2SOC = 100.0 // SOC alone would want all 3
+	input.HasChargePower = true
+	input.Battery2ChargePower = 300
+	input.InverterStates = []bool{true, false, false}
+
+	count, _ := selectBaselineMode(input, config, state, time.Now())
+	assert.Equal(t, 1, count, "charge controller only has 45W beyond the one active inverter")
+
+	input.Battery2ChargeState = "Bulk Charging"
+	count, _ = selectBaselineMode(input, config, state, time.Now())
+	assert.Equal(t, 0, count, "power sizing only applies in float")
+}
+
+func TestSelectBaselineMode_TargetRampDelaysSpike(t *testing.T) {
+	config := makeTestBaselineConfig()
+	config.TargetRampThreshold = 255 * 60
+	config.PriceExportThreshold = 0.30
+	state := makeBlankBaselineState(config)
+	input := makeBaselineInput()
+	input.HasExportPrice = true
+	input.ExportPrice = 0.10
+	start := time.Now()
+
+	count, _ := selectBaselineMode(input, config, state, start)
+	assert.Equal(t, 0, count)
+
+	input.ExportPrice = 0.45 // price export wants all 3 (765W)
+	count, debug := selectBaselineMode(input, config, state, start.Add(5*time.Second))
+	assert.Equal(t, 0, count, "a 5s spike doesn't move the count")
+	assert.InDelta(t, 765.0, debug.RampTarget, 0.001)
+	assert.Positive(t, debug.RampPressure)
+
+	count, _ = selectBaselineMode(input, config, state, start.Add(20*time.Second))
+	assert.Equal(t, 3, count)
+}
+
+func TestSelectBaselineMode_GridPIDCoversImport(t *testing.T) {
+	config := makeTestBaselineConfig()
+	config.GridPID = governor.PIDConfig{Kp: 0.5, Ki: 0.05, OutMax: 765}
+	state := makeBlankBaselineState(config)
+	input := makeBaselineInput()
+	input.HasGridPower = true
+	input.GridPower = 600 // importing
+	start := time.Now()
+
+	count, debug := selectBaselineMode(input, config, state, start)
+	assert.Equal(t, 2, count, "0.5 × 600W = 300W")
+	assert.True(t, findMode(debug.Modes, modeGridPID).Contributing)
+
+	// Import persists: the integral keeps raising the target
+	count, _ = selectBaselineMode(input, config, state, start.Add(20*time.Second))
+	assert.Equal(t, 3, count)
+}
+
+func TestSelectBaselineMode_ExportLimitCutsAtOnce(t *testing.T) {
+	config := makeTestBaselineConfig()
+	config.ExportLimitWatts = 5000
+	config.ExportLimitRecovery = 5 * time.Minute
+	state := makeBlankBaselineState(config)
+	input := makeBaselineInput()
+	input.ManualMode = true
+	input.ManualInverterCount = 3
+	input.InverterStates = []bool{true, true, true}
+	input.HasGridPower = true
+	input.GridExportP99_1Min = 5300
+
+	count, debug := selectBaselineMode(input, config, state, time.Now())
+	assert.Equal(t, 1, count, "300W over needs 2 inverters off; overrides manual")
+	assert.True(t, debug.ExportLimited)
+	assert.Equal(t, 1, debug.ExportMaxInv)
+}
+
+func TestSelectBaselineMode_ExportLimitRecoversSlowly(t *testing.T) {
+	config := makeTestBaselineConfig()
+	config.ExportLimitWatts = 5000
+	config.ExportLimitRecovery = 5 * time.Minute
+	state := makeBlankBaselineState(config)
+	input := makeBaselineInput()
+	input.ManualMode = true
+	input.ManualInverterCount = 3
+	input.InverterStates = []bool{true, true, true}
+	input.HasGridPower = true
+	input.GridExportP99_1Min = 5600
+
+	now := time.Now()
+	count, _ := selectBaselineMode(input, config, state, now)
+	assert.Equal(t, 0, count)
+
+	input.InverterStates = []bool{false, false, false}
+	input.GridExportP99_1Min = 4800 // under the limit, but no room for a whole inverter
+	count, _ = selectBaselineMode(input, config, state, now.Add(10*time.Minute))
+	assert.Equal(t, 0, count)
+
+	input.GridExportP99_1Min = 4000
+	count, _ = selectBaselineMode(input, config, state, now.Add(11*time.Minute))
+	assert.Equal(t, 0, count)
+	count, _ = selectBaselineMode(input, config, state, now.Add(16*time.Minute))
+	assert.Equal(t, 1, count, "one inverter back after the recovery time")
+	count, _ = selectBaselineMode(input, config, state, now.Add(17*time.Minute))
+	assert.Equal(t, 1, count, "the next waits another recovery time")
+}
+
+func TestSelectBaselineMode_ExportLimitNeedsGridPower(t *testing.T) {
+	config := makeTestBaselineConfig()
+	config.ExportLimitWatts = 5000
+	input := makeBaselineInput()
+	input.ManualMode = true
+	input.ManualInverterCount = 3
+	input.GridExportP99_1Min = 8000
+
+	count, debug := selectBaselineMode(input, config, makeBlankBaselineState(config), time.Now())
+	assert.Equal(t, 3, count)
+	assert.False(t, debug.ExportLimited)
+}
+
+func TestInverterCountWithHysteresis(t *testing.T) {
+	h := newInverterCountHysteresis(3, 255, 25)
+	assert.Equal(t, 0, inverterCountWithHysteresis(20, h), "under the first step's band")
+	assert.Equal(t, 1, inverterCountWithHysteresis(100, h))
+	assert.Equal(t, 1, inverterCountWithHysteresis(270, h), "just past one inverter: holds")
+	assert.Equal(t, 2, inverterCountWithHysteresis(285, h))
+	assert.Equal(t, 2, inverterCountWithHysteresis(240, h), "just under: holds")
+	assert.Equal(t, 1, inverterCountWithHysteresis(225, h))
+	assert.Equal(t, 3, inverterCountWithHysteresis(2000, h), "capped at the inverter count")
+	assert.Equal(t, 0, inverterCountWithHysteresis(0, h), "no target turns everything off")
+}
+
+func TestSelectBaselineMode_CountHysteresis(t *testing.T) {
+	config := makeTestBaselineConfig()
+	config.CountHysteresisWatts = 25
+	state := makeBlankBaselineState(config)
+	state.countHyst = newInverterCountHysteresis(3, config.WattsPerInverter, config.CountHysteresisWatts)
+	input := makeBaselineInput()
+	input.EVReservedWatts = 300
+	now := time.Now()
+
+	count, _ := selectBaselineMode(input, config, state, now)
+	assert.Equal(t, 2, count)
+
+	// Ceil would drop to one inverter as soon as the target dips under 255W
+	input.EVReservedWatts = 245
+	count, _ = selectBaselineMode(input, config, state, now.Add(time.Second))
+	assert.Equal(t, 2, count)
+	input.EVReservedWatts = 200
+	count, _ = selectBaselineMode(input, config, state, now.Add(2*time.Second))
+	assert.Equal(t, 1, count)
+}
+
+func TestTrimSetpoint(t *testing.T) {
+	assert.Equal(t, 145.0, trimSetpoint(655, 3, 255), "two flat out, trim covers the rest")
+	assert.Equal(t, 255.0, trimSetpoint(765, 3, 255))
+	assert.Equal(t, 255.0, trimSetpoint(2000, 3, 255), "count capped below the target")
+	assert.Equal(t, 100.0, trimSetpoint(100, 1, 255))
+}
+
+func TestApplyTrimSetpoint(t *testing.T) {
+	ch := make(chan MQTTMessage, 4)
+	sender := NewMQTTSender(ch)
+	inverters := []InverterInfo{
+		{EntityID: "switch.inv1", PowerLimitEntityID: "number.inv1_power_limit"},
+		{EntityID: "switch.inv2"},
+	}
+
+	last := applyTrimSetpoint(inverters, sender, 2, 400, 255, 0)
+	assert.Equal(t, 145.0, last)
+	var call proxyServiceCall
+	assert.NoError(t, json.Unmarshal((<-ch).Payload, &call))
+	assert.Equal(t, "set_value", call.Service)
+	assert.Equal(t, "number.inv1_power_limit", call.EntityID)
+
+	assert.Equal(t, 145.0, applyTrimSetpoint(inverters, sender, 2, 400, 255, last))
+	assert.Empty(t, ch, "unchanged setpoint isn't resent")
+
+	assert.Equal(t, 145.0, applyTrimSetpoint(inverters, sender, 0, 0, 255, last))
+	assert.Empty(t, ch, "trim inverter off")
+}
+
+func TestSelectBaselineMode_SelfConsumptionWithTrimInverter(t *testing.T) {
+	config := makeTestBaselineConfig()
+	config.Battery2.Inverters[0].PowerLimitEntityID = "number.inv1_power_limit"
+	input := makeBaselineInput()
+	input.SelfConsumptionMode = true
+	input.HouseLoad = 600
+
+	count, debug := selectBaselineMode(input, config, makeBlankBaselineState(config), time.Now())
+	assert.Equal(t, 3, count, "rounds up; the trim inverter makes up 90W")
+	assert.Equal(t, 600.0, debug.TargetWatts)
+}
+
+func TestInverterDwell_Hold(t *testing.T) {
+	t0 := time.Now()
+	var d InverterDwell
+	d.Observe([]bool{true, false, false}, t0)
+	assert.Equal(t, 0, d.Hold(0, 5*time.Minute, 2*time.Minute, t0), "startup states are settled")
+
+	d.Observe([]bool{true, true, false}, t0.Add(time.Minute))
+	assert.Equal(t, 2, d.Hold(1, 5*time.Minute, 2*time.Minute, t0.Add(3*time.Minute)), "inv2 held on")
+	assert.Equal(t, 1, d.Hold(1, 5*time.Minute, 2*time.Minute, t0.Add(6*time.Minute)))
+
+	d.Observe([]bool{true, false, false}, t0.Add(6*time.Minute))
+	assert.Equal(t, 1, d.Hold(3, 5*time.Minute, 2*time.Minute, t0.Add(7*time.Minute)), "inv2 held off")
+	assert.Equal(t, 3, d.Hold(3, 5*time.Minute, 2*time.Minute, t0.Add(8*time.Minute)))
+	assert.Equal(t, 3, d.Hold(3, 0, 0, t0.Add(7*time.Minute)), "0 disables")
+}
+
+func TestSelectBaselineMode_MinOnTimeHoldsInverter(t *testing.T) {
+	config := makeTestBaselineConfig()
+	config.MinOnTime = 5 * time.Minute
+	state := makeBlankBaselineState(config)
+	input := makeBaselineInput()
+	input.SelfConsumptionMode = true
+	t0 := time.Now()
+
+	selectBaselineMode(input, config, state, t0)
+	input.InverterStates = []bool{true, false, false}
+	input.HouseLoad = 0
+
+	count, debug := selectBaselineMode(input, config, state, t0.Add(time.Minute))
+	assert.Equal(t, 1, count, "just turned on")
+	assert.True(t, debug.DwellHeld)
+
+	count, debug = selectBaselineMode(input, config, state, t0.Add(6*time.Minute))
+	assert.Equal(t, 0, count)
+	assert.False(t, debug.DwellHeld)
+
+	input.ManualMode = true
+	input.InverterStates = []bool{false, true, false}
+	count, _ = selectBaselineMode(input, config, state, t0.Add(7*time.Minute))
+	assert.Equal(t, 0, count, "manual ignores the dwell")
+}
@@ -0,0 +1,100 @@
+package workers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ryansname/powerctl/internal/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateRoundTripEfficiency(t *testing.T) {
+	// 10 kWh in, 9 kWh out between two full-charge calibrations
+	eff, ok := estimateRoundTripEfficiency(100, 50, 110, 59, 4.75)
+	assert.True(t, ok)
+	assert.InDelta(t, 0.9, eff, 1e-9)
+}
+
+func TestEstimateRoundTripEfficiency_TooLittleCycled(t *testing.T) {
+	_, ok := estimateRoundTripEfficiency(100, 50, 101, 51, 4.75)
+	assert.False(t, ok, "1 kWh out is below the half-capacity threshold")
+}
+
+func TestEstimateRoundTripEfficiency_Implausible(t *testing.T) {
+	_, ok := estimateRoundTripEfficiency(100, 50, 105, 60, 4.75)
+	assert.False(t, ok, "more out than in means a calibration point was wrong")
+
+	_, ok = estimateRoundTripEfficiency(100, 50, 100, 60, 4.75)
+	assert.False(t, ok, "no inflow")
+}
+
+func TestBatteryCalibWorker_RecordsCalibrationEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	out := make(chan MQTTMessage, 20)
+	dataChan := make(chan DisplayData)
+	pressChan := make(chan SensorMessage)
+	config := BatteryCalibConfig{
+		Name:                 "battery9",
+		ChargeStateTopic:     "t/charge_state",
+		BatteryVoltageTopic:  "t/voltage",
+		InflowEnergyTopics:   []string{"t/in"},
+		InflowPowerTopics:    []string{"t/in_power"},
+		HighVoltageThreshold: 53.6,
+		FloatChargeState:     "Float Charging",
+	}
+	go batteryCalibWorker(ctx, dataChan, pressChan, config, NewMQTTSender(out), nil)
+
+	lastCalibrated := batteryDerivedStateTopic("battery9", "last_calibrated")
+	topicsOf := func(n int) []string {
+		var topics []string
+		for range n {
+			topics = append(topics, (<-out).Topic)
+		}
+		return topics
+	}
+
+	// No data yet: nothing to calibrate to
+	pressChan <- SensorMessage{Topic: batteryCalibratePressTopic("battery9"), Value: "PRESS"}
+
+	floatData := DisplayData{TopicData: map[string]any{
+		"t/charge_state": &stats.StringTopicData{Current: "Float Charging"},
+		"t/voltage":      &stats.FloatTopicData{Current: 54},
+		"t/in":           &stats.FloatTopicData{Current: 120.5},
+		"t/in_power":     &stats.FloatTopicData{Current: 100},
+	}}
+	// The first float calibration is an event; repeats only refresh the point
+	dataChan <- floatData
+	assert.Contains(t, topicsOf(3), lastCalibrated)
+	dataChan <- floatData
+	assert.Equal(t, []string{NewTopicBuilder("battery9").Attributes("sensor", "")}, topicsOf(1))
+
+	pressChan <- SensorMessage{Topic: batteryCalibratePressTopic("battery9"), Value: "PRESS"}
+	topicsOf(1) // the calibration point
+	attributes := <-out
+	assert.Equal(t, NewTopicBuilder("battery9").Attributes("sensor", "last_calibrated"), attributes.Topic)
+	assert.JSONEq(t, `{"trigger":"manual","soc":100,"inflows":120.5,"outflows":0,"voltage":54}`, string(attributes.Payload))
+	assert.Equal(t, lastCalibrated, (<-out).Topic)
+	assert.Empty(t, out)
+}
+
+func TestPublishEfficiency_UsesLastFullCalibration(t *testing.T) {
+	battery2, _ := DefaultBatteryConfigs()
+	config := battery2.CalibConfig()
+	out := make(chan MQTTMessage, 10)
+	data := DisplayData{TopicData: map[string]any{
+		// A soft cap or anchor has since moved the calibration point
+		config.CalibrationTopics.Inflows:      &stats.FloatTopicData{Current: 108},
+		config.CalibrationTopics.Outflows:     &stats.FloatTopicData{Current: 57},
+		config.FullCalibrationTopics.Inflows:  &stats.FloatTopicData{Current: 100},
+		config.FullCalibrationTopics.Outflows: &stats.FloatTopicData{Current: 50},
+	}}
+
+	publishEfficiency(NewMQTTSender(out), config, data, 110, 59)
+
+	assert.Equal(t, `{"full_calibration_inflows":110,"full_calibration_outflows":59}`, string((<-out).Payload))
+	efficiency := <-out
+	assert.Equal(t, batteryDerivedStateTopic(config.Name, "round_trip_efficiency"), efficiency.Topic)
+	assert.Equal(t, "90.0", string(efficiency.Payload))
+}
@@ -0,0 +1,563 @@
+package workers
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/ryansname/powerctl/governor"
+	"github.com/ryansname/powerctl/internal/ha"
+)
+
+// solarForecastMultiplier scales the single-site Solcast forecast to the actual array output.
+// Shared by the Battery 2 baseline forecast-excess mode and the Battery 3 dynamic charge limit.
+const solarForecastMultiplier = 3.9
+
+// BatteryConfig holds shared configuration for a battery
+type BatteryConfig struct {
+	Name                 string
+	CapacityKWh          float64
+	Manufacturer         string
+	InflowEnergyTopics   []string // Cumulative energy (kWh)
+	OutflowEnergyTopics  []string // Cumulative energy (kWh)
+	InflowPowerTopics    []string // Instantaneous power (W)
+	OutflowPowerTopics   []string // Instantaneous power (W); the output of InverterSwitchIDs, in order
+	ChargeStateTopic     string
+	BatteryVoltageTopic  string
+	CalibrationTopics    CalibrationTopics
+	HighVoltageThreshold float64
+	FloatChargeState     string
+	ConversionLossRate   float64
+	InverterSwitchIDs    []string
+	CerboSOCTopic        string // If set, SOC entity reads from this Cerbo MQTT topic instead of powerctl state
+	// UseMeasuredEfficiency replaces ConversionLossRate in the SOC calculation with the
+	// round-trip efficiency estimated between calibrations (once one is available).
+	UseMeasuredEfficiency bool
+	// EmptyVoltageThreshold is the voltage treated as the 0% anchor when measuring
+	// effective capacity for State of Health. 0 disables SOH tracking.
+	EmptyVoltageThreshold float64
+	// ChargeLimit caps the solar charge controller near the absorb threshold. nil disables.
+	ChargeLimit *ChargeLimitConfig
+	// LowVoltageTrip is the voltage below which the safety interlock refuses to turn
+	// any of InverterSwitchIDs on and baseline control starts shedding them. 0 disables.
+	LowVoltageTrip float64
+	// LowVoltageRecovery is the resting voltage that shows real charge rather than a
+	// rebound once load is shed; baseline control restores inverters after holding it.
+	// Must lie between LowVoltageTrip and HighVoltageThreshold.
+	LowVoltageRecovery float64
+	// LowVoltageFastTrip is the instantaneous voltage at which baseline control sheds
+	// every inverter straight from the raw MQTT reading, without waiting for stats or
+	// the recovery hold. Must be below LowVoltageTrip. 0 disables.
+	LowVoltageFastTrip float64
+	// Temperature derates charge and discharge from temperature sensors. nil disables.
+	Temperature *TemperatureConfig
+	// BMS monitors per-cell voltages and suspends discharge on a low cell. nil disables.
+	BMS *BMSConfig
+	// InverterModbus switches some of InverterSwitchIDs (the keys) over Modbus-TCP
+	// instead of HA. The switch entity's state topic still reports whether it is on.
+	InverterModbus map[string]ModbusTarget
+	// InverterShelly switches some of InverterSwitchIDs (the keys) through their Shelly
+	// relay's local RPC, falling back to HA when the relay is unreachable.
+	InverterShelly map[string]ShellyTarget
+	// SOCPublishEpsilon is the SOC change (%) worth publishing; smaller moves wait for
+	// the state heartbeat. 0 publishes every change.
+	SOCPublishEpsilon float64
+	// SOCReserve limits how many of InverterSwitchIDs may run by SOC; IslandSOCReserve
+	// replaces it while islanded or in storm mode. Zero disables.
+	SOCReserve       SOCReserve
+	IslandSOCReserve SOCReserve
+	// InverterPowerLimit gives some of InverterSwitchIDs (the keys) an adjustable output
+	// through an HA number entity (W). The first on is the trim inverter.
+	InverterPowerLimit map[string]string
+	// SOCAnchors are resting voltages for the battery's chemistry that correct the SOC
+	// between full-charge calibrations. Empty calibrates at full only.
+	SOCAnchors []SOCAnchor
+}
+
+// DefaultBatteryConfigs returns the site's battery definitions.
+func DefaultBatteryConfigs() (battery2, battery3 BatteryConfig) {
+	battery2 = BatteryConfig{
+		Name:         deviceNameBattery2,
+		CapacityKWh:  9.5,
+		Manufacturer: "SunnyTech Solar",
+		InflowEnergyTopics: []string{
+			"homeassistant/sensor/solar_5_total_energy/state",
+		},
+		OutflowEnergyTopics: []string{
+			"homeassistant/sensor/powerhouse_inverter_1_switch_0_energy/state",
+			"homeassistant/sensor/powerhouse_inverter_2_switch_0_energy/state",
+			"homeassistant/sensor/powerhouse_inverter_3_switch_0_energy/state",
+			"homeassistant/sensor/powerhouse_inverter_4_switch_0_energy/state",
+			"homeassistant/sensor/powerhouse_inverter_5_switch_0_energy/state",
+			"homeassistant/sensor/powerhouse_inverter_6_switch_0_energy/state",
+			"homeassistant/sensor/powerhouse_inverter_7_switch_0_energy/state",
+			"homeassistant/sensor/powerhouse_inverter_8_switch_0_energy/state",
+			"homeassistant/sensor/powerhouse_inverter_9_switch_0_energy/state",
+		},
+		InflowPowerTopics: []string{
+			"homeassistant/sensor/solar_5_solar_power/state",
+		},
+		OutflowPowerTopics: []string{
+			"homeassistant/sensor/powerhouse_inverter_1_switch_0_power/state",
+			"homeassistant/sensor/powerhouse_inverter_2_switch_0_power/state",
+			"homeassistant/sensor/powerhouse_inverter_3_switch_0_power/state",
+			"homeassistant/sensor/powerhouse_inverter_4_switch_0_power/state",
+			"homeassistant/sensor/powerhouse_inverter_5_switch_0_power/state",
+			"homeassistant/sensor/powerhouse_inverter_6_switch_0_power/state",
+			"homeassistant/sensor/powerhouse_inverter_7_switch_0_power/state",
+			"homeassistant/sensor/powerhouse_inverter_8_switch_0_power/state",
+			"homeassistant/sensor/powerhouse_inverter_9_switch_0_power/state",
+		},
+		ChargeStateTopic:    "homeassistant/sensor/solar_5_charge_state/state",
+		BatteryVoltageTopic: "homeassistant/sensor/solar_5_battery_voltage/state",
+		CalibrationTopics: CalibrationTopics{
+			Inflows:  NewTopicBuilder(deviceNameBattery2).Statestream("sensor", "State of Charge", "calibration_inflows"),
+			Outflows: NewTopicBuilder(deviceNameBattery2).Statestream("sensor", "State of Charge", "calibration_outflows"),
+		},
+		HighVoltageThreshold: 53.6,
+		FloatChargeState:     "Float Charging",
+		ConversionLossRate:   0.10,
+		SOCPublishEpsilon:    0.1,
+		// Matches the low-voltage inverter cutoff, the lowest point B2 is normally driven to
+		EmptyVoltageThreshold: 50.75,
+		LowVoltageTrip:        50.75,
+		LowVoltageRecovery:    52.0,
+		LowVoltageFastTrip:    49.5,
+		SOCReserve:            SOCReserve{TurnOnStart: 15, TurnOnEnd: 25, TurnOffStart: 12.5, TurnOffEnd: 22.5},
+		SOCAnchors:            lifePO4SOCAnchors16S,
+		IslandSOCReserve:      SOCReserve{TurnOnStart: 40, TurnOnEnd: 50, TurnOffStart: 37.5, TurnOffEnd: 47.5},
+		InverterSwitchIDs: []string{
+			"switch.powerhouse_inverter_1_switch_0",
+			"switch.powerhouse_inverter_2_switch_0",
+			"switch.powerhouse_inverter_3_switch_0",
+			"switch.powerhouse_inverter_4_switch_0",
+			"switch.powerhouse_inverter_5_switch_0",
+			"switch.powerhouse_inverter_6_switch_0",
+			"switch.powerhouse_inverter_7_switch_0",
+			"switch.powerhouse_inverter_8_switch_0",
+			"switch.powerhouse_inverter_9_switch_0",
+		},
+	}
+
+	battery3 = BatteryConfig{
+		Name:         deviceNameBattery3,
+		CapacityKWh:  3 * 14.5,
+		Manufacturer: "Micromall",
+		InflowEnergyTopics: []string{
+			"homeassistant/sensor/solar_3_total_energy/state",
+			"homeassistant/sensor/solar_4_total_energy/state",
+		},
+		OutflowEnergyTopics: []string{},
+		InflowPowerTopics: []string{
+			"homeassistant/sensor/solar_3_solar_power/state",
+			"homeassistant/sensor/solar_4_solar_power/state",
+		},
+		OutflowPowerTopics:  []string{},
+		ChargeStateTopic:    "homeassistant/sensor/solar_3_charge_state/state",
+		BatteryVoltageTopic: "homeassistant/sensor/solar_3_battery_voltage/state",
+		CalibrationTopics: CalibrationTopics{
+			Inflows:  NewTopicBuilder(deviceNameBattery3).Statestream("sensor", "State of Charge", "calibration_inflows"),
+			Outflows: NewTopicBuilder(deviceNameBattery3).Statestream("sensor", "State of Charge", "calibration_outflows"),
+		},
+		HighVoltageThreshold: 53.6,
+		FloatChargeState:     "Float Charging",
+		ConversionLossRate:   0.05,
+		SOCPublishEpsilon:    0.1,
+		InverterSwitchIDs:    []string{},
+		CerboSOCTopic:        TopicCerboBatterySOC,
+	}
+
+	return battery2, battery3
+}
+
+// SOCReserve is a SOC ladder (%) on a battery's inverter count: the first inverter
+// may run above TurnOnStart and all of them above TurnOnEnd; they are shed one by one
+// below TurnOffEnd, the last below TurnOffStart, the reserve floor.
+type SOCReserve struct {
+	TurnOnStart  float64 `json:"turn_on_start"`
+	TurnOnEnd    float64 `json:"turn_on_end"`
+	TurnOffStart float64 `json:"turn_off_start"`
+	TurnOffEnd   float64 `json:"turn_off_end"`
+}
+
+// Hysteresis returns the ladder as a stepped hysteresis over steps inverters, starting
+// with all of them allowed.
+func (r SOCReserve) Hysteresis(steps int) *governor.SteppedHysteresis {
+	h := governor.NewSteppedHysteresis(steps, true, r.TurnOnStart, r.TurnOnEnd, r.TurnOffStart, r.TurnOffEnd)
+	h.Current = steps
+	return h
+}
+
+// Validate checks the ladder lies within 0–100%, ascends, and turns off below where
+// it turns on.
+func (r SOCReserve) Validate() error {
+	var errs []error
+	for _, v := range []float64{r.TurnOnStart, r.TurnOnEnd, r.TurnOffStart, r.TurnOffEnd} {
+		if v < 0 || v > 100 {
+			errs = append(errs, fmt.Errorf("SOC reserve threshold %.1f%% not in 0–100%%", v))
+		}
+	}
+	if r.TurnOnStart > r.TurnOnEnd || r.TurnOffStart > r.TurnOffEnd {
+		errs = append(errs, errors.New("SOC reserve thresholds must ascend from start to end"))
+	}
+	if r.TurnOffStart > r.TurnOnStart || r.TurnOffEnd > r.TurnOnEnd {
+		errs = append(errs, fmt.Errorf("SOC reserve turn-off (%.1f–%.1f%%) above turn-on (%.1f–%.1f%%)",
+			r.TurnOffStart, r.TurnOffEnd, r.TurnOnStart, r.TurnOnEnd))
+	}
+	return errors.Join(errs...)
+}
+
+// CalibrationTopics holds statestream topic paths for calibration data
+type CalibrationTopics struct {
+	Inflows  string
+	Outflows string
+}
+
+// BatteryCalibConfig holds configuration for the calibration worker
+type BatteryCalibConfig struct {
+	Name                  string
+	ChargeStateTopic      string
+	BatteryVoltageTopic   string
+	InflowEnergyTopics    []string // Cumulative energy (kWh)
+	OutflowEnergyTopics   []string // Cumulative energy (kWh)
+	InflowPowerTopics     []string // Instantaneous power (W)
+	OutflowPowerTopics    []string // Instantaneous power (W)
+	HighVoltageThreshold  float64
+	FloatChargeState      string
+	CalibrationTopics     CalibrationTopics // To read/write calibration values
+	SOCTopic              string            // To read current SOC from DisplayData
+	CapacityKWh           float64
+	ConversionLossRate    float64
+	EmptyVoltageThreshold float64 // 0 disables SOH cycle tracking
+	SOHHistoryTopic       string  // Retained SOH cycle history, read back via statestream
+	SOCAnchors            []SOCAnchor
+	EfficiencyTopic       string // As BatterySOCConfig, so anchors solve with the same loss rate
+	// Totals at the last full calibration, which efficiency is estimated against. Unlike
+	// CalibrationTopics, soft caps and SOC anchors don't move them.
+	FullCalibrationTopics CalibrationTopics
+}
+
+// BatterySOCConfig holds configuration for the SOC worker
+type BatterySOCConfig struct {
+	Name                string
+	CapacityKWh         float64
+	InflowEnergyTopics  []string
+	OutflowEnergyTopics []string
+	CalibrationTopics   CalibrationTopics
+	ConversionLossRate  float64
+	EfficiencyTopic     string  // Measured round-trip efficiency (%); empty uses ConversionLossRate only
+	PublishEpsilon      float64 // SOC change (%) worth publishing
+}
+
+// Topics returns the statestream topics the battery's workers read.
+func (c *BatteryConfig) Topics() []string {
+	topics := slices.Concat(c.InflowEnergyTopics, c.OutflowEnergyTopics, c.InflowPowerTopics, c.OutflowPowerTopics)
+	topics = append(topics, c.ChargeStateTopic, c.BatteryVoltageTopic)
+	topics = append(topics, c.CalibrationTopics.Inflows, c.CalibrationTopics.Outflows)
+	if c.UseMeasuredEfficiency {
+		topics = append(topics, c.EfficiencyTopic())
+	}
+	if len(c.OutflowEnergyTopics) > 0 {
+		full := c.FullCalibrationTopics()
+		topics = append(topics, full.Inflows, full.Outflows)
+	}
+	if c.EmptyVoltageThreshold > 0 {
+		topics = append(topics, sohHistoryTopic(c.Name))
+	}
+	if c.ChargeLimit != nil {
+		topics = append(topics, c.ChargeLimit.SetpointStateTopic())
+	}
+	return topics
+}
+
+// CriticalTopics returns the HA sensors the battery's control decisions hinge on, which
+// must be fresh before actuating after a Home Assistant restart.
+func (c *BatteryConfig) CriticalTopics() []string {
+	topics := slices.Concat(c.InflowPowerTopics, c.OutflowPowerTopics)
+	return append(topics, c.ChargeStateTopic, c.BatteryVoltageTopic)
+}
+
+// Plausible readings from a 48V battery's sensors, in the units HA reports (V, kWh).
+// The voltage range rejects 0V dropouts; the energy step rejects counters that jump by
+// several times their total when a Shelly reboots.
+var (
+	batteryVoltageRule = PlausibilityRule{Min: 40, Max: 62, MaxStep: 4, StepInterval: time.Minute}
+	energyCounterRule  = PlausibilityRule{MaxStep: 1, StepInterval: time.Minute}
+)
+
+// PlausibilityRules returns the rules statsWorker applies to the battery's voltage and
+// cumulative energy topics.
+func (c *BatteryConfig) PlausibilityRules() map[string]PlausibilityRule {
+	rules := map[string]PlausibilityRule{c.BatteryVoltageTopic: batteryVoltageRule}
+	for _, topic := range slices.Concat(c.InflowEnergyTopics, c.OutflowEnergyTopics) {
+		rules[topic] = energyCounterRule
+	}
+	return rules
+}
+
+// CalibConfig creates a BatteryCalibConfig from the shared BatteryConfig
+func (c *BatteryConfig) CalibConfig() BatteryCalibConfig {
+	config := BatteryCalibConfig{
+		Name:                  c.Name,
+		ChargeStateTopic:      c.ChargeStateTopic,
+		BatteryVoltageTopic:   c.BatteryVoltageTopic,
+		InflowEnergyTopics:    c.InflowEnergyTopics,
+		OutflowEnergyTopics:   c.OutflowEnergyTopics,
+		InflowPowerTopics:     c.InflowPowerTopics,
+		OutflowPowerTopics:    c.OutflowPowerTopics,
+		HighVoltageThreshold:  c.HighVoltageThreshold,
+		FloatChargeState:      c.FloatChargeState,
+		CalibrationTopics:     c.CalibrationTopics,
+		SOCTopic:              c.SOCTopic(),
+		CapacityKWh:           c.CapacityKWh,
+		ConversionLossRate:    c.ConversionLossRate,
+		EmptyVoltageThreshold: c.EmptyVoltageThreshold,
+		SOHHistoryTopic:       sohHistoryTopic(c.Name),
+		SOCAnchors:            c.SOCAnchors,
+	}
+	if c.UseMeasuredEfficiency {
+		config.EfficiencyTopic = c.EfficiencyTopic()
+	}
+	if len(c.OutflowEnergyTopics) > 0 {
+		config.FullCalibrationTopics = c.FullCalibrationTopics()
+	}
+	return config
+}
+
+// SOCTopic returns the statestream topic for the battery's State of Charge sensor.
+func (c *BatteryConfig) SOCTopic() string {
+	return NewTopicBuilder(c.Name).Statestream("sensor", "State of Charge", "state")
+}
+
+// EfficiencyTopic returns the statestream topic for the battery's round-trip efficiency sensor.
+func (c *BatteryConfig) EfficiencyTopic() string {
+	return NewTopicBuilder(c.Name).Statestream("sensor", "Round Trip Efficiency", "state")
+}
+
+// FullCalibrationTopics returns the statestream topics for the totals at the last full
+// calibration, kept as attributes of the round-trip efficiency sensor.
+func (c *BatteryConfig) FullCalibrationTopics() CalibrationTopics {
+	topics := NewTopicBuilder(c.Name)
+	return CalibrationTopics{
+		Inflows:  topics.Statestream("sensor", "Round Trip Efficiency", "full_calibration_inflows"),
+		Outflows: topics.Statestream("sensor", "Round Trip Efficiency", "full_calibration_outflows"),
+	}
+}
+
+// AvailableEnergyTopic returns the statestream topic for the battery's Available Energy sensor.
+func (c *BatteryConfig) AvailableEnergyTopic() string {
+	return NewTopicBuilder(c.Name).Statestream("sensor", "Available Energy", "state")
+}
+
+// RuntimeConfig creates a BatteryRuntimeConfig for the time-to-empty / time-to-full
+// sensors. Only meaningful with both inflow and outflow power metered.
+func (c *BatteryConfig) RuntimeConfig() BatteryRuntimeConfig {
+	return BatteryRuntimeConfig{
+		Name:                 c.Name,
+		CapacityWh:           c.CapacityKWh * 1000,
+		AvailableEnergyTopic: c.AvailableEnergyTopic(),
+		InflowPowerTopics:    c.InflowPowerTopics,
+		OutflowPowerTopics:   c.OutflowPowerTopics,
+	}
+}
+
+// AvailableEnergyFromSOCConfig creates a BatteryAvailableEnergyConfig for batteries
+// whose SOC is published by an external source (e.g. Cerbo GX via HA entity).
+func (c *BatteryConfig) AvailableEnergyFromSOCConfig() BatteryAvailableEnergyConfig {
+	return BatteryAvailableEnergyConfig{
+		Name:           c.Name,
+		SOCTopic:       c.SOCTopic(),
+		CapacityKWh:    c.CapacityKWh,
+		PublishEpsilon: c.SOCPublishEpsilon,
+	}
+}
+
+// SOCConfig creates a BatterySOCConfig from the shared BatteryConfig
+func (c *BatteryConfig) SOCConfig() BatterySOCConfig {
+	config := BatterySOCConfig{
+		Name:                c.Name,
+		CapacityKWh:         c.CapacityKWh,
+		InflowEnergyTopics:  c.InflowEnergyTopics,
+		OutflowEnergyTopics: c.OutflowEnergyTopics,
+		CalibrationTopics:   c.CalibrationTopics,
+		ConversionLossRate:  c.ConversionLossRate,
+		PublishEpsilon:      c.SOCPublishEpsilon,
+	}
+	if c.UseMeasuredEfficiency {
+		config.EfficiencyTopic = c.EfficiencyTopic()
+	}
+	return config
+}
+
+// InterlockBattery returns the safety interlock's view of this battery.
+func (b BatteryConfig) InterlockBattery() InterlockBattery {
+	interlock := InterlockBattery{
+		Name:           b.Name,
+		VoltageTopic:   b.BatteryVoltageTopic,
+		LowVoltageTrip: b.LowVoltageTrip,
+		Inverters:      buildInverterGroup(b, "").Inverters,
+	}
+	if b.BMS != nil {
+		interlock.CellVoltageTopics = b.BMS.CellVoltageTopics
+		interlock.MinCellVoltage = b.BMS.MinCellVoltage
+	}
+	return interlock
+}
+
+// buildInverterGroup converts a BatteryConfig to a BatteryInverterGroup.
+func buildInverterGroup(b BatteryConfig, availableEnergyTopic string) BatteryInverterGroup {
+	inverters := make([]InverterInfo, len(b.InverterSwitchIDs))
+	for i, entityID := range b.InverterSwitchIDs {
+		inverters[i] = InverterInfo{EntityID: entityID, StateTopic: ha.EntityStateTopic(entityID)}
+		if target, ok := b.InverterModbus[entityID]; ok {
+			inverters[i].Modbus = &target
+		}
+		if target, ok := b.InverterShelly[entityID]; ok {
+			inverters[i].Shelly = &target
+		}
+		inverters[i].PowerLimitEntityID = b.InverterPowerLimit[entityID]
+		if i < len(b.OutflowPowerTopics) {
+			inverters[i].PowerTopic = b.OutflowPowerTopics[i]
+		}
+	}
+	return BatteryInverterGroup{
+		Name:                 b.Name,
+		Inverters:            inverters,
+		ChargeStateTopic:     b.ChargeStateTopic,
+		SOCTopic:             b.SOCTopic(),
+		BatteryVoltageTopic:  b.BatteryVoltageTopic,
+		CapacityWh:           b.CapacityKWh * 1000,
+		SolarMultiplier:      solarForecastMultiplier,
+		AvailableEnergyTopic: availableEnergyTopic,
+	}
+}
+
+// BuildBaselineInverterConfig creates configuration for the baseline inverter controller.
+func BuildBaselineInverterConfig(battery2, battery3 BatteryConfig) BaselineInverterConfig {
+	group := buildInverterGroup(battery2, TopicBattery2Energy)
+	inverterStateTopics := make([]string, len(battery2.InverterSwitchIDs))
+	for i, entityID := range battery2.InverterSwitchIDs {
+		inverterStateTopics[i] = ha.EntityStateTopic(entityID)
+	}
+	var inverterPowerTopics []string
+	for _, inv := range group.Inverters {
+		if inv.PowerTopic != "" {
+			inverterPowerTopics = append(inverterPowerTopics, inv.PowerTopic)
+		}
+	}
+
+	input := BaselineInputConfig{
+		Battery2SOCTopic:         battery2.SOCTopic(),
+		Battery2ChargeStateTopic: battery2.ChargeStateTopic,
+		Battery2VoltageTopic:     battery2.BatteryVoltageTopic,
+		Battery2EnergyTopic:      TopicBattery2Energy,
+		Solar1PowerTopic:         TopicSolar1Power,
+		Solar2PowerTopic:         topicSolar2ACPower,
+		HouseLoadTopic:           topicHouseLoadPower2,
+		GridStatusTopic:          "homeassistant/binary_sensor/home_sweet_home_grid_status_2/state",
+		ACFrequencyTopic:         topicACFrequency,
+		ForecastRemainingTopic:   TopicSolcastForecastRemaining,
+		DetailedForecastTopic:    TopicSolcastDetailedForecast,
+		TomorrowForecastTopic:    TopicSolcastForecastTomorrow,
+		InverterPowerTopics:      inverterPowerTopics,
+		InverterStateTopics:      inverterStateTopics,
+		Battery3SOCTopic:         battery3.SOCTopic(),
+		PowerwallSOCTopic:        "homeassistant/sensor/home_sweet_home_charge/state",
+		ExpectingPowerCutsTopic:  TopicExpectingPowerCutsState,
+		IslandModeTopic:          TopicIslandModeState,
+		StormModeTopic:           TopicStormModeState,
+		CurtailmentTopic:         TopicCurtailmentState,
+		EVReservedPowerTopic:     TopicEVReservedPower,
+		InverterModeTopic:        TopicInverterModeState,
+		ManualInverterCountTopic: TopicManualInverterCountState,
+	}
+
+	return BaselineInverterConfig{
+		Input:                     input,
+		Battery2:                  group,
+		WattsPerInverter:          255.0,
+		MaxTransferPower:          5000.0,
+		MaxBaselineWatts:          500.0,
+		PriceExportThreshold:      0.30,
+		TargetRampThreshold:       255 * 60, // one inverter's difference for a minute
+		CountHysteresisWatts:      25,       // ±10% of an inverter around each step
+		OverflowProbeWatts:        127.5,    // half an inverter, above typical float current
+		OverflowSOCTurnOffStart:   98.5,
+		OverflowSOCTurnOffEnd:     95.0,
+		OverflowSOCTurnOnStart:    95.75,
+		OverflowSOCTurnOnEnd:      99.5,
+		LowVoltageTurnOnStart:     52.0,
+		LowVoltageTurnOnEnd:       53.0,
+		LowVoltageTurnOffStart:    battery2.LowVoltageTrip,
+		LowVoltageTurnOffEnd:      52.0,
+		LowVoltageRecoveryVoltage: battery2.LowVoltageRecovery,
+		LowVoltageRecoveryTime:    10 * time.Minute,
+		LowVoltageSagPerInverter:  0.05,
+		LowVoltageFastTrip:        battery2.LowVoltageFastTrip,
+		SOCReserve:                battery2.SOCReserve,
+		IslandSOCReserve:          battery2.IslandSOCReserve,
+		// Slow PI loop: the count is quantised to 255W and HA power sensors lag a few seconds
+		GridPID: governor.PIDConfig{
+			Kp:     0.2,
+			Ki:     0.01,
+			OutMax: float64(len(battery2.InverterSwitchIDs)) * 255.0,
+		},
+		// Stop a count hovering at a boundary from cycling the same inverter
+		MinOnTime:  5 * time.Minute,
+		MinOffTime: 2 * time.Minute,
+		// DNSP export limit (--export-limit); only enforced with GridPowerTopic set
+		ExportLimitWatts:    5000,
+		ExportLimitRecovery: 5 * time.Minute,
+		// Export what Battery 2 won't need overnight over the last 3h of solar
+		DrawdownReserveSOC: 60,
+		DrawdownWindow:     3 * time.Hour,
+		// Keep 80% before a dull day (≤3kWh forecast), go down to 40% before a bright one (≥10kWh)
+		OvernightReserve: OvernightReserve{CloudyWh: 3000, CloudySOC: 80, SunnyWh: 10000, SunnySOC: 40},
+		// Past a 20-point SOC gap, lean on the fuller battery: 40 points past is 1kW (~4 inverters)
+		BalanceDeadband:        20,
+		BalanceWattsPerPercent: 25,
+		// An inverter's worth of shortfall at 4 on is 25%; allow for voltage-dependent output
+		OutputFeedbackTolerance: 0.2,
+		OutputFeedbackWindow:    5 * time.Minute,
+		// An inverter on but under 20W for 10 minutes is dead; try it again hourly
+		DeadInverterWatts: 20,
+		DeadInverterAfter: 10 * time.Minute,
+		DeadInverterRetry: time.Hour,
+	}
+}
+
+// BuildDynamicInverterConfig creates configuration for the dynamic (Multiplus) inverter controller.
+func BuildDynamicInverterConfig(battery2, battery3 BatteryConfig) DynamicInverterConfig {
+	return DynamicInverterConfig{
+		Input: DynamicInputConfig{
+			HouseLoadTopic:            topicHouseLoadPower2,
+			Solar1PowerTopic:          TopicSolar1Power,
+			Solar2PowerTopic:          topicSolar2ACPower,
+			Inverter1to9PowerTopic:    TopicPowerhouseTotalOut,
+			MultiplusACPowerTopic:     "homeassistant/sensor/powerhouse_inverter_10_ac_power/state",
+			Battery3SOCTopic:          battery3.SOCTopic(),
+			GridStatusTopic:           "homeassistant/binary_sensor/home_sweet_home_grid_status_2/state",
+			ACFrequencyTopic:          topicACFrequency,
+			PowerwallSOCTopic:         "homeassistant/sensor/home_sweet_home_charge/state",
+			DynamicAutoTopic:          TopicDynamicAutoState,
+			MultiplusSetpointCmdTopic: TopicInverter10SetpointCmd,
+			CarChargingEnabledTopic:   TopicCarChargingEnabledState,
+			CarChargingActiveTopic:    "homeassistant/binary_sensor/plb942_charging/state",
+			CarBatterySOCTopic:        "homeassistant/sensor/plb942_battery/state",
+			CarBattery3CutoffTopic:    TopicCarChargingBattery3CutoffState,
+			Solar34PowerTopic:         TopicSolar34Power,
+			Battery3DCCurrentTopic:    "homeassistant/sensor/battery_3_dc_current/state",
+			Battery3CCLTopic:          "homeassistant/sensor/battery_3_charge_current_limit/state",
+			Battery3CVLTopic:          "homeassistant/sensor/battery_3_charge_voltage_limit/state",
+			Battery3VoltageTopic:      "homeassistant/sensor/solar_3_battery_voltage/state",
+			Solar3BatteryCurrentTopic: "homeassistant/sensor/solar_3_battery_current/state",
+			Solar4BatteryCurrentTopic: "homeassistant/sensor/solar_4_battery_current/state",
+			PowerhouseNetPowerTopic:   "homeassistant/sensor/powerhouse_net_power/state",
+			ForecastRemainingTopic:    TopicSolcastForecastRemaining,
+			DetailedForecastTopic:     TopicSolcastDetailedForecast,
+			Battery3CapacityWh:        battery3.CapacityKWh * 1000,
+			SolarMultiplier:           solarForecastMultiplier,
+		},
+	}
+}
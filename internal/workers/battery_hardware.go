@@ -0,0 +1,79 @@
+package workers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// BatteryHardware is the optional hardware one battery is wired to, which the built-in
+// site config doesn't know: each field set turns on the matching worker or backend.
+type BatteryHardware struct {
+	ChargeLimit *ChargeLimitConfig `json:"charge_limit,omitempty"`
+	Temperature *TemperatureConfig `json:"temperature,omitempty"`
+	BMS         *BMSConfig         `json:"bms,omitempty"`
+	// Keyed by inverter switch entity ID
+	InverterModbus map[string]ModbusTarget `json:"inverter_modbus,omitempty"`
+	InverterShelly map[string]ShellyTarget `json:"inverter_shelly,omitempty"`
+	// Switch entity ID -> HA number entity for its output limit (W)
+	InverterPowerLimit map[string]string `json:"inverter_power_limit,omitempty"`
+	// Use the measured round-trip efficiency in place of ConversionLossRate
+	MeasuredEfficiency *bool `json:"measured_efficiency,omitempty"`
+}
+
+// Apply sets b's hardware fields from h; fields h leaves out keep b's values.
+func (h BatteryHardware) Apply(b *BatteryConfig) {
+	if h.ChargeLimit != nil {
+		b.ChargeLimit = h.ChargeLimit
+	}
+	if h.Temperature != nil {
+		b.Temperature = h.Temperature
+	}
+	if h.BMS != nil {
+		b.BMS = h.BMS
+	}
+	if h.InverterModbus != nil {
+		b.InverterModbus = h.InverterModbus
+	}
+	if h.InverterShelly != nil {
+		b.InverterShelly = h.InverterShelly
+	}
+	if h.InverterPowerLimit != nil {
+		b.InverterPowerLimit = h.InverterPowerLimit
+	}
+	if h.MeasuredEfficiency != nil {
+		b.UseMeasuredEfficiency = *h.MeasuredEfficiency
+	}
+}
+
+// LoadBatteryHardware reads per-battery hardware from a JSON file: an object keyed by
+// battery name (e.g. "Battery 2").
+func LoadBatteryHardware(path string) (map[string]BatteryHardware, error) {
+	var hardware map[string]BatteryHardware
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &hardware); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return hardware, nil
+}
+
+// applyBatteryHardware applies hardware to the batteries it names. A name matching no
+// battery is an error, so a typo doesn't silently leave the hardware unused.
+func applyBatteryHardware(hardware map[string]BatteryHardware, batteries ...*BatteryConfig) error {
+	for name, h := range hardware {
+		found := false
+		for _, b := range batteries {
+			if b.Name == name {
+				h.Apply(b)
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("battery hardware for unknown battery %q", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package workers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeBatteryHardware(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hardware.json")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadBatteryHardware_ChargeLimit(t *testing.T) {
+	path := writeBatteryHardware(t, `{
+		"Battery 2": {
+			"charge_limit": {
+				"setpoint_entity_id": "number.solar_5_max_charge_current",
+				"max_amps": 60,
+				"step_amps": 5,
+				"curve": [{"voltage": 55.2, "amps": 60}, {"voltage": 56.4, "amps": 20}]
+			}
+		}
+	}`)
+	hardware, err := LoadBatteryHardware(path)
+	assert.NoError(t, err)
+
+	battery2, battery3 := DefaultBatteryConfigs()
+	assert.NoError(t, applyBatteryHardware(hardware, &battery2, &battery3))
+	assert.Equal(t, &ChargeLimitConfig{
+		SetpointEntityID: "number.solar_5_max_charge_current",
+		MaxAmps:          60,
+		StepAmps:         5,
+		Curve:            []ChargeLimitPoint{{Voltage: 55.2, Amps: 60}, {Voltage: 56.4, Amps: 20}},
+	}, battery2.ChargeLimit)
+	assert.Nil(t, battery3.ChargeLimit, "batteries the file leaves out are unchanged")
+	assert.NoError(t, validateBatteryConfig(battery2))
+
+	battery2.ChargeLimit.SetpointEntityID = "switch.solar_5"
+	assert.ErrorContains(t, validateBatteryConfig(battery2), "not a number entity")
+}
+
+func TestLoadBatteryHardware_Temperature(t *testing.T) {
+	path := writeBatteryHardware(t, `{
+		"Battery 3": {
+			"temperature": {
+				"topics": ["homeassistant/sensor/battery_3_cell_temperature/state"],
+				"min_charge_temp": 0,
+				"min_discharge_temp": -10,
+				"derate_temp": 45,
+				"max_temp": 55
+			}
+		}
+	}`)
+	hardware, err := LoadBatteryHardware(path)
+	assert.NoError(t, err)
+
+	battery2, battery3 := DefaultBatteryConfigs()
+	assert.NoError(t, applyBatteryHardware(hardware, &battery2, &battery3))
+	assert.Equal(t, &TemperatureConfig{
+		Topics:           []string{"homeassistant/sensor/battery_3_cell_temperature/state"},
+		MinDischargeTemp: -10,
+		DerateTemp:       45,
+		MaxTemp:          55,
+	}, battery3.Temperature)
+	assert.Nil(t, battery2.Temperature)
+	assert.NoError(t, validateBatteryConfig(battery3))
+
+	battery3.Temperature.MaxTemp = 40
+	assert.ErrorContains(t, validateBatteryConfig(battery3), "must be above derate temperature")
+}
+
+func TestLoadBatteryHardware_BMS(t *testing.T) {
+	path := writeBatteryHardware(t, `{
+		"Battery 2": {
+			"bms": {
+				"cell_voltage_topics": ["jk/cell_1", "jk/cell_2"],
+				"min_cell_voltage": 2.9,
+				"recover_cell_voltage": 3.1
+			}
+		}
+	}`)
+	hardware, err := LoadBatteryHardware(path)
+	assert.NoError(t, err)
+
+	battery2, battery3 := DefaultBatteryConfigs()
+	assert.NoError(t, applyBatteryHardware(hardware, &battery2, &battery3))
+	assert.Equal(t, &BMSConfig{
+		CellVoltageTopics:  []string{"jk/cell_1", "jk/cell_2"},
+		MinCellVoltage:     2.9,
+		RecoverCellVoltage: 3.1,
+	}, battery2.BMS)
+	assert.Equal(t, []string{"jk/cell_1", "jk/cell_2"}, battery2.InterlockBattery().CellVoltageTopics)
+	assert.NoError(t, validateBatteryConfig(battery2))
+
+	battery2.BMS.RecoverCellVoltage = 2.8
+	assert.ErrorContains(t, validateBatteryConfig(battery2), "must not be below minimum")
+}
+
+func TestLoadBatteryHardware_InverterModbus(t *testing.T) {
+	path := writeBatteryHardware(t, `{
+		"Battery 2": {
+			"inverter_modbus": {
+				"switch.powerhouse_inverter_1_switch_0": {
+					"address": "192.168.1.50:502", "unit_id": 242, "register": 33, "on_value": 3, "off_value": 4
+				}
+			}
+		}
+	}`)
+	hardware, err := LoadBatteryHardware(path)
+	assert.NoError(t, err)
+
+	battery2, battery3 := DefaultBatteryConfigs()
+	assert.NoError(t, applyBatteryHardware(hardware, &battery2, &battery3))
+	target := ModbusTarget{Address: "192.168.1.50:502", UnitID: 242, Register: 33, OnValue: 3, OffValue: 4}
+	assert.Equal(t, map[string]ModbusTarget{"switch.powerhouse_inverter_1_switch_0": target}, battery2.InverterModbus)
+	assert.Equal(t, &target, buildInverterGroup(battery2, "").Inverters[0].Modbus)
+	assert.NoError(t, validateBatteryConfig(battery2))
+
+	battery2.InverterModbus["switch.not_an_inverter"] = target
+	assert.ErrorContains(t, validateBatteryConfig(battery2), "not an inverter switch")
+}
+
+func TestLoadBatteryHardware_InverterShelly(t *testing.T) {
+	path := writeBatteryHardware(t, `{
+		"Battery 2": {
+			"inverter_shelly": {
+				"switch.powerhouse_inverter_2_switch_0": {"host": "192.168.1.62", "switch_id": 1}
+			}
+		}
+	}`)
+	hardware, err := LoadBatteryHardware(path)
+	assert.NoError(t, err)
+
+	battery2, battery3 := DefaultBatteryConfigs()
+	assert.NoError(t, applyBatteryHardware(hardware, &battery2, &battery3))
+	target := ShellyTarget{Host: "192.168.1.62", SwitchID: 1}
+	assert.Equal(t, map[string]ShellyTarget{"switch.powerhouse_inverter_2_switch_0": target}, battery2.InverterShelly)
+	assert.Equal(t, &target, buildInverterGroup(battery2, "").Inverters[1].Shelly)
+	assert.NoError(t, validateBatteryConfig(battery2))
+
+	battery2.InverterShelly["switch.powerhouse_inverter_2_switch_0"] = ShellyTarget{}
+	assert.ErrorContains(t, validateBatteryConfig(battery2), "has no host")
+}
+
+func TestLoadBatteryHardware_InverterPowerLimit(t *testing.T) {
+	path := writeBatteryHardware(t, `{
+		"Battery 2": {
+			"inverter_power_limit": {
+				"switch.powerhouse_inverter_9_switch_0": "number.powerhouse_inverter_9_power_limit"
+			}
+		}
+	}`)
+	hardware, err := LoadBatteryHardware(path)
+	assert.NoError(t, err)
+
+	battery2, battery3 := DefaultBatteryConfigs()
+	assert.NoError(t, applyBatteryHardware(hardware, &battery2, &battery3))
+	assert.Equal(t, "number.powerhouse_inverter_9_power_limit", buildInverterGroup(battery2, "").Inverters[8].PowerLimitEntityID)
+	assert.NoError(t, validateBatteryConfig(battery2))
+
+	battery2.InverterPowerLimit["switch.powerhouse_inverter_9_switch_0"] = "sensor.inverter_9_power"
+	assert.ErrorContains(t, validateBatteryConfig(battery2), "not a number entity")
+}
+
+func TestLoadBatteryHardware_MeasuredEfficiency(t *testing.T) {
+	path := writeBatteryHardware(t, `{"Battery 2": {"measured_efficiency": true}}`)
+	hardware, err := LoadBatteryHardware(path)
+	assert.NoError(t, err)
+
+	battery2, battery3 := DefaultBatteryConfigs()
+	assert.NoError(t, applyBatteryHardware(hardware, &battery2, &battery3))
+	assert.True(t, battery2.UseMeasuredEfficiency)
+	assert.Equal(t, battery2.EfficiencyTopic(), battery2.CalibConfig().EfficiencyTopic)
+	assert.Contains(t, battery2.Topics(), battery2.EfficiencyTopic())
+	assert.False(t, battery3.UseMeasuredEfficiency)
+}
+
+func TestApplyBatteryHardware_UnknownBattery(t *testing.T) {
+	battery2, battery3 := DefaultBatteryConfigs()
+	err := applyBatteryHardware(map[string]BatteryHardware{"Battery 9": {}}, &battery2, &battery3)
+	assert.ErrorContains(t, err, `unknown battery "Battery 9"`)
+}
+
+func TestLoadBatteryHardware_Invalid(t *testing.T) {
+	_, err := LoadBatteryHardware(writeBatteryHardware(t, `{"Battery 2": []}`))
+	assert.ErrorContains(t, err, "parse")
+}
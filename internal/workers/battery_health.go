@@ -0,0 +1,110 @@
+package workers
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+)
+
+// sohHistoryCycles is how many measured capacity cycles are kept (and averaged) for SOH.
+const sohHistoryCycles = 10
+
+// SOHCycle is one measured capacity cycle: energy absorbed from the empty-voltage
+// anchor up to the next full-charge calibration.
+type SOHCycle struct {
+	Time       time.Time `json:"time"`
+	CapacityWh float64   `json:"capacity_wh"`
+}
+
+// CapacityAnchor records the energy totals (kWh) when the battery was last seen at
+// or below its empty-voltage threshold.
+type CapacityAnchor struct {
+	Inflows  float64
+	Outflows float64
+}
+
+// measureCycleCapacityWh returns the net energy stored between the empty anchor and
+// a full-charge calibration, applying the same outflow loss as the SOC calculation.
+func measureCycleCapacityWh(anchor CapacityAnchor, inflows, outflows, lossRate float64) float64 {
+	energyIn := (inflows - anchor.Inflows) * 1000
+	energyOut := (outflows - anchor.Outflows) * 1000
+	return energyIn - energyOut*(1+lossRate)
+}
+
+// appendSOHCycle appends a cycle and trims the history to the most recent n entries.
+func appendSOHCycle(history []SOHCycle, cycle SOHCycle, n int) []SOHCycle {
+	history = append(history, cycle)
+	if len(history) > n {
+		history = history[len(history)-n:]
+	}
+	return history
+}
+
+// stateOfHealth returns the mean measured capacity across history as a percentage
+// of nominal capacity. Returns 0 for an empty history.
+func stateOfHealth(history []SOHCycle, nominalWh float64) float64 {
+	if len(history) == 0 || nominalWh <= 0 {
+		return 0
+	}
+	var total float64
+	for _, c := range history {
+		total += c.CapacityWh
+	}
+	return total / float64(len(history)) / nominalWh * 100
+}
+
+// sohHistoryTopic returns the statestream topic carrying the retained cycle history
+// (the "cycles" attribute of the State of Health sensor).
+func sohHistoryTopic(batteryName string) string {
+	return NewTopicBuilder(batteryName).Statestream("sensor", "State of Health", "cycles")
+}
+
+// recordSOHCycle measures the cycle that just ended at a full calibration, appends it
+// to the history read back from HA, and publishes the updated SOH and history.
+func recordSOHCycle(
+	sender *MQTTSender,
+	config BatteryCalibConfig,
+	data DisplayData,
+	anchor CapacityAnchor,
+	inflows, outflows float64,
+) {
+	capacityWh := measureCycleCapacityWh(anchor, inflows, outflows, config.ConversionLossRate)
+	nominalWh := config.CapacityKWh * 1000
+	// A cycle that stored under a quarter of nominal capacity means the anchor was a
+	// voltage sag under load rather than a genuinely empty battery.
+	if capacityWh < nominalWh/4 {
+		log.Printf("%s: Skipping SOH cycle, only %.0f Wh absorbed since empty anchor\n", config.Name, capacityWh)
+		return
+	}
+
+	var history []SOHCycle
+	if err := json.Unmarshal([]byte(data.GetString(config.SOHHistoryTopic)), &history); err != nil {
+		log.Printf("%s: Ignoring unreadable SOH history, starting afresh: %v\n", config.Name, err)
+		history = nil
+	}
+	history = appendSOHCycle(history, SOHCycle{Time: time.Now(), CapacityWh: capacityWh}, sohHistoryCycles)
+	soh := stateOfHealth(history, nominalWh)
+
+	log.Printf("%s: Measured cycle capacity %.0f Wh, SOH %.1f%% over %d cycles\n",
+		config.Name, capacityWh, soh, len(history))
+
+	attributes, err := json.Marshal(map[string]any{"cycles": history})
+	if err != nil {
+		log.Printf("%s: Failed to marshal SOH history: %v\n", config.Name, err)
+		return
+	}
+
+	sender.Send(MQTTMessage{
+		Topic:   NewTopicBuilder(config.Name).Attributes("sensor", "state_of_health"),
+		Payload: attributes,
+		QoS:     1,
+		Retain:  true,
+	})
+	sender.Send(MQTTMessage{
+		Topic:   batteryDerivedStateTopic(config.Name, "state_of_health"),
+		Payload: []byte(strconv.FormatFloat(soh, 'f', 1, 64)),
+		QoS:     1,
+		Retain:  true,
+	})
+}
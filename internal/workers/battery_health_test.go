@@ -0,0 +1,52 @@
+package workers
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ryansname/powerctl/internal/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMeasureCycleCapacityWh(t *testing.T) {
+	anchor := CapacityAnchor{Inflows: 100, Outflows: 50}
+	// 10 kWh in, 1 kWh out at 10% loss while recharging from empty
+	got := measureCycleCapacityWh(anchor, 110, 51, 0.10)
+	assert.InDelta(t, 8900.0, got, 1e-6)
+}
+
+func TestAppendSOHCycle_TrimsToN(t *testing.T) {
+	var history []SOHCycle
+	for i := range 5 {
+		history = appendSOHCycle(history, SOHCycle{CapacityWh: float64(i)}, 3)
+	}
+	assert.Len(t, history, 3)
+	assert.InDelta(t, 2.0, history[0].CapacityWh, 1e-9, "oldest cycles dropped first")
+	assert.InDelta(t, 4.0, history[2].CapacityWh, 1e-9)
+}
+
+func TestStateOfHealth(t *testing.T) {
+	history := []SOHCycle{
+		{Time: time.Now(), CapacityWh: 9000},
+		{Time: time.Now(), CapacityWh: 8000},
+	}
+	assert.InDelta(t, 85.0, stateOfHealth(history, 10000), 1e-9)
+	assert.InDelta(t, 0.0, stateOfHealth(nil, 10000), 1e-9)
+}
+
+func TestRecordSOHCycle_MalformedHistoryStartsAfresh(t *testing.T) {
+	out := make(chan MQTTMessage, 10)
+	config := BatteryCalibConfig{Name: "Battery 2", CapacityKWh: 10, SOHHistoryTopic: sohHistoryTopic("Battery 2")}
+	data := DisplayData{TopicData: map[string]any{
+		config.SOHHistoryTopic: &stats.StringTopicData{Current: "not json"},
+	}}
+
+	recordSOHCycle(NewMQTTSender(out), config, data, CapacityAnchor{}, 9, 0)
+
+	attributes := <-out
+	var got struct{ Cycles []SOHCycle }
+	assert.NoError(t, json.Unmarshal(attributes.Payload, &got))
+	assert.Len(t, got.Cycles, 1)
+	assert.Equal(t, "90.0", string((<-out).Payload))
+}
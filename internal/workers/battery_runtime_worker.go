@@ -0,0 +1,121 @@
+package workers
+
+import (
+	"context"
+	"github.com/ryansname/powerctl/internal/stats"
+	"log"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// runtimeIdleWatts is the net power below which a battery counts as idle: neither
+// time to empty nor time to full is shown.
+const runtimeIdleWatts = 20.0
+
+// runtimeUnknown is the sensor payload HA shows as unknown.
+const runtimeUnknown = "None"
+
+// BatteryRuntimeConfig holds configuration for the time-to-empty / time-to-full sensors.
+type BatteryRuntimeConfig struct {
+	Name                 string
+	CapacityWh           float64
+	AvailableEnergyTopic string   // Wh, read back from the battery's Available Energy sensor
+	InflowPowerTopics    []string // W
+	OutflowPowerTopics   []string // W
+}
+
+// Topics returns the statestream topics the runtime worker reads.
+func (c BatteryRuntimeConfig) Topics() []string {
+	return slices.Concat([]string{c.AvailableEnergyTopic}, c.InflowPowerTopics, c.OutflowPowerTopics)
+}
+
+// RegisterPercentiles registers the 5m P50 of each power topic with the stats worker.
+// Must be called before statsWorker starts.
+func (c BatteryRuntimeConfig) RegisterPercentiles() {
+	for _, topic := range slices.Concat(c.InflowPowerTopics, c.OutflowPowerTopics) {
+		registerPercentile(topic, PercentileSpec{stats.P50, stats.Window5Min})
+	}
+}
+
+// netPower returns inflow minus outflow (W), each summed from 5m P50s so a passing
+// cloud or a load spike doesn't swing the estimate.
+func (c BatteryRuntimeConfig) netPower(data DisplayData) float64 {
+	var net float64
+	for _, topic := range c.InflowPowerTopics {
+		net += data.GetPercentile(topic, stats.P50, stats.Window5Min)
+	}
+	for _, topic := range c.OutflowPowerTopics {
+		net -= data.GetPercentile(topic, stats.P50, stats.Window5Min)
+	}
+	return net
+}
+
+// batteryRuntime returns the minutes until the battery is empty (discharging) or full
+// (charging) at netWatts. ok is false for the direction it isn't heading in.
+func batteryRuntime(availableWh, capacityWh, netWatts float64) (toEmpty, toFull float64, emptyOK, fullOK bool) {
+	switch {
+	case netWatts <= -runtimeIdleWatts:
+		return availableWh / -netWatts * 60, 0, true, false
+	case netWatts >= runtimeIdleWatts:
+		return 0, max(0, capacityWh-availableWh) / netWatts * 60, false, true
+	}
+	return 0, 0, false, false
+}
+
+// roundRuntime rounds minutes coarser as they grow (1m under an hour, 5m under ten
+// hours, 30m beyond), so the sensor only changes when the estimate meaningfully does.
+func roundRuntime(minutes float64) float64 {
+	step := 1.0
+	switch {
+	case minutes >= 600:
+		step = 30
+	case minutes >= 60:
+		step = 5
+	}
+	return math.Round(minutes/step) * step
+}
+
+// formatRuntime is the sensor payload for a rounded runtime, or runtimeUnknown.
+func formatRuntime(minutes float64, ok bool) string {
+	if !ok {
+		return runtimeUnknown
+	}
+	return strconv.FormatFloat(roundRuntime(minutes), 'f', 0, 64)
+}
+
+// batteryRuntimeWorker publishes the battery's Time to Empty and Time to Full sensors
+// (minutes) whenever their rounded values change, and on the state heartbeat.
+func batteryRuntimeWorker(
+	ctx context.Context,
+	dataChan <-chan DisplayData,
+	config BatteryRuntimeConfig,
+	sender *MQTTSender,
+) {
+	log.Printf("%s runtime worker started\n", config.Name)
+
+	emptyTopic := batteryDerivedStateTopic(config.Name, "time_to_empty")
+	fullTopic := batteryDerivedStateTopic(config.Name, "time_to_full")
+	filter := NewChangeFilter(0)
+
+	for {
+		select {
+		case data := <-dataChan:
+			availableWh := data.GetFloat(config.AvailableEnergyTopic).Current
+			toEmpty, toFull, emptyOK, fullOK := batteryRuntime(availableWh, config.CapacityWh, config.netPower(data))
+
+			now := time.Now()
+			if payload := formatRuntime(toEmpty, emptyOK); filter.ChangedPayload(emptyTopic, payload, now) {
+				sender.Send(MQTTMessage{Topic: emptyTopic, Payload: []byte(payload), QoS: 0, Retain: false})
+			}
+			if payload := formatRuntime(toFull, fullOK); filter.ChangedPayload(fullTopic, payload, now) {
+				sender.Send(MQTTMessage{Topic: fullTopic, Payload: []byte(payload), QoS: 0, Retain: false})
+			}
+
+		case <-ctx.Done():
+			log.Printf("%s runtime worker stopped\n", config.Name)
+			return
+		}
+	}
+}
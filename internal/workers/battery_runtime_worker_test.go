@@ -0,0 +1,75 @@
+package workers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ryansname/powerctl/internal/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatteryRuntime(t *testing.T) {
+	toEmpty, _, emptyOK, fullOK := batteryRuntime(5000, 9500, -1000)
+	assert.True(t, emptyOK)
+	assert.False(t, fullOK)
+	assert.InDelta(t, 300, toEmpty, 0.001, "5kWh at 1kW")
+
+	_, toFull, emptyOK, fullOK := batteryRuntime(5000, 9500, 900)
+	assert.False(t, emptyOK)
+	assert.True(t, fullOK)
+	assert.InDelta(t, 300, toFull, 0.001, "4.5kWh at 900W")
+
+	_, _, emptyOK, fullOK = batteryRuntime(5000, 9500, 10)
+	assert.False(t, emptyOK || fullOK, "idle")
+}
+
+func TestFormatRuntime(t *testing.T) {
+	assert.Equal(t, "42", formatRuntime(42.4, true))
+	assert.Equal(t, "125", formatRuntime(123, true), "5m steps over an hour")
+	assert.Equal(t, "630", formatRuntime(640, true), "30m steps over ten hours")
+	assert.Equal(t, runtimeUnknown, formatRuntime(42, false))
+}
+
+func TestBatteryRuntimeWorker_PublishesOnChange(t *testing.T) {
+	config := BatteryRuntimeConfig{
+		Name:                 "Battery 2",
+		CapacityWh:           9500,
+		AvailableEnergyTopic: testTopicB2Energy,
+		InflowPowerTopics:    []string{testTopicSolar1},
+		OutflowPowerTopics:   []string{testTopicLoad},
+	}
+	data := func(solar, load float64) DisplayData {
+		return DisplayData{
+			TopicData: map[string]any{testTopicB2Energy: makeFloatTopic(5000)},
+			Percentiles: map[PercentileKey]float64{
+				{testTopicSolar1, stats.P50, stats.Window5Min}: solar,
+				{testTopicLoad, stats.P50, stats.Window5Min}:   load,
+			},
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in := make(chan DisplayData)
+	out := make(chan MQTTMessage, 10)
+	go batteryRuntimeWorker(ctx, in, config, NewMQTTSender(out))
+
+	in <- data(0, 1000)
+	in <- data(0, 1001) // same rounded estimate
+	in <- data(0, 1000)
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+
+	published := map[string]string{}
+	for len(out) > 0 {
+		msg := <-out
+		_, seen := published[msg.Topic]
+		assert.False(t, seen, "%s published twice", msg.Topic)
+		published[msg.Topic] = string(msg.Payload)
+	}
+	assert.Equal(t, map[string]string{
+		batteryDerivedStateTopic("Battery 2", "time_to_empty"): "300",
+		batteryDerivedStateTopic("Battery 2", "time_to_full"):  runtimeUnknown,
+	}, published)
+}
@@ -1,11 +1,10 @@
-package main
+package workers
 
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"log"
-	"strings"
+	"time"
 )
 
 // calculateAvailableWh computes available energy from calibration reference point
@@ -27,6 +26,16 @@ func calculateAvailableWh(
 	return max(0, min(available, capacityWh))
 }
 
+// lossRateFromEfficiency converts a measured round-trip efficiency (%) into the
+// outflow loss rate used by calculateAvailableWh. Falls back when no plausible
+// estimate has been published yet (0 is the startup default).
+func lossRateFromEfficiency(efficiencyPercent, fallback float64) float64 {
+	if efficiencyPercent < 50 || efficiencyPercent > 100 {
+		return fallback
+	}
+	return 100/efficiencyPercent - 1
+}
+
 // batterySOCWorker reads calibration from DisplayData and performs energy accounting
 func batterySOCWorker(
 	ctx context.Context,
@@ -37,6 +46,8 @@ func batterySOCWorker(
 	log.Printf("%s SOC worker started\n", config.Name)
 
 	capacityWh := config.CapacityKWh * 1000 // Convert kWh to Wh
+	stateTopic := NewTopicBuilder(config.Name).State("sensor", "")
+	filter := NewChangeFilter(config.PublishEpsilon)
 
 	for {
 		select {
@@ -49,6 +60,11 @@ func batterySOCWorker(
 			inflowTotal := data.SumTopics(config.InflowEnergyTopics)
 			outflowTotal := data.SumTopics(config.OutflowEnergyTopics)
 
+			lossRate := config.ConversionLossRate
+			if config.EfficiencyTopic != "" {
+				lossRate = lossRateFromEfficiency(data.GetFloat(config.EfficiencyTopic).Current, lossRate)
+			}
+
 			// Calculate available energy from calibration point
 			availableWh := calculateAvailableWh(
 				capacityWh,
@@ -56,16 +72,16 @@ func batterySOCWorker(
 				calibOutflows,
 				inflowTotal,
 				outflowTotal,
-				config.ConversionLossRate,
+				lossRate,
 			)
 
 			// Calculate percentage
 			percentage := (availableWh / capacityWh) * 100
+			if !filter.Changed(stateTopic, percentage, time.Now()) {
+				continue
+			}
 
 			// Publish state to MQTT
-			deviceId := strings.ReplaceAll(strings.ToLower(config.Name), " ", "_")
-			stateTopic := fmt.Sprintf("powerctl/sensor/%s/state", deviceId)
-
 			statePayload := map[string]interface{}{
 				"percentage":   percentage,
 				"available_wh": availableWh,
@@ -81,7 +97,7 @@ func batterySOCWorker(
 				Topic:   stateTopic,
 				Payload: payloadBytes,
 				QoS:     0,
-				Retain:  false,
+				Retain:  true, // HA has the SOC straight after either side restarts
 			})
 
 		case <-ctx.Done():
@@ -93,9 +109,10 @@ func batterySOCWorker(
 
 // BatteryAvailableEnergyConfig holds configuration for deriving available energy from a SOC entity
 type BatteryAvailableEnergyConfig struct {
-	Name        string
-	SOCTopic    string // HA statestream topic publishing SOC as a plain percentage (0-100)
-	CapacityKWh float64
+	Name           string
+	SOCTopic       string // HA statestream topic publishing SOC as a plain percentage (0-100)
+	CapacityKWh    float64
+	PublishEpsilon float64 // SOC change (%) worth publishing
 }
 
 // batteryAvailableEnergyFromSOCWorker reads SOC from an HA entity and publishes available energy.
@@ -109,15 +126,17 @@ func batteryAvailableEnergyFromSOCWorker(
 	log.Printf("%s available energy worker started\n", config.Name)
 
 	capacityWh := config.CapacityKWh * 1000
+	stateTopic := NewTopicBuilder(config.Name).State("sensor", "")
+	filter := NewChangeFilter(config.PublishEpsilon)
 
 	for {
 		select {
 		case data := <-dataChan:
 			soc := data.GetFloat(config.SOCTopic).Current
 			availableWh := (soc / 100) * capacityWh
-
-			deviceId := strings.ReplaceAll(strings.ToLower(config.Name), " ", "_")
-			stateTopic := fmt.Sprintf("powerctl/sensor/%s/state", deviceId)
+			if !filter.Changed(stateTopic, soc, time.Now()) {
+				continue
+			}
 
 			payloadBytes, err := json.Marshal(map[string]interface{}{
 				"percentage":   soc,
@@ -132,7 +151,7 @@ func batteryAvailableEnergyFromSOCWorker(
 				Topic:   stateTopic,
 				Payload: payloadBytes,
 				QoS:     0,
-				Retain:  false,
+				Retain:  true, // HA has the SOC straight after either side restarts
 			})
 
 		case <-ctx.Done():
@@ -1,4 +1,4 @@
-package main
+package workers
 
 import (
 	"testing"
@@ -117,3 +117,10 @@ func TestCalculateAvailableWh_ChargeAndDischarge(t *testing.T) {
 	// Available = 10000 + 980 = 10980, clamped to 10000
 	assert.Equal(t, 10000.0, available)
 }
+
+func TestLossRateFromEfficiency(t *testing.T) {
+	assert.InDelta(t, 0.25, lossRateFromEfficiency(80, 0.10), 1e-9, "100/80 - 1")
+	assert.InDelta(t, 0.0, lossRateFromEfficiency(100, 0.10), 1e-9)
+	assert.InDelta(t, 0.10, lossRateFromEfficiency(0, 0.10), 1e-9, "no estimate yet falls back")
+	assert.InDelta(t, 0.10, lossRateFromEfficiency(30, 0.10), 1e-9, "implausible estimate falls back")
+}
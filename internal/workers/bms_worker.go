@@ -0,0 +1,112 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+)
+
+// BMSConfig configures cell-level monitoring from a BMS (e.g. JK or Seplos) that
+// publishes per-cell voltages to MQTT.
+type BMSConfig struct {
+	CellVoltageTopics  []string `json:"cell_voltage_topics"`  // One per cell (V)
+	MinCellVoltage     float64  `json:"min_cell_voltage"`     // Discharge is suspended when any cell is below this...
+	RecoverCellVoltage float64  `json:"recover_cell_voltage"` // ...until every cell is back above this
+}
+
+// bmsCellUndervoltageTopic returns the retained state topic for a battery's cell
+// undervoltage binary sensor. powerctl subscribes to it as well.
+func bmsCellUndervoltageTopic(batteryName string) string {
+	return NewTopicBuilder(batteryName).State("binary_sensor", "cell_undervoltage")
+}
+
+// bmsCellRange returns the lowest and highest cell voltage.
+func bmsCellRange(data DisplayData, topics []string) (lowest, highest float64) {
+	lowest, highest = math.Inf(1), math.Inf(-1)
+	for _, topic := range topics {
+		v := data.GetFloat(topic).Current
+		lowest = min(lowest, v)
+		highest = max(highest, v)
+	}
+	return lowest, highest
+}
+
+// EvaluateCellUndervoltage returns whether discharge should be suspended, given whether
+// it was and the lowest cell voltage.
+func EvaluateCellUndervoltage(suspended bool, config BMSConfig, lowest float64) bool {
+	if suspended {
+		return lowest < config.RecoverCellVoltage
+	}
+	return lowest < config.MinCellVoltage
+}
+
+// bmsWorker publishes a battery's lowest/highest cell voltage and cell delta, and the
+// cell undervoltage binary sensor that suspends the baseline controller's discharge.
+// The safety interlock reads the cell voltages itself to veto inverter turn-ons.
+func bmsWorker(
+	ctx context.Context,
+	dataChan <-chan DisplayData,
+	name string,
+	config BMSConfig,
+	sender *MQTTSender,
+	audit *AuditLog,
+) {
+	log.Printf("%s BMS worker started\n", name)
+
+	var suspended bool
+	started := false
+
+	for {
+		select {
+		case data := <-dataChan:
+			lowest, highest := bmsCellRange(data, config.CellVoltageTopics)
+			deltaMV := (highest - lowest) * 1000
+
+			// Resume from the retained state so a restart doesn't release a suspension
+			if !started {
+				suspended = data.GetBoolean(bmsCellUndervoltageTopic(name))
+				started = true
+			}
+			prev := suspended
+			suspended = EvaluateCellUndervoltage(suspended, config, lowest)
+			if suspended != prev {
+				action := fmt.Sprintf("%s discharge suspended: cell at %.3fV", name, lowest)
+				if !suspended {
+					action = fmt.Sprintf("%s discharge resumed: lowest cell %.3fV", name, lowest)
+				}
+				log.Println(action)
+				audit.Record("bms", action, map[string]float64{"lowest_cell": lowest, "delta_mv": deltaMV})
+			}
+
+			for suffix, value := range map[string]string{
+				"cell_min_voltage": strconv.FormatFloat(lowest, 'f', 3, 64),
+				"cell_max_voltage": strconv.FormatFloat(highest, 'f', 3, 64),
+				"cell_delta":       strconv.FormatFloat(deltaMV, 'f', 0, 64),
+			} {
+				sender.Send(MQTTMessage{
+					Topic:   batteryDerivedStateTopic(name, suffix),
+					Payload: []byte(value),
+					QoS:     0,
+					Retain:  false,
+				})
+			}
+
+			payload := "OFF"
+			if suspended {
+				payload = "ON"
+			}
+			sender.Send(MQTTMessage{
+				Topic:   bmsCellUndervoltageTopic(name),
+				Payload: []byte(payload),
+				QoS:     1,
+				Retain:  true,
+			})
+
+		case <-ctx.Done():
+			log.Printf("%s BMS worker stopped\n", name)
+			return
+		}
+	}
+}
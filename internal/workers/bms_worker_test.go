@@ -0,0 +1,27 @@
+package workers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBMSCellRange(t *testing.T) {
+	data := DisplayData{TopicData: map[string]any{
+		"cell_1": makeFloatTopic(3.301),
+		"cell_2": makeFloatTopic(3.285),
+		"cell_3": makeFloatTopic(3.342),
+	}}
+	lowest, highest := bmsCellRange(data, []string{"cell_1", "cell_2", "cell_3"})
+	assert.Equal(t, 3.285, lowest)
+	assert.Equal(t, 3.342, highest)
+}
+
+func TestEvaluateCellUndervoltage_Hysteresis(t *testing.T) {
+	config := BMSConfig{MinCellVoltage: 2.9, RecoverCellVoltage: 3.1}
+
+	assert.False(t, EvaluateCellUndervoltage(false, config, 3.0))
+	assert.True(t, EvaluateCellUndervoltage(false, config, 2.85))
+	assert.True(t, EvaluateCellUndervoltage(true, config, 3.0), "held until the recover voltage")
+	assert.False(t, EvaluateCellUndervoltage(true, config, 3.15))
+}
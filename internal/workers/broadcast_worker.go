@@ -0,0 +1,154 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+)
+
+// broadcastDropsSensorID is the debug sensor counting updates replaced before a
+// consumer read them, per broadcastDropReportInterval.
+const broadcastDropsSensorID = "powerctl_broadcast_drops"
+
+// broadcastDropReportInterval is how often drop counts are logged and published.
+const broadcastDropReportInterval = time.Minute
+
+// broadcastWaitingLogInterval is how often consumers still waiting on topics are logged.
+const broadcastWaitingLogInterval = 30 * time.Second
+
+// safetyChannelSize is the channel buffer of a Safety consumer: one slot, replaced by
+// each update, so the consumer never works through stale snapshots to reach the latest.
+const safetyChannelSize = 1
+
+// DownstreamConsumer is a worker fed by broadcastWorker. Its channel buffer is the
+// consumer's ring buffer: when full, the oldest update is dropped for the newest.
+// The consumer receives nothing until every topic in Requires has a value.
+type DownstreamConsumer struct {
+	Name     string
+	Ch       chan DisplayData
+	Requires []string
+	Safety   bool // Protection worker (low voltage, cells, temperature): served first, with a safetyChannelSize channel
+}
+
+// missingTopics returns the topics in required that data has no value for.
+func missingTopics(data DisplayData, required []string) []string {
+	var missing []string
+	for _, topic := range required {
+		if _, ok := data.TopicData[topic]; !ok {
+			missing = append(missing, topic)
+		}
+	}
+	return missing
+}
+
+// offerLatest sends data to ch, discarding the oldest buffered update if ch is full,
+// so a slow consumer always sees the latest data. Returns true if an update was dropped.
+func offerLatest[T any](ch chan T, data T) bool {
+	select {
+	case ch <- data:
+		return false
+	default:
+	}
+
+	// Full: make room. The consumer may have read in the meantime, so neither step blocks.
+	select {
+	case <-ch:
+	default:
+	}
+	select {
+	case ch <- data:
+	default:
+	}
+	return true
+}
+
+// safetyFirst returns the consumer indices with Safety consumers first, otherwise in order.
+func safetyFirst(consumers []DownstreamConsumer) []int {
+	order := make([]int, 0, len(consumers))
+	for _, safety := range []bool{true, false} {
+		for i, c := range consumers {
+			if c.Safety == safety {
+				order = append(order, i)
+			}
+		}
+	}
+	return order
+}
+
+// broadcastWorker receives DisplayData and fans out to multiple downstream workers
+// This implements the actor pattern where the broadcast logic is isolated in a single worker.
+// Safety consumers get each update before anyone else; one that falls behind is an error.
+func broadcastWorker(
+	ctx context.Context,
+	inputChan <-chan DisplayData,
+	consumers []DownstreamConsumer,
+	sender *MQTTSender,
+	heartbeats *Heartbeats,
+) {
+	drops := make([]int, len(consumers))
+	reportTicker := time.NewTicker(broadcastDropReportInterval)
+	defer reportTicker.Stop()
+
+	// Per-consumer readiness: a dead sensor only holds back the workers that read it
+	ready := make([]bool, len(consumers))
+	waiting := make([][]string, len(consumers))
+	for i, c := range consumers {
+		waiting[i] = c.Requires
+	}
+	waitingTicker := time.NewTicker(broadcastWaitingLogInterval)
+	defer waitingTicker.Stop()
+	order := safetyFirst(consumers)
+
+	for {
+		select {
+		case data := <-inputChan:
+			heartbeats.Beat("stats-worker")
+			heartbeats.Beat("broadcast-worker")
+			for _, i := range order {
+				c := consumers[i]
+				if !ready[i] {
+					// Waiting on topics isn't being stuck
+					heartbeats.Beat(c.Name)
+					waiting[i] = missingTopics(data, c.Requires)
+					if len(waiting[i]) > 0 {
+						continue
+					}
+					ready[i] = true
+					log.Printf("%s ready: received all %d required topics\n", c.Name, len(c.Requires))
+				}
+				if offerLatest(c.Ch, data) {
+					drops[i]++
+				} else {
+					heartbeats.Beat(c.Name)
+				}
+			}
+
+		case <-waitingTicker.C:
+			for i, c := range consumers {
+				if !ready[i] {
+					log.Printf("%s waiting on %d/%d topics: %s\n",
+						c.Name, len(waiting[i]), len(c.Requires), strings.Join(waiting[i], ", "))
+				}
+			}
+
+		case <-reportTicker.C:
+			total := 0
+			for i, c := range consumers {
+				if drops[i] > 0 {
+					level := "Warning"
+					if c.Safety {
+						level = "ERROR: safety consumer"
+					}
+					log.Printf("%s %s fell behind, dropped %d stale updates\n", level, c.Name, drops[i])
+					total += drops[i]
+					drops[i] = 0
+				}
+			}
+			sender.PublishDebugSensor(broadcastDropsSensorID, float64(total))
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
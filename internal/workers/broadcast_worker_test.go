@@ -0,0 +1,84 @@
+package workers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOfferLatest_DropsOldest(t *testing.T) {
+	ch := make(chan DisplayData, 2)
+	update := func(v float64) DisplayData {
+		return DisplayData{TopicData: map[string]any{"t": makeFloatTopic(v)}}
+	}
+
+	assert.False(t, offerLatest(ch, update(1)))
+	assert.False(t, offerLatest(ch, update(2)))
+	assert.True(t, offerLatest(ch, update(3)))
+	assert.True(t, offerLatest(ch, update(4)))
+
+	first := <-ch
+	second := <-ch
+	assert.InDelta(t, 3.0, first.GetFloat("t").Current, 0)
+	assert.InDelta(t, 4.0, second.GetFloat("t").Current, 0)
+}
+
+func TestBroadcastWorker_GatesEachConsumerOnItsTopics(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	input := make(chan DisplayData)
+	solar := DownstreamConsumer{Name: "solar", Ch: make(chan DisplayData, 10), Requires: []string{"solar"}}
+	tanks := DownstreamConsumer{Name: "tanks", Ch: make(chan DisplayData, 10), Requires: []string{"solar", "tank"}}
+	sender := NewMQTTSender(make(chan MQTTMessage, 10))
+	go broadcastWorker(ctx, input, []DownstreamConsumer{solar, tanks}, sender, nil)
+
+	// The tank sensor is dead: only the solar consumer gets data
+	input <- DisplayData{TopicData: map[string]any{"solar": makeFloatTopic(1)}}
+	got := <-solar.Ch
+	assert.InDelta(t, 1.0, got.GetFloat("solar").Current, 0)
+
+	input <- DisplayData{TopicData: map[string]any{"solar": makeFloatTopic(2), "tank": makeFloatTopic(50)}}
+	got = <-tanks.Ch
+	assert.InDelta(t, 50.0, got.GetFloat("tank").Current, 0)
+	assert.Len(t, solar.Ch, 1)
+}
+
+func TestMissingTopics(t *testing.T) {
+	data := DisplayData{TopicData: map[string]any{"a": makeFloatTopic(1)}}
+	assert.Equal(t, []string{"b"}, missingTopics(data, []string{"a", "b"}))
+	assert.Empty(t, missingTopics(data, []string{"a"}))
+}
+
+func TestSafetyFirst(t *testing.T) {
+	consumers := []DownstreamConsumer{
+		{Name: "lights"},
+		{Name: "baseline", Safety: true},
+		{Name: "tanks"},
+		{Name: "bms", Safety: true},
+	}
+	assert.Equal(t, []int{1, 3, 0, 2}, safetyFirst(consumers))
+}
+
+func TestBroadcastWorker_SafetyConsumerSeesLatest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	input := make(chan DisplayData)
+	// Declared first but served after the safety consumer, so once it has an update the
+	// safety consumer has had it too
+	other := DownstreamConsumer{Name: "lights", Ch: make(chan DisplayData, 10)}
+	safety := DownstreamConsumer{Name: "baseline", Ch: make(chan DisplayData, safetyChannelSize), Safety: true}
+	sender := NewMQTTSender(make(chan MQTTMessage, 10))
+	go broadcastWorker(ctx, input, []DownstreamConsumer{other, safety}, sender, nil)
+
+	// Three voltage updates while the consumer is busy: it reads only the newest
+	for _, v := range []float64{51.0, 50.2, 49.4} {
+		input <- DisplayData{TopicData: map[string]any{"voltage": makeFloatTopic(v)}}
+		<-other.Ch
+	}
+	got := <-safety.Ch
+	assert.InDelta(t, 49.4, got.GetFloat("voltage").Current, 0)
+	assert.Empty(t, safety.Ch)
+}
@@ -0,0 +1,130 @@
+package workers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// FailsafePolicy is what mqttSenderWorker does once the broker has been unreachable
+// for longer than BrokerFailsafe.After.
+type FailsafePolicy string
+
+const (
+	FailsafeNone     FailsafePolicy = "none"      // leave inverters as last commanded
+	FailsafeQueueOff FailsafePolicy = "queue-off" // queue turn_off for every inverter, sent on reconnect
+	FailsafeActuate  FailsafePolicy = "actuate"   // turn every inverter off through Modbus, Shelly or the HA REST API now
+)
+
+// ParseFailsafePolicy validates a --failsafe flag value.
+func ParseFailsafePolicy(s string) (FailsafePolicy, error) {
+	switch p := FailsafePolicy(s); p {
+	case FailsafeNone, FailsafeQueueOff, FailsafeActuate:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown failsafe policy %q (want none, queue-off or actuate)", s)
+}
+
+// BrokerFailsafe turns the inverters off after an extended broker outage, so they
+// don't run unsupervised on whatever was last commanded while powerctl is blind.
+// mqttSenderWorker drives it; a nil *BrokerFailsafe never trips.
+type BrokerFailsafe struct {
+	Policy       FailsafePolicy
+	After        time.Duration
+	Inverters    []string // switch entity IDs
+	NotifyEntity string   // notify entity alerted when the broker returns after a trip; "" disables
+	audit        *AuditLog
+
+	disconnectedAt time.Time   // zero while connected
+	tripped        atomic.Bool // Read by Tripped from other goroutines
+}
+
+// NewBrokerFailsafe returns a failsafe, or nil for FailsafeNone. Trips and recoveries
+// are recorded to audit (may be nil).
+func NewBrokerFailsafe(
+	policy FailsafePolicy,
+	after time.Duration,
+	inverters []InverterInfo,
+	notifyEntity string,
+	audit *AuditLog,
+) *BrokerFailsafe {
+	if policy == FailsafeNone {
+		return nil
+	}
+	entityIDs := make([]string, len(inverters))
+	for i, inv := range inverters {
+		entityIDs[i] = inv.EntityID
+	}
+	return &BrokerFailsafe{
+		Policy:       policy,
+		After:        after,
+		Inverters:    entityIDs,
+		NotifyEntity: notifyEntity,
+		audit:        audit,
+	}
+}
+
+// Update records the broker connection state. It returns the turn_off calls to send
+// when the outage first passes After, and the alert to send when the broker returns
+// after a trip (zero Topic if none). Safe on a nil failsafe.
+func (f *BrokerFailsafe) Update(connected bool, now time.Time) (offCalls []MQTTMessage, alert MQTTMessage) {
+	if f == nil {
+		return nil, MQTTMessage{}
+	}
+
+	if connected {
+		if f.tripped.Load() {
+			outage := now.Sub(f.disconnectedAt).Round(time.Second)
+			log.Printf("Broker failsafe: broker back after %s, releasing inverters\n", outage)
+			f.audit.Record("broker-failsafe", "broker restored", map[string]float64{"outage_s": outage.Seconds()})
+			if f.NotifyEntity != "" {
+				alert = serviceCallMessage("notify", "send_message", f.NotifyEntity, map[string]any{
+					"title":   "powerctl broker restored",
+					"message": fmt.Sprintf("MQTT broker was unreachable for %s; inverters were turned off (%s).", outage, f.Policy),
+				})
+			}
+		}
+		f.disconnectedAt = time.Time{}
+		f.tripped.Store(false)
+		return nil, alert
+	}
+
+	if f.disconnectedAt.IsZero() {
+		f.disconnectedAt = now
+	}
+	if f.tripped.Load() || now.Sub(f.disconnectedAt) < f.After {
+		return nil, MQTTMessage{}
+	}
+
+	f.tripped.Store(true)
+	log.Printf("Broker failsafe: broker unreachable for %s, turning %d inverters off (%s)\n",
+		f.After, len(f.Inverters), f.Policy)
+	f.audit.Record("broker-failsafe", "tripped: "+string(f.Policy), map[string]float64{"inverters": float64(len(f.Inverters))})
+	for _, entityID := range f.Inverters {
+		offCalls = append(offCalls, serviceCallMessage("switch", "turn_off", entityID, nil))
+	}
+	return offCalls, MQTTMessage{}
+}
+
+// Tripped reports whether the failsafe has tripped and the broker hasn't returned. Safe
+// on a nil failsafe and from any goroutine.
+func (f *BrokerFailsafe) Tripped() bool {
+	return f != nil && f.tripped.Load()
+}
+
+// Blocks reports whether msg is an inverter turn-on that must be dropped because the
+// failsafe has tripped: nothing may undo the turn-offs until the broker returns. Safe
+// on a nil failsafe.
+func (f *BrokerFailsafe) Blocks(msg MQTTMessage) bool {
+	if f == nil || !f.tripped.Load() || msg.Topic != TopicCallServiceProxy {
+		return false
+	}
+	var call proxyServiceCall
+	if err := json.Unmarshal(msg.Payload, &call); err != nil || call.Service == "turn_off" {
+		return false
+	}
+	return slices.Contains(f.Inverters, call.EntityID)
+}
@@ -0,0 +1,88 @@
+package workers
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeTestFailsafe(policy FailsafePolicy) *BrokerFailsafe {
+	return NewBrokerFailsafe(policy, 10*time.Minute, []InverterInfo{
+		{EntityID: "switch.inv_1"},
+		{EntityID: "switch.inv_2"},
+	}, "notify.phone", nil)
+}
+
+func TestParseFailsafePolicy(t *testing.T) {
+	policy, err := ParseFailsafePolicy("queue-off")
+	assert.NoError(t, err)
+	assert.Equal(t, FailsafeQueueOff, policy)
+
+	_, err = ParseFailsafePolicy("panic")
+	assert.Error(t, err)
+
+	assert.Nil(t, makeTestFailsafe(FailsafeNone), "none disables the failsafe")
+}
+
+func TestBrokerFailsafe_TripsOnceAfterOutage(t *testing.T) {
+	f := makeTestFailsafe(FailsafeQueueOff)
+	t0 := time.Date(2026, 3, 4, 10, 0, 0, 0, time.Local)
+
+	offCalls, _ := f.Update(false, t0)
+	assert.Empty(t, offCalls)
+	offCalls, _ = f.Update(false, t0.Add(9*time.Minute))
+	assert.Empty(t, offCalls, "not down long enough")
+
+	offCalls, _ = f.Update(false, t0.Add(10*time.Minute))
+	if assert.Len(t, offCalls, 2) {
+		var call proxyServiceCall
+		assert.NoError(t, json.Unmarshal(offCalls[1].Payload, &call))
+		assert.Equal(t, "turn_off", call.Service)
+		assert.Equal(t, "switch.inv_2", call.EntityID)
+	}
+	offCalls, _ = f.Update(false, t0.Add(20*time.Minute))
+	assert.Empty(t, offCalls, "only sent once per outage")
+
+	_, alert := f.Update(true, t0.Add(30*time.Minute))
+	var call proxyServiceCall
+	assert.NoError(t, json.Unmarshal(alert.Payload, &call))
+	assert.Equal(t, "notify.phone", call.EntityID)
+	assert.Contains(t, call.Data["message"], "30m0s")
+
+	_, alert = f.Update(true, t0.Add(31*time.Minute))
+	assert.Empty(t, alert.Topic, "alerted once")
+}
+
+func TestBrokerFailsafe_ShortOutageResets(t *testing.T) {
+	f := makeTestFailsafe(FailsafeActuate)
+	t0 := time.Date(2026, 3, 4, 10, 0, 0, 0, time.Local)
+
+	f.Update(false, t0)
+	_, alert := f.Update(true, t0.Add(5*time.Minute))
+	assert.Empty(t, alert.Topic, "no alert without a trip")
+
+	offCalls, _ := f.Update(false, t0.Add(12*time.Minute))
+	assert.Empty(t, offCalls, "outage timer restarted")
+}
+
+func TestBrokerFailsafe_BlocksTurnOnWhileTripped(t *testing.T) {
+	f := makeTestFailsafe(FailsafeActuate)
+	t0 := time.Date(2026, 3, 4, 10, 0, 0, 0, time.Local)
+	turnOn := serviceCallMessage("switch", "turn_on", "switch.inv_1", nil)
+
+	assert.False(t, f.Blocks(turnOn), "not tripped")
+
+	f.Update(false, t0)
+	f.Update(false, t0.Add(10*time.Minute))
+	assert.True(t, f.Blocks(turnOn))
+	assert.False(t, f.Blocks(serviceCallMessage("switch", "turn_off", "switch.inv_1", nil)))
+	assert.False(t, f.Blocks(serviceCallMessage("switch", "turn_on", "switch.pump", nil)), "not an inverter")
+
+	f.Update(true, t0.Add(11*time.Minute))
+	assert.False(t, f.Blocks(turnOn), "released on reconnect")
+
+	var nilFailsafe *BrokerFailsafe
+	assert.False(t, nilFailsafe.Blocks(turnOn))
+}
@@ -0,0 +1,54 @@
+package workers
+
+import (
+	"math"
+	"time"
+)
+
+// stateHeartbeat is how long a publishing worker goes without republishing an
+// unchanged state. Longer than resendInterval, so mqttSenderWorker's duplicate check
+// never swallows a heartbeat.
+const stateHeartbeat = 10 * time.Minute
+
+type lastPublished struct {
+	value   float64
+	payload string
+	at      time.Time
+}
+
+// ChangeFilter decides which state publishes are worth sending, so workers ticking on
+// every DisplayData don't flood HA's recorder: a topic is published when it changes
+// (numbers by more than Epsilon) or Heartbeat after it was last published. Each worker
+// keeps its own; not safe for concurrent use.
+type ChangeFilter struct {
+	Epsilon   float64
+	Heartbeat time.Duration
+	last      map[string]lastPublished
+}
+
+// NewChangeFilter returns a filter with the given epsilon and the stateHeartbeat.
+func NewChangeFilter(epsilon float64) *ChangeFilter {
+	return &ChangeFilter{Epsilon: epsilon, Heartbeat: stateHeartbeat, last: make(map[string]lastPublished)}
+}
+
+// Changed reports whether value should be published to topic, recording it as
+// published if so.
+func (f *ChangeFilter) Changed(topic string, value float64, now time.Time) bool {
+	last, ok := f.last[topic]
+	if ok && math.Abs(value-last.value) <= f.Epsilon && now.Sub(last.at) < f.Heartbeat {
+		return false
+	}
+	f.last[topic] = lastPublished{value: value, at: now}
+	return true
+}
+
+// ChangedPayload reports whether payload should be published to topic, recording it
+// as published if so. Any difference counts as a change.
+func (f *ChangeFilter) ChangedPayload(topic, payload string, now time.Time) bool {
+	last, ok := f.last[topic]
+	if ok && payload == last.payload && now.Sub(last.at) < f.Heartbeat {
+		return false
+	}
+	f.last[topic] = lastPublished{payload: payload, at: now}
+	return true
+}
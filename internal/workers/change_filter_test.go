@@ -0,0 +1,38 @@
+package workers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeFilter_Changed(t *testing.T) {
+	f := NewChangeFilter(0.5)
+	t0 := time.Date(2026, 3, 4, 10, 0, 0, 0, time.Local)
+
+	assert.True(t, f.Changed("soc", 50, t0), "first value")
+	assert.False(t, f.Changed("soc", 50.25, t0.Add(time.Second)), "within epsilon")
+	assert.False(t, f.Changed("soc", 50.5, t0.Add(2*time.Second)), "epsilon is inclusive")
+	assert.True(t, f.Changed("soc", 50.75, t0.Add(3*time.Second)))
+	assert.False(t, f.Changed("soc", 50.5, t0.Add(4*time.Second)), "measured from the last published value")
+	assert.True(t, f.Changed("other", 50.5, t0.Add(4*time.Second)), "topics are independent")
+
+	assert.False(t, f.Changed("soc", 50.75, t0.Add(3*time.Second+stateHeartbeat-time.Second)))
+	assert.True(t, f.Changed("soc", 50.75, t0.Add(3*time.Second+stateHeartbeat)), "heartbeat")
+}
+
+func TestChangeFilter_ChangedPayload(t *testing.T) {
+	f := NewChangeFilter(0)
+	t0 := time.Date(2026, 3, 4, 10, 0, 0, 0, time.Local)
+
+	assert.True(t, f.ChangedPayload("runtime", "42", t0))
+	assert.False(t, f.ChangedPayload("runtime", "42", t0.Add(time.Minute)))
+	assert.True(t, f.ChangedPayload("runtime", "43", t0.Add(2*time.Minute)))
+	assert.True(t, f.ChangedPayload("runtime", "43", t0.Add(2*time.Minute+stateHeartbeat)), "heartbeat")
+}
+
+func TestStateHeartbeat_OutlastsSenderDedupe(t *testing.T) {
+	// Otherwise mqttSenderWorker drops the heartbeat as an unchanged resend
+	assert.Greater(t, stateHeartbeat, resendInterval)
+}
@@ -0,0 +1,114 @@
+package workers
+
+import (
+	"context"
+	"github.com/ryansname/powerctl/internal/ha"
+	"github.com/ryansname/powerctl/internal/stats"
+	"log"
+	"math"
+	"time"
+)
+
+// chargeLimitCommandCooldown rate-limits setpoint writes; service calls bypass the
+// sender's payload dedupe.
+const chargeLimitCommandCooldown = 30 * time.Second
+
+// ChargeLimitPoint is one point on a charge limit curve: at Voltage (5m P99) the
+// charge controller is capped at Amps.
+type ChargeLimitPoint struct {
+	Voltage float64 `json:"voltage"`
+	Amps    float64 `json:"amps"`
+}
+
+// ChargeLimitConfig configures charge current limiting for one battery's solar
+// charge controller as it approaches the absorb threshold.
+type ChargeLimitConfig struct {
+	SetpointEntityID string             `json:"setpoint_entity_id"` // HA number entity for the controller's max charge current
+	MaxAmps          float64            `json:"max_amps"`           // Setpoint below the first curve point
+	StepAmps         float64            `json:"step_amps"`          // Controller resolution; setpoints round down to this
+	Curve            []ChargeLimitPoint `json:"curve"`              // Ascending by voltage, linearly interpolated
+}
+
+// SetpointStateTopic returns the statestream topic for the setpoint number entity.
+func (c *ChargeLimitConfig) SetpointStateTopic() string {
+	return ha.EntityStateTopic(c.SetpointEntityID)
+}
+
+// chargeLimitForVoltage returns the charge current cap for a battery voltage.
+// Below the curve the controller runs at MaxAmps; above it the last point holds.
+func chargeLimitForVoltage(voltage float64, config ChargeLimitConfig) float64 {
+	curve := config.Curve
+	if len(curve) == 0 || voltage <= curve[0].Voltage {
+		return config.MaxAmps
+	}
+
+	amps := curve[len(curve)-1].Amps
+	for i := 1; i < len(curve); i++ {
+		if voltage < curve[i].Voltage {
+			lo, hi := curve[i-1], curve[i]
+			frac := (voltage - lo.Voltage) / (hi.Voltage - lo.Voltage)
+			amps = lo.Amps + frac*(hi.Amps-lo.Amps)
+			break
+		}
+	}
+
+	return roundChargeLimit(amps, config)
+}
+
+// roundChargeLimit rounds amps down to the controller's step and clamps to [0, MaxAmps].
+func roundChargeLimit(amps float64, config ChargeLimitConfig) float64 {
+	if config.StepAmps > 0 {
+		amps = math.Floor(amps/config.StepAmps) * config.StepAmps
+	}
+	return max(0, min(amps, config.MaxAmps))
+}
+
+// deratedChargeLimit caps amps at derate percent of MaxAmps (from the temperature
+// derating worker).
+func deratedChargeLimit(amps, derate float64, config ChargeLimitConfig) float64 {
+	return roundChargeLimit(min(amps, config.MaxAmps*derate/100), config)
+}
+
+// chargeLimitWorker caps a solar charge controller's charge current from the battery's
+// 5m P99 voltage, reading the current setpoint back from HA rather than tracking it.
+// With a derateTopic (temperature derating, %), the cap is further limited by it.
+func chargeLimitWorker(
+	ctx context.Context,
+	dataChan <-chan DisplayData,
+	name string,
+	voltageTopic string,
+	derateTopic string,
+	config ChargeLimitConfig,
+	sender *MQTTSender,
+) {
+	log.Printf("%s charge limit worker started\n", name)
+
+	stateTopic := config.SetpointStateTopic()
+	var lastCommand time.Time
+
+	for {
+		select {
+		case data := <-dataChan:
+			voltageP99 := data.GetPercentile(voltageTopic, stats.P99, stats.Window5Min)
+			target := chargeLimitForVoltage(voltageP99, config)
+			if derateTopic != "" {
+				target = deratedChargeLimit(target, data.GetFloat(derateTopic).Current, config)
+			}
+			current := data.GetFloat(stateTopic).Current
+
+			if math.Abs(target-current) < 0.5 || time.Since(lastCommand) < chargeLimitCommandCooldown {
+				continue
+			}
+
+			log.Printf("%s: charge limit %.0fA -> %.0fA (P99 %.2fV)\n", name, current, target, voltageP99)
+			sender.CallService("number", "set_value", config.SetpointEntityID, map[string]any{
+				haServiceValueKey: target,
+			})
+			lastCommand = time.Now()
+
+		case <-ctx.Done():
+			log.Printf("%s charge limit worker stopped\n", name)
+			return
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package workers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeTestChargeLimitConfig() ChargeLimitConfig {
+	return ChargeLimitConfig{
+		SetpointEntityID: "number.solar_5_max_charge_current",
+		MaxAmps:          60,
+		StepAmps:         5,
+		Curve: []ChargeLimitPoint{
+			{Voltage: 55.0, Amps: 60},
+			{Voltage: 56.0, Amps: 20},
+			{Voltage: 56.4, Amps: 10},
+		},
+	}
+}
+
+func TestChargeLimitForVoltage_BelowCurve(t *testing.T) {
+	assert.InDelta(t, 60.0, chargeLimitForVoltage(53.0, makeTestChargeLimitConfig()), 1e-9)
+}
+
+func TestChargeLimitForVoltage_Interpolates(t *testing.T) {
+	// Halfway between 55V/60A and 56V/20A is 40A
+	assert.InDelta(t, 40.0, chargeLimitForVoltage(55.5, makeTestChargeLimitConfig()), 1e-9)
+	// 55.6V -> 36A, rounded down to the 5A step
+	assert.InDelta(t, 35.0, chargeLimitForVoltage(55.6, makeTestChargeLimitConfig()), 1e-9)
+}
+
+func TestChargeLimitForVoltage_AboveCurveHoldsLastPoint(t *testing.T) {
+	assert.InDelta(t, 10.0, chargeLimitForVoltage(57.0, makeTestChargeLimitConfig()), 1e-9)
+}
+
+func TestChargeLimitConfig_SetpointStateTopic(t *testing.T) {
+	config := makeTestChargeLimitConfig()
+	assert.Equal(t, "homeassistant/number/solar_5_max_charge_current/state", config.SetpointStateTopic())
+}
+
+func TestDeratedChargeLimit(t *testing.T) {
+	config := makeTestChargeLimitConfig()
+	assert.InDelta(t, 25.0, deratedChargeLimit(60, 45, config), 1e-9, "27A rounded down to the 5A step")
+	assert.InDelta(t, 10.0, deratedChargeLimit(10, 50, config), 1e-9, "voltage cap already lower")
+	assert.InDelta(t, 0.0, deratedChargeLimit(60, 0, config), 1e-9, "charging blocked")
+}
@@ -0,0 +1,155 @@
+package workers
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"time"
+)
+
+// TopicCommandFailedState is the state topic for the binary sensor that turns on
+// while any tracked service call has exhausted its retries without converging.
+const TopicCommandFailedState = "powerctl/binary_sensor/powerctl_command_failed/state"
+
+// CommandExpectation is the state a service call's target entity should reach.
+type CommandExpectation struct {
+	StateTopic string // Statestream topic of the target entity
+	State      string // Expected state, compared case-insensitively (e.g. "on", "Eco")
+}
+
+// CommandTrackerConfig configures service call acknowledgement and retry.
+type CommandTrackerConfig struct {
+	MaxRetries     int           // Resends before raising the alert
+	InitialBackoff time.Duration // Wait before the first resend; doubles after each
+}
+
+// trackedCommand is a service call waiting for its entity to reach the expected state.
+type trackedCommand struct {
+	msg      MQTTMessage
+	sentAt   time.Time
+	attempts int // resends so far
+	failed   bool
+}
+
+// CommandTracker holds the outstanding command per state topic. A newer command for
+// the same entity replaces the older one.
+type CommandTracker struct {
+	config  CommandTrackerConfig
+	pending map[string]*trackedCommand
+}
+
+// NewCommandTracker creates an empty tracker.
+func NewCommandTracker(config CommandTrackerConfig) *CommandTracker {
+	return &CommandTracker{config: config, pending: make(map[string]*trackedCommand)}
+}
+
+// Track records a sent command. A resend of the outstanding command (same payload)
+// keeps its attempt count, so control loops re-issuing it don't reset the backoff.
+func (t *CommandTracker) Track(msg MQTTMessage, now time.Time) {
+	topic := msg.Expect.StateTopic
+	if existing, ok := t.pending[topic]; ok && bytes.Equal(existing.msg.Payload, msg.Payload) {
+		existing.sentAt = now
+		return
+	}
+	t.pending[topic] = &trackedCommand{msg: msg, sentAt: now}
+}
+
+// Check drops commands whose entity has converged and returns the ones due a resend.
+// Commands out of retries are marked failed and stay tracked until they converge.
+func (t *CommandTracker) Check(data DisplayData, now time.Time) []MQTTMessage {
+	var resend []MQTTMessage
+	for topic, cmd := range t.pending {
+		if strings.EqualFold(data.GetString(topic), cmd.msg.Expect.State) {
+			if cmd.attempts > 0 || cmd.failed {
+				log.Printf("Command tracker: %s reached %q after %d retries\n", topic, cmd.msg.Expect.State, cmd.attempts)
+			}
+			delete(t.pending, topic)
+			continue
+		}
+		if cmd.failed {
+			continue
+		}
+
+		backoff := t.config.InitialBackoff << cmd.attempts
+		if now.Sub(cmd.sentAt) < backoff {
+			continue
+		}
+		if cmd.attempts >= t.config.MaxRetries {
+			log.Printf("Command tracker: %s still not %q after %d retries, giving up\n",
+				topic, cmd.msg.Expect.State, cmd.attempts)
+			cmd.failed = true
+			continue
+		}
+		cmd.attempts++
+		cmd.sentAt = now
+		log.Printf("Command tracker: %s not %q, resending (retry %d/%d)\n",
+			topic, cmd.msg.Expect.State, cmd.attempts, t.config.MaxRetries)
+		resend = append(resend, cmd.msg)
+	}
+	return resend
+}
+
+// Failed reports whether any tracked command has given up.
+func (t *CommandTracker) Failed() bool {
+	for _, cmd := range t.pending {
+		if cmd.failed {
+			return true
+		}
+	}
+	return false
+}
+
+// Clear forgets every outstanding command.
+func (t *CommandTracker) Clear() {
+	clear(t.pending)
+}
+
+// commandTrackerWorker watches the state topics of service calls sent with an
+// expectation (passed on by mqttSenderWorker after filtering), resends them with
+// exponential backoff, and turns on the powerctl_command_failed binary sensor when
+// one never converges. Tracking stops while powerctl or the inverter switch is off
+// (unless forceEnable), since resends go straight to mqttSenderWorker.
+func commandTrackerWorker(
+	ctx context.Context,
+	trackChan <-chan MQTTMessage,
+	dataChan <-chan DisplayData,
+	config CommandTrackerConfig,
+	sender *MQTTSender,
+	forceEnable bool,
+) {
+	log.Println("Command tracker worker started")
+
+	tracker := NewCommandTracker(config)
+	lastFailed := true // Publish the initial OFF state
+
+	for {
+		select {
+		case msg := <-trackChan:
+			tracker.Track(msg, time.Now())
+
+		case data := <-dataChan:
+			gated := !data.GetBoolean(TopicPowerctlEnabledState) || !data.GetBoolean(TopicPowerhouseInvertersEnabledState)
+			if gated && !forceEnable {
+				tracker.Clear()
+			}
+
+			for _, msg := range tracker.Check(data, time.Now()) {
+				sender.Send(msg)
+			}
+
+			if failed := tracker.Failed(); failed != lastFailed {
+				payload := "OFF"
+				if failed {
+					payload = "ON"
+				}
+				sender.Send(MQTTMessage{Topic: TopicCommandFailedState, Payload: []byte(payload), QoS: 1, Retain: true})
+				lastFailed = failed
+			}
+
+		case <-ctx.Done():
+			log.Println("Command tracker worker stopped")
+			return
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package workers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const trackerTestTopic = "homeassistant/switch/inv_1/state"
+
+func trackedSwitchCall(service, state string) MQTTMessage {
+	msg := serviceCallMessage("switch", service, "switch.inv_1", nil)
+	msg.Expect = &CommandExpectation{StateTopic: trackerTestTopic, State: state}
+	return msg
+}
+
+func switchState(raw string) DisplayData {
+	return DisplayData{TopicData: map[string]any{
+		trackerTestTopic: makeBoolTopic(raw == "on", raw),
+	}}
+}
+
+func TestCommandTracker_ConvergedCommandIsDropped(t *testing.T) {
+	tracker := NewCommandTracker(CommandTrackerConfig{MaxRetries: 3, InitialBackoff: 10 * time.Second})
+	now := time.Now()
+	tracker.Track(trackedSwitchCall("turn_on", "on"), now)
+
+	assert.Empty(t, tracker.Check(switchState("on"), now.Add(time.Minute)))
+	assert.Empty(t, tracker.pending)
+}
+
+func TestCommandTracker_RetriesWithBackoffThenFails(t *testing.T) {
+	tracker := NewCommandTracker(CommandTrackerConfig{MaxRetries: 2, InitialBackoff: 10 * time.Second})
+	start := time.Now()
+	msg := trackedSwitchCall("turn_on", "on")
+	tracker.Track(msg, start)
+	off := switchState("off")
+
+	assert.Empty(t, tracker.Check(off, start.Add(9*time.Second)))
+	assert.Equal(t, []MQTTMessage{msg}, tracker.Check(off, start.Add(10*time.Second)))
+
+	// The resend comes back through mqttSenderWorker without resetting the count
+	tracker.Track(msg, start.Add(10*time.Second))
+	assert.Empty(t, tracker.Check(off, start.Add(29*time.Second)))
+	assert.Equal(t, []MQTTMessage{msg}, tracker.Check(off, start.Add(30*time.Second)))
+
+	assert.False(t, tracker.Failed())
+	assert.Empty(t, tracker.Check(off, start.Add(70*time.Second)))
+	assert.True(t, tracker.Failed())
+
+	// A late convergence clears the failure
+	assert.Empty(t, tracker.Check(switchState("on"), start.Add(80*time.Second)))
+	assert.False(t, tracker.Failed())
+}
+
+func TestCommandTracker_NewCommandSupersedes(t *testing.T) {
+	tracker := NewCommandTracker(CommandTrackerConfig{MaxRetries: 1, InitialBackoff: 10 * time.Second})
+	start := time.Now()
+	tracker.Track(trackedSwitchCall("turn_on", "on"), start)
+	off := trackedSwitchCall("turn_off", "off")
+	tracker.Track(off, start.Add(5*time.Second))
+
+	// Entity is off, which satisfies the newer command
+	assert.Empty(t, tracker.Check(switchState("off"), start.Add(time.Minute)))
+	assert.Empty(t, tracker.pending)
+}
+
+func TestCommandTracker_CaseInsensitiveState(t *testing.T) {
+	tracker := NewCommandTracker(CommandTrackerConfig{MaxRetries: 1, InitialBackoff: time.Second})
+	now := time.Now()
+	msg := serviceCallMessage("select", "select_option", "select.miner", map[string]any{"option": "Eco"})
+	msg.Expect = &CommandExpectation{StateTopic: "miner/state", State: "Eco"}
+	tracker.Track(msg, now)
+
+	data := DisplayData{TopicData: map[string]any{"miner/state": makeStringTopic("eco")}}
+	assert.Empty(t, tracker.Check(data, now.Add(time.Minute)))
+	assert.Empty(t, tracker.pending)
+}
@@ -0,0 +1,362 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/ryansname/powerctl/internal/ha"
+	"github.com/ryansname/powerctl/sankey"
+)
+
+// version and commit identify the build, set at link time with -ldflags "-X
+// github.com/ryansname/powerctl/internal/workers.version=..." (and .commit). Without
+// commit, buildCommit falls back to the VCS revision go build embeds.
+var (
+	version = "dev"
+	commit  = ""
+)
+
+const commandUsage = `Usage: powerctl <command> [flags]
+
+Commands:
+  run              Run the control daemon (default when no command is given)
+  sankey           Print the generated Sankey card and template YAML
+  validate-config  Check battery configs and the excess policy, then exit
+  audit            Show recent control decisions from the audit log
+  simulate         Run the baseline controller over a simulated day against simple models
+  tune             Sweep ramp and overflow thresholds in simulation and report the Pareto-best
+  version          Print the build version and commit
+
+Run 'powerctl <command> -h' for command flags.
+`
+
+// RunCommand dispatches a subcommand and returns the process exit code. Bare flags
+// (e.g. `powerctl --debug`) still run the daemon so existing service files keep working.
+func RunCommand(args []string) int {
+	cmd := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+
+	switch cmd {
+	case "run":
+		return runDaemon(args)
+	case "sankey":
+		return runSankeyCommand(args)
+	case "validate-config":
+		return runValidateConfigCommand(args)
+	case "audit":
+		return runAuditCommand(args)
+	case "simulate":
+		return runSimulateCommand(args)
+	case "tune":
+		return runTuneCommand(args)
+	case "version":
+		fmt.Printf("%s (%s)\n", version, buildCommit())
+		return 0
+	case "help":
+		fmt.Print(commandUsage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "powerctl: unknown command %q\n\n%s", cmd, commandUsage)
+		return 2
+	}
+}
+
+// runSankeyCommand implements `powerctl sankey`: generate the Sankey card and template
+// YAML from the built-in diagram or a JSON definition, to stdout or files in --out.
+// With --validate, checks the referenced entities against HA instead.
+func runSankeyCommand(args []string) int {
+	fs := flag.NewFlagSet("sankey", flag.ContinueOnError)
+	configPath := fs.String("config", "", "JSON diagram definition (default: built-in)")
+	outDir := fs.String("out", "", "Write sankey-card.yaml and sankey-templates.yaml to this directory")
+	dumpConfig := fs.Bool("dump-config", false, "Print the diagram definition as JSON (a starting point for --config)")
+	templatesOnly := fs.Bool("templates", false, "Print only the template sensors YAML")
+	cardOnly := fs.Bool("card", false, "Print only the Sankey card YAML")
+	validate := fs.Bool("validate", false, "Check referenced entities exist in HA (needs HA_URL and HA_TOKEN)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg := sankey.DefaultConfig()
+	if *configPath != "" {
+		loaded, err := sankey.LoadConfig(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "sankey: %v\n", err)
+			return 1
+		}
+		cfg = loaded
+	}
+
+	if *dumpConfig {
+		data, err := sankey.MarshalConfig(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "sankey: %v\n", err)
+			return 1
+		}
+		fmt.Println(string(data))
+		return 0
+	}
+
+	if *validate {
+		return validateSankeyEntities(cfg)
+	}
+
+	configs := sankey.GenerateFrom(cfg)
+
+	if *outDir != "" {
+		files := []struct{ name, content string }{
+			{"sankey-card.yaml", configs.SankeyConfig},
+			{"sankey-templates.yaml", configs.Templates},
+		}
+		for _, f := range files {
+			path := filepath.Join(*outDir, f.name)
+			if err := os.WriteFile(path, []byte(f.content), 0o600); err != nil {
+				fmt.Fprintf(os.Stderr, "sankey: %v\n", err)
+				return 1
+			}
+			fmt.Printf("Wrote %s\n", path)
+		}
+		return 0
+	}
+
+	if !*templatesOnly {
+		fmt.Println(configs.SankeyConfig)
+	}
+	if !*cardOnly {
+		fmt.Println(configs.Templates)
+	}
+	return 0
+}
+
+// validateSankeyEntities reports every entity the diagram references that HA doesn't
+// have, with a suggestion when it looks like a misspelling. Returns the exit code.
+func validateSankeyEntities(cfg sankey.Config) int {
+	// .env is optional; HA_URL/HA_TOKEN may come from the shell
+	_ = godotenv.Load()
+	haURL, haToken := os.Getenv("HA_URL"), os.Getenv("HA_TOKEN")
+	if haURL == "" || haToken == "" {
+		fmt.Fprintln(os.Stderr, "sankey: HA_URL and HA_TOKEN are required for --validate")
+		return 2
+	}
+
+	known, err := ha.NewClient(haURL, haToken).EntityIDs(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sankey: %v\n", err)
+		return 1
+	}
+
+	missing := sankey.MissingEntities(cfg, known)
+	for _, m := range missing {
+		if m.Suggestion != "" {
+			fmt.Printf("missing: %s (did you mean %s?)\n", m.ID, m.Suggestion)
+		} else {
+			fmt.Printf("missing: %s\n", m.ID)
+		}
+	}
+	if len(missing) > 0 {
+		fmt.Printf("%d of %d referenced entities not found in Home Assistant\n",
+			len(missing), len(sankey.ReferencedEntities(cfg)))
+		return 1
+	}
+	fmt.Printf("All %d referenced entities exist\n", len(sankey.ReferencedEntities(cfg)))
+	return 0
+}
+
+// validateBatteryConfig checks a battery definition for mistakes that would otherwise
+// only show up at runtime (e.g. an inverter without a matching energy sensor).
+func validateBatteryConfig(b BatteryConfig) error {
+	var errs []error
+	if b.Name == "" {
+		errs = append(errs, errors.New("name is empty"))
+	}
+	if b.CapacityKWh <= 0 {
+		errs = append(errs, fmt.Errorf("capacity %.2f kWh must be positive", b.CapacityKWh))
+	}
+	if b.ConversionLossRate < 0 || b.ConversionLossRate >= 1 {
+		errs = append(errs, fmt.Errorf("conversion loss rate %.2f must be in [0, 1)", b.ConversionLossRate))
+	}
+	if len(b.OutflowEnergyTopics) != len(b.OutflowPowerTopics) {
+		errs = append(errs, fmt.Errorf("%d outflow energy topics but %d outflow power topics",
+			len(b.OutflowEnergyTopics), len(b.OutflowPowerTopics)))
+	}
+	if len(b.InverterSwitchIDs) > 0 && len(b.InverterSwitchIDs) != len(b.OutflowEnergyTopics) {
+		errs = append(errs, fmt.Errorf("%d inverter switches but %d outflow energy topics",
+			len(b.InverterSwitchIDs), len(b.OutflowEnergyTopics)))
+	}
+	if b.ChargeStateTopic == "" || b.BatteryVoltageTopic == "" {
+		errs = append(errs, errors.New("charge state and battery voltage topics are required"))
+	}
+	if b.EmptyVoltageThreshold > 0 && b.EmptyVoltageThreshold >= b.HighVoltageThreshold {
+		errs = append(errs, fmt.Errorf("empty voltage %.2fV must be below high voltage %.2fV",
+			b.EmptyVoltageThreshold, b.HighVoltageThreshold))
+	}
+	if b.LowVoltageTrip > 0 || b.LowVoltageRecovery > 0 {
+		if b.LowVoltageTrip >= b.LowVoltageRecovery || b.LowVoltageRecovery >= b.HighVoltageThreshold {
+			errs = append(errs, fmt.Errorf("low voltage trip %.2fV must be below recovery %.2fV, which must be below high voltage %.2fV",
+				b.LowVoltageTrip, b.LowVoltageRecovery, b.HighVoltageThreshold))
+		}
+	}
+	if b.LowVoltageFastTrip > 0 && b.LowVoltageTrip > 0 && b.LowVoltageFastTrip >= b.LowVoltageTrip {
+		errs = append(errs, fmt.Errorf("low voltage fast trip %.2fV must be below trip %.2fV",
+			b.LowVoltageFastTrip, b.LowVoltageTrip))
+	}
+	if err := validateSOCAnchors(b.SOCAnchors); err != nil {
+		errs = append(errs, err)
+	}
+	if err := b.SOCReserve.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := b.IslandSOCReserve.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("island: %w", err))
+	}
+	if b.ChargeLimit != nil {
+		if !strings.HasPrefix(b.ChargeLimit.SetpointEntityID, "number.") {
+			errs = append(errs, fmt.Errorf("charge limit setpoint %q is not a number entity", b.ChargeLimit.SetpointEntityID))
+		}
+		if b.ChargeLimit.MaxAmps <= 0 {
+			errs = append(errs, fmt.Errorf("charge limit max current %.1fA must be positive", b.ChargeLimit.MaxAmps))
+		}
+		for i := 1; i < len(b.ChargeLimit.Curve); i++ {
+			if b.ChargeLimit.Curve[i].Voltage <= b.ChargeLimit.Curve[i-1].Voltage {
+				errs = append(errs, errors.New("charge limit curve voltages must be strictly ascending"))
+				break
+			}
+		}
+	}
+	if t := b.Temperature; t != nil {
+		if len(t.Topics) == 0 {
+			errs = append(errs, errors.New("temperature derating needs at least one topic"))
+		}
+		if t.MaxTemp <= t.DerateTemp {
+			errs = append(errs, fmt.Errorf("max temperature %.1f°C must be above derate temperature %.1f°C",
+				t.MaxTemp, t.DerateTemp))
+		}
+	}
+	for entityID, target := range b.InverterModbus {
+		if !slices.Contains(b.InverterSwitchIDs, entityID) {
+			errs = append(errs, fmt.Errorf("modbus target for %s, which is not an inverter switch", entityID))
+		}
+		if target.Address == "" {
+			errs = append(errs, fmt.Errorf("modbus target for %s has no address", entityID))
+		}
+		if target.OnValue == target.OffValue {
+			errs = append(errs, fmt.Errorf("modbus target for %s has the same on and off value", entityID))
+		}
+	}
+	for entityID, target := range b.InverterShelly {
+		if !slices.Contains(b.InverterSwitchIDs, entityID) {
+			errs = append(errs, fmt.Errorf("shelly target for %s, which is not an inverter switch", entityID))
+		}
+		if target.Host == "" {
+			errs = append(errs, fmt.Errorf("shelly target for %s has no host", entityID))
+		}
+		if _, ok := b.InverterModbus[entityID]; ok {
+			errs = append(errs, fmt.Errorf("%s has both a modbus and a shelly target", entityID))
+		}
+	}
+	for entityID, numberID := range b.InverterPowerLimit {
+		if !slices.Contains(b.InverterSwitchIDs, entityID) {
+			errs = append(errs, fmt.Errorf("power limit for %s, which is not an inverter switch", entityID))
+		}
+		if !strings.HasPrefix(numberID, "number.") {
+			errs = append(errs, fmt.Errorf("power limit for %s is %q, not a number entity", entityID, numberID))
+		}
+	}
+	if bms := b.BMS; bms != nil {
+		if len(bms.CellVoltageTopics) == 0 {
+			errs = append(errs, errors.New("BMS monitoring needs at least one cell voltage topic"))
+		}
+		if bms.RecoverCellVoltage < bms.MinCellVoltage {
+			errs = append(errs, fmt.Errorf("cell recover voltage %.3fV must not be below minimum %.3fV",
+				bms.RecoverCellVoltage, bms.MinCellVoltage))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("%s: %w", b.Name, err)
+	}
+	return nil
+}
+
+// runValidateConfigCommand implements `powerctl validate-config`.
+func runValidateConfigCommand(args []string) int {
+	fs := flag.NewFlagSet("validate-config", flag.ContinueOnError)
+	excessPolicyPath := fs.String("excess-policy", "", "Also validate this excess policy JSON file")
+	touTariffPath := fs.String("tou-tariff", "", "Also validate this TOU tariff JSON file")
+	touSchedulePath := fs.String("tou-schedule", "", "Also validate this TOU schedule JSON file")
+	thresholdProfilesPath := fs.String("threshold-profiles", "", "Also validate this threshold profiles JSON file")
+	topicQoSPath := fs.String("topic-qos", "", "Also validate this topic QoS JSON file")
+	batteryHardwarePath := fs.String("battery-hardware", "", "Validate the batteries with this battery hardware JSON file applied")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	battery2, battery3 := DefaultBatteryConfigs()
+	if *batteryHardwarePath != "" {
+		hardware, err := LoadBatteryHardware(*batteryHardwarePath)
+		if err == nil {
+			err = applyBatteryHardware(hardware, &battery2, &battery3)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Config invalid:\nbattery hardware: %v\n", err)
+			return 1
+		}
+	}
+	errs := []error{
+		validateBatteryConfig(battery2),
+		validateBatteryConfig(battery3),
+		validateTopicUnits(topicUnits),
+	}
+	var subscribed []string
+	rules := make(map[string]PlausibilityRule)
+	for _, b := range []BatteryConfig{battery2, battery3} {
+		subscribed = append(subscribed, b.Topics()...)
+		maps.Copy(rules, b.PlausibilityRules())
+	}
+	errs = append(errs, validatePlausibilityRules(rules))
+	subscribed = append(subscribed, BuildBaselineInverterConfig(battery2, battery3).Input.Topics()...)
+	subscribed = append(subscribed, BuildDynamicInverterConfig(battery2, battery3).Input.Topics()...)
+	errs = append(errs, validateSelfPublishedTopics([]BatteryConfig{battery2, battery3}, subscribed))
+	if *excessPolicyPath != "" {
+		if _, err := LoadExcessPolicy(*excessPolicyPath); err != nil {
+			errs = append(errs, fmt.Errorf("excess policy: %w", err))
+		}
+	}
+	if *touTariffPath != "" {
+		if _, err := LoadTOUTariffConfig(*touTariffPath); err != nil {
+			errs = append(errs, fmt.Errorf("TOU tariff: %w", err))
+		}
+	}
+	if *touSchedulePath != "" {
+		if _, err := LoadTOUSchedulerConfig(*touSchedulePath); err != nil {
+			errs = append(errs, fmt.Errorf("TOU schedule: %w", err))
+		}
+	}
+
+	if *thresholdProfilesPath != "" {
+		if _, err := LoadThresholdProfiles(*thresholdProfilesPath, BuildBaselineInverterConfig(battery2, battery3)); err != nil {
+			errs = append(errs, fmt.Errorf("threshold profiles: %w", err))
+		}
+	}
+
+	if *topicQoSPath != "" {
+		if _, err := LoadTopicQoSConfig(*topicQoSPath); err != nil {
+			errs = append(errs, fmt.Errorf("topic QoS: %w", err))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		fmt.Fprintf(os.Stderr, "Config invalid:\n%v\n", err)
+		return 1
+	}
+	fmt.Println("Config OK")
+	return 0
+}
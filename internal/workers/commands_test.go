@@ -0,0 +1,109 @@
+package workers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultBatteryConfigsValid(t *testing.T) {
+	battery2, battery3 := DefaultBatteryConfigs()
+	assert.NoError(t, validateBatteryConfig(battery2))
+	assert.NoError(t, validateBatteryConfig(battery3))
+}
+
+func TestValidateBatteryConfig_MismatchedInverters(t *testing.T) {
+	b, _ := DefaultBatteryConfigs()
+	b.InverterSwitchIDs = b.InverterSwitchIDs[:3]
+
+	err := validateBatteryConfig(b)
+	assert.ErrorContains(t, err, "3 inverter switches but 9 outflow energy topics")
+}
+
+func TestValidateBatteryConfig_ChargeLimitCurveOrder(t *testing.T) {
+	b, _ := DefaultBatteryConfigs()
+	b.ChargeLimit = &ChargeLimitConfig{Curve: []ChargeLimitPoint{{Voltage: 54, Amps: 10}, {Voltage: 53, Amps: 5}}}
+
+	assert.ErrorContains(t, validateBatteryConfig(b), "strictly ascending")
+}
+
+func TestValidateBatteryConfig_Temperature(t *testing.T) {
+	b, _ := DefaultBatteryConfigs()
+	b.Temperature = &TemperatureConfig{DerateTemp: 50, MaxTemp: 45}
+
+	err := validateBatteryConfig(b)
+	assert.ErrorContains(t, err, "at least one topic")
+	assert.ErrorContains(t, err, "must be above derate temperature")
+}
+
+func TestValidateBatteryConfig_LowVoltage(t *testing.T) {
+	b, _ := DefaultBatteryConfigs()
+	b.LowVoltageRecovery = b.LowVoltageTrip
+	assert.ErrorContains(t, validateBatteryConfig(b), "must be below recovery")
+
+	b.LowVoltageRecovery = b.HighVoltageThreshold
+	assert.ErrorContains(t, validateBatteryConfig(b), "must be below high voltage")
+
+	b.LowVoltageRecovery = b.LowVoltageTrip + 1
+	b.LowVoltageFastTrip = b.LowVoltageTrip
+	assert.ErrorContains(t, validateBatteryConfig(b), "fast trip")
+
+	b.LowVoltageTrip, b.LowVoltageRecovery = 0, 0
+	assert.NoError(t, validateBatteryConfig(b), "disabled")
+}
+
+func TestSOCReserve_Validate(t *testing.T) {
+	b, _ := DefaultBatteryConfigs()
+	assert.NoError(t, b.SOCReserve.Validate())
+	assert.NoError(t, SOCReserve{}.Validate(), "disabled")
+
+	b.SOCReserve.TurnOffStart = b.SOCReserve.TurnOnStart + 1
+	assert.ErrorContains(t, validateBatteryConfig(b), "turn-off")
+
+	b.IslandSOCReserve.TurnOnEnd = 120
+	assert.ErrorContains(t, validateBatteryConfig(b), "island: SOC reserve threshold 120.0% not in 0–100%")
+}
+
+func TestBuildBaselineInverterConfig_LowVoltageFromBattery(t *testing.T) {
+	b2, b3 := DefaultBatteryConfigs()
+	b2.LowVoltageTrip, b2.LowVoltageRecovery = 48.5, 51.0
+	config := BuildBaselineInverterConfig(b2, b3)
+	assert.Equal(t, 48.5, config.LowVoltageTurnOffStart)
+	assert.Equal(t, 51.0, config.LowVoltageRecoveryVoltage)
+}
+
+func TestRunCommand_Unknown(t *testing.T) {
+	assert.Equal(t, 2, RunCommand([]string{"frobnicate"}))
+	assert.Equal(t, 0, RunCommand([]string{"version"}))
+}
+
+func TestValidateBatteryConfig_InverterModbus(t *testing.T) {
+	b, _ := DefaultBatteryConfigs()
+	b.InverterModbus = map[string]ModbusTarget{
+		b.InverterSwitchIDs[0]: {Address: "gx:502", OnValue: 3, OffValue: 4},
+	}
+	assert.NoError(t, validateBatteryConfig(b))
+
+	b.InverterModbus["switch.unknown"] = ModbusTarget{OnValue: 1}
+	err := validateBatteryConfig(b)
+	assert.ErrorContains(t, err, "not an inverter switch")
+	assert.ErrorContains(t, err, "has no address")
+}
+
+func TestValidateBatteryConfig_InverterShelly(t *testing.T) {
+	b, _ := DefaultBatteryConfigs()
+	b.InverterShelly = map[string]ShellyTarget{b.InverterSwitchIDs[0]: {Host: "192.168.1.50"}}
+	assert.NoError(t, validateBatteryConfig(b))
+
+	b.InverterModbus = map[string]ModbusTarget{b.InverterSwitchIDs[0]: {Address: "gx:502", OnValue: 3, OffValue: 4}}
+	assert.ErrorContains(t, validateBatteryConfig(b), "both a modbus and a shelly target")
+}
+
+func TestValidateBatteryConfig_InverterPowerLimit(t *testing.T) {
+	b, _ := DefaultBatteryConfigs()
+	b.InverterPowerLimit = map[string]string{b.InverterSwitchIDs[0]: "number.inverter_1_power_limit"}
+	assert.NoError(t, validateBatteryConfig(b))
+
+	b.InverterPowerLimit[b.InverterSwitchIDs[1]] = "sensor.inverter_2_power"
+	assert.ErrorContains(t, validateBatteryConfig(b), "not a number entity")
+}
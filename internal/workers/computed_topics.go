@@ -0,0 +1,428 @@
+package workers
+
+import (
+	"fmt"
+	"github.com/ryansname/powerctl/internal/ha"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Computed topics derived by statsWorker (see registerComputedTopic)
+const (
+	TopicPowerhouseTotalOut = "powerctl/computed/powerhouse_total_out"
+	TopicSolar34Power       = "powerctl/computed/solar_34_power"
+)
+
+// ComputedTopic is a float topic statsWorker evaluates from other float topics whenever
+// one of its inputs changes. It gets readings, percentiles and EMA like a received topic.
+//
+// Expressions support numbers, + - * / and parentheses, and the functions sum, min, max,
+// avg (any number of arguments) and abs. Operands are topics:
+//   - a bare name is a statestream sensor: solar_1_power is homeassistant/sensor/solar_1_power/state
+//   - a quoted string is a full topic: "powerctl/computed/solar_34_power"
+//   - a name with a {a..b} range expands to one argument per number, as a function argument:
+//     sum(powerhouse_inverter_{1..9}_switch_0_power)
+//
+// The value is only updated once every input has a value.
+type ComputedTopic struct {
+	Topic  string
+	Expr   string
+	inputs []string
+	root   exprNode
+}
+
+// computedTopics are evaluated in registration order, so an expression may use
+// computed topics registered before it.
+var computedTopics []*ComputedTopic
+
+// registerComputedTopic parses expr and adds it to computedTopics. Must be called
+// before statsWorker starts.
+func registerComputedTopic(topic, expr string) error {
+	c, err := compileComputedTopic(topic, expr)
+	if err != nil {
+		return err
+	}
+	// Only earlier computed topics may be read, which rules out cycles
+	if c.DependsOn(topic) {
+		return fmt.Errorf("computed topic %s: reads itself", topic)
+	}
+	for _, existing := range computedTopics {
+		if existing.DependsOn(topic) {
+			return fmt.Errorf("computed topic %s: read by %s, which is registered before it", topic, existing.Topic)
+		}
+	}
+	computedTopics = append(computedTopics, c)
+	return nil
+}
+
+// ComputedTopicInputs returns the received topics read by the computed topics, for
+// subscription. Inputs that are themselves computed are left out.
+func ComputedTopicInputs() []string {
+	computed := make(map[string]bool)
+	var topics []string
+	for _, c := range computedTopics {
+		for _, input := range c.inputs {
+			if !computed[input] {
+				topics = append(topics, input)
+			}
+		}
+		computed[c.Topic] = true
+	}
+	return topics
+}
+
+// sumTopicsExpr builds an expression summing topics, for computed topics derived from
+// config lists.
+func sumTopicsExpr(topics []string) string {
+	quoted := make([]string, len(topics))
+	for i, topic := range topics {
+		quoted[i] = strconv.Quote(topic)
+	}
+	return "sum(" + strings.Join(quoted, ", ") + ")"
+}
+
+func compileComputedTopic(topic, expr string) (*ComputedTopic, error) {
+	tokens, err := tokenizeExpr(expr)
+	if err != nil {
+		return nil, fmt.Errorf("computed topic %s: %w", topic, err)
+	}
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseExpr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("computed topic %s: %w", topic, err)
+	}
+	return &ComputedTopic{Topic: topic, Expr: expr, inputs: p.inputs, root: root}, nil
+}
+
+// DependsOn reports whether topic is one of the expression's operands.
+func (c *ComputedTopic) DependsOn(topic string) bool {
+	return slices.Contains(c.inputs, topic)
+}
+
+// Evaluate computes the value from lookup. ok is false while an input is missing or
+// on division by zero.
+func (c *ComputedTopic) Evaluate(lookup func(topic string) (float64, bool)) (value float64, ok bool) {
+	return c.root.eval(lookup)
+}
+
+type exprNode interface {
+	eval(lookup func(string) (float64, bool)) (float64, bool)
+}
+
+type numberNode float64
+
+func (n numberNode) eval(func(string) (float64, bool)) (float64, bool) {
+	return float64(n), true
+}
+
+type topicNode string
+
+func (n topicNode) eval(lookup func(string) (float64, bool)) (float64, bool) {
+	return lookup(string(n))
+}
+
+type negateNode struct{ operand exprNode }
+
+func (n negateNode) eval(lookup func(string) (float64, bool)) (float64, bool) {
+	v, ok := n.operand.eval(lookup)
+	return -v, ok
+}
+
+type binaryNode struct {
+	op          byte
+	left, right exprNode
+}
+
+func (n binaryNode) eval(lookup func(string) (float64, bool)) (float64, bool) {
+	l, ok := n.left.eval(lookup)
+	if !ok {
+		return 0, false
+	}
+	r, ok := n.right.eval(lookup)
+	if !ok {
+		return 0, false
+	}
+	switch n.op {
+	case '+':
+		return l + r, true
+	case '-':
+		return l - r, true
+	case '*':
+		return l * r, true
+	default:
+		if r == 0 {
+			return 0, false
+		}
+		return l / r, true
+	}
+}
+
+type funcNode struct {
+	name string
+	args []exprNode
+}
+
+func (n funcNode) eval(lookup func(string) (float64, bool)) (float64, bool) {
+	values := make([]float64, len(n.args))
+	for i, arg := range n.args {
+		v, ok := arg.eval(lookup)
+		if !ok {
+			return 0, false
+		}
+		values[i] = v
+	}
+
+	var result float64
+	switch n.name {
+	case "sum", "avg":
+		for _, v := range values {
+			result += v
+		}
+		if n.name == "avg" {
+			result /= float64(len(values))
+		}
+	case "min":
+		result = values[0]
+		for _, v := range values[1:] {
+			result = min(result, v)
+		}
+	case "max":
+		result = values[0]
+		for _, v := range values[1:] {
+			result = max(result, v)
+		}
+	case "abs":
+		result = max(values[0], -values[0])
+	}
+	return result, true
+}
+
+type exprTokenKind int
+
+const (
+	tokenNumber exprTokenKind = iota
+	tokenName
+	tokenTopic // quoted full topic
+	tokenSymbol
+)
+
+type exprToken struct {
+	kind exprTokenKind
+	text string
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func tokenizeExpr(expr string) ([]exprToken, error) {
+	var tokens []exprToken
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c >= '0' && c <= '9' || c == '.':
+			start := i
+			for i < len(expr) && (expr[i] >= '0' && expr[i] <= '9' || expr[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, exprToken{tokenNumber, expr[start:i]})
+		case isNameChar(c) || c == '{':
+			// Names may contain one {a..b} range
+			start := i
+			for i < len(expr) && (isNameChar(expr[i]) || expr[i] == '{') {
+				if expr[i] == '{' {
+					end := strings.IndexByte(expr[i:], '}')
+					if end < 0 {
+						return nil, fmt.Errorf("unterminated range in %q", expr[start:])
+					}
+					i += end
+				}
+				i++
+			}
+			tokens = append(tokens, exprToken{tokenName, expr[start:i]})
+		case c == '"':
+			end := strings.IndexByte(expr[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated topic string")
+			}
+			tokens = append(tokens, exprToken{tokenTopic, expr[i+1 : i+1+end]})
+			i += end + 2
+		case strings.IndexByte("+-*/(),", c) >= 0:
+			tokens = append(tokens, exprToken{tokenSymbol, string(c)})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return tokens, nil
+}
+
+// exprParser is a recursive descent parser over the token list, collecting the
+// topics the expression reads.
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+	inputs []string
+}
+
+func (p *exprParser) peek(text string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokenSymbol && p.tokens[p.pos].text == text
+}
+
+func (p *exprParser) expect(text string) error {
+	if !p.peek(text) {
+		return fmt.Errorf("expected %q", text)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *exprParser) topic(topic string) exprNode {
+	if !slices.Contains(p.inputs, topic) {
+		p.inputs = append(p.inputs, topic)
+	}
+	return topicNode(topic)
+}
+
+func (p *exprParser) parseExpr() (exprNode, error) {
+	left, err := p.parseTerm()
+	for err == nil && (p.peek("+") || p.peek("-")) {
+		op := p.tokens[p.pos].text[0]
+		p.pos++
+		var right exprNode
+		right, err = p.parseTerm()
+		left = binaryNode{op, left, right}
+	}
+	return left, err
+}
+
+func (p *exprParser) parseTerm() (exprNode, error) {
+	left, err := p.parseUnary()
+	for err == nil && (p.peek("*") || p.peek("/")) {
+		op := p.tokens[p.pos].text[0]
+		p.pos++
+		var right exprNode
+		right, err = p.parseUnary()
+		left = binaryNode{op, left, right}
+	}
+	return left, err
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.peek("-") {
+		p.pos++
+		operand, err := p.parseUnary()
+		return negateNode{operand}, err
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	tok := p.tokens[p.pos]
+	p.pos++
+
+	switch tok.kind {
+	case tokenNumber:
+		v, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %q", tok.text)
+		}
+		return numberNode(v), nil
+	case tokenTopic:
+		return p.topic(tok.text), nil
+	case tokenName:
+		if p.peek("(") {
+			return p.parseCall(tok.text)
+		}
+		if strings.Contains(tok.text, "{") {
+			return nil, fmt.Errorf("range %q is only allowed as a function argument", tok.text)
+		}
+		return p.topic(sensorTopic(tok.text)), nil
+	default:
+		if tok.text == "(" {
+			inner, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return inner, p.expect(")")
+		}
+		return nil, fmt.Errorf("unexpected %q", tok.text)
+	}
+}
+
+func (p *exprParser) parseCall(name string) (exprNode, error) {
+	switch name {
+	case "sum", "min", "max", "avg", "abs":
+	default:
+		return nil, fmt.Errorf("unknown function %q", name)
+	}
+	p.pos++ // (
+
+	var args []exprNode
+	for !p.peek(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		// A range argument expands in place
+		if p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokenName &&
+			strings.Contains(p.tokens[p.pos].text, "{") {
+			names, err := expandRange(p.tokens[p.pos].text)
+			if err != nil {
+				return nil, err
+			}
+			p.pos++
+			for _, n := range names {
+				args = append(args, p.topic(sensorTopic(n)))
+			}
+			continue
+		}
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.pos++ // )
+
+	if len(args) == 0 || (name == "abs" && len(args) != 1) {
+		return nil, fmt.Errorf("wrong number of arguments to %s", name)
+	}
+	return funcNode{name, args}, nil
+}
+
+// sensorTopic maps a statestream sensor name to its topic.
+func sensorTopic(name string) string {
+	return ha.StatestreamTopic("sensor", name, "state")
+}
+
+// expandRange expands the {a..b} in name into one name per number.
+func expandRange(name string) ([]string, error) {
+	open := strings.IndexByte(name, '{')
+	end := strings.IndexByte(name, '}')
+	from, to, ok := strings.Cut(name[open+1:end], "..")
+	if !ok {
+		return nil, fmt.Errorf("bad range in %q, want {a..b}", name)
+	}
+	a, errA := strconv.Atoi(from)
+	b, errB := strconv.Atoi(to)
+	if errA != nil || errB != nil || a > b {
+		return nil, fmt.Errorf("bad range in %q, want {a..b}", name)
+	}
+
+	names := make([]string, 0, b-a+1)
+	for i := a; i <= b; i++ {
+		names = append(names, name[:open]+strconv.Itoa(i)+name[end+1:])
+	}
+	return names, nil
+}
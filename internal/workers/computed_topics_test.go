@@ -0,0 +1,95 @@
+package workers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func lookupMap(values map[string]float64) func(string) (float64, bool) {
+	return func(topic string) (float64, bool) {
+		v, ok := values[topic]
+		return v, ok
+	}
+}
+
+func TestComputedTopic_RangeSum(t *testing.T) {
+	c, err := compileComputedTopic("out", "sum(powerhouse_inverter_{1..3}_switch_0_power)")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"homeassistant/sensor/powerhouse_inverter_1_switch_0_power/state",
+		"homeassistant/sensor/powerhouse_inverter_2_switch_0_power/state",
+		"homeassistant/sensor/powerhouse_inverter_3_switch_0_power/state",
+	}, c.inputs)
+
+	values := map[string]float64{
+		"homeassistant/sensor/powerhouse_inverter_1_switch_0_power/state": 100,
+		"homeassistant/sensor/powerhouse_inverter_2_switch_0_power/state": 200,
+	}
+	_, ok := c.Evaluate(lookupMap(values))
+	assert.False(t, ok, "waits for every input")
+
+	values["homeassistant/sensor/powerhouse_inverter_3_switch_0_power/state"] = 300
+	v, ok := c.Evaluate(lookupMap(values))
+	assert.True(t, ok)
+	assert.Equal(t, 600.0, v)
+}
+
+func TestComputedTopic_Arithmetic(t *testing.T) {
+	c, err := compileComputedTopic("net", `-(solar_1_power + "a/b") * 2 / max(1, abs(c)) - 3`)
+	assert.NoError(t, err)
+
+	v, ok := c.Evaluate(lookupMap(map[string]float64{
+		"homeassistant/sensor/solar_1_power/state": 10,
+		"a/b":                          5,
+		"homeassistant/sensor/c/state": -2,
+	}))
+	assert.True(t, ok)
+	assert.Equal(t, -18.0, v) // -(15)*2/2 - 3
+}
+
+func TestComputedTopic_DivideByZeroSkipped(t *testing.T) {
+	c, err := compileComputedTopic("ratio", `"a" / "b"`)
+	assert.NoError(t, err)
+	_, ok := c.Evaluate(lookupMap(map[string]float64{"a": 1, "b": 0}))
+	assert.False(t, ok)
+}
+
+func TestComputedTopic_ParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"sum(",
+		"foo(a)",
+		"abs(a, b)",
+		"a_{1..3}",      // range outside a function
+		"sum(a_{3..1})", // backwards range
+		"a + + ",        // missing operand
+		`"unterminated`, // open topic string
+		"a b",           // trailing token
+		"a % b",         // unknown operator
+	} {
+		_, err := compileComputedTopic("t", expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestRegisterComputedTopic_RejectsCycles(t *testing.T) {
+	saved := computedTopics
+	defer func() { computedTopics = saved }()
+	computedTopics = nil
+
+	assert.Error(t, registerComputedTopic("x", `"x" + 1`))
+	assert.NoError(t, registerComputedTopic("y", `"z" + 1`))
+	assert.Error(t, registerComputedTopic("z", `"y" + 1`), "y was registered first and reads z")
+
+	assert.NoError(t, registerComputedTopic("w", `"y" * 2`))
+	assert.Equal(t, []string{"z"}, ComputedTopicInputs(), "computed inputs aren't subscribed")
+}
+
+func TestSumTopicsExpr(t *testing.T) {
+	c, err := compileComputedTopic("s", sumTopicsExpr([]string{"a/1", "a/2"}))
+	assert.NoError(t, err)
+	v, ok := c.Evaluate(lookupMap(map[string]float64{"a/1": 1, "a/2": 2}))
+	assert.True(t, ok)
+	assert.Equal(t, 3.0, v)
+}
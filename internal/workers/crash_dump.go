@@ -0,0 +1,172 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// defaultCrashDir is where crash dumps are written unless --crash-dir overrides it.
+const defaultCrashDir = "powerctl-crashes"
+
+// crashDumpKeep is how many crash dumps are kept; older ones are deleted.
+const crashDumpKeep = 20
+
+// TopicWorkerPanicEvent is the state topic of the event entity fired on each panic.
+const TopicWorkerPanicEvent = "powerctl/event/powerctl_worker_panic/state"
+
+// crashDumps captures panics recovered by superviseWorker. Process-wide like
+// workerStatus; nil (until main sets it) only logs the stack.
+var crashDumps *CrashDumps
+
+// CrashDumps writes a file for each recovered panic with everything needed to work out
+// what happened: the full stack, the latest DisplayData and the worker's last Decision.
+// It also fires the worker panic event so restarts are noticed in HA. Safe for
+// concurrent use.
+type CrashDumps struct {
+	dir    string
+	keep   int
+	status *WorkerStatus
+	sender *MQTTSender // nil skips the event
+
+	mu     sync.Mutex
+	latest *DisplayData
+}
+
+// crashDump is the file written for a panic.
+type crashDump struct {
+	Worker   string         `json:"worker"`
+	At       time.Time      `json:"at"`
+	Panic    string         `json:"panic"`
+	Version  string         `json:"version"`
+	Commit   string         `json:"commit"`
+	Stack    string         `json:"stack"`
+	Decision *Decision      `json:"decision,omitempty"`
+	Topics   map[string]any `json:"topics,omitempty"` // Latest value of each topic, as in /api/state
+}
+
+// NewCrashDumps writes up to keep dumps to dir, looking up decisions in status.
+func NewCrashDumps(dir string, keep int, status *WorkerStatus, sender *MQTTSender) *CrashDumps {
+	return &CrashDumps{dir: dir, keep: keep, status: status, sender: sender}
+}
+
+// Update stores the latest DisplayData for the next dump.
+func (c *CrashDumps) Update(data DisplayData) {
+	c.mu.Lock()
+	c.latest = &data
+	c.mu.Unlock()
+}
+
+// Capture records a panic in worker. Failures to write the dump are logged along with
+// the stack, so it is never lost.
+func (c *CrashDumps) Capture(worker string, panicValue any, stack []byte, now time.Time) {
+	if c == nil {
+		log.Printf("Panic in %s: %v\n%s", worker, panicValue, stack)
+		return
+	}
+
+	dump := crashDump{
+		Worker:  worker,
+		At:      now,
+		Panic:   fmt.Sprint(panicValue),
+		Version: version,
+		Commit:  buildCommit(),
+		Stack:   string(stack),
+	}
+	if d, ok := c.status.LastDecision(worker); ok {
+		dump.Decision = &d
+	}
+	c.mu.Lock()
+	if c.latest != nil {
+		dump.Topics = make(map[string]any, len(c.latest.TopicData))
+		for topic, td := range c.latest.TopicData {
+			dump.Topics[topic] = topicValue(td)
+		}
+	}
+	c.mu.Unlock()
+
+	path, err := c.write(dump)
+	if err != nil {
+		log.Printf("Crash dump for %s: %v\n%s", worker, err, stack)
+	} else {
+		log.Printf("Crash dump for %s written to %s\n", worker, path)
+	}
+	c.fire(dump, path)
+}
+
+// write saves dump under dir and deletes all but the newest keep dumps.
+func (c *CrashDumps) write(dump crashDump) (string, error) {
+	payload, err := json.MarshalIndent(dump, "", "  ")
+	if err != nil {
+		// A decision with values JSON can't hold (NaN); keep the rest
+		dump.Decision = nil
+		if payload, err = json.MarshalIndent(dump, "", "  "); err != nil {
+			return "", err
+		}
+	}
+	if err := os.MkdirAll(c.dir, 0o750); err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("crash-%s-%s.json", dump.At.UTC().Format("20060102T150405.000Z"), dump.Worker)
+	path := filepath.Join(c.dir, name)
+	if err := os.WriteFile(path, payload, 0o600); err != nil {
+		return "", err
+	}
+	c.rotate()
+	return path, nil
+}
+
+// rotate deletes the oldest dumps beyond keep. Names sort by time.
+func (c *CrashDumps) rotate() {
+	dumps, err := filepath.Glob(filepath.Join(c.dir, "crash-*.json"))
+	if err != nil || len(dumps) <= c.keep {
+		return
+	}
+	slices.Sort(dumps)
+	for _, old := range dumps[:len(dumps)-c.keep] {
+		if err := os.Remove(old); err != nil {
+			log.Printf("Crash dumps: remove %s: %v\n", old, err)
+		}
+	}
+}
+
+// fire publishes the worker panic event. The send is left to a goroutine: the panic may
+// have been in the sender worker, which only drains its channel once restarted.
+func (c *CrashDumps) fire(dump crashDump, path string) {
+	if c.sender == nil {
+		return
+	}
+	payload, err := json.Marshal(map[string]string{
+		"event_type": "worker_panic",
+		"worker":     dump.Worker,
+		"panic":      dump.Panic,
+		"file":       path,
+	})
+	if err != nil {
+		log.Printf("Crash dumps: encode event: %v\n", err)
+		return
+	}
+	go c.sender.Send(MQTTMessage{Topic: TopicWorkerPanicEvent, Payload: payload, QoS: 1})
+}
+
+// crashDumpWorker keeps the latest DisplayData for crash dumps.
+func crashDumpWorker(ctx context.Context, dataChan <-chan DisplayData, dumps *CrashDumps) {
+	log.Println("Crash dump worker started")
+
+	for {
+		select {
+		case data := <-dataChan:
+			dumps.Update(data)
+
+		case <-ctx.Done():
+			log.Println("Crash dump worker stopped")
+			return
+		}
+	}
+}
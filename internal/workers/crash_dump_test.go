@@ -0,0 +1,79 @@
+package workers
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ryansname/powerctl/internal/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrashDumps_Capture(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "crashes")
+	status := NewWorkerStatus()
+	status.RecordDecision("baseline-inverter-control", map[string]float64{"soc": 55}, map[string]int{"count": 2})
+	out := make(chan MQTTMessage, 1)
+	dumps := NewCrashDumps(dir, 5, status, NewMQTTSender(out))
+	dumps.Update(DisplayData{TopicData: map[string]any{
+		"sensor.battery_2_voltage": &stats.FloatTopicData{Current: 51.5},
+	}})
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	dumps.Capture("baseline-inverter-control", "boom", []byte("goroutine 1 [running]:"), now)
+
+	files, err := filepath.Glob(filepath.Join(dir, "crash-*.json"))
+	assert.NoError(t, err)
+	if !assert.Len(t, files, 1) {
+		return
+	}
+	raw, err := os.ReadFile(files[0])
+	assert.NoError(t, err)
+	var dump struct {
+		Worker   string         `json:"worker"`
+		Panic    string         `json:"panic"`
+		Stack    string         `json:"stack"`
+		Decision map[string]any `json:"decision"`
+		Topics   map[string]any `json:"topics"`
+	}
+	assert.NoError(t, json.Unmarshal(raw, &dump))
+	assert.Equal(t, "baseline-inverter-control", dump.Worker)
+	assert.Equal(t, "boom", dump.Panic)
+	assert.Equal(t, "goroutine 1 [running]:", dump.Stack)
+	assert.Equal(t, map[string]any{"count": 2.0}, dump.Decision["Outputs"])
+	assert.Equal(t, 51.5, dump.Topics["sensor.battery_2_voltage"])
+
+	select {
+	case msg := <-out:
+		assert.Equal(t, TopicWorkerPanicEvent, msg.Topic)
+		assert.Contains(t, string(msg.Payload), `"event_type":"worker_panic"`)
+	case <-time.After(time.Second):
+		t.Fatal("no worker panic event")
+	}
+}
+
+func TestCrashDumps_Rotate(t *testing.T) {
+	dir := t.TempDir()
+	dumps := NewCrashDumps(dir, 3, NewWorkerStatus(), nil)
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		dumps.Capture("worker", "boom", nil, start.Add(time.Duration(i)*time.Minute))
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "crash-*.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "crash-20260301T120200.000Z-worker.json"),
+		filepath.Join(dir, "crash-20260301T120300.000Z-worker.json"),
+		filepath.Join(dir, "crash-20260301T120400.000Z-worker.json"),
+	}, files, "the oldest dumps are deleted")
+}
+
+func TestCrashDumps_NilLogsOnly(t *testing.T) {
+	var dumps *CrashDumps
+	assert.NotPanics(t, func() {
+		dumps.Capture("worker", "boom", []byte("stack"), time.Now())
+	})
+}
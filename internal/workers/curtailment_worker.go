@@ -0,0 +1,160 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// TopicCurtailmentState is the retained state topic for the powerctl-owned curtailment
+// binary sensor. powerctl subscribes to it too (pre-seeded OFF in stats.go).
+const TopicCurtailmentState = "powerctl/binary_sensor/powerctl_curtailment/state"
+
+// curtailmentVoteSource is the source name this worker uses on the discharge vote channel.
+const curtailmentVoteSource = "curtailment"
+
+// curtailmentReserve is the PW2 backup reserve (%) held while curtailed, so the
+// Powerwall soaks up solar (and paid-for grid import) instead of exporting.
+const curtailmentReserve = 100.0
+
+// CurtailmentConfig configures curtailment mode. At least one of PriceTopic and
+// SignalTopic must be set for the worker to run.
+type CurtailmentConfig struct {
+	PriceTopic  string        // Export price ($/kWh); negative curtails. "" ignores price
+	SignalTopic string        // DNSP curtailment binary sensor, on = curtail. "" ignores it
+	ClearDelay  time.Duration // Both must be clear this long before curtailment ends
+}
+
+// Enabled reports whether a price or signal topic is configured.
+func (c CurtailmentConfig) Enabled() bool {
+	return c.PriceTopic != "" || c.SignalTopic != ""
+}
+
+// Topics returns the topics the curtailment worker reads.
+func (c CurtailmentConfig) Topics() []string {
+	var topics []string
+	if c.PriceTopic != "" {
+		topics = append(topics, c.PriceTopic)
+	}
+	if c.SignalTopic != "" {
+		topics = append(topics, c.SignalTopic)
+	}
+	return topics
+}
+
+// CurtailmentState holds debounce state between evaluations.
+type CurtailmentState struct {
+	Active     bool
+	clearSince time.Time // when the trigger last cleared while active; zero if still triggered
+}
+
+// curtailmentTrigger returns why curtailment is called for, or "" if it isn't.
+func curtailmentTrigger(config CurtailmentConfig, data DisplayData) string {
+	if config.SignalTopic != "" && data.GetBoolean(config.SignalTopic) {
+		return "DNSP curtailment signal"
+	}
+	if config.PriceTopic != "" {
+		if price := data.GetFloat(config.PriceTopic).Current; price < 0 {
+			return fmt.Sprintf("export price %.3f", price)
+		}
+	}
+	return ""
+}
+
+// EvaluateCurtailment enters curtailment as soon as it's triggered and leaves it once
+// the trigger has been clear for ClearDelay. Returns true if the mode changed.
+func EvaluateCurtailment(
+	state *CurtailmentState,
+	config CurtailmentConfig,
+	triggered bool,
+	now time.Time,
+) bool {
+	if triggered {
+		state.clearSince = time.Time{}
+		if state.Active {
+			return false
+		}
+		state.Active = true
+		return true
+	}
+
+	if !state.Active {
+		return false
+	}
+	if state.clearSince.IsZero() {
+		state.clearSince = now
+	}
+	if now.Sub(state.clearSince) < config.ClearDelay {
+		return false
+	}
+	state.Active = false
+	state.clearSince = time.Time{}
+	return true
+}
+
+// curtailmentWorker publishes curtailment mode while export is penalised (negative
+// price) or the DNSP asks sites to stop exporting. While on, baseline control turns
+// every Battery 2 inverter off, the dump loads run flat out, and discharge is vetoed
+// with the PW2 backup reserve raised to curtailmentReserve so it charges instead.
+func curtailmentWorker(
+	ctx context.Context,
+	dataChan <-chan DisplayData,
+	config CurtailmentConfig,
+	voteChan chan<- DischargeRequest,
+	sender *MQTTSender,
+	audit *AuditLog,
+) {
+	log.Println("Curtailment worker started")
+
+	var state *CurtailmentState
+	var last DischargeRequest
+
+	for {
+		select {
+		case data := <-dataChan:
+			// Resume from the retained state so a restart mid-curtailment stays curtailed
+			if state == nil {
+				state = &CurtailmentState{Active: data.GetBoolean(TopicCurtailmentState)}
+			}
+
+			trigger := curtailmentTrigger(config, data)
+			if EvaluateCurtailment(state, config, trigger != "", time.Now()) {
+				action := "cleared"
+				if state.Active {
+					action = "curtailing: " + trigger
+				}
+				log.Printf("Curtailment: %s\n", action)
+				audit.Record("curtailment", action, nil)
+			}
+
+			req := DischargeRequest{Source: curtailmentVoteSource, Want: VoteNoOpinion, Reason: "clear"}
+			if state.Active {
+				req = DischargeRequest{
+					Source:       curtailmentVoteSource,
+					Want:         VoteOff,
+					Reason:       "curtailed",
+					ReserveFloor: curtailmentReserve,
+				}
+			}
+			if req != last && sendWithin(ctx, voteChan, req, sendTimeout, "Curtailment vote") {
+				last = req
+			}
+
+			payload := "OFF"
+			if state.Active {
+				payload = "ON"
+			}
+			sender.Send(MQTTMessage{
+				Topic:   TopicCurtailmentState,
+				Payload: []byte(payload),
+				QoS:     1,
+				Retain:  true,
+			})
+
+		case <-ctx.Done():
+			log.Println("Curtailment worker stopped")
+			return
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package workers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeTestCurtailmentConfig() CurtailmentConfig {
+	return CurtailmentConfig{
+		PriceTopic:  "ha/sensor/export_price/state",
+		SignalTopic: "ha/binary_sensor/dnsp_curtailment/state",
+		ClearDelay:  10 * time.Minute,
+	}
+}
+
+func TestCurtailmentTrigger(t *testing.T) {
+	config := makeTestCurtailmentConfig()
+	data := DisplayData{
+		TopicData: map[string]any{
+			config.PriceTopic:  makeFloatTopic(0.08),
+			config.SignalTopic: makeBoolTopic(false, "off"),
+		},
+	}
+	assert.Equal(t, "", curtailmentTrigger(config, data))
+
+	data.TopicData[config.PriceTopic] = makeFloatTopic(-0.02)
+	assert.Equal(t, "export price -0.020", curtailmentTrigger(config, data))
+
+	data.TopicData[config.SignalTopic] = makeBoolTopic(true, "on")
+	assert.Equal(t, "DNSP curtailment signal", curtailmentTrigger(config, data))
+
+	// An unconfigured signal isn't read
+	config.SignalTopic = ""
+	assert.Equal(t, "export price -0.020", curtailmentTrigger(config, data))
+}
+
+func TestEvaluateCurtailment_EntersImmediatelyAndClearsAfterDelay(t *testing.T) {
+	config := makeTestCurtailmentConfig()
+	state := &CurtailmentState{}
+	t0 := time.Date(2025, 11, 2, 13, 0, 0, 0, time.UTC)
+
+	assert.True(t, EvaluateCurtailment(state, config, true, t0))
+	assert.True(t, state.Active)
+
+	assert.False(t, EvaluateCurtailment(state, config, false, t0.Add(time.Minute)))
+	assert.False(t, EvaluateCurtailment(state, config, false, t0.Add(10*time.Minute)))
+	assert.True(t, state.Active)
+
+	assert.True(t, EvaluateCurtailment(state, config, false, t0.Add(11*time.Minute)))
+	assert.False(t, state.Active)
+}
+
+func TestEvaluateCurtailment_RetriggerRestartsClearDelay(t *testing.T) {
+	config := makeTestCurtailmentConfig()
+	state := &CurtailmentState{Active: true}
+	t0 := time.Date(2025, 11, 2, 13, 0, 0, 0, time.UTC)
+
+	EvaluateCurtailment(state, config, false, t0)
+	EvaluateCurtailment(state, config, true, t0.Add(5*time.Minute))
+	assert.False(t, EvaluateCurtailment(state, config, false, t0.Add(12*time.Minute)))
+	assert.True(t, state.Active)
+}
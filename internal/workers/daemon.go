@@ -0,0 +1,1758 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/ryansname/powerctl/internal/ha"
+	"github.com/ryansname/powerctl/internal/stats"
+	"github.com/ryansname/powerctl/sankey"
+)
+
+// SensorMessage represents an MQTT message with topic and value
+type SensorMessage struct {
+	Topic string
+	Value string
+}
+
+// DisplayData holds all data needed for display
+type DisplayData struct {
+	TopicData   map[string]any
+	Percentiles map[PercentileKey]float64
+}
+
+// lookup returns a topic's data, warning once if the topic was never subscribed.
+func (d *DisplayData) lookup(topic string) any {
+	td, ok := d.TopicData[topic]
+	if !ok && d.TopicData != nil {
+		warnUnsubscribedTopic(topic)
+	}
+	return td
+}
+
+// GetFloat extracts FloatTopicData from DisplayData
+// Returns a zero-valued FloatTopicData if topic doesn't exist or isn't a float topic
+func (d *DisplayData) GetFloat(topic string) *stats.FloatTopicData {
+	if td, ok := d.lookup(topic).(*stats.FloatTopicData); ok {
+		return td
+	}
+	return &stats.FloatTopicData{}
+}
+
+// GetPercentile returns a percentile value for a topic.
+// Panics if the topic/percentile/window combination is not in requiredPercentiles.
+func (d *DisplayData) GetPercentile(topic string, percentile int, window time.Duration) float64 {
+	key := PercentileKey{topic, percentile, window}
+	if value, exists := d.Percentiles[key]; exists {
+		return value
+	}
+
+	// Slow path: diagnose why it's missing
+	specs, topicExists := requiredPercentiles[topic]
+	if !topicExists {
+		panic(fmt.Sprintf("GetPercentile: topic %q is not in requiredPercentiles registry", topic))
+	}
+
+	for _, spec := range specs {
+		if spec.Percentile == percentile && spec.Window == window {
+			panic(fmt.Sprintf("GetPercentile: P%d with %v window is registered for %q but was not calculated", percentile, window, topic))
+		}
+	}
+
+	panic(fmt.Sprintf("GetPercentile: P%d with %v window is not registered for topic %q (add it to requiredPercentiles)", percentile, window, topic))
+}
+
+// LookupPercentile returns a percentile value for a topic, or false until the topic has
+// readings to calculate it from.
+func (d *DisplayData) LookupPercentile(topic string, percentile int, window time.Duration) (float64, bool) {
+	value, ok := d.Percentiles[PercentileKey{topic, percentile, window}]
+	return value, ok
+}
+
+// GetString extracts a string value from DisplayData.
+// Trims surrounding quotes in case the MQTT payload is JSON-encoded.
+// Also works for boolean and JSON document topics, returning the raw value (e.g. "off").
+func (d *DisplayData) GetString(topic string) string {
+	switch td := d.lookup(topic).(type) {
+	case *stats.StringTopicData:
+		return strings.Trim(td.Current, "\"")
+	case *stats.BooleanTopicData:
+		return strings.Trim(td.Raw, "\"")
+	case *stats.JSONTopicData:
+		return td.Raw
+	}
+	return ""
+}
+
+// GetBoolean extracts a boolean value from DisplayData.
+func (d *DisplayData) GetBoolean(topic string) bool {
+	if td, ok := d.lookup(topic).(*stats.BooleanTopicData); ok {
+		return td.Current
+	}
+	return false
+}
+
+// SumTopics calculates the sum of all specified topics
+func (d *DisplayData) SumTopics(topics []string) float64 {
+	var total float64
+	for _, topic := range topics {
+		total += d.GetFloat(topic).Current
+	}
+	return total
+}
+
+// GetJSON parses a JSON string topic into the provided pointer.
+// Go doesn't support generic methods, so caller passes pointer to result.
+// Panics if JSON unmarshaling fails.
+func (d *DisplayData) GetJSON(topic string, result any) {
+	jsonStr := d.GetString(topic)
+	if err := json.Unmarshal([]byte(jsonStr), result); err != nil {
+		panic(fmt.Sprintf("GetJSON: failed to unmarshal topic %q: %v", topic, err))
+	}
+}
+
+// runDaemon runs the control daemon (the `run` subcommand). It returns 1 when shutting
+// down because a worker failed or the watchdog fired, so a service manager (or the
+// add-on watchdog) restarts it.
+func runDaemon(args []string) int {
+	// As a Home Assistant add-on, options and the broker come from the Supervisor
+	if runningAsAddon() {
+		addonArgs, err := setupAddon(context.Background())
+		if err != nil {
+			log.Fatalf("Add-on setup failed: %v", err)
+		}
+		log.Println("Running as a Home Assistant add-on")
+		args = append(addonArgs, args...)
+	}
+
+	// Parse command line flags
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	forceEnable := fs.Bool("force-enable", false, "Bypass powerctl_enabled switch")
+	debugMode := fs.Bool("debug", false, "Enable debug introspection worker")
+	multiplusOnly := fs.Bool("multiplus-only", false, "Drop all outgoing MQTT messages whose topic is not under powerhouse_3/")
+	auditLogPath := fs.String("audit-log", defaultAuditLogPath, "Write control decisions to the audit table of this SQLite database (empty disables)")
+	crashDir := fs.String("crash-dir", defaultCrashDir, "Write a dump (stack, latest data, last decision) for each worker panic to this directory, keeping the newest 20")
+	counterStatePath := fs.String("counter-state", stats.DefaultCounterStatePath, "Keep energy counter reset offsets in this JSON file across restarts (empty keeps them in memory)")
+	summaryNotify := fs.String("summary-notify", "", "Send the daily summary to this notify entity (e.g. notify.mobile_app_phone)")
+	excessPolicyPath := fs.String("excess-policy", "", "Load the dump load excess policy from this JSON file instead of the built-in default")
+	touTariffPath := fs.String("tou-tariff", "", "Load the Powerwall discharge tariff template from this JSON file (missing fields keep the built-in defaults)")
+	touSchedulePath := fs.String("tou-schedule", "", "Load the TOU discharge scheduler windows, SOC levels and price gate from this JSON file (missing fields keep the built-in defaults)")
+	thresholdProfilesPath := fs.String("threshold-profiles", "", "Load seasonal / time-of-day baseline threshold profiles from this JSON file")
+	serviceCalls := fs.String("service-calls", "proxy", "How HA service calls are made: proxy (MQTT call_service topic) or native (REST API via HA_URL/HA_TOKEN, falling back to the proxy)")
+	serviceCallInterval := fs.Duration("service-call-interval", 2*time.Second, "Minimum time between service calls to the same entity; faster calls are coalesced to the latest (0 disables)")
+	sendQueueSize := fs.Int("send-queue-size", 1000, "Max outgoing MQTT messages held while disconnected; the oldest lowest-priority message is evicted when full")
+	topicQoSPath := fs.String("topic-qos", "", "Load per-topic subscription QoS and publish QoS/retain overrides from this JSON file")
+	mqttSessionDir := fs.String("mqtt-session-dir", "", "Keep a persistent MQTT session, storing in-flight messages in this directory (empty uses a clean session)")
+	watchdogExit := fs.Bool("watchdog-exit", false, "Shut down when the watchdog finds a stuck worker (for a service manager to restart) instead of only alerting")
+	teslaAPI := fs.String("tesla-api", "ha", "How the Powerwall is controlled: ha (tesla_custom integration) or fleet (Tesla Fleet API via TESLA_CLIENT_ID/TESLA_REFRESH_TOKEN)")
+	failsafe := fs.String("failsafe", "none", "What to do after --failsafe-after without the MQTT broker: none, queue-off (queue inverter turn-offs for reconnect) or actuate (turn inverters off via Modbus, Shelly or the HA REST API)")
+	failsafeAfter := fs.Duration("failsafe-after", 10*time.Minute, "How long the MQTT broker may be unreachable before --failsafe acts")
+	failsafeNotify := fs.String("failsafe-notify", "", "Alert this notify entity when the broker returns after the failsafe tripped")
+	leaderElection := fs.Bool("leader-election", false, "Run as one of several redundant instances: only the leader (holding the retained powerctl/leader/claim) actuates, the rest stay on standby")
+	observe := fs.Bool("observe", false, "Run read-only beside the active instance: every worker runs but actuation is held back and published to the powerctl_observer_* sensors")
+	updateCheck := fs.Bool("update-check", false, "Check the GitHub release feed every 6h and raise the powerctl_update_available binary sensor when a newer release is out")
+	batteryHardwarePath := fs.String("battery-hardware", "", "Load per-battery hardware (charge controller setpoint, temperature sensors, BMS cells, inverter Modbus/Shelly targets and power limits) from this JSON file")
+	exportPriceEntity := fs.String("export-price", "", "Dynamic tariff export price sensor ($/kWh, e.g. sensor.amber_feed_in_price) for the PriceExport baseline mode")
+	chargePowerEntity := fs.String("charge-power", "", "Battery 2 charge controller output sensor (W, e.g. sensor.solar_5_solar_power); sizes overflow from wasted charge power instead of SOC")
+	gridPowerEntity := fs.String("grid-power", "", "Site grid power sensor (W, positive = import, e.g. sensor.home_sweet_home_site_power) for the GridPID baseline mode and the export limit")
+	exportLimit := fs.Int("export-limit", 5000, "Cap on measured grid export (W, 1m P99) that cuts Battery 2 inverters; needs --grid-power, 0 disables")
+	importPriceEntity := fs.String("import-price", "", "Dynamic tariff import price sensor ($/kWh, e.g. sensor.amber_general_price) for the overnight grid charge scheduler")
+	stormWarningEntity := fs.String("storm-warning", "", "Severe weather warning binary sensor (e.g. binary_sensor.bom_severe_weather) that turns storm mode on")
+	curtailmentSignalEntity := fs.String("curtailment-signal", "", "DNSP curtailment binary sensor (on = curtail export, e.g. binary_sensor.sapn_curtailment); curtailment also follows a negative --export-price")
+	discoverInverters := fs.String("discover-inverters", "", "Build Battery 2 inverters from HA switch discovery configs matching this glob (e.g. powerhouse_inverter_*_switch_0)")
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println("Starting powerctl...")
+
+	if *sendQueueSize < 1 {
+		log.Fatal("--send-queue-size must be at least 1")
+	}
+	if *exportLimit < 0 {
+		log.Fatal("--export-limit must not be negative")
+	}
+
+	failsafePolicy, failsafeErr := ParseFailsafePolicy(*failsafe)
+	if failsafeErr != nil {
+		log.Fatal(failsafeErr)
+	}
+
+	if *forceEnable {
+		log.Println("WARNING: --force-enable active, ignoring powerctl_enabled switch")
+	}
+
+	var observer *Observer
+	if *observe {
+		if *leaderElection {
+			log.Fatal("--observe and --leader-election are mutually exclusive")
+		}
+		log.Println("WARNING: --observe active, no commands will be sent")
+		observer = NewObserver()
+	}
+
+	if *multiplusOnly {
+		log.Println("WARNING: --multiplus-only active, only powerhouse_3/ outgoing messages will be sent")
+	}
+
+	// Load .env file
+	if err := godotenv.Load(); err != nil {
+		log.Printf("Warning: Error loading .env file: %v\n", err)
+	}
+
+	// Get MQTT credentials from environment
+	mqttUsername := os.Getenv("MQTT_USERNAME")
+	mqttPassword := os.Getenv("MQTT_PASSWORD")
+
+	if mqttUsername == "" || mqttPassword == "" {
+		log.Fatal("MQTT_USERNAME and MQTT_PASSWORD must be set in .env file")
+	}
+
+	// Redundant instances are told apart by POWERCTL_INSTANCE_ID, defaulting to the hostname
+	var leader *LeaderElection
+	instanceID := os.Getenv("POWERCTL_INSTANCE_ID")
+	if *leaderElection {
+		if instanceID == "" {
+			hostname, err := os.Hostname()
+			if err != nil {
+				log.Fatalf("--leader-election needs POWERCTL_INSTANCE_ID or a hostname: %v", err)
+			}
+			instanceID = hostname
+		}
+		leader = NewLeaderElection(LeaderConfig{InstanceID: instanceID, Lease: 30 * time.Second, RenewInterval: 10 * time.Second})
+	}
+
+	// Get MQTT client ID from environment, default to "powerctl" (per instance with
+	// leader election or observing, as the broker disconnects duplicate client IDs)
+	mqttClientID := os.Getenv("MQTT_CLIENT_ID")
+	if mqttClientID == "" {
+		mqttClientID = deviceIDPowerctl
+		if leader != nil {
+			mqttClientID += "-" + instanceID
+		}
+		if observer != nil {
+			mqttClientID += "-observer"
+		}
+	}
+
+	// Get MQTT host from environment, default to "homeassistant.lan"
+	mqttHost := os.Getenv("MQTT_HOST")
+	if mqttHost == "" {
+		mqttHost = "homeassistant.lan"
+	}
+
+	// Get MQTT port from environment, default to 1883
+	mqttPort := 1883
+	if portStr := os.Getenv("MQTT_PORT"); portStr != "" {
+		p, err := strconv.Atoi(portStr)
+		if err != nil {
+			log.Fatalf("MQTT_PORT must be a valid integer: %v", err)
+		}
+		mqttPort = p
+	}
+
+	// Solcast fetcher is optional: without credentials the forecast comes from the HA integration
+	solcastConfig := SolcastConfig{
+		APIKey:     os.Getenv("SOLCAST_API_KEY"),
+		ResourceID: os.Getenv("SOLCAST_RESOURCE_ID"),
+		Interval:   3 * time.Hour,
+	}
+	solcastEnabled := solcastConfig.APIKey != "" && solcastConfig.ResourceID != ""
+
+	// Metrics export is optional: only runs with a line protocol write URL
+	metricsConfig := MetricsExportConfig{
+		WriteURL:       os.Getenv("METRICS_WRITE_URL"),
+		Token:          os.Getenv("METRICS_TOKEN"),
+		SampleInterval: 10 * time.Second,
+		BatchSize:      5000,
+		FlushInterval:  time.Minute,
+	}
+
+	// The control API is optional: only runs with a listen address, and always needs a token
+	apiConfig := APIConfig{Addr: os.Getenv("API_ADDR"), Token: os.Getenv("API_TOKEN")}
+	if apiConfig.Addr != "" && apiConfig.Token == "" {
+		log.Fatal("API_ADDR requires API_TOKEN")
+	}
+
+	// Native service calls talk to the HA REST API directly, with the MQTT proxy as fallback
+	var haClient *ha.Client
+	switch *serviceCalls {
+	case "proxy":
+	case "native":
+		haURL, haToken := os.Getenv("HA_URL"), os.Getenv("HA_TOKEN")
+		if haURL == "" || haToken == "" {
+			log.Fatal("--service-calls=native requires HA_URL and HA_TOKEN")
+		}
+		haClient = ha.NewClient(haURL, haToken)
+	default:
+		log.Fatalf("--service-calls must be proxy or native, got %q", *serviceCalls)
+	}
+
+	// The Powerwall site is driven through HA unless the Fleet API is configured
+	teslaSiteID := os.Getenv("TESLA_SITE_ID")
+	if teslaSiteID == "" {
+		teslaSiteID = defaultTeslaSiteID
+	}
+	switch *teslaAPI {
+	case "ha":
+	case "fleet":
+		if os.Getenv("TESLA_CLIENT_ID") == "" || os.Getenv("TESLA_REFRESH_TOKEN") == "" {
+			log.Fatal("--tesla-api=fleet requires TESLA_CLIENT_ID and TESLA_REFRESH_TOKEN")
+		}
+	default:
+		log.Fatalf("--tesla-api must be ha or fleet, got %q", *teslaAPI)
+	}
+
+	// Create context for lifecycle management
+	ctx, cancel := context.WithCancel(context.Background())
+
+	battery2, battery3 := DefaultBatteryConfigs()
+
+	// Optionally replace the static Battery 2 inverter list with switches found via HA discovery.
+	if *discoverInverters != "" {
+		found, err := discoverInverterSwitches(ctx, mqttHost, mqttPort, mqttUsername, mqttPassword, mqttClientID, *discoverInverters)
+		switch {
+		case err != nil:
+			log.Printf("Inverter discovery failed, using static list: %v\n", err)
+		case len(found) == 0:
+			log.Printf("Inverter discovery found no switches matching %q, using static list\n", *discoverInverters)
+		default:
+			log.Printf("Inverter discovery found %d switches: %s\n", len(found), strings.Join(found, ", "))
+			applyDiscoveredInverters(&battery2, found)
+		}
+	}
+
+	if *batteryHardwarePath != "" {
+		hardware, err := LoadBatteryHardware(*batteryHardwarePath)
+		if err == nil {
+			err = applyBatteryHardware(hardware, &battery2, &battery3)
+		}
+		if err == nil {
+			err = errors.Join(validateBatteryConfig(battery2), validateBatteryConfig(battery3))
+		}
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to load battery hardware: %v", err)
+		}
+		log.Printf("Loaded battery hardware from %s\n", *batteryHardwarePath)
+	}
+
+	batteries := []BatteryConfig{battery2, battery3}
+
+	// Collect the HA statestream topics each worker reads
+	topicRegistry := NewTopicRegistry()
+	for _, b := range batteries {
+		registerTopicUnit(b.BatteryVoltageTopic, UnitV)
+		for topic, rule := range b.PlausibilityRules() {
+			registerPlausibilityRule(topic, rule)
+		}
+		topicRegistry.Add(b.Name+"-calibration", b.Topics()...)
+		topicRegistry.Add(b.Name+"-soc", b.Topics()...)
+		if b.ChargeLimit != nil {
+			topicRegistry.Add(b.Name+"-charge-limit", b.BatteryVoltageTopic, b.ChargeLimit.SetpointStateTopic())
+		}
+		if b.Temperature != nil {
+			topicRegistry.Add(b.Name+"-temperature", b.Temperature.Topics...)
+			if b.ChargeLimit != nil {
+				topicRegistry.Add(b.Name+"-charge-limit", temperatureChargeDerateTopic(b.Name))
+			}
+			// Derating is read back like island mode; seed "no derating" for the first run
+			preSeededTopics = append(preSeededTopics,
+				SensorMessage{Topic: temperatureDischargeDerateTopic(b.Name), Value: "100"},
+				SensorMessage{Topic: temperatureChargeDerateTopic(b.Name), Value: "100"},
+			)
+			registerTopicUnit(temperatureDischargeDerateTopic(b.Name), UnitPercent)
+			registerTopicUnit(temperatureChargeDerateTopic(b.Name), UnitPercent)
+		}
+		if len(b.InflowPowerTopics) > 0 && len(b.OutflowPowerTopics) > 0 {
+			runtime := b.RuntimeConfig()
+			runtime.RegisterPercentiles()
+			topicRegistry.Add(b.Name+"-runtime", runtime.Topics()...)
+		}
+		if b.BMS != nil {
+			topicRegistry.Add(b.Name+"-bms", b.BMS.CellVoltageTopics...)
+			topicRegistry.Add(b.Name+"-bms", bmsCellUndervoltageTopic(b.Name))
+			preSeededTopics = append(preSeededTopics, SensorMessage{Topic: bmsCellUndervoltageTopic(b.Name), Value: "OFF"})
+		}
+	}
+	excessPolicy := DefaultExcessPolicy
+	if *excessPolicyPath != "" {
+		loaded, err := LoadExcessPolicy(*excessPolicyPath)
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to load excess policy: %v", err)
+		}
+		excessPolicy = loaded
+		log.Printf("Loaded excess policy from %s\n", *excessPolicyPath)
+	}
+	excessPolicy.RegisterPercentiles()
+	topicRegistry.Add("power-excess", excessPolicy.Topics()...)
+
+	// Charge limiters read a 5m P99 of battery voltage (registered before statsWorker starts)
+	for _, b := range batteries {
+		if b.ChargeLimit != nil {
+			registerPercentile(b.BatteryVoltageTopic, PercentileSpec{stats.P99, stats.Window5Min})
+		}
+	}
+
+	// Self-published battery topics that won't exist on first startup. No efficiency
+	// estimate until two full calibrations have been seen (0 falls back to
+	// ConversionLossRate), and the SOH cycle history starts empty until the first
+	// empty→full cycle is measured.
+	for _, b := range batteries {
+		if b.UseMeasuredEfficiency {
+			registerSelfPublishedFloat(b.EfficiencyTopic())
+		}
+		if len(b.OutflowEnergyTopics) > 0 {
+			full := b.FullCalibrationTopics()
+			registerSelfPublishedFloat(full.Inflows)
+			registerSelfPublishedFloat(full.Outflows)
+		}
+		if b.EmptyVoltageThreshold > 0 {
+			registerSelfPublishedString(sohHistoryTopic(b.Name), "[]")
+		}
+	}
+
+	// Computed topics evaluated by statsWorker (registered before it starts)
+	for _, c := range []struct{ topic, expr string }{
+		{TopicPowerhouseTotalOut, sumTopicsExpr(battery2.OutflowPowerTopics)},
+		{TopicSolar34Power, sumTopicsExpr(battery3.InflowPowerTopics)},
+	} {
+		if err := registerComputedTopic(c.topic, c.expr); err != nil {
+			cancel()
+			log.Fatalf("Invalid computed topic: %v", err)
+		}
+	}
+	topicRegistry.Add("computed-topics", ComputedTopicInputs()...)
+
+	// Build inverter controller configs and add their topics
+	baselineConfig := BuildBaselineInverterConfig(battery2, battery3)
+	dynamicConfig := BuildDynamicInverterConfig(battery2, battery3)
+	if solcastEnabled {
+		baselineConfig.Input.DetailedForecastTopic = TopicSolcastForecast
+		dynamicConfig.Input.DetailedForecastTopic = TopicSolcastForecast
+		topicRegistry.Add("solcast-forecast", SolcastTopics()...)
+	}
+	exportPriceTopic, err := entityFlagTopic("export-price", *exportPriceEntity)
+	if err != nil {
+		cancel()
+		log.Fatal(err)
+	}
+	baselineConfig.Input.ExportPriceTopic = exportPriceTopic
+	if baselineConfig.Input.ChargePowerTopic, err = entityFlagTopic("charge-power", *chargePowerEntity); err != nil {
+		cancel()
+		log.Fatal(err)
+	}
+	if baselineConfig.Input.GridPowerTopic, err = entityFlagTopic("grid-power", *gridPowerEntity); err != nil {
+		cancel()
+		log.Fatal(err)
+	}
+	baselineConfig.ExportLimitWatts = float64(*exportLimit)
+	if battery2.Temperature != nil {
+		baselineConfig.Input.DischargeDerateTopic = temperatureDischargeDerateTopic(battery2.Name)
+	}
+	if battery2.BMS != nil {
+		baselineConfig.Input.CellUndervoltageTopic = bmsCellUndervoltageTopic(battery2.Name)
+	}
+
+	// PW2 coordinator caps the Battery 2 inverters while they would charge the Powerwall;
+	// the cap is read back like island mode, seeded uncapped for the first run
+	coordinatorConfig := PW2CoordinatorConfig{
+		InverterPowerTopic: TopicPowerhouseTotalOut,
+		MaxInverters:       len(baselineConfig.Battery2.Inverters),
+		WattsPerInverter:   baselineConfig.WattsPerInverter,
+		ChargeTolerance:    100,
+		RaiseAfter:         2 * time.Minute,
+	}
+	topicRegistry.Add("pw2-coordinator", coordinatorConfig.Topics()...)
+	baselineConfig.Input.InverterCapTopic = TopicDIYInverterCap
+	preSeededTopics = append(preSeededTopics,
+		SensorMessage{Topic: TopicDIYInverterCap, Value: strconv.Itoa(coordinatorConfig.MaxInverters)})
+	topicRegistry.Add("baseline-inverter-control", baselineConfig.Input.Topics()...)
+	// Low-voltage recovery reads a 5m P50 of Battery 2 voltage
+	registerPercentile(baselineConfig.Input.Battery2VoltageTopic, PercentileSpec{stats.P50, stats.Window5Min})
+	// Export limit reads a 1m P1 of grid power (the P99 of export)
+	if baselineConfig.Input.GridPowerTopic != "" {
+		registerPercentile(baselineConfig.Input.GridPowerTopic, PercentileSpec{stats.P1, stats.Window1Min})
+	}
+	if *thresholdProfilesPath != "" {
+		profiles, err := LoadThresholdProfiles(*thresholdProfilesPath, baselineConfig)
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to load threshold profiles: %v", err)
+		}
+		baselineConfig.Profiles = profiles
+		log.Printf("Loaded %d threshold profiles from %s\n", len(profiles.Profiles), *thresholdProfilesPath)
+	}
+	topicRegistry.Add("dynamic-inverter-control", dynamicConfig.Input.Topics()...)
+
+	// Dump load enabler reads each load's state; EV charging reads the car and charger
+	dumpLoads := []DumpLoad{MinerDumpLoad}
+	topicRegistry.Add("dump-load-enabler", DumpLoadTopics(dumpLoads)...)
+	topicRegistry.Add("ev-charging", EVChargingTopics()...)
+
+	// Energy-today totals integrated by statsWorker (registered before it starts)
+	summaryConfig := DailySummaryConfig{
+		SolarEnergyTopic:    EnergyTodaySpec{ID: solarEnergyTodayID}.EnergyTodayTopic(),
+		InverterEntityIDs:   battery2.InverterSwitchIDs,
+		InverterStateTopics: baselineConfig.Input.InverterStateTopics,
+		NotifyEntity:        *summaryNotify,
+	}
+	for _, b := range batteries {
+		summary := SummaryBattery{Name: b.Name}
+		if len(b.InflowPowerTopics) > 0 {
+			spec := EnergyTodaySpec{
+				ID:          NewTopicBuilder(b.Name).ObjectID("charged_today"),
+				Name:        b.Name + " Charged Today",
+				PowerTopics: b.InflowPowerTopics,
+			}
+			registerEnergyToday(spec)
+			summary.ChargedTopic = spec.EnergyTodayTopic()
+		}
+		if len(b.OutflowPowerTopics) > 0 {
+			spec := EnergyTodaySpec{
+				ID:          NewTopicBuilder(b.Name).ObjectID("discharged_today"),
+				Name:        b.Name + " Discharged Today",
+				PowerTopics: b.OutflowPowerTopics,
+			}
+			registerEnergyToday(spec)
+			summary.DischargedTopic = spec.EnergyTodayTopic()
+		}
+		summaryConfig.Batteries = append(summaryConfig.Batteries, summary)
+	}
+	topicRegistry.Add("energy-today", EnergyTodayTopics()...)
+	topicRegistry.Add("daily-summary", summaryConfig.Topics()...)
+
+	// powerctl and powerhouse inverter enable switches (sender, interceptor, command tracker)
+	topicRegistry.Add("mqtt-sender-worker", TopicPowerctlEnabledState)
+	interlockConfig := SafetyInterlockConfig{
+		Batteries:        []InterlockBattery{battery2.InterlockBattery(), battery3.InterlockBattery()},
+		WattsPerInverter: baselineConfig.WattsPerInverter,
+		MaxTransferPower: baselineConfig.MaxTransferPower,
+		SolarTopic:       baselineConfig.Input.Solar1PowerTopic,
+		AbsorbSOCTopic:   baselineConfig.Input.Battery3SOCTopic,
+		AbsorbBelowSOC:   multiplusAbsorbSOC,
+	}
+	interlockConfig.RegisterPercentiles()
+	topicRegistry.Add("mqtt-sender-worker", interlockConfig.Topics()...)
+	topicRegistry.Add("inverter-interceptor", TopicPowerhouseInvertersEnabledState)
+
+	// PW2 discharge, operation mode, and expecting power cuts state topics
+	topicRegistry.Add("pw2-discharge", TopicPW2DischargeMode, TopicPW2OperationMode, TopicPW2BackupReserve)
+	touTariff := DefaultTOUTariffConfig
+	if *touTariffPath != "" {
+		loaded, err := LoadTOUTariffConfig(*touTariffPath)
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to load TOU tariff: %v", err)
+		}
+		touTariff = loaded
+		log.Printf("Loaded TOU tariff from %s\n", *touTariffPath)
+	}
+	if touTariff.PriceTopic != "" {
+		topicRegistry.Add("pw2-discharge", touTariff.PriceTopic)
+	}
+	topicRegistry.Add("expecting-power-cuts", TopicExpectingPowerCutsState, TopicHotWaterCylinderState)
+
+	// TOU discharge scheduler
+	touConfig := DefaultTOUSchedulerConfig
+	if *touSchedulePath != "" {
+		loaded, err := LoadTOUSchedulerConfig(*touSchedulePath)
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to load TOU schedule: %v", err)
+		}
+		touConfig = loaded
+		log.Printf("Loaded TOU schedule from %s\n", *touSchedulePath)
+	}
+	topicRegistry.Add("tou-discharge", touConfig.Topics()...)
+
+	// Grid charge scheduler: overnight Powerwall charging when cheap. Only runs with an
+	// import price entity
+	importPriceTopic, err := entityFlagTopic("import-price", *importPriceEntity)
+	if err != nil {
+		cancel()
+		log.Fatal(err)
+	}
+	gridChargeConfig := GridChargeConfig{
+		Window:     DischargeWindow{StartMinute: 0, EndMinute: 7 * 60},
+		PriceTopic: importPriceTopic,
+		MaxPrice:   0.15,
+		TargetSOC:  80,
+	}
+	if gridChargeConfig.PriceTopic != "" {
+		topicRegistry.Add("grid-charge", gridChargeConfig.Topics()...)
+		preSeededTopics = append(preSeededTopics, SensorMessage{Topic: TopicGridChargeState, Value: "off"})
+	}
+
+	// Storm mode only runs with a severe weather warning entity
+	stormWarningTopic, err := entityFlagTopic("storm-warning", *stormWarningEntity)
+	if err != nil {
+		cancel()
+		log.Fatal(err)
+	}
+	stormConfig := StormModeConfig{
+		WarningTopic: stormWarningTopic,
+		ClearDelay:   2 * time.Hour,
+	}
+	if stormConfig.WarningTopic != "" {
+		topicRegistry.Add("storm-mode", stormConfig.Topics()...)
+	}
+
+	// Curtailment only runs with an export price or a DNSP curtailment signal entity
+	curtailmentSignalTopic, err := entityFlagTopic("curtailment-signal", *curtailmentSignalEntity)
+	if err != nil {
+		cancel()
+		log.Fatal(err)
+	}
+	curtailmentConfig := CurtailmentConfig{
+		PriceTopic:  exportPriceTopic,
+		SignalTopic: curtailmentSignalTopic,
+		ClearDelay:  10 * time.Minute,
+	}
+	if curtailmentConfig.Enabled() {
+		topicRegistry.Add("curtailment", curtailmentConfig.Topics()...)
+	}
+
+	// Lounge AC, temperature, and sun topics for tile color worker
+	topicRegistry.Add("ac-tile", TopicLoungeACAction, TopicLoungeACState, TopicTemperatureInside, TopicSunState)
+
+	// Inverter 10 (Multiplus) setpoint command topic, echoed back for dynamic control
+	topicRegistry.Add("dynamic-inverter-control", TopicInverter10SetpointCmd)
+
+	// Powerhouse cooling topics
+	topicRegistry.Add("powerhouse-cooling", TopicPowerhouseBlowerTemp, TopicPowerhouseBlowerSwitch0State)
+
+	// Water tank, pump control and lights topics
+	topicRegistry.Add("tank-levels", TankTopics()...)
+	topicRegistry.Add("pump-control", PumpTopics()...)
+	topicRegistry.Add("lights", LightsTopics()...)
+
+	if err := topicRegistry.Validate(); err != nil {
+		cancel()
+		log.Fatalf("Invalid topic declarations:\n%v", err)
+	}
+	if err := validateSelfPublishedTopics(batteries, topicRegistry.Topics()); err != nil {
+		cancel()
+		log.Fatalf("Invalid self-published topics:\n%v", err)
+	}
+	if err := validateTopicUnits(topicUnits); err != nil {
+		cancel()
+		log.Fatalf("Invalid topic units:\n%v", err)
+	}
+	if err := validatePlausibilityRules(plausibilityRules); err != nil {
+		cancel()
+		log.Fatalf("Invalid plausibility rules:\n%v", err)
+	}
+	haTopics := topicRegistry.Topics()
+
+	// No separate Victron route needed: HA reads Cerbo N/ topics directly from the broker.
+
+	// Workers are declared below and launched together by supervisor.Start
+	supervisor := NewSupervisor(cancel, workerStatus)
+
+	// Launch audit log writer (control decisions; read back with `powerctl audit`)
+	auditLog := NewAuditLog(*auditLogPath)
+	if auditLog != nil {
+		supervisor.Go("audit-log", nil, auditLog.Run)
+	}
+
+	var topicQoS TopicQoSConfig
+	if *topicQoSPath != "" {
+		loaded, err := LoadTopicQoSConfig(*topicQoSPath)
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to load topic QoS config: %v", err)
+		}
+		topicQoS = loaded
+		log.Printf("Loaded topic QoS config from %s\n", *topicQoSPath)
+	}
+
+	// Create channels for communication between workers
+	msgChan := make(chan SensorMessage, 10)
+	statsChan := make(chan DisplayData, 10)
+	mqttOutgoingChan := make(chan MQTTMessage, 100)     // Larger buffer for queuing
+	inverterOutgoingChan := make(chan MQTTMessage, 100) // For inverter control messages
+	mqttClientChan := make(chan MQTTConnection, 1)      // Buffered to prevent blocking OnConnectionUp
+	senderDataChan := make(chan DisplayData, 10)        // For mqttSenderWorker to receive enabled state
+
+	var serviceRoute *haServiceRoute
+	if haClient != nil {
+		serviceRoute = newHAServiceRoute()
+		supervisor.Go("ha-service-worker", nil, func(ctx context.Context) {
+			haServiceWorker(ctx, serviceRoute, haClient)
+		})
+		log.Println("Service calls: native HA REST API (MQTT proxy fallback)")
+	}
+
+	heartbeats := NewHeartbeats()                   // Worker progress, checked by the watchdog
+	commandTrackChan := make(chan MQTTMessage, 100) // Service calls to confirm, from mqttSenderWorker
+	diagnostics := NewDiagnostics(time.Now())       // Controller health, for the diagnostic sensors
+
+	// Inverters with a Modbus or Shelly target are switched directly rather than through HA
+	allInverters := append(buildInverterGroup(battery2, "").Inverters, buildInverterGroup(battery3, "").Inverters...)
+	modbus := newModbusRoute(allInverters)
+	if modbus != nil {
+		supervisor.Go("modbus-worker", nil, func(ctx context.Context) {
+			modbusWorker(ctx, modbus)
+		})
+	}
+	shelly := newShellyRoute(allInverters)
+	if shelly != nil {
+		supervisor.Go("shelly-worker", nil, func(ctx context.Context) {
+			shellyWorker(ctx, shelly, NewShellyClient())
+		})
+	}
+
+	// Battery entities expire when their state goes quiet; the SOC workers publish only on change
+	keepalive := NewKeepalive()
+	for _, b := range batteries {
+		keepalive.Track(NewTopicBuilder(b.Name).State("sensor", ""), entityExpireAfter)
+	}
+
+	// After a Home Assistant restart, hold actuation until the sensors decisions hinge on are fresh
+	var criticalTopics []string
+	for _, b := range batteries {
+		criticalTopics = append(criticalTopics, b.CriticalTopics()...)
+	}
+	resync := NewHAResync(HAResyncConfig{CriticalTopics: criticalTopics, Timeout: 2 * time.Minute})
+	brokerFailsafe := NewBrokerFailsafe(failsafePolicy, *failsafeAfter, allInverters, *failsafeNotify, auditLog)
+
+	// Launch MQTT sender worker (receives client updates via channel)
+	supervisor.Go("mqtt-sender-worker", nil, func(ctx context.Context) {
+		mqttSenderWorker(ctx, mqttOutgoingChan, mqttClientChan, senderDataChan, MQTTSenderConfig{
+			ForceEnable:         *forceEnable,
+			MultiplusOnly:       *multiplusOnly,
+			ServiceCallInterval: *serviceCallInterval,
+			QueueSize:           *sendQueueSize,
+			MaxInFlight:         10,
+			Heartbeats:          heartbeats,
+			Interlock:           NewSafetyInterlock(interlockConfig, auditLog),
+			Modbus:              modbus,
+			Shelly:              shelly,
+			TopicQoS:            topicQoS,
+			Keepalive:           keepalive,
+			Failsafe:            brokerFailsafe,
+			Leader:              leader,
+			Observer:            observer,
+			Resync:              resync,
+			Diagnostics:         diagnostics,
+		}, serviceRoute, commandTrackChan)
+	})
+
+	// Create MQTT sender for workers
+	mqttSender := NewMQTTSender(mqttOutgoingChan).WithContext(ctx)
+
+	// Write a crash dump for each worker panic (supervisor.Start below launches everything)
+	crashDumps = NewCrashDumps(*crashDir, crashDumpKeep, workerStatus, mqttSender)
+
+	// Create Home Assistant entities once the sender is draining its channel
+	supervisor.Once("ha-entities", []string{"mqtt-sender-worker"}, func(ctx context.Context) {
+		log.Println("Creating Home Assistant entities...")
+
+		for _, b := range batteries {
+			if b.CerboSOCTopic != "" {
+				err := mqttSender.CreateBatterySOCEntityFromCerbo(b.Name, b.CapacityKWh, b.Manufacturer, b.CerboSOCTopic)
+				if err != nil {
+					cancel()
+					log.Fatalf("Failed to create %s State of Charge entity: %v", b.Name, err)
+				}
+			} else {
+				err := mqttSender.CreateBatteryEntity(
+					b.Name, b.CapacityKWh, b.Manufacturer,
+					"State of Charge", "battery", "%", "percentage", 1,
+				)
+				if err != nil {
+					cancel()
+					log.Fatalf("Failed to create %s State of Charge entity: %v", b.Name, err)
+				}
+			}
+
+			err := mqttSender.CreateBatteryEntity(
+				b.Name, b.CapacityKWh, b.Manufacturer,
+				"Available Energy", "energy", "Wh", "available_wh", 0,
+			)
+			if err != nil {
+				cancel()
+				log.Fatalf("Failed to create %s Available Energy entity: %v", b.Name, err)
+			}
+
+			err = mqttSender.CreateBatteryCalibrationEntities(b.Name, b.CapacityKWh, b.Manufacturer)
+			if err != nil {
+				cancel()
+				log.Fatalf("Failed to create %s calibration entities: %v", b.Name, err)
+			}
+
+			// Round-trip efficiency needs metered outflows to compare against inflows
+			if len(b.OutflowEnergyTopics) > 0 {
+				err = mqttSender.CreateBatteryDerivedEntity(
+					b.Name, b.CapacityKWh, b.Manufacturer,
+					"Round Trip Efficiency", "round_trip_efficiency", "%", 1,
+				)
+				if err != nil {
+					cancel()
+					log.Fatalf("Failed to create %s Round Trip Efficiency entity: %v", b.Name, err)
+				}
+			}
+
+			if b.EmptyVoltageThreshold > 0 {
+				err = mqttSender.CreateBatteryDerivedEntity(
+					b.Name, b.CapacityKWh, b.Manufacturer,
+					"State of Health", "state_of_health", "%", 1,
+				)
+				if err != nil {
+					cancel()
+					log.Fatalf("Failed to create %s State of Health entity: %v", b.Name, err)
+				}
+			}
+
+			if b.Temperature != nil {
+				err = mqttSender.CreateBatteryDerivedEntity(
+					b.Name, b.CapacityKWh, b.Manufacturer,
+					"Discharge Derate", "discharge_derate", string(topicUnit(temperatureDischargeDerateTopic(b.Name))), 0,
+				)
+				if err == nil {
+					err = mqttSender.CreateBatteryDerivedEntity(
+						b.Name, b.CapacityKWh, b.Manufacturer,
+						"Charge Derate", "charge_derate", string(topicUnit(temperatureChargeDerateTopic(b.Name))), 0,
+					)
+				}
+				if err == nil {
+					err = mqttSender.CreateOverTemperatureBinarySensor(b.Name)
+				}
+				if err != nil {
+					cancel()
+					log.Fatalf("Failed to create %s temperature entities: %v", b.Name, err)
+				}
+			}
+
+			// Time to empty / full needs both directions of power metered
+			if len(b.InflowPowerTopics) > 0 && len(b.OutflowPowerTopics) > 0 {
+				for _, e := range []struct{ name, suffix string }{
+					{"Time to Empty", "time_to_empty"},
+					{"Time to Full", "time_to_full"},
+				} {
+					err = mqttSender.CreateBatteryDerivedEntity(b.Name, b.CapacityKWh, b.Manufacturer, e.name, e.suffix, "min", 0)
+					if err != nil {
+						cancel()
+						log.Fatalf("Failed to create %s %s entity: %v", b.Name, e.name, err)
+					}
+				}
+			}
+
+			if b.BMS != nil {
+				for _, e := range []struct{ name, suffix, unit string }{
+					{"Lowest Cell Voltage", "cell_min_voltage", "V"},
+					{"Highest Cell Voltage", "cell_max_voltage", "V"},
+					{"Cell Delta", "cell_delta", "mV"},
+				} {
+					precision := 3
+					if e.unit == "mV" {
+						precision = 0
+					}
+					err = mqttSender.CreateBatteryDerivedEntity(b.Name, b.CapacityKWh, b.Manufacturer, e.name, e.suffix, e.unit, precision)
+					if err != nil {
+						break
+					}
+				}
+				if err == nil {
+					err = mqttSender.CreateCellUndervoltageBinarySensor(b.Name)
+				}
+				if err != nil {
+					cancel()
+					log.Fatalf("Failed to create %s BMS entities: %v", b.Name, err)
+				}
+			}
+		}
+
+		// Create powerctl enabled switch
+		err := mqttSender.CreatePowerctlSwitch()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create powerctl switch: %v", err)
+		}
+
+		// Create powerhouse inverters enabled switch
+		err = mqttSender.CreatePowerhouseInvertersSwitch()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create powerhouse inverters switch: %v", err)
+		}
+
+		// Clean up any HA entities that have been renamed or retired.
+		mqttSender.DeleteOldEntities()
+
+		// Create PW2 discharge mode select (Auto / Force On / Force Off).
+		err = mqttSender.CreatePW2DischargeModeSelect()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create PW2 discharge mode select: %v", err)
+		}
+
+		// Create PW2 discharge state sensor (the arbiter's DischargePhase)
+		err = mqttSender.CreatePW2DischargeStateSensor()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create PW2 discharge state sensor: %v", err)
+		}
+
+		// Create daily summary sensor (report in its attributes)
+		err = mqttSender.CreateDailySummarySensor()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create daily summary sensor: %v", err)
+		}
+
+		// Create day-so-far counter sensors (refreshed by the daily summary worker)
+		err = mqttSender.CreateCounterSensors()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create counter sensors: %v", err)
+		}
+
+		// Create threshold profile sensor (the baseline controller's active profile)
+		err = mqttSender.CreateThresholdProfileSensor(baselineConfig.Profiles.Names())
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create threshold profile sensor: %v", err)
+		}
+
+		// Create data quality sensor (readings rejected as implausible)
+		err = mqttSender.CreateDataQualitySensor()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create data quality sensor: %v", err)
+		}
+
+		// Create observer sensors (what an --observe instance would have done)
+		if observer != nil {
+			err = mqttSender.CreateObserverSensors()
+			if err != nil {
+				cancel()
+				log.Fatalf("Failed to create observer sensors: %v", err)
+			}
+		}
+
+		// Create expecting power cuts switch
+		err = mqttSender.CreateExpectingPowerCutsSwitch()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create expecting power cuts switch: %v", err)
+		}
+
+		// Create TOU discharge switch (arms the peak-window discharge scheduler)
+		err = mqttSender.CreateTOUDischargeSwitch()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create TOU discharge switch: %v", err)
+		}
+
+		// Create grid charge switch (arms the overnight grid charge scheduler)
+		if gridChargeConfig.PriceTopic != "" {
+			err = mqttSender.CreateGridChargeSwitch()
+			if err != nil {
+				cancel()
+				log.Fatalf("Failed to create grid charge switch: %v", err)
+			}
+		}
+
+		// Create inverter 10 (Multiplus) AC setpoint number entity
+		err = mqttSender.CreateInverter10ACSetpointEntity()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create inverter 10 AC setpoint entity: %v", err)
+		}
+
+		// Create the "Sleep Ryan" button (triggers the slow dim of Ryan's lights)
+		err = mqttSender.createButton(
+			"powerctl_sleep_ryan",
+			"Sleep Ryan",
+			"mdi:weather-night",
+			TopicSleepRyanPress,
+		)
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create sleep ryan button: %v", err)
+		}
+
+		// Create inverter 10 (Multiplus) AC power sensor entity
+		err = mqttSender.CreateMultiplusACPowerEntity()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create inverter 10 AC power entity: %v", err)
+		}
+
+		// Create inverter 10 (Multiplus) DC current sensor entity (Cerbo vebus DC current)
+		err = mqttSender.CreateMultiplusDCCurrentEntity()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create inverter 10 DC current entity: %v", err)
+		}
+
+		// Create Solar 3 & 4 MPPT mode sensor entities (Cerbo solarcharger topics)
+		err = mqttSender.CreateSolarMpptModeEntity("Solar 3", TopicSolarcharger279MppMode)
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create Solar 3 MPPT mode entity: %v", err)
+		}
+		err = mqttSender.CreateSolarMpptModeEntity("Solar 4", TopicSolarcharger278MppMode)
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create Solar 4 MPPT mode entity: %v", err)
+		}
+
+		// Create Battery 3 DC power sensor entity (Cerbo system battery power)
+		err = mqttSender.CreateBattery3DCPowerEntity()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create Battery 3 DC power entity: %v", err)
+		}
+
+		// Create Battery 3 DC current and CCL entities (Cerbo system battery current/limit)
+		err = mqttSender.CreateBattery3CurrentEntity()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create Battery 3 DC current entity: %v", err)
+		}
+		err = mqttSender.CreateBattery3CCLEntity()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create Battery 3 CCL entity: %v", err)
+		}
+		err = mqttSender.CreateBattery3CVLEntity()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create Battery 3 CVL entity: %v", err)
+		}
+
+		// Create dynamic auto switch (controls auto vs manual Multiplus setpoint)
+		err = mqttSender.CreateDynamicAutoSwitch()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create dynamic auto switch: %v", err)
+		}
+
+		// Create car charging switch and Battery 3 SOC cutoff number entity
+		err = mqttSender.CreateCarChargingSwitch()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create car charging switch: %v", err)
+		}
+		err = mqttSender.CreateCarChargingBattery3CutoffEntity()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create car charging cutoff entity: %v", err)
+		}
+
+		// Create inverter mode select and manual inverter count (B2 maintenance override)
+		err = mqttSender.CreateInverterModeEntities(len(baselineConfig.Battery2.Inverters))
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create inverter mode entities: %v", err)
+		}
+
+		// Create water tank fill sensors and flush mode binary sensor
+		err = mqttSender.CreateWaterTankEntities()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create water tank entities: %v", err)
+		}
+		err = mqttSender.CreateTankFlushModeBinarySensor()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create tank flush mode binary sensor: %v", err)
+		}
+
+		// Create island mode binary sensor (on during a grid outage)
+		err = mqttSender.CreateIslandModeBinarySensor()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create island mode binary sensor: %v", err)
+		}
+
+		// Create storm mode binary sensor (on while a severe weather warning is in force)
+		err = mqttSender.CreateStormModeBinarySensor()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create storm mode binary sensor: %v", err)
+		}
+
+		// Create curtailment binary sensor (on while export is curtailed)
+		err = mqttSender.CreateCurtailmentBinarySensor()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create curtailment binary sensor: %v", err)
+		}
+
+		// Create command failed binary sensor (on while a service call never took effect)
+		err = mqttSender.CreateCommandFailedBinarySensor()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create command failed binary sensor: %v", err)
+		}
+
+		// Create broadcast drops debug sensor (updates a slow worker never saw, per minute)
+		err = mqttSender.CreateDebugSensor(broadcastDropsSensorID, "Broadcast Dropped Updates", "", 0)
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create broadcast drops sensor: %v", err)
+		}
+
+		// Create diagnostic sensors (uptime, reconnects, message rate, restarts, queue depth, version)
+		err = mqttSender.CreateDiagnosticSensors()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create diagnostic sensors: %v", err)
+		}
+
+		// Create update available binary sensor and latest version sensor (release check)
+		if *updateCheck {
+			err = mqttSender.CreateUpdateCheckEntities()
+			if err != nil {
+				cancel()
+				log.Fatalf("Failed to create update check entities: %v", err)
+			}
+		}
+
+		// Create worker panic event (fired with each crash dump)
+		err = mqttSender.CreateWorkerPanicEvent()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create worker panic event: %v", err)
+		}
+
+		// Create worker stuck binary sensor (on while the watchdog sees no progress from a worker)
+		err = mqttSender.CreateWorkerStuckBinarySensor()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create worker stuck binary sensor: %v", err)
+		}
+
+		// Create target ramp pressure debug sensor (baseline target smoothing)
+		err = mqttSender.CreateDebugSensor(targetRampPressureSensorID, "Target Ramp Pressure", "W·s", 0)
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create target ramp pressure sensor: %v", err)
+		}
+
+		// Create overnight reserve sensor (drawdown planner reserve from tomorrow's forecast)
+		err = mqttSender.CreateDebugSensor(overnightReserveSensorID, "Overnight Reserve", "%", 0)
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create overnight reserve sensor: %v", err)
+		}
+
+		// Create dead inverters sensor (switched on but not producing)
+		err = mqttSender.CreateDeadInvertersSensor()
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create dead inverters sensor: %v", err)
+		}
+
+		// Create DIY inverter cap debug sensor (PW2 coordinator)
+		err = mqttSender.CreateDebugSensor(diyInverterCapSensorID, "DIY Inverter Cap", "", 0)
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create DIY inverter cap sensor: %v", err)
+		}
+
+		// Create EV reserved power debug sensor (share of excess held for the car)
+		err = mqttSender.CreateDebugSensor(evReservedSensorID, "EV Reserved Power", string(topicUnit(TopicEVReservedPower)), 0)
+		if err != nil {
+			cancel()
+			log.Fatalf("Failed to create EV reserved power sensor: %v", err)
+		}
+
+		// Create energy-today sensors (integrated by statsWorker, reset at midnight)
+		for _, spec := range energyTodaySpecs {
+			err = mqttSender.CreateEnergyTodaySensor(spec)
+			if err != nil {
+				cancel()
+				log.Fatalf("Failed to create %s sensor: %v", spec.Name, err)
+			}
+		}
+
+		log.Println("Home Assistant entities created")
+	})
+
+	// Launch sankey config worker (generates and publishes sankey configurations)
+	supervisor.GoPausable("sankey-worker", []string{"ha-entities"}, func(ctx context.Context) {
+		log.Println("Generating sankey configurations...")
+		configs := sankey.Generate()
+		mqttSender.CallService("notify", "send_message", "notify.sankey_config", map[string]any{
+			"message": configs.SankeyConfig,
+		})
+		mqttSender.CallService("notify", "send_message", "notify.sankey_templates", map[string]any{
+			"message": configs.Templates,
+		})
+		mqttSender.CallService("homeassistant", "reload_all", "", nil)
+		log.Println("Sankey configurations published")
+	})
+
+	// Launch stats worker (produces statistics, correcting counter resets and dropping
+	// implausible readings)
+	var counterTopics []string
+	for _, b := range batteries {
+		counterTopics = append(counterTopics, b.InflowEnergyTopics...)
+		counterTopics = append(counterTopics, b.OutflowEnergyTopics...)
+	}
+	counters, err := stats.LoadEnergyCounters(*counterStatePath, counterTopics)
+	if err != nil {
+		cancel()
+		log.Fatalf("Failed to load energy counter state: %v", err)
+	}
+	dataQuality := NewDataQuality(plausibilityRules)
+	supervisor.Go("stats-worker", nil, func(ctx context.Context) {
+		statsWorker(ctx, msgChan, statsChan, haTopics, counters, dataQuality)
+	})
+
+	// Launch data quality publisher (readings statsWorker rejected)
+	supervisor.Go("data-quality", []string{"ha-entities"}, func(ctx context.Context) {
+		dataQualityWorker(ctx, dataQuality, mqttSender, time.Minute)
+	})
+
+	// Pre-seed topics (see preSeededTopics in stats.go) so statsWorker doesn't
+	// block on first startup. Real broker values override these on connection.
+	// Sent once the stats worker is running so the seeds can't outgrow the channel buffer.
+	supervisor.Once("pre-seed", []string{"stats-worker"}, func(ctx context.Context) {
+		for _, msg := range preSeededTopics {
+			select {
+			case msgChan <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+
+	// Launch battery workers and collect downstream channels.
+	var downstream []DownstreamConsumer
+	var calibrateRoutes []TopicRoute
+	for _, b := range batteries {
+		calibChan := make(chan DisplayData, 10)
+		socChan := make(chan DisplayData, 10)
+		downstream = append(downstream,
+			DownstreamConsumer{Name: b.Name + "-calibration", Ch: calibChan},
+			DownstreamConsumer{Name: b.Name + "-soc", Ch: socChan},
+		)
+
+		// Launch calibration worker (its Calibrate Full button is routed straight to it)
+		calibConfig := b.CalibConfig()
+		calibratePressChan := make(chan SensorMessage, 10)
+		calibrateRoutes = append(calibrateRoutes, TopicRoute{
+			Topics:  []string{batteryCalibratePressTopic(b.Name)},
+			Channel: calibratePressChan,
+		})
+		supervisor.Go(b.Name+"-calib", nil, func(ctx context.Context) {
+			batteryCalibWorker(ctx, calibChan, calibratePressChan, calibConfig, mqttSender, auditLog)
+		})
+
+		// Launch SOC or available-energy worker depending on SOC source
+		if b.CerboSOCTopic != "" {
+			availConfig := b.AvailableEnergyFromSOCConfig()
+			supervisor.Go(b.Name+"-available-energy", nil, func(ctx context.Context) {
+				batteryAvailableEnergyFromSOCWorker(ctx, socChan, availConfig, mqttSender)
+			})
+		} else {
+			socConfig := b.SOCConfig()
+			supervisor.Go(b.Name+"-soc", nil, func(ctx context.Context) {
+				batterySOCWorker(ctx, socChan, socConfig, mqttSender)
+			})
+		}
+
+		// Launch time-to-empty / time-to-full estimates
+		if len(b.InflowPowerTopics) > 0 && len(b.OutflowPowerTopics) > 0 {
+			runtimeChan := make(chan DisplayData, 10)
+			runtime := b.RuntimeConfig()
+			downstream = append(downstream, DownstreamConsumer{Name: b.Name + "-runtime", Ch: runtimeChan})
+			supervisor.Go(b.Name+"-runtime", nil, func(ctx context.Context) {
+				batteryRuntimeWorker(ctx, runtimeChan, runtime, mqttSender)
+			})
+		}
+
+		// Launch charge limiter if this battery's charge controller is configured for it
+		if b.ChargeLimit != nil {
+			chargeLimitChan := make(chan DisplayData, 10)
+			downstream = append(downstream, DownstreamConsumer{Name: b.Name + "-charge-limit", Ch: chargeLimitChan})
+			chargeLimit := *b.ChargeLimit
+			derateTopic := ""
+			if b.Temperature != nil {
+				derateTopic = temperatureChargeDerateTopic(b.Name)
+			}
+			supervisor.Go(b.Name+"-charge-limit", nil, func(ctx context.Context) {
+				chargeLimitWorker(ctx, chargeLimitChan, b.Name, b.BatteryVoltageTopic, derateTopic, chargeLimit, mqttSender)
+			})
+		}
+
+		// Launch BMS cell monitoring if this battery's BMS publishes cell voltages
+		if b.BMS != nil {
+			bmsChan := make(chan DisplayData, safetyChannelSize)
+			downstream = append(downstream, DownstreamConsumer{Name: b.Name + "-bms", Ch: bmsChan, Safety: true})
+			bms := *b.BMS
+			supervisor.Go(b.Name+"-bms", nil, func(ctx context.Context) {
+				bmsWorker(ctx, bmsChan, b.Name, bms, mqttSender, auditLog)
+			})
+		}
+
+		// Launch temperature derating if this battery has temperature sensors
+		if b.Temperature != nil {
+			temperatureChan := make(chan DisplayData, safetyChannelSize)
+			downstream = append(downstream, DownstreamConsumer{Name: b.Name + "-temperature", Ch: temperatureChan, Safety: true})
+			temperature := *b.Temperature
+			supervisor.Go(b.Name+"-temperature", nil, func(ctx context.Context) {
+				temperatureDeratingWorker(ctx, temperatureChan, b.Name, temperature, mqttSender, auditLog)
+			})
+		}
+	}
+
+	// Launch power excess calculator, EV reservation, and dump load enabler
+	powerExcessChan := make(chan DisplayData, 10)
+	excessValueChan := make(chan float64, 10)
+	evDataChan := make(chan DisplayData, 10)
+	dumpLoadExcessChan := make(chan float64, 10)
+	dumpLoadDataChan := make(chan DisplayData, 10)
+	downstream = append(downstream,
+		DownstreamConsumer{Name: "power-excess", Ch: powerExcessChan},
+		DownstreamConsumer{Name: "ev-charging", Ch: evDataChan},
+		DownstreamConsumer{Name: "dump-load-enabler", Ch: dumpLoadDataChan},
+	)
+
+	supervisor.Go("power-excess-calculator", nil, func(ctx context.Context) {
+		powerExcessCalculator(ctx, powerExcessChan, excessValueChan, excessPolicy)
+	})
+
+	supervisor.GoPausable("ev-charging-worker", nil, func(ctx context.Context) {
+		evChargingWorker(ctx, excessValueChan, dumpLoadExcessChan, evDataChan, EVChargingConfig{
+			ReserveShare:     0.5,
+			ChargingMinWatts: 100,
+		}, mqttSender)
+	})
+
+	supervisor.Go("dump-load-enabler", nil, func(ctx context.Context) {
+		dumpLoadEnabler(ctx, dumpLoadExcessChan, dumpLoadDataChan, dumpLoads, mqttSender, auditLog)
+	})
+
+	// Create inverterSender that sends to inverterOutgoingChan (filtered by interceptor)
+	inverterSender := NewMQTTSender(inverterOutgoingChan)
+
+	// Launch interceptor to filter inverter messages based on powerctl_inverter_enabled switch
+	interceptorDataChan := make(chan DisplayData, 10)
+	downstream = append(downstream, DownstreamConsumer{Name: "inverter-interceptor", Ch: interceptorDataChan})
+
+	supervisor.Go("inverter-interceptor", nil, func(ctx context.Context) {
+		mqttInterceptorWorker(
+			ctx,
+			"Powerhouse inverters",
+			TopicPowerhouseInvertersEnabledState,
+			inverterOutgoingChan,
+			mqttOutgoingChan,
+			interceptorDataChan,
+			*forceEnable,
+		)
+	})
+
+	// Launch baseline inverter controller (Battery 2 inverters)
+	// Safety consumer: low-voltage protection must act on the latest reading, never a backlog.
+	// Readings below the fast trip skip stats altogether, straight from mqttWorker.
+	var lvFastPath *LowVoltageFastPath
+	if baselineConfig.LowVoltageFastTrip > 0 {
+		lvFastPath = NewLowVoltageFastPath(baselineConfig.Input.Battery2VoltageTopic, baselineConfig.LowVoltageFastTrip)
+	}
+	baselineDisplayChan := make(chan DisplayData, safetyChannelSize)
+	baselineInputChan := make(chan BaselineInput, safetyChannelSize)
+	baselineDebugChan := make(chan BaselineDebugInfo, 10)
+	downstream = append(downstream, DownstreamConsumer{Name: "baseline-inverter-control", Ch: baselineDisplayChan, Safety: true})
+
+	supervisor.Go("baseline-input-bridge", nil, func(ctx context.Context) {
+		for {
+			select {
+			case data := <-baselineDisplayChan:
+				// Replace an input the controller hasn't read yet rather than dropping this one
+				offerLatest(baselineInputChan, ExtractBaselineInput(data, baselineConfig.Input))
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+
+	supervisor.Go("baseline-inverter-control", nil, func(ctx context.Context) {
+		baselineInverterControl(ctx, baselineInputChan, lvFastPath.Trips(), baselineConfig, inverterSender, baselineDebugChan, auditLog)
+	})
+
+	// Launch dynamic inverter controller (Multiplus II, Battery 3)
+	dynamicDisplayChan := make(chan DisplayData, 10)
+	dynamicInputChan := make(chan DynamicInput, 10)
+	dynamicDebugChan := make(chan DynamicDebugInfo, 10)
+	downstream = append(downstream, DownstreamConsumer{Name: "dynamic-inverter-control", Ch: dynamicDisplayChan})
+
+	supervisor.Go("dynamic-input-bridge", nil, func(ctx context.Context) {
+		for {
+			select {
+			case data := <-dynamicDisplayChan:
+				select {
+				case dynamicInputChan <- ExtractDynamicInput(data, dynamicConfig.Input):
+				default:
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+
+	supervisor.Go("dynamic-inverter-control", nil, func(ctx context.Context) {
+		dynamicInverterControl(ctx, dynamicInputChan, mqttSender, dynamicDebugChan)
+	})
+
+	// Baseline debug info feeds both the debug aggregator and the daily summary
+	aggregatorBaselineChan := make(chan BaselineDebugInfo, 10)
+	summaryDebugChan := make(chan BaselineDebugInfo, 10)
+	supervisor.Go("baseline-debug-tee", nil, func(ctx context.Context) {
+		for {
+			select {
+			case info := <-baselineDebugChan:
+				for _, ch := range []chan BaselineDebugInfo{aggregatorBaselineChan, summaryDebugChan} {
+					select {
+					case ch <- info:
+					default:
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+
+	// Launch debug aggregator (combines baseline + dynamic debug info for HA display)
+	supervisor.Go("debug-aggregator", nil, func(ctx context.Context) {
+		debugAggregatorWorker(ctx, aggregatorBaselineChan, dynamicDebugChan, mqttSender)
+	})
+
+	// Launch daily summary (published at local midnight)
+	summaryDataChan := make(chan DisplayData, 10)
+	downstream = append(downstream, DownstreamConsumer{Name: "daily-summary", Ch: summaryDataChan})
+	supervisor.GoPausable("daily-summary", nil, func(ctx context.Context) {
+		dailySummaryWorker(ctx, summaryDataChan, summaryDebugChan, summaryConfig, mqttSender)
+	})
+
+	// Vote channel carries discharge requests from automation sources into the arbiter.
+	dischargeVoteChan := make(chan DischargeRequest, 10)
+
+	// Launch Powerwall 2 discharge arbiter
+	pw2DischargeChan := make(chan DisplayData, 10)
+	downstream = append(downstream, DownstreamConsumer{Name: "pw2-discharge", Ch: pw2DischargeChan})
+
+	// An observer stays on the HA client, whose service calls it can hold back
+	tesla := NewHATeslaClient(mqttSender, teslaSiteID)
+	if *teslaAPI == "fleet" && observer == nil {
+		fleetURL := os.Getenv("TESLA_FLEET_URL")
+		if fleetURL == "" {
+			fleetURL = defaultTeslaFleetURL
+		}
+		// Fleet commands bypass mqttSenderWorker, so they are held back by the same rules here
+		guard := &TeslaGuard{ForceEnable: *forceEnable, Leader: leader, Resync: resync, Failsafe: brokerFailsafe}
+		tesla = NewGuardedTeslaClient(NewTeslaFleetClient(ctx, fleetURL, teslaSiteID,
+			os.Getenv("TESLA_CLIENT_ID"), os.Getenv("TESLA_REFRESH_TOKEN"), os.Getenv("TESLA_TOKEN_FILE")), guard)
+		teslaGuardChan := make(chan DisplayData, 10)
+		downstream = append(downstream, DownstreamConsumer{Name: "tesla-guard", Ch: teslaGuardChan})
+		supervisor.Go("tesla-guard", nil, func(ctx context.Context) {
+			teslaGuardWorker(ctx, guard, teslaGuardChan)
+		})
+		log.Println("Powerwall control: Tesla Fleet API")
+	}
+
+	supervisor.Go("discharge-arbiter", nil, func(ctx context.Context) {
+		dischargeArbiter(ctx, pw2DischargeChan, dischargeVoteChan, mqttSender, tesla, auditLog, touTariff)
+	})
+
+	supervisor.GoPausable("threshold-profile", nil, func(ctx context.Context) {
+		thresholdProfileWorker(ctx, baselineConfig.Profiles, mqttSender)
+	})
+
+	// Launch PW2 coordinator (keeps the DIY inverters from charging the Powerwall)
+	coordinatorChan := make(chan DisplayData, 10)
+	downstream = append(downstream, DownstreamConsumer{Name: "pw2-coordinator", Ch: coordinatorChan})
+
+	supervisor.GoPausable("pw2-coordinator", nil, func(ctx context.Context) {
+		pw2CoordinatorWorker(ctx, coordinatorChan, coordinatorConfig, mqttSender, auditLog)
+	})
+
+	// Launch expecting power cuts worker
+	expectingPowerCutsChan := make(chan DisplayData, 10)
+	downstream = append(downstream, DownstreamConsumer{Name: "expecting-power-cuts", Ch: expectingPowerCutsChan})
+
+	supervisor.Go("expecting-power-cuts", nil, func(ctx context.Context) {
+		expectingPowerCutsWorker(ctx, expectingPowerCutsChan, dischargeVoteChan, mqttSender, tesla)
+	})
+
+	// Launch island mode worker (grid outage detection for baseline SOC limits and dump load)
+	islandModeChan := make(chan DisplayData, 10)
+	downstream = append(downstream, DownstreamConsumer{Name: "island-mode", Ch: islandModeChan})
+	islandConfig := IslandModeConfig{
+		GridStatusTopic: baselineConfig.Input.GridStatusTopic,
+		OutageDelay:     30 * time.Second,
+		RestoreDelay:    5 * time.Minute,
+	}
+
+	supervisor.Go("island-mode-worker", nil, func(ctx context.Context) {
+		islandModeWorker(ctx, islandModeChan, islandConfig, mqttSender)
+	})
+
+	// Launch storm mode worker (pre-emptive shedding on severe weather warnings)
+	if stormConfig.WarningTopic != "" {
+		stormChan := make(chan DisplayData, 10)
+		downstream = append(downstream, DownstreamConsumer{Name: "storm-mode", Ch: stormChan})
+
+		supervisor.Go("storm-mode-worker", nil, func(ctx context.Context) {
+			stormModeWorker(ctx, stormChan, stormConfig, dischargeVoteChan, mqttSender)
+		})
+	}
+
+	// Launch curtailment worker (negative export price or DNSP curtailment signal)
+	if curtailmentConfig.Enabled() {
+		curtailmentChan := make(chan DisplayData, 10)
+		downstream = append(downstream, DownstreamConsumer{Name: "curtailment", Ch: curtailmentChan})
+
+		supervisor.Go("curtailment-worker", nil, func(ctx context.Context) {
+			curtailmentWorker(ctx, curtailmentChan, curtailmentConfig, dischargeVoteChan, mqttSender, auditLog)
+		})
+	}
+
+	// Launch metrics exporter (long-term history outside HA's recorder)
+	if metricsConfig.WriteURL != "" {
+		metricsChan := make(chan DisplayData, 10)
+		downstream = append(downstream, DownstreamConsumer{Name: "metrics-export", Ch: metricsChan})
+
+		supervisor.GoPausable("metrics-export-worker", nil, func(ctx context.Context) {
+			metricsExportWorker(ctx, metricsChan, metricsConfig)
+		})
+	}
+
+	// Launch the control API (state and control verbs over HTTP instead of MQTT topics)
+	if apiConfig.Addr != "" {
+		apiChan := make(chan DisplayData, 10)
+		downstream = append(downstream, DownstreamConsumer{Name: "api", Ch: apiChan})
+
+		calibConfigs := make([]BatteryCalibConfig, len(batteries))
+		for i, b := range batteries {
+			calibConfigs[i] = b.CalibConfig()
+		}
+		apiServer := NewAPIServer(apiConfig.Token, workerStatus, supervisor, mqttSender, auditLog,
+			calibConfigs, len(baselineConfig.Battery2.Inverters))
+		supervisor.Go("api-server", []string{"ha-entities"}, func(ctx context.Context) {
+			apiServerWorker(ctx, apiChan, apiConfig, apiServer)
+		})
+	}
+
+	// Launch the observer sensors (read-only mode: would-be commands and decisions)
+	if observer != nil {
+		supervisor.Go("observer", []string{"ha-entities"}, func(ctx context.Context) {
+			observerWorker(ctx, observer, workerStatus, mqttSender, 10*time.Second)
+		})
+	}
+
+	// Launch HA restart handling (birth and last-will messages drive resync)
+	haStatusChan := make(chan SensorMessage, 10)
+	supervisor.Go("ha-resync", []string{"mqtt-sender-worker"}, func(ctx context.Context) {
+		haResyncWorker(ctx, resync, haStatusChan, mqttSender)
+	})
+
+	// Launch leader election (redundant instances: only the leader actuates)
+	leaderClaimChan := make(chan SensorMessage, 10)
+	if leader != nil {
+		leaderDataChan := make(chan DisplayData, 10)
+		downstream = append(downstream, DownstreamConsumer{Name: "leader-election", Ch: leaderDataChan})
+		supervisor.Go("leader-election", []string{"mqtt-sender-worker"}, func(ctx context.Context) {
+			leaderElectionWorker(ctx, leader, leaderClaimChan, leaderDataChan, mqttSender)
+		})
+	}
+
+	// Launch Solcast forecast fetcher (replaces the HA integration's detailed forecast)
+	if solcastEnabled {
+		solcastChan := make(chan DisplayData, 10)
+		downstream = append(downstream, DownstreamConsumer{Name: "solcast-forecast", Ch: solcastChan})
+
+		supervisor.GoPausable("solcast-forecast-worker", nil, func(ctx context.Context) {
+			solcastForecastWorker(ctx, solcastChan, solcastConfig, mqttSender)
+		})
+	}
+
+	// Launch TOU discharge scheduler (votes for PW2 discharge in peak windows)
+	touChan := make(chan DisplayData, 10)
+	downstream = append(downstream, DownstreamConsumer{Name: "tou-discharge", Ch: touChan})
+
+	supervisor.GoPausable("tou-discharge-scheduler", nil, func(ctx context.Context) {
+		touDischargeScheduler(ctx, touChan, touConfig, dischargeVoteChan)
+	})
+
+	// Launch AC tile color worker
+	acTileChan := make(chan DisplayData, 10)
+	downstream = append(downstream, DownstreamConsumer{Name: "ac-tile", Ch: acTileChan})
+
+	supervisor.GoPausable("ac-tile-worker", nil, func(ctx context.Context) {
+		acTileWorker(ctx, acTileChan, mqttSender)
+	})
+
+	// Launch grid charge scheduler (asks the arbiter to charge PW2 overnight when cheap)
+	if gridChargeConfig.PriceTopic != "" {
+		gridChargeChan := make(chan DisplayData, 10)
+		downstream = append(downstream, DownstreamConsumer{Name: "grid-charge", Ch: gridChargeChan})
+
+		supervisor.GoPausable("grid-charge-scheduler", nil, func(ctx context.Context) {
+			gridChargeScheduler(ctx, gridChargeChan, gridChargeConfig, dischargeVoteChan)
+		})
+	}
+
+	// Launch energy today worker (publishes statsWorker's energy-since-midnight topics)
+	energyTodayChan := make(chan DisplayData, 10)
+	downstream = append(downstream, DownstreamConsumer{Name: "energy-today", Ch: energyTodayChan})
+
+	supervisor.GoPausable("energy-today-worker", nil, func(ctx context.Context) {
+		energyTodayWorker(ctx, energyTodayChan, mqttSender)
+	})
+
+	// Launch powerhouse cooling worker
+	coolingChan := make(chan DisplayData, 10)
+	downstream = append(downstream, DownstreamConsumer{Name: "powerhouse-cooling", Ch: coolingChan})
+
+	supervisor.Go("powerhouse-cooling-worker", nil, func(ctx context.Context) {
+		powerhouseCoolingWorker(ctx, coolingChan, mqttSender)
+	})
+
+	// Launch tank levels worker (computes water tank fill percentages)
+	tankLevelsChan := make(chan DisplayData, 10)
+	downstream = append(downstream, DownstreamConsumer{Name: "tank-levels", Ch: tankLevelsChan})
+
+	supervisor.GoPausable("tank-levels-worker", nil, func(ctx context.Context) {
+		tankLevelsWorker(ctx, tankLevelsChan, mqttSender)
+	})
+
+	// Launch pump control worker (daily start check, low-level floor, full stop)
+	pumpControlChan := make(chan DisplayData, 10)
+	downstream = append(downstream, DownstreamConsumer{Name: "pump-control", Ch: pumpControlChan})
+
+	supervisor.Go("pump-control-worker", nil, func(ctx context.Context) {
+		pumpControlWorker(ctx, pumpControlChan, mqttSender)
+	})
+
+	// Launch lights worker (outside auto-off, kitchen↔mum, garage mirror, sleep dim).
+	// sleepRyanChan delivers button presses on a dedicated route so momentary
+	// presses aren't collapsed by statsWorker's per-topic state.
+	lightsChan := make(chan DisplayData, 10)
+	sleepRyanChan := make(chan SensorMessage, 10)
+	downstream = append(downstream, DownstreamConsumer{Name: "lights", Ch: lightsChan})
+
+	supervisor.GoPausable("lights-worker", nil, func(ctx context.Context) {
+		lightsWorker(ctx, lightsChan, sleepRyanChan, mqttSender)
+	})
+
+	// Launch command tracker (resends service calls until their entity converges)
+	commandTrackerChan := make(chan DisplayData, 10)
+	downstream = append(downstream, DownstreamConsumer{Name: "command-tracker", Ch: commandTrackerChan})
+	supervisor.Go("command-tracker", nil, func(ctx context.Context) {
+		commandTrackerWorker(ctx, commandTrackChan, commandTrackerChan, CommandTrackerConfig{
+			MaxRetries:     3,
+			InitialBackoff: 15 * time.Second,
+		}, mqttSender, *forceEnable)
+	})
+
+	// Launch Cerbo keepalive worker (outbound only)
+	supervisor.Go("cerbo-keepalive", nil, func(ctx context.Context) {
+		cerboKeepaliveWorker(ctx, mqttSender)
+	})
+
+	// Add senderDataChan to downstream consumers for mqttSenderWorker to receive enabled state
+	downstream = append(downstream, DownstreamConsumer{Name: "mqtt-sender-worker", Ch: senderDataChan})
+
+	// Launch crash dump worker (keeps the latest data for crash dumps)
+	crashDumpChan := make(chan DisplayData, 10)
+	downstream = append(downstream, DownstreamConsumer{Name: "crash-dumps", Ch: crashDumpChan})
+	supervisor.Go("crash-dump-worker", nil, func(ctx context.Context) {
+		crashDumpWorker(ctx, crashDumpChan, crashDumps)
+	})
+
+	// Launch debug worker if enabled
+	if *debugMode {
+		debugChan := make(chan DisplayData, 10)
+		downstream = append(downstream, DownstreamConsumer{Name: "debug-worker", Ch: debugChan})
+		supervisor.Go("debug-worker", nil, func(ctx context.Context) {
+			debugWorker(ctx, cancel, debugChan, heartbeats)
+		})
+	}
+
+	// Each consumer waits only for the topics it declared; undeclared consumers wait for all
+	for i, c := range downstream {
+		downstream[i].Requires = topicRegistry.TopicsFor(c.Name)
+		if downstream[i].Requires == nil {
+			downstream[i].Requires = haTopics
+		}
+	}
+
+	// Launch broadcast worker (fans out to all downstream workers)
+	supervisor.Go("broadcast-worker", nil, func(ctx context.Context) {
+		broadcastWorker(ctx, statsChan, downstream, mqttSender, heartbeats)
+	})
+
+	// Launch watchdog (detects workers that stopped making progress, e.g. deadlocked)
+	supervisor.Go("watchdog", nil, func(ctx context.Context) {
+		watchdogWorker(ctx, cancel, heartbeats, workerStatus, WatchdogConfig{
+			Threshold:     2 * time.Minute,
+			CheckInterval: 30 * time.Second,
+			ExitOnStuck:   *watchdogExit,
+		}, mqttSender)
+	})
+
+	// Launch diagnostics worker (controller health sensors on the Powerctl device)
+	supervisor.Go("diagnostics-worker", []string{"ha-entities"}, func(ctx context.Context) {
+		diagnosticsWorker(ctx, diagnostics, workerStatus, mqttSender)
+	})
+
+	// Launch release check (optional: flags builds older than the latest GitHub release)
+	if *updateCheck {
+		supervisor.GoPausable("update-check-worker", []string{"ha-entities"}, func(ctx context.Context) {
+			updateCheckWorker(ctx, UpdateCheckConfig{URL: defaultReleaseURL, Interval: 6 * time.Hour}, mqttSender)
+		})
+	}
+
+	// Launch MQTT worker last, once entities exist and everything downstream is ready
+	supervisor.Go("mqtt-worker", []string{"mqtt-sender-worker", "ha-entities", "pre-seed", "broadcast-worker"}, func(ctx context.Context) {
+		routes := []TopicRoute{
+			{Topics: haTopics, Channel: msgChan, Seen: resync.Seen, Tap: lvFastPath.Tap},
+			{Topics: []string{TopicHAStatus}, Channel: haStatusChan},
+			{Topics: []string{TopicSleepRyanPress}, Channel: sleepRyanChan},
+		}
+		routes = append(routes, calibrateRoutes...)
+		if leader != nil {
+			routes = append(routes, TopicRoute{Topics: []string{TopicLeaderClaim}, Channel: leaderClaimChan})
+		}
+		mqttWorker(ctx, mqttHost, mqttPort, routes, mqttUsername, mqttPassword, mqttClientID, *mqttSessionDir, topicQoS, mqttClientChan, diagnostics)
+	})
+
+	if err := supervisor.Start(ctx); err != nil {
+		cancel()
+		log.Fatalf("Invalid worker dependencies: %v", err)
+	}
+
+	// Wait for interrupt signal or context cancellation (from panic)
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case <-sigChan:
+		log.Println("\nShutting down...")
+		cancel()
+		return 0
+	case <-ctx.Done():
+		log.Println("\nShutting down due to error...")
+		return 1
+	}
+}
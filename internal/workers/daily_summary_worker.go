@@ -0,0 +1,384 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// dailySummarySensorID is the sensor holding the previous day's summary: the date as
+	// its state and the markdown report in its "report" attribute.
+	dailySummarySensorID = "powerctl_daily_summary"
+
+	TopicDailySummaryState      = "powerctl/sensor/" + dailySummarySensorID + "/state"
+	TopicDailySummaryAttributes = "powerctl/sensor/" + dailySummarySensorID + "/attributes"
+
+	// summaryMaxGap caps how long a single reading is credited for (rule time, inverter
+	// hours), so a stall or restart isn't counted as time spent in the last state.
+	summaryMaxGap = time.Minute
+
+	ruleIdle = "Idle" // no inverters on
+
+	// Day-so-far counters, refreshed every minute. Rule minutes' state is the rule with
+	// the most minutes; the others' is the total. Breakdowns are in the attributes.
+	ruleMinutesSensorID      = "powerctl_rule_minutes_today"
+	modeTransitionsSensorID  = "powerctl_mode_transitions_today"
+	inverterSwitchesSensorID = "powerctl_inverter_switches_today"
+)
+
+// SummaryBattery names the energy-today topics (Wh) for a battery's charge and
+// discharge. Either may be empty when that direction isn't metered.
+type SummaryBattery struct {
+	Name            string
+	ChargedTopic    string
+	DischargedTopic string
+}
+
+// DailySummaryConfig holds configuration for the end-of-day summary.
+type DailySummaryConfig struct {
+	SolarEnergyTopic    string // energy-today topic (Wh)
+	Batteries           []SummaryBattery
+	InverterEntityIDs   []string // Battery 2 inverters, aligned with InverterStateTopics
+	InverterStateTopics []string
+	NotifyEntity        string // notify entity sent the report; "" disables
+}
+
+// Topics returns the statestream topics the summary reads (the energy-today topics are
+// synthetic and always present).
+func (c DailySummaryConfig) Topics() []string {
+	return c.InverterStateTopics
+}
+
+// BatteryDay is one battery's energy for the day.
+type BatteryDay struct {
+	Name         string  `json:"name"`
+	ChargedWh    float64 `json:"charged_wh"`
+	DischargedWh float64 `json:"discharged_wh"`
+}
+
+// DailySummary is one day's report.
+type DailySummary struct {
+	Date             string             `json:"date"`
+	SolarWh          float64            `json:"solar_wh"`
+	Batteries        []BatteryDay       `json:"batteries"`
+	InverterHours    map[string]float64 `json:"inverter_hours"`
+	LowVoltageEvents int                `json:"low_voltage_events"`
+	RuleMinutes      map[string]float64 `json:"rule_minutes"`
+	ModeTransitions  int                `json:"mode_transitions"`
+	InverterSwitches map[string]int     `json:"inverter_switches"`
+}
+
+// dailyTally accumulates the current day. Energy comes from the energy-today topics,
+// so only their last value before midnight is kept.
+type dailyTally struct {
+	config DailySummaryConfig
+	day    time.Time // local midnight starting the day
+
+	solarWh    float64
+	batteries  []BatteryDay
+	inverterOn []time.Duration
+	switches   []int
+	states     []bool
+	lastData   time.Time
+
+	ruleTime    map[string]time.Duration
+	winner      string
+	transitions int
+	lastDebug   time.Time
+	lowVoltage  bool
+	lvEvents    int
+}
+
+func newDailyTally(config DailySummaryConfig, now time.Time) *dailyTally {
+	t := &dailyTally{config: config}
+	t.reset(now)
+	return t
+}
+
+// reset starts a new day at now, carrying over the current states.
+func (t *dailyTally) reset(now time.Time) {
+	y, m, d := now.Date()
+	t.day = time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	t.solarWh = 0
+	t.batteries = make([]BatteryDay, len(t.config.Batteries))
+	for i, b := range t.config.Batteries {
+		t.batteries[i].Name = b.Name
+	}
+	t.inverterOn = make([]time.Duration, len(t.config.InverterStateTopics))
+	t.switches = make([]int, len(t.config.InverterStateTopics))
+	t.ruleTime = make(map[string]time.Duration)
+	t.transitions = 0
+	t.lvEvents = 0
+}
+
+// credit returns how long the state seen at last has held by now, capped at
+// summaryMaxGap (0 before the first reading).
+func credit(last, now time.Time) time.Duration {
+	if last.IsZero() || !now.After(last) {
+		return 0
+	}
+	return min(now.Sub(last), summaryMaxGap)
+}
+
+// Data records energy totals, credits inverter on-time and counts inverter switches.
+func (t *dailyTally) Data(data DisplayData, now time.Time) {
+	d := credit(t.lastData, now)
+	for i, on := range t.states {
+		if on {
+			t.inverterOn[i] += d
+		}
+	}
+	first := t.lastData.IsZero()
+	t.lastData = now
+	for i, topic := range t.config.InverterStateTopics {
+		on := data.GetBoolean(topic)
+		if i >= len(t.states) {
+			t.states = append(t.states, on)
+			continue
+		}
+		if on != t.states[i] && !first {
+			t.switches[i]++
+		}
+		t.states[i] = on
+	}
+
+	t.solarWh = data.GetFloat(t.config.SolarEnergyTopic).Current
+	for i, b := range t.config.Batteries {
+		if b.ChargedTopic != "" {
+			t.batteries[i].ChargedWh = data.GetFloat(b.ChargedTopic).Current
+		}
+		if b.DischargedTopic != "" {
+			t.batteries[i].DischargedWh = data.GetFloat(b.DischargedTopic).Current
+		}
+	}
+}
+
+// baselineWinner names what decided the baseline count: the safety reason, manual,
+// self-consumption, the contributing mode, or ruleIdle.
+func baselineWinner(info BaselineDebugInfo) string {
+	switch {
+	case info.SafetyReason != "":
+		return modeSafety
+	case info.Manual:
+		return modeManual
+	case info.SelfConsumption:
+		return modeSelfConsumption
+	}
+	for _, mode := range info.Modes {
+		if mode.Contributing {
+			return mode.Name
+		}
+	}
+	return ruleIdle
+}
+
+// Debug credits the previous winner and counts mode transitions and low-voltage limit
+// trips.
+func (t *dailyTally) Debug(info BaselineDebugInfo, now time.Time) {
+	winner := baselineWinner(info)
+	if t.winner != "" {
+		t.ruleTime[t.winner] += credit(t.lastDebug, now)
+		if winner != t.winner {
+			t.transitions++
+		}
+	}
+	t.winner = winner
+	t.lastDebug = now
+
+	if info.Battery2LowVoltage && !t.lowVoltage {
+		t.lvEvents++
+	}
+	t.lowVoltage = info.Battery2LowVoltage
+}
+
+// Summary returns the day so far.
+func (t *dailyTally) Summary() DailySummary {
+	summary := DailySummary{
+		Date:             t.day.Format(time.DateOnly),
+		SolarWh:          t.solarWh,
+		Batteries:        slices.Clone(t.batteries),
+		InverterHours:    make(map[string]float64, len(t.inverterOn)),
+		LowVoltageEvents: t.lvEvents,
+		RuleMinutes:      make(map[string]float64, len(t.ruleTime)),
+		ModeTransitions:  t.transitions,
+		InverterSwitches: make(map[string]int, len(t.switches)),
+	}
+	for i, on := range t.inverterOn {
+		name := t.config.InverterStateTopics[i]
+		if i < len(t.config.InverterEntityIDs) {
+			name = t.config.InverterEntityIDs[i]
+		}
+		summary.InverterHours[name] = on.Hours()
+		summary.InverterSwitches[name] = t.switches[i]
+	}
+	for rule, d := range t.ruleTime {
+		summary.RuleMinutes[rule] = d.Minutes()
+	}
+	return summary
+}
+
+// TotalSwitches is the number of inverter switch operations across every inverter.
+func (s DailySummary) TotalSwitches() int {
+	total := 0
+	for _, n := range s.InverterSwitches {
+		total += n
+	}
+	return total
+}
+
+// TopRule returns the rule with the most minutes, or "" before any.
+func (s DailySummary) TopRule() string {
+	top := ""
+	for rule, minutes := range s.RuleMinutes {
+		if top == "" || minutes > s.RuleMinutes[top] || (minutes == s.RuleMinutes[top] && rule < top) {
+			top = rule
+		}
+	}
+	return top
+}
+
+// Markdown renders the summary as GFM tables for an HA markdown card.
+func (s DailySummary) Markdown() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**%s**\n\n", s.Date)
+	sb.WriteString("| | |\n|---|---:|\n")
+	fmt.Fprintf(&sb, "| Solar | %.1f kWh |\n", s.SolarWh/1000)
+	for _, b := range s.Batteries {
+		fmt.Fprintf(&sb, "| %s in / out | %.1f / %.1f kWh |\n", b.Name, b.ChargedWh/1000, b.DischargedWh/1000)
+	}
+	var total float64
+	for _, h := range s.InverterHours {
+		total += h
+	}
+	fmt.Fprintf(&sb, "| Inverter hours | %.1f h |\n", total)
+	fmt.Fprintf(&sb, "| Inverter switches | %d |\n", s.TotalSwitches())
+	fmt.Fprintf(&sb, "| Low-voltage events | %d |\n", s.LowVoltageEvents)
+	fmt.Fprintf(&sb, "| Mode transitions | %d |\n", s.ModeTransitions)
+
+	rules := slices.Collect(maps.Keys(s.RuleMinutes))
+	slices.SortFunc(rules, func(a, b string) int {
+		if s.RuleMinutes[a] != s.RuleMinutes[b] {
+			if s.RuleMinutes[a] > s.RuleMinutes[b] {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a, b)
+	})
+	if len(rules) > 0 {
+		sb.WriteString("\n| Rule | Time |\n|---|---:|\n")
+		for _, rule := range rules {
+			fmt.Fprintf(&sb, "| %s | %.0f min |\n", rule, s.RuleMinutes[rule])
+		}
+	}
+	return sb.String()
+}
+
+// publishDailySummary publishes summary, retained, to the summary sensor and sends it
+// to the notify entity if configured.
+func publishDailySummary(sender *MQTTSender, summary DailySummary, notifyEntity string) {
+	report := summary.Markdown()
+	attributes, err := json.Marshal(struct {
+		DailySummary
+		Report string `json:"report"`
+	}{summary, report})
+	if err != nil {
+		log.Printf("Daily summary: failed to marshal attributes: %v\n", err)
+		return
+	}
+	sender.Send(MQTTMessage{Topic: TopicDailySummaryAttributes, Payload: attributes, QoS: 1, Retain: true})
+	sender.Send(MQTTMessage{Topic: TopicDailySummaryState, Payload: []byte(summary.Date), QoS: 1, Retain: true})
+	if notifyEntity != "" {
+		sender.CallService("notify", "send_message", notifyEntity, map[string]any{
+			"title":   "Powerctl " + summary.Date,
+			"message": report,
+		})
+	}
+}
+
+// dailyCounters is the day so far, refreshed every minute by dailySummaryWorker for the
+// metrics exporter. nil until the first refresh.
+var dailyCounters atomic.Pointer[DailySummary]
+
+// publishCounters publishes the day-so-far counters that changed to their sensors: the
+// total as the state and the breakdown as attributes.
+func publishCounters(sender *MQTTSender, filter *ChangeFilter, summary DailySummary, now time.Time) {
+	send := func(topic string, payload []byte) {
+		if filter.ChangedPayload(topic, string(payload), now) {
+			sender.Send(MQTTMessage{Topic: topic, Payload: payload, QoS: 0})
+		}
+	}
+	publish := func(sensorID, state string, attributes any) {
+		send("powerctl/sensor/"+sensorID+"/state", []byte(state))
+		if attributes == nil {
+			return
+		}
+		payload, err := json.Marshal(attributes)
+		if err != nil {
+			log.Printf("Daily summary: failed to marshal %s attributes: %v\n", sensorID, err)
+			return
+		}
+		send("powerctl/sensor/"+sensorID+"/attributes", payload)
+	}
+	publish(ruleMinutesSensorID, summary.TopRule(), summary.RuleMinutes)
+	publish(modeTransitionsSensorID, strconv.Itoa(summary.ModeTransitions), nil)
+	publish(inverterSwitchesSensorID, strconv.Itoa(summary.TotalSwitches()), summary.InverterSwitches)
+}
+
+// dailySummaryWorker tallies the day from DisplayData and the baseline controller's
+// debug info, publishes the counters every minute and the summary at local midnight. A restart starts the
+// tally again, so the first summary after one covers part of the day.
+func dailySummaryWorker(
+	ctx context.Context,
+	dataChan <-chan DisplayData,
+	debugChan <-chan BaselineDebugInfo,
+	config DailySummaryConfig,
+	sender *MQTTSender,
+) {
+	log.Println("Daily summary worker started")
+
+	tally := newDailyTally(config, time.Now())
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	counterFilter := NewChangeFilter(0)
+
+	rollover := func(now time.Time) {
+		if now.Before(tally.day.AddDate(0, 0, 1)) {
+			return
+		}
+		summary := tally.Summary()
+		log.Printf("Daily summary %s: %.1f kWh solar, %d low-voltage events\n",
+			summary.Date, summary.SolarWh/1000, summary.LowVoltageEvents)
+		publishDailySummary(sender, summary, config.NotifyEntity)
+		tally.reset(now)
+	}
+
+	for {
+		select {
+		case data := <-dataChan:
+			now := time.Now()
+			rollover(now)
+			tally.Data(data, now)
+		case info := <-debugChan:
+			now := time.Now()
+			rollover(now)
+			tally.Debug(info, now)
+		case now := <-ticker.C:
+			rollover(now)
+			counters := tally.Summary()
+			dailyCounters.Store(&counters)
+			publishCounters(sender, counterFilter, counters, now)
+		case <-ctx.Done():
+			log.Println("Daily summary worker stopped")
+			return
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package workers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeTestSummaryConfig() DailySummaryConfig {
+	return DailySummaryConfig{
+		SolarEnergyTopic: "solar_today",
+		Batteries: []SummaryBattery{
+			{Name: "Battery 2", ChargedTopic: "b2_in_today", DischargedTopic: "b2_out_today"},
+			{Name: "Battery 3", ChargedTopic: "b3_in_today"},
+		},
+		InverterEntityIDs:   []string{"switch.inv1", "switch.inv2"},
+		InverterStateTopics: []string{"inv1", "inv2"},
+	}
+}
+
+func TestDailyTally_Summary(t *testing.T) {
+	config := makeTestSummaryConfig()
+	t0 := time.Date(2026, 3, 4, 10, 0, 0, 0, time.Local)
+	tally := newDailyTally(config, t0)
+
+	data := DisplayData{TopicData: map[string]any{
+		"solar_today":  makeFloatTopic(12000),
+		"b2_in_today":  makeFloatTopic(5000),
+		"b2_out_today": makeFloatTopic(4000),
+		"b3_in_today":  makeFloatTopic(7000),
+		"inv1":         makeBoolTopic(true, "on"),
+		"inv2":         makeBoolTopic(false, "off"),
+	}}
+	overflow := BaselineDebugInfo{Modes: []ModeState{{Name: "Overflow", Contributing: true}}}
+	lowVoltage := BaselineDebugInfo{Battery2LowVoltage: true}
+
+	for i := range 60 {
+		now := t0.Add(time.Duration(i) * time.Second)
+		tally.Data(data, now)
+		if i < 30 {
+			tally.Debug(overflow, now)
+		} else {
+			tally.Debug(lowVoltage, now)
+		}
+	}
+	tally.Debug(BaselineDebugInfo{}, t0.Add(time.Minute))
+	tally.Debug(lowVoltage, t0.Add(time.Minute+time.Second))
+	tally.Data(data, t0.Add(time.Hour)) // gap capped at summaryMaxGap
+	data.TopicData["inv2"] = makeBoolTopic(true, "on")
+	tally.Data(data, t0.Add(time.Hour+time.Second))
+
+	summary := tally.Summary()
+	assert.Equal(t, "2026-03-04", summary.Date)
+	assert.Equal(t, 12000.0, summary.SolarWh)
+	assert.Equal(t, []BatteryDay{
+		{Name: "Battery 2", ChargedWh: 5000, DischargedWh: 4000},
+		{Name: "Battery 3", ChargedWh: 7000},
+	}, summary.Batteries)
+	assert.InDelta(t, (2 * time.Minute).Hours(), summary.InverterHours["switch.inv1"], 1e-9)
+	assert.Equal(t, 0.0, summary.InverterHours["switch.inv2"])
+	assert.Equal(t, 2, summary.LowVoltageEvents)
+	assert.InDelta(t, 0.5, summary.RuleMinutes["Overflow"], 1e-9)
+	assert.InDelta(t, 31.0/60, summary.RuleMinutes[ruleIdle], 1e-9, "nothing contributing from 30s to 61s")
+	assert.Equal(t, 1, summary.ModeTransitions, "Overflow to Idle")
+	assert.Equal(t, map[string]int{"switch.inv1": 0, "switch.inv2": 1}, summary.InverterSwitches)
+	assert.Equal(t, ruleIdle, summary.TopRule())
+
+	tally.reset(t0.AddDate(0, 0, 1))
+	assert.Equal(t, 0, tally.Summary().LowVoltageEvents)
+	assert.Equal(t, 0, tally.Summary().TotalSwitches())
+	assert.Equal(t, "2026-03-05", tally.Summary().Date)
+}
+
+func TestBaselineWinner(t *testing.T) {
+	assert.Equal(t, modeSafety, baselineWinner(BaselineDebugInfo{SafetyReason: "High frequency", Manual: true}))
+	assert.Equal(t, modeManual, baselineWinner(BaselineDebugInfo{Manual: true}))
+	assert.Equal(t, "Baseline", baselineWinner(BaselineDebugInfo{Modes: []ModeState{
+		{Name: "Overflow"},
+		{Name: "Baseline", Contributing: true},
+	}}))
+	assert.Equal(t, ruleIdle, baselineWinner(BaselineDebugInfo{}))
+}
+
+func TestPublishDailySummary(t *testing.T) {
+	ch := make(chan MQTTMessage, 4)
+	summary := DailySummary{
+		Date:             "2026-03-04",
+		SolarWh:          12345,
+		Batteries:        []BatteryDay{{Name: "Battery 2", ChargedWh: 5000, DischargedWh: 4000}},
+		InverterHours:    map[string]float64{"switch.inv1": 2, "switch.inv2": 1.5},
+		LowVoltageEvents: 1,
+		RuleMinutes:      map[string]float64{"Baseline": 600, "Overflow": 90},
+	}
+	publishDailySummary(NewMQTTSender(ch), summary, "notify.phone")
+
+	attributes := <-ch
+	assert.Equal(t, TopicDailySummaryAttributes, attributes.Topic)
+	var decoded struct {
+		SolarWh float64 `json:"solar_wh"`
+		Report  string  `json:"report"`
+	}
+	assert.NoError(t, json.Unmarshal(attributes.Payload, &decoded))
+	assert.Equal(t, 12345.0, decoded.SolarWh)
+	assert.Contains(t, decoded.Report, "| Solar | 12.3 kWh |")
+	assert.Contains(t, decoded.Report, "| Inverter hours | 3.5 h |")
+	assert.Less(t, strings.Index(decoded.Report, "Baseline"), strings.Index(decoded.Report, "Overflow"), "longest rule first")
+
+	state := <-ch
+	assert.Equal(t, TopicDailySummaryState, state.Topic)
+	assert.Equal(t, "2026-03-04", string(state.Payload))
+	assert.True(t, state.Retain)
+
+	var call proxyServiceCall
+	assert.NoError(t, json.Unmarshal((<-ch).Payload, &call))
+	assert.Equal(t, "notify.phone", call.EntityID)
+}
+
+func TestPublishCounters(t *testing.T) {
+	ch := make(chan MQTTMessage, 8)
+	publishCounters(NewMQTTSender(ch), NewChangeFilter(0), DailySummary{
+		RuleMinutes:      map[string]float64{"Baseline": 600, "Overflow": 90},
+		ModeTransitions:  7,
+		InverterSwitches: map[string]int{"switch.inv1": 3, "switch.inv2": 2},
+	}, time.Now())
+
+	published := map[string]string{}
+	for len(ch) > 0 {
+		msg := <-ch
+		published[msg.Topic] = string(msg.Payload)
+	}
+	assert.Equal(t, "Baseline", published["powerctl/sensor/"+ruleMinutesSensorID+"/state"])
+	assert.Equal(t, "7", published["powerctl/sensor/"+modeTransitionsSensorID+"/state"])
+	assert.Equal(t, "5", published["powerctl/sensor/"+inverterSwitchesSensorID+"/state"])
+	assert.JSONEq(t, `{"switch.inv1": 3, "switch.inv2": 2}`, published["powerctl/sensor/"+inverterSwitchesSensorID+"/attributes"])
+	assert.NotContains(t, published, "powerctl/sensor/"+modeTransitionsSensorID+"/attributes")
+}
@@ -0,0 +1,111 @@
+package workers
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+)
+
+// deadInvertersSensorID lists inverters switched on but not producing (see DeadInverters).
+const deadInvertersSensorID = "powerctl_dead_inverters"
+
+// DeadInverters flags inverters whose switch is on while their power stays under Watts
+// for After: a tripped DC breaker or failed unit that the switch state alone can't
+// show. A dead inverter is left out of the count (and switched off) until Retry has
+// passed, when it may be tried again, or until it is seen producing. Zero After
+// disables detection.
+type DeadInverters struct {
+	Watts float64
+	After time.Duration
+	Retry time.Duration
+
+	lowSince  []time.Time // when each inverter was first seen on and not producing
+	deadSince []time.Time // zero while not dead
+}
+
+// Update records each inverter's switch state and power, returning true if the set of
+// dead inverters changed.
+func (d *DeadInverters) Update(states []bool, powers []float64, now time.Time) bool {
+	if d.After <= 0 {
+		return false
+	}
+	if len(d.lowSince) != len(states) {
+		d.lowSince = make([]time.Time, len(states))
+		d.deadSince = make([]time.Time, len(states))
+	}
+
+	changed := false
+	for i, on := range states {
+		producing := i < len(powers) && powers[i] >= d.Watts
+		if !d.deadSince[i].IsZero() {
+			if producing || now.Sub(d.deadSince[i]) >= d.Retry {
+				d.deadSince[i], d.lowSince[i] = time.Time{}, time.Time{}
+				changed = true
+			}
+			continue
+		}
+		if !on || producing {
+			d.lowSince[i] = time.Time{}
+			continue
+		}
+		if d.lowSince[i].IsZero() {
+			d.lowSince[i] = now
+		}
+		if now.Sub(d.lowSince[i]) >= d.After {
+			d.deadSince[i] = now
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Dead reports whether inverter i is dead.
+func (d *DeadInverters) Dead(i int) bool {
+	return i < len(d.deadSince) && !d.deadSince[i].IsZero()
+}
+
+// Split separates inverters (and their states) into those available to the count and
+// those that are dead.
+func (d *DeadInverters) Split(inverters []InverterInfo, states []bool) (available []InverterInfo, availableStates []bool, dead []InverterInfo, deadStates []bool) {
+	for i, inv := range inverters {
+		on := i < len(states) && states[i]
+		if d.Dead(i) {
+			dead, deadStates = append(dead, inv), append(deadStates, on)
+		} else {
+			available, availableStates = append(available, inv), append(availableStates, on)
+		}
+	}
+	return available, availableStates, dead, deadStates
+}
+
+// inverterEntityIDs returns the switch entity ID of each inverter.
+func inverterEntityIDs(inverters []InverterInfo) []string {
+	entityIDs := make([]string, len(inverters))
+	for i, inv := range inverters {
+		entityIDs[i] = inv.EntityID
+	}
+	return entityIDs
+}
+
+// publishDeadInverters publishes the dead inverters sensor: the count, with their
+// switch entity IDs in the attributes.
+func publishDeadInverters(sender *MQTTSender, entityIDs []string) {
+	sender.Send(MQTTMessage{
+		Topic:   "powerctl/sensor/" + deadInvertersSensorID + "/state",
+		Payload: []byte(strconv.Itoa(len(entityIDs))),
+		QoS:     1,
+		Retain:  true,
+	})
+	payload, err := json.Marshal(map[string]any{"inverters": entityIDs})
+	if err != nil {
+		log.Printf("Dead inverters: encode attributes: %v\n", err)
+		return
+	}
+	sender.Send(MQTTMessage{
+		Topic:   "powerctl/sensor/" + deadInvertersSensorID + "/attributes",
+		Payload: payload,
+		QoS:     1,
+		Retain:  true,
+	})
+}
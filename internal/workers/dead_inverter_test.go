@@ -0,0 +1,84 @@
+package workers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadInverters_FlagsOnButNotProducing(t *testing.T) {
+	d := &DeadInverters{Watts: 20, After: 10 * time.Minute, Retry: time.Hour}
+	t0 := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	states := []bool{true, true, false}
+	powers := []float64{240, 0, 0}
+
+	assert.False(t, d.Update(states, powers, t0))
+	assert.False(t, d.Update(states, powers, t0.Add(9*time.Minute)))
+	assert.True(t, d.Update(states, powers, t0.Add(10*time.Minute)))
+	assert.False(t, d.Dead(0))
+	assert.True(t, d.Dead(1))
+	assert.False(t, d.Dead(2), "off inverters aren't judged")
+
+	inverters := []InverterInfo{{EntityID: "switch.a"}, {EntityID: "switch.b"}, {EntityID: "switch.c"}}
+	available, availableStates, dead, deadStates := d.Split(inverters, states)
+	assert.Equal(t, []string{"switch.a", "switch.c"}, inverterEntityIDs(available))
+	assert.Equal(t, []bool{true, false}, availableStates)
+	assert.Equal(t, []string{"switch.b"}, inverterEntityIDs(dead))
+	assert.Equal(t, []bool{true}, deadStates)
+}
+
+func TestDeadInverters_ProducingResetsTimer(t *testing.T) {
+	d := &DeadInverters{Watts: 20, After: 10 * time.Minute, Retry: time.Hour}
+	t0 := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	d.Update([]bool{true}, []float64{0}, t0)
+	d.Update([]bool{true}, []float64{200}, t0.Add(5*time.Minute))
+	assert.False(t, d.Update([]bool{true}, []float64{0}, t0.Add(12*time.Minute)))
+	assert.False(t, d.Dead(0), "the low spell restarted at 12m")
+}
+
+func TestDeadInverters_RetriedAfterRetry(t *testing.T) {
+	d := &DeadInverters{Watts: 20, After: 10 * time.Minute, Retry: time.Hour}
+	t0 := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	d.Update([]bool{true}, []float64{0}, t0)
+	d.Update([]bool{true}, []float64{0}, t0.Add(10*time.Minute))
+	assert.True(t, d.Dead(0))
+
+	// Switched off while dead, and stays excluded until the retry
+	assert.False(t, d.Update([]bool{false}, []float64{0}, t0.Add(30*time.Minute)))
+	assert.True(t, d.Dead(0))
+	assert.True(t, d.Update([]bool{false}, []float64{0}, t0.Add(70*time.Minute)))
+	assert.False(t, d.Dead(0))
+}
+
+func TestDeadInverters_Disabled(t *testing.T) {
+	d := &DeadInverters{}
+	t0 := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	assert.False(t, d.Update([]bool{true}, []float64{0}, t0))
+	assert.False(t, d.Update([]bool{true}, []float64{0}, t0.Add(time.Hour)))
+	assert.False(t, d.Dead(0))
+}
+
+func TestBaselineController_LeavesDeadInverterOut(t *testing.T) {
+	config := makeTestBaselineConfig()
+	config.DeadInverterWatts = 20
+	config.DeadInverterAfter = 10 * time.Minute
+	config.DeadInverterRetry = time.Hour
+	controller := newBaselineController(config, nil)
+	input := makeBaselineInput()
+	input.ManualMode = true
+	input.ManualInverterCount = 3
+	input.Battery2Voltage = 53.5 // clear of the low-voltage limit
+	input.InverterStates = []bool{true, true, true}
+	input.HasInverterOutput = true
+	input.InverterPowers = []float64{240, 0, 240}
+	t0 := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	count, _ := controller.Decide(input, t0)
+	assert.Equal(t, 3, count)
+	count, debug := controller.Decide(input, t0.Add(10*time.Minute))
+	assert.Equal(t, 2, count, "only two inverters left to run")
+	assert.Equal(t, 1, debug.DeadInverters)
+}
@@ -1,4 +1,4 @@
-package main
+package workers
 
 import (
 	"context"
@@ -21,11 +21,46 @@ func formatCombinedDebug(baseline BaselineDebugInfo, dynamic DynamicDebugInfo) s
 		modes := make([]ModeState, len(baseline.Modes))
 		copy(modes, baseline.Modes)
 		sort.Slice(modes, func(i, j int) bool { return modes[i].Watts > modes[j].Watts })
-		if len(modes) > 0 && modes[0].Watts != 0 {
+		if baseline.Manual {
+			rows = append(rows, [2]string{modeManual, "forced"})
+		} else if baseline.SelfConsumption {
+			rows = append(rows, [2]string{modeSelfConsumption, fmt.Sprintf("%.0f", baseline.RampTarget)})
+		} else if len(modes) > 0 && modes[0].Watts != 0 {
 			rows = append(rows, [2]string{modes[0].Name, fmt.Sprintf("%.0f", modes[0].Watts)})
 		}
+		if baseline.RampPressure != 0 {
+			rows = append(rows, [2]string{"Ramp", fmt.Sprintf("→%.0fW (%.0fWs)", baseline.RampTarget, baseline.RampPressure)})
+		}
+		if baseline.DwellHeld {
+			rows = append(rows, [2]string{"Dwell", "min on/off"})
+		}
+		if baseline.NegativePrice {
+			rows = append(rows, [2]string{"Negative Price", "no export"})
+		}
 		if baseline.Battery2LowVoltage {
-			rows = append(rows, [2]string{"Low Voltage", fmt.Sprintf("%d @ %.2fV", baseline.Battery2VoltageMaxInv, baseline.Battery2VoltageMin)})
+			value := fmt.Sprintf("%d @ %.2fV", baseline.Battery2VoltageMaxInv, baseline.Battery2VoltageMin)
+			if baseline.Battery2LVRecovering {
+				value += " (recovering)"
+			}
+			rows = append(rows, [2]string{"Low Voltage", value})
+		}
+		if baseline.TemperatureLimited {
+			rows = append(rows, [2]string{"Temperature", fmt.Sprintf("max %d", baseline.TemperatureMaxInv)})
+		}
+		if baseline.CoordinatorLimited {
+			rows = append(rows, [2]string{"PW2 Coordinator", fmt.Sprintf("max %d", baseline.CoordinatorCap)})
+		}
+		if baseline.ExportLimited {
+			rows = append(rows, [2]string{"Export Limit", fmt.Sprintf("max %d @ %.0fW", baseline.ExportMaxInv, baseline.ExportP99)})
+		}
+		if baseline.Curtailed {
+			rows = append(rows, [2]string{"Curtailed", "all off"})
+		}
+		if baseline.DeadInverters > 0 {
+			rows = append(rows, [2]string{"Dead", fmt.Sprintf("%d inverters", baseline.DeadInverters)})
+		}
+		if baseline.OutputCorrection != 0 {
+			rows = append(rows, [2]string{"Output", fmt.Sprintf("%+d (%.0f%%)", baseline.OutputCorrection, baseline.OutputRatio*100)})
 		}
 	}
 
@@ -90,7 +125,10 @@ func debugAggregatorWorker(
 		if output == lastOutput {
 			return
 		}
-		sender.CallService("input_text", "set_value", "input_text.powerhouse_control_debug", map[string]any{haServiceValueKey: output})
+		msg := serviceCallMessage("input_text", "set_value", "input_text.powerhouse_control_debug",
+			map[string]any{haServiceValueKey: output})
+		msg.Priority = PriorityDebug
+		sender.Send(msg)
 		lastOutput = output
 	}
 
@@ -0,0 +1,154 @@
+package workers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// debugRecording streams watch values to a CSV or NDJSON file (chosen by extension)
+// on every DisplayData update until its deadline, for offline tuning analysis.
+type debugRecording struct {
+	path   string
+	specs  []WatchSpec
+	until  time.Time
+	file   *os.File
+	buf    *bufio.Writer
+	csv    *csv.Writer // nil for NDJSON
+	rows   int
+	failed error
+}
+
+// newDebugRecording creates path and writes the CSV header. Recording runs until
+// now+duration.
+func newDebugRecording(path string, specs []WatchSpec, duration time.Duration, now time.Time) (*debugRecording, error) {
+	var ndjson bool
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+	case ".ndjson", ".jsonl", ".json":
+		ndjson = true
+	default:
+		return nil, fmt.Errorf("--out must end in .csv or .ndjson, got %q", path)
+	}
+
+	file, err := os.Create(path) //nolint:gosec // path typed at the debug prompt
+	if err != nil {
+		return nil, err
+	}
+	r := &debugRecording{
+		path:  path,
+		specs: specs,
+		until: now.Add(duration),
+		file:  file,
+		buf:   bufio.NewWriter(file),
+	}
+	if !ndjson {
+		r.csv = csv.NewWriter(r.buf)
+		header := []string{"timestamp"}
+		for _, spec := range specs {
+			header = append(header, spec.String())
+		}
+		r.failed = r.csv.Write(header)
+	}
+	return r, nil
+}
+
+// Write appends a row for data. Returns false once the recording is over (deadline
+// passed or a write failed); the caller then calls Close.
+func (r *debugRecording) Write(data DisplayData, now time.Time) bool {
+	if r.failed != nil || !now.Before(r.until) {
+		return false
+	}
+
+	timestamp := now.Format(time.RFC3339Nano)
+	if r.csv != nil {
+		row := []string{timestamp}
+		for _, spec := range r.specs {
+			row = append(row, spec.GetValue(data))
+		}
+		r.failed = r.csv.Write(row)
+	} else {
+		row := map[string]any{"timestamp": timestamp}
+		for _, spec := range r.specs {
+			value := spec.GetValue(data)
+			if f, err := strconv.ParseFloat(value, 64); err == nil {
+				row[spec.String()] = f
+			} else {
+				row[spec.String()] = value
+			}
+		}
+		line, err := json.Marshal(row)
+		if err == nil {
+			_, err = r.buf.Write(append(line, '\n'))
+		}
+		r.failed = err
+	}
+	if r.failed != nil {
+		return false
+	}
+	r.rows++
+	return true
+}
+
+// Close flushes and closes the file, returning the first error seen.
+func (r *debugRecording) Close() error {
+	if r.csv != nil {
+		r.csv.Flush()
+		if r.failed == nil {
+			r.failed = r.csv.Error()
+		}
+	}
+	if err := r.buf.Flush(); r.failed == nil {
+		r.failed = err
+	}
+	if err := r.file.Close(); r.failed == nil {
+		r.failed = err
+	}
+	return r.failed
+}
+
+// parseRecordArgs parses `record <topic...> --out <file> [--duration <d>]`. With no
+// topics the current watches are recorded.
+func parseRecordArgs(args []string, watches []WatchSpec) (out string, specs []WatchSpec, duration time.Duration, err error) {
+	duration = time.Hour
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--out":
+			if i+1 >= len(args) {
+				return "", nil, 0, fmt.Errorf("--out requires a file")
+			}
+			i++
+			out = args[i]
+		case "--duration":
+			if i+1 >= len(args) {
+				return "", nil, 0, fmt.Errorf("--duration requires a value (e.g. 1h, 30m)")
+			}
+			i++
+			duration, err = time.ParseDuration(args[i])
+			if err != nil || duration <= 0 {
+				return "", nil, 0, fmt.Errorf("invalid --duration %q", args[i])
+			}
+		default:
+			if strings.HasPrefix(args[i], "-") {
+				return "", nil, 0, fmt.Errorf("unknown option: %s", args[i])
+			}
+			specs = append(specs, WatchSpec{Topic: args[i]})
+		}
+	}
+	if out == "" {
+		return "", nil, 0, fmt.Errorf("usage: record [<topic>...] --out <file.csv|file.ndjson> [--duration 1h]")
+	}
+	if len(specs) == 0 {
+		specs = watches
+	}
+	if len(specs) == 0 {
+		return "", nil, 0, fmt.Errorf("nothing to record: name topics or add watches first")
+	}
+	return out, specs, duration, nil
+}
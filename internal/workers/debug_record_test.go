@@ -0,0 +1,75 @@
+package workers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRecordArgs(t *testing.T) {
+	watches := []WatchSpec{{Topic: "watched"}}
+
+	out, specs, duration, err := parseRecordArgs([]string{"a", "b", "--out", "x.csv", "--duration", "30m"}, watches)
+	assert.NoError(t, err)
+	assert.Equal(t, "x.csv", out)
+	assert.Equal(t, []WatchSpec{{Topic: "a"}, {Topic: "b"}}, specs)
+	assert.Equal(t, 30*time.Minute, duration)
+
+	// No topics records the watches, for an hour by default
+	_, specs, duration, err = parseRecordArgs([]string{"--out", "x.ndjson"}, watches)
+	assert.NoError(t, err)
+	assert.Equal(t, watches, specs)
+	assert.Equal(t, time.Hour, duration)
+
+	for _, args := range [][]string{
+		{"a"},
+		{"a", "--out"},
+		{"a", "--out", "x.csv", "--duration", "soon"},
+		{"a", "--out", "x.csv", "--bogus"},
+	} {
+		_, _, _, err = parseRecordArgs(args, watches)
+		assert.Error(t, err, args)
+	}
+	_, _, _, err = parseRecordArgs([]string{"--out", "x.csv"}, nil)
+	assert.Error(t, err)
+}
+
+func TestDebugRecording_CSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rec.csv")
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	specs := []WatchSpec{{Topic: "power"}, {Topic: "grid"}}
+	r, err := newDebugRecording(path, specs, time.Minute, now)
+	assert.NoError(t, err)
+
+	data := DisplayData{TopicData: map[string]any{"power": makeFloatTopic(1234.5), "grid": makeBoolTopic(true, "on")}}
+	assert.True(t, r.Write(data, now))
+	assert.False(t, r.Write(data, now.Add(time.Minute)), "deadline passed")
+	assert.NoError(t, r.Close())
+
+	contents, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "timestamp,power,grid\n2026-01-02T03:04:05Z,1234.50,on\n", string(contents))
+}
+
+func TestDebugRecording_NDJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rec.ndjson")
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	r, err := newDebugRecording(path, []WatchSpec{{Topic: "power"}, {Topic: "mode"}}, time.Minute, now)
+	assert.NoError(t, err)
+
+	data := DisplayData{TopicData: map[string]any{"power": makeFloatTopic(10), "mode": makeStringTopic("auto")}}
+	assert.True(t, r.Write(data, now))
+	assert.NoError(t, r.Close())
+
+	contents, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"timestamp":"2026-01-02T03:04:05Z","power":10,"mode":"auto"}`, string(contents))
+}
+
+func TestDebugRecording_RejectsUnknownExtension(t *testing.T) {
+	_, err := newDebugRecording(filepath.Join(t.TempDir(), "rec.txt"), []WatchSpec{{Topic: "a"}}, time.Minute, time.Now())
+	assert.Error(t, err)
+}
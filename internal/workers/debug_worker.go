@@ -1,7 +1,8 @@
-package main
+package workers
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -14,6 +15,7 @@ import (
 	"time"
 
 	"github.com/chzyer/readline"
+	"github.com/ryansname/powerctl/internal/stats"
 )
 
 // WatchSpec represents a topic to watch with optional time window and percentile
@@ -21,10 +23,14 @@ type WatchSpec struct {
 	Topic      string // Full topic path
 	Minutes    int    // 0 = current, 1/5/15 = time window
 	Percentile int    // 0 = current, 1/50/66/99 = percentile
+	Stat       string // "" = value above, "ema" / "rate" = FloatTopicData.EMA / Rate
 }
 
 // String returns a unique key for this watch spec
 func (w WatchSpec) String() string {
+	if w.Stat != "" {
+		return fmt.Sprintf("%s -s %s", w.Topic, w.Stat)
+	}
 	if w.Minutes == 0 && w.Percentile == 0 {
 		return w.Topic
 	}
@@ -41,12 +47,35 @@ func (w WatchSpec) ShortName() string {
 		name = parts[len(parts)-2] // Second to last part is usually the sensor name
 	}
 
+	if w.Stat != "" {
+		return name + " " + w.Stat
+	}
 	if w.Minutes == 0 && w.Percentile == 0 {
 		return name
 	}
 	return fmt.Sprintf("%s %dm p%d", name, w.Minutes, w.Percentile)
 }
 
+// Header returns ShortName with the topic's unit, if declared (see topicUnits).
+func (w WatchSpec) Header() string {
+	unit := topicUnit(w.Topic)
+	switch {
+	case unit == "":
+		return w.ShortName()
+	case w.Stat == "rate":
+		return fmt.Sprintf("%s (%s/s)", w.ShortName(), unit)
+	}
+	return fmt.Sprintf("%s (%s)", w.ShortName(), unit)
+}
+
+// unitLabel describes a declared unit for `list`, noting statsWorker's conversion.
+func unitLabel(unit Unit) string {
+	if unit.Normalized() != unit {
+		return fmt.Sprintf("%s → %s", unit, unit.Normalized())
+	}
+	return string(unit)
+}
+
 // GetValue extracts the value from DisplayData based on the watch spec
 func (w WatchSpec) GetValue(data DisplayData) string {
 	// Check if it's a string topic first
@@ -55,7 +84,7 @@ func (w WatchSpec) GetValue(data DisplayData) string {
 	}
 
 	// Check if it's a boolean topic
-	if boolData, ok := data.TopicData[w.Topic].(*BooleanTopicData); ok {
+	if boolData, ok := data.TopicData[w.Topic].(*stats.BooleanTopicData); ok {
 		if boolData.Current {
 			return "on"
 		}
@@ -69,9 +98,14 @@ func (w WatchSpec) GetValue(data DisplayData) string {
 	}
 
 	var value float64
-	if w.Minutes == 0 && w.Percentile == 0 {
+	switch {
+	case w.Stat == "ema":
+		value = floatData.EMA
+	case w.Stat == "rate":
+		value = floatData.Rate
+	case w.Minutes == 0 && w.Percentile == 0:
 		value = floatData.Current
-	} else {
+	default:
 		// Use GetPercentile with recover to handle unregistered percentiles gracefully
 		func() {
 			defer func() {
@@ -124,6 +158,8 @@ type DebugState struct {
 	latestData    *DisplayData
 	rl            *readline.Instance
 	prevValues    map[string]string // Track previous value per watch for change highlighting
+	heartbeats    *Heartbeats
+	recording     *debugRecording
 }
 
 // NewDebugState creates a new debug state
@@ -170,7 +206,7 @@ func (s *DebugState) RemoveWatch(spec WatchSpec) bool {
 func (s *DebugState) RemoveWatchFuzzy(topic string) bool {
 	// First try exact match (current value only)
 	for i, w := range s.watches {
-		if w.Topic == topic && w.Minutes == 0 && w.Percentile == 0 {
+		if w.Topic == topic && w.Minutes == 0 && w.Percentile == 0 && w.Stat == "" {
 			s.watches = slices.Delete(s.watches, i, i+1)
 			s.headerPrinted = false
 			log.Printf("Unwatched: %s", topic)
@@ -253,15 +289,21 @@ func (s *DebugState) ListTopics() {
 		// Show type indicator
 		var typeStr string
 		switch s.latestData.TopicData[topic].(type) {
-		case *FloatTopicData:
+		case *stats.FloatTopicData:
 			typeStr = "[float]"
-		case *StringTopicData:
+		case *stats.StringTopicData:
 			typeStr = "[string]"
-		case *BooleanTopicData:
+		case *stats.BooleanTopicData:
 			typeStr = "[bool]"
+		case *stats.JSONTopicData:
+			typeStr = "[json]"
 		default:
 			typeStr = "[?]"
 		}
+		if unit := topicUnits[topic]; unit != "" {
+			s.print("  %s %s (%s)", typeStr, topic, unitLabel(unit))
+			continue
+		}
 		s.print("  %s %s", typeStr, topic)
 	}
 }
@@ -275,13 +317,13 @@ func (s *DebugState) PrintHeader() {
 	// Calculate column widths
 	s.columnWidths = make([]int, len(s.watches))
 	for i, w := range s.watches {
-		s.columnWidths[i] = len(w.ShortName())
+		s.columnWidths[i] = len(w.Header())
 	}
 
 	// Build header line
 	parts := make([]string, 0, len(s.watches))
 	for i, w := range s.watches {
-		parts = append(parts, fmt.Sprintf("%*s", s.columnWidths[i], w.ShortName()))
+		parts = append(parts, fmt.Sprintf("%*s", s.columnWidths[i], w.Header()))
 	}
 	s.print("%s", strings.Join(parts, " | "))
 	s.headerPrinted = true
@@ -336,7 +378,7 @@ func (s *DebugState) PrintRow(data DisplayData) {
 // parseWatchSpec parses watch command arguments into a WatchSpec
 func parseWatchSpec(args []string) (*WatchSpec, error) {
 	if len(args) == 0 {
-		return nil, fmt.Errorf("usage: watch <topic> [-m <1|5|15>] [-p <1|50|66|99>]")
+		return nil, fmt.Errorf("usage: watch <topic> [-m <1|5|15>] [-p <1|50|66|99>] | [-s <ema|rate>]")
 	}
 
 	spec := &WatchSpec{
@@ -368,11 +410,24 @@ func parseWatchSpec(args []string) (*WatchSpec, error) {
 				return nil, fmt.Errorf("-p must be 1, 50, 66, or 99")
 			}
 			spec.Percentile = p
+		case "-s":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("-s requires a value (ema or rate)")
+			}
+			i++
+			if args[i] != "ema" && args[i] != "rate" {
+				return nil, fmt.Errorf("-s must be ema or rate")
+			}
+			spec.Stat = args[i]
 		default:
 			return nil, fmt.Errorf("unknown option: %s", args[i])
 		}
 	}
 
+	if spec.Stat != "" && (spec.Minutes != 0 || spec.Percentile != 0) {
+		return nil, fmt.Errorf("-s cannot be combined with -m or -p")
+	}
+
 	// If minutes specified but not percentile, default to P50
 	if spec.Minutes > 0 && spec.Percentile == 0 {
 		spec.Percentile = 50
@@ -385,6 +440,83 @@ func parseWatchSpec(args []string) (*WatchSpec, error) {
 	return spec, nil
 }
 
+// ListWorkers prints every supervised worker with its state, restarts, last heartbeat
+// and the workers it requires.
+func (s *DebugState) ListWorkers(now time.Time) {
+	workers := workerStatus.Workers()
+	s.print("%-32s %-10s %8s %10s  %-40s %s", "WORKER", "STATE", "RESTARTS", "HEARTBEAT", "REQUIRES", "LAST PANIC")
+	for _, w := range workers {
+		beat := "-"
+		if last := s.heartbeats.Last(w.Name); !last.IsZero() {
+			beat = now.Sub(last).Truncate(time.Second).String() + " ago"
+		}
+		requires := "-"
+		if len(w.Requires) > 0 {
+			requires = strings.Join(w.Requires, ",")
+		}
+		s.print("%-32s %-10s %8d %10s  %-40s %s", w.Name, w.State, w.Restarts, beat, requires, w.LastPanic)
+	}
+}
+
+// Why prints a controller's most recent decision inputs and outputs.
+func (s *DebugState) Why(worker string, now time.Time) {
+	d, ok := workerStatus.LastDecision(worker)
+	if !ok {
+		log.Printf("No decision recorded for %s (have: %s)", worker, strings.Join(workerStatus.DecisionWorkers(), ", "))
+		return
+	}
+	s.print("%s decided %s ago", worker, now.Sub(d.At).Truncate(time.Millisecond))
+	s.print("Inputs: %s", formatDecision(d.Inputs))
+	s.print("Outputs: %s", formatDecision(d.Outputs))
+}
+
+// formatDecision renders decision data as indented JSON, or Go syntax if it has values
+// JSON can't hold (NaN).
+func formatDecision(v any) string {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("%+v", v)
+	}
+	return string(out)
+}
+
+// StartRecording begins recording to a file, replacing any recording in progress.
+func (s *DebugState) StartRecording(args []string, now time.Time) {
+	out, specs, duration, err := parseRecordArgs(args, s.watches)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return
+	}
+	s.StopRecording()
+	recording, err := newDebugRecording(out, specs, duration, now)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return
+	}
+	s.recording = recording
+	log.Printf("Recording %d values to %s for %v", len(specs), out, duration)
+}
+
+// StopRecording closes the recording in progress, if any.
+func (s *DebugState) StopRecording() {
+	if s.recording == nil {
+		return
+	}
+	if err := s.recording.Close(); err != nil {
+		log.Printf("Recording to %s failed: %v", s.recording.path, err)
+	} else {
+		log.Printf("Recorded %d rows to %s", s.recording.rows, s.recording.path)
+	}
+	s.recording = nil
+}
+
+// Record writes data to the recording in progress, stopping it once it is over.
+func (s *DebugState) Record(data DisplayData, now time.Time) {
+	if s.recording != nil && !s.recording.Write(data, now) {
+		s.StopRecording()
+	}
+}
+
 // handleDebugCommand processes a debug command
 func handleDebugCommand(cmd string, state *DebugState) {
 	parts := strings.Fields(cmd)
@@ -416,8 +548,8 @@ func handleDebugCommand(cmd string, state *DebugState) {
 			log.Printf("Error: %v", err)
 			return
 		}
-		// If no -m/-p specified, use fuzzy match
-		if spec.Minutes == 0 && spec.Percentile == 0 {
+		// If no -m/-p/-s specified, use fuzzy match
+		if spec.Minutes == 0 && spec.Percentile == 0 && spec.Stat == "" {
 			state.RemoveWatchFuzzy(spec.Topic)
 		} else if !state.RemoveWatch(*spec) {
 			log.Printf("No watch found for: %s", spec.String())
@@ -426,6 +558,26 @@ func handleDebugCommand(cmd string, state *DebugState) {
 	case "list":
 		state.ListTopics()
 
+	case "workers":
+		state.ListWorkers(time.Now())
+
+	case "record":
+		if len(parts) == 2 && parts[1] == "stop" {
+			state.StopRecording()
+			return
+		}
+		state.StartRecording(parts[1:], time.Now())
+
+	case "why":
+		if len(parts) < 2 {
+			log.Printf("Usage: why <worker> (have: %s)", strings.Join(workerStatus.DecisionWorkers(), ", "))
+			return
+		}
+		state.Why(parts[1], time.Now())
+
+	case "version":
+		state.print("powerctl %s (%s)", version, buildCommit())
+
 	case "help":
 		fmt.Println("Commands:")
 		fmt.Println("  list                             - List all available topics")
@@ -433,9 +585,16 @@ func handleDebugCommand(cmd string, state *DebugState) {
 		fmt.Println("  watch <topic> -m <1|5|15>        - Watch time window (defaults to p50)")
 		fmt.Println("  watch <topic> -p <1|50|66|99>    - Watch percentile (defaults to 15m)")
 		fmt.Println("  watch <topic> -m 15 -p 66        - Watch specific window and percentile")
+		fmt.Println("  watch <topic> -s <ema|rate>      - Watch 1m moving average or rate of change (/s)")
 		fmt.Println("  unwatch <topic>                  - Remove watch (exact or fuzzy match)")
 		fmt.Println("  unwatch <topic> -m 15 -p 66      - Remove specific watch")
 		fmt.Println("  unwatch --all                    - Remove all watches")
+		fmt.Println("  record [<topic>...] --out <file> - Record values (default: watches) to .csv or .ndjson")
+		fmt.Println("         [--duration 1h]")
+		fmt.Println("  record stop                      - Stop recording")
+		fmt.Println("  workers                          - List workers, state, restarts, heartbeat and dependencies")
+		fmt.Println("  why <worker>                     - Show a controller's last decision inputs/outputs")
+		fmt.Println("  version                          - Show the build version and commit")
 		fmt.Println("  help                             - Show this help")
 
 	default:
@@ -467,7 +626,11 @@ func readlineLoop(
 		}
 		line = strings.TrimSpace(line)
 		if line != "" {
-			commandChan <- line
+			select {
+			case commandChan <- line:
+			case <-ctx.Done():
+				return
+			}
 		}
 	}
 }
@@ -487,8 +650,13 @@ func getHistoryFilePath() string {
 	return filepath.Join(powerctlCache, "debug_history")
 }
 
-// debugWorker provides interactive introspection of DisplayData
-func debugWorker(ctx context.Context, cancel context.CancelFunc, dataChan <-chan DisplayData) {
+// debugWorker provides interactive introspection of DisplayData and worker state
+func debugWorker(
+	ctx context.Context,
+	cancel context.CancelFunc,
+	dataChan <-chan DisplayData,
+	heartbeats *Heartbeats,
+) {
 	// Create readline instance with prompt and persistent history
 	rl, err := readline.NewEx(&readline.Config{
 		Prompt:      "> ",
@@ -512,6 +680,7 @@ func debugWorker(ctx context.Context, cancel context.CancelFunc, dataChan <-chan
 	commandChan := make(chan string, 10)
 	state := NewDebugState()
 	state.SetReadline(rl)
+	state.heartbeats = heartbeats
 
 	SafeGo(ctx, cancel, "readlineLoop", func(ctx context.Context) {
 		readlineLoop(ctx, cancel, rl, commandChan)
@@ -526,7 +695,9 @@ func debugWorker(ctx context.Context, cancel context.CancelFunc, dataChan <-chan
 			if len(state.watches) > 0 {
 				state.PrintRow(data)
 			}
+			state.Record(data, time.Now())
 		case <-ctx.Done():
+			state.StopRecording()
 			log.Println("Debug worker stopped")
 			return
 		}
@@ -0,0 +1,162 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// Diagnostic sensors on the Powerctl device, showing the controller's own health.
+const (
+	uptimeSensorID         = "powerctl_uptime"
+	mqttReconnectsSensorID = "powerctl_mqtt_reconnects"
+	messageRateSensorID    = "powerctl_message_rate"
+	workerRestartsSensorID = "powerctl_worker_restarts"
+	sendQueueDepthSensorID = "powerctl_send_queue_depth"
+	sendTimeoutsSensorID   = "powerctl_send_timeouts"
+	versionSensorID        = "powerctl_version"
+	commitSensorID         = "powerctl_commit"
+)
+
+// diagnosticsInterval is how often the diagnostic sensors are published.
+const diagnosticsInterval = 30 * time.Second
+
+// Diagnostics counts what the MQTT workers see for the diagnostic sensors. The counters
+// are safe for concurrent use; a nil *Diagnostics ignores them.
+type Diagnostics struct {
+	started    time.Time
+	connects   atomic.Int64
+	received   atomic.Int64
+	queueDepth atomic.Int64
+
+	// Used only by Sample
+	lastReceived int64
+	lastSample   time.Time
+}
+
+// DiagnosticsSample is one reading of the diagnostic sensors.
+type DiagnosticsSample struct {
+	Uptime         time.Duration
+	Reconnects     int64
+	MessageRate    float64 // Messages received per second since the previous sample
+	WorkerRestarts int     // Panics recovered by the supervisor, across all workers
+	QueueDepth     int64   // Outgoing messages waiting for the broker
+	SendTimeouts   int64   // Channel sends abandoned after sendTimeout (see sendWithin)
+}
+
+// NewDiagnostics starts counting from started, the process start.
+func NewDiagnostics(started time.Time) *Diagnostics {
+	return &Diagnostics{started: started, lastSample: started}
+}
+
+// Connected records a connection to the broker; every one after the first is a reconnect.
+func (d *Diagnostics) Connected() {
+	if d != nil {
+		d.connects.Add(1)
+	}
+}
+
+// Received records an incoming message.
+func (d *Diagnostics) Received() {
+	if d != nil {
+		d.received.Add(1)
+	}
+}
+
+// SetQueueDepth records the send queue's length.
+func (d *Diagnostics) SetQueueDepth(n int) {
+	if d != nil {
+		d.queueDepth.Store(int64(n))
+	}
+}
+
+// Sample reads the counters, with the message rate over the time since the last sample.
+// Called only by diagnosticsWorker.
+func (d *Diagnostics) Sample(status *WorkerStatus, now time.Time) DiagnosticsSample {
+	sample := DiagnosticsSample{
+		Uptime:       now.Sub(d.started),
+		Reconnects:   max(0, d.connects.Load()-1),
+		QueueDepth:   d.queueDepth.Load(),
+		SendTimeouts: sendTimeouts.Load(),
+	}
+
+	received := d.received.Load()
+	if elapsed := now.Sub(d.lastSample).Seconds(); elapsed > 0 {
+		sample.MessageRate = float64(received-d.lastReceived) / elapsed
+	}
+	d.lastReceived, d.lastSample = received, now
+
+	for _, w := range status.Workers() {
+		sample.WorkerRestarts += w.Restarts
+	}
+	return sample
+}
+
+// buildCommit returns the commit set at link time, or else the VCS revision go build
+// embedded, shortened, with "-dirty" for a modified tree; "unknown" for builds outside
+// a checkout (such as the add-on image).
+func buildCommit() string {
+	if commit != "" {
+		return commit
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	revision, modified := "", false
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+	if revision == "" {
+		return "unknown"
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return revision
+}
+
+// diagnosticsWorker publishes the diagnostic sensors: version and commit once (retained),
+// the counters every diagnosticsInterval.
+func diagnosticsWorker(ctx context.Context, diag *Diagnostics, status *WorkerStatus, sender *MQTTSender) {
+	log.Println("Diagnostics worker started")
+
+	for id, value := range map[string]string{versionSensorID: version, commitSensorID: buildCommit()} {
+		sender.Send(MQTTMessage{
+			Topic:   "powerctl/sensor/" + id + "/state",
+			Payload: []byte(value),
+			QoS:     1,
+			Retain:  true,
+		})
+	}
+
+	ticker := time.NewTicker(diagnosticsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			sample := diag.Sample(status, now)
+			sender.PublishDebugSensor(uptimeSensorID, sample.Uptime.Seconds())
+			sender.PublishDebugSensor(mqttReconnectsSensorID, float64(sample.Reconnects))
+			sender.PublishDebugSensor(messageRateSensorID, sample.MessageRate)
+			sender.PublishDebugSensor(workerRestartsSensorID, float64(sample.WorkerRestarts))
+			sender.PublishDebugSensor(sendQueueDepthSensorID, float64(sample.QueueDepth))
+			sender.PublishDebugSensor(sendTimeoutsSensorID, float64(sample.SendTimeouts))
+
+		case <-ctx.Done():
+			log.Println("Diagnostics worker stopped")
+			return
+		}
+	}
+}
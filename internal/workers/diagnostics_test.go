@@ -0,0 +1,57 @@
+package workers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiagnostics_Sample(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := NewDiagnostics(start)
+	status := NewWorkerStatus()
+	status.Declared("a", nil)
+	status.Started("a")
+	status.Stopped("a", "boom")
+	status.Stopped("a", "boom")
+	status.Declared("b", nil)
+	status.Stopped("b", "boom")
+
+	d.Connected()
+	for range 60 {
+		d.Received()
+	}
+	d.SetQueueDepth(7)
+
+	s := d.Sample(status, start.Add(30*time.Second))
+	assert.Equal(t, 30*time.Second, s.Uptime)
+	assert.Equal(t, int64(0), s.Reconnects, "the first connection isn't a reconnect")
+	assert.InDelta(t, 2.0, s.MessageRate, 0.001)
+	assert.Equal(t, 3, s.WorkerRestarts)
+	assert.Equal(t, int64(7), s.QueueDepth)
+
+	// The rate covers only the messages since the previous sample
+	d.Connected()
+	d.Connected()
+	for range 10 {
+		d.Received()
+	}
+	s = d.Sample(status, start.Add(40*time.Second))
+	assert.Equal(t, int64(2), s.Reconnects)
+	assert.InDelta(t, 1.0, s.MessageRate, 0.001)
+}
+
+func TestDiagnostics_NilIgnoresCounts(t *testing.T) {
+	var d *Diagnostics
+	assert.NotPanics(t, func() {
+		d.Connected()
+		d.Received()
+		d.SetQueueDepth(3)
+	})
+}
+
+func TestBuildCommit(t *testing.T) {
+	// Test binaries carry no VCS stamp, but the result must always be displayable
+	assert.NotEmpty(t, buildCommit())
+}
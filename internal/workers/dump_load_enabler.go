@@ -0,0 +1,190 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+
+	"github.com/ryansname/powerctl/governor"
+)
+
+const (
+	MinerWorkmodeEntity = "select.miner1_workmode_set"
+	// Topic to read current miner workmode from HA (self-published; see selfPublishedStringTopics in stats.go)
+	TopicMinerWorkmode = "homeassistant/select/miner1_workmode_set/state"
+
+	WorkmodeSuper    = "Super"
+	WorkmodeStandard = "Standard"
+	WorkmodeEco      = "Eco"
+	WorkmodeOff      = "Standby"
+
+	dumpLoadSwitchOn  = "on"
+	dumpLoadSwitchOff = "off"
+)
+
+// DumpLoadTier is one power level of a dump load. The tier is selected when more
+// than Watts of excess remains for the load, and Watts is then taken from the pool.
+type DumpLoadTier struct {
+	Watts  float64
+	Option string // Select option, or "on" for switch loads
+}
+
+// DumpLoad is a controllable load that soaks up excess power. Loads are listed in
+// priority order: earlier loads are fed first and shed last.
+type DumpLoad struct {
+	Name       string
+	Domain     string // "select" or "switch"
+	EntityID   string
+	StateTopic string
+	OffOption  string         // Select option (or "off") when the load gets no allocation
+	Tiers      []DumpLoadTier // Highest power first
+	MinDwell   time.Duration  // Desired option must hold this long before it's applied
+	DryRun     bool           // Log the desired option instead of commanding HA
+}
+
+// DumpLoadTopics returns the state topics needed to read back every load.
+func DumpLoadTopics(loads []DumpLoad) []string {
+	topics := make([]string, len(loads))
+	for i, load := range loads {
+		topics[i] = load.StateTopic
+	}
+	return topics
+}
+
+// MinerDumpLoad is the miner workmode select.
+var MinerDumpLoad = DumpLoad{
+	Name:       "Miner",
+	Domain:     "select",
+	EntityID:   MinerWorkmodeEntity,
+	StateTopic: TopicMinerWorkmode,
+	OffOption:  WorkmodeOff,
+	Tiers: []DumpLoadTier{
+		{Watts: 1700, Option: WorkmodeSuper},
+		{Watts: 1200, Option: WorkmodeStandard},
+		{Watts: 800, Option: WorkmodeEco},
+	},
+	MinDwell: 2 * time.Minute,
+	DryRun:   true, // Not yet enabled
+}
+
+// allocateDumpLoads assigns excess to loads in priority order, giving each the highest
+// tier that fits what's left. As excess falls, the lowest-priority loads lose their
+// allocation first.
+func allocateDumpLoads(loads []DumpLoad, excessWatts float64) []string {
+	options := make([]string, len(loads))
+	remaining := excessWatts
+	for i, load := range loads {
+		options[i] = load.OffOption
+		for _, tier := range load.Tiers {
+			if remaining > tier.Watts {
+				options[i] = tier.Option
+				remaining -= tier.Watts
+				break
+			}
+		}
+	}
+	return options
+}
+
+// commandDumpLoad sets a load to the given option via the HA service proxy.
+func commandDumpLoad(sender *MQTTSender, load DumpLoad, option string) {
+	switch load.Domain {
+	case "switch":
+		service := "turn_off"
+		if option == dumpLoadSwitchOn {
+			service = "turn_on"
+		}
+		sender.CallServiceExpecting("switch", service, load.EntityID, nil, load.StateTopic, option)
+	default:
+		sender.CallServiceExpecting("select", "select_option", load.EntityID,
+			map[string]any{"option": option}, load.StateTopic, option)
+	}
+}
+
+// dumpLoadEnabler controls dump loads based on excess power
+func dumpLoadEnabler(
+	ctx context.Context,
+	excessChan <-chan float64,
+	dataChan <-chan DisplayData,
+	loads []DumpLoad,
+	sender *MQTTSender,
+	audit *AuditLog,
+) {
+	log.Println("Dump load enabler started")
+
+	var latestExcess float64
+	excessReceived := false
+	// Last desired option per dry-run load, so the log only shows changes
+	dryRunOptions := make([]string, len(loads))
+	// Per-load dwell governors, seeded from HA state on the first tick
+	var dwells []*governor.Dwell[string]
+
+	for {
+		select {
+		case excessWatts := <-excessChan:
+			latestExcess = excessWatts
+			excessReceived = true
+
+		case data := <-dataChan:
+			// Wait until we've received at least one excess calculation
+			if !excessReceived {
+				continue
+			}
+
+			if dwells == nil {
+				dwells = make([]*governor.Dwell[string], len(loads))
+				for i, load := range loads {
+					dwells[i] = governor.NewDwell(data.GetString(load.StateTopic), load.MinDwell)
+				}
+			}
+
+			// Excess arrives with the car's share already removed (see evChargingWorker).
+			// Grid is out or a storm is coming: every Wh stays in the batteries.
+			// Curtailed: exporting costs money, so every load takes its top tier.
+			excess := latestExcess
+			shed := data.GetBoolean(TopicIslandModeState) || data.GetBoolean(TopicStormModeState)
+			curtailed := !shed && data.GetBoolean(TopicCurtailmentState)
+			if shed {
+				excess = 0
+			} else if curtailed {
+				excess = math.Inf(1)
+			}
+			allocated := allocateDumpLoads(loads, excess)
+
+			now := time.Now()
+			desired := make([]string, len(loads))
+			for i := range loads {
+				// Shedding for an outage or storm, or curtailing, skips the dwell
+				if shed || curtailed {
+					dwells[i].Force(allocated[i])
+				}
+				desired[i] = dwells[i].Update(allocated[i], now)
+			}
+
+			for i, load := range loads {
+				// Read actual state from Home Assistant via DisplayData
+				current := data.GetString(load.StateTopic)
+				if desired[i] == current {
+					continue
+				}
+				if load.DryRun {
+					if desired[i] != dryRunOptions[i] {
+						log.Printf("Dump load %s (dry run): excess=%.0fW, would change %s -> %s\n",
+							load.Name, excess, current, desired[i])
+						dryRunOptions[i] = desired[i]
+					}
+					continue
+				}
+				log.Printf("Dump load %s: excess=%.0fW, changing %s -> %s\n", load.Name, excess, current, desired[i])
+				commandDumpLoad(sender, load, desired[i])
+				audit.Record("dump-load", load.Name+" "+current+"→"+desired[i],
+					map[string]float64{"excess": excess})
+			}
+
+		case <-ctx.Done():
+			log.Println("Dump load enabler stopped")
+			return
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package workers
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeTestDumpLoads() []DumpLoad {
+	heater := DumpLoad{
+		Name:       "Water Heater",
+		Domain:     "switch",
+		EntityID:   "switch.water_heater",
+		StateTopic: "homeassistant/switch/water_heater/state",
+		OffOption:  dumpLoadSwitchOff,
+		Tiers:      []DumpLoadTier{{Watts: 2000, Option: dumpLoadSwitchOn}},
+	}
+	return []DumpLoad{MinerDumpLoad, heater}
+}
+
+func TestAllocateDumpLoads_MinerTiers(t *testing.T) {
+	loads := []DumpLoad{MinerDumpLoad}
+	assert.Equal(t, []string{WorkmodeSuper}, allocateDumpLoads(loads, 1800))
+	assert.Equal(t, []string{WorkmodeStandard}, allocateDumpLoads(loads, 1700))
+	assert.Equal(t, []string{WorkmodeEco}, allocateDumpLoads(loads, 900))
+	assert.Equal(t, []string{WorkmodeOff}, allocateDumpLoads(loads, 800))
+}
+
+func TestAllocateDumpLoads_PriorityOrder(t *testing.T) {
+	loads := makeTestDumpLoads()
+
+	// Enough for both: miner takes Super, heater gets the remainder
+	assert.Equal(t, []string{WorkmodeSuper, dumpLoadSwitchOn}, allocateDumpLoads(loads, 4000))
+
+	// Heater is shed first as excess falls
+	assert.Equal(t, []string{WorkmodeSuper, dumpLoadSwitchOff}, allocateDumpLoads(loads, 3000))
+	assert.Equal(t, []string{WorkmodeOff, dumpLoadSwitchOff}, allocateDumpLoads(loads, 500))
+}
+
+func TestAllocateDumpLoads_LowerPriorityUsesLeftover(t *testing.T) {
+	loads := makeTestDumpLoads()
+	// Miner takes Super (1700W), leaving 2100W for the heater
+	assert.Equal(t, []string{WorkmodeSuper, dumpLoadSwitchOn}, allocateDumpLoads(loads, 3800))
+}
+
+func TestAllocateDumpLoads_CurtailedRunsEveryLoadFlatOut(t *testing.T) {
+	assert.Equal(t, []string{WorkmodeSuper, dumpLoadSwitchOn}, allocateDumpLoads(makeTestDumpLoads(), math.Inf(1)))
+}
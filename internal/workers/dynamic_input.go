@@ -1,9 +1,10 @@
-package main
+package workers
 
 import (
 	"time"
 
-	"github.com/ryansname/powerctl/src/governor"
+	"github.com/ryansname/powerctl/governor"
+	"github.com/ryansname/powerctl/internal/stats"
 )
 
 // DynamicInputConfig holds the topics needed to extract DynamicInput from DisplayData.
@@ -11,7 +12,7 @@ type DynamicInputConfig struct {
 	HouseLoadTopic            string
 	Solar1PowerTopic          string
 	Solar2PowerTopic          string
-	Inverter1to9PowerTopics   []string
+	Inverter1to9PowerTopic    string // Computed sum of the inverter 1-9 power sensors
 	MultiplusACPowerTopic     string
 	Battery3SOCTopic          string
 	GridStatusTopic           string
@@ -23,7 +24,7 @@ type DynamicInputConfig struct {
 	CarChargingActiveTopic    string
 	CarBatterySOCTopic        string
 	CarBattery3CutoffTopic    string
-	Solar34PowerTopics        []string
+	Solar34PowerTopic         string // Computed sum of the Solar 3 and 4 power sensors
 	Battery3DCCurrentTopic    string
 	Battery3CCLTopic          string
 	Battery3CVLTopic          string
@@ -131,6 +132,7 @@ func (c DynamicInputConfig) Topics() []string {
 		c.HouseLoadTopic,
 		c.Solar1PowerTopic,
 		c.Solar2PowerTopic,
+		c.Inverter1to9PowerTopic,
 		c.MultiplusACPowerTopic,
 		c.Battery3SOCTopic,
 		c.GridStatusTopic,
@@ -142,6 +144,7 @@ func (c DynamicInputConfig) Topics() []string {
 		c.CarChargingActiveTopic,
 		c.CarBatterySOCTopic,
 		c.CarBattery3CutoffTopic,
+		c.Solar34PowerTopic,
 		c.Battery3DCCurrentTopic,
 		c.Battery3CCLTopic,
 		c.Battery3CVLTopic,
@@ -152,8 +155,6 @@ func (c DynamicInputConfig) Topics() []string {
 		c.ForecastRemainingTopic,
 		c.DetailedForecastTopic,
 	}
-	topics = append(topics, c.Inverter1to9PowerTopics...)
-	topics = append(topics, c.Solar34PowerTopics...)
 	return topics
 }
 
@@ -164,18 +165,17 @@ func ExtractDynamicInput(data DisplayData, config DynamicInputConfig) DynamicInp
 	carChargingEnabled := data.GetBoolean(config.CarChargingEnabledTopic)
 	carChargingActive := data.GetBoolean(config.CarChargingActiveTopic)
 
-	var forecast governor.ForecastPeriods
-	data.GetJSON(config.DetailedForecastTopic, &forecast)
+	forecast := data.GetForecastPeriods(config.DetailedForecastTopic)
 
 	return DynamicInput{
 		HouseLoad:             data.GetFloat(config.HouseLoadTopic).Current,
 		Solar1Power:           data.GetFloat(config.Solar1PowerTopic).Current,
 		Solar2Power:           data.GetFloat(config.Solar2PowerTopic).Current,
-		Inverter1to9Power:     -data.SumTopics(config.Inverter1to9PowerTopics),
+		Inverter1to9Power:     -data.GetFloat(config.Inverter1to9PowerTopic).Current,
 		MultiplusACPower:      data.GetFloat(config.MultiplusACPowerTopic).Current,
 		Battery3SOC:           data.GetFloat(config.Battery3SOCTopic).Current,
 		GridAvailable:         gridAvailable,
-		ACFreqP100_5Min:       data.GetPercentile(config.ACFrequencyTopic, P100, Window5Min),
+		ACFreqP100_5Min:       data.GetPercentile(config.ACFrequencyTopic, stats.P100, stats.Window5Min),
 		PowerwallSOC:          data.GetFloat(config.PowerwallSOCTopic).Current,
 		DynamicAutoEnabled:    dynamicAutoEnabled,
 		MultiplusSetpointCmd:  data.GetFloat(config.MultiplusSetpointCmdTopic).Current,
@@ -185,7 +185,7 @@ func ExtractDynamicInput(data DisplayData, config DynamicInputConfig) DynamicInp
 		CarBattery3Cutoff:     data.GetFloat(config.CarBattery3CutoffTopic).Current,
 		Tariff:                CurrentTariff(time.Now()),
 		Rebate:                InRebateWindow(time.Now()),
-		Solar34Power:          data.SumTopics(config.Solar34PowerTopics),
+		Solar34Power:          data.GetFloat(config.Solar34PowerTopic).Current,
 		Battery3ChargeCurrent: max(0, data.GetFloat(config.Battery3DCCurrentTopic).Current),
 		Battery3CCL:           data.GetFloat(config.Battery3CCLTopic).Current,
 		Battery3CVL:           data.GetFloat(config.Battery3CVLTopic).Current,
@@ -193,7 +193,7 @@ func ExtractDynamicInput(data DisplayData, config DynamicInputConfig) DynamicInp
 		Solar3BatteryCurrent:  data.GetFloat(config.Solar3BatteryCurrentTopic).Current,
 		Solar4BatteryCurrent:  data.GetFloat(config.Solar4BatteryCurrentTopic).Current,
 		PowerhouseNetPower:    data.GetFloat(config.PowerhouseNetPowerTopic).Current,
-		// Already in Wh: statsWorker converts this topic via kiloToBaseUnitTopics.
+		// Already in Wh: statsWorker normalizes this topic per topicUnits.
 		ForecastRemainingWh: data.GetFloat(config.ForecastRemainingTopic).Current,
 		DetailedForecast:    forecast,
 		Battery3CapacityWh:  config.Battery3CapacityWh,
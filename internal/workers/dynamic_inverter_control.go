@@ -1,4 +1,4 @@
-package main
+package workers
 
 import (
 	"context"
@@ -8,7 +8,7 @@ import (
 	"math"
 	"time"
 
-	"github.com/ryansname/powerctl/src/governor"
+	"github.com/ryansname/powerctl/governor"
 )
 
 const (
@@ -92,21 +92,21 @@ type DynamicInverterState struct {
 
 // DynamicDebugInfo contains mode states for the dynamic controller debug output.
 type DynamicDebugInfo struct {
-	Auto         bool
-	Priority     string
-	Setpoint     float64
-	Headroom     float64
-	HeadroomActive bool // true when the transfer-limit headroom is near/binding the setpoint
-	Battery3SOC  float64
-	Safety       bool
-	CarCharging  string  // "" = disabled, "active", or gate reason (e.g. "gated: soc")
-	CCLOverflowW    float64 // watts the CCL-overflow constraint requires as minimum discharge
-	CCLChargeMaxW   float64 // max charge W the CCL headroom allows (dynamicMaxChargeW when unrestricted)
-	CVLOverflowW    float64 // watts the CVL-overflow constraint requires as minimum discharge
-	B3ChargeMaxW    float64 // max charge W from forecast charge limit (dynamicMaxChargeW when unrestricted)
+	Auto               bool
+	Priority           string
+	Setpoint           float64
+	Headroom           float64
+	HeadroomActive     bool // true when the transfer-limit headroom is near/binding the setpoint
+	Battery3SOC        float64
+	Safety             bool
+	CarCharging        string  // "" = disabled, "active", or gate reason (e.g. "gated: soc")
+	CCLOverflowW       float64 // watts the CCL-overflow constraint requires as minimum discharge
+	CCLChargeMaxW      float64 // max charge W the CCL headroom allows (dynamicMaxChargeW when unrestricted)
+	CVLOverflowW       float64 // watts the CVL-overflow constraint requires as minimum discharge
+	B3ChargeMaxW       float64 // max charge W from forecast charge limit (dynamicMaxChargeW when unrestricted)
 	B3ExpectedFinalKwh float64 // projected EOD B3 energy from current SOC + forecast battery-side solar (no powerhouse charging)
-	B3DischargeMaxW float64 // max discharge W from B3 low-SOC taper (dynamicMaxDischargeW when unrestricted)
-	PWOffsetW       float64 // extra discharge W added to intent from the Powerwall-low offset
+	B3DischargeMaxW    float64 // max discharge W from B3 low-SOC taper (dynamicMaxDischargeW when unrestricted)
+	PWOffsetW          float64 // extra discharge W added to intent from the Powerwall-low offset
 }
 
 // DynamicModeConstraint encodes a mode's desired setpoint and its allowed range.
@@ -216,6 +216,7 @@ func cvlOverflowConstraint(voltage, cvl, solar34W float64) DynamicModeConstraint
 //     the limit (the Multiplus may still charge the remaining headroom).
 //   - headroomA < 0: solar alone already exceeds the limit, so force MinDischarge of the excess
 //     (−headroomA × voltage) to relieve MPPT throttling.
+//
 // Returns no constraint when voltage is unavailable (0V at startup).
 func cclOverflowConstraint(solar3A, solar4A, ccl, voltage float64) DynamicModeConstraint {
 	if voltage <= 0 {
@@ -371,9 +372,10 @@ func calculateDynamicSetpoint(
 	input DynamicInput,
 	state *DynamicInverterState,
 ) (float64, DynamicDebugInfo) {
-	state.houseLoadMax.Update(input.HouseLoad)
-	state.houseSideGeneration.Update(input.Solar1Power + input.Inverter1to9Power)
-	state.cvlVoltageMax.Update(input.Battery3Voltage)
+	now := time.Now()
+	state.houseLoadMax.Update(input.HouseLoad, now)
+	state.houseSideGeneration.Update(input.Solar1Power+input.Inverter1to9Power, now)
+	state.cvlVoltageMax.Update(input.Battery3Voltage, now)
 
 	busLoad := input.PowerhouseNetPower + input.MultiplusACPower
 	headroom := dynamicTransferLimit - busLoad
@@ -407,7 +409,6 @@ func calculateDynamicSetpoint(
 	// socLimit caps MaxCharge to whatever powerhouse charging B3 needs to reach target by solar
 	// end given the forecast (transfer-limit MinCharge still wins via lo>hi).
 	// phChargeLimit prevents charging from drawing power through the cable from the house side.
-	now := time.Now()
 	smoothedForecastWh := state.updateForecastSmoothing(input.ForecastRemainingWh, now)
 	socLimit := b3ForecastChargeLimit(
 		input.Battery3SOC,
@@ -563,6 +564,7 @@ func dynamicInverterControl(
 				default:
 				}
 			}
+			workerStatus.RecordDecision("dynamic-inverter-control", input, debug)
 
 		case <-ticker.C:
 			send(lastSetpoint)
@@ -1,10 +1,10 @@
-package main
+package workers
 
 import (
 	"testing"
 	"time"
 
-	"github.com/ryansname/powerctl/src/governor"
+	"github.com/ryansname/powerctl/governor"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -602,8 +602,8 @@ func TestCalculateDynamic_Headroom(t *testing.T) {
 func TestForecastSmoothing_RunningMinWithinDay(t *testing.T) {
 	s := &DynamicInverterState{}
 	day := time.Date(2026, 6, 13, 9, 0, 0, 0, time.Local)
-	assert.InDelta(t, 5000.0, s.updateForecastSmoothing(5000, day), 0.001)                // first → set
-	assert.InDelta(t, 3000.0, s.updateForecastSmoothing(3000, day.Add(time.Hour)), 0.001) // lower → tracks down
+	assert.InDelta(t, 5000.0, s.updateForecastSmoothing(5000, day), 0.001)                  // first → set
+	assert.InDelta(t, 3000.0, s.updateForecastSmoothing(3000, day.Add(time.Hour)), 0.001)   // lower → tracks down
 	assert.InDelta(t, 3000.0, s.updateForecastSmoothing(8000, day.Add(2*time.Hour)), 0.001) // higher → held
 }
 
@@ -864,7 +864,7 @@ func TestCalculateDynamic_PWOffset_CappedByB3DischargeLimit(t *testing.T) {
 // TestDynamicOverflowScenario is a scratch test for manual exploration.
 // Edit the values under "Scenario inputs" and run:
 //
-//	nix-shell --run 'go test ./src/... -run TestDynamicOverflowScenario -v'
+//	nix-shell --run 'go test ./internal/workers -run TestDynamicOverflowScenario -v'
 //
 // Each row shows one tick (≈1 second of real time). No ramp — the CCL overflow
 // constraint is instantaneous and stateless, so convergence happens immediately.
@@ -0,0 +1,153 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+)
+
+// energyTodayPublishInterval is how often energyTodayWorker publishes the totals to HA.
+const energyTodayPublishInterval = time.Minute
+
+// solarEnergyTodayID is the spec integrating every solar array's output.
+const solarEnergyTodayID = "solar_energy_today"
+
+// EnergyTodaySpec defines a synthetic topic holding the energy (Wh) delivered by a set
+// of power topics (W) since local midnight. statsWorker integrates it and exposes it in
+// DisplayData under EnergyTodayTopic.
+type EnergyTodaySpec struct {
+	ID          string   // Sensor ID, e.g. "solar_energy_today"
+	Name        string   // Home Assistant entity name
+	PowerTopics []string // Summed; negative readings (e.g. inverter standby) count as 0
+}
+
+// EnergyTodayTopic returns the synthetic topic, which is also the HA state topic.
+func (s EnergyTodaySpec) EnergyTodayTopic() string {
+	return "powerctl/sensor/" + s.ID + "/state"
+}
+
+// energyTodaySpecs lists the integrated topics. Specs built from runtime config are
+// added with registerEnergyToday.
+var energyTodaySpecs = []EnergyTodaySpec{
+	{
+		ID:   solarEnergyTodayID,
+		Name: "Solar Energy Today",
+		PowerTopics: []string{
+			TopicSolar1Power,
+			topicSolar2ACPower,
+			"homeassistant/sensor/solar_5_solar_power/state",
+		},
+	},
+}
+
+// registerEnergyToday adds a spec to energyTodaySpecs. Must be called before
+// statsWorker starts.
+func registerEnergyToday(spec EnergyTodaySpec) {
+	energyTodaySpecs = append(energyTodaySpecs, spec)
+}
+
+// EnergyTodayTopics returns the power topics read by every registered spec.
+func EnergyTodayTopics() []string {
+	var topics []string
+	for _, spec := range energyTodaySpecs {
+		topics = append(topics, spec.PowerTopics...)
+	}
+	return topics
+}
+
+// energyIntegrator accumulates one EnergyTodaySpec. Each power reading is held until
+// the next one (matching the time weighting of the percentiles). Totals are in memory
+// only, so a restart starts the day again from 0; HA's total_increasing state class
+// treats the drop as a meter reset.
+type energyIntegrator struct {
+	spec   EnergyTodaySpec
+	power  map[string]float64 // topic -> latest watts
+	energy float64            // Wh since midnight
+	last   time.Time
+}
+
+func newEnergyIntegrator(spec EnergyTodaySpec) *energyIntegrator {
+	return &energyIntegrator{spec: spec, power: make(map[string]float64)}
+}
+
+// Advance integrates the current power up to now, restarting from 0 at local midnight.
+func (e *energyIntegrator) Advance(now time.Time) {
+	if e.last.IsZero() {
+		e.last = now
+		return
+	}
+	if !now.After(e.last) {
+		return
+	}
+
+	var watts float64
+	for _, w := range e.power {
+		watts += w
+	}
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if e.last.Before(midnight) {
+		e.energy = watts * now.Sub(midnight).Hours()
+	} else {
+		e.energy += watts * now.Sub(e.last).Hours()
+	}
+	e.last = now
+}
+
+// SetPower records a new reading for topic, integrating the previous one up to now.
+func (e *energyIntegrator) SetPower(topic string, watts float64, now time.Time) {
+	e.Advance(now)
+	e.power[topic] = max(0, watts)
+}
+
+// newEnergyIntegrators creates an integrator per registered spec, indexed by the power
+// topics that feed it.
+func newEnergyIntegrators() (all []*energyIntegrator, byTopic map[string][]*energyIntegrator) {
+	byTopic = make(map[string][]*energyIntegrator)
+	for _, spec := range energyTodaySpecs {
+		e := newEnergyIntegrator(spec)
+		all = append(all, e)
+		for _, topic := range spec.PowerTopics {
+			byTopic[topic] = append(byTopic[topic], e)
+		}
+	}
+	return all, byTopic
+}
+
+// energyTodayWorker publishes the energy-today topics to their HA sensors.
+func energyTodayWorker(ctx context.Context, dataChan <-chan DisplayData, sender *MQTTSender) {
+	log.Println("Energy today worker started")
+
+	var lastPublish time.Time
+	filter := NewChangeFilter(0)
+	for {
+		select {
+		case data := <-dataChan:
+			now := time.Now()
+			if now.Sub(lastPublish) < energyTodayPublishInterval {
+				continue
+			}
+			lastPublish = now
+			for _, spec := range energyTodaySpecs {
+				topic := spec.EnergyTodayTopic()
+				if _, ok := data.TopicData[topic]; !ok {
+					continue
+				}
+				payload := strconv.FormatFloat(data.GetFloat(topic).Current, 'f', 0, 64)
+				if !filter.ChangedPayload(topic, payload, now) {
+					continue
+				}
+				sender.Send(MQTTMessage{
+					Topic:   topic,
+					Payload: []byte(payload),
+					QoS:     0,
+					Retain:  false,
+				})
+			}
+
+		case <-ctx.Done():
+			log.Println("Energy today worker stopped")
+			return
+		}
+	}
+}
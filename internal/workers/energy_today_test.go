@@ -0,0 +1,42 @@
+package workers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnergyIntegrator_SumsTopicsOverTime(t *testing.T) {
+	e := newEnergyIntegrator(EnergyTodaySpec{ID: "test", PowerTopics: []string{"a", "b"}})
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.Local)
+
+	e.SetPower("a", 1000, start)
+	e.SetPower("b", 500, start.Add(30*time.Minute)) // a alone for 30m: 500Wh
+	e.Advance(start.Add(time.Hour))                 // a+b for 30m: 750Wh
+
+	assert.InDelta(t, 1250.0, e.energy, 0.001)
+}
+
+func TestEnergyIntegrator_NegativePowerIgnored(t *testing.T) {
+	e := newEnergyIntegrator(EnergyTodaySpec{ID: "test", PowerTopics: []string{"a"}})
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.Local)
+
+	e.SetPower("a", -5, start)
+	e.Advance(start.Add(time.Hour))
+
+	assert.Equal(t, 0.0, e.energy)
+}
+
+func TestEnergyIntegrator_ResetsAtMidnight(t *testing.T) {
+	e := newEnergyIntegrator(EnergyTodaySpec{ID: "test", PowerTopics: []string{"a"}})
+	start := time.Date(2026, 3, 1, 23, 0, 0, 0, time.Local)
+
+	e.SetPower("a", 100, start)
+	e.Advance(start.Add(30 * time.Minute))
+	assert.InDelta(t, 50.0, e.energy, 0.001)
+
+	// Only the 15 minutes after midnight count towards the new day
+	e.Advance(start.Add(75 * time.Minute))
+	assert.InDelta(t, 25.0, e.energy, 0.001)
+}
@@ -0,0 +1,100 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"strings"
+)
+
+// Car topics for EV charging coordination.
+const (
+	TopicCarLocation     = "homeassistant/device_tracker/plb942_location_tracker/state"
+	TopicCarChargerPower = "homeassistant/sensor/plb942_charger_power/state"
+)
+
+// evReservedSensorID is the powerctl debug sensor carrying the watts reserved for the car.
+// powerctl subscribes to its state topic so the baseline controller can request inverters.
+const evReservedSensorID = "powerctl_ev_reserved_power"
+
+// TopicEVReservedPower is the state topic for the EV reserved power sensor.
+const TopicEVReservedPower = "powerctl/sensor/" + evReservedSensorID + "/state"
+
+// EVChargingConfig configures how much excess is set aside for the car.
+type EVChargingConfig struct {
+	ReserveShare     float64 // Fraction of excess reserved while the car is home and charging
+	ChargingMinWatts float64 // Charger draw above this counts as actively charging
+}
+
+// EVChargingTopics returns the statestream topics the EV charging worker needs.
+func EVChargingTopics() []string {
+	return []string{TopicCarLocation, TopicCarChargerPower, TopicEVReservedPower}
+}
+
+// EVInput holds the inputs for one EV reservation evaluation.
+type EVInput struct {
+	Home         bool
+	ChargerPower float64 // W
+}
+
+// ExtractEVInput reads EV inputs from DisplayData. device_tracker reports "home"
+// (HA lowercases zone names for the home zone).
+func ExtractEVInput(data DisplayData) EVInput {
+	return EVInput{
+		Home:         strings.EqualFold(data.GetString(TopicCarLocation), "home"),
+		ChargerPower: data.GetFloat(TopicCarChargerPower).Current,
+	}
+}
+
+// evReservedWatts returns the share of excess reserved for the car while it is home and
+// charging. The car's actual draw is already consuming excess, so it sets the floor;
+// excess caps the reservation.
+func evReservedWatts(in EVInput, excessWatts float64, config EVChargingConfig) float64 {
+	if !in.Home || in.ChargerPower <= config.ChargingMinWatts || excessWatts <= 0 {
+		return 0
+	}
+	reserved := max(excessWatts*config.ReserveShare, in.ChargerPower)
+	return min(reserved, excessWatts)
+}
+
+// evChargingWorker sits between powerExcessCalculator and dumpLoadEnabler: it subtracts
+// the car's reservation from excess before the dump load sees it, and publishes the
+// reservation so the baseline controller can supply it with inverters.
+func evChargingWorker(
+	ctx context.Context,
+	excessInChan <-chan float64,
+	excessOutChan chan<- float64,
+	dataChan <-chan DisplayData,
+	config EVChargingConfig,
+	sender *MQTTSender,
+) {
+	log.Println("EV charging worker started")
+
+	var in EVInput
+	var lastReserved float64
+
+	for {
+		select {
+		case data := <-dataChan:
+			in = ExtractEVInput(data)
+
+		case excess := <-excessInChan:
+			reserved := evReservedWatts(in, excess, config)
+			if (reserved > 0) != (lastReserved > 0) {
+				log.Printf("EV charging: reserving %.0fW of %.0fW excess (home=%v, charger %.0fW)\n",
+					reserved, excess, in.Home, in.ChargerPower)
+			}
+			lastReserved = reserved
+			sender.PublishDebugSensor(evReservedSensorID, reserved)
+
+			select {
+			case excessOutChan <- excess - reserved:
+			case <-ctx.Done():
+				return
+			}
+
+		case <-ctx.Done():
+			log.Println("EV charging worker stopped")
+			return
+		}
+	}
+}
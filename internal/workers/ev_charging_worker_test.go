@@ -0,0 +1,44 @@
+package workers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeTestEVConfig() EVChargingConfig {
+	return EVChargingConfig{ReserveShare: 0.5, ChargingMinWatts: 100}
+}
+
+func TestEvReservedWatts_AwayOrIdle(t *testing.T) {
+	config := makeTestEVConfig()
+	assert.InDelta(t, 0.0, evReservedWatts(EVInput{Home: false, ChargerPower: 2000}, 1900, config), 1e-9)
+	assert.InDelta(t, 0.0, evReservedWatts(EVInput{Home: true, ChargerPower: 0}, 1900, config), 1e-9,
+		"home but not charging")
+}
+
+func TestEvReservedWatts_ShareOfExcess(t *testing.T) {
+	// Charging at 500W, half of 1900W excess is larger
+	got := evReservedWatts(EVInput{Home: true, ChargerPower: 500}, 1900, makeTestEVConfig())
+	assert.InDelta(t, 950.0, got, 1e-9)
+}
+
+func TestEvReservedWatts_ChargerDrawIsFloorCappedByExcess(t *testing.T) {
+	config := makeTestEVConfig()
+	assert.InDelta(t, 1500.0, evReservedWatts(EVInput{Home: true, ChargerPower: 1500}, 1900, config), 1e-9)
+	assert.InDelta(t, 1000.0, evReservedWatts(EVInput{Home: true, ChargerPower: 7000}, 1000, config), 1e-9)
+}
+
+func TestSelectBaselineMode_EVReservationRequestsInverters(t *testing.T) {
+	config := makeTestBaselineConfig()
+	state := makeBlankBaselineState(config)
+	input := makeBaselineInput()
+	input.EVReservedWatts = 500 // ceil(500/255) = 2
+
+	count, debug := selectBaselineMode(input, config, state, time.Now())
+	assert.Equal(t, 2, count)
+	evMode := findMode(debug.Modes, modeEV)
+	assert.NotNil(t, evMode)
+	assert.True(t, evMode.Contributing)
+}
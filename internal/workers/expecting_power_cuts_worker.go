@@ -1,4 +1,4 @@
-package main
+package workers
 
 import (
 	"context"
@@ -6,7 +6,7 @@ import (
 	"log"
 	"time"
 
-	"github.com/ryansname/powerctl/src/governor"
+	"github.com/ryansname/powerctl/governor"
 )
 
 // TopicExpectingPowerCutsState is the state topic for the expecting power cuts switch.
@@ -24,6 +24,7 @@ const powerCutVoteSource = "power-cut"
 // expectingPowerCutsWorker prepares the house for an anticipated power cut:
 // raises PW2 backup reserve, turns off the hot water cylinder, and votes for
 // PW2 discharge when SOC is high (hysteresis: on at >=90%, off at <=85%).
+// Storm mode also raises the backup reserve, but nothing else.
 // Discharge is requested via the arbiter vote channel rather than by writing
 // the discharge switch directly.
 func expectingPowerCutsWorker(
@@ -31,6 +32,7 @@ func expectingPowerCutsWorker(
 	dataChan <-chan DisplayData,
 	voteChan chan<- DischargeRequest,
 	sender *MQTTSender,
+	tesla TeslaClient,
 ) {
 	log.Println("Expecting power cuts worker started")
 
@@ -70,8 +72,8 @@ func expectingPowerCutsWorker(
 					reason = fmt.Sprintf("armed, SOC %.1f%% below 90%%", soc)
 				}
 			}
-			if want != lastVote || reason != lastVoteReason {
-				voteChan <- DischargeRequest{Source: powerCutVoteSource, Want: want, Reason: reason}
+			req := DischargeRequest{Source: powerCutVoteSource, Want: want, Reason: reason}
+			if (want != lastVote || reason != lastVoteReason) && sendWithin(ctx, voteChan, req, sendTimeout, "Power cut vote") {
 				lastVote = want
 				lastVoteReason = reason
 			}
@@ -82,14 +84,20 @@ func expectingPowerCutsWorker(
 
 			backupReserve := data.GetFloat(TopicPW2BackupReserve).Current
 			hotWaterOn := data.GetBoolean(TopicHotWaterCylinderState)
+			holdReserve := enabled || data.GetBoolean(TopicStormModeState)
 
-			if enabled && backupReserve < 50 {
+			if holdReserve && backupReserve < 50 {
 				log.Println("Power cut prep: setting PW2 backup reserve to 50%")
-				setBackupReserve(sender, 50)
+				if err := tesla.SetBackupReserve(50); err != nil {
+					log.Printf("Power cut prep: %v\n", err)
+				}
 				lastCommandSent = time.Now()
-			} else if !enabled && backupReserve >= 50 {
+			} else if !holdReserve && backupReserve == 50 {
+				// Only our own 50%: a higher reserve may be the arbiter holding a grid charge floor
 				log.Println("Power cut prep over: restoring PW2 backup reserve to 10%")
-				setBackupReserve(sender, 10)
+				if err := tesla.SetBackupReserve(pw2DefaultReserve); err != nil {
+					log.Printf("Power cut prep over: %v\n", err)
+				}
 				lastCommandSent = time.Now()
 			}
 
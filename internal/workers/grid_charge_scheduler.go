@@ -0,0 +1,92 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// TopicGridChargeState is the state topic for the powerctl_grid_charge switch that arms
+// the grid charge scheduler.
+const TopicGridChargeState = "homeassistant/switch/powerctl_grid_charge/state"
+
+// gridChargeVoteSource is the source name this scheduler uses on the discharge vote channel.
+const gridChargeVoteSource = "grid-charge"
+
+// GridChargeConfig configures overnight Powerwall charging from the grid.
+type GridChargeConfig struct {
+	Window     DischargeWindow // When charging may happen, e.g. 00:00–07:00
+	PriceTopic string          // HA electricity price sensor
+	MaxPrice   float64         // Only charge when price is at or below this
+	TargetSOC  float64         // Morning SOC to charge to (%)
+}
+
+// Topics returns the statestream topics the scheduler reads.
+func (c GridChargeConfig) Topics() []string {
+	return []string{TopicGridChargeState, PowerwallSOCTopic, c.PriceTopic}
+}
+
+// GridChargeInput holds the inputs for one scheduler evaluation.
+type GridChargeInput struct {
+	Armed bool
+	Price float64
+	SOC   float64
+}
+
+// EvaluateGridCharge returns the scheduler's request for this tick. While charging it
+// vetoes discharge and asks the arbiter to hold the backup reserve at TargetSOC, which
+// makes the Powerwall charge from the grid up to it. Otherwise it has no opinion and
+// the arbiter restores the normal reserve.
+func EvaluateGridCharge(config GridChargeConfig, in GridChargeInput, now time.Time) DischargeRequest {
+	req := DischargeRequest{Source: gridChargeVoteSource, Want: VoteNoOpinion}
+	switch {
+	case !in.Armed:
+		req.Reason = "disarmed"
+	case !config.Window.contains(now):
+		req.Reason = "outside charge window"
+	case in.Price > config.MaxPrice:
+		req.Reason = fmt.Sprintf("price %.3f above %.3f", in.Price, config.MaxPrice)
+	default:
+		req.Want = VoteOff
+		req.ReserveFloor = config.TargetSOC
+		req.Reason = fmt.Sprintf("price %.3f, charging to %.0f%% (SOC %.1f%%)", in.Price, config.TargetSOC, in.SOC)
+		if in.SOC >= config.TargetSOC {
+			req.Reason = fmt.Sprintf("price %.3f, holding %.0f%%", in.Price, config.TargetSOC)
+		}
+	}
+	return req
+}
+
+// gridChargeScheduler asks the discharge arbiter to charge the Powerwall from the grid
+// overnight while armed and the price is low enough.
+func gridChargeScheduler(
+	ctx context.Context,
+	dataChan <-chan DisplayData,
+	config GridChargeConfig,
+	voteChan chan<- DischargeRequest,
+) {
+	log.Println("Grid charge scheduler started")
+
+	var last DischargeRequest
+	for {
+		select {
+		case data := <-dataChan:
+			in := GridChargeInput{
+				Armed: data.GetBoolean(TopicGridChargeState),
+				Price: data.GetFloat(config.PriceTopic).Current,
+				SOC:   data.GetFloat(PowerwallSOCTopic).Current,
+			}
+
+			req := EvaluateGridCharge(config, in, time.Now())
+			if req != last && sendWithin(ctx, voteChan, req, sendTimeout, "Grid charge vote") {
+				log.Printf("Grid charge scheduler: %s\n", req.Reason)
+				last = req
+			}
+
+		case <-ctx.Done():
+			log.Println("Grid charge scheduler stopped")
+			return
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package workers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeTestGridChargeConfig() GridChargeConfig {
+	return GridChargeConfig{
+		Window:     DischargeWindow{StartMinute: 0, EndMinute: 7 * 60},
+		PriceTopic: "ha/sensor/import_price/state",
+		MaxPrice:   0.15,
+		TargetSOC:  80,
+	}
+}
+
+var gridChargeTestNight = time.Date(2025, 6, 4, 1, 0, 0, 0, time.Local)
+
+func TestEvaluateGridCharge_CheapNightVetoesAndHoldsReserve(t *testing.T) {
+	req := EvaluateGridCharge(makeTestGridChargeConfig(), GridChargeInput{Armed: true, Price: 0.10, SOC: 40}, gridChargeTestNight)
+	assert.Equal(t, VoteOff, req.Want)
+	assert.Equal(t, 80.0, req.ReserveFloor)
+}
+
+func TestEvaluateGridCharge_NoOpinion(t *testing.T) {
+	config := makeTestGridChargeConfig()
+	in := GridChargeInput{Armed: true, Price: 0.10, SOC: 40}
+
+	req := EvaluateGridCharge(config, in, gridChargeTestNight.Add(7*time.Hour))
+	assert.Equal(t, VoteNoOpinion, req.Want, "08:00 is after the window")
+	assert.Zero(t, req.ReserveFloor)
+
+	in.Price = 0.20
+	assert.Equal(t, VoteNoOpinion, EvaluateGridCharge(config, in, gridChargeTestNight).Want, "too expensive")
+
+	in = GridChargeInput{Armed: false, Price: 0.10}
+	assert.Equal(t, VoteNoOpinion, EvaluateGridCharge(config, in, gridChargeTestNight).Want)
+}
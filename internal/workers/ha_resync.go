@@ -0,0 +1,239 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TopicHAStatus is Home Assistant's MQTT birth and last-will topic: "online" once HA
+// has started, "offline" when it stops or its connection drops.
+const TopicHAStatus = "homeassistant/status"
+
+// HAResyncConfig configures the hold after a Home Assistant restart.
+type HAResyncConfig struct {
+	CriticalTopics []string      // Statestream topics that must refresh before actuating again
+	Timeout        time.Duration // Release the hold after this even if some never refresh
+}
+
+// HAResync holds actuation while Home Assistant restarts. Statestream topics go quiet
+// while HA is down and are republished (or not) as it comes back, so decisions made
+// from them look like sensors changed. From "offline" or "online" on TopicHAStatus
+// until every critical topic has delivered a value again, mqttSenderWorker holds back
+// service calls and Victron writes and replays the latest of each when the hold ends.
+// turn_off calls, states and the resync's own update_entity calls still go out. A nil
+// *HAResync never holds. Safe for concurrent use.
+type HAResync struct {
+	config HAResyncConfig
+
+	mu      sync.Mutex
+	holding bool
+	since   time.Time
+	pending map[string]bool // critical topics not delivered since the hold began
+
+	held     map[string]MQTTMessage // latest held actuation per entity or topic
+	heldKeys []string               // held keys in arrival order
+}
+
+// NewHAResync creates a resync that isn't holding.
+func NewHAResync(config HAResyncConfig) *HAResync {
+	return &HAResync{config: config}
+}
+
+// Holding reports whether actuation is held.
+func (r *HAResync) Holding() bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.holding
+}
+
+// isEntityRefresh reports whether msg is a homeassistant.update_entity call.
+func isEntityRefresh(msg MQTTMessage) bool {
+	if msg.Topic != TopicCallServiceProxy {
+		return false
+	}
+	var call proxyServiceCall
+	if err := json.Unmarshal(msg.Payload, &call); err != nil {
+		return false
+	}
+	return call.Domain == "homeassistant" && call.Service == "update_entity"
+}
+
+// isTurnOff reports whether msg is a turn_off service call, which is always safe to send.
+func isTurnOff(msg MQTTMessage) bool {
+	if msg.Topic != TopicCallServiceProxy {
+		return false
+	}
+	var call proxyServiceCall
+	if err := json.Unmarshal(msg.Payload, &call); err != nil {
+		return false
+	}
+	return call.Service == "turn_off"
+}
+
+// resyncKey identifies what a held actuation sets, so a newer command replaces it.
+func resyncKey(msg MQTTMessage) string {
+	if key := serviceCallKey(msg); key != "" {
+		return key
+	}
+	if msg.Topic == TopicCallServiceProxy {
+		return msg.Topic + " " + string(msg.Payload)
+	}
+	return msg.Topic
+}
+
+// Admit reports whether msg can be published now. Otherwise it is held until Due,
+// replacing any held command to the same entity or topic.
+func (r *HAResync) Admit(msg MQTTMessage) bool {
+	if r == nil || !isActuation(msg) || isEntityRefresh(msg) {
+		return true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := resyncKey(msg)
+	if isTurnOff(msg) {
+		// Sent now, so an older held command must not undo it on replay
+		if _, ok := r.held[key]; ok {
+			delete(r.held, key)
+			r.heldKeys = slices.DeleteFunc(r.heldKeys, func(k string) bool { return k == key })
+		}
+		return true
+	}
+	if !r.holding {
+		return true
+	}
+	if len(r.held) == 0 {
+		log.Println("HA resync: holding commands until critical sensors refresh")
+	}
+	if _, ok := r.held[key]; !ok {
+		r.heldKeys = append(r.heldKeys, key)
+	}
+	r.held[key] = msg
+	return false
+}
+
+// Due returns the held commands, in arrival order, once the hold has ended.
+func (r *HAResync) Due() []MQTTMessage {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.holding || len(r.held) == 0 {
+		return nil
+	}
+	due := make([]MQTTMessage, len(r.heldKeys))
+	for i, key := range r.heldKeys {
+		due[i] = r.held[key]
+	}
+	r.held = make(map[string]MQTTMessage)
+	r.heldKeys = nil
+	return due
+}
+
+// Hold starts (or restarts) the hold, waiting for every critical topic again.
+func (r *HAResync) Hold(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.holding = true
+	r.since = now
+	if r.held == nil {
+		r.held = make(map[string]MQTTMessage)
+	}
+	r.pending = make(map[string]bool, len(r.config.CriticalTopics))
+	for _, topic := range r.config.CriticalTopics {
+		r.pending[topic] = true
+	}
+}
+
+// Seen records a value delivered on topic, releasing the hold once every critical
+// topic has been delivered. Safe on a nil resync.
+func (r *HAResync) Seen(topic string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.holding || !r.pending[topic] {
+		return
+	}
+	delete(r.pending, topic)
+	if len(r.pending) == 0 {
+		r.holding = false
+		log.Println("HA resync: critical sensors fresh, actuation resumed")
+	}
+}
+
+// Expire releases a hold that has lasted Timeout, returning the critical topics that
+// never refreshed (sorted), or nil if nothing was released.
+func (r *HAResync) Expire(now time.Time) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.holding || now.Sub(r.since) < r.config.Timeout {
+		return nil
+	}
+	r.holding = false
+	stale := make([]string, 0, len(r.pending))
+	for topic := range r.pending {
+		stale = append(stale, topic)
+	}
+	slices.Sort(stale)
+	return stale
+}
+
+// entityRefreshCalls returns a homeassistant.update_entity call for the entity behind
+// each statestream state topic, so polled sensors report without waiting for their
+// next interval.
+func entityRefreshCalls(topics []string) []MQTTMessage {
+	var calls []MQTTMessage
+	for _, topic := range topics {
+		parts := strings.Split(topic, "/")
+		if len(parts) != 4 || parts[0] != "homeassistant" || parts[3] != "state" {
+			continue
+		}
+		calls = append(calls, serviceCallMessage("homeassistant", "update_entity", parts[1]+"."+parts[2], nil))
+	}
+	return calls
+}
+
+// haResyncWorker follows HA's birth and last-will messages. On "offline" it holds
+// actuation; on "online" it holds (again) and asks HA to refresh the critical sensors.
+// Holds that outlast the timeout are released with a warning.
+func haResyncWorker(ctx context.Context, resync *HAResync, statusChan <-chan SensorMessage, sender *MQTTSender) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg := <-statusChan:
+			switch msg.Value {
+			case "offline":
+				log.Println("HA resync: Home Assistant offline, holding actuation")
+				resync.Hold(time.Now())
+			case "online":
+				log.Printf("HA resync: Home Assistant online, holding actuation until %d critical sensors refresh\n",
+					len(resync.config.CriticalTopics))
+				resync.Hold(time.Now())
+				for _, call := range entityRefreshCalls(resync.config.CriticalTopics) {
+					sender.Send(call)
+				}
+			}
+
+		case now := <-ticker.C:
+			if stale := resync.Expire(now); stale != nil {
+				log.Printf("HA resync: released after %s without fresh data from %s\n",
+					resync.config.Timeout, strings.Join(stale, ", "))
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
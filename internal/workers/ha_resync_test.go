@@ -0,0 +1,80 @@
+package workers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHAResync_HoldsUntilCriticalTopicsFresh(t *testing.T) {
+	var disabled *HAResync
+	assert.True(t, disabled.Admit(serviceCallMessage("switch", "turn_on", "switch.inverter_1", nil)))
+	assert.Nil(t, disabled.Due())
+
+	resync := NewHAResync(HAResyncConfig{
+		CriticalTopics: []string{"homeassistant/sensor/a/state", "homeassistant/sensor/b/state"},
+		Timeout:        2 * time.Minute,
+	})
+	turnOn := serviceCallMessage("switch", "turn_on", "switch.inverter_1", nil)
+	assert.True(t, resync.Admit(turnOn))
+
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	resync.Hold(start)
+	mode := MQTTMessage{Topic: "powerhouse_3/W/vebus/276/Mode", Payload: []byte(`{"value":3}`)}
+	assert.False(t, resync.Admit(turnOn))
+	assert.False(t, resync.Admit(mode))
+	assert.True(t, resync.Admit(MQTTMessage{Topic: "powerctl/sensor/powerctl_mode/state"}))
+	assert.True(t, resync.Admit(serviceCallMessage("homeassistant", "update_entity", "sensor.a", nil)))
+	assert.Nil(t, resync.Due(), "nothing is replayed while holding")
+
+	resync.Seen("homeassistant/sensor/a/state")
+	resync.Seen("homeassistant/sensor/other/state")
+	assert.True(t, resync.Holding())
+	resync.Seen("homeassistant/sensor/b/state")
+	assert.False(t, resync.Holding())
+	assert.Equal(t, []MQTTMessage{turnOn, mode}, resync.Due())
+	assert.Nil(t, resync.Due())
+	assert.True(t, resync.Admit(turnOn))
+}
+
+func TestHAResync_TurnOffPassesHold(t *testing.T) {
+	resync := NewHAResync(HAResyncConfig{CriticalTopics: []string{"homeassistant/sensor/a/state"}, Timeout: time.Minute})
+	resync.Hold(time.Now())
+
+	turnOn := serviceCallMessage("switch", "turn_on", "switch.inverter_1", nil)
+	turnOff := serviceCallMessage("switch", "turn_off", "switch.inverter_1", nil)
+	other := serviceCallMessage("switch", "turn_on", "switch.inverter_2", nil)
+	assert.False(t, resync.Admit(turnOn))
+	assert.False(t, resync.Admit(other))
+	assert.True(t, resync.Admit(turnOff))
+
+	// The turn_on held before it must not undo the turn_off on replay
+	resync.Seen("homeassistant/sensor/a/state")
+	assert.Equal(t, []MQTTMessage{other}, resync.Due())
+}
+
+func TestHAResync_Expire(t *testing.T) {
+	resync := NewHAResync(HAResyncConfig{
+		CriticalTopics: []string{"homeassistant/sensor/b/state", "homeassistant/sensor/a/state"},
+		Timeout:        2 * time.Minute,
+	})
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.Nil(t, resync.Expire(start))
+
+	resync.Hold(start)
+	resync.Seen("homeassistant/sensor/b/state")
+	assert.Nil(t, resync.Expire(start.Add(time.Minute)))
+	assert.Equal(t, []string{"homeassistant/sensor/a/state"}, resync.Expire(start.Add(2*time.Minute)))
+	assert.False(t, resync.Holding())
+}
+
+func TestEntityRefreshCalls(t *testing.T) {
+	calls := entityRefreshCalls([]string{
+		"homeassistant/sensor/solar_5_battery_voltage/state",
+		"homeassistant/sensor/solar_5_battery_voltage/attribute",
+		"powerctl/sensor/x/state",
+	})
+	assert.Len(t, calls, 1)
+	assert.JSONEq(t, `{"domain":"homeassistant","service":"update_entity","entity_id":"sensor.solar_5_battery_voltage"}`, string(calls[0].Payload))
+}
@@ -0,0 +1,80 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ryansname/powerctl/internal/ha"
+	"log"
+	"time"
+)
+
+// nativeRetryAfter is how long service calls go straight to the MQTT proxy after a
+// native call fails, so an unreachable HA doesn't add a request timeout to every call.
+const nativeRetryAfter = time.Minute
+
+// haServiceRoute diverts call_service proxy messages from mqttSenderWorker to the
+// native HA client. Calls the client can't make come back on fallback and are
+// published to the proxy topic as usual.
+type haServiceRoute struct {
+	calls    chan MQTTMessage
+	fallback chan MQTTMessage
+}
+
+func newHAServiceRoute() *haServiceRoute {
+	return &haServiceRoute{
+		calls:    make(chan MQTTMessage, 100),
+		fallback: make(chan MQTTMessage, 100),
+	}
+}
+
+// toProxy hands a service call back to mqttSenderWorker for the MQTT proxy.
+func (r *haServiceRoute) toProxy(ctx context.Context, msg MQTTMessage) {
+	select {
+	case r.fallback <- msg:
+	case <-ctx.Done():
+	}
+}
+
+// proxyServiceCall is the JSON payload MQTTSender.CallService publishes.
+type proxyServiceCall struct {
+	Domain   string         `json:"domain"`
+	Service  string         `json:"service"`
+	EntityID string         `json:"entity_id"`
+	Data     map[string]any `json:"data"`
+}
+
+// haServiceWorker makes service calls directly against the HA REST API, falling back
+// to the MQTT proxy when a call fails and for nativeRetryAfter afterwards.
+func haServiceWorker(ctx context.Context, route *haServiceRoute, client *ha.Client) {
+	log.Println("HA service worker started")
+
+	var proxyUntil time.Time
+	for {
+		select {
+		case msg := <-route.calls:
+			if time.Now().Before(proxyUntil) {
+				route.toProxy(ctx, msg)
+				continue
+			}
+
+			var call proxyServiceCall
+			if err := json.Unmarshal(msg.Payload, &call); err != nil {
+				log.Printf("HA service worker: invalid service call payload: %v\n", err)
+				continue
+			}
+
+			if err := client.CallService(ctx, call.Domain, call.Service, call.EntityID, call.Data); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Printf("HA service worker: %v, using MQTT proxy for %s\n", err, nativeRetryAfter)
+				proxyUntil = time.Now().Add(nativeRetryAfter)
+				route.toProxy(ctx, msg)
+			}
+
+		case <-ctx.Done():
+			log.Println("HA service worker stopped")
+			return
+		}
+	}
+}
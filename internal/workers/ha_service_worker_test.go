@@ -0,0 +1,69 @@
+package workers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ryansname/powerctl/internal/ha"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHAServiceWorker_FallsBackToProxy(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	route := newHAServiceRoute()
+	go haServiceWorker(ctx, route, ha.NewClient(server.URL, "t"))
+
+	first := serviceCallMessage("switch", "turn_on", "switch.a", nil)
+	route.calls <- first
+	select {
+	case msg := <-route.fallback:
+		assert.Equal(t, first, msg)
+	case <-time.After(time.Second):
+		t.Fatal("failed call was not handed back to the proxy")
+	}
+
+	// Within nativeRetryAfter the next call goes straight to the proxy
+	second := serviceCallMessage("switch", "turn_on", "switch.b", nil)
+	route.calls <- second
+	select {
+	case msg := <-route.fallback:
+		assert.Equal(t, second, msg)
+	case <-time.After(time.Second):
+		t.Fatal("call was not sent to the proxy")
+	}
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestHAServiceWorker_NativeSuccess(t *testing.T) {
+	called := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called <- r.URL.Path
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	route := newHAServiceRoute()
+	go haServiceWorker(ctx, route, ha.NewClient(server.URL, "t"))
+
+	route.calls <- serviceCallMessage("switch", "turn_on", "switch.a", nil)
+	assert.Equal(t, "/api/services/switch/turn_on", <-called)
+	select {
+	case <-route.fallback:
+		t.Fatal("successful call should not fall back")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -1,17 +1,20 @@
-package main
+package workers
 
 import (
 	"testing"
 	"time"
 
+	"github.com/ryansname/powerctl/internal/stats"
 	"github.com/stretchr/testify/assert"
 )
 
-func makeFloatTopic(v float64) *FloatTopicData { return &FloatTopicData{Current: v} }
-func makeBoolTopic(v bool, raw string) *BooleanTopicData {
-	return &BooleanTopicData{Current: v, Raw: raw}
+func makeFloatTopic(v float64) *stats.FloatTopicData { return &stats.FloatTopicData{Current: v} }
+
+func makeBoolTopic(v bool, raw string) *stats.BooleanTopicData {
+	return &stats.BooleanTopicData{Current: v, Raw: raw}
 }
-func makeStringTopic(v string) *StringTopicData { return &StringTopicData{Current: v} }
+
+func makeStringTopic(v string) *stats.StringTopicData { return &stats.StringTopicData{Current: v} }
 
 const (
 	testTopicB2SOC    = "b2soc"
@@ -46,8 +49,9 @@ func makeBaselineDisplayData() (DisplayData, BaselineInputConfig) {
 		ExpectingPowerCutsTopic:  "powercuts",
 	}
 
-	freqKey := PercentileKey{Topic: freqTopic, Percentile: P100, Window: Window5Min}
-	solar1P90Key := PercentileKey{Topic: config.Solar1PowerTopic, Percentile: P90, Window: Window15Min}
+	freqKey := PercentileKey{Topic: freqTopic, Percentile: stats.P100, Window: stats.Window5Min}
+	solar1P90Key := PercentileKey{Topic: config.Solar1PowerTopic, Percentile: stats.P90, Window: stats.Window15Min}
+	voltP50Key := PercentileKey{Topic: config.Battery2VoltageTopic, Percentile: stats.P50, Window: stats.Window5Min}
 	data := DisplayData{
 		TopicData: map[string]any{
 			testTopicB2SOC:    makeFloatTopic(87.5),
@@ -71,6 +75,7 @@ func makeBaselineDisplayData() (DisplayData, BaselineInputConfig) {
 		Percentiles: map[PercentileKey]float64{
 			freqKey:      50.15,
 			solar1P90Key: 900.0,
+			voltP50Key:   52.3,
 		},
 	}
 	return data, config
@@ -83,6 +88,7 @@ func TestExtractBaselineInput(t *testing.T) {
 	assert.InDelta(t, 87.5, input.Battery2SOC, 0.001)
 	assert.Equal(t, "Float Charging", input.Battery2ChargeState)
 	assert.InDelta(t, 52.1, input.Battery2Voltage, 0.001)
+	assert.InDelta(t, 52.3, input.Battery2VoltageP50_5Min, 0.001)
 	assert.InDelta(t, 8500.0, input.Battery2EnergyWh, 0.001)
 	assert.InDelta(t, 1200.0, input.Solar1Power, 0.001)
 	assert.InDelta(t, 900.0, input.Solar1P90_15Min, 0.001)
@@ -109,30 +115,28 @@ func TestExtractBaselineInput_ExpectingPowerCuts(t *testing.T) {
 func makeDynamicDisplayData() (DisplayData, DynamicInputConfig) {
 	freqTopic := "freq"
 	config := DynamicInputConfig{
-		HouseLoadTopic:          testTopicLoad,
-		Solar1PowerTopic:        testTopicSolar1,
-		Solar2PowerTopic:        testTopicSolar2,
-		Inverter1to9PowerTopics: []string{"inv1p", "inv2p", "inv3p"},
-		MultiplusACPowerTopic:   "multiplusac",
-		Battery3SOCTopic:        testTopicB3SOC,
-		GridStatusTopic:         testTopicGrid,
-		ACFrequencyTopic:        freqTopic,
-		PowerwallSOCTopic:       testTopicPWSOC,
-		ForecastRemainingTopic:  "forecastremaining",
-		DetailedForecastTopic:   "detailedforecast",
-		Battery3CapacityWh:      43500,
-		SolarMultiplier:         3.9,
+		HouseLoadTopic:         testTopicLoad,
+		Solar1PowerTopic:       testTopicSolar1,
+		Solar2PowerTopic:       testTopicSolar2,
+		Inverter1to9PowerTopic: "inv1to9p",
+		MultiplusACPowerTopic:  "multiplusac",
+		Battery3SOCTopic:       testTopicB3SOC,
+		GridStatusTopic:        testTopicGrid,
+		ACFrequencyTopic:       freqTopic,
+		PowerwallSOCTopic:      testTopicPWSOC,
+		ForecastRemainingTopic: "forecastremaining",
+		DetailedForecastTopic:  "detailedforecast",
+		Battery3CapacityWh:     43500,
+		SolarMultiplier:        3.9,
 	}
 
-	freqKey := PercentileKey{Topic: freqTopic, Percentile: P100, Window: 5 * time.Minute}
+	freqKey := PercentileKey{Topic: freqTopic, Percentile: stats.P100, Window: 5 * time.Minute}
 	data := DisplayData{
 		TopicData: map[string]any{
 			testTopicLoad:       makeFloatTopic(2000),
 			testTopicSolar1:     makeFloatTopic(1500),
 			testTopicSolar2:     makeFloatTopic(600),
-			"inv1p":             makeFloatTopic(-255),
-			"inv2p":             makeFloatTopic(-255),
-			"inv3p":             makeFloatTopic(-510),
+			"inv1to9p":          makeFloatTopic(-1020),
 			"multiplusac":       makeFloatTopic(-800),
 			testTopicB3SOC:      makeFloatTopic(65.0),
 			testTopicGrid:       makeBoolTopic(true, "on"),
@@ -155,7 +159,7 @@ func TestExtractDynamicInput(t *testing.T) {
 	assert.InDelta(t, 2000.0, input.HouseLoad, 0.001)
 	assert.InDelta(t, 1500.0, input.Solar1Power, 0.001)
 	assert.InDelta(t, 600.0, input.Solar2Power, 0.001)
-	assert.InDelta(t, 1020.0, input.Inverter1to9Power, 0.001) // 255+255+510
+	assert.InDelta(t, 1020.0, input.Inverter1to9Power, 0.001)
 	assert.InDelta(t, -800.0, input.MultiplusACPower, 0.001)
 	assert.InDelta(t, 65.0, input.Battery3SOC, 0.001)
 	assert.True(t, input.GridAvailable)
@@ -0,0 +1,381 @@
+package workers
+
+import (
+	"log"
+	"math"
+	"time"
+
+	"github.com/ryansname/powerctl/governor"
+)
+
+const floatChargingState = "Float Charging"
+
+const (
+	modeBaseline = "Baseline"
+	modeSafety   = "Safety"
+)
+
+// PowerRequest represents a power request from a rule.
+type PowerRequest struct {
+	Name  string
+	Watts float64
+}
+
+// PowerLimit represents a power limit from a rule.
+type PowerLimit struct {
+	Name  string
+	Watts float64
+}
+
+// InverterInfo holds information about a single inverter.
+type InverterInfo struct {
+	EntityID   string // e.g., "switch.powerhouse_inverter_1_switch_0"
+	StateTopic string // e.g., "homeassistant/switch/powerhouse_inverter_1_switch_0/state"
+
+	// Modbus, if set, switches the inverter over Modbus-TCP instead of the HA service call
+	Modbus *ModbusTarget
+	// Shelly, if set, switches the inverter's relay directly, falling back to HA
+	Shelly *ShellyTarget
+	// PowerLimitEntityID, if set, is the HA number entity (W) limiting the inverter's output
+	PowerLimitEntityID string
+	// PowerTopic, if set, reports the inverter's output (W)
+	PowerTopic string
+}
+
+// BatteryInverterGroup holds inverters for a single battery.
+type BatteryInverterGroup struct {
+	Name                 string
+	Inverters            []InverterInfo
+	ChargeStateTopic     string
+	SOCTopic             string
+	BatteryVoltageTopic  string
+	CapacityWh           float64 // Battery capacity in Wh
+	SolarMultiplier      float64 // Multiplier for solar forecast
+	AvailableEnergyTopic string  // Topic for battery available energy
+}
+
+// BatteryOverflowState holds per-battery runtime state for overflow mode.
+type BatteryOverflowState struct {
+	LastWatts  float64
+	InFloat    bool
+	Hysteresis *governor.SteppedHysteresis
+}
+
+// ModeState represents a mode's value and whether it's contributing to the final selection.
+type ModeState struct {
+	Name         string
+	Watts        float64
+	Contributing bool
+}
+
+// checkBatteryOverflow returns inverter count for overflow mode using SOC-based hysteresis.
+// Requires Float Charging + 100% SOC to enter. Once entered, stays active while in Float.
+// Watts can only decrease to prevent inverter flapping.
+func checkBatteryOverflow(
+	chargeState string,
+	soc float64,
+	wattsPerInverter float64,
+	state *BatteryOverflowState,
+) PowerRequest {
+	name := "Overflow"
+	inFloat := chargeState == floatChargingState
+
+	if !inFloat {
+		state.InFloat = false
+		return PowerRequest{Name: name, Watts: 0}
+	}
+
+	if !state.InFloat && soc < 100 {
+		return PowerRequest{Name: name, Watts: 0}
+	}
+
+	count := state.Hysteresis.Update(soc)
+	watts := float64(count) * wattsPerInverter
+
+	if !state.InFloat {
+		state.InFloat = true
+		state.LastWatts = watts
+	} else {
+		watts = min(watts, state.LastWatts)
+		state.LastWatts = watts
+	}
+
+	return PowerRequest{Name: name, Watts: watts}
+}
+
+// overflowFromChargePower sizes overflow mode from the charge controller's output instead
+// of SOC. In float the controller throttles to what is drawn, so output beyond the active
+// inverters' draw is the float current plus any headroom: at probeWatts or more, one more
+// inverter is tried. A shortfall means the battery is covering the inverters, so enough
+// are dropped to cover it. Only called once checkBatteryOverflow has entered float.
+func overflowFromChargePower(
+	chargePower float64,
+	active int,
+	maxCount int,
+	wattsPerInverter float64,
+	probeWatts float64,
+) PowerRequest {
+	surplus := chargePower - float64(active)*wattsPerInverter
+	count := active
+	switch {
+	case surplus >= probeWatts:
+		count++
+	case surplus < 0:
+		count -= int(math.Ceil(-surplus / wattsPerInverter))
+	}
+	count = max(0, min(count, maxCount))
+	return PowerRequest{Name: "Overflow", Watts: float64(count) * wattsPerInverter}
+}
+
+// forecastExcessRequest returns the power needed to reach 100% battery by solar end today.
+func forecastExcessRequest(
+	forecastRemainingWh float64,
+	forecast governor.ForecastPeriods,
+	availableWh float64,
+	wattsPerInverter float64,
+	battery BatteryInverterGroup,
+	state *governor.ForecastExcessState,
+	now time.Time,
+) PowerRequest {
+	input := governor.ForecastExcessInput{
+		Now:                 now,
+		ForecastRemainingWh: forecastRemainingWh,
+		Forecast:            forecast,
+		AvailableWh:         availableWh,
+		InverterCount:       len(battery.Inverters),
+		WattsPerInverter:    wattsPerInverter,
+		SolarMultiplier:     battery.SolarMultiplier,
+		CapacityWh:          battery.CapacityWh,
+	}
+	result := governor.ForecastExcessRequestCore(input, state)
+	return PowerRequest{Name: result.Name, Watts: result.Watts}
+}
+
+// drawdownSolarEndKw is the (pre-multiplier Solcast) generation above which a forecast
+// period still counts towards the solar day for the drawdown planner.
+const drawdownSolarEndKw = 0.05
+
+// OvernightReserve sets the drawdown reserve from tomorrow's forecast: SunnySOC when
+// at least SunnyWh is forecast, CloudySOC at or below CloudyWh, linear in between.
+// Forecasts are the single-site Solcast total, before solarForecastMultiplier.
+type OvernightReserve struct {
+	CloudyWh  float64
+	CloudySOC float64
+	SunnyWh   float64
+	SunnySOC  float64
+}
+
+// Enabled reports whether the reserve is configured.
+func (r OvernightReserve) Enabled() bool {
+	return r.SunnyWh > r.CloudyWh
+}
+
+// SOC returns the reserve (%) to hold overnight before a day forecast to make tomorrowWh.
+func (r OvernightReserve) SOC(tomorrowWh float64) float64 {
+	fraction := clamp((tomorrowWh-r.CloudyWh)/(r.SunnyWh-r.CloudyWh), 0, 1)
+	return r.CloudySOC + fraction*(r.SunnySOC-r.CloudySOC)
+}
+
+// drawdownRequest is the inverse of forecastExcessRequest for the evening: within window
+// of the forecast solar end, it spreads the energy above reserveSOC (plus the battery's
+// share of the solar still to come) over the time left, so the battery ends the day at
+// the overnight reserve instead of carrying surplus into the night.
+func drawdownRequest(
+	forecastRemainingWh float64,
+	forecast governor.ForecastPeriods,
+	availableWh float64,
+	reserveSOC float64,
+	window time.Duration,
+	wattsPerInverter float64,
+	battery BatteryInverterGroup,
+	now time.Time,
+) PowerRequest {
+	name := "Drawdown"
+	if reserveSOC <= 0 || window <= 0 {
+		return PowerRequest{Name: name}
+	}
+	untilEnd := forecast.FindSolarEndTime(drawdownSolarEndKw).Sub(now)
+	if untilEnd <= 0 || untilEnd > window {
+		return PowerRequest{Name: name}
+	}
+
+	reserveWh := reserveSOC / 100 * battery.CapacityWh
+	exportableWh := availableWh + battery.SolarMultiplier*forecastRemainingWh - reserveWh
+	if exportableWh <= 0 {
+		return PowerRequest{Name: name}
+	}
+
+	// Offset by half an inverter like forecastExcessRequest, so ceil rounding in
+	// calculateInverterCount doesn't take the battery below the reserve
+	maxInverterWatts := float64(len(battery.Inverters)) * wattsPerInverter
+	watts := exportableWh/untilEnd.Hours() - 0.5*wattsPerInverter
+	return PowerRequest{Name: name, Watts: max(0, min(watts, maxInverterWatts))}
+}
+
+// multiplusAbsorbSOC is the Battery 3 SOC below which its Multiplus absorbs what the
+// powerhouse would otherwise transfer, so the transfer limit doesn't apply.
+const multiplusAbsorbSOC = 94.0
+
+// powerhouseTransferLimit returns the available capacity after accounting for solar generation.
+func powerhouseTransferLimit(solar1P90_15Min float64, maxTransferPower float64) PowerLimit {
+	return PowerLimit{Name: "PowerhouseTransfer", Watts: maxTransferPower - solar1P90_15Min}
+}
+
+// maxPowerRequest returns the PowerRequest with the highest watts.
+func maxPowerRequest(a, b PowerRequest) PowerRequest {
+	if a.Watts >= b.Watts {
+		return a
+	}
+	return b
+}
+
+// calculateInverterCount computes how many inverters are needed for target power.
+func calculateInverterCount(targetWatts, wattsPerInverter float64) int {
+	if targetWatts <= 0 {
+		return 0
+	}
+	count := int(math.Ceil(targetWatts / wattsPerInverter))
+	return min(count, 9)
+}
+
+// newInverterCountHysteresis converts target watts to an inverter count like
+// calculateInverterCount, but step k is only reached above (k-1)·wattsPerInverter+band
+// and left below (k-1)·wattsPerInverter-band, so a target hovering at a multiple of
+// wattsPerInverter doesn't flap the count.
+func newInverterCountHysteresis(count int, wattsPerInverter, band float64) *governor.SteppedHysteresis {
+	top := float64(count-1) * wattsPerInverter
+	return governor.NewSteppedHysteresis(
+		count, true,
+		band, top+band,
+		-band, top-band,
+	)
+}
+
+// inverterCountWithHysteresis returns the count for targetWatts from h, or 0 (resetting
+// h) when there is no target.
+func inverterCountWithHysteresis(targetWatts float64, h *governor.SteppedHysteresis) int {
+	if targetWatts <= 0 {
+		h.Current = 0
+		return 0
+	}
+	return h.Update(targetWatts)
+}
+
+// trimInverterIndex returns the index of the first inverter with an adjustable output,
+// or -1 if none has one.
+func trimInverterIndex(inverters []InverterInfo) int {
+	for i, inv := range inverters {
+		if inv.PowerLimitEntityID != "" {
+			return i
+		}
+	}
+	return -1
+}
+
+// trimSetpoint returns the trim inverter's output so count inverters deliver targetWatts:
+// the others run flat out and the trim takes the remainder. It runs flat out too when
+// the count was capped below what the target needs.
+func trimSetpoint(targetWatts float64, count int, wattsPerInverter float64) float64 {
+	remainder := targetWatts - float64(count-1)*wattsPerInverter
+	return math.Round(max(0, min(remainder, wattsPerInverter)))
+}
+
+// applyTrimSetpoint sets the trim inverter's power limit when it will be on and the
+// setpoint differs from last (the previously sent value). Returns the value now in force.
+func applyTrimSetpoint(
+	inverters []InverterInfo,
+	sender *MQTTSender,
+	desiredCount int,
+	targetWatts float64,
+	wattsPerInverter float64,
+	last float64,
+) float64 {
+	trim := trimInverterIndex(inverters)
+	if trim < 0 || trim >= desiredCount {
+		return last
+	}
+	setpoint := trimSetpoint(targetWatts, desiredCount, wattsPerInverter)
+	if setpoint == last {
+		return last
+	}
+	entityID := inverters[trim].PowerLimitEntityID
+	log.Printf("Setting %s to %.0fW\n", entityID, setpoint)
+	sender.CallService("number", "set_value", entityID, map[string]any{"value": setpoint})
+	return setpoint
+}
+
+// InverterDwell tracks when each inverter last changed state, so a count dancing around
+// a boundary doesn't toggle the same inverter every evaluation. The zero value is ready.
+type InverterDwell struct {
+	on      []bool
+	changed []time.Time // zero until a change is seen
+}
+
+// Observe records changes in the reported inverter states. An inverter's first report
+// is taken as settled.
+func (d *InverterDwell) Observe(states []bool, now time.Time) {
+	for i, on := range states {
+		if i >= len(d.on) {
+			d.on = append(d.on, on)
+			d.changed = append(d.changed, time.Time{})
+			continue
+		}
+		if on != d.on[i] {
+			d.on[i] = on
+			d.changed[i] = now
+		}
+	}
+}
+
+// Hold adjusts desiredCount (inverters 0..count-1 on, see applyInverterChanges) so no
+// inverter turns on within minOff of turning off, or off within minOn of turning on.
+// Minimum-on wins when the two conflict.
+func (d *InverterDwell) Hold(desiredCount int, minOn, minOff time.Duration, now time.Time) int {
+	count := desiredCount
+	for i := 0; i < min(count, len(d.on)); i++ {
+		if !d.on[i] && !d.changed[i].IsZero() && now.Sub(d.changed[i]) < minOff {
+			count = i
+			break
+		}
+	}
+	for i := len(d.on) - 1; i >= count; i-- {
+		if d.on[i] && !d.changed[i].IsZero() && now.Sub(d.changed[i]) < minOn {
+			count = i + 1
+			break
+		}
+	}
+	return count
+}
+
+// maxInvertersForSOC returns the max inverters allowed based on SOC percentage.
+func maxInvertersForSOC(socPercent float64, hysteresis *governor.SteppedHysteresis) int {
+	return hysteresis.Update(socPercent)
+}
+
+// applyInverterChanges enables/disables inverters to match the desired count.
+func applyInverterChanges(
+	currentStates []bool,
+	inverters []InverterInfo,
+	sender *MQTTSender,
+	desiredCount int,
+) bool {
+	changed := false
+
+	for i, inv := range inverters {
+		current := i < len(currentStates) && currentStates[i]
+		desired := i < desiredCount
+
+		if current != desired {
+			if desired {
+				log.Printf("Enabling %s\n", inv.EntityID)
+				sender.CallServiceExpecting("switch", "turn_on", inv.EntityID, nil, inv.StateTopic, "on")
+			} else {
+				log.Printf("Disabling %s\n", inv.EntityID)
+				sender.CallServiceExpecting("switch", "turn_off", inv.EntityID, nil, inv.StateTopic, "off")
+			}
+			changed = true
+		}
+	}
+
+	return changed
+}
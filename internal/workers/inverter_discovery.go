@@ -0,0 +1,145 @@
+package workers
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/ryansname/powerctl/internal/ha"
+)
+
+// TopicSwitchDiscoveryWildcard matches every retained HA switch discovery config.
+const TopicSwitchDiscoveryWildcard = "homeassistant/switch/+/config"
+
+// inverterDiscoveryWindow is how long the scanner listens for retained discovery
+// configs. The broker delivers retained messages immediately on subscribe, so a
+// few seconds is plenty.
+const inverterDiscoveryWindow = 3 * time.Second
+
+// discoveryObjectID extracts the object ID from a discovery config topic.
+// Handles both homeassistant/<domain>/<object_id>/config and the
+// homeassistant/<domain>/<node_id>/<object_id>/config forms.
+func discoveryObjectID(topic string) string {
+	parts := strings.Split(topic, "/")
+	if len(parts) < 4 || parts[len(parts)-1] != "config" {
+		return ""
+	}
+	return parts[len(parts)-2]
+}
+
+// matchInverterSwitches filters discovered switch object IDs against a glob
+// pattern (e.g. "powerhouse_inverter_*_switch_0") and returns the matching
+// entity IDs in natural order, so inverter_10 sorts after inverter_9.
+func matchInverterSwitches(objectIDs []string, pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid inverter pattern %q: %w", pattern, err)
+	}
+
+	var matched []string
+	for _, id := range objectIDs {
+		if ok, _ := path.Match(pattern, id); ok {
+			matched = append(matched, id)
+		}
+	}
+
+	slices.SortFunc(matched, func(a, b string) int {
+		if c := cmp.Compare(len(a), len(b)); c != 0 {
+			return c
+		}
+		return cmp.Compare(a, b)
+	})
+	matched = slices.Compact(matched)
+
+	entityIDs := make([]string, len(matched))
+	for i, id := range matched {
+		entityIDs[i] = "switch." + id
+	}
+	return entityIDs, nil
+}
+
+// applyDiscoveredInverters rebuilds a battery's inverter group from discovered
+// switch entity IDs. The Shelly energy and power sensors share the switch's
+// object ID, so the outflow topics are derived from the same list.
+func applyDiscoveredInverters(b *BatteryConfig, entityIDs []string) {
+	b.InverterSwitchIDs = entityIDs
+	b.OutflowEnergyTopics = make([]string, len(entityIDs))
+	b.OutflowPowerTopics = make([]string, len(entityIDs))
+	for i, entityID := range entityIDs {
+		objectID := strings.TrimPrefix(entityID, "switch.")
+		b.OutflowEnergyTopics[i] = ha.StatestreamTopic("sensor", objectID+"_energy", "state")
+		b.OutflowPowerTopics[i] = ha.StatestreamTopic("sensor", objectID+"_power", "state")
+	}
+}
+
+// discoverInverterSwitches connects a short-lived MQTT client, collects the
+// retained switch discovery configs and returns entity IDs matching pattern.
+func discoverInverterSwitches(
+	ctx context.Context,
+	broker string,
+	port int,
+	username, password, clientID, pattern string,
+) ([]string, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(broker, strconv.Itoa(port)))
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+
+	var mu sync.Mutex
+	var objectIDs []string
+	client := paho.NewClient(paho.ClientConfig{
+		ClientID: clientID + "-discovery",
+		Conn:     conn,
+		OnPublishReceived: []func(paho.PublishReceived) (bool, error){
+			func(pr paho.PublishReceived) (bool, error) {
+				// Empty retained payloads are deleted entities
+				if len(pr.Packet.Payload) == 0 {
+					return true, nil
+				}
+				if id := discoveryObjectID(pr.Packet.Topic); id != "" {
+					mu.Lock()
+					objectIDs = append(objectIDs, id)
+					mu.Unlock()
+				}
+				return true, nil
+			},
+		},
+	})
+	connect := &paho.Connect{ClientID: clientID + "-discovery", KeepAlive: 30, CleanStart: true}
+	if username != "" {
+		connect.Username, connect.UsernameFlag = username, true
+	}
+	if password != "" {
+		connect.Password, connect.PasswordFlag = []byte(password), true
+	}
+	if _, err := client.Connect(ctx, connect); err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	defer func() { _ = client.Disconnect(&paho.Disconnect{}) }()
+
+	if _, err := client.Subscribe(ctx, &paho.Subscribe{Subscriptions: []paho.SubscribeOptions{
+		{Topic: TopicSwitchDiscoveryWildcard},
+	}}); err != nil {
+		return nil, fmt.Errorf("subscribe: %w", err)
+	}
+
+	select {
+	case <-time.After(inverterDiscoveryWindow):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	log.Printf("Inverter discovery: saw %d switch configs\n", len(objectIDs))
+	return matchInverterSwitches(objectIDs, pattern)
+}
@@ -0,0 +1,49 @@
+package workers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscoveryObjectID(t *testing.T) {
+	assert.Equal(t, "powerhouse_inverter_1_switch_0",
+		discoveryObjectID("homeassistant/switch/powerhouse_inverter_1_switch_0/config"))
+	assert.Equal(t, "inverter_2",
+		discoveryObjectID("homeassistant/switch/shelly_node/inverter_2/config"))
+	assert.Empty(t, discoveryObjectID("homeassistant/switch/powerctl_enabled/state"))
+	assert.Empty(t, discoveryObjectID("config"))
+}
+
+func TestMatchInverterSwitches_NaturalOrder(t *testing.T) {
+	ids := []string{
+		"powerhouse_inverter_10_switch_0",
+		"powerctl_enabled",
+		"powerhouse_inverter_2_switch_0",
+		"powerhouse_inverter_1_switch_0",
+		"powerhouse_blower_switch_0",
+		"powerhouse_inverter_2_switch_0", // duplicate retained delivery
+	}
+
+	got, err := matchInverterSwitches(ids, "powerhouse_inverter_*_switch_0")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"switch.powerhouse_inverter_1_switch_0",
+		"switch.powerhouse_inverter_2_switch_0",
+		"switch.powerhouse_inverter_10_switch_0",
+	}, got)
+}
+
+func TestMatchInverterSwitches_InvalidPattern(t *testing.T) {
+	_, err := matchInverterSwitches([]string{"a"}, "[")
+	assert.Error(t, err)
+}
+
+func TestApplyDiscoveredInverters(t *testing.T) {
+	b := BatteryConfig{Name: "Battery 2"}
+	applyDiscoveredInverters(&b, []string{"switch.powerhouse_inverter_1_switch_0"})
+
+	assert.Equal(t, []string{"switch.powerhouse_inverter_1_switch_0"}, b.InverterSwitchIDs)
+	assert.Equal(t, []string{"homeassistant/sensor/powerhouse_inverter_1_switch_0_energy/state"}, b.OutflowEnergyTopics)
+	assert.Equal(t, []string{"homeassistant/sensor/powerhouse_inverter_1_switch_0_power/state"}, b.OutflowPowerTopics)
+}
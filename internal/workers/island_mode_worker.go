@@ -0,0 +1,99 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// TopicIslandModeState is the retained state topic for the powerctl-owned island
+// mode binary sensor. powerctl subscribes to it too, so controllers read the same
+// value HA shows (pre-seeded OFF in stats.go).
+const TopicIslandModeState = "powerctl/binary_sensor/powerctl_island_mode/state"
+
+// IslandModeConfig configures grid outage detection.
+type IslandModeConfig struct {
+	GridStatusTopic string        // Binary sensor, on = grid available
+	OutageDelay     time.Duration // Grid must be off this long before entering island mode
+	RestoreDelay    time.Duration // Grid must be back this long before leaving island mode
+}
+
+// IslandModeState holds outage debounce state between evaluations.
+type IslandModeState struct {
+	Island    bool
+	pendingAt time.Time // when the grid last changed away from the current mode; zero if settled
+}
+
+// EvaluateIslandMode debounces grid availability into island mode. Returns true if
+// the mode changed on this evaluation.
+func EvaluateIslandMode(
+	state *IslandModeState,
+	config IslandModeConfig,
+	gridAvailable bool,
+	now time.Time,
+) bool {
+	// Grid status agrees with the current mode: nothing pending
+	if gridAvailable != state.Island {
+		state.pendingAt = time.Time{}
+		return false
+	}
+
+	if state.pendingAt.IsZero() {
+		state.pendingAt = now
+	}
+
+	delay := config.OutageDelay
+	if state.Island {
+		delay = config.RestoreDelay
+	}
+	if now.Sub(state.pendingAt) < delay {
+		return false
+	}
+
+	state.Island = !state.Island
+	state.pendingAt = time.Time{}
+	return true
+}
+
+// islandModeWorker publishes island mode while the grid is out. The baseline
+// controller switches to island SOC limits and the dump load enabler stands down
+// while it is on; both revert when the grid has been back for RestoreDelay.
+func islandModeWorker(
+	ctx context.Context,
+	dataChan <-chan DisplayData,
+	config IslandModeConfig,
+	sender *MQTTSender,
+) {
+	log.Println("Island mode worker started")
+
+	var state *IslandModeState
+
+	for {
+		select {
+		case data := <-dataChan:
+			// Resume from the retained state so a restart mid-outage stays islanded
+			if state == nil {
+				state = &IslandModeState{Island: data.GetBoolean(TopicIslandModeState)}
+			}
+
+			if EvaluateIslandMode(state, config, data.GetBoolean(config.GridStatusTopic), time.Now()) {
+				log.Printf("Island mode: %v\n", state.Island)
+			}
+
+			payload := "OFF"
+			if state.Island {
+				payload = "ON"
+			}
+			sender.Send(MQTTMessage{
+				Topic:   TopicIslandModeState,
+				Payload: []byte(payload),
+				QoS:     1,
+				Retain:  true,
+			})
+
+		case <-ctx.Done():
+			log.Println("Island mode worker stopped")
+			return
+		}
+	}
+}
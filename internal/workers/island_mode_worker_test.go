@@ -0,0 +1,69 @@
+package workers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeTestIslandConfig() IslandModeConfig {
+	return IslandModeConfig{
+		GridStatusTopic: "ha/binary_sensor/grid/state",
+		OutageDelay:     30 * time.Second,
+		RestoreDelay:    5 * time.Minute,
+	}
+}
+
+func TestEvaluateIslandMode_EntersAfterOutageDelay(t *testing.T) {
+	config := makeTestIslandConfig()
+	state := &IslandModeState{}
+	t0 := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.False(t, EvaluateIslandMode(state, config, false, t0))
+	assert.False(t, EvaluateIslandMode(state, config, false, t0.Add(29*time.Second)))
+	assert.False(t, state.Island)
+
+	assert.True(t, EvaluateIslandMode(state, config, false, t0.Add(30*time.Second)))
+	assert.True(t, state.Island)
+}
+
+func TestEvaluateIslandMode_BlipDoesNotEnter(t *testing.T) {
+	config := makeTestIslandConfig()
+	state := &IslandModeState{}
+	t0 := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	EvaluateIslandMode(state, config, false, t0)
+	EvaluateIslandMode(state, config, true, t0.Add(10*time.Second))
+	assert.False(t, EvaluateIslandMode(state, config, false, t0.Add(35*time.Second)),
+		"grid returned in between, so the outage timer restarted")
+	assert.False(t, state.Island)
+}
+
+func TestEvaluateIslandMode_RevertsAfterRestoreDelay(t *testing.T) {
+	config := makeTestIslandConfig()
+	state := &IslandModeState{Island: true}
+	t0 := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.False(t, EvaluateIslandMode(state, config, true, t0))
+	assert.False(t, EvaluateIslandMode(state, config, true, t0.Add(4*time.Minute)))
+	assert.True(t, EvaluateIslandMode(state, config, true, t0.Add(5*time.Minute)))
+	assert.False(t, state.Island)
+}
+
+func TestSelectBaselineMode_IslandModeUsesDeeperReserve(t *testing.T) {
+	config := makeTestBaselineConfig()
+
+	input := makeBaselineInput()
+	input.Battery2SOC = 30.0
+	input.HouseLoad = 2000
+
+	state := makeBlankBaselineState(config)
+	count, _ := selectBaselineMode(input, config, state, time.Now())
+	assert.Positive(t, count, "30% is above the normal SOC limit")
+
+	input.IslandMode = true
+	state = makeBlankBaselineState(config)
+	count, _ = selectBaselineMode(input, config, state, time.Now())
+	assert.Equal(t, 0, count, "30% is below the island reserve")
+}
@@ -0,0 +1,40 @@
+package workers
+
+import (
+	"encoding/json"
+
+	"github.com/ryansname/powerctl/governor"
+	"github.com/ryansname/powerctl/internal/stats"
+)
+
+// jsonTopicDecoders maps JSON document topics to their decoder. statsWorker stores these
+// topics as *JSONTopicData; a payload that doesn't decode keeps the last document.
+var jsonTopicDecoders = map[string]func([]byte) (any, error){
+	TopicSolcastDetailedForecast: decodeJSON[governor.ForecastPeriods],
+	TopicSolcastForecast:         decodeJSON[governor.ForecastPeriods],
+}
+
+// decodeJSON decodes a document into a T.
+func decodeJSON[T any](b []byte) (any, error) {
+	var v T
+	err := json.Unmarshal(b, &v)
+	return v, err
+}
+
+// jsonTopicValue returns the decoded document of a JSON document topic, or the zero T
+// if it hasn't arrived or was registered with a decoder for another type.
+func jsonTopicValue[T any](d *DisplayData, topic string) T {
+	if td, ok := d.lookup(topic).(*stats.JSONTopicData); ok {
+		if v, ok := td.Value.(T); ok {
+			return v
+		}
+	}
+	var zero T
+	return zero
+}
+
+// GetForecastPeriods returns the forecast periods from a JSON document topic, or nil
+// before the first forecast.
+func (d *DisplayData) GetForecastPeriods(topic string) governor.ForecastPeriods {
+	return jsonTopicValue[governor.ForecastPeriods](d, topic)
+}
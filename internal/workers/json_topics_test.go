@@ -0,0 +1,45 @@
+package workers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ryansname/powerctl/governor"
+	"github.com/ryansname/powerctl/internal/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+const testForecastJSON = `[{"period_start": "2026-03-04T10:00:00+13:00", "pv_estimate": 2.5, "pv_estimate10": 1.2, "pv_estimate90": 3.1}]`
+
+func TestStatsWorker_DecodesJSONTopicOnce(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in := make(chan SensorMessage, 10)
+	out := make(chan DisplayData, 10)
+	go statsWorker(ctx, in, out, []string{TopicSolcastDetailedForecast}, nil, nil)
+
+	in <- SensorMessage{Topic: TopicSolcastDetailedForecast, Value: testForecastJSON}
+	in <- SensorMessage{Topic: TopicSolcastDetailedForecast, Value: "not json"}
+	data := <-out
+
+	forecast := data.GetForecastPeriods(TopicSolcastDetailedForecast)
+	if assert.Len(t, forecast, 1, "invalid JSON keeps the last document") {
+		assert.Equal(t, 2.5, forecast[0].PvEstimate)
+		assert.True(t, forecast[0].PeriodStart.Equal(time.Date(2026, 3, 3, 21, 0, 0, 0, time.UTC)))
+	}
+
+	// Raw readers still work
+	var raw []map[string]any
+	data.GetJSON(TopicSolcastDetailedForecast, &raw)
+	assert.Len(t, raw, 1)
+}
+
+func TestGetForecastPeriods_Missing(t *testing.T) {
+	data := DisplayData{TopicData: map[string]any{
+		"plain":    makeStringTopic(testForecastJSON),
+		"forecast": &stats.JSONTopicData{Raw: "[]", Value: governor.ForecastPeriods{}},
+	}}
+	assert.Nil(t, data.GetForecastPeriods("plain"), "only decoded documents")
+	assert.Empty(t, data.GetForecastPeriods("forecast"))
+}
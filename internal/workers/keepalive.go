@@ -0,0 +1,63 @@
+package workers
+
+import (
+	"time"
+)
+
+// entityExpireAfter is the expire_after given to HA sensors that go unavailable when
+// powerctl stops publishing.
+const entityExpireAfter = 30 * time.Minute
+
+type keptMessage struct {
+	msg MQTTMessage
+	at  time.Time
+}
+
+// Keepalive republishes the latest state of tracked topics before their entities'
+// expire_after lapses, so a sensor whose value just hasn't changed in a while doesn't
+// go unavailable. Only track topics whose silence isn't itself meaningful: tank levels
+// stop publishing on purpose when their sensor drops out. mqttSenderWorker drives it;
+// a nil *Keepalive tracks nothing.
+type Keepalive struct {
+	expireAfter map[string]time.Duration
+	last        map[string]keptMessage
+}
+
+// NewKeepalive creates a keepalive tracking no topics.
+func NewKeepalive() *Keepalive {
+	return &Keepalive{expireAfter: make(map[string]time.Duration), last: make(map[string]keptMessage)}
+}
+
+// Track keeps topic alive for an entity with the given expire_after. Must be called
+// before mqttSenderWorker starts.
+func (k *Keepalive) Track(topic string, expireAfter time.Duration) {
+	k.expireAfter[topic] = expireAfter
+}
+
+// Published records a message as it goes out. Safe on a nil keepalive.
+func (k *Keepalive) Published(msg MQTTMessage, now time.Time) {
+	if k == nil {
+		return
+	}
+	if _, ok := k.expireAfter[msg.Topic]; ok {
+		k.last[msg.Topic] = keptMessage{msg: msg, at: now}
+	}
+}
+
+// Due returns the latest message of every tracked topic unpublished for half its
+// expire_after, leaving the other half for the resend to get through. Returned
+// messages count as published, so a resend stuck in the queue isn't repeated every
+// call. Topics never published are left to expire. Safe on a nil keepalive.
+func (k *Keepalive) Due(now time.Time) []MQTTMessage {
+	if k == nil {
+		return nil
+	}
+	var due []MQTTMessage
+	for topic, kept := range k.last {
+		if now.Sub(kept.at) >= k.expireAfter[topic]/2 {
+			due = append(due, kept.msg)
+			k.last[topic] = keptMessage{msg: kept.msg, at: now}
+		}
+	}
+	return due
+}
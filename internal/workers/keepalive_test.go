@@ -0,0 +1,33 @@
+package workers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeepalive_RepublishesAtHalfExpiry(t *testing.T) {
+	k := NewKeepalive()
+	k.Track("soc", 30*time.Minute)
+	t0 := time.Date(2026, 3, 4, 10, 0, 0, 0, time.Local)
+
+	assert.Empty(t, k.Due(t0.Add(time.Hour)), "never published, left to expire")
+
+	msg := MQTTMessage{Topic: "soc", Payload: []byte(`{"percentage":50}`)}
+	k.Published(msg, t0)
+	k.Published(MQTTMessage{Topic: "untracked"}, t0)
+
+	assert.Empty(t, k.Due(t0.Add(14*time.Minute)))
+	assert.Equal(t, []MQTTMessage{msg}, k.Due(t0.Add(15*time.Minute)))
+	assert.Empty(t, k.Due(t0.Add(16*time.Minute)), "resend counts as published")
+
+	newer := MQTTMessage{Topic: "soc", Payload: []byte(`{"percentage":51}`)}
+	k.Published(newer, t0.Add(20*time.Minute))
+	assert.Empty(t, k.Due(t0.Add(30*time.Minute)))
+	assert.Equal(t, []MQTTMessage{newer}, k.Due(t0.Add(35*time.Minute)), "latest value")
+
+	var nilKeepalive *Keepalive
+	nilKeepalive.Published(msg, t0)
+	assert.Nil(t, nilKeepalive.Due(t0))
+}
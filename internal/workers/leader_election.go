@@ -0,0 +1,174 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// TopicLeaderClaim is the retained claim the leader renews. The last claim the
+	// broker delivered wins, so instances claiming together agree on who holds it.
+	TopicLeaderClaim = "powerctl/leader/claim"
+	// topicLeaderInstances prefixes each instance's retained role and readiness.
+	topicLeaderInstances = "powerctl/leader/instances/"
+)
+
+// LeaderConfig configures leader election between redundant instances.
+type LeaderConfig struct {
+	InstanceID    string
+	Lease         time.Duration // A claim older than this can be taken over
+	RenewInterval time.Duration // How often the leader renews (and a standby checks) the claim
+}
+
+// LeaderClaim is the payload of TopicLeaderClaim.
+type LeaderClaim struct {
+	Instance string    `json:"instance"`
+	At       time.Time `json:"at"`
+}
+
+// InstanceStatus is each instance's retained role, so HA can show that the standby
+// is up and has data to take over with.
+type InstanceStatus struct {
+	Role  string    `json:"role"` // "leader" or "standby"
+	Ready bool      `json:"ready"`
+	At    time.Time `json:"at"`
+}
+
+// LeaderElection decides whether this instance may actuate. mqttSenderWorker drops
+// every outgoing message except leadership topics while it is standby, so the standby
+// keeps computing from the same data but publishes and calls nothing. A nil
+// *LeaderElection (election disabled) is always leader.
+type LeaderElection struct {
+	config LeaderConfig
+	leader atomic.Bool
+
+	latest  *LeaderClaim // last claim delivered by the broker
+	seenAt  time.Time    // when it was delivered; local time, so clock skew between hosts doesn't matter
+	started time.Time
+}
+
+// NewLeaderElection starts as standby until the broker echoes this instance's claim.
+func NewLeaderElection(config LeaderConfig) *LeaderElection {
+	return &LeaderElection{config: config}
+}
+
+// IsLeader reports whether this instance may actuate.
+func (l *LeaderElection) IsLeader() bool {
+	return l == nil || l.leader.Load()
+}
+
+// isLeadershipTopic reports whether topic is election traffic, which a standby still
+// publishes.
+func isLeadershipTopic(topic string) bool {
+	return strings.HasPrefix(topic, "powerctl/leader/")
+}
+
+// Allows reports whether msg may be published.
+func (l *LeaderElection) Allows(msg MQTTMessage) bool {
+	return l.IsLeader() || isLeadershipTopic(msg.Topic)
+}
+
+// Observe records a claim delivered by the broker and re-evaluates leadership.
+func (l *LeaderElection) Observe(claim LeaderClaim, now time.Time) {
+	l.latest = &claim
+	l.seenAt = now
+	l.evaluate(now)
+}
+
+// evaluate leads while the latest claim is this instance's and was delivered within the
+// lease. A leader that stops hearing its own renewals (broker gone) steps down with the
+// lease.
+func (l *LeaderElection) evaluate(now time.Time) {
+	leading := l.latest != nil && l.latest.Instance == l.config.InstanceID && now.Sub(l.seenAt) <= l.config.Lease
+	if was := l.leader.Swap(leading); was != leading {
+		if leading {
+			log.Printf("Leader election: %s is now leader\n", l.config.InstanceID)
+		} else if l.latest != nil && l.latest.Instance != l.config.InstanceID {
+			log.Printf("Leader election: %s yielding to %s, now standby\n", l.config.InstanceID, l.latest.Instance)
+		} else {
+			log.Printf("Leader election: %s lost its lease, now standby\n", l.config.InstanceID)
+		}
+	}
+}
+
+// ShouldClaim reports whether to publish a claim now: to renew our own, or to take over
+// one that hasn't been renewed within the lease (a retained claim left by a dead leader
+// expires a lease after it arrives). With no claim seen, an instance waits out a lease
+// after starting so the retained claim of a running leader has time to arrive.
+func (l *LeaderElection) ShouldClaim(now time.Time) bool {
+	if l.started.IsZero() {
+		l.started = now
+	}
+	switch {
+	case l.latest == nil:
+		return now.Sub(l.started) >= l.config.Lease
+	case l.latest.Instance == l.config.InstanceID:
+		return true
+	default:
+		return now.Sub(l.seenAt) > l.config.Lease
+	}
+}
+
+// leaderElectionWorker runs the election: it renews or takes over the claim every
+// RenewInterval, follows claims from the broker, and publishes this instance's role.
+// The instance is ready once broadcastWorker has delivered data.
+func leaderElectionWorker(
+	ctx context.Context,
+	election *LeaderElection,
+	claimChan <-chan SensorMessage,
+	dataChan <-chan DisplayData,
+	sender *MQTTSender,
+) {
+	config := election.config
+	log.Printf("Leader election started as %s (lease %s)\n", config.InstanceID, config.Lease)
+
+	ticker := time.NewTicker(config.RenewInterval)
+	defer ticker.Stop()
+	ready := false
+
+	publishStatus := func(now time.Time) {
+		role := "standby"
+		if election.IsLeader() {
+			role = "leader"
+		}
+		payload, _ := json.Marshal(InstanceStatus{Role: role, Ready: ready, At: now})
+		sender.Send(MQTTMessage{Topic: topicLeaderInstances + config.InstanceID, Payload: payload, QoS: 1, Retain: true})
+	}
+
+	for {
+		select {
+		case msg := <-claimChan:
+			var claim LeaderClaim
+			if err := json.Unmarshal([]byte(msg.Value), &claim); err != nil {
+				log.Printf("Leader election: ignoring invalid claim %q: %v\n", msg.Value, err)
+				continue
+			}
+			wasLeader := election.IsLeader()
+			election.Observe(claim, time.Now())
+			if election.IsLeader() != wasLeader {
+				publishStatus(time.Now())
+			}
+
+		case <-dataChan:
+			if !ready {
+				ready = true
+				publishStatus(time.Now())
+			}
+
+		case now := <-ticker.C:
+			election.evaluate(now)
+			if election.ShouldClaim(now) {
+				payload, _ := json.Marshal(LeaderClaim{Instance: config.InstanceID, At: now})
+				sender.Send(MQTTMessage{Topic: TopicLeaderClaim, Payload: payload, QoS: 1, Retain: true})
+			}
+			publishStatus(now)
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeaderElection_ClaimAndTakeover(t *testing.T) {
+	start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	lease := 30 * time.Second
+	a := NewLeaderElection(LeaderConfig{InstanceID: "a", Lease: lease})
+	b := NewLeaderElection(LeaderConfig{InstanceID: "b", Lease: lease})
+
+	// Nobody claims before a lease has passed, in case a leader's retained claim is on its way
+	assert.False(t, a.ShouldClaim(start))
+	assert.False(t, b.ShouldClaim(start))
+	assert.True(t, a.ShouldClaim(start.Add(lease)))
+	assert.True(t, b.ShouldClaim(start.Add(lease)))
+
+	// Both claimed; the broker delivered a's then b's, so both end up agreeing on b
+	now := start.Add(lease + time.Second)
+	for _, claim := range []LeaderClaim{{Instance: "a"}, {Instance: "b"}} {
+		a.Observe(claim, now)
+		b.Observe(claim, now)
+	}
+	assert.False(t, a.IsLeader())
+	assert.True(t, b.IsLeader())
+	assert.True(t, b.ShouldClaim(now.Add(10*time.Second)), "leader renews")
+	assert.False(t, a.ShouldClaim(now.Add(10*time.Second)), "standby waits while the claim is fresh")
+
+	// b stops renewing: a takes over after the lease, and b steps down on its own
+	later := now.Add(lease + time.Second)
+	assert.True(t, a.ShouldClaim(later))
+	b.evaluate(later)
+	assert.False(t, b.IsLeader())
+	a.Observe(LeaderClaim{Instance: "a"}, later)
+	assert.True(t, a.IsLeader())
+
+	var disabled *LeaderElection
+	assert.True(t, disabled.IsLeader())
+	assert.True(t, disabled.Allows(MQTTMessage{Topic: TopicCallServiceProxy}))
+	assert.False(t, b.Allows(MQTTMessage{Topic: TopicCallServiceProxy}))
+	assert.True(t, b.Allows(MQTTMessage{Topic: topicLeaderInstances + "b"}))
+}
+
+func TestLeaderElectionWorker_PublishesReadiness(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := make(chan MQTTMessage, 10)
+	claims := make(chan SensorMessage, 1)
+	data := make(chan DisplayData, 1)
+	election := NewLeaderElection(LeaderConfig{InstanceID: "b", Lease: time.Hour, RenewInterval: time.Hour})
+	go leaderElectionWorker(ctx, election, claims, data, NewMQTTSender(out))
+
+	data <- DisplayData{}
+	msg := <-out
+	assert.Equal(t, "powerctl/leader/instances/b", msg.Topic)
+	var status InstanceStatus
+	assert.NoError(t, json.Unmarshal(msg.Payload, &status))
+	assert.Equal(t, "standby", status.Role)
+	assert.True(t, status.Ready)
+
+	claims <- SensorMessage{Topic: TopicLeaderClaim, Value: `{"instance":"b","at":"2026-05-01T12:00:00Z"}`}
+	assert.NoError(t, json.Unmarshal((<-out).Payload, &status))
+	assert.Equal(t, "leader", status.Role)
+}
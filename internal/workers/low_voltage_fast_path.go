@@ -0,0 +1,41 @@
+package workers
+
+import (
+	"strconv"
+	"strings"
+)
+
+// LowVoltageFastPath passes raw battery voltage readings below Trip straight from
+// mqttWorker to baseline control, skipping statsWorker's aggregation and the broadcast
+// tick. Readings outside batteryVoltageRule's range are sensor glitches, not a flat
+// battery, and are ignored. A nil *LowVoltageFastPath ignores everything.
+type LowVoltageFastPath struct {
+	Topic string
+	Trip  float64
+	Ch    chan float64 // One slot, latest reading wins
+}
+
+// NewLowVoltageFastPath watches topic for readings below trip.
+func NewLowVoltageFastPath(topic string, trip float64) *LowVoltageFastPath {
+	return &LowVoltageFastPath{Topic: topic, Trip: trip, Ch: make(chan float64, 1)}
+}
+
+// Tap checks one incoming message, for TopicRoute.Tap. Never blocks.
+func (f *LowVoltageFastPath) Tap(msg SensorMessage) {
+	if f == nil || msg.Topic != f.Topic {
+		return
+	}
+	voltage, err := strconv.ParseFloat(strings.TrimSpace(msg.Value), 64)
+	if err != nil || voltage >= f.Trip || voltage < batteryVoltageRule.Min || voltage > batteryVoltageRule.Max {
+		return
+	}
+	offerLatest(f.Ch, voltage)
+}
+
+// Trips returns the channel of tripping readings, nil (never ready) if disabled.
+func (f *LowVoltageFastPath) Trips() <-chan float64 {
+	if f == nil {
+		return nil
+	}
+	return f.Ch
+}
@@ -0,0 +1,49 @@
+package workers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLowVoltageFastPath_Tap(t *testing.T) {
+	f := NewLowVoltageFastPath("b2/voltage", 49.5)
+
+	f.Tap(SensorMessage{Topic: "b2/voltage", Value: "50.1"})
+	f.Tap(SensorMessage{Topic: "b3/voltage", Value: "48.0"})
+	f.Tap(SensorMessage{Topic: "b2/voltage", Value: "0"}) // glitch, not a flat battery
+	f.Tap(SensorMessage{Topic: "b2/voltage", Value: "unknown"})
+	assert.Empty(t, f.Ch)
+
+	f.Tap(SensorMessage{Topic: "b2/voltage", Value: "49.3"})
+	f.Tap(SensorMessage{Topic: "b2/voltage", Value: "49.1"})
+	assert.InDelta(t, 49.1, <-f.Trips(), 0, "the latest reading wins")
+
+	var disabled *LowVoltageFastPath
+	assert.NotPanics(t, func() { disabled.Tap(SensorMessage{Topic: "b2/voltage", Value: "45"}) })
+	assert.Nil(t, disabled.Trips())
+}
+
+func TestBaselineController_FastTripHoldsUntilRecovery(t *testing.T) {
+	config := makeTestBaselineConfig()
+	config.LowVoltageFastTrip = 49.5
+	controller := newBaselineController(config, nil)
+	input := makeBaselineInput()
+	input.ManualMode = true
+	input.ManualInverterCount = 3
+	input.Battery2Voltage = 53.5
+	input.Battery2VoltageP50_5Min = 53.5
+	t0 := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	count, _ := controller.Decide(input, t0)
+	assert.Equal(t, 3, count)
+
+	assert.True(t, controller.FastTrip(49.2, t0.Add(time.Second)))
+	assert.False(t, controller.FastTrip(49.0, t0.Add(2*time.Second)), "already tripped")
+
+	// The aggregated voltage hasn't caught up, but the trip holds like any low-voltage cut
+	count, debug := controller.Decide(input, t0.Add(3*time.Second))
+	assert.Equal(t, 0, count)
+	assert.True(t, debug.Battery2LowVoltage)
+}
@@ -0,0 +1,167 @@
+package workers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/ryansname/powerctl/internal/stats"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metricsMeasurement is the line protocol measurement every sample is written under.
+const metricsMeasurement = "powerctl"
+
+// MetricsExportConfig configures the long-term metrics exporter. Any endpoint that
+// accepts InfluxDB line protocol works: InfluxDB v2 (/api/v2/write?org=..&bucket=..)
+// or VictoriaMetrics (/write).
+type MetricsExportConfig struct {
+	WriteURL       string
+	Token          string        // Optional; sent as "Authorization: Token <token>"
+	SampleInterval time.Duration // How often the latest value of every topic is sampled
+	BatchSize      int           // Lines buffered before a write is forced
+	FlushInterval  time.Duration // Maximum time lines sit in the buffer
+}
+
+// lineProtocolEscaper escapes tag values per the line protocol spec.
+var lineProtocolEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// metricLine formats one sample. The topic (minus its /state suffix) is the tag, so
+// HA sensors and powerctl's own derived values (SOC, available energy) are both kept.
+func metricLine(topic string, value float64, ts time.Time) string {
+	tag := lineProtocolEscaper.Replace(strings.TrimSuffix(topic, "/state"))
+	return fmt.Sprintf("%s,topic=%s value=%s %d",
+		metricsMeasurement, tag, strconv.FormatFloat(value, 'f', -1, 64), ts.UnixNano())
+}
+
+// sampleMetrics returns a line for every numeric and boolean topic in data, sorted
+// by topic. Booleans are written as 0/1; string topics are skipped.
+func sampleMetrics(data DisplayData, ts time.Time) []string {
+	var lines []string
+	for topic, td := range data.TopicData {
+		switch d := td.(type) {
+		case *stats.FloatTopicData:
+			lines = append(lines, metricLine(topic, d.Current, ts))
+		case *stats.BooleanTopicData:
+			value := 0.0
+			if d.Current {
+				value = 1
+			}
+			lines = append(lines, metricLine(topic, value, ts))
+		}
+	}
+	slices.Sort(lines)
+	return lines
+}
+
+// counterMetrics returns lines for the daily summary's day-so-far counters, tagged
+// counter/<name>[/<key>], sorted. nil before the first refresh.
+func counterMetrics(summary *DailySummary, ts time.Time) []string {
+	if summary == nil {
+		return nil
+	}
+	lines := []string{
+		metricLine("counter/mode_transitions", float64(summary.ModeTransitions), ts),
+		metricLine("counter/low_voltage_events", float64(summary.LowVoltageEvents), ts),
+	}
+	for rule, minutes := range summary.RuleMinutes {
+		lines = append(lines, metricLine("counter/rule_minutes/"+rule, minutes, ts))
+	}
+	for inverter, n := range summary.InverterSwitches {
+		lines = append(lines, metricLine("counter/inverter_switches/"+inverter, float64(n), ts))
+	}
+	slices.Sort(lines)
+	return lines
+}
+
+// writeLineProtocol POSTs a batch of lines to the configured endpoint.
+func writeLineProtocol(ctx context.Context, client *http.Client, config MetricsExportConfig, lines []string) error {
+	body := strings.Join(lines, "\n") + "\n"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.WriteURL, bytes.NewBufferString(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if config.Token != "" {
+		req.Header.Set("Authorization", "Token "+config.Token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("metrics write returned %s", resp.Status)
+	}
+	return nil
+}
+
+// metricsExportWorker samples DisplayData every SampleInterval and writes batches of
+// line protocol to the metrics endpoint. Writes happen on a separate goroutine so a
+// slow endpoint never backs up the broadcast channel; if writes fall behind, whole
+// batches are dropped rather than buffered without bound.
+func metricsExportWorker(
+	ctx context.Context,
+	dataChan <-chan DisplayData,
+	config MetricsExportConfig,
+) {
+	log.Println("Metrics export worker started")
+
+	batches := make(chan []string, 4)
+	go func() {
+		client := &http.Client{Timeout: 10 * time.Second}
+		for {
+			select {
+			case batch := <-batches:
+				if err := writeLineProtocol(ctx, client, config, batch); err != nil {
+					log.Printf("Metrics export: dropped %d lines: %v\n", len(batch), err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var buffer []string
+	var lastSample, lastFlush time.Time
+
+	flush := func(now time.Time) {
+		lastFlush = now
+		if len(buffer) == 0 {
+			return
+		}
+		select {
+		case batches <- buffer:
+		default:
+			log.Printf("Metrics export: writer behind, dropped %d lines\n", len(buffer))
+		}
+		buffer = nil
+	}
+
+	for {
+		select {
+		case data := <-dataChan:
+			now := time.Now()
+			if now.Sub(lastSample) >= config.SampleInterval {
+				buffer = append(buffer, sampleMetrics(data, now)...)
+				buffer = append(buffer, counterMetrics(dailyCounters.Load(), now)...)
+				lastSample = now
+			}
+			if len(buffer) >= config.BatchSize || now.Sub(lastFlush) >= config.FlushInterval {
+				flush(now)
+			}
+
+		case <-ctx.Done():
+			log.Println("Metrics export worker stopped")
+			return
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package workers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ryansname/powerctl/internal/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricLine(t *testing.T) {
+	ts := time.Unix(1700000000, 0)
+	assert.Equal(t,
+		"powerctl,topic=homeassistant/sensor/battery_2_available_energy value=8000.5 1700000000000000000",
+		metricLine("homeassistant/sensor/battery_2_available_energy/state", 8000.5, ts))
+	assert.Equal(t,
+		`powerctl,topic=odd\ topic\,with\=chars value=1 1700000000000000000`,
+		metricLine("odd topic,with=chars", 1, ts))
+}
+
+func TestSampleMetrics(t *testing.T) {
+	data := DisplayData{TopicData: map[string]any{
+		"b/state": &stats.BooleanTopicData{Current: true, Raw: "on"},
+		"a/state": &stats.FloatTopicData{Current: 2.5},
+		"c/state": &stats.StringTopicData{Current: "Bulk Charging"},
+	}}
+	ts := time.Unix(10, 0)
+
+	assert.Equal(t, []string{
+		"powerctl,topic=a value=2.5 10000000000",
+		"powerctl,topic=b value=1 10000000000",
+	}, sampleMetrics(data, ts))
+}
+
+func TestCounterMetrics(t *testing.T) {
+	ts := time.Unix(10, 0)
+	assert.Nil(t, counterMetrics(nil, ts), "before the first refresh")
+
+	summary := &DailySummary{
+		RuleMinutes:      map[string]float64{"Baseline": 90.5},
+		ModeTransitions:  4,
+		InverterSwitches: map[string]int{"switch.inv1": 3},
+	}
+	assert.Equal(t, []string{
+		"powerctl,topic=counter/inverter_switches/switch.inv1 value=3 10000000000",
+		"powerctl,topic=counter/low_voltage_events value=0 10000000000",
+		"powerctl,topic=counter/mode_transitions value=4 10000000000",
+		"powerctl,topic=counter/rule_minutes/Baseline value=90.5 10000000000",
+	}, counterMetrics(summary, ts))
+}
+
+func TestWriteLineProtocol(t *testing.T) {
+	var gotBody, gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		gotAuth = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	config := MetricsExportConfig{WriteURL: server.URL, Token: "tok"}
+	err := writeLineProtocol(context.Background(), server.Client(), config, []string{"a", "b"})
+	assert.NoError(t, err)
+	assert.Equal(t, "a\nb\n", gotBody)
+	assert.Equal(t, "Token tok", gotAuth)
+}
+
+func TestWriteLineProtocol_ServerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	err := writeLineProtocol(context.Background(), server.Client(), MetricsExportConfig{WriteURL: server.URL}, []string{"a"})
+	assert.Error(t, err)
+}
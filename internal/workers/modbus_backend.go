@@ -0,0 +1,187 @@
+package workers
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"time"
+)
+
+// modbusTimeout bounds connecting to a Modbus-TCP device and each request/response.
+const modbusTimeout = 3 * time.Second
+
+// ModbusTarget is the register that switches an inverter on a Modbus-TCP device, e.g. a
+// Victron GX (unit 227, register 33 "VE.Bus mode": 3 on, 4 off).
+type ModbusTarget struct {
+	Address  string `json:"address"` // host:port, usually port 502
+	UnitID   byte   `json:"unit_id"`
+	Register uint16 `json:"register"` // Holding register, written with function 0x06
+	OnValue  uint16 `json:"on_value"`
+	OffValue uint16 `json:"off_value"`
+}
+
+// modbusRoute diverts call_service proxy messages for Modbus-backed inverters from
+// mqttSenderWorker to modbusWorker, after the safety interlock has checked them.
+type modbusRoute struct {
+	targets map[string]ModbusTarget // switch entity ID -> target
+	calls   chan MQTTMessage
+}
+
+// newModbusRoute returns a route for the inverters with a Modbus target, or nil if none
+// have one.
+func newModbusRoute(inverters []InverterInfo) *modbusRoute {
+	targets := make(map[string]ModbusTarget)
+	for _, inv := range inverters {
+		if inv.Modbus != nil {
+			targets[inv.EntityID] = *inv.Modbus
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	return &modbusRoute{targets: targets, calls: make(chan MQTTMessage, 100)}
+}
+
+// Handles reports whether msg is a service call for a Modbus-backed entity. Safe on a
+// nil route.
+func (r *modbusRoute) Handles(msg MQTTMessage) bool {
+	if r == nil || msg.Topic != TopicCallServiceProxy {
+		return false
+	}
+	var call proxyServiceCall
+	if err := json.Unmarshal(msg.Payload, &call); err != nil {
+		return false
+	}
+	_, ok := r.targets[call.EntityID]
+	return ok
+}
+
+// modbusClient holds one connection per device and writes single registers.
+type modbusClient struct {
+	conns         map[string]net.Conn
+	transactionID uint16
+}
+
+func newModbusClient() *modbusClient {
+	return &modbusClient{conns: make(map[string]net.Conn)}
+}
+
+// WriteRegister writes value to a holding register (function 0x06) and checks the echo.
+// The connection is dropped on any error and redialled on the next write.
+func (c *modbusClient) WriteRegister(target ModbusTarget, value uint16) error {
+	conn, ok := c.conns[target.Address]
+	if !ok {
+		var err error
+		conn, err = net.DialTimeout("tcp", target.Address, modbusTimeout)
+		if err != nil {
+			return fmt.Errorf("modbus connect %s: %w", target.Address, err)
+		}
+		c.conns[target.Address] = conn
+	}
+
+	err := c.writeRegister(conn, target, value)
+	if err != nil {
+		_ = conn.Close()
+		delete(c.conns, target.Address)
+		return fmt.Errorf("modbus write %s unit %d register %d: %w", target.Address, target.UnitID, target.Register, err)
+	}
+	return nil
+}
+
+func (c *modbusClient) writeRegister(conn net.Conn, target ModbusTarget, value uint16) error {
+	c.transactionID++
+	if err := conn.SetDeadline(time.Now().Add(modbusTimeout)); err != nil {
+		return err
+	}
+
+	// MBAP header (transaction, protocol 0, length of what follows, unit) then the PDU
+	request := make([]byte, 12)
+	binary.BigEndian.PutUint16(request[0:], c.transactionID)
+	binary.BigEndian.PutUint16(request[4:], 6)
+	request[6] = target.UnitID
+	request[7] = 0x06
+	binary.BigEndian.PutUint16(request[8:], target.Register)
+	binary.BigEndian.PutUint16(request[10:], value)
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	length := binary.BigEndian.Uint16(header[4:])
+	if length < 2 || length > 254 {
+		return fmt.Errorf("bad response length %d", length)
+	}
+	pdu := make([]byte, length-1)
+	if _, err := io.ReadFull(conn, pdu); err != nil {
+		return err
+	}
+	if id := binary.BigEndian.Uint16(header[0:]); id != c.transactionID {
+		return fmt.Errorf("response for transaction %d, want %d", id, c.transactionID)
+	}
+	if pdu[0] == 0x06|0x80 {
+		if len(pdu) < 2 {
+			return fmt.Errorf("truncated exception response % x", pdu)
+		}
+		return fmt.Errorf("exception code %d", pdu[1])
+	}
+	if len(pdu) != 5 || pdu[0] != 0x06 || binary.BigEndian.Uint16(pdu[3:]) != value {
+		return fmt.Errorf("unexpected response % x", pdu)
+	}
+	return nil
+}
+
+// Close closes every open connection.
+func (c *modbusClient) Close() {
+	for address, conn := range c.conns {
+		_ = conn.Close()
+		delete(c.conns, address)
+	}
+}
+
+// modbusWorker writes the on/off register for service calls routed to Modbus-backed
+// inverters. Failed writes aren't retried here; the command tracker resends the call
+// while the inverter's state topic disagrees.
+func modbusWorker(ctx context.Context, route *modbusRoute) {
+	log.Println("Modbus worker started")
+
+	client := newModbusClient()
+	defer client.Close()
+
+	for {
+		select {
+		case msg := <-route.calls:
+			var call proxyServiceCall
+			if err := json.Unmarshal(msg.Payload, &call); err != nil {
+				log.Printf("Modbus worker: invalid service call payload: %v\n", err)
+				continue
+			}
+			target := route.targets[call.EntityID]
+
+			var value uint16
+			switch call.Service {
+			case "turn_on":
+				value = target.OnValue
+			case "turn_off":
+				value = target.OffValue
+			default:
+				log.Printf("Modbus worker: %s.%s is not supported for %s\n", call.Domain, call.Service, call.EntityID)
+				continue
+			}
+
+			if err := client.WriteRegister(target, value); err != nil {
+				log.Printf("Modbus worker: %s %s: %v\n", call.Service, call.EntityID, err)
+			}
+
+		case <-ctx.Done():
+			log.Println("Modbus worker stopped")
+			return
+		}
+	}
+}
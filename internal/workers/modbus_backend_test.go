@@ -0,0 +1,101 @@
+package workers
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// serveModbus answers write-single-register requests on a loopback listener, echoing
+// them unless the register is exceptionRegister. Written values are sent on writes.
+func serveModbus(t *testing.T, exceptionRegister uint16) (address string, writes <-chan uint16) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("loopback listener unavailable: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	ch := make(chan uint16, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		request := make([]byte, 12)
+		for {
+			if _, err := io.ReadFull(conn, request); err != nil {
+				return
+			}
+			if binary.BigEndian.Uint16(request[8:]) == exceptionRegister {
+				response := append([]byte{}, request[:9]...)
+				binary.BigEndian.PutUint16(response[4:], 3)
+				response[7], response[8] = 0x86, 2 // illegal data address
+				_, _ = conn.Write(response)
+				continue
+			}
+			ch <- binary.BigEndian.Uint16(request[10:])
+			_, _ = conn.Write(request)
+		}
+	}()
+	return listener.Addr().String(), ch
+}
+
+func TestModbusClient_WriteRegister(t *testing.T) {
+	address, writes := serveModbus(t, 99)
+	client := newModbusClient()
+	defer client.Close()
+
+	target := ModbusTarget{Address: address, UnitID: 227, Register: 33, OnValue: 3, OffValue: 4}
+	assert.NoError(t, client.WriteRegister(target, target.OnValue))
+	assert.Equal(t, uint16(3), <-writes)
+	assert.NoError(t, client.WriteRegister(target, target.OffValue), "reuses the connection")
+	assert.Equal(t, uint16(4), <-writes)
+
+	target.Register = 99
+	assert.ErrorContains(t, client.WriteRegister(target, 3), "exception code 2")
+}
+
+func TestModbusClient_TruncatedExceptionResponse(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("loopback listener unavailable: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		request := make([]byte, 12)
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return
+		}
+		// Exception function code with no exception code byte
+		response := append([]byte{}, request[:8]...)
+		binary.BigEndian.PutUint16(response[4:], 2)
+		response[7] = 0x86
+		_, _ = conn.Write(response)
+	}()
+
+	client := newModbusClient()
+	defer client.Close()
+	target := ModbusTarget{Address: listener.Addr().String(), UnitID: 227, Register: 33, OnValue: 3}
+	assert.ErrorContains(t, client.WriteRegister(target, 3), "truncated exception response")
+}
+
+func TestModbusRoute_HandlesOnlyModbusInverters(t *testing.T) {
+	assert.Nil(t, newModbusRoute([]InverterInfo{{EntityID: "switch.inv_1"}}))
+
+	route := newModbusRoute([]InverterInfo{
+		{EntityID: "switch.inv_1"},
+		{EntityID: "switch.inv_2", Modbus: &ModbusTarget{Address: "gx:502"}},
+	})
+	assert.True(t, route.Handles(serviceCallMessage("switch", "turn_on", "switch.inv_2", nil)))
+	assert.False(t, route.Handles(serviceCallMessage("switch", "turn_on", "switch.inv_1", nil)))
+	assert.False(t, route.Handles(MQTTMessage{Topic: "powerhouse_3/W/x", Payload: []byte("{}")}))
+}
@@ -1,4 +1,4 @@
-package main
+package workers
 
 import (
 	"context"
@@ -31,7 +31,11 @@ func mqttInterceptorWorker(
 
 		case msg := <-inputChan:
 			if forceEnable || enabled || isDiscoveryTopic(msg.Topic) {
-				outputChan <- msg
+				if isTurnOff(msg) {
+					sendWaiting(ctx, outputChan, msg, sendTimeout, name+" interceptor turn_off")
+				} else {
+					sendWithin(ctx, outputChan, msg, sendTimeout, name+" interceptor "+msg.Topic)
+				}
 			} else {
 				log.Printf("%s disabled, dropping message to %s\n", name, msg.Topic)
 			}
@@ -0,0 +1,2058 @@
+package workers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+)
+
+type lastSentInfo struct {
+	payload []byte
+	sentAt  time.Time
+}
+
+const resendInterval = 5 * time.Minute
+
+const (
+	deviceNamePowerctl       = "Powerctl"
+	deviceManufacturerCustom = "Custom"
+	deviceNameBattery2       = "Battery 2"
+	deviceIDBattery3         = "battery_3"
+	deviceNameBattery3       = "Battery 3"
+	deviceIDInverter10       = "powerhouse_inverter_10"
+	deviceNameInverter10     = "Powerhouse Inverter 10"
+	deviceModelMultiplus2    = "Multiplus II 48/5000/70"
+	deviceClassCurrent       = "current"
+	deviceIDPowerctl         = "powerctl"
+	deviceIDWaterTanks       = "water_tanks"
+	deviceNameWaterTanks     = "Water Tanks"
+	stateClassMeasurement    = "measurement"
+	valueTemplateJSONValue   = "{{ value_json.value }}"
+	haServiceValueKey        = "value"
+)
+
+// MQTTMessage represents an outgoing MQTT message
+type MQTTMessage struct {
+	Topic    string
+	Payload  []byte
+	QoS      byte
+	Retain   bool
+	Expect   *CommandExpectation // Optional; set on service calls the command tracker should confirm
+	Priority MessagePriority     // Queue priority while disconnected; default classifies by topic
+}
+
+// MQTTSender wraps a channel for sending MQTT messages with helper methods. Sends give
+// up once the sender's context is done or after sendTimeout, so a stalled sender worker
+// can't block every worker publishing through it. turn_off calls are the exception:
+// they wait for the sender worker however long it takes.
+type MQTTSender struct {
+	ch  chan<- MQTTMessage
+	ctx context.Context
+}
+
+// NewMQTTSender creates a new MQTTSender wrapping the given channel
+func NewMQTTSender(ch chan<- MQTTMessage) *MQTTSender {
+	return &MQTTSender{ch: ch, ctx: context.Background()}
+}
+
+// WithContext returns a sender whose sends give up once ctx is done.
+func (s *MQTTSender) WithContext(ctx context.Context) *MQTTSender {
+	return &MQTTSender{ch: s.ch, ctx: ctx}
+}
+
+// Send sends a raw MQTTMessage
+func (s *MQTTSender) Send(msg MQTTMessage) {
+	if isTurnOff(msg) {
+		sendWaiting(s.ctx, s.ch, msg, sendTimeout, "MQTT sender turn_off")
+		return
+	}
+	sendWithin(s.ctx, s.ch, msg, sendTimeout, "MQTT sender "+msg.Topic)
+}
+
+// TopicCallServiceProxy is the MQTT topic an HA automation listens on to make
+// service calls on powerctl's behalf (replaces the old nodered/proxy flow).
+const TopicCallServiceProxy = "powerctl/ha/call_service"
+
+// CallService sends a Home Assistant service call via the MQTT call_service proxy
+func (s *MQTTSender) CallService(domain, service, entityID string, data map[string]any) {
+	s.Send(serviceCallMessage(domain, service, entityID, data))
+}
+
+// CallServiceExpecting sends a service call and asks the command tracker to resend it
+// until stateTopic reports state.
+func (s *MQTTSender) CallServiceExpecting(
+	domain, service, entityID string,
+	data map[string]any,
+	stateTopic, state string,
+) {
+	msg := serviceCallMessage(domain, service, entityID, data)
+	msg.Expect = &CommandExpectation{StateTopic: stateTopic, State: state}
+	s.Send(msg)
+}
+
+// serviceCallMessage builds the call_service proxy message for a service call.
+func serviceCallMessage(domain, service, entityID string, data map[string]any) MQTTMessage {
+	payload := map[string]any{
+		"domain":  domain,
+		"service": service,
+	}
+	if entityID != "" {
+		payload["entity_id"] = entityID
+	}
+	if data != nil {
+		payload["data"] = data
+	}
+	payloadBytes, _ := json.Marshal(payload)
+
+	return MQTTMessage{
+		Topic:   TopicCallServiceProxy,
+		Payload: payloadBytes,
+		QoS:     1,
+		Retain:  false,
+	}
+}
+
+// CreateBatteryEntity creates a Home Assistant battery entity via MQTT discovery
+func (s *MQTTSender) CreateBatteryEntity(
+	batteryName string,
+	capacityKWh float64,
+	manufacturer string,
+	entityName, entityClass, entityMeasure, jsonKey string,
+	displayPrecision int,
+) error {
+	type haDeviceConfig struct {
+		Identifiers  []string `json:"identifiers"`
+		Name         string   `json:"name"`
+		Manufacturer string   `json:"manufacturer,omitempty"`
+		Model        string   `json:"model,omitempty"`
+	}
+
+	type haEntityConfig struct {
+		Name                string         `json:"name,omitempty"`
+		DeviceClass         string         `json:"device_class"`
+		StateTopic          string         `json:"state_topic"`
+		JsonAttributesTopic string         `json:"json_attributes_topic,omitempty"`
+		UnitOfMeasure       string         `json:"unit_of_measurement,omitempty"`
+		ValueTemplate       string         `json:"value_template"`
+		UniqueId            string         `json:"unique_id"`
+		ExpireAfter         uint           `json:"expire_after,omitempty"`
+		StateClass          string         `json:"state_class,omitempty"`
+		DisplayPrecision    int            `json:"suggested_display_precision,omitempty"`
+		Device              haDeviceConfig `json:"device"`
+	}
+
+	topics := NewTopicBuilder(batteryName)
+	deviceId := topics.DeviceID()
+
+	config := haEntityConfig{
+		Name:                entityName,
+		DeviceClass:         entityClass,
+		StateTopic:          topics.State("sensor", ""),
+		JsonAttributesTopic: topics.Attributes("sensor", ""),
+		UnitOfMeasure:       entityMeasure,
+		ValueTemplate:       "{{ value_json." + jsonKey + "}}",
+		UniqueId:            deviceId + "_" + jsonKey,
+		ExpireAfter:         uint(entityExpireAfter.Seconds()),
+		StateClass:          stateClassMeasurement,
+		DisplayPrecision:    displayPrecision,
+		Device: haDeviceConfig{
+			Identifiers:  []string{deviceId},
+			Name:         batteryName,
+			Manufacturer: manufacturer,
+			Model:        fmt.Sprintf("%.0f kWh", capacityKWh),
+		},
+	}
+
+	configTopic := topics.DiscoveryConfig("sensor", jsonKey)
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.Send(MQTTMessage{
+		Topic:   configTopic,
+		Payload: payload,
+		QoS:     2,
+		Retain:  true,
+	})
+
+	return nil
+}
+
+// batteryDerivedStateTopic returns the state topic for a per-battery sensor published
+// as a plain value (rather than a key in the shared SOC JSON payload).
+func batteryDerivedStateTopic(batteryName, suffix string) string {
+	return NewTopicBuilder(batteryName).State("sensor", suffix)
+}
+
+// CreateBatteryDerivedEntity creates a per-battery sensor on the battery's HA device
+// whose state is published retained to batteryDerivedStateTopic. Used for slow-moving
+// estimates (efficiency, health) that must survive restarts.
+func (s *MQTTSender) CreateBatteryDerivedEntity(
+	batteryName string,
+	capacityKWh float64,
+	manufacturer string,
+	entityName, suffix, unit string,
+	displayPrecision int,
+) error {
+	type haDeviceConfig struct {
+		Identifiers  []string `json:"identifiers"`
+		Name         string   `json:"name"`
+		Manufacturer string   `json:"manufacturer,omitempty"`
+		Model        string   `json:"model,omitempty"`
+	}
+
+	type haEntityConfig struct {
+		Name                string         `json:"name,omitempty"`
+		StateTopic          string         `json:"state_topic"`
+		JsonAttributesTopic string         `json:"json_attributes_topic,omitempty"`
+		UnitOfMeasure       string         `json:"unit_of_measurement,omitempty"`
+		UniqueId            string         `json:"unique_id"`
+		StateClass          string         `json:"state_class,omitempty"`
+		DisplayPrecision    int            `json:"suggested_display_precision,omitempty"`
+		Device              haDeviceConfig `json:"device"`
+	}
+
+	topics := NewTopicBuilder(batteryName)
+	deviceId := topics.DeviceID()
+
+	config := haEntityConfig{
+		Name:                entityName,
+		StateTopic:          topics.State("sensor", suffix),
+		JsonAttributesTopic: topics.Attributes("sensor", suffix),
+		UnitOfMeasure:       unit,
+		UniqueId:            deviceId + "_" + suffix,
+		StateClass:          stateClassMeasurement,
+		DisplayPrecision:    displayPrecision,
+		Device: haDeviceConfig{
+			Identifiers:  []string{deviceId},
+			Name:         batteryName,
+			Manufacturer: manufacturer,
+			Model:        fmt.Sprintf("%.0f kWh", capacityKWh),
+		},
+	}
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.Send(MQTTMessage{
+		Topic:   topics.DiscoveryConfig("sensor", suffix),
+		Payload: payload,
+		QoS:     2,
+		Retain:  true,
+	})
+
+	return nil
+}
+
+// CreateBatteryCalibrationEntities creates the battery's Last Calibrated timestamp
+// sensor (the latest CalibrationEvent in its attributes) and its Calibrate Full button,
+// which publishes to batteryCalibratePressTopic.
+func (s *MQTTSender) CreateBatteryCalibrationEntities(batteryName string, capacityKWh float64, manufacturer string) error {
+	type haDeviceConfig struct {
+		Identifiers  []string `json:"identifiers"`
+		Name         string   `json:"name"`
+		Manufacturer string   `json:"manufacturer,omitempty"`
+		Model        string   `json:"model,omitempty"`
+	}
+
+	type haSensorConfig struct {
+		Name                string         `json:"name"`
+		DeviceClass         string         `json:"device_class"`
+		StateTopic          string         `json:"state_topic"`
+		JsonAttributesTopic string         `json:"json_attributes_topic"`
+		UniqueId            string         `json:"unique_id"`
+		Icon                string         `json:"icon"`
+		Device              haDeviceConfig `json:"device"`
+	}
+
+	type haButtonConfig struct {
+		Name         string         `json:"name"`
+		CommandTopic string         `json:"command_topic"`
+		UniqueId     string         `json:"unique_id"`
+		Icon         string         `json:"icon"`
+		Device       haDeviceConfig `json:"device"`
+	}
+
+	topics := NewTopicBuilder(batteryName)
+	device := haDeviceConfig{
+		Identifiers:  []string{topics.DeviceID()},
+		Name:         batteryName,
+		Manufacturer: manufacturer,
+		Model:        fmt.Sprintf("%.0f kWh", capacityKWh),
+	}
+
+	sensor, err := json.Marshal(haSensorConfig{
+		Name:                "Last Calibrated",
+		DeviceClass:         "timestamp",
+		StateTopic:          topics.State("sensor", "last_calibrated"),
+		JsonAttributesTopic: topics.Attributes("sensor", "last_calibrated"),
+		UniqueId:            topics.ObjectID("last_calibrated"),
+		Icon:                "mdi:battery-sync",
+		Device:              device,
+	})
+	if err != nil {
+		return err
+	}
+	button, err := json.Marshal(haButtonConfig{
+		Name:         "Calibrate Full",
+		CommandTopic: batteryCalibratePressTopic(batteryName),
+		UniqueId:     topics.ObjectID("calibrate"),
+		Icon:         "mdi:battery-check",
+		Device:       device,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.Send(MQTTMessage{Topic: topics.DiscoveryConfig("sensor", "last_calibrated"), Payload: sensor, QoS: 2, Retain: true})
+	s.Send(MQTTMessage{Topic: topics.DiscoveryConfig("button", "calibrate"), Payload: button, QoS: 2, Retain: true})
+	return nil
+}
+
+// CreateBatterySOCEntityFromCerbo creates a battery SOC entity that reads directly
+// from a Cerbo GX MQTT topic ({"value": N} format) instead of powerctl state.
+func (s *MQTTSender) CreateBatterySOCEntityFromCerbo(
+	batteryName string,
+	capacityKWh float64,
+	manufacturer string,
+	cerboSOCTopic string,
+) error {
+	type haDeviceConfig struct {
+		Identifiers  []string `json:"identifiers"`
+		Name         string   `json:"name"`
+		Manufacturer string   `json:"manufacturer,omitempty"`
+		Model        string   `json:"model,omitempty"`
+	}
+
+	type haEntityConfig struct {
+		Name             string         `json:"name,omitempty"`
+		DeviceClass      string         `json:"device_class"`
+		StateTopic       string         `json:"state_topic"`
+		UnitOfMeasure    string         `json:"unit_of_measurement,omitempty"`
+		ValueTemplate    string         `json:"value_template"`
+		UniqueId         string         `json:"unique_id"`
+		ExpireAfter      uint           `json:"expire_after,omitempty"`
+		StateClass       string         `json:"state_class,omitempty"`
+		DisplayPrecision int            `json:"suggested_display_precision,omitempty"`
+		Device           haDeviceConfig `json:"device"`
+	}
+
+	topics := NewTopicBuilder(batteryName)
+	deviceId := topics.DeviceID()
+
+	config := haEntityConfig{
+		Name:             "State of Charge",
+		DeviceClass:      "battery",
+		StateTopic:       cerboSOCTopic,
+		UnitOfMeasure:    "%",
+		ValueTemplate:    valueTemplateJSONValue,
+		UniqueId:         deviceId + "_percentage",
+		ExpireAfter:      uint(entityExpireAfter.Seconds()),
+		StateClass:       stateClassMeasurement,
+		DisplayPrecision: 1,
+		Device: haDeviceConfig{
+			Identifiers:  []string{deviceId},
+			Name:         batteryName,
+			Manufacturer: manufacturer,
+			Model:        fmt.Sprintf("%.0f kWh", capacityKWh),
+		},
+	}
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.Send(MQTTMessage{
+		Topic:   topics.DiscoveryConfig("sensor", "percentage"),
+		Payload: payload,
+		QoS:     2,
+		Retain:  true,
+	})
+
+	return nil
+}
+
+// CreateDebugSensor creates a simple debug sensor via MQTT discovery
+func (s *MQTTSender) CreateDebugSensor(sensorID, name, unit string, precision int) error {
+	type haDeviceConfig struct {
+		Identifiers  []string `json:"identifiers"`
+		Name         string   `json:"name"`
+		Manufacturer string   `json:"manufacturer,omitempty"`
+	}
+
+	type haEntityConfig struct {
+		Name             string         `json:"name"`
+		StateTopic       string         `json:"state_topic"`
+		UnitOfMeasure    string         `json:"unit_of_measurement,omitempty"`
+		UniqueId         string         `json:"unique_id"`
+		StateClass       string         `json:"state_class,omitempty"`
+		DisplayPrecision int            `json:"suggested_display_precision,omitempty"`
+		Device           haDeviceConfig `json:"device"`
+	}
+
+	config := haEntityConfig{
+		Name:             name,
+		StateTopic:       "powerctl/sensor/" + sensorID + "/state",
+		UnitOfMeasure:    unit,
+		UniqueId:         sensorID,
+		StateClass:       stateClassMeasurement,
+		DisplayPrecision: precision,
+		Device: haDeviceConfig{
+			Identifiers:  []string{deviceIDPowerctl},
+			Name:         deviceNamePowerctl,
+			Manufacturer: "DIY",
+		},
+	}
+
+	configTopic := "homeassistant/sensor/" + sensorID + "/config"
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.Send(MQTTMessage{
+		Topic:   configTopic,
+		Payload: payload,
+		QoS:     2,
+		Retain:  true,
+	})
+
+	return nil
+}
+
+// CreateEnergyTodaySensor creates the HA energy sensor for an EnergyTodaySpec. Its state
+// resets at midnight, which the total_increasing state class records as a new cycle.
+func (s *MQTTSender) CreateEnergyTodaySensor(spec EnergyTodaySpec) error {
+	type haDeviceConfig struct {
+		Identifiers  []string `json:"identifiers"`
+		Name         string   `json:"name"`
+		Manufacturer string   `json:"manufacturer,omitempty"`
+	}
+
+	type haEntityConfig struct {
+		Name             string         `json:"name"`
+		StateTopic       string         `json:"state_topic"`
+		UnitOfMeasure    string         `json:"unit_of_measurement"`
+		UniqueId         string         `json:"unique_id"`
+		DeviceClass      string         `json:"device_class"`
+		StateClass       string         `json:"state_class"`
+		DisplayPrecision int            `json:"suggested_display_precision"`
+		Device           haDeviceConfig `json:"device"`
+	}
+
+	config := haEntityConfig{
+		Name:             spec.Name,
+		StateTopic:       spec.EnergyTodayTopic(),
+		UnitOfMeasure:    "Wh",
+		UniqueId:         spec.ID,
+		DeviceClass:      "energy",
+		StateClass:       "total_increasing",
+		DisplayPrecision: 0,
+		Device: haDeviceConfig{
+			Identifiers:  []string{deviceIDPowerctl},
+			Name:         deviceNamePowerctl,
+			Manufacturer: "DIY",
+		},
+	}
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.Send(MQTTMessage{
+		Topic:   "homeassistant/sensor/" + spec.ID + "/config",
+		Payload: payload,
+		QoS:     2,
+		Retain:  true,
+	})
+
+	return nil
+}
+
+// PublishDebugSensor publishes a value to a debug sensor.
+// Uses powerctl/ prefix to avoid conflicts with HA statestream.
+func (s *MQTTSender) PublishDebugSensor(sensorID string, value float64) {
+	s.Send(MQTTMessage{
+		Topic:    "powerctl/sensor/" + sensorID + "/state",
+		Payload:  []byte(strconv.FormatFloat(value, 'f', 1, 64)),
+		QoS:      0,
+		Retain:   false,
+		Priority: PriorityDebug,
+	})
+}
+
+// createSwitch creates a Home Assistant switch via MQTT discovery.
+// NOTE: The stateTopic must also be added to selfPublishedBoolTopics in stats.go
+// and expectedTopics in main.go, or startup will block/error on first run.
+func (s *MQTTSender) createSwitch(uniqueID, name, icon, stateTopic string) error {
+	type haDeviceConfig struct {
+		Identifiers  []string `json:"identifiers"`
+		Name         string   `json:"name"`
+		Manufacturer string   `json:"manufacturer,omitempty"`
+	}
+
+	type haSwitchConfig struct {
+		Name         string         `json:"name"`
+		StateTopic   string         `json:"state_topic"`
+		CommandTopic string         `json:"command_topic"`
+		UniqueId     string         `json:"unique_id"`
+		Icon         string         `json:"icon,omitempty"`
+		Optimistic   bool           `json:"optimistic"`
+		Device       haDeviceConfig `json:"device"`
+	}
+
+	config := haSwitchConfig{
+		Name:         name,
+		StateTopic:   stateTopic,
+		CommandTopic: "powerctl/switch/" + uniqueID + "/set",
+		UniqueId:     uniqueID,
+		Icon:         icon,
+		Optimistic:   true,
+		Device: haDeviceConfig{
+			Identifiers:  []string{deviceIDPowerctl},
+			Name:         deviceNamePowerctl,
+			Manufacturer: deviceManufacturerCustom,
+		},
+	}
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.Send(MQTTMessage{
+		Topic:   "homeassistant/switch/" + uniqueID + "/config",
+		Payload: payload,
+		QoS:     2,
+		Retain:  true,
+	})
+
+	return nil
+}
+
+// createButton creates a stateless Home Assistant button via MQTT discovery.
+// Pressing it (in the HA UI or via button.press) publishes to commandTopic;
+// powerctl routes that topic straight to the relevant worker.
+func (s *MQTTSender) createButton(uniqueID, name, icon, commandTopic string) error {
+	type haDeviceConfig struct {
+		Identifiers  []string `json:"identifiers"`
+		Name         string   `json:"name"`
+		Manufacturer string   `json:"manufacturer,omitempty"`
+	}
+
+	type haButtonConfig struct {
+		Name         string         `json:"name"`
+		CommandTopic string         `json:"command_topic"`
+		UniqueId     string         `json:"unique_id"`
+		ObjectId     string         `json:"object_id"`
+		Icon         string         `json:"icon,omitempty"`
+		Device       haDeviceConfig `json:"device"`
+	}
+
+	// object_id pins the entity_id (button.<uniqueID>) instead of letting HA
+	// derive it from the device+entity name.
+	config := haButtonConfig{
+		Name:         name,
+		CommandTopic: commandTopic,
+		UniqueId:     uniqueID,
+		ObjectId:     uniqueID,
+		Icon:         icon,
+		Device: haDeviceConfig{
+			Identifiers:  []string{deviceIDPowerctl},
+			Name:         deviceNamePowerctl,
+			Manufacturer: deviceManufacturerCustom,
+		},
+	}
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.Send(MQTTMessage{
+		Topic:   "homeassistant/button/" + uniqueID + "/config",
+		Payload: payload,
+		QoS:     2,
+		Retain:  true,
+	})
+
+	return nil
+}
+
+func (s *MQTTSender) createSelect(uniqueID, name, icon, stateTopic string, options []string) error {
+	type haDeviceConfig struct {
+		Identifiers  []string `json:"identifiers"`
+		Name         string   `json:"name"`
+		Manufacturer string   `json:"manufacturer,omitempty"`
+	}
+
+	type haSelectConfig struct {
+		Name         string         `json:"name"`
+		StateTopic   string         `json:"state_topic"`
+		CommandTopic string         `json:"command_topic"`
+		UniqueId     string         `json:"unique_id"`
+		Icon         string         `json:"icon,omitempty"`
+		Options      []string       `json:"options"`
+		Optimistic   bool           `json:"optimistic"`
+		Device       haDeviceConfig `json:"device"`
+	}
+
+	config := haSelectConfig{
+		Name:         name,
+		StateTopic:   stateTopic,
+		CommandTopic: "powerctl/select/" + uniqueID + "/set",
+		UniqueId:     uniqueID,
+		Icon:         icon,
+		Options:      options,
+		Optimistic:   true,
+		Device: haDeviceConfig{
+			Identifiers:  []string{deviceIDPowerctl},
+			Name:         deviceNamePowerctl,
+			Manufacturer: deviceManufacturerCustom,
+		},
+	}
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.Send(MQTTMessage{
+		Topic:   "homeassistant/select/" + uniqueID + "/config",
+		Payload: payload,
+		QoS:     2,
+		Retain:  true,
+	})
+
+	return nil
+}
+
+// CreatePowerctlSwitch creates the powerctl_enabled switch via MQTT discovery
+func (s *MQTTSender) CreatePowerctlSwitch() error {
+	return s.createSwitch("powerctl_enabled", "Enabled", "mdi:power", TopicPowerctlEnabledState)
+}
+
+// CreatePowerhouseInvertersSwitch creates the powerctl_inverter_enabled switch via MQTT discovery
+func (s *MQTTSender) CreatePowerhouseInvertersSwitch() error {
+	return s.createSwitch("powerctl_inverter_enabled", "Inverter Enabled", "mdi:power-plug", TopicPowerhouseInvertersEnabledState)
+}
+
+// CreatePW2DischargeModeSelect creates the powerctl_pw2_discharge_mode select via MQTT discovery.
+// Tri-state: Auto (delegate to automation), Force On (always discharge), Force Off (never discharge).
+func (s *MQTTSender) CreatePW2DischargeModeSelect() error {
+	return s.createSelect(
+		"powerctl_pw2_discharge_mode",
+		"PW2 Discharge Mode",
+		"mdi:battery-arrow-down",
+		TopicPW2DischargeMode,
+		[]string{PW2DischargeModeAuto, PW2DischargeModeForceOn, PW2DischargeModeForceOff},
+	)
+}
+
+// CreatePW2DischargeStateSensor creates the sensor showing the discharge arbiter's
+// DischargePhase (Idle / Activating / Discharging / Deactivating).
+func (s *MQTTSender) CreatePW2DischargeStateSensor() error {
+	return s.createEnumSensor(
+		dischargeStateSensorID,
+		"PW2 Discharge State",
+		"mdi:state-machine",
+		TopicPW2DischargeState,
+		dischargePhaseNames,
+	)
+}
+
+// CreateDataQualitySensor creates the sensor counting readings statsWorker rejected as
+// implausible (per-topic counts and reasons in its attributes).
+func (s *MQTTSender) CreateDataQualitySensor() error {
+	return s.createAttributeSensor(dataQualitySensorID, "Data Quality Rejections", "mdi:filter-remove-outline", "", "total_increasing")
+}
+
+// CreateDeadInvertersSensor creates the sensor counting inverters switched on but not
+// producing, with their switch entity IDs in its attributes.
+func (s *MQTTSender) CreateDeadInvertersSensor() error {
+	return s.createAttributeSensor(deadInvertersSensorID, "Dead Inverters", "mdi:power-plug-off", "", "measurement")
+}
+
+// CreateObserverSensors creates the sensors an --observe instance publishes: commands it
+// held back (state: total, attributes: the most recent) and each controller's latest
+// decision outputs.
+func (s *MQTTSender) CreateObserverSensors() error {
+	err := s.createAttributeSensor(observerCommandsSensorID, "Observer Commands", "mdi:eye-outline", "", "total_increasing")
+	if err == nil {
+		err = s.createAttributeSensor(observerDecisionsSensorID, "Observer Decisions", "mdi:eye-check-outline", "", "")
+	}
+	return err
+}
+
+// CreateThresholdProfileSensor creates the sensor showing the active ThresholdProfile.
+func (s *MQTTSender) CreateThresholdProfileSensor(names []string) error {
+	return s.createEnumSensor(
+		thresholdProfileSensorID,
+		"Threshold Profile",
+		"mdi:calendar-clock",
+		TopicThresholdProfileState,
+		names,
+	)
+}
+
+// CreateDailySummarySensor creates the sensor holding the previous day's summary. Its
+// state is the date; the markdown report is in the "report" attribute.
+func (s *MQTTSender) CreateDailySummarySensor() error {
+	return s.createAttributeSensor(dailySummarySensorID, "Daily Summary", "mdi:clipboard-text-clock", "", "")
+}
+
+// CreateCounterSensors creates the day-so-far rule minutes, mode transition and
+// inverter switch sensors.
+func (s *MQTTSender) CreateCounterSensors() error {
+	err := s.createAttributeSensor(ruleMinutesSensorID, "Rule Minutes Today", "mdi:trophy", "", "")
+	if err == nil {
+		err = s.createAttributeSensor(modeTransitionsSensorID, "Mode Transitions Today", "mdi:swap-horizontal", "", "total_increasing")
+	}
+	if err == nil {
+		err = s.createAttributeSensor(inverterSwitchesSensorID, "Inverter Switches Today", "mdi:electric-switch", "", "total_increasing")
+	}
+	return err
+}
+
+// CreateDiagnosticSensors creates the controller health sensors (see diagnosticsWorker)
+// on the Powerctl device alongside the Enabled switch, adding the build version to it.
+func (s *MQTTSender) CreateDiagnosticSensors() error {
+	sensors := []struct {
+		id, name, icon, unit, stateClass string
+	}{
+		{uptimeSensorID, "Uptime", "mdi:timer-outline", "s", stateClassMeasurement},
+		{mqttReconnectsSensorID, "MQTT Reconnects", "mdi:lan-disconnect", "", "total_increasing"},
+		{messageRateSensorID, "Messages Received", "mdi:message-arrow-left", "msg/s", stateClassMeasurement},
+		{workerRestartsSensorID, "Worker Restarts", "mdi:restart-alert", "", "total_increasing"},
+		{sendQueueDepthSensorID, "Send Queue Depth", "mdi:tray-full", "", stateClassMeasurement},
+		{sendTimeoutsSensorID, "Send Timeouts", "mdi:timer-sand-complete", "", "total_increasing"},
+		{versionSensorID, "Version", "mdi:tag-outline", "", ""},
+		{commitSensorID, "Commit", "mdi:source-commit", "", ""},
+	}
+	for _, sensor := range sensors {
+		if err := s.createDiagnosticSensor(sensor.id, sensor.name, sensor.icon, sensor.unit, sensor.stateClass); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createDiagnosticSensor creates a powerctl sensor in Home Assistant's diagnostic
+// entity category, stating powerctl/sensor/<id>/state.
+func (s *MQTTSender) createDiagnosticSensor(uniqueID, name, icon, unit, stateClass string) error {
+	type haDeviceConfig struct {
+		Identifiers  []string `json:"identifiers"`
+		Name         string   `json:"name"`
+		Manufacturer string   `json:"manufacturer,omitempty"`
+		SWVersion    string   `json:"sw_version,omitempty"`
+	}
+
+	type haSensorConfig struct {
+		Name           string         `json:"name"`
+		StateTopic     string         `json:"state_topic"`
+		UniqueId       string         `json:"unique_id"`
+		Icon           string         `json:"icon,omitempty"`
+		UnitOfMeasure  string         `json:"unit_of_measurement,omitempty"`
+		StateClass     string         `json:"state_class,omitempty"`
+		EntityCategory string         `json:"entity_category"`
+		Device         haDeviceConfig `json:"device"`
+	}
+
+	config := haSensorConfig{
+		Name:           name,
+		StateTopic:     "powerctl/sensor/" + uniqueID + "/state",
+		UniqueId:       uniqueID,
+		Icon:           icon,
+		UnitOfMeasure:  unit,
+		StateClass:     stateClass,
+		EntityCategory: "diagnostic",
+		Device: haDeviceConfig{
+			Identifiers:  []string{deviceIDPowerctl},
+			Name:         deviceNamePowerctl,
+			Manufacturer: deviceManufacturerCustom,
+			SWVersion:    version,
+		},
+	}
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.Send(MQTTMessage{
+		Topic:   "homeassistant/sensor/" + uniqueID + "/config",
+		Payload: payload,
+		QoS:     2,
+		Retain:  true,
+	})
+
+	return nil
+}
+
+// createAttributeSensor creates a powerctl sensor with a JSON attributes topic
+// alongside its state topic (powerctl/sensor/<id>/state and /attributes).
+func (s *MQTTSender) createAttributeSensor(uniqueID, name, icon, unit, stateClass string) error {
+	type haDeviceConfig struct {
+		Identifiers  []string `json:"identifiers"`
+		Name         string   `json:"name"`
+		Manufacturer string   `json:"manufacturer,omitempty"`
+	}
+
+	type haSensorConfig struct {
+		Name                string         `json:"name"`
+		StateTopic          string         `json:"state_topic"`
+		JsonAttributesTopic string         `json:"json_attributes_topic"`
+		UniqueId            string         `json:"unique_id"`
+		Icon                string         `json:"icon,omitempty"`
+		UnitOfMeasure       string         `json:"unit_of_measurement,omitempty"`
+		StateClass          string         `json:"state_class,omitempty"`
+		Device              haDeviceConfig `json:"device"`
+	}
+
+	config := haSensorConfig{
+		Name:                name,
+		StateTopic:          "powerctl/sensor/" + uniqueID + "/state",
+		JsonAttributesTopic: "powerctl/sensor/" + uniqueID + "/attributes",
+		UniqueId:            uniqueID,
+		Icon:                icon,
+		UnitOfMeasure:       unit,
+		StateClass:          stateClass,
+		Device: haDeviceConfig{
+			Identifiers:  []string{deviceIDPowerctl},
+			Name:         deviceNamePowerctl,
+			Manufacturer: deviceManufacturerCustom,
+		},
+	}
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.Send(MQTTMessage{
+		Topic:   "homeassistant/sensor/" + uniqueID + "/config",
+		Payload: payload,
+		QoS:     2,
+		Retain:  true,
+	})
+
+	return nil
+}
+
+// createEnumSensor creates a Home Assistant sensor whose state is one of options.
+func (s *MQTTSender) createEnumSensor(uniqueID, name, icon, stateTopic string, options []string) error {
+	type haDeviceConfig struct {
+		Identifiers  []string `json:"identifiers"`
+		Name         string   `json:"name"`
+		Manufacturer string   `json:"manufacturer,omitempty"`
+	}
+
+	type haSensorConfig struct {
+		Name        string         `json:"name"`
+		StateTopic  string         `json:"state_topic"`
+		UniqueId    string         `json:"unique_id"`
+		Icon        string         `json:"icon,omitempty"`
+		DeviceClass string         `json:"device_class"`
+		Options     []string       `json:"options"`
+		Device      haDeviceConfig `json:"device"`
+	}
+
+	config := haSensorConfig{
+		Name:        name,
+		StateTopic:  stateTopic,
+		UniqueId:    uniqueID,
+		Icon:        icon,
+		DeviceClass: "enum",
+		Options:     options,
+		Device: haDeviceConfig{
+			Identifiers:  []string{deviceIDPowerctl},
+			Name:         deviceNamePowerctl,
+			Manufacturer: deviceManufacturerCustom,
+		},
+	}
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.Send(MQTTMessage{
+		Topic:   "homeassistant/sensor/" + uniqueID + "/config",
+		Payload: payload,
+		QoS:     2,
+		Retain:  true,
+	})
+
+	return nil
+}
+
+// DeleteOldEntities removes obsolete HA entities by publishing empty retained discovery
+// configs. Add an entry here whenever an entity is renamed or retired so old installs
+// don't keep a ghost copy. Safe to call repeatedly.
+func (s *MQTTSender) DeleteOldEntities() {
+	obsolete := []string{
+		"homeassistant/switch/powerctl_pw2_discharge/config", // superseded by powerctl_pw2_discharge_mode select
+	}
+	for _, topic := range obsolete {
+		s.Send(MQTTMessage{
+			Topic:   topic,
+			Payload: []byte{},
+			QoS:     2,
+			Retain:  true,
+		})
+	}
+}
+
+// CreateExpectingPowerCutsSwitch creates the expecting power cuts switch via MQTT discovery
+func (s *MQTTSender) CreateExpectingPowerCutsSwitch() error {
+	return s.createSwitch("powerctl_expecting_power_cuts", "Expecting Power Cuts", "mdi:transmission-tower-off", TopicExpectingPowerCutsState)
+}
+
+// CreateTOUDischargeSwitch creates the powerctl_tou_discharge switch via MQTT discovery.
+// When on, the TOU scheduler votes for PW2 discharge during peak windows.
+func (s *MQTTSender) CreateTOUDischargeSwitch() error {
+	return s.createSwitch("powerctl_tou_discharge", "TOU Discharge", "mdi:clock-time-five", TopicTOUDischargeState)
+}
+
+// CreateGridChargeSwitch creates the powerctl_grid_charge switch via MQTT discovery.
+// When on, the grid charge scheduler charges the Powerwall overnight while power is cheap.
+func (s *MQTTSender) CreateGridChargeSwitch() error {
+	return s.createSwitch("powerctl_grid_charge", "Grid Charge", "mdi:transmission-tower-import", TopicGridChargeState)
+}
+
+// CreateDynamicAutoSwitch creates the powerctl_dynamic_auto switch via MQTT discovery.
+// When on, the dynamic controller calculates the setpoint automatically.
+// When off, the user controls the setpoint via the HA number entity.
+func (s *MQTTSender) CreateDynamicAutoSwitch() error {
+	return s.createSwitch("powerctl_dynamic_auto", "Dynamic Auto", "mdi:robot", TopicDynamicAutoState)
+}
+
+// CreateCarChargingSwitch creates the powerctl_car_charging switch via MQTT discovery.
+// When on, the dynamic controller pushes Multiplus discharge to its safe maximum to supply
+// the car charger from Battery 3 / solar instead of grid.
+func (s *MQTTSender) CreateCarChargingSwitch() error {
+	return s.createSwitch("powerctl_car_charging", "Car Charging", "mdi:car-electric", TopicCarChargingEnabledState)
+}
+
+// CreateCarChargingBattery3CutoffEntity creates the Battery 3 SOC cutoff number entity
+// for the car-charging feature. Below this SOC, car charging is suppressed and auto-disabled.
+func (s *MQTTSender) CreateCarChargingBattery3CutoffEntity() error {
+	type haDeviceConfig struct {
+		Identifiers  []string `json:"identifiers"`
+		Name         string   `json:"name"`
+		Manufacturer string   `json:"manufacturer,omitempty"`
+	}
+
+	type haNumberConfig struct {
+		Name          string         `json:"name"`
+		UniqueId      string         `json:"unique_id"`
+		CommandTopic  string         `json:"command_topic"`
+		StateTopic    string         `json:"state_topic"`
+		UnitOfMeasure string         `json:"unit_of_measurement"`
+		Min           float64        `json:"min"`
+		Max           float64        `json:"max"`
+		Step          float64        `json:"step"`
+		Mode          string         `json:"mode"`
+		Icon          string         `json:"icon,omitempty"`
+		Optimistic    bool           `json:"optimistic"`
+		Device        haDeviceConfig `json:"device"`
+	}
+
+	config := haNumberConfig{
+		Name:          "Car Charging B3 Cutoff",
+		UniqueId:      "powerctl_car_charging_battery3_cutoff",
+		CommandTopic:  TopicCarChargingBattery3CutoffCmd,
+		StateTopic:    TopicCarChargingBattery3CutoffState,
+		UnitOfMeasure: "%",
+		Min:           0,
+		Max:           100,
+		Step:          1,
+		Mode:          "slider",
+		Icon:          "mdi:battery-alert",
+		Optimistic:    true,
+		Device: haDeviceConfig{
+			Identifiers:  []string{deviceIDPowerctl},
+			Name:         deviceNamePowerctl,
+			Manufacturer: deviceManufacturerCustom,
+		},
+	}
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.Send(MQTTMessage{
+		Topic:   "homeassistant/number/powerctl_car_charging_battery3_cutoff/config",
+		Payload: payload,
+		QoS:     2,
+		Retain:  true,
+	})
+
+	return nil
+}
+
+// CreateInverterModeEntities creates the inverter mode select (auto/manual/self_consumption)
+// and the manual inverter count number entity used while the mode is manual.
+func (s *MQTTSender) CreateInverterModeEntities(maxCount int) error {
+	err := s.createSelect(
+		"powerctl_inverter_mode",
+		"Inverter Mode",
+		"mdi:hand-back-right",
+		TopicInverterModeState,
+		[]string{InverterModeAuto, InverterModeManual, InverterModeSelfConsumption},
+	)
+	if err != nil {
+		return err
+	}
+
+	type haDeviceConfig struct {
+		Identifiers  []string `json:"identifiers"`
+		Name         string   `json:"name"`
+		Manufacturer string   `json:"manufacturer,omitempty"`
+	}
+
+	type haNumberConfig struct {
+		Name         string         `json:"name"`
+		UniqueId     string         `json:"unique_id"`
+		CommandTopic string         `json:"command_topic"`
+		StateTopic   string         `json:"state_topic"`
+		Min          float64        `json:"min"`
+		Max          float64        `json:"max"`
+		Step         float64        `json:"step"`
+		Mode         string         `json:"mode"`
+		Icon         string         `json:"icon,omitempty"`
+		Optimistic   bool           `json:"optimistic"`
+		Device       haDeviceConfig `json:"device"`
+	}
+
+	config := haNumberConfig{
+		Name:         "Manual Inverter Count",
+		UniqueId:     "powerctl_manual_inverter_count",
+		CommandTopic: TopicManualInverterCountCmd,
+		StateTopic:   TopicManualInverterCountState,
+		Min:          0,
+		Max:          float64(maxCount),
+		Step:         1,
+		Mode:         "box",
+		Icon:         "mdi:counter",
+		Optimistic:   true,
+		Device: haDeviceConfig{
+			Identifiers:  []string{deviceIDPowerctl},
+			Name:         deviceNamePowerctl,
+			Manufacturer: deviceManufacturerCustom,
+		},
+	}
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.Send(MQTTMessage{
+		Topic:   "homeassistant/number/powerctl_manual_inverter_count/config",
+		Payload: payload,
+		QoS:     2,
+		Retain:  true,
+	})
+
+	return nil
+}
+
+// CreateInverter10ACSetpointEntity creates the Multiplus II AC setpoint number entity via MQTT discovery
+func (s *MQTTSender) CreateInverter10ACSetpointEntity() error {
+	type haDeviceConfig struct {
+		Identifiers []string `json:"identifiers"`
+		Name        string   `json:"name"`
+		Model       string   `json:"model,omitempty"`
+	}
+
+	type haNumberConfig struct {
+		Name          string         `json:"name"`
+		UniqueId      string         `json:"unique_id"`
+		StateTopic    string         `json:"state_topic"`
+		ValueTemplate string         `json:"value_template"`
+		CommandTopic  string         `json:"command_topic"`
+		UnitOfMeasure string         `json:"unit_of_measurement"`
+		Min           float64        `json:"min"`
+		Max           float64        `json:"max"`
+		Step          float64        `json:"step"`
+		Mode          string         `json:"mode"`
+		Device        haDeviceConfig `json:"device"`
+	}
+
+	config := haNumberConfig{
+		Name:          "AC Setpoint",
+		UniqueId:      "powerhouse_inverter_10_ac_setpoint",
+		StateTopic:    TopicMultiplusSetpointRead,
+		ValueTemplate: valueTemplateJSONValue,
+		CommandTopic:  TopicInverter10SetpointCmd,
+		UnitOfMeasure: "W",
+		Min:           -3000,
+		Max:           3500,
+		Step:          10,
+		Mode:          "slider",
+		Device: haDeviceConfig{
+			Identifiers: []string{deviceIDInverter10},
+			Name:        deviceNameInverter10,
+			Model:       deviceModelMultiplus2,
+		},
+	}
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.Send(MQTTMessage{
+		Topic:   "homeassistant/number/powerhouse_inverter_10_ac_setpoint/config",
+		Payload: payload,
+		QoS:     2,
+		Retain:  true,
+	})
+
+	return nil
+}
+
+// CreateMultiplusACPowerEntity creates the Multiplus II AC output power sensor entity via MQTT discovery
+func (s *MQTTSender) CreateMultiplusACPowerEntity() error {
+	type haDeviceConfig struct {
+		Identifiers []string `json:"identifiers"`
+		Name        string   `json:"name"`
+		Model       string   `json:"model,omitempty"`
+	}
+
+	type haSensorConfig struct {
+		Name          string         `json:"name"`
+		UniqueId      string         `json:"unique_id"`
+		StateTopic    string         `json:"state_topic"`
+		ValueTemplate string         `json:"value_template"`
+		UnitOfMeasure string         `json:"unit_of_measurement"`
+		DeviceClass   string         `json:"device_class"`
+		StateClass    string         `json:"state_class"`
+		Device        haDeviceConfig `json:"device"`
+	}
+
+	config := haSensorConfig{
+		Name:          "AC Power",
+		UniqueId:      "powerhouse_inverter_10_ac_power",
+		StateTopic:    TopicMultiplusACPower,
+		ValueTemplate: valueTemplateJSONValue,
+		UnitOfMeasure: "W",
+		DeviceClass:   "power",
+		StateClass:    stateClassMeasurement,
+		Device: haDeviceConfig{
+			Identifiers: []string{deviceIDInverter10},
+			Name:        deviceNameInverter10,
+			Model:       deviceModelMultiplus2,
+		},
+	}
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.Send(MQTTMessage{
+		Topic:   "homeassistant/sensor/powerhouse_inverter_10_ac_power/config",
+		Payload: payload,
+		QoS:     2,
+		Retain:  true,
+	})
+
+	return nil
+}
+
+// CreateMultiplusDCCurrentEntity creates the Multiplus II DC current sensor entity via MQTT discovery.
+// Reads the inverter's own DC (battery-side) current from the Cerbo vebus topic — the Multiplus's
+// contribution to battery current, distinct from battery_3_dc_current (system total).
+func (s *MQTTSender) CreateMultiplusDCCurrentEntity() error {
+	type haDeviceConfig struct {
+		Identifiers []string `json:"identifiers"`
+		Name        string   `json:"name"`
+		Model       string   `json:"model,omitempty"`
+	}
+
+	type haSensorConfig struct {
+		Name          string         `json:"name"`
+		UniqueId      string         `json:"unique_id"`
+		StateTopic    string         `json:"state_topic"`
+		ValueTemplate string         `json:"value_template"`
+		UnitOfMeasure string         `json:"unit_of_measurement"`
+		DeviceClass   string         `json:"device_class"`
+		StateClass    string         `json:"state_class"`
+		Device        haDeviceConfig `json:"device"`
+	}
+
+	config := haSensorConfig{
+		Name:          "DC Current",
+		UniqueId:      "powerhouse_inverter_10_dc_current",
+		StateTopic:    TopicMultiplusDCCurrent,
+		ValueTemplate: valueTemplateJSONValue,
+		UnitOfMeasure: "A",
+		DeviceClass:   deviceClassCurrent,
+		StateClass:    stateClassMeasurement,
+		Device: haDeviceConfig{
+			Identifiers: []string{deviceIDInverter10},
+			Name:        deviceNameInverter10,
+			Model:       deviceModelMultiplus2,
+		},
+	}
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.Send(MQTTMessage{
+		Topic:   "homeassistant/sensor/powerhouse_inverter_10_dc_current/config",
+		Payload: payload,
+		QoS:     2,
+		Retain:  true,
+	})
+
+	return nil
+}
+
+// CreateBattery3DCPowerEntity creates a Battery 3 DC power sensor that reads from the Cerbo
+// system battery power topic via MQTT discovery.
+func (s *MQTTSender) CreateBattery3DCPowerEntity() error {
+	type haDeviceConfig struct {
+		Identifiers []string `json:"identifiers"`
+		Name        string   `json:"name"`
+	}
+
+	type haSensorConfig struct {
+		Name          string         `json:"name"`
+		UniqueId      string         `json:"unique_id"`
+		StateTopic    string         `json:"state_topic"`
+		ValueTemplate string         `json:"value_template"`
+		UnitOfMeasure string         `json:"unit_of_measurement"`
+		DeviceClass   string         `json:"device_class"`
+		StateClass    string         `json:"state_class"`
+		Device        haDeviceConfig `json:"device"`
+	}
+
+	config := haSensorConfig{
+		Name:          "DC Power",
+		UniqueId:      "battery_3_dc_power",
+		StateTopic:    TopicCerboBatteryDCPower,
+		ValueTemplate: valueTemplateJSONValue,
+		UnitOfMeasure: "W",
+		DeviceClass:   "power",
+		StateClass:    stateClassMeasurement,
+		Device: haDeviceConfig{
+			Identifiers: []string{deviceIDBattery3},
+			Name:        deviceNameBattery3,
+		},
+	}
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.Send(MQTTMessage{
+		Topic:   "homeassistant/sensor/battery_3_dc_power/config",
+		Payload: payload,
+		QoS:     2,
+		Retain:  true,
+	})
+
+	return nil
+}
+
+// CreateBattery3CurrentEntity creates a Battery 3 DC current sensor (positive = discharging)
+// that reads from the Cerbo system battery current topic via MQTT discovery.
+func (s *MQTTSender) CreateBattery3CurrentEntity() error {
+	type haDeviceConfig struct {
+		Identifiers []string `json:"identifiers"`
+		Name        string   `json:"name"`
+	}
+	type haSensorConfig struct {
+		Name          string         `json:"name"`
+		UniqueId      string         `json:"unique_id"`
+		StateTopic    string         `json:"state_topic"`
+		ValueTemplate string         `json:"value_template"`
+		UnitOfMeasure string         `json:"unit_of_measurement"`
+		DeviceClass   string         `json:"device_class"`
+		StateClass    string         `json:"state_class"`
+		Device        haDeviceConfig `json:"device"`
+	}
+
+	config := haSensorConfig{
+		Name:          "DC Current",
+		UniqueId:      "battery_3_dc_current",
+		StateTopic:    TopicCerboBatteryCurrent,
+		ValueTemplate: valueTemplateJSONValue,
+		UnitOfMeasure: "A",
+		DeviceClass:   deviceClassCurrent,
+		StateClass:    stateClassMeasurement,
+		Device: haDeviceConfig{
+			Identifiers: []string{deviceIDBattery3},
+			Name:        deviceNameBattery3,
+		},
+	}
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.Send(MQTTMessage{
+		Topic:   "homeassistant/sensor/battery_3_dc_current/config",
+		Payload: payload,
+		QoS:     2,
+		Retain:  true,
+	})
+
+	return nil
+}
+
+// CreateBattery3CCLEntity creates a Battery 3 charge current limit sensor
+// that reads from the Cerbo BMS MaxChargeCurrent topic via MQTT discovery.
+func (s *MQTTSender) CreateBattery3CCLEntity() error {
+	type haDeviceConfig struct {
+		Identifiers []string `json:"identifiers"`
+		Name        string   `json:"name"`
+	}
+	type haSensorConfig struct {
+		Name          string         `json:"name"`
+		UniqueId      string         `json:"unique_id"`
+		StateTopic    string         `json:"state_topic"`
+		ValueTemplate string         `json:"value_template"`
+		UnitOfMeasure string         `json:"unit_of_measurement"`
+		DeviceClass   string         `json:"device_class"`
+		StateClass    string         `json:"state_class"`
+		Device        haDeviceConfig `json:"device"`
+	}
+
+	config := haSensorConfig{
+		Name:          "Charge Current Limit",
+		UniqueId:      "battery_3_ccl",
+		StateTopic:    TopicCerboBatteryCCL,
+		ValueTemplate: valueTemplateJSONValue,
+		UnitOfMeasure: "A",
+		DeviceClass:   deviceClassCurrent,
+		StateClass:    stateClassMeasurement,
+		Device: haDeviceConfig{
+			Identifiers: []string{deviceIDBattery3},
+			Name:        deviceNameBattery3,
+		},
+	}
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.Send(MQTTMessage{
+		Topic:   "homeassistant/sensor/battery_3_ccl/config",
+		Payload: payload,
+		QoS:     2,
+		Retain:  true,
+	})
+
+	return nil
+}
+
+// CreateBattery3CVLEntity creates a Battery 3 charge voltage limit sensor
+// that reads from the Cerbo BMS MaxChargeVoltage topic via MQTT discovery.
+func (s *MQTTSender) CreateBattery3CVLEntity() error {
+	type haDeviceConfig struct {
+		Identifiers []string `json:"identifiers"`
+		Name        string   `json:"name"`
+	}
+	type haSensorConfig struct {
+		Name          string         `json:"name"`
+		UniqueId      string         `json:"unique_id"`
+		StateTopic    string         `json:"state_topic"`
+		ValueTemplate string         `json:"value_template"`
+		UnitOfMeasure string         `json:"unit_of_measurement"`
+		DeviceClass   string         `json:"device_class"`
+		StateClass    string         `json:"state_class"`
+		Device        haDeviceConfig `json:"device"`
+	}
+
+	config := haSensorConfig{
+		Name:          "Charge Voltage Limit",
+		UniqueId:      "battery_3_cvl",
+		StateTopic:    TopicCerboBatteryCVL,
+		ValueTemplate: valueTemplateJSONValue,
+		UnitOfMeasure: "V",
+		DeviceClass:   "voltage",
+		StateClass:    stateClassMeasurement,
+		Device: haDeviceConfig{
+			Identifiers: []string{deviceIDBattery3},
+			Name:        deviceNameBattery3,
+		},
+	}
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.Send(MQTTMessage{
+		Topic:   "homeassistant/sensor/battery_3_cvl/config",
+		Payload: payload,
+		QoS:     2,
+		Retain:  true,
+	})
+
+	return nil
+}
+
+// CreateSolarMpptModeEntity creates an MPPT operating mode sensor for a solar charger,
+// reading from the Cerbo solarcharger topic via MQTT discovery.
+func (s *MQTTSender) CreateSolarMpptModeEntity(
+	solarName string,
+	cerboTopic string,
+) error {
+	type haDeviceConfig struct {
+		Identifiers []string `json:"identifiers"`
+		Name        string   `json:"name"`
+	}
+
+	type haSensorConfig struct {
+		Name          string         `json:"name"`
+		UniqueId      string         `json:"unique_id"`
+		StateTopic    string         `json:"state_topic"`
+		ValueTemplate string         `json:"value_template"`
+		StateClass    string         `json:"state_class"`
+		Device        haDeviceConfig `json:"device"`
+	}
+
+	entityId := NewTopicBuilder(solarName).ObjectID("mppt_mode")
+
+	config := haSensorConfig{
+		Name:          "MPPT Mode",
+		UniqueId:      entityId,
+		StateTopic:    cerboTopic,
+		ValueTemplate: valueTemplateJSONValue,
+		StateClass:    stateClassMeasurement,
+		Device: haDeviceConfig{
+			Identifiers: []string{solarName},
+			Name:        solarName,
+		},
+	}
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.Send(MQTTMessage{
+		Topic:   "homeassistant/sensor/" + entityId + "/config",
+		Payload: payload,
+		QoS:     2,
+		Retain:  true,
+	})
+
+	return nil
+}
+
+// createPercentSensor creates a percentage sensor on the Water Tanks device via MQTT discovery.
+// The sensor expires to unavailable if powerctl stops publishing (e.g. tank sensor offline).
+func (s *MQTTSender) createPercentSensor(uniqueID, name, stateTopic, jsonKey string) error {
+	type haDeviceConfig struct {
+		Identifiers  []string `json:"identifiers"`
+		Name         string   `json:"name"`
+		Manufacturer string   `json:"manufacturer,omitempty"`
+	}
+
+	type haSensorConfig struct {
+		Name             string         `json:"name"`
+		StateTopic       string         `json:"state_topic"`
+		UnitOfMeasure    string         `json:"unit_of_measurement"`
+		ValueTemplate    string         `json:"value_template"`
+		UniqueId         string         `json:"unique_id"`
+		ExpireAfter      uint           `json:"expire_after,omitempty"`
+		StateClass       string         `json:"state_class,omitempty"`
+		DisplayPrecision int            `json:"suggested_display_precision,omitempty"`
+		Device           haDeviceConfig `json:"device"`
+	}
+
+	config := haSensorConfig{
+		Name:             name,
+		StateTopic:       stateTopic,
+		UnitOfMeasure:    "%",
+		ValueTemplate:    "{{ value_json." + jsonKey + " }}",
+		UniqueId:         uniqueID,
+		ExpireAfter:      uint(entityExpireAfter.Seconds()),
+		StateClass:       stateClassMeasurement,
+		DisplayPrecision: 1,
+		Device: haDeviceConfig{
+			Identifiers:  []string{deviceIDWaterTanks},
+			Name:         deviceNameWaterTanks,
+			Manufacturer: deviceManufacturerCustom,
+		},
+	}
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.Send(MQTTMessage{
+		Topic:   "homeassistant/sensor/" + uniqueID + "/config",
+		Payload: payload,
+		QoS:     2,
+		Retain:  true,
+	})
+
+	return nil
+}
+
+// CreateWaterTankEntities creates the five tank fill sensors published by tankLevelsWorker.
+func (s *MQTTSender) CreateWaterTankEntities() error {
+	sensors := []struct {
+		uniqueID, name, stateTopic, jsonKey string
+	}{
+		{"header_tank_percent_full", "Header Tank Percent Full", TopicHeaderTankLevelsState, "percent_full"},
+		{"storage_tank_percent_full", "Storage Tank Percent Full", TopicStorageTankLevelsState, "percent_full"},
+		{"storage_tank_1_percent_full", "Storage Tank 1 Percent Full", TopicStorageTankLevelsState, "tank_1_percent_full"},
+		{"storage_tank_2_percent_full", "Storage Tank 2 Percent Full", TopicStorageTankLevelsState, "tank_2_percent_full"},
+		{"storage_tank_3_percent_full", "Storage Tank 3 Percent Full", TopicStorageTankLevelsState, "tank_3_percent_full"},
+	}
+	for _, sensor := range sensors {
+		if err := s.createPercentSensor(sensor.uniqueID, sensor.name, sensor.stateTopic, sensor.jsonKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createBinarySensor creates a Home Assistant binary sensor via MQTT discovery.
+// Read-only counterpart of createSwitch (no command topic).
+func (s *MQTTSender) createBinarySensor(uniqueID, name, icon, stateTopic string) error {
+	type haDeviceConfig struct {
+		Identifiers  []string `json:"identifiers"`
+		Name         string   `json:"name"`
+		Manufacturer string   `json:"manufacturer,omitempty"`
+	}
+
+	type haBinarySensorConfig struct {
+		Name       string         `json:"name"`
+		StateTopic string         `json:"state_topic"`
+		UniqueId   string         `json:"unique_id"`
+		Icon       string         `json:"icon,omitempty"`
+		Device     haDeviceConfig `json:"device"`
+	}
+
+	config := haBinarySensorConfig{
+		Name:       name,
+		StateTopic: stateTopic,
+		UniqueId:   uniqueID,
+		Icon:       icon,
+		Device: haDeviceConfig{
+			Identifiers:  []string{deviceIDPowerctl},
+			Name:         deviceNamePowerctl,
+			Manufacturer: deviceManufacturerCustom,
+		},
+	}
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.Send(MQTTMessage{
+		Topic:   "homeassistant/binary_sensor/" + uniqueID + "/config",
+		Payload: payload,
+		QoS:     2,
+		Retain:  true,
+	})
+
+	return nil
+}
+
+// CreateTankFlushModeBinarySensor creates the tank flush mode binary sensor via MQTT discovery.
+// On during the first fortnight of every third month (see IsFlushMode).
+func (s *MQTTSender) CreateTankFlushModeBinarySensor() error {
+	return s.createBinarySensor("powerctl_tank_flush_mode", "Tank Flush Mode", "mdi:water-sync", TopicTankFlushModeState)
+}
+
+// CreateIslandModeBinarySensor creates the powerctl_island_mode binary sensor via MQTT discovery.
+// On while the grid is out (see islandModeWorker).
+func (s *MQTTSender) CreateIslandModeBinarySensor() error {
+	return s.createBinarySensor("powerctl_island_mode", "Island Mode", "mdi:island", TopicIslandModeState)
+}
+
+// CreateStormModeBinarySensor creates the storm mode binary sensor (on while a severe
+// weather warning is in force or recently cleared).
+func (s *MQTTSender) CreateStormModeBinarySensor() error {
+	return s.createBinarySensor("powerctl_storm_mode", "Storm Mode", "mdi:weather-lightning-rainy", TopicStormModeState)
+}
+
+// CreateCurtailmentBinarySensor creates the curtailment binary sensor (on while export
+// is curtailed by a negative price or DNSP signal, or recently was).
+func (s *MQTTSender) CreateCurtailmentBinarySensor() error {
+	return s.createBinarySensor("powerctl_curtailment", "Curtailment", "mdi:transmission-tower-off", TopicCurtailmentState)
+}
+
+// CreateCommandFailedBinarySensor creates the binary sensor raised when a service call
+// never reaches its expected state.
+func (s *MQTTSender) CreateCommandFailedBinarySensor() error {
+	return s.createBinarySensor("powerctl_command_failed", "Command Failed", "mdi:alert-circle", TopicCommandFailedState)
+}
+
+// CreateOverTemperatureBinarySensor creates a battery's over-temperature binary sensor
+// (see temperatureDeratingWorker), for HA alerting.
+func (s *MQTTSender) CreateOverTemperatureBinarySensor(batteryName string) error {
+	return s.createBinarySensor(NewTopicBuilder(batteryName).ObjectID("over_temperature"), batteryName+" Over Temperature",
+		"mdi:thermometer-alert", temperatureAlertTopic(batteryName))
+}
+
+// CreateCellUndervoltageBinarySensor creates a battery's cell undervoltage binary sensor
+// (see bmsWorker), on while discharge is suspended.
+func (s *MQTTSender) CreateCellUndervoltageBinarySensor(batteryName string) error {
+	return s.createBinarySensor(NewTopicBuilder(batteryName).ObjectID("cell_undervoltage"), batteryName+" Cell Undervoltage",
+		"mdi:battery-alert-variant-outline", bmsCellUndervoltageTopic(batteryName))
+}
+
+// CreateWorkerStuckBinarySensor creates the binary sensor raised by the watchdog.
+func (s *MQTTSender) CreateWorkerStuckBinarySensor() error {
+	return s.createBinarySensor("powerctl_worker_stuck", "Worker Stuck", "mdi:timer-alert", TopicWorkerStuckState)
+}
+
+// CreateUpdateCheckEntities creates the update available binary sensor and the latest
+// release diagnostic sensor published by updateCheckWorker.
+func (s *MQTTSender) CreateUpdateCheckEntities() error {
+	err := s.createBinarySensor("powerctl_update_available", "Update Available", "mdi:package-up", TopicUpdateAvailableState)
+	if err == nil {
+		err = s.createDiagnosticSensor(latestVersionSensorID, "Latest Version", "mdi:tag-arrow-up-outline", "", "")
+	}
+	return err
+}
+
+// CreateWorkerPanicEvent creates the event entity fired for each worker panic, with the
+// worker, panic and crash dump file in its attributes.
+func (s *MQTTSender) CreateWorkerPanicEvent() error {
+	type haDeviceConfig struct {
+		Identifiers  []string `json:"identifiers"`
+		Name         string   `json:"name"`
+		Manufacturer string   `json:"manufacturer,omitempty"`
+	}
+
+	type haEventConfig struct {
+		Name       string         `json:"name"`
+		StateTopic string         `json:"state_topic"`
+		EventTypes []string       `json:"event_types"`
+		UniqueId   string         `json:"unique_id"`
+		Icon       string         `json:"icon,omitempty"`
+		Device     haDeviceConfig `json:"device"`
+	}
+
+	config := haEventConfig{
+		Name:       "Worker Panic",
+		StateTopic: TopicWorkerPanicEvent,
+		EventTypes: []string{"worker_panic"},
+		UniqueId:   "powerctl_worker_panic",
+		Icon:       "mdi:alert-octagram",
+		Device: haDeviceConfig{
+			Identifiers:  []string{deviceIDPowerctl},
+			Name:         deviceNamePowerctl,
+			Manufacturer: deviceManufacturerCustom,
+		},
+	}
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	s.Send(MQTTMessage{
+		Topic:   "homeassistant/event/powerctl_worker_panic/config",
+		Payload: payload,
+		QoS:     2,
+		Retain:  true,
+	})
+
+	return nil
+}
+
+// isDiscoveryTopic checks if a topic is an MQTT discovery config topic
+func isDiscoveryTopic(topic string) bool {
+	return strings.HasSuffix(topic, "/config")
+}
+
+// TopicPowerctlEnabledState is the state topic for the powerctl_enabled switch.
+// Statestream publishes here, powerctl reads to check enabled state.
+const TopicPowerctlEnabledState = "homeassistant/switch/powerctl_enabled/state"
+
+// TopicPowerhouseInvertersEnabledState is the state topic for the powerctl_inverter_enabled switch.
+// Controls whether unifiedInverterEnabler messages are forwarded.
+const TopicPowerhouseInvertersEnabledState = "homeassistant/switch/powerctl_inverter_enabled/state"
+
+// MQTTSenderConfig configures mqttSenderWorker filtering, rate limiting and queuing.
+type MQTTSenderConfig struct {
+	ForceEnable         bool             // Bypass the powerctl_enabled switch
+	MultiplusOnly       bool             // Drop everything outside powerhouse_3/ (except discovery)
+	ServiceCallInterval time.Duration    // Coalesce calls to the same entity closer than this (0 disables)
+	QueueSize           int              // Max messages held while disconnected or the window is full
+	MaxInFlight         int              // Max publishes awaiting broker acknowledgement
+	Heartbeats          *Heartbeats      // Optional; beaten on every loop iteration
+	Interlock           *SafetyInterlock // Optional; vetoes unsafe commands before dispatch
+	Modbus              *modbusRoute     // Optional; service calls for Modbus-backed inverters go here
+	Shelly              *shellyRoute     // Optional; service calls for Shelly-backed inverters go here first
+	Failsafe            *BrokerFailsafe  // Optional; turns inverters off after an extended broker outage
+	TopicQoS            TopicQoSConfig   // Per-topic QoS and retain overrides, applied as messages are published
+	Keepalive           *Keepalive       // Optional; republishes quiet states before HA expires them
+	Leader              *LeaderElection  // Optional; while standby only election traffic is published
+	Observer            *Observer        // Optional; read-only mode, only the observer sensors are published
+	Resync              *HAResync        // Optional; holds actuation while Home Assistant restarts
+	Diagnostics         *Diagnostics     // Optional; given the queue depth on every loop iteration
+}
+
+// publishTimeout bounds how long a publish may hold an in-flight slot.
+const publishTimeout = 30 * time.Second
+
+// publishResult reports a completed asynchronous publish.
+type publishResult struct {
+	topic string
+	done  chan struct{} // Closed when the publish completes; see startPublish
+	err   error
+}
+
+// mqttSenderWorker handles outgoing MQTT messages with queuing and filtering.
+// A non-nil serviceRoute sends service calls to haServiceWorker instead of the proxy topic.
+// Service calls with an expectation are passed on to trackChan (nil disables tracking).
+func mqttSenderWorker(
+	ctx context.Context,
+	outgoingChan <-chan MQTTMessage,
+	clientChan <-chan MQTTConnection,
+	dataChan <-chan DisplayData,
+	config MQTTSenderConfig,
+	serviceRoute *haServiceRoute,
+	trackChan chan<- MQTTMessage,
+) {
+	log.Println("MQTT sender worker started")
+
+	var client MQTTConnection
+	queue := NewSendQueue(config.QueueSize)
+	enabled := true // Default to enabled
+	lastSent := make(map[string]lastSentInfo)
+
+	// Nil channels (never ready) when service calls always use the proxy
+	var fallbackChan, shellyFallbackChan <-chan MQTTMessage
+	if serviceRoute != nil {
+		fallbackChan = serviceRoute.fallback
+	}
+	if config.Shelly != nil {
+		shellyFallbackChan = config.Shelly.fallback
+	}
+
+	// QoS 1 and 2 publishes complete asynchronously; at most config.MaxInFlight are awaited at once.
+	// Anything beyond the window waits in the queue, and while the queue is non-empty new
+	// messages join it too, so per-topic ordering (within a priority) is preserved.
+	completions := make(chan publishResult, config.MaxInFlight)
+	inFlight := 0
+	// QoS 1 and 2 publishes are awaited in their own goroutines, so each waits for the
+	// previous publish on its topic to complete: two writes to the same setting must not
+	// reach it reversed
+	topicTail := make(map[string]chan struct{})
+
+	publishNow := func(conn MQTTConnection, msg MQTTMessage) error {
+		pubCtx, cancel := context.WithTimeout(ctx, publishTimeout)
+		defer cancel()
+		_, err := conn.Publish(pubCtx, &paho.Publish{
+			Topic:   msg.Topic,
+			QoS:     msg.QoS,
+			Retain:  msg.Retain,
+			Payload: msg.Payload,
+		})
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("no acknowledgement after %s", publishTimeout)
+		}
+		return err
+	}
+
+	startPublish := func(msg MQTTMessage) {
+		msg = config.TopicQoS.ApplyPublish(msg)
+		prev := topicTail[msg.Topic]
+		if msg.QoS == 0 && prev == nil {
+			// QoS 0 returns once written, so it's sent inline and keeps its place among other topics
+			if err := publishNow(client, msg); err != nil {
+				log.Printf("Failed to publish to %s: %v\n", msg.Topic, err)
+			}
+		} else {
+			conn, done := client, make(chan struct{})
+			topicTail[msg.Topic] = done
+			inFlight++
+			go func() {
+				defer close(done)
+				if prev != nil {
+					<-prev
+				}
+				completions <- publishResult{topic: msg.Topic, done: done, err: publishNow(conn, msg)}
+			}()
+		}
+		lastSent[msg.Topic] = lastSentInfo{
+			payload: bytes.Clone(msg.Payload),
+			sentAt:  time.Now(),
+		}
+		config.Keepalive.Published(msg, time.Now())
+	}
+
+	// sendQueued publishes queued messages, highest priority first, until the window fills
+	sendQueued := func() {
+		for client != nil && client.IsConnected() && inFlight < config.MaxInFlight {
+			msg, expired, ok := queue.Pop(time.Now())
+			if expired > 0 {
+				log.Printf("MQTT sender dropped %d expired queued messages\n", expired)
+			}
+			if !ok {
+				return
+			}
+			startPublish(msg)
+		}
+	}
+
+	publish := func(msg MQTTMessage) {
+		if client != nil && client.IsConnected() && inFlight < config.MaxInFlight && queue.Len() == 0 {
+			startPublish(msg)
+			return
+		}
+		// Disconnected or window full, queue the message
+		if !queue.Push(msg, time.Now()) {
+			log.Printf("MQTT sender queue full (%d), dropped lowest priority message\n", config.QueueSize)
+		}
+		if client == nil || !client.IsConnected() {
+			log.Printf("MQTT sender worker queued message (total queued: %d)\n", queue.Len())
+		}
+	}
+
+	// sendNative passes a service call to haServiceWorker, reporting false if it should
+	// be published to the proxy instead
+	sendNative := func(msg MQTTMessage) bool {
+		if serviceRoute == nil || msg.Topic != TopicCallServiceProxy {
+			return false
+		}
+		select {
+		case serviceRoute.calls <- msg:
+			return true
+		default:
+			log.Println("Native service call queue full, using MQTT proxy")
+			return false
+		}
+	}
+
+	// actuate sends a message that may be published, by Modbus, Shelly, the HA REST API
+	// or MQTT
+	actuate := func(msg MQTTMessage) {
+		// Checked here rather than on arrival so calls held by the limiter are judged on
+		// current data when released. The veto is logged by the interlock.
+		if config.Failsafe.Blocks(msg) {
+			log.Println("Broker failsafe tripped, dropping inverter service call")
+			return
+		}
+		if config.Interlock.Veto(msg, time.Now()) != "" {
+			return
+		}
+
+		if msg.Expect != nil && trackChan != nil {
+			select {
+			case trackChan <- msg:
+			default:
+				log.Printf("Command tracker busy, not tracking %s\n", msg.Expect.StateTopic)
+			}
+		}
+
+		if config.Modbus.Handles(msg) {
+			select {
+			case config.Modbus.calls <- msg:
+				return
+			default:
+				log.Println("Modbus queue full, using Home Assistant")
+			}
+		}
+
+		if config.Shelly.Handles(msg) {
+			select {
+			case config.Shelly.calls <- msg:
+				return
+			default:
+				log.Println("Shelly queue full, using Home Assistant")
+			}
+		}
+
+		if sendNative(msg) {
+			return
+		}
+
+		// Change detection: skip if payload unchanged and recently sent.
+		// Service calls and Victron read/write topics are commands that must always be forwarded.
+		if msg.Topic != TopicCallServiceProxy &&
+			!strings.HasPrefix(msg.Topic, "powerhouse_3/W/") &&
+			!strings.HasPrefix(msg.Topic, "powerhouse_3/R/") {
+			if last, ok := lastSent[msg.Topic]; ok {
+				if bytes.Equal(last.payload, msg.Payload) && time.Since(last.sentAt) < resendInterval {
+					return
+				}
+			}
+		}
+
+		publish(msg)
+	}
+
+	// dispatch sends a message that has passed the filters and rate limiter
+	dispatch := func(msg MQTTMessage) {
+		// Calls held by the limiter may outlast leadership
+		if !config.Leader.Allows(msg) || !config.Observer.Allows(msg, time.Now()) {
+			return
+		}
+		actuate(msg)
+	}
+
+	// The failsafe belongs to the instance that led while the broker was reachable: a
+	// leader loses its lease during the very outage the failsafe is for
+	ledWhenConnected := config.Leader.IsLeader()
+
+	limiter := NewServiceCallLimiter(config.ServiceCallInterval)
+	flushTicker := time.NewTicker(serviceCallFlushInterval)
+	defer flushTicker.Stop()
+
+	for {
+		config.Heartbeats.Beat("mqtt-sender-worker")
+		config.Diagnostics.SetQueueDepth(queue.Len())
+		select {
+		case data := <-dataChan:
+			// Read enabled state using GetBoolean (parsed by statsWorker)
+			newEnabled := data.GetBoolean(TopicPowerctlEnabledState)
+			if newEnabled != enabled {
+				log.Printf("Powerctl enabled: %v\n", newEnabled)
+				enabled = newEnabled
+			}
+			config.Interlock.Update(data)
+
+		case newClient := <-clientChan:
+			log.Println("MQTT sender worker received new connection")
+			client = newClient
+
+			// Process any queued messages now that we have a client
+			if queued := queue.Len(); queued > 0 && client != nil && client.IsConnected() {
+				log.Printf("MQTT sender worker sending %d queued messages\n", queued)
+				sendQueued()
+			}
+
+		case res := <-completions:
+			inFlight--
+			if topicTail[res.topic] == res.done {
+				delete(topicTail, res.topic)
+			}
+			if res.err != nil {
+				log.Printf("Failed to publish to %s: %v\n", res.topic, res.err)
+			}
+			sendQueued()
+
+		case msg := <-outgoingChan:
+			// Multiplus-only isolation: drop everything outside the Cerbo namespace,
+			// except discovery config topics which register HA entities.
+			if config.MultiplusOnly && !strings.HasPrefix(msg.Topic, "powerhouse_3/") && !isDiscoveryTopic(msg.Topic) {
+				continue
+			}
+
+			// A standby instance computes everything but publishes only its election traffic
+			if !config.Leader.Allows(msg) {
+				continue
+			}
+			// An observer records what it would actuate and publishes only its own sensors
+			if !config.Observer.Allows(msg, time.Now()) {
+				continue
+			}
+
+			// Check if message should be published (an observer's own sensors always are)
+			isEnabled := config.ForceEnable || enabled || isDiscoveryTopic(msg.Topic) || isLeadershipTopic(msg.Topic) || config.Observer != nil
+			if !isEnabled {
+				log.Printf("Powerctl disabled, dropping message to %s\n", msg.Topic)
+				continue
+			}
+
+			// Decisions made while HA restarts may be from stale or replayed sensors
+			if !config.Resync.Admit(msg) {
+				continue
+			}
+
+			if !limiter.Admit(msg, time.Now()) {
+				continue
+			}
+			dispatch(msg)
+
+		case now := <-flushTicker.C:
+			// Commands held while HA resynced go out once it has fresh data, unless
+			// powerctl has been disabled since
+			if due := config.Resync.Due(); len(due) > 0 && (config.ForceEnable || enabled || config.Observer != nil) {
+				log.Printf("HA resync: replaying %d held commands\n", len(due))
+				for _, msg := range due {
+					if limiter.Admit(msg, now) {
+						dispatch(msg)
+					}
+				}
+			}
+			for _, msg := range limiter.Due(now) {
+				dispatch(msg)
+			}
+
+			// Unchanged repeats on purpose, so past the duplicate check
+			if (config.ForceEnable || enabled) && config.Leader.IsLeader() {
+				for _, msg := range config.Keepalive.Due(now) {
+					if config.Observer.Allows(msg, now) {
+						publish(msg)
+					}
+				}
+			}
+
+			connected := client != nil && client.IsConnected()
+			offCalls, alert := config.Failsafe.Update(connected, now)
+			if (config.ForceEnable || enabled) && ledWhenConnected {
+				for _, msg := range offCalls {
+					if !config.Observer.Allows(msg, now) {
+						continue
+					}
+					if config.Failsafe.Policy == FailsafeActuate {
+						actuate(msg) // Modbus, Shelly or native first; the rest queue for reconnect
+					} else {
+						publish(msg)
+					}
+				}
+			}
+			// Sent as the broker returns, before leadership is re-established
+			if alert.Topic != "" && ledWhenConnected && config.Observer.Allows(alert, now) {
+				actuate(alert)
+			}
+			if connected {
+				ledWhenConnected = config.Leader.IsLeader()
+			}
+
+		case msg := <-fallbackChan:
+			// Already filtered on the way out; the native call failed so use the proxy
+			publish(msg)
+
+		case msg := <-shellyFallbackChan:
+			// Already filtered and checked on the way out; the Shelly couldn't take it
+			if !sendNative(msg) {
+				publish(msg)
+			}
+
+		case <-ctx.Done():
+			log.Println("MQTT sender worker stopped")
+			return
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package workers
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePublishClient records publishes; QoS 0 returns at once, as when written to the
+// broker, and QoS 1 stays in flight until released. It is connected until down is set.
+type fakePublishClient struct {
+	mu        sync.Mutex
+	published []string
+	acks      []chan struct{}
+	down      atomic.Bool
+}
+
+func (c *fakePublishClient) IsConnected() bool { return !c.down.Load() }
+
+func (c *fakePublishClient) Publish(ctx context.Context, p *paho.Publish) (*paho.PublishResponse, error) {
+	c.mu.Lock()
+	ack := make(chan struct{})
+	c.published = append(c.published, p.Topic)
+	c.acks = append(c.acks, ack)
+	c.mu.Unlock()
+	if p.QoS == 0 {
+		return &paho.PublishResponse{}, nil
+	}
+	select {
+	case <-ack:
+		return &paho.PublishResponse{}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *fakePublishClient) snapshot() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.published...)
+}
+
+// release acknowledges the first unacknowledged publish to topic
+func (c *fakePublishClient) release(topic string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, published := range c.published {
+		if published == topic && c.acks[i] != nil {
+			close(c.acks[i])
+			c.acks[i] = nil
+			return
+		}
+	}
+}
+
+func TestMQTTSenderWorker_BoundedInFlightWindow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	outgoing := make(chan MQTTMessage, 10)
+	clientChan := make(chan MQTTConnection, 1)
+	client := &fakePublishClient{}
+	clientChan <- client
+
+	go mqttSenderWorker(ctx, outgoing, clientChan, make(chan DisplayData), MQTTSenderConfig{
+		ForceEnable: true,
+		QueueSize:   10,
+		MaxInFlight: 2,
+	}, nil, nil)
+
+	for _, topic := range []string{"a", "b", "c", "d"} {
+		outgoing <- MQTTMessage{Topic: topic, Payload: []byte("1"), QoS: 1}
+	}
+
+	// Unacknowledged publishes don't block the worker, but only two go out
+	assert.Eventually(t, func() bool { return len(client.snapshot()) == 2 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.ElementsMatch(t, []string{"a", "b"}, client.snapshot())
+
+	// Each acknowledgement frees a slot for the next queued message, in order
+	client.release("b")
+	assert.Eventually(t, func() bool { return len(client.snapshot()) == 3 }, time.Second, time.Millisecond)
+	assert.Equal(t, "c", client.snapshot()[2])
+	client.release("a")
+	assert.Eventually(t, func() bool { return len(client.snapshot()) == 4 }, time.Second, time.Millisecond)
+	assert.Equal(t, "d", client.snapshot()[3])
+}
+
+func TestMQTTSenderWorker_SameTopicWaitsForAcknowledgement(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	outgoing := make(chan MQTTMessage, 10)
+	clientChan := make(chan MQTTConnection, 1)
+	client := &fakePublishClient{}
+	clientChan <- client
+
+	go mqttSenderWorker(ctx, outgoing, clientChan, make(chan DisplayData), MQTTSenderConfig{
+		ForceEnable: true,
+		QueueSize:   10,
+		MaxInFlight: 10,
+	}, nil, nil)
+
+	// The second write can't overtake the first, even with the window open
+	outgoing <- MQTTMessage{Topic: "a", Payload: []byte("1"), QoS: 1}
+	outgoing <- MQTTMessage{Topic: "a", Payload: []byte("2"), QoS: 1}
+	outgoing <- MQTTMessage{Topic: "b", Payload: []byte("1")}
+	assert.Eventually(t, func() bool { return len(client.snapshot()) == 2 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.ElementsMatch(t, []string{"a", "b"}, client.snapshot())
+
+	client.release("a")
+	assert.Eventually(t, func() bool { return len(client.snapshot()) == 3 }, time.Second, time.Millisecond)
+	assert.Equal(t, "a", client.snapshot()[2])
+}
+
+func TestMQTTSenderWorker_StandbyPublishesOnlyElectionTraffic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	outgoing := make(chan MQTTMessage, 10)
+	clientChan := make(chan MQTTConnection, 1)
+	client := &fakePublishClient{}
+	clientChan <- client
+	leader := NewLeaderElection(LeaderConfig{InstanceID: "b", Lease: time.Minute})
+
+	go mqttSenderWorker(ctx, outgoing, clientChan, make(chan DisplayData), MQTTSenderConfig{
+		QueueSize:   10,
+		MaxInFlight: 10,
+		Leader:      leader,
+	}, nil, nil)
+
+	outgoing <- serviceCallMessage("switch", "turn_on", "switch.inverter_1", nil)
+	outgoing <- MQTTMessage{Topic: TopicLeaderClaim, Payload: []byte(`{}`)}
+	assert.Eventually(t, func() bool { return len(client.snapshot()) == 1 }, time.Second, time.Millisecond)
+
+	leader.Observe(LeaderClaim{Instance: "b"}, time.Now())
+	outgoing <- serviceCallMessage("switch", "turn_on", "switch.inverter_1", nil)
+	assert.Eventually(t, func() bool { return len(client.snapshot()) == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{TopicLeaderClaim, TopicCallServiceProxy}, client.snapshot())
+}
+
+func TestMQTTSenderWorker_FailsafeOutlastsLeaderLease(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	outgoing := make(chan MQTTMessage, 10)
+	clientChan := make(chan MQTTConnection, 1)
+	client := &fakePublishClient{}
+	clientChan <- client
+	leader := NewLeaderElection(LeaderConfig{InstanceID: "a", Lease: 50 * time.Millisecond})
+	leader.Observe(LeaderClaim{Instance: "a"}, time.Now())
+
+	go mqttSenderWorker(ctx, outgoing, clientChan, make(chan DisplayData), MQTTSenderConfig{
+		ForceEnable: true,
+		QueueSize:   10,
+		MaxInFlight: 10,
+		Leader:      leader,
+		Failsafe: &BrokerFailsafe{
+			Policy:    FailsafeQueueOff,
+			After:     300 * time.Millisecond,
+			Inverters: []string{"switch.inverter_1"},
+		},
+	}, nil, nil)
+	time.Sleep(2 * serviceCallFlushInterval)
+
+	// The broker goes away and the lease lapses well before the failsafe trips
+	client.down.Store(true)
+	time.Sleep(100 * time.Millisecond)
+	leader.evaluate(time.Now())
+	assert.False(t, leader.IsLeader())
+	time.Sleep(300*time.Millisecond + 2*serviceCallFlushInterval)
+
+	// Still standby on reconnect, but the queued turn_off goes out
+	reconnected := &fakePublishClient{}
+	clientChan <- reconnected
+	assert.Eventually(t, func() bool { return len(reconnected.snapshot()) == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{TopicCallServiceProxy}, reconnected.snapshot())
+	assert.Empty(t, client.snapshot())
+}
+
+func TestMQTTSenderWorker_TurnOffPassesHAResync(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	outgoing := make(chan MQTTMessage, 10)
+	clientChan := make(chan MQTTConnection, 1)
+	client := &fakePublishClient{}
+	clientChan <- client
+	resync := NewHAResync(HAResyncConfig{CriticalTopics: []string{"homeassistant/sensor/a/state"}, Timeout: time.Minute})
+	resync.Hold(time.Now())
+
+	go mqttSenderWorker(ctx, outgoing, clientChan, make(chan DisplayData), MQTTSenderConfig{
+		ForceEnable: true,
+		QueueSize:   10,
+		MaxInFlight: 10,
+		Resync:      resync,
+	}, nil, nil)
+
+	outgoing <- serviceCallMessage("switch", "turn_on", "switch.inverter_2", nil)
+	outgoing <- MQTTMessage{Topic: "powerhouse_3/W/vebus/276/Mode", Payload: []byte(`{"value":3}`)}
+	outgoing <- serviceCallMessage("switch", "turn_off", "switch.inverter_1", nil)
+	assert.Eventually(t, func() bool { return len(client.snapshot()) == 1 }, time.Second, time.Millisecond)
+	time.Sleep(2 * serviceCallFlushInterval)
+	assert.Equal(t, []string{TopicCallServiceProxy}, client.snapshot(), "only the turn_off goes out during the hold")
+
+	// The held commands are replayed once HA has fresh data
+	client.release(TopicCallServiceProxy)
+	resync.Seen("homeassistant/sensor/a/state")
+	assert.Eventually(t, func() bool { return len(client.snapshot()) == 3 }, time.Second, time.Millisecond)
+	assert.ElementsMatch(t, []string{TopicCallServiceProxy, TopicCallServiceProxy, "powerhouse_3/W/vebus/276/Mode"}, client.snapshot())
+}
+
+func TestMQTTSenderWorker_FullModbusQueueFallsBackToHA(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	outgoing := make(chan MQTTMessage, 10)
+	clientChan := make(chan MQTTConnection, 1)
+	client := &fakePublishClient{}
+	clientChan <- client
+	route := newModbusRoute([]InverterInfo{{EntityID: "switch.inverter_1", Modbus: &ModbusTarget{Address: "gx:502"}}})
+	route.calls = make(chan MQTTMessage) // Nobody draining: always full
+
+	go mqttSenderWorker(ctx, outgoing, clientChan, make(chan DisplayData), MQTTSenderConfig{
+		ForceEnable: true,
+		QueueSize:   10,
+		MaxInFlight: 10,
+		Modbus:      route,
+	}, nil, nil)
+
+	outgoing <- serviceCallMessage("switch", "turn_off", "switch.inverter_1", nil)
+	assert.Eventually(t, func() bool { return len(client.snapshot()) == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{TopicCallServiceProxy}, client.snapshot())
+}
+
+func TestMQTTSenderWorker_ObserverPublishesOnlyItsSensors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	outgoing := make(chan MQTTMessage, 10)
+	clientChan := make(chan MQTTConnection, 1)
+	client := &fakePublishClient{}
+	clientChan <- client
+	observer := NewObserver()
+
+	// Not enabled either: the observer's sensors still go out
+	go mqttSenderWorker(ctx, outgoing, clientChan, make(chan DisplayData), MQTTSenderConfig{
+		QueueSize:   10,
+		MaxInFlight: 10,
+		Observer:    observer,
+	}, nil, nil)
+
+	commandsState := "powerctl/sensor/" + observerCommandsSensorID + "/state"
+	outgoing <- serviceCallMessage("switch", "turn_on", "switch.inverter_1", nil)
+	outgoing <- MQTTMessage{Topic: "powerhouse_3/W/settings/0/Settings/CGwacs/AcPowerSetPoint", Payload: []byte(`{"value":-500}`)}
+	outgoing <- MQTTMessage{Topic: "homeassistant/sensor/powerctl_mode/config", Payload: []byte(`{}`)}
+	outgoing <- MQTTMessage{Topic: commandsState, Payload: []byte("2")}
+	assert.Eventually(t, func() bool { return len(client.snapshot()) == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{commandsState}, client.snapshot())
+
+	total, _, _ := observer.Commands()
+	assert.Equal(t, 2, total)
+}
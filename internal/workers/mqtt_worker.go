@@ -0,0 +1,266 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/eclipse/paho.golang/paho/session/state"
+	"github.com/eclipse/paho.golang/paho/store/file"
+)
+
+// mqttSessionExpiry is how long the broker keeps a persistent session while powerctl is away
+const mqttSessionExpiry = 24 * time.Hour
+
+// TopicRoute binds a set of subscribed topics to a destination channel.
+// mqttWorker subscribes to every topic in Topics and forwards each incoming
+// message on that topic to Channel.
+type TopicRoute struct {
+	Topics  []string
+	Channel chan<- SensorMessage
+	Seen    func(topic string)  // Optional; called for each valid message before forwarding
+	Tap     func(SensorMessage) // Optional; sees each valid message before forwarding, must not block
+}
+
+// MQTTConnection is the MQTT connection mqttWorker shares with mqttSenderWorker.
+type MQTTConnection interface {
+	IsConnected() bool
+	// Publish blocks until the message is sent (QoS 0) or acknowledged (QoS 1 and 2)
+	Publish(ctx context.Context, p *paho.Publish) (*paho.PublishResponse, error)
+}
+
+// mqttConnection tracks whether the autopaho connection is currently up.
+type mqttConnection struct {
+	cm        atomic.Pointer[autopaho.ConnectionManager]
+	connected atomic.Bool
+}
+
+func (c *mqttConnection) IsConnected() bool { return c.connected.Load() }
+
+func (c *mqttConnection) Publish(ctx context.Context, p *paho.Publish) (*paho.PublishResponse, error) {
+	cm := c.cm.Load()
+	if cm == nil {
+		return nil, autopaho.ConnectionDownError
+	}
+	return cm.Publish(ctx, p)
+}
+
+// topicAliases replaces repeated publish topics with MQTT v5 topic aliases, up to the
+// broker's limit for the current connection. Only QoS 0 publishes are aliased: QoS 1 and
+// 2 publishes are kept in the session and may be resent on a later connection, where
+// the alias means nothing.
+type topicAliases struct {
+	mu      sync.Mutex
+	max     uint16
+	aliases map[string]uint16
+}
+
+// Reset starts a new connection's aliases; max is the broker's topic alias maximum.
+func (t *topicAliases) Reset(max uint16) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.max = max
+	t.aliases = make(map[string]uint16)
+}
+
+// PublishHook is called by paho before each publish is sent.
+func (t *topicAliases) PublishHook(p *paho.Publish) {
+	if p.QoS != 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	alias, ok := t.aliases[p.Topic]
+	if !ok {
+		if len(t.aliases) >= int(t.max) {
+			return
+		}
+		// The first publish carries both, which tells the broker the mapping
+		alias = uint16(len(t.aliases) + 1) //nolint:gosec // bounded by t.max
+		t.aliases[p.Topic] = alias
+	} else {
+		p.Topic = ""
+	}
+	if p.Properties == nil {
+		p.Properties = &paho.PublishProperties{}
+	}
+	p.Properties.TopicAlias = paho.Uint16(alias)
+}
+
+// newMQTTSession keeps the session's in-flight messages in dir so they survive a restart
+func newMQTTSession(dir string) (*state.State, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	client, err := file.New(dir, "client-", ".pkt")
+	if err != nil {
+		return nil, err
+	}
+	server, err := file.New(dir, "server-", ".pkt")
+	if err != nil {
+		return nil, err
+	}
+	return state.New(client, server), nil
+}
+
+// mqttWorker manages the MQTT v5 connection and forwards messages to routed channels.
+// The same connection is handed to mqttSenderWorker on every (re)connect.
+// With a non-empty sessionDir the broker session persists across restarts: the
+// broker keeps subscriptions and queues QoS 1 messages while powerctl is away, and
+// unacknowledged outgoing messages are stored in sessionDir and resent on reconnect.
+// topicQoS overrides the subscription QoS per topic. Connections and incoming messages
+// are counted in diag (nil disables).
+func mqttWorker(
+	ctx context.Context,
+	broker string,
+	port int,
+	routes []TopicRoute,
+	username, password, clientID string,
+	sessionDir string,
+	topicQoS TopicQoSConfig,
+	clientChan chan<- MQTTConnection,
+	diag *Diagnostics,
+) {
+	// forward delivers a message to the route's channel
+	forward := func(route TopicRoute, topic string, payload []byte) {
+		value := string(payload)
+
+		// Skip invalid values from HA - sensor has dropped out
+		// TODO: Track how long sensors have been invalid and send notification
+		if value == "Undefined" || value == "unavailable" || value == "unknown" {
+			return
+		}
+		diag.Received()
+		if route.Seen != nil {
+			route.Seen(topic)
+		}
+		if route.Tap != nil {
+			route.Tap(SensorMessage{Topic: topic, Value: value})
+		}
+
+		select {
+		case route.Channel <- SensorMessage{Topic: topic, Value: value}:
+		case <-ctx.Done():
+		}
+	}
+
+	// Messages are routed by topic rather than per subscription, so messages the broker
+	// queued for a persistent session are delivered even before the subscriptions are renewed
+	routeFor := make(map[string]TopicRoute)
+	for _, route := range routes {
+		for _, topic := range route.Topics {
+			routeFor[topic] = route
+		}
+	}
+
+	serverURL, err := url.Parse(fmt.Sprintf("mqtt://%s:%d", broker, port))
+	if err != nil {
+		log.Printf("Invalid MQTT broker address: %v\n", err)
+		return
+	}
+
+	conn := &mqttConnection{}
+	aliases := &topicAliases{}
+	cfg := autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{serverURL},
+		KeepAlive:                     30,
+		CleanStartOnInitialConnection: true,
+		ReconnectBackoff:              autopaho.NewConstantBackoff(5 * time.Second),
+		ConnectUsername:               username,
+		ConnectPassword:               []byte(password),
+		// Aliases are per connection; none are used until the broker's limit is known
+		ConnectPacketBuilder: func(cp *paho.Connect, _ *url.URL) (*paho.Connect, error) {
+			aliases.Reset(0)
+			return cp, nil
+		},
+		OnConnectionUp: func(cm *autopaho.ConnectionManager, connack *paho.Connack) {
+			if connack.Properties != nil && connack.Properties.TopicAliasMaximum != nil {
+				aliases.Reset(*connack.Properties.TopicAliasMaximum)
+			}
+			conn.cm.Store(cm)
+			conn.connected.Store(true)
+			diag.Connected()
+			log.Printf("Connected to MQTT broker at %s (session present: %v)\n", broker, connack.SessionPresent) //nolint:gosec // broker host from operator-set env config, not untrusted input
+
+			// Send the connection to the sender worker
+			select {
+			case clientChan <- conn:
+				log.Println("Sent MQTT connection to sender worker")
+			case <-ctx.Done():
+				return
+			}
+
+			// Subscribe to all routed topics
+			var subscribeQoS byte
+			if sessionDir != "" {
+				subscribeQoS = 1
+			}
+			for _, route := range routes {
+				for _, topic := range route.Topics {
+					_, err := cm.Subscribe(ctx, &paho.Subscribe{Subscriptions: []paho.SubscribeOptions{
+						{Topic: topic, QoS: topicQoS.SubscribeQoS(topic, subscribeQoS)},
+					}})
+					if err != nil {
+						log.Printf("Failed to subscribe to topic %s: %v\n", topic, err)
+					} else {
+						log.Printf("Subscribed to topic: %s\n", topic)
+					}
+				}
+			}
+		},
+		OnConnectError: func(err error) {
+			log.Printf("Failed to connect to MQTT broker: %v\n", err)
+		},
+		ClientConfig: paho.ClientConfig{
+			ClientID: clientID,
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){
+				func(pr paho.PublishReceived) (bool, error) {
+					route, ok := routeFor[pr.Packet.Topic]
+					if ok {
+						forward(route, pr.Packet.Topic, pr.Packet.Payload)
+					}
+					return ok, nil
+				},
+			},
+			OnClientError: func(err error) {
+				conn.connected.Store(false)
+				log.Printf("MQTT connection lost: %v\n", err)
+			},
+			OnServerDisconnect: func(d *paho.Disconnect) {
+				conn.connected.Store(false)
+				log.Printf("MQTT connection lost: server disconnected (reason %d)\n", d.ReasonCode)
+			},
+			PublishHook: aliases.PublishHook,
+		},
+	}
+	if sessionDir != "" {
+		session, err := newMQTTSession(sessionDir)
+		if err != nil {
+			log.Printf("Failed to open MQTT session store %s: %v\n", sessionDir, err)
+			return
+		}
+		cfg.CleanStartOnInitialConnection = false
+		cfg.SessionExpiryInterval = uint32(mqttSessionExpiry / time.Second)
+		cfg.Session = session
+	}
+
+	// Connect to broker, retrying until ctx is done
+	log.Printf("Connecting to MQTT broker at %s...\n", broker) //nolint:gosec // broker host from operator-set env config, not untrusted input
+	cm, err := autopaho.NewConnection(ctx, cfg)
+	if err != nil {
+		log.Printf("Failed to connect to MQTT broker: %v\n", err)
+		return
+	}
+
+	// The connection manager disconnects when ctx is done
+	<-cm.Done()
+	conn.connected.Store(false)
+	log.Println("Disconnected from MQTT broker")
+}
@@ -0,0 +1,52 @@
+package workers
+
+import (
+	"testing"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicAliases(t *testing.T) {
+	aliases := &topicAliases{}
+	publish := func(topic string, qos byte) *paho.Publish {
+		p := &paho.Publish{Topic: topic, QoS: qos}
+		aliases.PublishHook(p)
+		return p
+	}
+	alias := func(p *paho.Publish) uint16 {
+		if p.Properties == nil || p.Properties.TopicAlias == nil {
+			return 0
+		}
+		return *p.Properties.TopicAlias
+	}
+
+	// No aliases until the broker's limit is known
+	aliases.Reset(0)
+	p := publish("a", 0)
+	assert.Equal(t, "a", p.Topic)
+	assert.Zero(t, alias(p))
+
+	aliases.Reset(1)
+	p = publish("a", 0)
+	assert.Equal(t, "a", p.Topic, "first publish sets the alias")
+	assert.Equal(t, uint16(1), alias(p))
+	p = publish("a", 0)
+	assert.Empty(t, p.Topic, "later publishes send only the alias")
+	assert.Equal(t, uint16(1), alias(p))
+
+	// Beyond the limit topics are sent in full
+	p = publish("b", 0)
+	assert.Equal(t, "b", p.Topic)
+	assert.Zero(t, alias(p))
+
+	// Stored publishes may be resent on another connection
+	p = publish("a", 1)
+	assert.Equal(t, "a", p.Topic)
+	assert.Zero(t, alias(p))
+
+	// A new connection starts over
+	aliases.Reset(1)
+	p = publish("a", 0)
+	assert.Equal(t, "a", p.Topic)
+}
@@ -0,0 +1,130 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Observer sensors, published only by an instance running with --observe.
+const (
+	observerCommandsSensorID  = "powerctl_observer_commands"
+	observerDecisionsSensorID = "powerctl_observer_decisions"
+)
+
+// observerRecentCommands is how many would-be commands the commands sensor lists.
+const observerRecentCommands = 20
+
+// ObservedCommand is an actuation an observing instance held back.
+type ObservedCommand struct {
+	At      time.Time       `json:"at"`
+	Topic   string          `json:"topic"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Observer runs powerctl read-only beside the active instance: every worker runs, but
+// mqttSenderWorker lets only the observer's own sensors out. Actuations (service calls
+// and Victron writes) are recorded for the commands sensor; everything else, such as
+// the entity states the active instance owns, is dropped. A nil *Observer lets
+// everything through. Safe for concurrent use.
+type Observer struct {
+	mu       sync.Mutex
+	total    int
+	recent   []ObservedCommand
+	lastSeen int // total when last published
+}
+
+// NewObserver creates an observer with no commands recorded.
+func NewObserver() *Observer {
+	return &Observer{}
+}
+
+// isActuation reports whether msg would change something outside powerctl.
+func isActuation(msg MQTTMessage) bool {
+	return msg.Topic == TopicCallServiceProxy || strings.HasPrefix(msg.Topic, "powerhouse_3/W/")
+}
+
+// isObserverTopic reports whether topic belongs to an observer sensor (its state,
+// attributes or discovery config).
+func isObserverTopic(topic string) bool {
+	parts := strings.Split(topic, "/")
+	return len(parts) == 4 && strings.HasPrefix(parts[2], "powerctl_observer_")
+}
+
+// Allows reports whether msg may be published, recording it if it is an actuation.
+func (o *Observer) Allows(msg MQTTMessage, now time.Time) bool {
+	if o == nil || isObserverTopic(msg.Topic) {
+		return true
+	}
+	if !isActuation(msg) {
+		return false
+	}
+
+	payload := json.RawMessage(msg.Payload)
+	if !json.Valid(payload) {
+		payload, _ = json.Marshal(string(msg.Payload))
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.total++
+	o.recent = append(o.recent, ObservedCommand{At: now, Topic: msg.Topic, Payload: payload})
+	if len(o.recent) > observerRecentCommands {
+		o.recent = o.recent[len(o.recent)-observerRecentCommands:]
+	}
+	return false
+}
+
+// Commands returns the number of commands held back and the most recent ones, oldest
+// first. changed is false if nothing was recorded since the last call.
+func (o *Observer) Commands() (total int, recent []ObservedCommand, changed bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	changed = o.total != o.lastSeen
+	o.lastSeen = o.total
+	return o.total, append([]ObservedCommand(nil), o.recent...), changed
+}
+
+// observerWorker publishes what the observing instance would have done: the commands
+// it held back, and each controller's latest decision outputs from status.
+func observerWorker(ctx context.Context, observer *Observer, status *WorkerStatus, sender *MQTTSender, interval time.Duration) {
+	log.Println("Observer mode: actuation is held back and published to the powerctl_observer_* sensors")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	publish := func(sensorID, state string, attributes any) {
+		sender.Send(MQTTMessage{Topic: "powerctl/sensor/" + sensorID + "/state", Payload: []byte(state), QoS: 1, Retain: true})
+		payload, err := json.Marshal(attributes)
+		if err != nil {
+			log.Printf("Observer: encode %s attributes: %v\n", sensorID, err)
+			return
+		}
+		sender.Send(MQTTMessage{Topic: "powerctl/sensor/" + sensorID + "/attributes", Payload: payload, QoS: 1, Retain: true})
+	}
+
+	first := true
+	for {
+		select {
+		case <-ticker.C:
+			if total, recent, changed := observer.Commands(); changed || first {
+				publish(observerCommandsSensorID, strconv.Itoa(total), map[string]any{"recent": recent})
+			}
+			first = false
+
+			decisions := make(map[string]any)
+			for _, worker := range status.DecisionWorkers() {
+				if d, ok := status.LastDecision(worker); ok {
+					decisions[worker] = decisionJSON(d.Outputs)
+				}
+			}
+			publish(observerDecisionsSensorID, strconv.Itoa(len(decisions)), decisions)
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package workers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserver_Allows(t *testing.T) {
+	var disabled *Observer
+	assert.True(t, disabled.Allows(serviceCallMessage("switch", "turn_on", "switch.inverter_1", nil), time.Now()))
+
+	observer := NewObserver()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Own sensors pass; states and discovery the active instance owns are dropped unrecorded
+	assert.True(t, observer.Allows(MQTTMessage{Topic: "powerctl/sensor/powerctl_observer_decisions/attributes"}, now))
+	assert.True(t, observer.Allows(MQTTMessage{Topic: "homeassistant/sensor/powerctl_observer_commands/config"}, now))
+	assert.False(t, observer.Allows(MQTTMessage{Topic: "powerctl/sensor/powerctl_mode/state", Payload: []byte("auto")}, now))
+	_, _, changed := observer.Commands()
+	assert.False(t, changed)
+
+	// Actuations are held back and recorded; non-JSON payloads are kept as strings
+	assert.False(t, observer.Allows(serviceCallMessage("switch", "turn_on", "switch.inverter_1", nil), now))
+	assert.False(t, observer.Allows(MQTTMessage{Topic: "powerhouse_3/W/vebus/276/Mode", Payload: []byte("not json")}, now))
+	total, recent, changed := observer.Commands()
+	assert.True(t, changed)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, TopicCallServiceProxy, recent[0].Topic)
+	assert.JSONEq(t, `"not json"`, string(recent[1].Payload))
+
+	_, _, changed = observer.Commands()
+	assert.False(t, changed)
+
+	// Only the most recent commands are kept
+	for i := range observerRecentCommands {
+		observer.Allows(MQTTMessage{Topic: fmt.Sprintf("powerhouse_3/W/%d", i), Payload: []byte("1")}, now)
+	}
+	total, recent, _ = observer.Commands()
+	assert.Equal(t, 2+observerRecentCommands, total)
+	assert.Len(t, recent, observerRecentCommands)
+	assert.Equal(t, "powerhouse_3/W/0", recent[0].Topic)
+}
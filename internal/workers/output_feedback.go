@@ -0,0 +1,62 @@
+package workers
+
+import (
+	"math"
+	"time"
+)
+
+// OutputFeedback corrects the inverter count from measured output. Over each window
+// in which the count holds, it compares the average commanded watts with the average
+// measured output; when they differ by more than the tolerance it steps a correction
+// of one inverter towards the shortfall (or surplus), so an inverter that is switched
+// on but silently producing nothing is made up by the next one. A window in which the
+// count changes is restarted, since inverters take a while to ramp.
+type OutputFeedback struct {
+	Tolerance float64 // Fraction of commanded watts, e.g. 0.2; 0 disables
+	Window    time.Duration
+
+	Correction int     // -1, 0 or +1 inverters
+	Ratio      float64 // measured/commanded over the last complete window
+
+	count     int
+	start     time.Time
+	commanded float64 // sums over the window
+	measured  float64
+	samples   int
+}
+
+// Update records one tick with count inverters commanded to produce commandedWatts
+// while measuredWatts was produced, and returns the correction to add to count. The
+// correction is dropped while nothing is commanded.
+func (f *OutputFeedback) Update(count int, commandedWatts, measuredWatts float64, now time.Time) int {
+	if f.Tolerance <= 0 || f.Window <= 0 {
+		return 0
+	}
+	if count <= 0 {
+		f.Correction = 0
+		f.samples = 0
+		return 0
+	}
+	if count != f.count || f.samples == 0 {
+		f.count, f.start = count, now
+		f.commanded, f.measured, f.samples = 0, 0, 0
+	}
+	f.commanded += commandedWatts
+	f.measured += measuredWatts
+	f.samples++
+
+	if now.Sub(f.start) < f.Window || f.commanded <= 0 {
+		return f.Correction
+	}
+	f.Ratio = f.measured / f.commanded
+	if math.Abs(f.Ratio-1) > f.Tolerance {
+		step := 1
+		if f.Ratio > 1 {
+			step = -1
+		}
+		f.Correction = max(-1, min(1, f.Correction+step))
+	}
+	f.start = now
+	f.commanded, f.measured, f.samples = 0, 0, 0
+	return f.Correction
+}
@@ -0,0 +1,55 @@
+package workers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputFeedback_AddsInverterForShortfall(t *testing.T) {
+	f := &OutputFeedback{Tolerance: 0.2, Window: 5 * time.Minute}
+	t0 := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	// 4 commanded, one silently dead: 765W of 1020W
+	for i := range 5 {
+		assert.Equal(t, 0, f.Update(4, 1020, 765, t0.Add(time.Duration(i)*time.Minute)))
+	}
+	assert.Equal(t, 1, f.Update(4, 1020, 765, t0.Add(5*time.Minute)))
+	assert.InDelta(t, 0.75, f.Ratio, 0.001)
+
+	// The extra inverter makes up the shortfall, so the correction holds
+	for i := 6; i <= 11; i++ {
+		assert.Equal(t, 1, f.Update(4, 1020, 1020, t0.Add(time.Duration(i)*time.Minute)))
+	}
+}
+
+func TestOutputFeedback_RemovesCorrectionWhenInverterRecovers(t *testing.T) {
+	f := &OutputFeedback{Tolerance: 0.2, Window: 5 * time.Minute, Correction: 1}
+	t0 := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i <= 5; i++ {
+		f.Update(4, 1020, 1275, t0.Add(time.Duration(i)*time.Minute))
+	}
+	assert.Equal(t, 0, f.Correction)
+}
+
+func TestOutputFeedback_CountChangeRestartsWindow(t *testing.T) {
+	f := &OutputFeedback{Tolerance: 0.2, Window: 5 * time.Minute}
+	t0 := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	f.Update(4, 1020, 500, t0)
+	f.Update(3, 765, 500, t0.Add(4*time.Minute))
+	assert.Equal(t, 0, f.Update(3, 765, 500, t0.Add(6*time.Minute)), "window restarted at the count change")
+	assert.Equal(t, 1, f.Update(3, 765, 500, t0.Add(9*time.Minute)))
+
+	assert.Equal(t, 0, f.Update(0, 0, 0, t0.Add(10*time.Minute)), "dropped with nothing commanded")
+	assert.Equal(t, 0, f.Correction)
+}
+
+func TestOutputFeedback_Disabled(t *testing.T) {
+	f := &OutputFeedback{}
+	t0 := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, 0, f.Update(4, 1020, 0, t0))
+	assert.Equal(t, 0, f.Update(4, 1020, 0, t0.Add(time.Hour)))
+}
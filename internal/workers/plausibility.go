@@ -0,0 +1,207 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ryansname/powerctl/internal/stats"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// dataQualitySensorID is the debug sensor counting readings statsWorker rejected.
+const dataQualitySensorID = "powerctl_data_quality"
+
+// plausibilityResettle is how many step-rejected readings in a row are taken as a real
+// change of level (e.g. a sensor replaced or recalibrated) and accepted.
+const plausibilityResettle = 3
+
+// PlausibilityRule bounds the readings a topic can really produce, in normalized units
+// (see topicUnits). A range applies when Min < Max. A reading may move from the last
+// accepted one by at most MaxStep per StepInterval elapsed, and always by one MaxStep;
+// 0 disables the step check.
+type PlausibilityRule struct {
+	Min, Max     float64
+	MaxStep      float64
+	StepInterval time.Duration
+}
+
+// plausibilityRules holds the rules statsWorker applies on top of topicUnits'
+// per-unit checks. Topics not listed are only checked per unit.
+var plausibilityRules = map[string]PlausibilityRule{}
+
+// registerPlausibilityRule declares rule for a topic only known at runtime (e.g. from
+// BatteryConfig). Must be called before statsWorker starts.
+func registerPlausibilityRule(topic string, rule PlausibilityRule) {
+	plausibilityRules[topic] = rule
+}
+
+// validatePlausibilityRules reports rules that could never accept or never apply.
+func validatePlausibilityRules(rules map[string]PlausibilityRule) error {
+	topics := make([]string, 0, len(rules))
+	for topic := range rules {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	var errs []error
+	for _, topic := range topics {
+		rule := rules[topic]
+		if rule.Min > rule.Max {
+			errs = append(errs, fmt.Errorf("%s: min %g above max %g", topic, rule.Min, rule.Max))
+		}
+		if rule.MaxStep < 0 || (rule.MaxStep > 0 && rule.StepInterval <= 0) {
+			errs = append(errs, fmt.Errorf("%s: max step %g needs a positive step interval", topic, rule.MaxStep))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// check returns why value is implausible given the last accepted reading (if any), or "".
+func (r PlausibilityRule) check(value float64, last *stats.Reading, now time.Time) string {
+	if r.Min < r.Max && (value < r.Min || value > r.Max) {
+		return fmt.Sprintf("outside %g..%g", r.Min, r.Max)
+	}
+	if r.MaxStep > 0 && last != nil {
+		allowed := r.MaxStep * max(1, float64(now.Sub(last.Timestamp))/float64(r.StepInterval))
+		if step := math.Abs(value - last.Value); step > allowed {
+			return fmt.Sprintf("step of %g from %g exceeds %g", step, last.Value, allowed)
+		}
+	}
+	return ""
+}
+
+// TopicQuality is a topic's rejection record, published in the data quality sensor.
+type TopicQuality struct {
+	Rejected   int       `json:"rejected"`
+	LastReason string    `json:"last_reason"`
+	LastAt     time.Time `json:"last_at"`
+}
+
+// DataQuality applies the unit and plausibility checks to statsWorker's numeric readings
+// and counts what it rejects. Rejected readings are dropped, so downstream workers keep
+// the last plausible value. A nil *DataQuality checks units only and counts nothing.
+// Safe for concurrent use.
+type DataQuality struct {
+	rules map[string]PlausibilityRule
+
+	mu       sync.Mutex
+	last     map[string]stats.Reading // last accepted reading per ruled topic
+	streak   map[string]int           // consecutive step rejections per topic
+	topics   map[string]*TopicQuality
+	total    int
+	lastSeen int // total when last published
+}
+
+// NewDataQuality creates a DataQuality applying rules.
+func NewDataQuality(rules map[string]PlausibilityRule) *DataQuality {
+	return &DataQuality{
+		rules:  rules,
+		last:   make(map[string]stats.Reading),
+		streak: make(map[string]int),
+		topics: make(map[string]*TopicQuality),
+	}
+}
+
+// Admit returns why a normalized reading in unit must be rejected, or "" to accept it.
+func (q *DataQuality) Admit(topic string, value float64, unit Unit, now time.Time) string {
+	reason := ""
+	if !unit.Plausible(value) {
+		reason = fmt.Sprintf("implausible for %s", unit.Normalized())
+	}
+	if q == nil {
+		return reason
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if rule, ok := q.rules[topic]; ok && reason == "" {
+		var last *stats.Reading
+		if r, ok := q.last[topic]; ok {
+			last = &r
+		}
+		reason = rule.check(value, last, now)
+		// A step held for several readings is a new level rather than a glitch
+		if reason != "" && rule.check(value, nil, now) == "" {
+			q.streak[topic]++
+			if q.streak[topic] >= plausibilityResettle {
+				log.Printf("Data quality: accepting new level %g on %s after %d rejected readings\n", value, topic, q.streak[topic])
+				reason = ""
+			}
+		}
+		if reason == "" {
+			q.last[topic] = stats.Reading{Value: value, Timestamp: now}
+			delete(q.streak, topic)
+		}
+	}
+	if reason != "" {
+		t, ok := q.topics[topic]
+		if !ok {
+			t = &TopicQuality{}
+			q.topics[topic] = t
+		}
+		t.Rejected++
+		t.LastReason, t.LastAt = reason, now
+		q.total++
+	}
+	return reason
+}
+
+// Rejections returns the number of readings rejected and each topic's record. changed
+// is false if nothing was rejected since the last call.
+func (q *DataQuality) Rejections() (total int, topics map[string]TopicQuality, changed bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	topics = make(map[string]TopicQuality, len(q.topics))
+	for topic, t := range q.topics {
+		topics[topic] = *t
+	}
+	changed = q.total != q.lastSeen
+	q.lastSeen = q.total
+	return q.total, topics, changed
+}
+
+// dataQualityWorker publishes the data quality sensor: readings rejected since startup,
+// with each topic's count and latest reason in its attributes.
+func dataQualityWorker(ctx context.Context, quality *DataQuality, sender *MQTTSender, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	first := true
+	for {
+		select {
+		case <-ticker.C:
+			total, topics, changed := quality.Rejections()
+			if !changed && !first {
+				continue
+			}
+			first = false
+
+			sender.Send(MQTTMessage{
+				Topic:   "powerctl/sensor/" + dataQualitySensorID + "/state",
+				Payload: []byte(strconv.Itoa(total)),
+				QoS:     1,
+				Retain:  true,
+			})
+			payload, err := json.Marshal(map[string]any{"topics": topics})
+			if err != nil {
+				log.Printf("Data quality: encode attributes: %v\n", err)
+				continue
+			}
+			sender.Send(MQTTMessage{
+				Topic:   "powerctl/sensor/" + dataQualitySensorID + "/attributes",
+				Payload: payload,
+				QoS:     1,
+				Retain:  true,
+			})
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package workers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataQuality_Admit(t *testing.T) {
+	quality := NewDataQuality(map[string]PlausibilityRule{
+		"t/voltage": batteryVoltageRule,
+		"t/energy":  energyCounterRule,
+	})
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Range: a 0V dropout is rejected, the last plausible value kept
+	assert.Empty(t, quality.Admit("t/voltage", 52.1, UnitV, start))
+	assert.Equal(t, "outside 40..62", quality.Admit("t/voltage", 0, UnitV, start.Add(time.Second)))
+	assert.Empty(t, quality.Admit("t/voltage", 52.3, UnitV, start.Add(2*time.Second)))
+
+	// Step: a 10x counter jump is rejected; the allowance grows with the time since the last reading
+	assert.Empty(t, quality.Admit("t/energy", 120.5, "", start))
+	assert.Contains(t, quality.Admit("t/energy", 1205, "", start.Add(time.Minute)), "step of 1084.5")
+	assert.Empty(t, quality.Admit("t/energy", 122, "", start.Add(2*time.Minute)))
+
+	// Unit checks apply to every topic, even with a nil DataQuality
+	assert.NotEmpty(t, quality.Admit("t/soc", 120, UnitPercent, start))
+	var unruled *DataQuality
+	assert.NotEmpty(t, unruled.Admit("t/soc", 120, UnitPercent, start))
+	assert.Empty(t, unruled.Admit("t/energy", 1e9, "", start))
+
+	total, topics, changed := quality.Rejections()
+	assert.Equal(t, 3, total)
+	assert.True(t, changed)
+	assert.Equal(t, 1, topics["t/energy"].Rejected)
+	assert.Equal(t, "outside 40..62", topics["t/voltage"].LastReason)
+	_, _, changed = quality.Rejections()
+	assert.False(t, changed)
+}
+
+func TestDataQuality_ResettlesOnSustainedStep(t *testing.T) {
+	quality := NewDataQuality(map[string]PlausibilityRule{"t/energy": energyCounterRule})
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.Empty(t, quality.Admit("t/energy", 10, "", start))
+
+	for i := 1; i < plausibilityResettle; i++ {
+		assert.NotEmpty(t, quality.Admit("t/energy", 500, "", start.Add(time.Duration(i)*time.Second)))
+	}
+	assert.Empty(t, quality.Admit("t/energy", 500, "", start.Add(time.Minute)))
+	assert.Empty(t, quality.Admit("t/energy", 500.2, "", start.Add(2*time.Minute)))
+}
+
+func TestValidatePlausibilityRules(t *testing.T) {
+	assert.NoError(t, validatePlausibilityRules(map[string]PlausibilityRule{"a": batteryVoltageRule, "b": energyCounterRule}))
+	err := validatePlausibilityRules(map[string]PlausibilityRule{
+		"a": {Min: 5, Max: 1},
+		"b": {MaxStep: 1},
+	})
+	assert.ErrorContains(t, err, "a: min 5 above max 1")
+	assert.ErrorContains(t, err, "b: max step 1 needs a positive step interval")
+}
@@ -0,0 +1,176 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ryansname/powerctl/internal/stats"
+	"log"
+	"os"
+	"time"
+)
+
+// Topics for power excess calculation
+const (
+	TopicBattery1Energy = "homeassistant/sensor/home_sweet_home_tg118095000r1a_battery_remaining/state"
+	TopicBattery2Energy = "homeassistant/sensor/battery_2_available_energy/state"
+	TopicBattery3Energy = "homeassistant/sensor/battery_3_available_energy/state"
+	TopicSolar1Power    = "homeassistant/sensor/solar_1_power/state"
+
+	TopicSolcastForecastRemaining = "homeassistant/sensor/solcast_pv_forecast_forecast_remaining_today/state"
+	TopicSolcastDetailedForecast  = "homeassistant/sensor/solcast_pv_forecast_forecast_today/detailedForecast"
+	TopicSolcastForecastTomorrow  = "homeassistant/sensor/solcast_pv_forecast_forecast_tomorrow/state"
+)
+
+// ExcessRule adds Contribution watts of excess while the topic's percentile over
+// Window is above Threshold.
+type ExcessRule struct {
+	Topic        string        `json:"topic"`
+	Percentile   int           `json:"percentile"`
+	Window       time.Duration `json:"-"`
+	Threshold    float64       `json:"threshold"`
+	Contribution float64       `json:"contribution"`
+}
+
+// UnmarshalJSON reads Window as a Go duration string (e.g. "5m").
+func (r *ExcessRule) UnmarshalJSON(b []byte) error {
+	type plain ExcessRule
+	aux := struct {
+		*plain
+		Window string `json:"window"`
+	}{plain: (*plain)(r)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	window, err := time.ParseDuration(aux.Window)
+	if err != nil {
+		return fmt.Errorf("rule %s: invalid window %q: %w", r.Topic, aux.Window, err)
+	}
+	r.Window = window
+	return nil
+}
+
+// ExcessGroup sums its rules' contributions and caps the total at Cap (0 = uncapped).
+type ExcessGroup struct {
+	Name  string       `json:"name"`
+	Rules []ExcessRule `json:"rules"`
+	Cap   float64      `json:"cap"`
+}
+
+// ExcessPolicy is the per-site description of how much power dump loads may use.
+// Group totals are summed, then capped at MaxWatts (0 = uncapped).
+type ExcessPolicy struct {
+	Groups   []ExcessGroup `json:"groups"`
+	MaxWatts float64       `json:"max_watts"`
+}
+
+// DefaultExcessPolicy: batteries contribute up to 900W (Tesla > 4kWh → 1000W,
+// Battery 2 > 2.5kWh → 450W), plus 1000W while Solar 1 is above 1kW.
+var DefaultExcessPolicy = ExcessPolicy{
+	Groups: []ExcessGroup{
+		{
+			Name: "Batteries",
+			Rules: []ExcessRule{
+				{TopicBattery1Energy, stats.P50, stats.Window5Min, 4000, 1000}, // Wh (converted from kWh in statsWorker)
+				{TopicBattery2Energy, stats.P50, stats.Window5Min, 2500, 450},
+			},
+			Cap: 900,
+		},
+		{
+			Name: "Solar",
+			Rules: []ExcessRule{
+				{TopicSolar1Power, stats.P50, stats.Window5Min, 1000, 1000},
+			},
+		},
+	},
+}
+
+// LoadExcessPolicy reads an ExcessPolicy from a JSON file.
+func LoadExcessPolicy(path string) (ExcessPolicy, error) {
+	var policy ExcessPolicy
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return policy, err
+	}
+	if err := json.Unmarshal(b, &policy); err != nil {
+		return policy, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for _, group := range policy.Groups {
+		for _, rule := range group.Rules {
+			if rule.Topic == "" || rule.Window <= 0 {
+				return policy, fmt.Errorf("group %q: rule needs a topic and a positive window", group.Name)
+			}
+		}
+	}
+	return policy, nil
+}
+
+// Topics returns all topics needed for power excess calculation
+func (p ExcessPolicy) Topics() []string {
+	var topics []string
+	for _, group := range p.Groups {
+		for _, rule := range group.Rules {
+			topics = append(topics, rule.Topic)
+		}
+	}
+	return topics
+}
+
+// RegisterPercentiles registers each rule's percentile/window with the stats worker.
+// Must be called before statsWorker starts.
+func (p ExcessPolicy) RegisterPercentiles() {
+	for _, group := range p.Groups {
+		for _, rule := range group.Rules {
+			registerPercentile(rule.Topic, PercentileSpec{rule.Percentile, rule.Window})
+		}
+	}
+}
+
+// Evaluate returns the excess watts available for dump loads.
+func (p ExcessPolicy) Evaluate(data DisplayData) float64 {
+	var excessWatts float64
+	for _, group := range p.Groups {
+		var groupWatts float64
+		for _, rule := range group.Rules {
+			if data.GetPercentile(rule.Topic, rule.Percentile, rule.Window) > rule.Threshold {
+				groupWatts += rule.Contribution
+			}
+		}
+		if group.Cap > 0 {
+			groupWatts = min(groupWatts, group.Cap)
+		}
+		excessWatts += groupWatts
+	}
+	if p.MaxWatts > 0 {
+		excessWatts = min(excessWatts, p.MaxWatts)
+	}
+	return excessWatts
+}
+
+// powerExcessCalculator calculates excess power available for dump loads
+func powerExcessCalculator(
+	ctx context.Context,
+	dataChan <-chan DisplayData,
+	excessChan chan<- float64,
+	policy ExcessPolicy,
+) {
+	log.Println("Power excess calculator started")
+
+	for {
+		select {
+		case data := <-dataChan:
+			excessWatts := policy.Evaluate(data)
+
+			// Send excess to downstream worker
+			select {
+			case excessChan <- excessWatts:
+			case <-ctx.Done():
+				return
+			}
+
+		case <-ctx.Done():
+			log.Println("Power excess calculator stopped")
+			return
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package workers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ryansname/powerctl/internal/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeExcessData(tesla, battery2, solar1 float64) DisplayData {
+	return DisplayData{
+		TopicData: map[string]any{},
+		Percentiles: map[PercentileKey]float64{
+			{TopicBattery1Energy, stats.P50, stats.Window5Min}: tesla,
+			{TopicBattery2Energy, stats.P50, stats.Window5Min}: battery2,
+			{TopicSolar1Power, stats.P50, stats.Window5Min}:    solar1,
+		},
+	}
+}
+
+func TestDefaultExcessPolicy(t *testing.T) {
+	p := DefaultExcessPolicy
+	assert.InDelta(t, 0.0, p.Evaluate(makeExcessData(3000, 2000, 500)), 1e-9)
+	assert.InDelta(t, 450.0, p.Evaluate(makeExcessData(3000, 3000, 500)), 1e-9)
+	// Both batteries: 1450W capped at 900W
+	assert.InDelta(t, 900.0, p.Evaluate(makeExcessData(5000, 3000, 500)), 1e-9)
+	assert.InDelta(t, 1900.0, p.Evaluate(makeExcessData(5000, 3000, 1500)), 1e-9)
+}
+
+func TestExcessPolicy_MaxWatts(t *testing.T) {
+	p := DefaultExcessPolicy
+	p.MaxWatts = 1200
+	assert.InDelta(t, 1200.0, p.Evaluate(makeExcessData(5000, 3000, 1500)), 1e-9)
+}
+
+func TestLoadExcessPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	err := os.WriteFile(path, []byte(`{
+		"groups": [{
+			"name": "Solar",
+			"rules": [{"topic": "homeassistant/sensor/solar_1_power/state", "percentile": 90,
+				"window": "15m", "threshold": 2000, "contribution": 1500}]
+		}],
+		"max_watts": 1000
+	}`), 0o600)
+	assert.NoError(t, err)
+
+	p, err := LoadExcessPolicy(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 1000.0, p.MaxWatts)
+	assert.Equal(t, ExcessRule{TopicSolar1Power, stats.P90, 15 * time.Minute, 2000, 1500}, p.Groups[0].Rules[0])
+	assert.Equal(t, []string{TopicSolar1Power}, p.Topics())
+}
+
+func TestLoadExcessPolicy_InvalidWindow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	err := os.WriteFile(path, []byte(`{"groups": [{"rules": [{"topic": "x", "window": "soon"}]}]}`), 0o600)
+	assert.NoError(t, err)
+
+	_, err = LoadExcessPolicy(path)
+	assert.Error(t, err)
+}
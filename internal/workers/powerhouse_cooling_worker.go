@@ -1,10 +1,11 @@
-package main
+package workers
 
 import (
 	"context"
 	"log"
+	"time"
 
-	"github.com/ryansname/powerctl/src/governor"
+	"github.com/ryansname/powerctl/governor"
 )
 
 // TopicPowerhouseBlowerTemp is the temperature sensor for the powerhouse blower.
@@ -36,7 +37,7 @@ func powerhouseCoolingWorker(ctx context.Context, dataChan <-chan DisplayData, s
 		case data := <-dataChan:
 			// Update called before Max() so tracker always has current temp on first tick.
 			// statsWorker guarantees temperature topic has a real value before first broadcast.
-			tracker.Update(data.GetFloat(TopicPowerhouseBlowerTemp).Current)
+			tracker.Update(data.GetFloat(TopicPowerhouseBlowerTemp).Current, time.Now())
 			tempMax := tracker.Max()
 			cooling := data.GetBoolean(TopicPowerhouseBlowerSwitch0State)
 
@@ -1,9 +1,12 @@
-package main
+package workers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"os"
 	"time"
 )
 
@@ -23,10 +26,17 @@ const (
 	PW2DischargeModeForceOff = "Force Off"
 )
 
-const pw2SiteID = "2233628"
 const pw2OperationModeEntity = "select.home_sweet_home_operation_mode"
+
 const pw2BackupReserveEntity = "number.home_sweet_home_backup_reserve"
-const pw2TimeBasedControl = "Time-Based Control" //nolint:gosec // operation mode label, not a secret
+
+const pw2TimeBasedControl = "Time-Based Control"
+
+//nolint:gosec // operation mode label, not a secret
+
+// pw2DefaultReserve is the backup reserve (%) restored when discharge stops and no
+// vote holds a reserve floor.
+const pw2DefaultReserve = 10.0
 
 // propagationWindow is how long the arbiter waits after sending a command before
 // re-issuing the same intent — gives Tesla time to update its operation mode. An
@@ -49,6 +59,10 @@ type DischargeRequest struct {
 	Source string
 	Want   DischargeVote
 	Reason string
+
+	// ReserveFloor is a backup reserve (%) to hold while discharge isn't intended, e.g.
+	// above SOC to charge from the grid. 0 for none; the highest floor wins.
+	ReserveFloor float64
 }
 
 // Tesla TOU tariff wire-format constants.
@@ -158,26 +172,193 @@ func reconcileDischarge(
 	return intentChanged || now.Sub(lastSent) >= propagationWindow
 }
 
+// modeChangeTimeout is how long Activating/Deactivating may wait for HA to reflect the
+// new operation mode before the arbiter reports it (it keeps retrying regardless).
+const modeChangeTimeout = 5 * time.Minute
+
+// touRefreshInterval is how often the discharge tariff is re-sent while discharging.
+const touRefreshInterval = time.Hour
+
+// dischargeStateSensorID is the powerctl sensor showing the arbiter's DischargePhase.
+const dischargeStateSensorID = "powerctl_pw2_discharge_state"
+
+// TopicPW2DischargeState is the retained state topic of the discharge state sensor.
+const TopicPW2DischargeState = "powerctl/sensor/" + dischargeStateSensorID + "/state"
+
+// DischargePhase is where the arbiter is in driving the Powerwall's operation mode.
+type DischargePhase int
+
+const (
+	PhaseIdle         DischargePhase = iota // not discharging (or passive)
+	PhaseActivating                         // start sent, waiting for Time-Based Control
+	PhaseDischarging                        // Time-Based Control confirmed
+	PhaseDeactivating                       // stop sent, waiting for it to clear
+)
+
+// dischargePhaseNames are the sensor states, indexed by DischargePhase.
+var dischargePhaseNames = []string{"Idle", "Activating", "Discharging", "Deactivating"}
+
+func (p DischargePhase) String() string {
+	return dischargePhaseNames[p]
+}
+
+// dischargeAction is the command a DischargeMachine step asks for.
+type dischargeAction int
+
+const (
+	actionNone dischargeAction = iota
+	actionStart
+	actionStop
+	actionRefresh // re-send the discharge tariff
+)
+
+// DischargeMachine tracks the arbiter's phase between ticks.
+type DischargeMachine struct {
+	Phase DischargePhase
+	Since time.Time // when Phase was entered
+
+	lastSent        time.Time // last start/stop command
+	sentOn          bool      // whether the last command was a start
+	lastRefresh     time.Time
+	timeoutReported bool
+}
+
+// enter moves to phase; staying in the same phase keeps Since.
+func (m *DischargeMachine) enter(phase DischargePhase, now time.Time) {
+	if phase != m.Phase {
+		m.Phase, m.Since, m.timeoutReported = phase, now, false
+	}
+}
+
+// Step advances the machine for this tick's intent and whether the Powerwall is in
+// Time-Based Control, and returns the command to send.
+//
+// Passive stops a discharge the arbiter started (once) and then leaves the Powerwall
+// alone. Otherwise commands follow reconcileDischarge: an intent change fires at once,
+// and a mode HA hasn't reflected is re-sent every propagationWindow.
+func (m *DischargeMachine) Step(intent DischargeIntent, actual bool, now time.Time) dischargeAction {
+	if intent == IntentPassive {
+		m.enter(PhaseIdle, now)
+		if !m.sentOn {
+			return actionNone
+		}
+		m.lastSent, m.sentOn = now, false
+		return actionStop
+	}
+
+	desired := intent == IntentOn
+	if reconcileDischarge(desired, actual, m.sentOn, m.lastSent, now) {
+		m.lastSent, m.sentOn = now, desired
+		if desired {
+			m.enter(PhaseActivating, now)
+			m.lastRefresh = now
+			return actionStart
+		}
+		m.enter(PhaseDeactivating, now)
+		return actionStop
+	}
+
+	switch {
+	case desired && actual:
+		m.enter(PhaseDischarging, now)
+		if now.Sub(m.lastRefresh) >= touRefreshInterval {
+			m.lastRefresh = now
+			return actionRefresh
+		}
+	case !desired && !actual:
+		m.enter(PhaseIdle, now)
+	}
+	return actionNone
+}
+
+// TimedOut reports, once per phase, that Activating or Deactivating has waited
+// modeChangeTimeout without HA reflecting the new mode.
+func (m *DischargeMachine) TimedOut(now time.Time) bool {
+	if m.timeoutReported || (m.Phase != PhaseActivating && m.Phase != PhaseDeactivating) {
+		return false
+	}
+	if now.Sub(m.Since) < modeChangeTimeout {
+		return false
+	}
+	m.timeoutReported = true
+	return true
+}
+
+// reserveFloor returns the highest ReserveFloor among votes, 0 if none.
+func reserveFloor(votes map[string]DischargeRequest) float64 {
+	var floor float64
+	for _, req := range votes {
+		floor = max(floor, req.ReserveFloor)
+	}
+	return floor
+}
+
+// reconcileReserve decides whether to set the backup reserve this tick while discharge
+// isn't intended. held is the floor last applied (0 if none). Returns the reserve to
+// set, or 0. Released floors are restored to the default only if nobody has changed the
+// reserve since.
+func reconcileReserve(floor, held, actual float64, lastSent, now time.Time) float64 {
+	if now.Sub(lastSent) < propagationWindow {
+		return 0
+	}
+	if floor > 0 {
+		if actual != floor {
+			return floor
+		}
+		return 0
+	}
+	if held > 0 && actual == held {
+		return pw2DefaultReserve
+	}
+	return 0
+}
+
 // dischargeArbiter holds per-source votes, reads the user-facing select mode, and
-// reconciles the Powerwall 2 operation mode to match the merged desired state.
-// Replaces the old edge-detection switch worker: state-based eventual consistency
-// means a toggle made during the propagation window is never lost.
+// reconciles the Powerwall 2 operation mode to match the merged desired state through
+// a DischargeMachine, publishing its phase to TopicPW2DischargeState. State-based
+// eventual consistency means a toggle made during the propagation window is never lost.
 func dischargeArbiter(
 	ctx context.Context,
 	dataChan <-chan DisplayData,
 	voteChan <-chan DischargeRequest,
 	sender *MQTTSender,
+	tesla TeslaClient,
+	audit *AuditLog,
+	tariff TOUTariffConfig,
 ) {
 	log.Println("Discharge arbiter started")
 
 	votes := make(map[string]DischargeRequest)
-	var lastSent time.Time
-	var lastSentDesired bool
-	var lastTOURefresh time.Time
+	machine := &DischargeMachine{}
+	published := false
 	var lastReason string
+	var heldReserve float64 // reserve floor last applied, 0 if none
+	var lastReserveSent time.Time
+
+	// holdReserve applies the votes' reserve floor while discharge isn't intended, and
+	// restores the default reserve once the floor is released
+	holdReserve := func(floor, backupReserve float64, now time.Time) {
+		if floor == 0 && backupReserve != heldReserve {
+			heldReserve = 0 // changed by someone else, leave it
+		}
+		set := reconcileReserve(floor, heldReserve, backupReserve, lastReserveSent, now)
+		if set == 0 {
+			return
+		}
+		log.Printf("Discharge arbiter: setting backup reserve to %.0f%%\n", set)
+		if err := tesla.SetBackupReserve(set); err != nil {
+			log.Printf("Discharge arbiter: set backup reserve: %v\n", err)
+		}
+		audit.Record("discharge-arbiter", fmt.Sprintf("backup reserve %.0f%%", set),
+			map[string]float64{"backup_reserve": backupReserve, "floor": floor})
+		lastReserveSent = now
+		heldReserve = floor
+	}
 
 	log.Println("Discharge arbiter: sending initial Octopus tariff")
-	sendOctopusTariff(sender)
+	if err := sendOctopusTariff(tesla); err != nil {
+		log.Printf("Discharge arbiter: initial tariff failed: %v\n", err)
+	}
 
 	for {
 		select {
@@ -185,8 +366,14 @@ func dischargeArbiter(
 			userMode := data.GetString(TopicPW2DischargeMode)
 			currentMode := data.GetString(TopicPW2OperationMode)
 			backupReserve := data.GetFloat(TopicPW2BackupReserve).Current
+			var livePrice float64
+			if tariff.PriceTopic != "" {
+				livePrice = data.GetFloat(tariff.PriceTopic).Current
+			}
 
 			intent, reason := decideDischarge(userMode, votes)
+			floor := reserveFloor(votes)
+			restReserve := max(pw2DefaultReserve, floor)
 			now := time.Now()
 
 			if reason != lastReason {
@@ -194,39 +381,56 @@ func dischargeArbiter(
 				lastReason = reason
 			}
 
-			if intent == IntentPassive {
-				// covers: DISCHARGE-PASSIVE-2 — one-shot cleanup when transitioning
-				// into Passive from a prior commanded On so the discharge tariff
-				// doesn't linger. lastSentDesired flips to false after cleanup, so
-				// subsequent passive ticks are no-ops and external Tesla-app
-				// changes stick (DISCHARGE-PASSIVE-1).
-				if lastSentDesired {
-					log.Println("Discharge arbiter: entering Passive, running stopDischarge cleanup")
-					stopDischarge(sender)
-					requestModeUpdate(sender)
-					lastSent = now
-					lastSentDesired = false
-				}
-				continue
-			}
-
-			desired := intent == IntentOn
+			prevPhase := machine.Phase
 			actual := currentMode == pw2TimeBasedControl
-
-			if reconcileDischarge(desired, actual, lastSentDesired, lastSent, now) {
-				if desired {
-					startDischarge(sender, backupReserve)
-					lastTOURefresh = now
-				} else {
-					stopDischarge(sender)
+			switch machine.Step(intent, actual, now) {
+			case actionStart:
+				if err := startDischarge(tesla, backupReserve, buildTOUTariff(tariff, now, livePrice)); err != nil {
+					log.Printf("Discharge arbiter: start discharge: %v\n", err)
+				}
+				requestModeUpdate(sender)
+				audit.Record("discharge-arbiter", "start discharge ("+reason+")",
+					map[string]float64{"backup_reserve": backupReserve})
+			case actionStop:
+				// Passive runs this once, when it follows a commanded On, so the
+				// discharge tariff doesn't linger (DISCHARGE-PASSIVE-2); after that
+				// external Tesla-app changes stick (DISCHARGE-PASSIVE-1)
+				if err := stopDischarge(tesla, restReserve); err != nil {
+					log.Printf("Discharge arbiter: stop discharge: %v\n", err)
 				}
+				heldReserve, lastReserveSent = floor, now
 				requestModeUpdate(sender)
-				lastSent = now
-				lastSentDesired = desired
-			} else if desired && actual && time.Since(lastTOURefresh) >= time.Hour {
+				audit.Record("discharge-arbiter", "stop discharge ("+reason+")",
+					map[string]float64{"backup_reserve": backupReserve})
+			case actionRefresh:
 				log.Println("Discharge arbiter: refreshing discharge state")
-				startDischarge(sender, backupReserve)
-				lastTOURefresh = now
+				if err := startDischarge(tesla, backupReserve, buildTOUTariff(tariff, now, livePrice)); err != nil {
+					log.Printf("Discharge arbiter: refresh discharge: %v\n", err)
+				}
+			}
+
+			if machine.Phase != prevPhase {
+				log.Printf("Discharge arbiter: %v -> %v (%s)\n", prevPhase, machine.Phase, reason)
+			}
+			if machine.Phase != prevPhase || !published {
+				sender.Send(MQTTMessage{
+					Topic:   TopicPW2DischargeState,
+					Payload: []byte(machine.Phase.String()),
+					QoS:     1,
+					Retain:  true,
+				})
+				published = true
+			}
+			if machine.TimedOut(now) {
+				log.Printf("Discharge arbiter: WARNING: %v for %v, operation mode still %q\n",
+					machine.Phase, modeChangeTimeout, currentMode)
+				audit.Record("discharge-arbiter", fmt.Sprintf("%v timed out (mode %q)", machine.Phase, currentMode), nil)
+			}
+
+			if intent == IntentOn {
+				heldReserve = 0 // discharge manages the reserve itself
+			} else {
+				holdReserve(floor, backupReserve, now)
 			}
 
 		case req := <-voteChan:
@@ -244,66 +448,35 @@ func requestModeUpdate(sender *MQTTSender) {
 	sender.CallService("homeassistant", "update_entity", pw2OperationModeEntity, nil)
 }
 
-// stopDischarge restores self-consumption mode with no battery export and resets the tariff.
-func stopDischarge(sender *MQTTSender) {
-	sendOctopusTariff(sender)
-	sendTeslaAPI(sender, "OPERATION_MODE", map[string]any{
-		"default_real_mode": "self_consumption",
-	})
-	sendTeslaAPI(sender, "ENERGY_SITE_IMPORT_EXPORT_CONFIG", map[string]any{
-		"customer_preferred_export_rule": "never",
-	})
-	setBackupReserve(sender, 10)
+// stopDischarge restores self-consumption mode with no battery export, resets the tariff
+// and sets the backup reserve. Every command is attempted; the errors are joined.
+func stopDischarge(tesla TeslaClient, reserve float64) error {
+	return errors.Join(
+		sendOctopusTariff(tesla),
+		tesla.SetOperationMode(TeslaModeSelfConsumption),
+		tesla.SetExportRule(TeslaExportNever),
+		tesla.SetBackupReserve(reserve),
+	)
 }
 
-// startDischarge pushes a TOU tariff and sets autonomous mode with battery export.
-func startDischarge(sender *MQTTSender, currentReserve float64) {
-	sendTOUTariff(sender)
-	sendTeslaAPI(sender, "OPERATION_MODE", map[string]any{
-		"default_real_mode": "autonomous",
-	})
-	sendTeslaAPI(sender, "ENERGY_SITE_IMPORT_EXPORT_CONFIG", map[string]any{
-		"customer_preferred_export_rule": "battery_ok",
-	})
+// startDischarge pushes the discharge tariff (see buildTOUTariff) and sets autonomous
+// mode with battery export. Every command is attempted; the errors are joined.
+func startDischarge(tesla TeslaClient, currentReserve float64, tariff map[string]any) error {
 	nudgeReserve := 22.0
 	if currentReserve != 21 {
 		nudgeReserve = 21.0
 	}
-	setBackupReserve(sender, nudgeReserve)
-}
-
-// setBackupReserve sets the Powerwall backup reserve percentage via HA.
-func setBackupReserve(sender *MQTTSender, percent float64) {
-	sender.CallService("number", "set_value", pw2BackupReserveEntity, map[string]any{
-		tariffKeyValue: percent,
-	})
-}
-
-// sendTeslaAPI sends a tesla_custom.api service call via the Node-RED proxy.
-// Body fields are merged into parameters alongside path_vars, since the
-// tesla_custom service pops path_vars and passes the rest as kwargs.
-func sendTeslaAPI(sender *MQTTSender, command string, body map[string]any) {
-	params := map[string]any{
-		"path_vars": map[string]any{
-			"site_id": pw2SiteID,
-		},
-	}
-	for k, v := range body {
-		params[k] = v
-	}
-	sender.CallService("tesla_custom", "api", "", map[string]any{
-		"command":    command,
-		"parameters": params,
-	})
+	return errors.Join(
+		tesla.SetTOUTariff(tariff),
+		tesla.SetOperationMode(TeslaModeAutonomous),
+		tesla.SetExportRule(TeslaExportBatteryOK),
+		tesla.SetBackupReserve(nudgeReserve),
+	)
 }
 
 // sendOctopusTariff restores the Octopus/Vector pricing schedule to the Powerwall.
-func sendOctopusTariff(sender *MQTTSender) {
-	sendTeslaAPI(sender, "TIME_OF_USE_SETTINGS", map[string]any{
-		"tou_settings": map[string]any{
-			"tariff_content_v2": buildOctopusTariff(),
-		},
-	})
+func sendOctopusTariff(tesla TeslaClient) error {
+	return tesla.SetTOUTariff(buildOctopusTariff())
 }
 
 // buildOctopusTariff returns the tariff_content_v2 for the Octopus/Vector residential plan.
@@ -486,24 +659,106 @@ func buildOctopusTariff() map[string]any {
 	}
 }
 
-// sendTOUTariff generates and sends a TOU tariff with ON_PEAK now and SUPER_OFF_PEAK later.
-func sendTOUTariff(sender *MQTTSender) {
-	tariff := buildTOUTariff(time.Now())
-	sendTeslaAPI(sender, "TIME_OF_USE_SETTINGS", map[string]any{
-		"tou_settings": map[string]any{
-			"tariff_content_v2": tariff,
-		},
-	})
+// TOUTariffConfig is the template for the discharge tariff: ON_PEAK from now for
+// PeakDuration, SUPER_OFF_PEAK for the rest of the day. Rates are per kWh.
+type TOUTariffConfig struct {
+	Name         string        `json:"name"` // Shown in the Tesla app, with the start time appended
+	Utility      string        `json:"utility"`
+	Currency     string        `json:"currency"`
+	BuyPeak      float64       `json:"buy_peak"`
+	BuyOffPeak   float64       `json:"buy_off_peak"`
+	SellPeak     float64       `json:"sell_peak"`
+	SellOffPeak  float64       `json:"sell_off_peak"`
+	PeakDuration time.Duration `json:"-"` // Rounded to the half hour
+
+	// PriceTopic, if set, is a live price sensor the peak rates follow instead of
+	// BuyPeak/SellPeak (never below the off-peak rates, which Tesla would reject).
+	PriceTopic string `json:"price_topic"`
+}
+
+// DefaultTOUTariffConfig sells at 0.30 for 90 minutes.
+var DefaultTOUTariffConfig = TOUTariffConfig{
+	Name:         "Powerctl Discharge",
+	Utility:      tariffUtilityCustom,
+	Currency:     "USD",
+	BuyPeak:      0.31,
+	BuyOffPeak:   0.07,
+	SellPeak:     0.30,
+	SellOffPeak:  0.07,
+	PeakDuration: 90 * time.Minute,
+}
+
+// UnmarshalJSON reads PeakDuration as a Go duration string (e.g. "90m").
+func (c *TOUTariffConfig) UnmarshalJSON(b []byte) error {
+	type plain TOUTariffConfig
+	aux := struct {
+		*plain
+		PeakDuration string `json:"peak_duration"`
+	}{plain: (*plain)(c)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	if aux.PeakDuration == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(aux.PeakDuration)
+	if err != nil {
+		return fmt.Errorf("invalid peak_duration %q: %w", aux.PeakDuration, err)
+	}
+	c.PeakDuration = d
+	return nil
+}
+
+// Validate reports values Tesla would reject or that leave no off-peak time.
+func (c TOUTariffConfig) Validate() error {
+	var errs []error
+	if c.Currency == "" || c.Utility == "" {
+		errs = append(errs, errors.New("currency and utility are required"))
+	}
+	if c.BuyOffPeak < 0 || c.SellOffPeak < 0 {
+		errs = append(errs, errors.New("rates must not be negative"))
+	}
+	if c.BuyPeak < c.BuyOffPeak || c.SellPeak < c.SellOffPeak {
+		errs = append(errs, errors.New("peak rates must not be below off-peak rates"))
+	}
+	if c.PeakDuration < 30*time.Minute || c.PeakDuration > 23*time.Hour {
+		errs = append(errs, fmt.Errorf("peak duration %v must be between 30m and 23h", c.PeakDuration))
+	}
+	return errors.Join(errs...)
+}
+
+// LoadTOUTariffConfig reads a TOUTariffConfig from a JSON file. Fields it leaves out
+// keep their DefaultTOUTariffConfig values.
+func LoadTOUTariffConfig(path string) (TOUTariffConfig, error) {
+	config := DefaultTOUTariffConfig
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(b, &config); err != nil {
+		return config, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return config, config.Validate()
 }
 
-// buildTOUTariff creates a tariff_content_v2 structure with ON_PEAK for ~90 minutes
-// from the current time and SUPER_OFF_PEAK for the remaining hours.
-// Start rounds down to nearest 30min, end rounds to nearest 30min from now+90min.
-// Wrapping (toHour < fromHour) is valid and covers the full 24 hours.
-func buildTOUTariff(now time.Time) map[string]any {
+// peakRates returns the ON_PEAK buy and sell rates, following livePrice when
+// PriceTopic is set.
+func (c TOUTariffConfig) peakRates(livePrice float64) (buy, sell float64) {
+	if c.PriceTopic == "" {
+		return c.BuyPeak, c.SellPeak
+	}
+	return max(livePrice, c.BuyOffPeak), max(livePrice, c.SellOffPeak)
+}
+
+// buildTOUTariff creates a tariff_content_v2 structure with ON_PEAK for
+// config.PeakDuration from the current time and SUPER_OFF_PEAK for the remaining hours.
+// Start rounds down to nearest 30min, end rounds to nearest 30min from now+PeakDuration.
+// Wrapping (toHour < fromHour) is valid and covers the full 24 hours. livePrice is
+// only used with config.PriceTopic set.
+func buildTOUTariff(config TOUTariffConfig, now time.Time, livePrice float64) map[string]any {
 	totalMin := now.Hour()*60 + now.Minute()
 	startMin := totalMin / 30 * 30
-	endMin := (totalMin + 90 + 15) / 30 * 30
+	endMin := (totalMin + int(config.PeakDuration.Minutes()) + 15) / 30 * 30
 	onPeakStartHour := (startMin / 60) % 24
 	onPeakStartMin := startMin % 60
 	onPeakEndHour := (endMin / 60) % 24
@@ -550,22 +805,23 @@ func buildTOUTariff(now time.Time) map[string]any {
 		seasonAllYear: map[string]any{tariffKeyRates: map[string]any{}},
 	}
 
+	buyPeak, sellPeak := config.peakRates(livePrice)
 	buyRates := map[string]any{
 		bandALL:       map[string]any{tariffKeyRates: map[string]any{bandALL: 0}},
-		seasonAllYear: map[string]any{tariffKeyRates: map[string]any{bandOnPeak: 0.31, bandSuperOffPeak: 0.07}},
+		seasonAllYear: map[string]any{tariffKeyRates: map[string]any{bandOnPeak: buyPeak, bandSuperOffPeak: config.BuyOffPeak}},
 	}
 
 	sellRates := map[string]any{
 		bandALL:       map[string]any{tariffKeyRates: map[string]any{bandALL: 0}},
-		seasonAllYear: map[string]any{tariffKeyRates: map[string]any{bandOnPeak: 0.30, bandSuperOffPeak: 0.07}},
+		seasonAllYear: map[string]any{tariffKeyRates: map[string]any{bandOnPeak: sellPeak, bandSuperOffPeak: config.SellOffPeak}},
 	}
 
 	return map[string]any{
 		"version":                    1,
-		tariffKeyUtility:             tariffUtilityCustom,
+		tariffKeyUtility:             config.Utility,
 		"code":                       "CUSTOM-EXPORT",
-		"name":                       fmt.Sprintf("Powerctl Discharge (%s)", now.Format("15:04")),
-		"currency":                   "USD",
+		"name":                       fmt.Sprintf("%s (%s)", config.Name, now.Format("15:04")),
+		"currency":                   config.Currency,
 		tariffKeyMonthlyMinimumBill:  0,
 		tariffKeyMinApplicableDemand: 0,
 		tariffKeyMaxApplicableDemand: 0,
@@ -578,7 +834,7 @@ func buildTOUTariff(now time.Time) map[string]any {
 			seasonAllYear: season,
 		},
 		"sell_tariff": map[string]any{
-			tariffKeyUtility:             tariffUtilityCustom,
+			tariffKeyUtility:             config.Utility,
 			tariffKeyMonthlyMinimumBill:  0,
 			tariffKeyMinApplicableDemand: 0,
 			tariffKeyMaxApplicableDemand: 0,
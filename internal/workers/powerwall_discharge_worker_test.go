@@ -1,6 +1,8 @@
-package main
+package workers
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -9,8 +11,8 @@ import (
 )
 
 const (
-	testSourcePeak   = "peak-power"
-	testReasonSOC92  = "SOC 92%"
+	testSourcePeak  = "peak-power"
+	testReasonSOC92 = "SOC 92%"
 )
 
 // covers: DISCHARGE-USER-3
@@ -316,7 +318,7 @@ func TestBuildTOUTariffPeakWindow(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			now := time.Date(2026, 1, 1, tt.hour, tt.min, 0, 0, time.UTC)
-			tariff := buildTOUTariff(now)
+			tariff := buildTOUTariff(DefaultTOUTariffConfig, now, 0)
 
 			seasons, ok := tariff["seasons"].(map[string]any)
 			if !ok {
@@ -354,3 +356,145 @@ func TestBuildTOUTariffPeakWindow(t *testing.T) {
 		})
 	}
 }
+
+// touRate returns a band's AllYear rate from the buy tariff, or the sell tariff with sell set.
+func touRate(t *testing.T, tariff map[string]any, sell bool, band string) any {
+	if sell {
+		tariff = tariff["sell_tariff"].(map[string]any)
+	}
+	charges := tariff[tariffKeyEnergyCharges].(map[string]any)[seasonAllYear].(map[string]any)
+	return charges[tariffKeyRates].(map[string]any)[band]
+}
+
+func TestBuildTOUTariff_UsesConfig(t *testing.T) {
+	config := DefaultTOUTariffConfig
+	config.Name, config.Currency, config.Utility = "Sellback", "NZD", "Octopus"
+	config.BuyPeak, config.SellPeak, config.SellOffPeak = 0.45, 0.40, 0.10
+	config.PeakDuration = 2 * time.Hour
+
+	tariff := buildTOUTariff(config, time.Date(2026, 1, 1, 3, 0, 0, 0, time.UTC), 0)
+	assert.Equal(t, "Sellback (03:00)", tariff["name"])
+	assert.Equal(t, "NZD", tariff["currency"])
+	assert.Equal(t, "Octopus", tariff[tariffKeyUtility])
+	assert.Equal(t, 0.45, touRate(t, tariff, false, bandOnPeak))
+	assert.Equal(t, 0.40, touRate(t, tariff, true, bandOnPeak))
+	assert.Equal(t, 0.10, touRate(t, tariff, true, bandSuperOffPeak))
+
+	seasons := tariff[tariffKeySeasons].(map[string]any)[seasonAllYear].(map[string]any)
+	onPeak := seasons["tou_periods"].(map[string]any)[bandOnPeak].(map[string]any)
+	period := onPeak[tariffKeyPeriods].([]any)[0].(map[string]any)
+	assert.Equal(t, 5, period[tariffKeyToHour], "2h peak")
+}
+
+func TestBuildTOUTariff_LivePrice(t *testing.T) {
+	config := DefaultTOUTariffConfig
+	config.PriceTopic = "homeassistant/sensor/export_price/state"
+	now := time.Date(2026, 1, 1, 17, 0, 0, 0, time.UTC)
+
+	tariff := buildTOUTariff(config, now, 0.52)
+	assert.Equal(t, 0.52, touRate(t, tariff, false, bandOnPeak))
+	assert.Equal(t, 0.52, touRate(t, tariff, true, bandOnPeak))
+
+	// Below off-peak: clamped so Tesla keeps ON_PEAK ≥ SUPER_OFF_PEAK
+	tariff = buildTOUTariff(config, now, -0.05)
+	assert.Equal(t, config.SellOffPeak, touRate(t, tariff, true, bandOnPeak))
+}
+
+func TestLoadTOUTariffConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tariff.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"currency": "NZD", "sell_peak": 0.35, "peak_duration": "2h"}`), 0o600))
+	config, err := LoadTOUTariffConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "NZD", config.Currency)
+	assert.Equal(t, 0.35, config.SellPeak)
+	assert.Equal(t, 2*time.Hour, config.PeakDuration)
+	assert.Equal(t, DefaultTOUTariffConfig.BuyPeak, config.BuyPeak, "missing fields keep defaults")
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"sell_peak": 0.01}`), 0o600))
+	_, err = LoadTOUTariffConfig(path)
+	assert.Error(t, err, "peak below off-peak")
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"peak_duration": "soon"}`), 0o600))
+	_, err = LoadTOUTariffConfig(path)
+	assert.Error(t, err)
+}
+
+// covers: DISCHARGE-RESERVE-1
+func TestReconcileReserve_HoldsHighestFloor(t *testing.T) {
+	votes := map[string]DischargeRequest{
+		"grid-charge": {Source: "grid-charge", Want: VoteOff, ReserveFloor: 80},
+		"other":       {Source: "other", Want: VoteOff, ReserveFloor: 30},
+	}
+	floor := reserveFloor(votes)
+	assert.Equal(t, 80.0, floor)
+
+	now := time.Now()
+	assert.Equal(t, 80.0, reconcileReserve(floor, 0, 10, time.Time{}, now))
+	assert.Equal(t, 0.0, reconcileReserve(floor, 80, 10, now.Add(-10*time.Second), now), "within propagation window")
+	assert.Equal(t, 0.0, reconcileReserve(floor, 80, 80, time.Time{}, now))
+}
+
+// covers: DISCHARGE-RESERVE-2
+func TestReconcileReserve_RestoresDefaultOnlyIfUnchanged(t *testing.T) {
+	now := time.Now()
+	assert.Equal(t, pw2DefaultReserve, reconcileReserve(0, 80, 80, time.Time{}, now))
+	assert.Equal(t, 0.0, reconcileReserve(0, 0, 60, time.Time{}, now), "changed in the Tesla app")
+}
+
+// covers: DISCHARGE-STATE-1, DISCHARGE-RECON-4, DISCHARGE-RECON-5
+func TestDischargeMachine_ActivateAndRefresh(t *testing.T) {
+	m := &DischargeMachine{}
+	now := time.Now()
+
+	assert.Equal(t, actionStart, m.Step(IntentOn, false, now))
+	assert.Equal(t, PhaseActivating, m.Phase)
+	assert.Equal(t, actionNone, m.Step(IntentOn, false, now.Add(10*time.Second)), "within propagation window")
+	assert.Equal(t, actionStart, m.Step(IntentOn, false, now.Add(35*time.Second)), "HA hasn't reflected it: retry")
+
+	assert.Equal(t, actionNone, m.Step(IntentOn, true, now.Add(40*time.Second)))
+	assert.Equal(t, PhaseDischarging, m.Phase)
+	assert.Equal(t, actionRefresh, m.Step(IntentOn, true, now.Add(35*time.Second+touRefreshInterval)))
+}
+
+// covers: DISCHARGE-STATE-1, DISCHARGE-RECON-3
+func TestDischargeMachine_Deactivate(t *testing.T) {
+	m := &DischargeMachine{}
+	now := time.Now()
+	m.Step(IntentOn, false, now)
+	m.Step(IntentOn, true, now.Add(time.Second))
+
+	assert.Equal(t, actionStop, m.Step(IntentOff, true, now.Add(2*time.Second)), "intent change fires at once")
+	assert.Equal(t, PhaseDeactivating, m.Phase)
+	assert.Equal(t, actionNone, m.Step(IntentOff, false, now.Add(3*time.Second)))
+	assert.Equal(t, PhaseIdle, m.Phase)
+}
+
+// covers: DISCHARGE-PASSIVE-1, DISCHARGE-PASSIVE-2
+func TestDischargeMachine_PassiveCleansUpOnce(t *testing.T) {
+	m := &DischargeMachine{}
+	now := time.Now()
+	m.Step(IntentOn, false, now)
+
+	assert.Equal(t, actionStop, m.Step(IntentPassive, true, now.Add(time.Second)))
+	assert.Equal(t, PhaseIdle, m.Phase)
+	assert.Equal(t, actionNone, m.Step(IntentPassive, true, now.Add(time.Minute)), "Tesla app change respected")
+
+	// Discharging that powerctl never commanded is left alone too
+	external := &DischargeMachine{}
+	assert.Equal(t, actionNone, external.Step(IntentPassive, true, now))
+}
+
+// covers: DISCHARGE-STATE-2
+func TestDischargeMachine_TimedOutReportsOnce(t *testing.T) {
+	m := &DischargeMachine{}
+	now := time.Now()
+	m.Step(IntentOn, false, now)
+
+	assert.False(t, m.TimedOut(now.Add(modeChangeTimeout-time.Second)))
+	assert.True(t, m.TimedOut(now.Add(modeChangeTimeout)))
+	assert.False(t, m.TimedOut(now.Add(modeChangeTimeout+time.Minute)), "reported once")
+
+	m.Step(IntentOn, true, now.Add(modeChangeTimeout+2*time.Minute))
+	assert.False(t, m.TimedOut(now.Add(time.Hour)), "Discharging doesn't time out")
+}
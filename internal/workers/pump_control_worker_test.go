@@ -1,9 +1,10 @@
-package main
+package workers
 
 import (
 	"testing"
 	"time"
 
+	"github.com/ryansname/powerctl/internal/stats"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -193,8 +194,8 @@ func TestIsFlushMode(t *testing.T) {
 func TestExtractPumpInput(t *testing.T) {
 	data := DisplayData{
 		TopicData: map[string]any{
-			TopicHeaderTankLevelsState: &StringTopicData{Current: `{"percent_full": 68.9}`},
-			TopicPumpSwitchState:       &BooleanTopicData{Current: true, Raw: "on"},
+			TopicHeaderTankLevelsState: &stats.StringTopicData{Current: `{"percent_full": 68.9}`},
+			TopicPumpSwitchState:       &stats.BooleanTopicData{Current: true, Raw: "on"},
 		},
 	}
 	in := ExtractPumpInput(data)
@@ -203,7 +204,7 @@ func TestExtractPumpInput(t *testing.T) {
 	assert.True(t, in.PumpOn)
 
 	// Pre-seeded sentinel marks "no data yet".
-	data.TopicData[TopicHeaderTankLevelsState] = &StringTopicData{Current: `{"percent_full": -1000}`}
+	data.TopicData[TopicHeaderTankLevelsState] = &stats.StringTopicData{Current: `{"percent_full": -1000}`}
 	in = ExtractPumpInput(data)
 	assert.False(t, in.HeaderValid)
 }
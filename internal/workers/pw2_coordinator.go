@@ -0,0 +1,130 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+)
+
+// diyInverterCapSensorID is the debug sensor for the coordinator's Battery 2 inverter cap.
+const diyInverterCapSensorID = "diy_inverter_cap"
+
+// TopicDIYInverterCap is the retained Battery 2 inverter cap published by the PW2
+// coordinator. Baseline control reads it back.
+const TopicDIYInverterCap = "powerctl/sensor/" + diyInverterCapSensorID + "/state"
+
+// TopicPowerwallBatteryPower is the Powerwall 2 battery power (W after conversion,
+// positive discharging).
+const TopicPowerwallBatteryPower = "homeassistant/sensor/home_sweet_home_battery_power_2/state"
+
+// TopicSitePower is the grid power at the Tesla gateway (W after conversion, positive importing).
+const TopicSitePower = "homeassistant/sensor/home_sweet_home_site_power/state"
+
+// PW2CoordinatorConfig configures the coordination between the Powerwall and the Battery 2
+// (DIY) inverters.
+type PW2CoordinatorConfig struct {
+	InverterPowerTopic string  // DIY inverter output (W)
+	MaxInverters       int     // Cap when uncoordinated
+	WattsPerInverter   float64 // Output of one inverter
+	ChargeTolerance    float64 // Powerwall charging (W) below this is ignored
+	// RaiseAfter is how long there must be room for another inverter (Powerwall
+	// discharging or grid importing at least one inverter's worth) before the cap rises.
+	RaiseAfter time.Duration
+}
+
+// Topics returns the statestream topics the coordinator reads.
+func (c PW2CoordinatorConfig) Topics() []string {
+	return []string{TopicPowerwallBatteryPower, TopicSitePower, c.InverterPowerTopic}
+}
+
+// PW2CoordinatorState holds the cap between evaluations.
+type PW2CoordinatorState struct {
+	Cap        int
+	raiseSince time.Time // when room for another inverter was first seen, zero if none
+}
+
+// NewPW2CoordinatorState starts uncapped.
+func NewPW2CoordinatorState(config PW2CoordinatorConfig) *PW2CoordinatorState {
+	return &PW2CoordinatorState{Cap: config.MaxInverters}
+}
+
+// EvaluateDIYInverterCap returns the Battery 2 inverter cap. Whenever the Powerwall
+// charges while DIY inverters run, their output is (at least partly) going into the
+// Powerwall, only to be discharged or exported again later: the cap drops at once by
+// enough inverters to cover the charge. It rises one inverter at a time once there has
+// been room for one for RaiseAfter.
+func EvaluateDIYInverterCap(
+	state *PW2CoordinatorState,
+	config PW2CoordinatorConfig,
+	powerwallPower, sitePower, inverterPower float64,
+	now time.Time,
+) int {
+	charge := -powerwallPower
+	switch {
+	case charge > config.ChargeTolerance && inverterPower > 0:
+		running := int(math.Round(inverterPower / config.WattsPerInverter))
+		excess := int(math.Ceil(min(charge, inverterPower) / config.WattsPerInverter))
+		state.Cap = max(0, min(state.Cap, running-excess))
+		state.raiseSince = time.Time{}
+
+	case state.Cap < config.MaxInverters &&
+		(powerwallPower >= config.WattsPerInverter || sitePower >= config.WattsPerInverter):
+		if state.raiseSince.IsZero() {
+			state.raiseSince = now
+		} else if now.Sub(state.raiseSince) >= config.RaiseAfter {
+			state.Cap++
+			state.raiseSince = now
+		}
+
+	default:
+		state.raiseSince = time.Time{}
+	}
+	return state.Cap
+}
+
+// pw2CoordinatorWorker publishes the Battery 2 inverter cap that keeps the DIY inverters
+// from charging the Powerwall, so the discharge arbiter never exports energy they
+// pushed into it. Baseline control applies the cap; the Powerwall's own discharge
+// (arbiter intent On) is left alone, as it can't absorb while discharging.
+func pw2CoordinatorWorker(
+	ctx context.Context,
+	dataChan <-chan DisplayData,
+	config PW2CoordinatorConfig,
+	sender *MQTTSender,
+	audit *AuditLog,
+) {
+	log.Println("PW2 coordinator started")
+
+	state := NewPW2CoordinatorState(config)
+	for {
+		select {
+		case data := <-dataChan:
+			powerwallPower := data.GetFloat(TopicPowerwallBatteryPower).Current
+			inverterPower := data.GetFloat(config.InverterPowerTopic).Current
+			prev := state.Cap
+			capped := EvaluateDIYInverterCap(state, config,
+				powerwallPower, data.GetFloat(TopicSitePower).Current, inverterPower, time.Now())
+
+			if capped != prev {
+				log.Printf("PW2 coordinator: DIY inverter cap %d -> %d (Powerwall %.0fW, inverters %.0fW)\n",
+					prev, capped, powerwallPower, inverterPower)
+				audit.Record("pw2-coordinator", fmt.Sprintf("DIY inverter cap %d", capped),
+					map[string]float64{"powerwall_power": powerwallPower, "inverter_power": inverterPower})
+			}
+
+			sender.Send(MQTTMessage{
+				Topic:   TopicDIYInverterCap,
+				Payload: []byte(strconv.Itoa(capped)),
+				QoS:     1,
+				Retain:  true,
+			})
+
+		case <-ctx.Done():
+			log.Println("PW2 coordinator stopped")
+			return
+		}
+	}
+}
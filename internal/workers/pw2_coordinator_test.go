@@ -0,0 +1,49 @@
+package workers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeTestCoordinatorConfig() PW2CoordinatorConfig {
+	return PW2CoordinatorConfig{
+		InverterPowerTopic: "inverters",
+		MaxInverters:       9,
+		WattsPerInverter:   255,
+		ChargeTolerance:    100,
+		RaiseAfter:         2 * time.Minute,
+	}
+}
+
+func TestEvaluateDIYInverterCap_DropsWhilePowerwallAbsorbs(t *testing.T) {
+	config := makeTestCoordinatorConfig()
+	state := NewPW2CoordinatorState(config)
+	now := time.Now()
+
+	// 6 inverters running, Powerwall charging 600W: 3 inverters' worth is going into it
+	assert.Equal(t, 3, EvaluateDIYInverterCap(state, config, -600, 0, 1530, now))
+
+	// Small charge is noise
+	assert.Equal(t, 3, EvaluateDIYInverterCap(state, config, -50, 0, 765, now))
+
+	// Charging with no inverters running doesn't involve them
+	assert.Equal(t, 3, EvaluateDIYInverterCap(state, config, -2000, 0, 0, now))
+}
+
+func TestEvaluateDIYInverterCap_RisesOneAtATimeWithRoom(t *testing.T) {
+	config := makeTestCoordinatorConfig()
+	state := &PW2CoordinatorState{Cap: 2}
+	now := time.Now()
+
+	assert.Equal(t, 2, EvaluateDIYInverterCap(state, config, 300, 0, 510, now))
+	assert.Equal(t, 2, EvaluateDIYInverterCap(state, config, 300, 0, 510, now.Add(time.Minute)))
+	assert.Equal(t, 3, EvaluateDIYInverterCap(state, config, 0, 400, 510, now.Add(2*time.Minute)), "grid import is room too")
+
+	// Room gone restarts the wait
+	assert.Equal(t, 3, EvaluateDIYInverterCap(state, config, 0, 0, 765, now.Add(3*time.Minute)))
+	assert.Equal(t, 3, EvaluateDIYInverterCap(state, config, 300, 0, 765, now.Add(4*time.Minute)))
+	assert.Equal(t, 3, EvaluateDIYInverterCap(state, config, 300, 0, 765, now.Add(5*time.Minute)))
+	assert.Equal(t, 4, EvaluateDIYInverterCap(state, config, 300, 0, 765, now.Add(6*time.Minute)))
+}
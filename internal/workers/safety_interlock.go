@@ -0,0 +1,211 @@
+package workers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ryansname/powerctl/internal/stats"
+	"log"
+	"math"
+	"time"
+)
+
+// interlockPendingTTL is how long an admitted turn-on counts towards the transfer limit
+// before its state topic reports the inverter on.
+const interlockPendingTTL = 30 * time.Second
+
+// The interlock judges battery voltage by its 1m median, so a momentary sag under load
+// or a single bad reading neither vetoes nor allows a turn-on
+const (
+	interlockVoltagePercentile = stats.P50
+	interlockVoltageWindow     = stats.Window1Min
+)
+
+// InterlockBattery describes the inverters on one battery for the safety interlock.
+type InterlockBattery struct {
+	Name           string
+	VoltageTopic   string
+	LowVoltageTrip float64 // Refuse turn-on below this voltage; 0 disables
+	Inverters      []InverterInfo
+
+	CellVoltageTopics []string // BMS per-cell voltages; empty disables the cell check
+	MinCellVoltage    float64  // Refuse turn-on while any cell is below this
+}
+
+// SafetyInterlockConfig holds the hard limits enforced on every outgoing command.
+type SafetyInterlockConfig struct {
+	Batteries        []InterlockBattery
+	WattsPerInverter float64
+
+	// MaxTransferPower limits the powerhouse transfer: inverter output across all
+	// batteries plus SolarTopic's 15m P90, as powerhouseTransferLimit. 0 disables.
+	MaxTransferPower float64
+	SolarTopic       string
+	// While AbsorbSOCTopic is below AbsorbBelowSOC its Multiplus absorbs the excess, so the
+	// transfer limit doesn't apply (as in baseline control). Empty topic disables.
+	AbsorbSOCTopic string
+	AbsorbBelowSOC float64
+}
+
+// Topics returns the battery voltage and inverter state topics the interlock reads.
+func (c SafetyInterlockConfig) Topics() []string {
+	var topics []string
+	for _, b := range c.Batteries {
+		topics = append(topics, b.VoltageTopic)
+		for _, inv := range b.Inverters {
+			topics = append(topics, inv.StateTopic)
+		}
+		topics = append(topics, b.CellVoltageTopics...)
+	}
+	if c.MaxTransferPower > 0 {
+		topics = append(topics, c.SolarTopic)
+		if c.AbsorbSOCTopic != "" {
+			topics = append(topics, c.AbsorbSOCTopic)
+		}
+	}
+	return topics
+}
+
+// RegisterPercentiles registers the voltage and solar percentiles the interlock reads.
+// Must be called before statsWorker starts.
+func (c SafetyInterlockConfig) RegisterPercentiles() {
+	for _, b := range c.Batteries {
+		registerPercentile(b.VoltageTopic, PercentileSpec{interlockVoltagePercentile, interlockVoltageWindow})
+	}
+	if c.MaxTransferPower > 0 {
+		registerPercentile(c.SolarTopic, PercentileSpec{stats.P90, stats.Window15Min})
+	}
+}
+
+// SafetyInterlock vetoes commands that would break a hard rule, whichever worker sent
+// them: no inverter turn-on while its battery is below the low-voltage trip, and never
+// more inverters on than MaxTransferPower allows. mqttSenderWorker checks every message.
+// A rule whose readings haven't arrived yet doesn't veto.
+type SafetyInterlock struct {
+	config   SafetyInterlockConfig
+	audit    *AuditLog
+	voltages map[string]float64   // battery name -> 1m median voltage, once known
+	cellMin  map[string]float64   // battery name -> lowest reported cell voltage, once known
+	on       map[string]bool      // inverter entity ID -> reported on
+	pending  map[string]time.Time // inverter entity ID -> admitted turn-on not yet reported
+	battery  map[string]int       // inverter entity ID -> index into config.Batteries
+
+	solar      float64 // SolarTopic 15m P90
+	solarKnown bool
+	absorbing  bool // AbsorbSOCTopic is below AbsorbBelowSOC
+}
+
+// NewSafetyInterlock creates an interlock. Vetoes are logged and recorded to audit (may be nil).
+func NewSafetyInterlock(config SafetyInterlockConfig, audit *AuditLog) *SafetyInterlock {
+	s := &SafetyInterlock{
+		config:   config,
+		audit:    audit,
+		voltages: make(map[string]float64),
+		cellMin:  make(map[string]float64),
+		on:       make(map[string]bool),
+		pending:  make(map[string]time.Time),
+		battery:  make(map[string]int),
+	}
+	for i, b := range config.Batteries {
+		for _, inv := range b.Inverters {
+			s.battery[inv.EntityID] = i
+		}
+	}
+	return s
+}
+
+// Update refreshes voltages and inverter states. Safe on a nil interlock.
+func (s *SafetyInterlock) Update(data DisplayData) {
+	if s == nil {
+		return
+	}
+	for _, b := range s.config.Batteries {
+		if v, ok := data.LookupPercentile(b.VoltageTopic, interlockVoltagePercentile, interlockVoltageWindow); ok {
+			s.voltages[b.Name] = v
+		}
+		lowest, known := math.Inf(1), false
+		for _, topic := range b.CellVoltageTopics {
+			if cell, ok := data.TopicData[topic].(*stats.FloatTopicData); ok {
+				lowest, known = min(lowest, cell.Current), true
+			}
+		}
+		if known {
+			s.cellMin[b.Name] = lowest
+		}
+		for _, inv := range b.Inverters {
+			on := data.GetBoolean(inv.StateTopic)
+			s.on[inv.EntityID] = on
+			if on {
+				delete(s.pending, inv.EntityID)
+			}
+		}
+	}
+	if s.config.MaxTransferPower > 0 {
+		s.solar, s.solarKnown = data.LookupPercentile(s.config.SolarTopic, stats.P90, stats.Window15Min)
+		if soc, ok := data.TopicData[s.config.AbsorbSOCTopic].(*stats.FloatTopicData); ok {
+			s.absorbing = soc.Current < s.config.AbsorbBelowSOC
+		}
+	}
+}
+
+// activeInverters counts inverters reported on plus turn-ons still awaiting their state.
+func (s *SafetyInterlock) activeInverters(now time.Time) int {
+	count := 0
+	for entityID, on := range s.on {
+		if on {
+			count++
+		} else if admitted, ok := s.pending[entityID]; ok && now.Sub(admitted) < interlockPendingTTL {
+			count++
+		}
+	}
+	return count
+}
+
+// Veto returns why msg must not be sent, or "" to allow it. Allowed turn-ons are
+// counted towards the transfer limit until the inverter reports on. Safe on a nil
+// interlock, which allows everything.
+func (s *SafetyInterlock) Veto(msg MQTTMessage, now time.Time) string {
+	if s == nil || msg.Topic != TopicCallServiceProxy {
+		return ""
+	}
+	var call proxyServiceCall
+	if err := json.Unmarshal(msg.Payload, &call); err != nil {
+		return ""
+	}
+	idx, ok := s.battery[call.EntityID]
+	if !ok || (call.Service != "turn_on" && call.Service != "toggle") {
+		return ""
+	}
+	if s.on[call.EntityID] {
+		return "" // already on, nothing changes
+	}
+
+	b := s.config.Batteries[idx]
+	reason := ""
+	voltage, voltageKnown := s.voltages[b.Name]
+	if b.LowVoltageTrip > 0 && voltageKnown && voltage < b.LowVoltageTrip {
+		reason = fmt.Sprintf("%s at %.2fV (1m median) is below the %.2fV low-voltage trip", b.Name, voltage, b.LowVoltageTrip)
+	}
+	if cell, ok := s.cellMin[b.Name]; reason == "" && ok && cell < b.MinCellVoltage {
+		reason = fmt.Sprintf("%s has a cell at %.3fV, below %.3fV", b.Name, cell, b.MinCellVoltage)
+	}
+	active := s.activeInverters(now)
+	if admitted, ok := s.pending[call.EntityID]; ok && now.Sub(admitted) < interlockPendingTTL {
+		active-- // a repeat of a turn-on already counted
+	}
+	if reason == "" && s.config.MaxTransferPower > 0 && s.solarKnown && !s.absorbing {
+		limit := powerhouseTransferLimit(s.solar, s.config.MaxTransferPower)
+		if float64(active+1)*s.config.WattsPerInverter > limit.Watts {
+			reason = fmt.Sprintf("%d inverters on with %.0fW solar, another would exceed the %.0fW transfer limit",
+				active, s.solar, s.config.MaxTransferPower)
+		}
+	}
+
+	if reason != "" {
+		log.Printf("Safety interlock vetoed %s %s: %s\n", call.Service, call.EntityID, reason)
+		s.audit.Record("interlock", fmt.Sprintf("Vetoed %s %s: %s", call.Service, call.EntityID, reason),
+			map[string]float64{"voltage": voltage, "solar_p90": s.solar, "active_inverters": float64(active)})
+		return reason
+	}
+	s.pending[call.EntityID] = now
+	return ""
+}
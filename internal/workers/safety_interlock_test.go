@@ -0,0 +1,137 @@
+package workers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ryansname/powerctl/internal/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeTestInterlock() *SafetyInterlock {
+	return NewSafetyInterlock(SafetyInterlockConfig{
+		Batteries: []InterlockBattery{{
+			Name:           "Battery 2",
+			VoltageTopic:   "b2/voltage",
+			LowVoltageTrip: 50.75,
+			Inverters: []InverterInfo{
+				{EntityID: "switch.inv_1", StateTopic: "inv_1/state"},
+				{EntityID: "switch.inv_2", StateTopic: "inv_2/state"},
+				{EntityID: "switch.inv_3", StateTopic: "inv_3/state"},
+			},
+		}},
+		WattsPerInverter: 255,
+		MaxTransferPower: 2000,
+		SolarTopic:       "solar_1/power",
+		AbsorbSOCTopic:   "b3/soc",
+		AbsorbBelowSOC:   94,
+	}, nil)
+}
+
+// interlockData reads voltage as the battery's 1m median, with 1500W of solar (room
+// for one inverter under the transfer limit) and Battery 3 full
+func interlockData(voltage float64, on ...bool) DisplayData {
+	data := DisplayData{
+		TopicData: map[string]any{
+			"b2/voltage":    makeFloatTopic(voltage),
+			"solar_1/power": makeFloatTopic(1500),
+			"b3/soc":        makeFloatTopic(100),
+		},
+		Percentiles: map[PercentileKey]float64{
+			{"b2/voltage", interlockVoltagePercentile, interlockVoltageWindow}: voltage,
+			{"solar_1/power", stats.P90, stats.Window15Min}:                    1500,
+		},
+	}
+	for i, state := range on {
+		data.TopicData["inv_"+string(rune('1'+i))+"/state"] = makeBoolTopic(state, "")
+	}
+	return data
+}
+
+func TestSafetyInterlock_LowVoltageVetoesTurnOn(t *testing.T) {
+	s := makeTestInterlock()
+	s.Update(interlockData(50.5, false, false, false))
+	now := time.Now()
+
+	assert.Contains(t, s.Veto(serviceCallMessage("switch", "turn_on", "switch.inv_1", nil), now), "low-voltage trip")
+	assert.Empty(t, s.Veto(serviceCallMessage("switch", "turn_off", "switch.inv_1", nil), now))
+	assert.Empty(t, s.Veto(serviceCallMessage("switch", "turn_on", "switch.other", nil), now))
+
+	s.Update(interlockData(51.0, false, false, false))
+	assert.Empty(t, s.Veto(serviceCallMessage("switch", "turn_on", "switch.inv_1", nil), now))
+}
+
+func TestSafetyInterlock_LowVoltageUsesMedian(t *testing.T) {
+	s := makeTestInterlock()
+	// A momentary sag below the trip doesn't veto while the 1m median is above it
+	data := interlockData(51.0, false, false, false)
+	data.TopicData["b2/voltage"] = makeFloatTopic(49.0)
+	s.Update(data)
+	assert.Empty(t, s.Veto(serviceCallMessage("switch", "turn_on", "switch.inv_1", nil), time.Now()))
+}
+
+func TestSafetyInterlock_UnknownReadingsDontVeto(t *testing.T) {
+	s := makeTestInterlock()
+	// Before the first voltage, cell and solar readings, nothing is known to be unsafe
+	s.Update(DisplayData{TopicData: map[string]any{}})
+	assert.Empty(t, s.Veto(serviceCallMessage("switch", "turn_on", "switch.inv_1", nil), time.Now()))
+	assert.Empty(t, s.Veto(serviceCallMessage("switch", "turn_on", "switch.inv_2", nil), time.Now()))
+	assert.Empty(t, s.Veto(serviceCallMessage("switch", "turn_on", "switch.inv_3", nil), time.Now()))
+}
+
+func TestSafetyInterlock_TransferLimitCountsPendingTurnOns(t *testing.T) {
+	s := makeTestInterlock()
+	s.Update(interlockData(52, false, false, false))
+	now := time.Now()
+
+	assert.Empty(t, s.Veto(serviceCallMessage("switch", "turn_on", "switch.inv_1", nil), now))
+	assert.Empty(t, s.Veto(serviceCallMessage("switch", "turn_on", "switch.inv_1", nil), now), "repeat of an admitted turn-on")
+	assert.Contains(t, s.Veto(serviceCallMessage("switch", "turn_on", "switch.inv_2", nil), now), "transfer limit")
+
+	// The pending turn-on expires if the inverter never reports on
+	assert.Empty(t, s.Veto(serviceCallMessage("switch", "turn_on", "switch.inv_2", nil), now.Add(interlockPendingTTL)))
+
+	// Inverters reported on count too
+	s = makeTestInterlock()
+	s.Update(interlockData(52, true, false, false))
+	assert.Contains(t, s.Veto(serviceCallMessage("switch", "turn_on", "switch.inv_2", nil), now), "transfer limit")
+}
+
+func TestSafetyInterlock_TransferLimitSkippedWhileMultiplusAbsorbs(t *testing.T) {
+	s := makeTestInterlock()
+	data := interlockData(52, true, false, false)
+	data.TopicData["b3/soc"] = makeFloatTopic(80)
+	s.Update(data)
+	assert.Empty(t, s.Veto(serviceCallMessage("switch", "turn_on", "switch.inv_2", nil), time.Now()))
+}
+
+func TestSafetyInterlock_NilAllowsEverything(t *testing.T) {
+	var s *SafetyInterlock
+	s.Update(interlockData(0))
+	assert.Empty(t, s.Veto(serviceCallMessage("switch", "turn_on", "switch.inv_1", nil), time.Now()))
+}
+
+func TestSafetyInterlock_LowCellVetoesTurnOn(t *testing.T) {
+	config := SafetyInterlockConfig{
+		Batteries: []InterlockBattery{{
+			Name:              "Battery 2",
+			VoltageTopic:      "b2/voltage",
+			LowVoltageTrip:    50.75,
+			Inverters:         []InverterInfo{{EntityID: "switch.inv_1", StateTopic: "inv_1/state"}},
+			CellVoltageTopics: []string{"cell_1", "cell_2"},
+			MinCellVoltage:    2.9,
+		}},
+	}
+	s := NewSafetyInterlock(config, nil)
+	assert.Contains(t, config.Topics(), "cell_2")
+
+	data := interlockData(52, false)
+	data.TopicData["cell_1"] = makeFloatTopic(3.3)
+	data.TopicData["cell_2"] = makeFloatTopic(2.8)
+	s.Update(data)
+	assert.Contains(t, s.Veto(serviceCallMessage("switch", "turn_on", "switch.inv_1", nil), time.Now()), "has a cell at 2.800V")
+
+	data.TopicData["cell_2"] = makeFloatTopic(3.2)
+	s.Update(data)
+	assert.Empty(t, s.Veto(serviceCallMessage("switch", "turn_on", "switch.inv_1", nil), time.Now()))
+}
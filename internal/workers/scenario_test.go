@@ -0,0 +1,240 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/ryansname/powerctl/internal/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+// scenarioTimeout bounds each wait for an outgoing command. statsWorker broadcasts
+// once a second, so a command normally follows a published value within two.
+const scenarioTimeout = 5 * time.Second
+
+// scenario runs the real worker graph against an embedded MQTT broker: mqttWorker →
+// stats → broadcast → baseline control → interceptor → mqttSenderWorker. publish feeds
+// statestream values through the broker, and the expect helpers read the messages the
+// sender published to it.
+type scenario struct {
+	t      *testing.T
+	broker *mqtt.Server
+	out    chan MQTTMessage
+}
+
+// startScenarioBroker starts an embedded broker on a free local port, stopped when the
+// test ends.
+func startScenarioBroker(t *testing.T) (*mqtt.Server, int) {
+	t.Helper()
+	broker := mqtt.New(&mqtt.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	assert.NoError(t, broker.AddHook(new(auth.AllowHook), nil))
+	tcp := listeners.NewTCP(listeners.Config{ID: "scenario", Address: "127.0.0.1:0"})
+	if !assert.NoError(t, broker.AddListener(tcp)) {
+		t.FailNow()
+	}
+	assert.NoError(t, broker.Serve())
+	t.Cleanup(func() { _ = broker.Close() })
+
+	_, port, err := net.SplitHostPort(tcp.Address())
+	assert.NoError(t, err)
+	n, err := strconv.Atoi(port)
+	assert.NoError(t, err)
+	return broker, n
+}
+
+// newBaselineScenario starts the Battery 2 inverter control graph for config. Workers
+// stop when the test ends.
+func newBaselineScenario(t *testing.T, config BaselineInverterConfig) *scenario {
+	if testing.Short() {
+		t.Skip("scenario tests run in real time")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	broker, port := startScenarioBroker(t)
+	s := &scenario{t: t, broker: broker, out: make(chan MQTTMessage, 100)}
+	err := broker.Subscribe(TopicCallServiceProxy, 1, func(_ *mqtt.Client, _ packets.Subscription, pk packets.Packet) {
+		s.out <- MQTTMessage{Topic: pk.TopicName, Payload: pk.Payload}
+	})
+	assert.NoError(t, err)
+
+	sensorChan := make(chan SensorMessage, 100)
+	clientChan := make(chan MQTTConnection, 1)
+	outgoing := make(chan MQTTMessage, 100)
+	statsChan := make(chan DisplayData, 10)
+	inverterOut := make(chan MQTTMessage, 100)
+	baselineData := make(chan DisplayData, 10)
+	baselineInput := make(chan BaselineInput, 10)
+	interceptorData := make(chan DisplayData, 10)
+
+	// As runDaemon: low-voltage recovery reads a 5m P50 of Battery 2 voltage
+	registerPercentile(config.Input.Battery2VoltageTopic, PercentileSpec{stats.P50, stats.Window5Min})
+	topics := append(config.Input.Topics(), TopicPowerhouseInvertersEnabledState)
+	consumers := []DownstreamConsumer{
+		{Name: "baseline-inverter-control", Ch: baselineData, Requires: config.Input.Topics()},
+		{Name: "inverter-interceptor", Ch: interceptorData, Requires: []string{TopicPowerhouseInvertersEnabledState}},
+	}
+
+	go mqttWorker(ctx, "127.0.0.1", port, []TopicRoute{{Topics: topics, Channel: sensorChan}},
+		"", "", t.Name(), "", TopicQoSConfig{}, clientChan, nil)
+	go mqttSenderWorker(ctx, outgoing, clientChan, nil, MQTTSenderConfig{
+		ForceEnable: true,
+		QueueSize:   100,
+		MaxInFlight: 10,
+	}, nil, nil)
+	go statsWorker(ctx, sensorChan, statsChan, topics, nil, nil)
+	go broadcastWorker(ctx, statsChan, consumers, NewMQTTSender(make(chan MQTTMessage, 100)), NewHeartbeats())
+	go func() {
+		for {
+			select {
+			case data := <-baselineData:
+				baselineInput <- ExtractBaselineInput(data, config.Input)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go baselineInverterControl(ctx, baselineInput, nil, config, NewMQTTSender(inverterOut), nil, nil)
+	go mqttInterceptorWorker(ctx, "Powerhouse inverters", TopicPowerhouseInvertersEnabledState,
+		inverterOut, outgoing, interceptorData, false)
+	return s
+}
+
+// publish publishes a retained statestream value to the broker, as Home Assistant does.
+// Retained values reach mqttWorker even if it subscribes afterwards.
+func (s *scenario) publish(topic, value string) {
+	assert.NoError(s.t, s.broker.Publish(topic, []byte(value), true, 0))
+}
+
+// nextCall returns the next service call sent, skipping other messages (debug sensors).
+// ok is false if none arrives within timeout.
+func (s *scenario) nextCall(timeout time.Duration) (call proxyServiceCall, ok bool) {
+	deadline := time.After(timeout)
+	for {
+		select {
+		case msg := <-s.out:
+			if msg.Topic != TopicCallServiceProxy {
+				continue
+			}
+			assert.NoError(s.t, json.Unmarshal(msg.Payload, &call))
+			return call, true
+		case <-deadline:
+			return call, false
+		}
+	}
+}
+
+// expectCalls waits for exactly these service/entity pairs, in order.
+func (s *scenario) expectCalls(want ...[2]string) {
+	s.t.Helper()
+	for _, w := range want {
+		call, ok := s.nextCall(scenarioTimeout)
+		if !assert.True(s.t, ok, "timed out waiting for %s %s", w[0], w[1]) {
+			return
+		}
+		assert.Equal(s.t, w, [2]string{call.Service, call.EntityID})
+	}
+}
+
+// expectNoCalls asserts nothing is sent for d.
+func (s *scenario) expectNoCalls(d time.Duration) {
+	s.t.Helper()
+	call, ok := s.nextCall(d)
+	assert.False(s.t, ok, "unexpected %s %s", call.Service, call.EntityID)
+}
+
+// publishHealthyBaseline publishes every baseline input with a healthy, idle site:
+// grid on, Battery 2 at 80% and 53.5V, no load, all inverters off.
+func (s *scenario) publishHealthyBaseline(config BaselineInverterConfig) {
+	in := config.Input
+	for topic, value := range map[string]string{
+		in.Battery2SOCTopic:                  "80",
+		in.Battery2ChargeStateTopic:          "Bulk Charging",
+		in.Battery2VoltageTopic:              "53.5",
+		in.Battery2EnergyTopic:               "7000",
+		in.Solar1PowerTopic:                  "0",
+		in.Solar2PowerTopic:                  "0",
+		in.HouseLoadTopic:                    "0",
+		in.GridStatusTopic:                   "on",
+		in.ACFrequencyTopic:                  "50",
+		in.ForecastRemainingTopic:            "0",
+		in.TomorrowForecastTopic:             "0",
+		in.DetailedForecastTopic:             "[]",
+		in.Battery3SOCTopic:                  "80",
+		in.PowerwallSOCTopic:                 "50",
+		in.ExpectingPowerCutsTopic:           "off",
+		in.IslandModeTopic:                   "off",
+		in.StormModeTopic:                    "off",
+		in.CurtailmentTopic:                  "off",
+		in.EVReservedPowerTopic:              "0",
+		in.InverterModeTopic:                 InverterModeAuto,
+		in.ManualInverterCountTopic:          "0",
+		TopicPowerhouseInvertersEnabledState: "on",
+	} {
+		s.publish(topic, value)
+	}
+	for _, topic := range in.InverterStateTopics {
+		s.publish(topic, "off")
+	}
+	for _, topic := range in.InverterPowerTopics {
+		s.publish(topic, "0")
+	}
+}
+
+func makeScenarioBaselineConfig() BaselineInverterConfig {
+	battery2, battery3 := DefaultBatteryConfigs()
+	return BuildBaselineInverterConfig(battery2, battery3)
+}
+
+func TestScenario_ManualCountSwitchesInverters(t *testing.T) {
+	config := makeScenarioBaselineConfig()
+	s := newBaselineScenario(t, config)
+	s.publishHealthyBaseline(config)
+	s.expectNoCalls(2 * time.Second)
+
+	s.publish(config.Input.ManualInverterCountTopic, "2")
+	s.publish(config.Input.InverterModeTopic, InverterModeManual)
+	s.expectCalls(
+		[2]string{"turn_on", config.Battery2.Inverters[0].EntityID},
+		[2]string{"turn_on", config.Battery2.Inverters[1].EntityID},
+	)
+}
+
+func TestScenario_InterceptorDisabledDropsCommands(t *testing.T) {
+	config := makeScenarioBaselineConfig()
+	s := newBaselineScenario(t, config)
+	s.publishHealthyBaseline(config)
+	s.publish(TopicPowerhouseInvertersEnabledState, "off")
+	s.publish(config.Input.ManualInverterCountTopic, "2")
+	s.publish(config.Input.InverterModeTopic, InverterModeManual)
+	s.expectNoCalls(3 * time.Second)
+}
+
+func TestScenario_CellUndervoltageOverridesManual(t *testing.T) {
+	config := makeScenarioBaselineConfig()
+	config.Input.CellUndervoltageTopic = bmsCellUndervoltageTopic("Battery 2")
+	s := newBaselineScenario(t, config)
+	s.publishHealthyBaseline(config)
+	s.publish(config.Input.CellUndervoltageTopic, "off")
+	s.publish(config.Input.ManualInverterCountTopic, "1")
+	s.publish(config.Input.InverterModeTopic, InverterModeManual)
+	s.expectCalls([2]string{"turn_on", config.Battery2.Inverters[0].EntityID})
+
+	// The controller sees its own command confirmed, then the BMS trips
+	s.publish(config.Input.InverterStateTopics[0], "on")
+	s.publish(config.Input.CellUndervoltageTopic, "on")
+	s.expectCalls([2]string{"turn_off", config.Battery2.Inverters[0].EntityID})
+}
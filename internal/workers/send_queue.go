@@ -0,0 +1,124 @@
+package workers
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// MessagePriority orders messages queued while the broker is unreachable.
+type MessagePriority int
+
+const (
+	PriorityDefault MessagePriority = iota // Classified by topic, see queuePriority
+	PriorityDebug                          // Debug text and diagnostics
+	PriorityState                          // Sensor state publishes
+	PriorityCommand                        // Service calls, Victron writes and discovery configs
+)
+
+// queuedStateTTL is how long a queued state or debug publish stays worth sending.
+// Commands and discovery configs never expire.
+const queuedStateTTL = 2 * time.Minute
+
+// queuePriority resolves a message's priority, classifying PriorityDefault by topic.
+func queuePriority(msg MQTTMessage) MessagePriority {
+	if msg.Priority != PriorityDefault {
+		return msg.Priority
+	}
+	if msg.Topic == TopicCallServiceProxy || strings.HasPrefix(msg.Topic, "powerhouse_3/W/") || isDiscoveryTopic(msg.Topic) {
+		return PriorityCommand
+	}
+	return PriorityState
+}
+
+type queuedMessage struct {
+	msg      MQTTMessage
+	priority MessagePriority
+	queuedAt time.Time
+	key      string // serviceCallKey, "" for other messages
+	turnOff  bool
+}
+
+// SendQueue holds outgoing messages while disconnected or the publish window is
+// full. A service call replaces any queued call to the same entity, so a reconnect
+// replays only the latest command. It is bounded: when full, the oldest message of the
+// lowest priority is evicted. turn_off calls are never evicted or dropped.
+type SendQueue struct {
+	maxSize int
+	items   []queuedMessage
+}
+
+// NewSendQueue creates a queue holding at most maxSize messages.
+func NewSendQueue(maxSize int) *SendQueue {
+	return &SendQueue{maxSize: maxSize}
+}
+
+// Len returns the number of queued messages.
+func (q *SendQueue) Len() int {
+	return len(q.items)
+}
+
+// Push queues msg. Returns false if a message had to be dropped to stay in bounds,
+// which is msg itself when everything queued outranks it. A turn_off that finds
+// nothing to evict is queued past the bound instead.
+func (q *SendQueue) Push(msg MQTTMessage, now time.Time) bool {
+	item := queuedMessage{
+		msg:      msg,
+		priority: queuePriority(msg),
+		queuedAt: now,
+		key:      serviceCallKey(msg),
+		turnOff:  isTurnOff(msg),
+	}
+	if item.key != "" {
+		q.items = slices.DeleteFunc(q.items, func(it queuedMessage) bool { return it.key == item.key })
+	}
+	if len(q.items) < q.maxSize {
+		q.items = append(q.items, item)
+		return true
+	}
+
+	// Items are in arrival order, so the first of the lowest priority is the oldest
+	victim := -1
+	for i, it := range q.items {
+		if it.priority > item.priority || it.turnOff {
+			continue
+		}
+		if victim < 0 || it.priority < q.items[victim].priority {
+			victim = i
+		}
+	}
+	switch {
+	case victim >= 0:
+		q.items = append(slices.Delete(q.items, victim, victim+1), item)
+	case item.turnOff:
+		q.items = append(q.items, item)
+		return true
+	}
+	return false
+}
+
+// Pop removes and returns the oldest message of the highest priority, dropping state
+// and debug publishes that have expired. ok is false once the queue is empty.
+func (q *SendQueue) Pop(now time.Time) (msg MQTTMessage, expired int, ok bool) {
+	q.items = slices.DeleteFunc(q.items, func(it queuedMessage) bool {
+		stale := it.priority < PriorityCommand && now.Sub(it.queuedAt) > queuedStateTTL
+		if stale {
+			expired++
+		}
+		return stale
+	})
+	if len(q.items) == 0 {
+		return MQTTMessage{}, expired, false
+	}
+
+	// Items are in arrival order, so the first of the highest priority is the oldest
+	best := 0
+	for i, it := range q.items {
+		if it.priority > q.items[best].priority {
+			best = i
+		}
+	}
+	msg = q.items[best].msg
+	q.items = slices.Delete(q.items, best, best+1)
+	return msg, expired, true
+}
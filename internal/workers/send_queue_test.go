@@ -0,0 +1,138 @@
+package workers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueuePriority(t *testing.T) {
+	assert.Equal(t, PriorityCommand, queuePriority(serviceCallMessage("switch", "turn_on", "switch.a", nil)))
+	assert.Equal(t, PriorityCommand, queuePriority(MQTTMessage{Topic: "powerhouse_3/W/x/setpoint"}))
+	assert.Equal(t, PriorityCommand, queuePriority(MQTTMessage{Topic: "homeassistant/sensor/x/config"}))
+	assert.Equal(t, PriorityState, queuePriority(MQTTMessage{Topic: "powerctl/sensor/x/state"}))
+	assert.Equal(t, PriorityDebug, queuePriority(MQTTMessage{Topic: "powerctl/sensor/x/state", Priority: PriorityDebug}))
+}
+
+// drain pops everything, as the sender does on reconnect
+func drain(q *SendQueue, now time.Time) (msgs []MQTTMessage, expired int) {
+	for {
+		msg, n, ok := q.Pop(now)
+		expired += n
+		if !ok {
+			return msgs, expired
+		}
+		msgs = append(msgs, msg)
+	}
+}
+
+func TestSendQueue_PopsByPriority(t *testing.T) {
+	q := NewSendQueue(10)
+	now := time.Now()
+	state1 := MQTTMessage{Topic: "state/1"}
+	debug := MQTTMessage{Topic: "debug", Priority: PriorityDebug}
+	cmd := MQTTMessage{Topic: "powerhouse_3/W/cmd"}
+	state2 := MQTTMessage{Topic: "state/2"}
+	for _, m := range []MQTTMessage{state1, debug, cmd, state2} {
+		assert.True(t, q.Push(m, now))
+	}
+
+	msgs, expired := drain(q, now)
+	assert.Equal(t, []MQTTMessage{cmd, state1, state2, debug}, msgs)
+	assert.Zero(t, expired)
+	assert.Zero(t, q.Len())
+}
+
+func TestSendQueue_DropsStaleStates(t *testing.T) {
+	q := NewSendQueue(10)
+	start := time.Now()
+	cmd := MQTTMessage{Topic: "powerhouse_3/W/cmd"}
+	fresh := MQTTMessage{Topic: "state/fresh"}
+	q.Push(MQTTMessage{Topic: "state/stale"}, start)
+	q.Push(cmd, start)
+	q.Push(fresh, start.Add(queuedStateTTL))
+
+	msgs, expired := drain(q, start.Add(queuedStateTTL+time.Second))
+	assert.Equal(t, []MQTTMessage{cmd, fresh}, msgs)
+	assert.Equal(t, 1, expired)
+}
+
+func TestSendQueue_EvictsOldestLowestPriority(t *testing.T) {
+	q := NewSendQueue(3)
+	now := time.Now()
+	state := MQTTMessage{Topic: "state"}
+	debugOld := MQTTMessage{Topic: "debug/old", Priority: PriorityDebug}
+	debugNew := MQTTMessage{Topic: "debug/new", Priority: PriorityDebug}
+	cmd := MQTTMessage{Topic: "powerhouse_3/W/cmd"}
+	q.Push(state, now)
+	q.Push(debugOld, now)
+	q.Push(debugNew, now)
+
+	assert.False(t, q.Push(cmd, now))
+	msgs, _ := drain(q, now)
+	assert.Equal(t, []MQTTMessage{cmd, state, debugNew}, msgs)
+}
+
+func TestSendQueue_DropsIncomingWhenOutranked(t *testing.T) {
+	q := NewSendQueue(1)
+	now := time.Now()
+	cmd := MQTTMessage{Topic: "powerhouse_3/W/cmd"}
+	q.Push(cmd, now)
+
+	assert.False(t, q.Push(MQTTMessage{Topic: "state"}, now))
+	msgs, _ := drain(q, now)
+	assert.Equal(t, []MQTTMessage{cmd}, msgs)
+}
+
+func TestSendQueue_EvictsOldestAtEqualPriority(t *testing.T) {
+	q := NewSendQueue(2)
+	now := time.Now()
+	old := MQTTMessage{Topic: "powerhouse_3/W/old"}
+	mid := MQTTMessage{Topic: "powerhouse_3/W/mid"}
+	latest := MQTTMessage{Topic: "powerhouse_3/W/new"}
+	q.Push(old, now)
+	q.Push(mid, now)
+
+	assert.False(t, q.Push(latest, now))
+	msgs, _ := drain(q, now)
+	assert.Equal(t, []MQTTMessage{mid, latest}, msgs)
+}
+
+func TestSendQueue_KeepsLatestCallPerEntity(t *testing.T) {
+	q := NewSendQueue(10)
+	now := time.Now()
+	turnOn := serviceCallMessage("switch", "turn_on", "switch.inverter_1", nil)
+	other := serviceCallMessage("switch", "turn_on", "switch.inverter_2", nil)
+	turnOff := serviceCallMessage("switch", "turn_off", "switch.inverter_1", nil)
+	q.Push(turnOn, now)
+	q.Push(other, now)
+
+	assert.True(t, q.Push(turnOff, now))
+	msgs, _ := drain(q, now)
+	assert.Equal(t, []MQTTMessage{other, turnOff}, msgs, "the queued turn_on is not replayed")
+}
+
+func TestSendQueue_NeverDropsTurnOff(t *testing.T) {
+	q := NewSendQueue(2)
+	now := time.Now()
+	off1 := serviceCallMessage("switch", "turn_off", "switch.inverter_1", nil)
+	off2 := serviceCallMessage("switch", "turn_off", "switch.inverter_2", nil)
+	off3 := serviceCallMessage("switch", "turn_off", "switch.inverter_3", nil)
+	on4 := serviceCallMessage("switch", "turn_on", "switch.inverter_4", nil)
+	q.Push(off1, now)
+	q.Push(off2, now)
+
+	// Nothing but turn_offs to evict: a turn_on is dropped, a turn_off goes past the bound
+	assert.False(t, q.Push(on4, now))
+	assert.True(t, q.Push(off3, now))
+	msgs, _ := drain(q, now)
+	assert.Equal(t, []MQTTMessage{off1, off2, off3}, msgs)
+
+	// A turn_off evicts a command rather than another turn_off
+	q.Push(off1, now)
+	q.Push(on4, now)
+	assert.False(t, q.Push(off2, now))
+	msgs, _ = drain(q, now)
+	assert.Equal(t, []MQTTMessage{off1, off2}, msgs)
+}
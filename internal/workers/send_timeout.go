@@ -0,0 +1,68 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// sendTimeout bounds how long a worker waits to hand a message to a stalled consumer.
+// Every consumer drains its channel continuously, so a send that waits this long means
+// the consumer is stuck; the watchdog deals with that, and the sender carries on.
+const sendTimeout = 5 * time.Second
+
+// sendTimeouts counts sends abandoned after sendTimeout, for the diagnostic sensor.
+var sendTimeouts atomic.Int64
+
+// sendWithin delivers v on ch, giving up if ctx is done or timeout passes first.
+// Returns whether v was delivered; a timeout is logged under name and counted.
+func sendWithin[T any](ctx context.Context, ch chan<- T, v T, timeout time.Duration, name string) bool {
+	select {
+	case ch <- v:
+		return true
+	default:
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case ch <- v:
+		return true
+	case <-timer.C:
+		sendTimeouts.Add(1)
+		log.Printf("ERROR: %s: send blocked for %v, dropped\n", name, timeout)
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// sendWaiting delivers v on ch like sendWithin, but never drops it: past timeout the
+// stall is logged under name and counted, and the send keeps waiting until ctx is done.
+// For messages that must not be lost, such as turn_off calls.
+func sendWaiting[T any](ctx context.Context, ch chan<- T, v T, timeout time.Duration, name string) bool {
+	select {
+	case ch <- v:
+		return true
+	default:
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case ch <- v:
+		return true
+	case <-timer.C:
+		sendTimeouts.Add(1)
+		log.Printf("ERROR: %s: send blocked for %v, still waiting\n", name, timeout)
+	case <-ctx.Done():
+		return false
+	}
+	select {
+	case ch <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
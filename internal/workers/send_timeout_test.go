@@ -0,0 +1,79 @@
+package workers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendWithin(t *testing.T) {
+	ch := make(chan int, 1)
+	assert.True(t, sendWithin(context.Background(), ch, 1, time.Millisecond, "test"))
+	assert.Equal(t, 1, <-ch)
+
+	// Nobody receiving: abandoned after the timeout and counted
+	before := sendTimeouts.Load()
+	blocked := make(chan int)
+	assert.False(t, sendWithin(context.Background(), blocked, 2, 5*time.Millisecond, "test"))
+	assert.Equal(t, before+1, sendTimeouts.Load())
+
+	// A cancelled context gives up without counting a timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.False(t, sendWithin(ctx, blocked, 3, time.Hour, "test"))
+	assert.Equal(t, before+1, sendTimeouts.Load())
+}
+
+func TestSendWaiting(t *testing.T) {
+	before := sendTimeouts.Load()
+	blocked := make(chan int)
+	delivered := make(chan bool)
+	go func() { delivered <- sendWaiting(context.Background(), blocked, 1, 5*time.Millisecond, "test") }()
+
+	// Still waiting well past the timeout, which is counted
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 1, <-blocked)
+	assert.True(t, <-delivered)
+	assert.Equal(t, before+1, sendTimeouts.Load())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.False(t, sendWaiting(ctx, blocked, 2, time.Hour, "test"))
+}
+
+func TestMQTTSender_TurnOffNeverDropped(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits out sendTimeout")
+	}
+	ch := make(chan MQTTMessage)
+	sender := NewMQTTSender(ch)
+	go sender.CallService("switch", "turn_off", "switch.inverter_1", nil)
+
+	// A turn_on would have been dropped after sendTimeout
+	time.Sleep(sendTimeout + 100*time.Millisecond)
+	select {
+	case msg := <-ch:
+		assert.True(t, isTurnOff(msg))
+	case <-time.After(time.Second):
+		t.Fatal("turn_off was dropped")
+	}
+}
+
+func TestMQTTSender_SendGivesUpWhenDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sender := NewMQTTSender(make(chan MQTTMessage)).WithContext(ctx)
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		sender.Send(MQTTMessage{Topic: "powerctl/test"})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Send blocked after the context was cancelled")
+	}
+}
@@ -0,0 +1,80 @@
+package workers
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+// serviceCallFlushInterval is how often mqttSenderWorker releases held service calls.
+const serviceCallFlushInterval = 250 * time.Millisecond
+
+// ServiceCallLimiter enforces a minimum interval between service calls to the same
+// entity. Calls arriving too soon are held, and a newer call replaces the held one,
+// so a rapid on/off/on burst collapses to the final command.
+type ServiceCallLimiter struct {
+	minInterval time.Duration
+	lastSent    map[string]time.Time
+	held        map[string]MQTTMessage
+}
+
+// NewServiceCallLimiter creates a limiter; a zero minInterval admits every call.
+func NewServiceCallLimiter(minInterval time.Duration) *ServiceCallLimiter {
+	return &ServiceCallLimiter{
+		minInterval: minInterval,
+		lastSent:    make(map[string]time.Time),
+		held:        make(map[string]MQTTMessage),
+	}
+}
+
+// serviceCallKey identifies the entity a service call targets, per domain so that
+// e.g. homeassistant.update_entity doesn't replace a select_option on the same entity.
+// Returns "" for calls without an entity, which are never limited.
+func serviceCallKey(msg MQTTMessage) string {
+	if msg.Topic != TopicCallServiceProxy {
+		return ""
+	}
+	var call proxyServiceCall
+	if err := json.Unmarshal(msg.Payload, &call); err != nil || call.EntityID == "" {
+		return ""
+	}
+	return call.Domain + "/" + call.EntityID
+}
+
+// Admit reports whether msg can be sent now. Otherwise it is held until Due.
+func (l *ServiceCallLimiter) Admit(msg MQTTMessage, now time.Time) bool {
+	if l.minInterval <= 0 {
+		return true
+	}
+	key := serviceCallKey(msg)
+	if key == "" {
+		return true
+	}
+
+	_, waiting := l.held[key]
+	if !waiting && now.Sub(l.lastSent[key]) >= l.minInterval {
+		l.lastSent[key] = now
+		return true
+	}
+	l.held[key] = msg
+	return false
+}
+
+// Due returns the held calls whose interval has elapsed, ordered by entity.
+func (l *ServiceCallLimiter) Due(now time.Time) []MQTTMessage {
+	var keys []string
+	for key := range l.held {
+		if now.Sub(l.lastSent[key]) >= l.minInterval {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	due := make([]MQTTMessage, len(keys))
+	for i, key := range keys {
+		due[i] = l.held[key]
+		delete(l.held, key)
+		l.lastSent[key] = now
+	}
+	return due
+}
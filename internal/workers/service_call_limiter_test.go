@@ -0,0 +1,53 @@
+package workers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceCallLimiter_CoalescesBurst(t *testing.T) {
+	limiter := NewServiceCallLimiter(2 * time.Second)
+	start := time.Now()
+
+	on := serviceCallMessage("switch", "turn_on", "switch.inv_1", nil)
+	off := serviceCallMessage("switch", "turn_off", "switch.inv_1", nil)
+
+	assert.True(t, limiter.Admit(on, start))
+	assert.False(t, limiter.Admit(off, start.Add(100*time.Millisecond)))
+	assert.False(t, limiter.Admit(on, start.Add(200*time.Millisecond)))
+
+	assert.Empty(t, limiter.Due(start.Add(time.Second)))
+	assert.Equal(t, []MQTTMessage{on}, limiter.Due(start.Add(2*time.Second)))
+	assert.Empty(t, limiter.Due(start.Add(3*time.Second)))
+
+	// The flushed call starts a new interval
+	assert.False(t, limiter.Admit(off, start.Add(3*time.Second)))
+	assert.Empty(t, limiter.Due(start.Add(3500*time.Millisecond)))
+	assert.Equal(t, []MQTTMessage{off}, limiter.Due(start.Add(4*time.Second)))
+}
+
+func TestServiceCallLimiter_IndependentKeys(t *testing.T) {
+	limiter := NewServiceCallLimiter(2 * time.Second)
+	now := time.Now()
+
+	assert.True(t, limiter.Admit(serviceCallMessage("switch", "turn_on", "switch.inv_1", nil), now))
+	assert.True(t, limiter.Admit(serviceCallMessage("switch", "turn_on", "switch.inv_2", nil), now))
+	// Same entity, different domain
+	assert.True(t, limiter.Admit(serviceCallMessage("homeassistant", "update_entity", "switch.inv_1", nil), now))
+	// No entity: never limited
+	assert.True(t, limiter.Admit(serviceCallMessage("tesla_custom", "api", "", nil), now))
+	assert.True(t, limiter.Admit(serviceCallMessage("tesla_custom", "api", "", nil), now))
+	// Not a service call
+	assert.True(t, limiter.Admit(MQTTMessage{Topic: "powerhouse_3/W/x"}, now))
+	assert.True(t, limiter.Admit(MQTTMessage{Topic: "powerhouse_3/W/x"}, now))
+}
+
+func TestServiceCallLimiter_Disabled(t *testing.T) {
+	limiter := NewServiceCallLimiter(0)
+	now := time.Now()
+	msg := serviceCallMessage("switch", "turn_on", "switch.inv_1", nil)
+	assert.True(t, limiter.Admit(msg, now))
+	assert.True(t, limiter.Admit(msg, now))
+}
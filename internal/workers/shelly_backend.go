@@ -0,0 +1,192 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// shellyRequestTimeout bounds each Shelly RPC request.
+	shellyRequestTimeout = 3 * time.Second
+	// shellyHealthInterval is how often every Shelly is polled with Switch.GetStatus.
+	shellyHealthInterval = 30 * time.Second
+)
+
+// ShellyTarget is the Shelly Gen2 relay (local HTTP RPC, no device auth) behind an
+// inverter switch entity.
+type ShellyTarget struct {
+	Host     string `json:"host"`      // IP or hostname, optionally with :port
+	SwitchID int    `json:"switch_id"` // Relay channel, 0 on single-channel devices
+}
+
+// ShellyClient makes Shelly Gen2 RPC calls over local HTTP.
+type ShellyClient struct {
+	client *http.Client
+}
+
+// NewShellyClient returns a client with shellyRequestTimeout per request.
+func NewShellyClient() *ShellyClient {
+	return &ShellyClient{client: &http.Client{Timeout: shellyRequestTimeout}}
+}
+
+// rpc calls method with params and decodes the JSON result into result (may be nil).
+func (c *ShellyClient) rpc(ctx context.Context, host, method string, params url.Values, result any) error {
+	u := "http://" + host + "/rpc/" + method + "?" + params.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("shelly %s %s failed (%d): %s", host, method, resp.StatusCode, body)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("decode shelly %s %s: %w", host, method, err)
+	}
+	return nil
+}
+
+// SetSwitch turns the relay on or off (Switch.Set).
+func (c *ShellyClient) SetSwitch(ctx context.Context, target ShellyTarget, on bool) error {
+	params := url.Values{"id": {strconv.Itoa(target.SwitchID)}, "on": {strconv.FormatBool(on)}}
+	return c.rpc(ctx, target.Host, "Switch.Set", params, nil)
+}
+
+// SwitchOutput returns whether the relay is on (Switch.GetStatus).
+func (c *ShellyClient) SwitchOutput(ctx context.Context, target ShellyTarget) (bool, error) {
+	var status struct {
+		Output bool `json:"output"`
+	}
+	params := url.Values{"id": {strconv.Itoa(target.SwitchID)}}
+	err := c.rpc(ctx, target.Host, "Switch.GetStatus", params, &status)
+	return status.Output, err
+}
+
+// shellyRoute diverts call_service proxy messages for Shelly-backed inverters from
+// mqttSenderWorker to shellyWorker, after the safety interlock has checked them. Calls
+// the Shelly can't take come back on fallback and go to Home Assistant as usual.
+type shellyRoute struct {
+	targets  map[string]ShellyTarget // switch entity ID -> relay
+	calls    chan MQTTMessage
+	fallback chan MQTTMessage
+}
+
+// newShellyRoute returns a route for the inverters with a Shelly target, or nil if none
+// have one.
+func newShellyRoute(inverters []InverterInfo) *shellyRoute {
+	targets := make(map[string]ShellyTarget)
+	for _, inv := range inverters {
+		if inv.Shelly != nil {
+			targets[inv.EntityID] = *inv.Shelly
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	return &shellyRoute{
+		targets:  targets,
+		calls:    make(chan MQTTMessage, 100),
+		fallback: make(chan MQTTMessage, 100),
+	}
+}
+
+// Handles reports whether msg is a service call for a Shelly-backed entity. Safe on a
+// nil route.
+func (r *shellyRoute) Handles(msg MQTTMessage) bool {
+	if r == nil || msg.Topic != TopicCallServiceProxy {
+		return false
+	}
+	var call proxyServiceCall
+	if err := json.Unmarshal(msg.Payload, &call); err != nil {
+		return false
+	}
+	_, ok := r.targets[call.EntityID]
+	return ok
+}
+
+// toHomeAssistant hands a service call back to mqttSenderWorker.
+func (r *shellyRoute) toHomeAssistant(ctx context.Context, msg MQTTMessage) {
+	select {
+	case r.fallback <- msg:
+	case <-ctx.Done():
+	}
+}
+
+// shellyWorker switches Shelly-backed inverters directly, so control keeps working while
+// Home Assistant restarts. Every relay is health checked each shellyHealthInterval; calls
+// for a relay that failed its last check or call go to Home Assistant until it passes one.
+func shellyWorker(ctx context.Context, route *shellyRoute, client *ShellyClient) {
+	log.Println("Shelly worker started")
+
+	unhealthy := make(map[string]bool) // host -> failed its last check or call
+
+	checkHealth := func() {
+		for entityID, target := range route.targets {
+			_, err := client.SwitchOutput(ctx, target)
+			if ctx.Err() != nil {
+				return
+			}
+			failed := err != nil
+			if failed != unhealthy[target.Host] {
+				if failed {
+					log.Printf("Shelly %s (%s) unreachable, using Home Assistant: %v\n", target.Host, entityID, err)
+				} else {
+					log.Printf("Shelly %s (%s) reachable again\n", target.Host, entityID)
+				}
+			}
+			unhealthy[target.Host] = failed
+		}
+	}
+	checkHealth()
+
+	ticker := time.NewTicker(shellyHealthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg := <-route.calls:
+			var call proxyServiceCall
+			if err := json.Unmarshal(msg.Payload, &call); err != nil {
+				log.Printf("Shelly worker: invalid service call payload: %v\n", err)
+				continue
+			}
+			target := route.targets[call.EntityID]
+			if unhealthy[target.Host] || (call.Service != "turn_on" && call.Service != "turn_off") {
+				route.toHomeAssistant(ctx, msg)
+				continue
+			}
+
+			if err := client.SetSwitch(ctx, target, call.Service == "turn_on"); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Printf("Shelly worker: %s %s: %v, using Home Assistant\n", call.Service, call.EntityID, err)
+				unhealthy[target.Host] = true
+				route.toHomeAssistant(ctx, msg)
+			}
+
+		case <-ticker.C:
+			checkHealth()
+
+		case <-ctx.Done():
+			log.Println("Shelly worker stopped")
+			return
+		}
+	}
+}
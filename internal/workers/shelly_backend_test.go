@@ -0,0 +1,85 @@
+package workers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeShelly serves Switch.Set and Switch.GetStatus, recording Switch.Set queries.
+type fakeShelly struct {
+	sets chan string
+	fail bool
+}
+
+func (f *fakeShelly) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.fail {
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+		return
+	}
+	switch r.URL.Path {
+	case "/rpc/Switch.Set":
+		f.sets <- r.URL.RawQuery
+		_, _ = w.Write([]byte(`{"was_on":false}`))
+	case "/rpc/Switch.GetStatus":
+		_, _ = w.Write([]byte(`{"id":0,"output":true,"apower":241.5}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func startFakeShelly(t *testing.T, fail bool) (*fakeShelly, ShellyTarget) {
+	f := &fakeShelly{sets: make(chan string, 10), fail: fail}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return f, ShellyTarget{Host: strings.TrimPrefix(server.URL, "http://")}
+}
+
+func TestShellyClient_SetAndStatus(t *testing.T) {
+	f, target := startFakeShelly(t, false)
+	client := NewShellyClient()
+
+	assert.NoError(t, client.SetSwitch(context.Background(), target, true))
+	assert.Equal(t, "id=0&on=true", <-f.sets)
+
+	on, err := client.SwitchOutput(context.Background(), target)
+	assert.NoError(t, err)
+	assert.True(t, on)
+}
+
+func TestShellyWorker_FallsBackWhenUnreachable(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	f, healthy := startFakeShelly(t, false)
+	_, broken := startFakeShelly(t, true)
+	route := newShellyRoute([]InverterInfo{
+		{EntityID: "switch.inv_1", Shelly: &healthy},
+		{EntityID: "switch.inv_2", Shelly: &broken},
+		{EntityID: "switch.inv_3"},
+	})
+	assert.False(t, route.Handles(serviceCallMessage("switch", "turn_on", "switch.inv_3", nil)))
+	go shellyWorker(ctx, route, NewShellyClient())
+
+	route.calls <- serviceCallMessage("switch", "turn_off", "switch.inv_1", nil)
+	select {
+	case query := <-f.sets:
+		assert.Equal(t, "id=0&on=false", query)
+	case <-time.After(time.Second):
+		t.Fatal("no Switch.Set")
+	}
+
+	msg := serviceCallMessage("switch", "turn_on", "switch.inv_2", nil)
+	route.calls <- msg
+	select {
+	case fallback := <-route.fallback:
+		assert.Equal(t, msg.Payload, fallback.Payload)
+	case <-time.After(time.Second):
+		t.Fatal("no fallback to Home Assistant")
+	}
+}
@@ -0,0 +1,354 @@
+package workers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/ryansname/powerctl/governor"
+)
+
+// SimVoltagePoint is one point of a battery's resting voltage curve.
+type SimVoltagePoint struct {
+	SOC   float64 // %
+	Volts float64
+}
+
+// defaultSimVoltageCurve is a rough 16S LiFePO4 resting curve: flat through the
+// middle, falling away below 10%.
+var defaultSimVoltageCurve = []SimVoltagePoint{
+	{0, 48.0}, {10, 50.8}, {30, 52.0}, {90, 53.2}, {100, 53.6},
+}
+
+// defaultSimLoadProfile is the house load (W) by local hour used without --load.
+var defaultSimLoadProfile = [24]float64{
+	450, 400, 400, 400, 400, 500, 900, 1200, 900, 700, 600, 600,
+	650, 600, 600, 700, 900, 1500, 1800, 1500, 1100, 800, 600, 500,
+}
+
+// SimModel holds the simple plant models `powerctl simulate` runs the baseline
+// controller against.
+type SimModel struct {
+	StartSOC           float64 // %
+	CapacityWh         float64
+	ChargeEfficiency   float64 // share of charger output stored
+	ConversionLossRate float64 // extra drain per Wh the inverters put out, as in the SOC worker
+	WattsPerInverter   float64
+	VoltageCurve       []SimVoltagePoint
+	SagPerInverter     float64                  // V the battery sags per inverter on
+	Forecast           governor.ForecastPeriods // pv_estimate (kW) of the Solcast site
+	SolarMultiplier    float64                  // scales the forecast site to Battery 2's charger
+	LoadWatts          [24]float64              // house load by local hour
+}
+
+// NewSimModel creates the model of Battery 2 from its BatteryConfig.
+func NewSimModel(b BatteryConfig, forecast governor.ForecastPeriods, startSOC float64) SimModel {
+	return SimModel{
+		StartSOC:           startSOC,
+		CapacityWh:         b.CapacityKWh * 1000,
+		ChargeEfficiency:   0.95,
+		ConversionLossRate: b.ConversionLossRate,
+		WattsPerInverter:   255,
+		VoltageCurve:       defaultSimVoltageCurve,
+		SagPerInverter:     0.05,
+		Forecast:           forecast,
+		SolarMultiplier:    solarForecastMultiplier,
+		LoadWatts:          defaultSimLoadProfile,
+	}
+}
+
+// Voltage returns the battery voltage at soc with inverters on.
+func (m SimModel) Voltage(soc float64, inverters int) float64 {
+	curve := m.VoltageCurve
+	v := curve[len(curve)-1].Volts
+	if soc <= curve[0].SOC {
+		v = curve[0].Volts
+	}
+	for i := 1; i < len(curve); i++ {
+		lo, hi := curve[i-1], curve[i]
+		if soc >= lo.SOC && soc <= hi.SOC {
+			v = lo.Volts + (hi.Volts-lo.Volts)*(soc-lo.SOC)/(hi.SOC-lo.SOC)
+			break
+		}
+	}
+	return v - m.SagPerInverter*float64(inverters)
+}
+
+// ChargeWatts returns the charger's output at now from the forecast.
+func (m SimModel) ChargeWatts(now time.Time) float64 {
+	return m.Forecast.GetCurrentGeneration(now) * 1000 * m.SolarMultiplier
+}
+
+// SimSample is the simulated state at one step.
+type SimSample struct {
+	Time        time.Time
+	SOC         float64
+	Voltage     float64
+	ChargeWatts float64
+	LoadWatts   float64
+	Inverters   int
+	Rule        string // what decided the count (see baselineWinner)
+}
+
+// SimResult is the outcome of a simulated run.
+type SimResult struct {
+	Samples       []SimSample
+	Switches      int                // individual inverter turn-ons and turn-offs
+	InverterHours float64            // inverter-hours on
+	DischargedWh  float64            // inverter output
+	ClippedWh     float64            // charger output with nowhere to go at 100%
+	RuleMinutes   map[string]float64 // minutes each rule decided the count
+}
+
+// simulate runs the baseline controller against model from start for duration in
+// steps of step. Inverters follow the decided count at once. Battery 3 isn't modelled,
+// so balancing against it is disabled.
+func simulate(config BaselineInverterConfig, model SimModel, start time.Time, duration, step time.Duration) SimResult {
+	config.BalanceWattsPerPercent = 0
+	controller := newBaselineController(config, nil)
+	b2Count := len(config.Battery2.Inverters)
+	result := SimResult{RuleMinutes: make(map[string]float64)}
+
+	soc, count, inFloat := model.StartSOC, 0, false
+	hours := step.Hours()
+	for now := start; now.Before(start.Add(duration)); now = now.Add(step) {
+		charge := model.ChargeWatts(now)
+		load := model.LoadWatts[now.Hour()]
+		voltage := model.Voltage(soc, count)
+
+		inFloat = soc >= 100 || (inFloat && charge > 0)
+		chargeState := "Off"
+		switch {
+		case inFloat:
+			chargeState = "Float Charging"
+		case charge > 0:
+			chargeState = "Bulk Charging"
+		}
+
+		states := make([]bool, b2Count)
+		for i := range count {
+			states[i] = true
+		}
+		input := BaselineInput{
+			Battery2SOC:             soc,
+			Battery2ChargeState:     chargeState,
+			Battery2Voltage:         voltage,
+			Battery2VoltageP50_5Min: voltage,
+			Battery2EnergyWh:        soc / 100 * model.CapacityWh,
+			HouseLoad:               load,
+			GridAvailable:           true,
+			ACFrequency:             50,
+			ACFreqP100_5Min:         50,
+			ForecastRemainingWh:     model.Forecast.SumGenerationAfter(now.Truncate(30*time.Minute)) * 1000,
+			DetailedForecast:        model.Forecast,
+			InverterStates:          states,
+			Battery3SOC:             100,
+			PowerwallSOC:            50,
+		}
+		desired, info := controller.Decide(input, now)
+		rule := baselineWinner(info)
+
+		result.Switches += max(desired-count, count-desired)
+		count = desired
+		result.RuleMinutes[rule] += step.Minutes()
+		result.Samples = append(result.Samples, SimSample{
+			Time: now, SOC: soc, Voltage: model.Voltage(soc, count),
+			ChargeWatts: charge, LoadWatts: load, Inverters: count, Rule: rule,
+		})
+
+		out := float64(count) * model.WattsPerInverter
+		result.InverterHours += float64(count) * hours
+		result.DischargedWh += out * hours
+		storedWh := (charge*model.ChargeEfficiency - out*(1+model.ConversionLossRate)) * hours
+		soc += storedWh / model.CapacityWh * 100
+		if soc > 100 {
+			result.ClippedWh += (soc - 100) / 100 * model.CapacityWh / model.ChargeEfficiency
+			soc = 100
+		}
+		soc = max(soc, 0)
+	}
+	return result
+}
+
+// writeSimCSV writes one row per sample.
+func writeSimCSV(w io.Writer, samples []SimSample) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"time", "soc", "voltage", "charge_w", "load_w", "inverters", "rule"})
+	for _, s := range samples {
+		_ = cw.Write([]string{
+			s.Time.Format(time.RFC3339),
+			strconv.FormatFloat(s.SOC, 'f', 2, 64),
+			strconv.FormatFloat(s.Voltage, 'f', 2, 64),
+			strconv.FormatFloat(s.ChargeWatts, 'f', 0, 64),
+			strconv.FormatFloat(s.LoadWatts, 'f', 0, 64),
+			strconv.Itoa(s.Inverters),
+			s.Rule,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// printSimSummary prints the SOC range, switching and rule minutes of a run.
+func printSimSummary(w io.Writer, result SimResult) {
+	if len(result.Samples) == 0 {
+		return
+	}
+	first, last := result.Samples[0], result.Samples[len(result.Samples)-1]
+	minSOC, maxSOC := first.SOC, first.SOC
+	for _, s := range result.Samples {
+		minSOC, maxSOC = min(minSOC, s.SOC), max(maxSOC, s.SOC)
+	}
+	fmt.Fprintf(w, "SOC: start %.1f%%, end %.1f%%, min %.1f%%, max %.1f%%\n", first.SOC, last.SOC, minSOC, maxSOC)
+	fmt.Fprintf(w, "Inverter switches: %d\n", result.Switches)
+	fmt.Fprintf(w, "Inverter-hours: %.1f (%.2f kWh out)\n", result.InverterHours, result.DischargedWh/1000)
+	fmt.Fprintf(w, "Clipped solar: %.2f kWh\n", result.ClippedWh/1000)
+	fmt.Fprintln(w, "Rule minutes:")
+	for _, rule := range slices.Sorted(maps.Keys(result.RuleMinutes)) {
+		fmt.Fprintf(w, "  %-24s %5.0f\n", rule, result.RuleMinutes[rule])
+	}
+}
+
+// loadSimLoadProfile reads a JSON array of 24 hourly house loads (W).
+func loadSimLoadProfile(path string) ([24]float64, error) {
+	var profile [24]float64
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return profile, err
+	}
+	var watts []float64
+	if err := json.Unmarshal(b, &watts); err != nil {
+		return profile, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(watts) != 24 {
+		return profile, fmt.Errorf("%s: want 24 hourly loads, got %d", path, len(watts))
+	}
+	copy(profile[:], watts)
+	return profile, nil
+}
+
+// simFlags are the flags shared by `powerctl simulate` and `powerctl tune` describing
+// the simulated day.
+type simFlags struct {
+	forecastPath *string
+	loadPath     *string
+	startSOC     *float64
+	step         *time.Duration
+	profilesPath *string
+	verbose      *bool
+}
+
+func addSimFlags(fs *flag.FlagSet) simFlags {
+	return simFlags{
+		forecastPath: fs.String("forecast", "", "Solcast detailed forecast JSON (the detailedForecast attribute); the day simulated is its first period's"),
+		loadPath:     fs.String("load", "", "JSON array of 24 hourly house loads in W (default: built-in profile)"),
+		startSOC:     fs.Float64("start-soc", 50, "Battery 2 SOC (%) at midnight"),
+		step:         fs.Duration("step", time.Minute, "Simulation step"),
+		profilesPath: fs.String("threshold-profiles", "", "Threshold profiles JSON file to apply"),
+		verbose:      fs.Bool("v", false, "Show the controller's log output"),
+	}
+}
+
+// simSetup is a simulated day ready to run.
+type simSetup struct {
+	config BaselineInverterConfig
+	model  SimModel
+	start  time.Time
+	step   time.Duration
+}
+
+// load reads the files the flags name and builds the day to simulate. Usage errors
+// are reported with exit code 2, unreadable files with 1.
+func (f simFlags) load() (simSetup, int, error) {
+	if *f.forecastPath == "" {
+		return simSetup{}, 2, errors.New("--forecast is required")
+	}
+	if *f.step <= 0 {
+		return simSetup{}, 2, errors.New("--step must be positive")
+	}
+
+	b, err := os.ReadFile(*f.forecastPath)
+	if err != nil {
+		return simSetup{}, 1, err
+	}
+	var forecast governor.ForecastPeriods
+	if err := json.Unmarshal(b, &forecast); err != nil || len(forecast) == 0 {
+		return simSetup{}, 1, fmt.Errorf("%s is not a non-empty forecast: %v", *f.forecastPath, err)
+	}
+
+	battery2, battery3 := DefaultBatteryConfigs()
+	config := BuildBaselineInverterConfig(battery2, battery3)
+	if *f.profilesPath != "" {
+		profiles, err := LoadThresholdProfiles(*f.profilesPath, config)
+		if err != nil {
+			return simSetup{}, 1, fmt.Errorf("threshold profiles: %w", err)
+		}
+		config.Profiles = profiles
+	}
+
+	model := NewSimModel(battery2, forecast, *f.startSOC)
+	if *f.loadPath != "" {
+		if model.LoadWatts, err = loadSimLoadProfile(*f.loadPath); err != nil {
+			return simSetup{}, 1, err
+		}
+	}
+
+	if !*f.verbose {
+		log.SetOutput(io.Discard)
+	}
+	first := forecast[0].PeriodStart.Local()
+	start := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, time.Local)
+	return simSetup{config: config, model: model, start: start, step: *f.step}, 0, nil
+}
+
+// run simulates the day with config.
+func (s simSetup) run(config BaselineInverterConfig) SimResult {
+	return simulate(config, s.model, s.start, 24*time.Hour, s.step)
+}
+
+// runSimulateCommand implements `powerctl simulate`: run the baseline controller over
+// a simulated day against Battery 2, solar from a Solcast forecast file and a house
+// load profile, then print the SOC range and switching (and the SOC curve to --out).
+func runSimulateCommand(args []string) int {
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	sim := addSimFlags(fs)
+	outPath := fs.String("out", "", "Write the SOC curve and inverter count per step to this CSV file")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	setup, code, err := sim.load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "simulate: %v\n", err)
+		return code
+	}
+	defer log.SetOutput(os.Stderr)
+	result := setup.run(setup.config)
+
+	if *outPath != "" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "simulate: %v\n", err)
+			return 1
+		}
+		err = writeSimCSV(f, result.Samples)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "simulate: %v\n", err)
+			return 1
+		}
+	}
+	fmt.Printf("Simulated %s from %.1f%% SOC\n", setup.start.Format("2006-01-02"), setup.model.StartSOC)
+	printSimSummary(os.Stdout, result)
+	return 0
+}
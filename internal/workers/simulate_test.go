@@ -0,0 +1,93 @@
+package workers
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ryansname/powerctl/governor"
+	"github.com/stretchr/testify/assert"
+)
+
+// makeSimForecast returns half-hourly periods for day peaking at peakKW at noon.
+func makeSimForecast(day time.Time, peakKW float64) governor.ForecastPeriods {
+	var periods governor.ForecastPeriods
+	for i := range 48 {
+		start := day.Add(time.Duration(i) * 30 * time.Minute)
+		h := float64(i) / 2
+		kw := 0.0
+		if h > 6 && h < 18 {
+			kw = peakKW * math.Sin((h-6)/12*math.Pi)
+		}
+		periods = append(periods, governor.ForecastPeriod{PeriodStart: start, PvEstimate: kw})
+	}
+	return periods
+}
+
+func TestSimModel_Voltage(t *testing.T) {
+	b2, _ := DefaultBatteryConfigs()
+	m := NewSimModel(b2, nil, 50)
+	assert.InDelta(t, 52.0, m.Voltage(30, 0), 1e-9)
+	assert.InDelta(t, 52.6, m.Voltage(60, 0), 1e-9, "interpolated")
+	assert.InDelta(t, 52.6-0.15, m.Voltage(60, 3), 1e-9, "sag per inverter")
+	assert.InDelta(t, 48.0, m.Voltage(-1, 0), 1e-9)
+	assert.InDelta(t, 53.6, m.Voltage(101, 0), 1e-9)
+}
+
+func TestSimulate_SunnyDay(t *testing.T) {
+	day := time.Date(2026, 3, 4, 0, 0, 0, 0, time.Local)
+	b2, b3 := DefaultBatteryConfigs()
+	config := BuildBaselineInverterConfig(b2, b3)
+	result := simulate(config, NewSimModel(b2, makeSimForecast(day, 1.0), 40), day, 24*time.Hour, time.Minute)
+
+	assert.Len(t, result.Samples, 24*60)
+	maxSOC, minSOC := 0.0, 100.0
+	for _, s := range result.Samples {
+		maxSOC, minSOC = max(maxSOC, s.SOC), min(minSOC, s.SOC)
+	}
+	assert.Equal(t, 100.0, maxSOC, "a sunny day fills the battery")
+	assert.GreaterOrEqual(t, minSOC, b2.SOCReserve.TurnOffStart-0.5, "held at the reserve floor")
+	assert.Positive(t, result.RuleMinutes["Overflow"])
+	assert.Positive(t, result.Switches)
+	assert.InDelta(t, result.InverterHours*255, result.DischargedWh, 1e-6)
+}
+
+func TestSimulate_WinterReserveHoldsMoreCharge(t *testing.T) {
+	day := time.Date(2026, 7, 4, 0, 0, 0, 0, time.Local)
+	b2, b3 := DefaultBatteryConfigs()
+	model := NewSimModel(b2, makeSimForecast(day, 0.3), 40)
+	lowest := func(config BaselineInverterConfig) float64 {
+		result := simulate(config, model, day, 24*time.Hour, time.Minute)
+		low := 100.0
+		for _, s := range result.Samples {
+			low = min(low, s.SOC)
+		}
+		return low
+	}
+
+	config := BuildBaselineInverterConfig(b2, b3)
+	summer := lowest(config)
+	config.Profiles = ThresholdProfiles{Profiles: []ThresholdProfile{{
+		Name:      "winter",
+		Months:    []time.Month{time.July},
+		Overrides: ThresholdOverrides{SOCReserve: &SOCReserve{TurnOnStart: 32.5, TurnOnEnd: 42.5, TurnOffStart: 30, TurnOffEnd: 40}},
+	}}}
+	winter := lowest(config)
+
+	assert.Less(t, summer, 20.0)
+	assert.GreaterOrEqual(t, winter, 29.5)
+}
+
+func TestLoadSimLoadProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "load.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`[1,2,3]`), 0o600))
+	_, err := loadSimLoadProfile(path)
+	assert.ErrorContains(t, err, "want 24 hourly loads, got 3")
+
+	assert.NoError(t, os.WriteFile(path, []byte(`[0,1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18,19,20,21,22,23]`), 0o600))
+	profile, err := loadSimLoadProfile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 23.0, profile[23])
+}
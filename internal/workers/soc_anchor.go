@@ -0,0 +1,61 @@
+package workers
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// SOCAnchor is a resting voltage known to mean a state of charge. Hitting one corrects
+// the coulomb count between full-charge calibrations, which can be weeks apart in
+// cloudy weather.
+type SOCAnchor struct {
+	Voltage   float64 // Resting battery voltage
+	Tolerance float64 // ±V around Voltage that counts as at the anchor
+	SOC       float64 // %
+}
+
+// lifePO4SOCAnchors16S are the anchors of a 16-cell LiFePO4 pack: 3.20V per cell at
+// rest is about 20%, just above the knee. The curve is too flat further up to anchor on.
+var lifePO4SOCAnchors16S = []SOCAnchor{
+	{Voltage: 51.2, Tolerance: 0.1, SOC: 20},
+}
+
+const (
+	// anchorRestPower is the largest net battery power (W) that counts as resting.
+	anchorRestPower = 50.0
+	// anchorRestDuration is how long a battery must rest before its voltage is trusted.
+	anchorRestDuration = 30 * time.Minute
+	// anchorMinCorrection is the smallest SOC error (%) an anchor corrects; closer
+	// estimates are left alone rather than nudged on every rest.
+	anchorMinCorrection = 5.0
+)
+
+// matchSOCAnchor returns the anchor a resting voltage is at, if any.
+func matchSOCAnchor(anchors []SOCAnchor, voltage float64) (SOCAnchor, bool) {
+	for _, a := range anchors {
+		if math.Abs(voltage-a.Voltage) <= a.Tolerance {
+			return a, true
+		}
+	}
+	return SOCAnchor{}, false
+}
+
+// anchorCalibrationOutflows returns the outflow calibration total that makes
+// calculateAvailableWh read soc percent with the inflow calibration at inflows: the
+// energy missing below full is booked as outflow since an imaginary full charge.
+func anchorCalibrationOutflows(capacityWh, outflows, lossRate, soc float64) float64 {
+	missingWh := capacityWh * (1 - soc/100)
+	return outflows - missingWh/(1000*(1+lossRate))
+}
+
+// validateSOCAnchors reports anchors outside 0–100% or with no tolerance.
+func validateSOCAnchors(anchors []SOCAnchor) error {
+	for _, a := range anchors {
+		if a.SOC <= 0 || a.SOC >= 100 || a.Tolerance <= 0 {
+			return fmt.Errorf("SOC anchor %.2fV: SOC %.1f%% must be in (0, 100) and tolerance %.2fV positive",
+				a.Voltage, a.SOC, a.Tolerance)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package workers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchSOCAnchor(t *testing.T) {
+	a, ok := matchSOCAnchor(lifePO4SOCAnchors16S, 51.25)
+	assert.True(t, ok)
+	assert.Equal(t, 20.0, a.SOC)
+
+	_, ok = matchSOCAnchor(lifePO4SOCAnchors16S, 51.4)
+	assert.False(t, ok)
+	_, ok = matchSOCAnchor(nil, 51.2)
+	assert.False(t, ok)
+}
+
+func TestAnchorCalibrationOutflows(t *testing.T) {
+	// The solved calibration point reads back as the anchor SOC
+	const capacityWh, inflows, outflows, lossRate = 9500.0, 320.4, 301.7, 0.1
+	calibOutflows := anchorCalibrationOutflows(capacityWh, outflows, lossRate, 20)
+	available := calculateAvailableWh(capacityWh, inflows, calibOutflows, inflows, outflows, lossRate)
+	assert.InDelta(t, 0.2*capacityWh, available, 1e-6)
+}
+
+func TestValidateSOCAnchors(t *testing.T) {
+	assert.NoError(t, validateSOCAnchors(lifePO4SOCAnchors16S))
+	assert.Error(t, validateSOCAnchors([]SOCAnchor{{Voltage: 51.2, Tolerance: 0.1, SOC: 100}}))
+	assert.Error(t, validateSOCAnchors([]SOCAnchor{{Voltage: 51.2, SOC: 20}}))
+}
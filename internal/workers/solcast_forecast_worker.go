@@ -0,0 +1,204 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/ryansname/powerctl/governor"
+)
+
+// Topics for the Solcast fetcher. The worker keeps the full multi-day response and
+// the fetch time retained so restarts don't spend API calls, and publishes today's
+// periods in the same shape as the HA integration's detailedForecast attribute.
+const (
+	TopicSolcastForecast  = "powerctl/solcast/detailed_forecast"
+	TopicSolcastCache     = "powerctl/solcast/forecasts"
+	TopicSolcastFetchedAt = "powerctl/solcast/fetched_at"
+
+	solcastAPIBase = "https://api.solcast.com.au"
+)
+
+// SolcastConfig holds the API credentials and call budget for the fetcher.
+type SolcastConfig struct {
+	APIKey     string
+	ResourceID string
+	BaseURL    string        // Defaults to solcastAPIBase
+	Interval   time.Duration // Minimum time between API calls (hobbyist tier allows 10/day)
+}
+
+// SolcastTopics returns the retained topics the fetcher reads back.
+func SolcastTopics() []string {
+	return []string{TopicSolcastForecast, TopicSolcastCache, TopicSolcastFetchedAt}
+}
+
+// solcastResponse is the rooftop_sites forecasts payload. Solcast reports period_end;
+// consumers work in period_start like the HA integration.
+type solcastResponse struct {
+	Forecasts []struct {
+		PeriodEnd    time.Time `json:"period_end"`
+		PvEstimate   float64   `json:"pv_estimate"`
+		PvEstimate10 float64   `json:"pv_estimate10"`
+		PvEstimate90 float64   `json:"pv_estimate90"`
+	} `json:"forecasts"`
+}
+
+// parseSolcastForecasts converts a forecasts response into 30-minute periods sorted by start.
+func parseSolcastForecasts(body []byte) (governor.ForecastPeriods, error) {
+	var resp solcastResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("parse forecasts: %w", err)
+	}
+	periods := make(governor.ForecastPeriods, len(resp.Forecasts))
+	for i, f := range resp.Forecasts {
+		periods[i] = governor.ForecastPeriod{
+			PeriodStart:  f.PeriodEnd.Add(-30 * time.Minute),
+			PvEstimate:   f.PvEstimate,
+			PvEstimate10: f.PvEstimate10,
+			PvEstimate90: f.PvEstimate90,
+		}
+	}
+	slices.SortFunc(periods, func(a, b governor.ForecastPeriod) int {
+		return a.PeriodStart.Compare(b.PeriodStart)
+	})
+	return periods, nil
+}
+
+// forecastForDay returns the periods starting on the same local calendar day as day.
+// Forecast consumers treat the list as "today" (e.g. FindSolarEndTime), so
+// tomorrow's periods must not leak in.
+func forecastForDay(periods governor.ForecastPeriods, day time.Time) governor.ForecastPeriods {
+	y, m, d := day.Date()
+	today := governor.ForecastPeriods{}
+	for _, p := range periods {
+		py, pm, pd := p.PeriodStart.In(day.Location()).Date()
+		if py == y && pm == m && pd == d {
+			today = append(today, p)
+		}
+	}
+	return today
+}
+
+// fetchSolcastForecast calls the rooftop site forecasts endpoint.
+func fetchSolcastForecast(ctx context.Context, client *http.Client, config SolcastConfig) (governor.ForecastPeriods, error) {
+	base := config.BaseURL
+	if base == "" {
+		base = solcastAPIBase
+	}
+	url := fmt.Sprintf("%s/rooftop_sites/%s/forecasts?format=json&hours=48", base, config.ResourceID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+config.APIKey)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("solcast returned %s", resp.Status)
+	}
+	return parseSolcastForecasts(body)
+}
+
+type solcastResult struct {
+	periods governor.ForecastPeriods
+	err     error
+}
+
+// solcastForecastWorker fetches the Solcast forecast at most once per Interval (tracked
+// across restarts via the retained fetched_at topic) and republishes today's periods
+// on each fetch and at each day rollover. Fetches run off the data loop so a slow API
+// doesn't back up the broadcast channel.
+func solcastForecastWorker(
+	ctx context.Context,
+	dataChan <-chan DisplayData,
+	config SolcastConfig,
+	sender *MQTTSender,
+) {
+	log.Println("Solcast forecast worker started")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	results := make(chan solcastResult, 1)
+	fetching := false
+	var lastAttempt time.Time
+	var publishedDay time.Time
+
+	publish := func(topic string, payload []byte) {
+		sender.Send(MQTTMessage{Topic: topic, Payload: payload, QoS: 1, Retain: true})
+	}
+	publishDay := func(periods governor.ForecastPeriods, now time.Time) {
+		payload, err := json.Marshal(forecastForDay(periods, now))
+		if err != nil {
+			log.Printf("Solcast: failed to marshal forecast: %v\n", err)
+			return
+		}
+		publish(TopicSolcastForecast, payload)
+		publishedDay = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	}
+
+	for {
+		select {
+		case data := <-dataChan:
+			now := time.Now()
+
+			last := time.Unix(int64(data.GetFloat(TopicSolcastFetchedAt).Current), 0)
+			if lastAttempt.After(last) {
+				last = lastAttempt
+			}
+			if !fetching && now.Sub(last) >= config.Interval {
+				fetching = true
+				lastAttempt = now
+				go func() {
+					periods, err := fetchSolcastForecast(ctx, client, config)
+					results <- solcastResult{periods, err}
+				}()
+			}
+
+			today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+			if !today.Equal(publishedDay) {
+				var cached governor.ForecastPeriods
+				data.GetJSON(TopicSolcastCache, &cached)
+				if len(cached) > 0 {
+					publishDay(cached, now)
+				}
+			}
+
+		case res := <-results:
+			fetching = false
+			if res.err != nil {
+				log.Printf("Solcast: fetch failed, retrying in %v: %v\n", config.Interval, res.err)
+				continue
+			}
+			log.Printf("Solcast: fetched %d forecast periods\n", len(res.periods))
+
+			payload, err := json.Marshal(res.periods)
+			if err != nil {
+				log.Printf("Solcast: failed to marshal forecast: %v\n", err)
+				continue
+			}
+			now := time.Now()
+			publish(TopicSolcastCache, payload)
+			publish(TopicSolcastFetchedAt, []byte(strconv.FormatInt(now.Unix(), 10)))
+			publishDay(res.periods, now)
+
+		case <-ctx.Done():
+			log.Println("Solcast forecast worker stopped")
+			return
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package workers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSolcastBody = `{"forecasts": [
+	{"pv_estimate": 1.5, "pv_estimate10": 1.0, "pv_estimate90": 2.0, "period_end": "2025-01-02T01:00:00.0000000Z", "period": "PT30M"},
+	{"pv_estimate": 2.5, "pv_estimate10": 2.0, "pv_estimate90": 3.0, "period_end": "2025-01-01T23:30:00.0000000Z", "period": "PT30M"}
+]}`
+
+func TestParseSolcastForecasts(t *testing.T) {
+	periods, err := parseSolcastForecasts([]byte(testSolcastBody))
+	assert.NoError(t, err)
+	assert.Len(t, periods, 2)
+
+	// Sorted by start, start = period_end - 30m
+	assert.Equal(t, time.Date(2025, 1, 1, 23, 0, 0, 0, time.UTC), periods[0].PeriodStart.UTC())
+	assert.InDelta(t, 2.5, periods[0].PvEstimate, 1e-9)
+	assert.Equal(t, time.Date(2025, 1, 2, 0, 30, 0, 0, time.UTC), periods[1].PeriodStart.UTC())
+	assert.InDelta(t, 2.0, periods[1].PvEstimate90, 1e-9)
+}
+
+func TestParseSolcastForecasts_Invalid(t *testing.T) {
+	_, err := parseSolcastForecasts([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestForecastForDay(t *testing.T) {
+	periods, err := parseSolcastForecasts([]byte(testSolcastBody))
+	assert.NoError(t, err)
+
+	// UTC: one period on each day
+	assert.Len(t, forecastForDay(periods, time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)), 1)
+
+	// NZDT (UTC+13): both periods fall on 2 Jan local
+	nz := time.FixedZone("NZDT", 13*3600)
+	assert.Len(t, forecastForDay(periods, time.Date(2025, 1, 2, 12, 0, 0, 0, nz)), 2)
+	assert.Empty(t, forecastForDay(periods, time.Date(2025, 1, 1, 12, 0, 0, 0, nz)))
+}
+
+func TestFetchSolcastForecast(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/rooftop_sites/abcd/forecasts", r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(testSolcastBody))
+	}))
+	defer server.Close()
+
+	config := SolcastConfig{APIKey: "secret", ResourceID: "abcd", BaseURL: server.URL}
+	periods, err := fetchSolcastForecast(context.Background(), server.Client(), config)
+	assert.NoError(t, err)
+	assert.Len(t, periods, 2)
+}
+
+func TestFetchSolcastForecast_RateLimited(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	config := SolcastConfig{APIKey: "secret", ResourceID: "abcd", BaseURL: server.URL}
+	_, err := fetchSolcastForecast(context.Background(), server.Client(), config)
+	assert.Error(t, err)
+}
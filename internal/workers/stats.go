@@ -0,0 +1,527 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/ryansname/powerctl/governor"
+	"github.com/ryansname/powerctl/internal/stats"
+)
+
+// emaTimeConstant is the time constant of FloatTopicData.EMA and Rate.
+const emaTimeConstant = time.Minute
+
+const (
+	topicHouseLoadPower2 = "homeassistant/sensor/home_sweet_home_load_power_2/state"
+	topicACFrequency     = "homeassistant/sensor/lounge_ac_frequency/state"
+	topicSolar2ACPower   = "homeassistant/sensor/primo_5_0_ac_power/state"
+)
+
+// PercentileSpec defines a specific percentile and time window combination
+type PercentileSpec struct {
+	Percentile int           // 1, 50, 66, or 99
+	Window     time.Duration // Any duration; windows over stats.ReadingsRetention cost a RollingPercentile
+}
+
+// requiredPercentiles maps topics to the specific percentile/window combinations they need.
+// Topics not in this map will only have their Current value tracked (no percentile calculations).
+// This dramatically reduces computation by only calculating what's actually used.
+var requiredPercentiles = map[string][]PercentileSpec{
+	// Solar 1 power - P50 used by power_excess_calculator; P90 used by baseline_inverter_control
+	TopicSolar1Power: {
+		{50, 5 * time.Minute},
+		{90, 15 * time.Minute},
+	},
+
+	// Tesla battery remaining - used by powerExcessCalculator for P50._5
+	"homeassistant/sensor/home_sweet_home_tg118095000r1a_battery_remaining/state": {{50, 5 * time.Minute}},
+
+	// Battery available energy - used by powerExcessCalculator for P50._5
+	TopicBattery2Energy: {{50, 5 * time.Minute}},
+
+	// AC frequency - used by baseline/dynamic controllers for high frequency protection (P100._5)
+	topicACFrequency: {{100, 5 * time.Minute}},
+
+	// Tank ADC voltages - quartiles feed tank_levels_worker's 5-minute Tukey trimean
+	TopicHeaderTankADC:  {{25, 5 * time.Minute}, {50, 5 * time.Minute}, {75, 5 * time.Minute}},
+	TopicStorageTankADC: {{25, 5 * time.Minute}, {50, 5 * time.Minute}, {75, 5 * time.Minute}},
+}
+
+// downsampleIntervals thins high-rate topics to a few readings per interval, keeping
+// the extremes, before percentiles are calculated from them (see stats.Downsampler).
+// Current, EMA and Rate still see every message.
+var downsampleIntervals = map[string]time.Duration{
+	// The lounge frequency sensor publishes several times a second; P100 only needs the peaks
+	topicACFrequency: 2 * time.Second,
+}
+
+// registerPercentile adds a percentile/window to requiredPercentiles for topics only
+// known at runtime (e.g. from BatteryConfig). Must be called before statsWorker starts.
+func registerPercentile(topic string, spec PercentileSpec) {
+	for _, existing := range requiredPercentiles[topic] {
+		if existing == spec {
+			return
+		}
+	}
+	requiredPercentiles[topic] = append(requiredPercentiles[topic], spec)
+}
+
+// PercentileKey identifies a specific percentile calculation
+type PercentileKey struct {
+	Topic      string
+	Percentile int
+	Window     time.Duration
+}
+
+// percentileScratch holds the buffers the per-second percentile refresh reuses, so it
+// doesn't allocate per topic and window.
+type percentileScratch struct {
+	readings stats.Readings // a topic's stats.ReadingRing, linearised
+	pairs    []stats.WeightedValue
+}
+
+// calculateRequiredStats calculates only the percentiles specified in the registry for a topic.
+// Results are written to the percentiles map. scratch may be nil.
+func calculateRequiredStats(
+	topic string,
+	readings stats.Readings,
+	percentiles map[PercentileKey]float64,
+	scratch *percentileScratch,
+) {
+	specs, needsPercentiles := requiredPercentiles[topic]
+	if !needsPercentiles || len(readings) == 0 {
+		return
+	}
+	if scratch == nil {
+		scratch = &percentileScratch{}
+	}
+
+	now := time.Now()
+
+	// Each window is filtered and sorted once, for every spec sharing it
+	for i, spec := range specs {
+		if spec.Window > stats.ReadingsRetention {
+			continue // see calculateLongWindowStats
+		}
+		if slices.ContainsFunc(specs[:i], func(s PercentileSpec) bool { return s.Window == spec.Window }) {
+			continue // done with an earlier spec
+		}
+
+		pairs, totalDuration, fallback := stats.PrepareWindowData(scratch.pairs, readings, spec.Window, now)
+		if pairs != nil {
+			scratch.pairs = pairs
+		}
+		for _, same := range specs[i:] {
+			if same.Window != spec.Window {
+				continue
+			}
+			value := fallback
+			if pairs != nil {
+				value = stats.CalculateSelectedPercentile(pairs, totalDuration, same.Percentile, fallback)
+			}
+			percentiles[PercentileKey{topic, same.Percentile, same.Window}] = value
+		}
+	}
+}
+
+// newLongWindowTrackers creates a RollingPercentile for each topic with a registered
+// window longer than stats.ReadingsRetention, sized to its longest window.
+func newLongWindowTrackers() map[string]*governor.RollingPercentile {
+	trackers := make(map[string]*governor.RollingPercentile)
+	for topic, specs := range requiredPercentiles {
+		var longest time.Duration
+		for _, spec := range specs {
+			longest = max(longest, spec.Window)
+		}
+		if longest > stats.ReadingsRetention {
+			trackers[topic] = governor.NewRollingPercentile(longest)
+		}
+	}
+	return trackers
+}
+
+// calculateLongWindowStats fills in the percentiles for windows longer than
+// stats.ReadingsRetention from the topic's RollingPercentile.
+func calculateLongWindowStats(
+	topic string,
+	tracker *governor.RollingPercentile,
+	percentiles map[PercentileKey]float64,
+	now time.Time,
+) {
+	for _, spec := range requiredPercentiles[topic] {
+		if spec.Window <= stats.ReadingsRetention {
+			continue
+		}
+		if value, ok := tracker.Percentile(float64(spec.Percentile), spec.Window, now); ok {
+			percentiles[PercentileKey{topic, spec.Percentile, spec.Window}] = value
+		}
+	}
+}
+
+// topicSnapshot builds the DisplayData handed downstream. One DisplayData is shared
+// by reference between all consumers, so its maps must never be written after
+// publishing: topic values are immutable (statsWorker replaces rather than mutates
+// them), so a shallow copy suffices, and is only made when something changed.
+type topicSnapshot struct {
+	dirty       bool
+	topicData   map[string]any
+	percentiles map[PercentileKey]float64
+}
+
+// markDirty records that topicData changed since the last snapshot.
+func (s *topicSnapshot) markDirty() {
+	s.dirty = true
+}
+
+// Take returns a read-only view of the current state, reusing the previous maps
+// when nothing changed.
+func (s *topicSnapshot) Take(topicData map[string]any, percentiles map[PercentileKey]float64) DisplayData {
+	if s.dirty || s.topicData == nil {
+		s.topicData = maps.Clone(topicData)
+		s.dirty = false
+	}
+	if s.percentiles == nil || !maps.Equal(s.percentiles, percentiles) {
+		s.percentiles = maps.Clone(percentiles)
+	}
+	return DisplayData{TopicData: s.topicData, Percentiles: s.percentiles}
+}
+
+func allExpectedTopicsReceived(topicData map[string]any, expectedTopics []string) bool {
+	for _, topic := range expectedTopics {
+		if _, ok := topicData[topic]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Topics pre-seeded into msgChan at startup so statsWorker doesn't block waiting
+// for values that may be absent from the broker. Real broker values override these
+// on connection. Unlike the selfPublished* defaults below, these take effect
+// immediately rather than after the startup timeout — use them when waiting would
+// block the first broadcast (e.g. topics powerctl itself publishes unretained).
+var preSeededTopics = []SensorMessage{
+	// Island mode is retained, but the first run has nothing to replay; assume grid-connected.
+	{Topic: TopicIslandModeState, Value: "OFF"},
+	// Storm mode likewise, and stays OFF when no warning topic is configured.
+	{Topic: TopicStormModeState, Value: "OFF"},
+	// Curtailment likewise, with no price or DNSP signal configured.
+	{Topic: TopicCurtailmentState, Value: "OFF"},
+	// EV reservation is published unretained by evChargingWorker, which only runs
+	// after the first broadcast; seed 0 so it doesn't block startup.
+	{Topic: TopicEVReservedPower, Value: "0"},
+	// TOU discharge is opt-in: the selfPublishedBoolTopics default of true would
+	// start discharging on a first run before the switch state arrives.
+	{Topic: TopicTOUDischargeState, Value: "off"},
+	// Solcast fetcher state is retained, but the first run has nothing to replay:
+	// an epoch fetch time triggers an immediate fetch, and an empty forecast reads
+	// as no generation until it lands.
+	{Topic: TopicSolcastForecast, Value: "[]"},
+	{Topic: TopicSolcastCache, Value: "[]"},
+	{Topic: TopicSolcastFetchedAt, Value: "0"},
+	{Topic: TopicInverter10SetpointCmd, Value: "0"},
+	// Tank ADC sentinel: real readings are >= 0, so negative means "no data yet"
+	{Topic: TopicHeaderTankADC, Value: "-1"},
+	{Topic: TopicStorageTankADC, Value: "-1"},
+	// Calibration defaults mirror the HA input_number values; statestream only
+	// republishes input_numbers on change, so they may never arrive after connect.
+	// TODO: fetch the live input_number values from HA at startup instead of hardcoding.
+	{Topic: TopicHeaderTankFullVoltage, Value: "4.76"},
+	{Topic: TopicHeaderTankEmptyVoltage, Value: "0.0"},
+	{Topic: TopicStorageTankFullVoltage, Value: "4.86"},
+	{Topic: TopicStorageTankEmptyVoltage, Value: "0.2"},
+	// Header tank level sentinel: powerctl's own publishes aren't retained, and
+	// tankLevelsWorker can't publish until the first broadcast, so a selfPublished*
+	// timeout default would stall every startup. Pre-seeding marks "no data yet"
+	// for the pump controller instantly.
+	{Topic: TopicHeaderTankLevelsState, Value: `{"percent_full": -1000}`},
+	// Ryan's lights brightness is null (statestream may not publish) while the
+	// light is off; seed 0 so the lights worker's dim doesn't block startup.
+	{Topic: TopicLightRyansBrightness, Value: "0"},
+	// Car-charging B3 SOC cutoff: a powerctl-owned number whose retained value
+	// may not arrive after connect. 20% is a placeholder default; not ideal.
+	// TODO: revisit — likely remove or rework how this cutoff is sourced.
+	{Topic: TopicCarChargingBattery3CutoffState, Value: "20"},
+	// Battery 3 SOC comes from the Cerbo via an HA entity (statestream may not
+	// republish promptly, and the Cerbo can go quiet overnight). Seed 50% rather
+	// than letting it default to 0: at 0 the controller treats B3 as empty and
+	// refuses to discharge, stranding it. Real values override this on connect.
+	{Topic: "homeassistant/sensor/battery_3_state_of_charge/state", Value: "50"},
+}
+
+// Topics that should be initialized to 0.0 if not received within timeout
+// These are self-published topics that won't exist on first startup
+var selfPublishedFloatTopics = []string{
+	TopicBattery2Energy,
+	"homeassistant/sensor/battery_2_state_of_charge/state",
+	TopicBattery3Energy,
+	// battery_3_state_of_charge is pre-seeded to 50% instead (see preSeededTopics):
+	// a 0.0 default strands B3 because the controller won't discharge what it
+	// thinks is an empty battery.
+	// Solar 2 inverter goes unavailable at night; default to 0 so startup isn't blocked
+	topicSolar2ACPower,
+	TopicManualInverterCountState,
+}
+
+// String topics that should be initialized to a default if not received within timeout
+var selfPublishedStringTopics = map[string]string{
+	TopicMinerWorkmode:     WorkmodeOff,          // dump_load_enabler controls this; default to off
+	TopicPW2DischargeMode:  PW2DischargeModeAuto, // arbiter delegates to automation by default
+	TopicInverterModeState: InverterModeAuto,     // baseline controller picks the count
+}
+
+// registerSelfPublishedFloat adds a topic only known at runtime (e.g. from
+// BatteryConfig) to selfPublishedFloatTopics. Must be called before statsWorker starts.
+func registerSelfPublishedFloat(topic string) {
+	if !slices.Contains(selfPublishedFloatTopics, topic) {
+		selfPublishedFloatTopics = append(selfPublishedFloatTopics, topic)
+	}
+}
+
+// registerSelfPublishedString adds a default to selfPublishedStringTopics for topics
+// only known at runtime (e.g. from BatteryConfig). Must be called before statsWorker
+// starts.
+func registerSelfPublishedString(topic, defaultValue string) {
+	selfPublishedStringTopics[topic] = defaultValue
+}
+
+// Boolean topics that should be initialized to true if not received within timeout
+var selfPublishedBoolTopics = []string{
+	TopicPowerctlEnabledState,
+	TopicPowerhouseInvertersEnabledState,
+	TopicExpectingPowerCutsState,
+	TopicDynamicAutoState,
+}
+
+// statsWorker receives messages, maintains statistics, and sends to output channel.
+// Energy counters are made monotonic by counters, then numeric readings quality rejects
+// are dropped (either may be nil; see EnergyCounters and DataQuality).
+func statsWorker(
+	ctx context.Context,
+	msgChan <-chan SensorMessage,
+	outputChan chan<- DisplayData,
+	expectedTopics []string,
+	counters *stats.EnergyCounters,
+	quality *DataQuality,
+) {
+	// Map of topic -> data (*FloatTopicData, *StringTopicData, *BooleanTopicData or *JSONTopicData)
+	topicData := make(map[string]any)
+	// Map of topic -> readings (for topics in requiredPercentiles only)
+	topicReadings := make(map[string]*stats.ReadingRing)
+	// High-rate topics thinned before their readings are stored
+	downsamplers := make(map[string]*stats.Downsampler)
+	for topic, interval := range downsampleIntervals {
+		downsamplers[topic] = &stats.Downsampler{Interval: interval}
+	}
+	var downsampled [3]stats.Reading
+	// Percentiles for registered topics
+	percentiles := make(map[PercentileKey]float64)
+	// History for percentile windows longer than stats.ReadingsRetention
+	longWindows := newLongWindowTrackers()
+	// Moving average and rate of change for every float topic
+	emas := make(map[string]*governor.EMA)
+	// Synthetic energy-since-midnight topics (see energy_today.go)
+	energyIntegrators, energyByTopic := newEnergyIntegrators()
+	lookupFloat := func(topic string) (float64, bool) {
+		td, ok := topicData[topic].(*stats.FloatTopicData)
+		if !ok {
+			return 0, false
+		}
+		return td.Current, true
+	}
+	// Read-only copies shared with every downstream worker
+	snapshot := &topicSnapshot{}
+	// Reused by the percentile refresh
+	scratch := &percentileScratch{}
+	// Numeric topics currently sending non-numeric payloads (logged once per outage)
+	nonNumeric := make(map[string]bool)
+	// Topics whose latest reading was rejected by quality (logged once per outage)
+	implausible := make(map[string]bool)
+
+	// Ready state tracking (for logging only: each downstream worker is gated on its
+	// own topics by broadcastWorker)
+	allTopicsReceived := false
+
+	// Timer to initialize self-published topics if not received
+	selfPublishedTimer := time.NewTimer(20 * time.Second)
+	defer selfPublishedTimer.Stop()
+
+	// Percentile refresh ticker for live updates and downstream broadcast
+	percentileTicker := time.NewTicker(1 * time.Second)
+	defer percentileTicker.Stop()
+
+	// recordFloat stores a float value and feeds everything derived from it
+	var recordFloat func(topic string, value float64, now time.Time)
+	recordFloat = func(topic string, value float64, now time.Time) {
+		ema, ok := emas[topic]
+		if !ok {
+			ema = governor.NewEMA(emaTimeConstant)
+			emas[topic] = ema
+		}
+		ema.Update(value, now)
+		for _, e := range energyByTopic[topic] {
+			e.SetPower(topic, value, now)
+		}
+
+		// Handle as float topic. Values are replaced, never mutated, so
+		// published snapshots can share them (see topicSnapshot).
+		topicData[topic] = &stats.FloatTopicData{Current: value, EMA: ema.Value, Rate: ema.Rate}
+
+		// Add new reading to internal storage (percentiles calculated on ticker)
+		if _, ok := requiredPercentiles[topic]; ok {
+			ring, ok := topicReadings[topic]
+			if !ok {
+				ring = &stats.ReadingRing{}
+				topicReadings[topic] = ring
+			}
+			reading := stats.Reading{Value: value, Timestamp: now}
+			if d, ok := downsamplers[topic]; ok {
+				for _, r := range d.Add(reading, downsampled[:0]) {
+					ring.Push(r)
+				}
+			} else {
+				ring.Push(reading)
+			}
+		}
+		if tracker, ok := longWindows[topic]; ok {
+			tracker.Add(value, now)
+		}
+
+		// Re-evaluate computed topics reading this one (which recurses to their dependents)
+		for _, c := range computedTopics {
+			if !c.DependsOn(topic) {
+				continue
+			}
+			if computed, ok := c.Evaluate(lookupFloat); ok {
+				recordFloat(c.Topic, computed, now)
+			}
+		}
+	}
+
+	for {
+		select {
+		case msg := <-msgChan:
+			// Only the declared unit may trail a number; kW/kWh are normalized to W/Wh
+			unit := topicUnits[msg.Topic]
+			payload := stats.ParsePayload(msg.Value, string(unit))
+			_, wasFloat := topicData[msg.Topic].(*stats.FloatTopicData)
+			switch {
+			case payload.IsFloat:
+				now := time.Now()
+				value, commit := counters.Correct(msg.Topic, payload.Float*unit.Scale(), now)
+				if reason := quality.Admit(msg.Topic, value, unit, now); reason != "" {
+					if !implausible[msg.Topic] {
+						log.Printf("Stats worker: ignoring implausible %s%s on %s (%s), keeping last value\n",
+							payload.Raw, unit, msg.Topic, reason)
+						implausible[msg.Topic] = true
+					}
+					continue
+				}
+				commit()
+				if implausible[msg.Topic] {
+					log.Printf("Stats worker: %s is plausible again\n", msg.Topic)
+					delete(implausible, msg.Topic)
+				}
+				if nonNumeric[msg.Topic] {
+					log.Printf("Stats worker: %s is numeric again\n", msg.Topic)
+					delete(nonNumeric, msg.Topic)
+				}
+
+				recordFloat(msg.Topic, value, now)
+			case wasFloat:
+				// A numeric topic that stops parsing keeps its last value rather than
+				// reading as 0 until it recovers
+				if !nonNumeric[msg.Topic] {
+					log.Printf("Stats worker: ignoring non-numeric %q on %s, keeping last value\n", msg.Value, msg.Topic)
+					nonNumeric[msg.Topic] = true
+				}
+				continue
+			case payload.IsBool:
+				// Repeats (e.g. statestream republishing every switch) leave the snapshot as is
+				if old, ok := topicData[msg.Topic].(*stats.BooleanTopicData); ok && old.Current == payload.Bool && old.Raw == payload.Raw {
+					continue
+				}
+				topicData[msg.Topic] = &stats.BooleanTopicData{Current: payload.Bool, Raw: payload.Raw}
+			case jsonTopicDecoders[msg.Topic] != nil:
+				if old, ok := topicData[msg.Topic].(*stats.JSONTopicData); ok && old.Raw == payload.Raw {
+					continue
+				}
+				value, err := jsonTopicDecoders[msg.Topic]([]byte(payload.Raw))
+				if err != nil {
+					log.Printf("Stats worker: ignoring invalid JSON on %s, keeping last value: %v\n", msg.Topic, err)
+					continue
+				}
+				topicData[msg.Topic] = &stats.JSONTopicData{Raw: payload.Raw, Value: value}
+			default:
+				if old, ok := topicData[msg.Topic].(*stats.StringTopicData); ok && old.Current == payload.Raw {
+					continue
+				}
+				topicData[msg.Topic] = &stats.StringTopicData{Current: payload.Raw}
+			}
+			snapshot.markDirty()
+
+			// Check if we've received all expected topics
+			if !allTopicsReceived && allExpectedTopicsReceived(topicData, expectedTopics) {
+				allTopicsReceived = true
+				log.Printf("Stats worker ready: received data for all %d topics\n", len(expectedTopics))
+			}
+
+		case <-selfPublishedTimer.C:
+			snapshot.markDirty()
+			// Initialize self-published float topics to 0.0 if not yet received
+			for _, topic := range selfPublishedFloatTopics {
+				if _, exists := topicData[topic]; !exists {
+					log.Printf("Initializing missing self-published topic to 0.0: %s\n", topic)
+					recordFloat(topic, 0.0, time.Now())
+				}
+			}
+			// Initialize self-published string topics to defaults if not yet received
+			for topic, defaultValue := range selfPublishedStringTopics {
+				if _, exists := topicData[topic]; !exists {
+					log.Printf("Initializing missing self-published topic to %q: %s\n", defaultValue, topic)
+					topicData[topic] = &stats.StringTopicData{Current: defaultValue}
+				}
+			}
+			// Initialize self-published boolean topics to true if not yet received
+			for _, topic := range selfPublishedBoolTopics {
+				if _, exists := topicData[topic]; !exists {
+					log.Printf("Initializing missing self-published topic to true: %s\n", topic)
+					topicData[topic] = &stats.BooleanTopicData{Current: true}
+				}
+			}
+
+		case <-percentileTicker.C:
+			// Recalculate percentiles for registered topics (live updates as time passes)
+			for topic, ring := range topicReadings {
+				scratch.readings = ring.AppendTo(scratch.readings[:0])
+				calculateRequiredStats(topic, scratch.readings, percentiles, scratch)
+			}
+			now := time.Now()
+			counters.Flush(now)
+			for topic, tracker := range longWindows {
+				calculateLongWindowStats(topic, tracker, percentiles, now)
+			}
+			for _, e := range energyIntegrators {
+				e.Advance(now)
+				topic := e.spec.EnergyTodayTopic()
+				if current, ok := topicData[topic].(*stats.FloatTopicData); !ok || current.Current != e.energy {
+					topicData[topic] = &stats.FloatTopicData{Current: e.energy}
+					snapshot.markDirty()
+				}
+			}
+
+			// Send updated data (non-blocking to avoid stalling if downstream is slow)
+			select {
+			case outputChan <- snapshot.Take(topicData, percentiles):
+			default:
+				// Channel full, skip this update
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
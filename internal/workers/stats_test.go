@@ -0,0 +1,177 @@
+package workers
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ryansname/powerctl/internal/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalculateRequiredStats_UpdatesSpecifiedPercentiles(t *testing.T) {
+	now := time.Now()
+	readings := stats.Readings{
+		{Value: 100.0, Timestamp: now.Add(-30 * time.Second)},
+	}
+
+	// Temporarily add a test topic to the registry
+	testTopic := "test/topic/for/unit/test"
+	requiredPercentiles[testTopic] = []PercentileSpec{
+		{50, 5 * time.Minute},
+		{99, 15 * time.Minute},
+	}
+	defer delete(requiredPercentiles, testTopic)
+
+	percentiles := make(map[PercentileKey]float64)
+	calculateRequiredStats(testTopic, readings, percentiles, nil)
+
+	// Only registered specs should be set
+	assert.Equal(t, 100.0, percentiles[PercentileKey{testTopic, 50, stats.Window5Min}])
+	assert.Equal(t, 100.0, percentiles[PercentileKey{testTopic, 99, stats.Window15Min}])
+	// Unregistered combinations should not exist
+	_, exists := percentiles[PercentileKey{testTopic, 50, 1 * time.Minute}]
+	assert.False(t, exists)
+	_, exists = percentiles[PercentileKey{testTopic, 50, stats.Window15Min}]
+	assert.False(t, exists)
+	_, exists = percentiles[PercentileKey{testTopic, 1, stats.Window15Min}]
+	assert.False(t, exists)
+}
+
+func TestTopicSnapshot_IsolatedFromLaterUpdates(t *testing.T) {
+	topicData := map[string]any{"sensor/power": &stats.FloatTopicData{Current: 42.5}}
+	percentiles := map[PercentileKey]float64{{"sensor/power", 50, stats.Window5Min}: 40}
+	snapshot := &topicSnapshot{}
+
+	first := snapshot.Take(topicData, percentiles)
+
+	// statsWorker replaces values and mutates percentiles in place
+	topicData["sensor/power"] = &stats.FloatTopicData{Current: 99}
+	topicData["climate/state"] = &stats.StringTopicData{Current: acStateCool}
+	snapshot.markDirty()
+	percentiles[PercentileKey{"sensor/power", 50, stats.Window5Min}] = 60
+
+	assert.InDelta(t, 42.5, first.GetFloat("sensor/power").Current, 0)
+	assert.Empty(t, first.GetString("climate/state"))
+	assert.InDelta(t, 40.0, first.Percentiles[PercentileKey{"sensor/power", 50, stats.Window5Min}], 0)
+
+	second := snapshot.Take(topicData, percentiles)
+	assert.InDelta(t, 99.0, second.GetFloat("sensor/power").Current, 0)
+	assert.Equal(t, acStateCool, second.GetString("climate/state"))
+	assert.InDelta(t, 60.0, second.Percentiles[PercentileKey{"sensor/power", 50, stats.Window5Min}], 0)
+}
+
+func TestTopicSnapshot_ReusesUnchangedMaps(t *testing.T) {
+	topicData := map[string]any{"sensor/power": &stats.FloatTopicData{Current: 42.5}}
+	percentiles := map[PercentileKey]float64{}
+	snapshot := &topicSnapshot{}
+
+	first := snapshot.Take(topicData, percentiles)
+	second := snapshot.Take(topicData, percentiles)
+
+	// Same underlying maps: no copy when nothing changed
+	assert.Equal(t, reflect.ValueOf(first.TopicData).Pointer(), reflect.ValueOf(second.TopicData).Pointer())
+	assert.Equal(t, reflect.ValueOf(first.Percentiles).Pointer(), reflect.ValueOf(second.Percentiles).Pointer())
+	assert.NotNil(t, first.Percentiles)
+}
+
+func TestCalculateRequiredStats_UnregisteredTopicSkipped(t *testing.T) {
+	now := time.Now()
+	readings := stats.Readings{
+		{Value: 100.0, Timestamp: now.Add(-30 * time.Second)},
+	}
+
+	// Use a topic that's not in the registry
+	unregisteredTopic := "unregistered/topic/not/in/registry"
+	percentiles := make(map[PercentileKey]float64)
+	calculateRequiredStats(unregisteredTopic, readings, percentiles, nil)
+
+	// Map should remain empty (nothing calculated for unregistered topic)
+	assert.Empty(t, percentiles)
+}
+
+func TestCalculateLongWindowStats(t *testing.T) {
+	testTopic := "test/topic/long/window"
+	requiredPercentiles[testTopic] = []PercentileSpec{
+		{66, 10 * time.Minute},
+		{50, time.Hour},
+	}
+	defer delete(requiredPercentiles, testTopic)
+
+	trackers := newLongWindowTrackers()
+	tracker, ok := trackers[testTopic]
+	assert.True(t, ok)
+	assert.Equal(t, time.Hour, tracker.MaxWindow())
+
+	now := time.Now()
+	tracker.Add(100, now.Add(-50*time.Minute))
+	tracker.Add(300, now.Add(-10*time.Minute))
+
+	percentiles := make(map[PercentileKey]float64)
+	calculateLongWindowStats(testTopic, tracker, percentiles, now)
+	assert.Equal(t, 100.0, percentiles[PercentileKey{testTopic, 50, time.Hour}])
+	_, exists := percentiles[PercentileKey{testTopic, 66, 10 * time.Minute}]
+	assert.False(t, exists, "short windows come from readings")
+}
+
+func TestStatsWorker_NumericTopicKeepsValueOnGarbage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in := make(chan SensorMessage, 10)
+	out := make(chan DisplayData, 10)
+	go statsWorker(ctx, in, out, []string{"t/voltage"}, nil, nil)
+
+	in <- SensorMessage{Topic: "t/voltage", Value: "53.2"}
+	in <- SensorMessage{Topic: "t/voltage", Value: "garbage"}
+	data := <-out
+	assert.Equal(t, 53.2, data.GetFloat("t/voltage").Current)
+
+	in <- SensorMessage{Topic: "t/voltage", Value: "52.9"}
+	for data = range out {
+		if data.GetFloat("t/voltage").Current != 53.2 {
+			break
+		}
+	}
+	assert.Equal(t, 52.9, data.GetFloat("t/voltage").Current)
+}
+
+// benchReadings returns a 15-minute history at one reading per second, the retention
+// a busy power sensor reaches.
+func benchReadings(now time.Time) stats.Readings {
+	readings := make(stats.Readings, 0, 900)
+	for i := 900; i > 0; i-- {
+		readings = append(readings, stats.Reading{Value: float64(i % 37), Timestamp: now.Add(-time.Duration(i) * time.Second)})
+	}
+	return readings
+}
+
+func BenchmarkCalculateRequiredStats(b *testing.B) {
+	readings := benchReadings(time.Now())
+	percentiles := make(map[PercentileKey]float64)
+	scratch := &percentileScratch{}
+	b.ReportAllocs()
+	for b.Loop() {
+		// Solar 1: P50 over 5m and P90 over 15m
+		calculateRequiredStats(TopicSolar1Power, readings, percentiles, scratch)
+	}
+}
+
+func BenchmarkTopicSnapshotTake(b *testing.B) {
+	// 150 topics with one changing per tick, as with a full statestream subscription
+	topicData := make(map[string]any, 150)
+	for i := range 150 {
+		topicData["homeassistant/sensor/topic_"+strconv.Itoa(i)+"/state"] = &stats.FloatTopicData{Current: float64(i)}
+	}
+	percentiles := map[PercentileKey]float64{{Topic: "t", Percentile: stats.P50, Window: stats.Window5Min}: 1}
+	snapshot := &topicSnapshot{}
+	b.ReportAllocs()
+	i := 0
+	for b.Loop() {
+		topicData["homeassistant/sensor/topic_0/state"] = &stats.FloatTopicData{Current: float64(i)}
+		snapshot.markDirty()
+		snapshot.Take(topicData, percentiles)
+		i++
+	}
+}
@@ -0,0 +1,116 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// TopicStormModeState is the retained state topic for the powerctl-owned storm mode
+// binary sensor. powerctl subscribes to it too (pre-seeded OFF in stats.go).
+const TopicStormModeState = "powerctl/binary_sensor/powerctl_storm_mode/state"
+
+// stormVoteSource is the source name this worker uses on the discharge vote channel.
+const stormVoteSource = "storm"
+
+// StormModeConfig configures severe weather load shedding.
+type StormModeConfig struct {
+	WarningTopic string        // Binary sensor, on = severe weather warning in force; "" disables storm mode
+	ClearDelay   time.Duration // Warning must be clear this long before storm mode ends
+}
+
+// Topics returns the topics the storm mode worker reads.
+func (c StormModeConfig) Topics() []string {
+	return []string{c.WarningTopic}
+}
+
+// StormModeState holds warning debounce state between evaluations.
+type StormModeState struct {
+	Active     bool
+	clearSince time.Time // when the warning last cleared while active; zero if still warning
+}
+
+// EvaluateStormMode enters storm mode as soon as a warning is issued and leaves it
+// once the warning has been clear for ClearDelay. Returns true if the mode changed.
+func EvaluateStormMode(
+	state *StormModeState,
+	config StormModeConfig,
+	warning bool,
+	now time.Time,
+) bool {
+	if warning {
+		state.clearSince = time.Time{}
+		if state.Active {
+			return false
+		}
+		state.Active = true
+		return true
+	}
+
+	if !state.Active {
+		return false
+	}
+	if state.clearSince.IsZero() {
+		state.clearSince = now
+	}
+	if now.Sub(state.clearSince) < config.ClearDelay {
+		return false
+	}
+	state.Active = false
+	state.clearSince = time.Time{}
+	return true
+}
+
+// stormModeWorker publishes storm mode while a severe weather warning is in force.
+// While on, the PW2 backup reserve is raised (expectingPowerCutsWorker), discharge is
+// vetoed, the dump load stands down and baseline control holds the island SOC reserve.
+func stormModeWorker(
+	ctx context.Context,
+	dataChan <-chan DisplayData,
+	config StormModeConfig,
+	voteChan chan<- DischargeRequest,
+	sender *MQTTSender,
+) {
+	log.Println("Storm mode worker started")
+
+	var state *StormModeState
+	var lastVote DischargeVote = -1
+
+	for {
+		select {
+		case data := <-dataChan:
+			// Resume from the retained state so a restart mid-warning stays in storm mode
+			if state == nil {
+				state = &StormModeState{Active: data.GetBoolean(TopicStormModeState)}
+			}
+
+			if EvaluateStormMode(state, config, data.GetBoolean(config.WarningTopic), time.Now()) {
+				log.Printf("Storm mode: %v\n", state.Active)
+			}
+
+			want, reason := VoteNoOpinion, "clear"
+			if state.Active {
+				want, reason = VoteOff, "severe weather warning"
+			}
+			req := DischargeRequest{Source: stormVoteSource, Want: want, Reason: reason}
+			if want != lastVote && sendWithin(ctx, voteChan, req, sendTimeout, "Storm vote") {
+				lastVote = want
+			}
+
+			payload := "OFF"
+			if state.Active {
+				payload = "ON"
+			}
+			sender.Send(MQTTMessage{
+				Topic:   TopicStormModeState,
+				Payload: []byte(payload),
+				QoS:     1,
+				Retain:  true,
+			})
+
+		case <-ctx.Done():
+			log.Println("Storm mode worker stopped")
+			return
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package workers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeTestStormConfig() StormModeConfig {
+	return StormModeConfig{
+		WarningTopic: "ha/binary_sensor/severe_weather/state",
+		ClearDelay:   2 * time.Hour,
+	}
+}
+
+func TestEvaluateStormMode_EntersImmediately(t *testing.T) {
+	state := &StormModeState{}
+	t0 := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.False(t, EvaluateStormMode(state, makeTestStormConfig(), false, t0))
+	assert.True(t, EvaluateStormMode(state, makeTestStormConfig(), true, t0.Add(time.Second)))
+	assert.True(t, state.Active)
+	assert.False(t, EvaluateStormMode(state, makeTestStormConfig(), true, t0.Add(2*time.Second)))
+}
+
+func TestEvaluateStormMode_ClearsAfterDelay(t *testing.T) {
+	config := makeTestStormConfig()
+	state := &StormModeState{Active: true}
+	t0 := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.False(t, EvaluateStormMode(state, config, false, t0))
+	assert.False(t, EvaluateStormMode(state, config, false, t0.Add(119*time.Minute)))
+	assert.True(t, state.Active)
+
+	assert.True(t, EvaluateStormMode(state, config, false, t0.Add(2*time.Hour)))
+	assert.False(t, state.Active)
+}
+
+func TestEvaluateStormMode_ReissuedWarningRestartsClearDelay(t *testing.T) {
+	config := makeTestStormConfig()
+	state := &StormModeState{Active: true}
+	t0 := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	EvaluateStormMode(state, config, false, t0)
+	EvaluateStormMode(state, config, true, t0.Add(time.Hour))
+	assert.False(t, EvaluateStormMode(state, config, false, t0.Add(150*time.Minute)),
+		"warning was reissued, so the clear timer restarted")
+	assert.True(t, state.Active)
+}
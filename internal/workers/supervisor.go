@@ -0,0 +1,343 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errUnknownWorker is returned by Pause and Resume for names never declared.
+var errUnknownWorker = errors.New("unknown worker")
+
+// errNotPausable is returned by Pause for workers not declared with GoPausable.
+var errNotPausable = errors.New("can't be paused")
+
+// Restart policy for supervised workers.
+const (
+	workerMaxRetries = 10
+	workerMaxDelay   = 10 * time.Minute
+	workerResetAfter = 2 * time.Minute // Run this long before panicking to reset the retries
+)
+
+type supervisedWorker struct {
+	name     string
+	requires []string
+	once     bool // Dependents wait for run to return, not just start
+	pausable bool // Declared with GoPausable
+	run      func(ctx context.Context)
+	ready    chan struct{}
+
+	mu     sync.Mutex
+	paused bool
+	resume chan struct{}      // Closed by Resume
+	stop   context.CancelFunc // Cancels the running instance, for Pause
+}
+
+// Supervisor launches declared workers in dependency order: a worker starts once every
+// worker it requires has started (or, for Once workers, completed). Each worker is
+// restarted on panic by superviseWorker, and its state is reported to workerStatus for
+// the watchdog and the debug REPL's workers command.
+type Supervisor struct {
+	cancel  context.CancelFunc
+	status  *WorkerStatus
+	workers []*supervisedWorker
+	byName  map[string]*supervisedWorker
+	err     error // First declaration error, returned by Start
+}
+
+// NewSupervisor creates a supervisor reporting to status. cancel shuts the app down
+// when a worker runs out of retries.
+func NewSupervisor(cancel context.CancelFunc, status *WorkerStatus) *Supervisor {
+	return &Supervisor{cancel: cancel, status: status, byName: make(map[string]*supervisedWorker)}
+}
+
+// Go declares a long-running worker. Workers requiring it start once it has started.
+func (s *Supervisor) Go(name string, requires []string, run func(ctx context.Context)) {
+	s.add(&supervisedWorker{name: name, requires: requires, run: run})
+}
+
+// GoPausable declares a long-running worker that Pause may stop. Only workers the site
+// is safe without belong here: pausing infrastructure (stats, broadcast, the MQTT
+// workers) or an inverter controller would leave the inverters latched without the
+// safety interlock, failsafe or low-voltage protection.
+func (s *Supervisor) GoPausable(name string, requires []string, run func(ctx context.Context)) {
+	s.add(&supervisedWorker{name: name, requires: requires, pausable: true, run: run})
+}
+
+// Once declares a worker that runs to completion, such as creating HA entities.
+// Workers requiring it start once it has returned.
+func (s *Supervisor) Once(name string, requires []string, run func(ctx context.Context)) {
+	s.add(&supervisedWorker{name: name, requires: requires, once: true, run: run})
+}
+
+func (s *Supervisor) add(w *supervisedWorker) {
+	if _, ok := s.byName[w.name]; ok {
+		if s.err == nil {
+			s.err = fmt.Errorf("worker %q declared twice", w.name)
+		}
+		return
+	}
+	w.ready = make(chan struct{})
+	s.workers = append(s.workers, w)
+	s.byName[w.name] = w
+}
+
+// Start checks the dependency graph and launches every worker in dependency order.
+// Nothing is launched if a worker was declared twice, requires an undeclared worker or
+// is part of a cycle.
+func (s *Supervisor) Start(ctx context.Context) error {
+	if s.err != nil {
+		return s.err
+	}
+	order, err := s.order()
+	if err != nil {
+		return err
+	}
+	for _, w := range order {
+		s.status.Declared(w.name, w.requires)
+	}
+	for _, w := range order {
+		go s.launch(ctx, w)
+	}
+	return nil
+}
+
+// order sorts the workers so each follows the workers it requires, otherwise keeping
+// declaration order.
+func (s *Supervisor) order() ([]*supervisedWorker, error) {
+	for _, w := range s.workers {
+		for _, dep := range w.requires {
+			if _, ok := s.byName[dep]; !ok {
+				return nil, fmt.Errorf("worker %q requires undeclared worker %q", w.name, dep)
+			}
+		}
+	}
+
+	placed := make(map[string]bool, len(s.workers))
+	order := make([]*supervisedWorker, 0, len(s.workers))
+	for len(order) < len(s.workers) {
+		progress := false
+		for _, w := range s.workers {
+			if placed[w.name] || !allPlaced(w.requires, placed) {
+				continue
+			}
+			placed[w.name] = true
+			order = append(order, w)
+			progress = true
+		}
+		if !progress {
+			var cycle []string
+			for _, w := range s.workers {
+				if !placed[w.name] {
+					cycle = append(cycle, w.name)
+				}
+			}
+			return nil, fmt.Errorf("worker dependency cycle among: %s", strings.Join(cycle, ", "))
+		}
+	}
+	return order, nil
+}
+
+func allPlaced(names []string, placed map[string]bool) bool {
+	for _, name := range names {
+		if !placed[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// launch waits for w's dependencies, then runs it under superviseWorker.
+func (s *Supervisor) launch(ctx context.Context, w *supervisedWorker) {
+	for _, dep := range w.requires {
+		select {
+		case <-s.byName[dep].ready:
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	var readyOnce sync.Once
+	markReady := func() { readyOnce.Do(func() { close(w.ready) }) }
+	onStart := markReady
+	if w.once {
+		onStart = nil
+	}
+	run := w.run
+	if !w.once {
+		run = w.runPausable
+	}
+	if superviseWorker(ctx, s.cancel, s.status, w.name, run, onStart) && w.once {
+		markReady()
+	}
+}
+
+// runPausable runs w until ctx is done, holding off while it is paused. Pause cancels
+// the running instance's context, so a paused worker has returned from its loop.
+func (w *supervisedWorker) runPausable(ctx context.Context) {
+	for {
+		runCtx, stop := context.WithCancel(ctx)
+		w.mu.Lock()
+		paused, resume := w.paused, w.resume
+		if !paused {
+			w.stop = stop
+		}
+		w.mu.Unlock()
+
+		if paused {
+			stop()
+			select {
+			case <-resume:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		w.run(runCtx)
+		stop()
+		w.mu.Lock()
+		paused = w.paused
+		w.mu.Unlock()
+		if !paused || ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// Pause stops a worker declared with GoPausable until Resume. Its broadcast channel fills and
+// drops updates meanwhile; on resume it starts afresh, like a restart after a panic.
+func (s *Supervisor) Pause(name string) error {
+	w, ok := s.byName[name]
+	if !ok {
+		return fmt.Errorf("%w %q", errUnknownWorker, name)
+	}
+	if w.once {
+		return fmt.Errorf("worker %q runs once and can't be paused", name)
+	}
+	if !w.pausable {
+		return fmt.Errorf("worker %q %w", name, errNotPausable)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.paused {
+		return nil
+	}
+	w.paused = true
+	w.resume = make(chan struct{})
+	if w.stop != nil {
+		w.stop()
+	}
+	s.status.Paused(name)
+	log.Printf("%s paused\n", name)
+	return nil
+}
+
+// Resume restarts a worker stopped by Pause.
+func (s *Supervisor) Resume(name string) error {
+	w, ok := s.byName[name]
+	if !ok {
+		return fmt.Errorf("%w %q", errUnknownWorker, name)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.paused {
+		return nil
+	}
+	w.paused = false
+	close(w.resume)
+	s.status.Started(name)
+	log.Printf("%s resumed\n", name)
+	return nil
+}
+
+// SafeGo launches a goroutine with panic recovery and retry logic, for goroutines
+// started at runtime rather than declared on the Supervisor.
+func SafeGo(
+	ctx context.Context,
+	cancel context.CancelFunc,
+	name string,
+	fn func(ctx context.Context),
+) {
+	workerStatus.Declared(name, nil)
+	go superviseWorker(ctx, cancel, workerStatus, name, fn, nil)
+}
+
+// superviseWorker runs fn until it returns normally, calling onStart (if set) on
+// every start. On panic, retries with exponential backoff (max 10 retries). Retry
+// count resets if the worker ran for 2+ minutes before failing. After exhausting
+// retries, cancels context to trigger shutdown. Each panic is passed to crashDumps with
+// its stack. Reports whether fn returned normally
+// rather than being abandoned.
+func superviseWorker(
+	ctx context.Context,
+	cancel context.CancelFunc,
+	status *WorkerStatus,
+	name string,
+	fn func(ctx context.Context),
+	onStart func(),
+) bool {
+	retries := 0
+	delay := time.Second
+
+	for {
+		startTime := time.Now()
+		var panicValue any
+		var stack []byte
+
+		status.Started(name)
+		if onStart != nil {
+			onStart()
+		}
+		func() {
+			defer func() {
+				if panicValue = recover(); panicValue != nil {
+					stack = debug.Stack()
+				}
+			}()
+			fn(ctx)
+		}()
+		status.Stopped(name, panicValue)
+		if panicValue != nil {
+			crashDumps.Capture(name, panicValue, stack, time.Now())
+		}
+
+		// If function returned normally (no panic), we're done
+		// This covers both context cancellation and unexpected completion
+		if panicValue == nil {
+			return true
+		}
+
+		// If ran for resetAfter duration before panicking, reset retry state
+		if time.Since(startTime) >= workerResetAfter {
+			retries = 0
+			delay = time.Second
+		}
+
+		retries++
+		log.Printf("Panic in %s (attempt %d/%d): %v\n", name, retries, workerMaxRetries, panicValue)
+
+		// Check if we've exhausted retries
+		if retries >= workerMaxRetries {
+			log.Printf("%s failed after %d retries, shutting down\n", name, workerMaxRetries)
+			status.Failed(name)
+			cancel()
+			return false
+		}
+
+		// Wait before retry with exponential backoff
+		log.Printf("%s will retry in %v\n", name, delay)
+		select {
+		case <-time.After(delay):
+			// Double delay for next time, cap at max
+			delay = min(delay*2, workerMaxDelay)
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package workers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func workerNames(workers []*supervisedWorker) []string {
+	names := make([]string, len(workers))
+	for i, w := range workers {
+		names[i] = w.name
+	}
+	return names
+}
+
+func TestSupervisor_OrdersByDependency(t *testing.T) {
+	s := NewSupervisor(func() {}, NewWorkerStatus())
+	noop := func(ctx context.Context) {}
+	s.Go("mqtt-worker", []string{"sender", "entities"}, noop)
+	s.Once("entities", []string{"sender"}, noop)
+	s.Go("stats", nil, noop)
+	s.Go("sender", nil, noop)
+
+	order, err := s.order()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"stats", "sender", "entities", "mqtt-worker"}, workerNames(order))
+}
+
+func TestSupervisor_RejectsBadGraphs(t *testing.T) {
+	noop := func(ctx context.Context) {}
+
+	s := NewSupervisor(func() {}, NewWorkerStatus())
+	s.Go("a", []string{"missing"}, noop)
+	assert.ErrorContains(t, s.Start(context.Background()), `undeclared worker "missing"`)
+
+	s = NewSupervisor(func() {}, NewWorkerStatus())
+	s.Go("a", []string{"b"}, noop)
+	s.Go("b", []string{"a"}, noop)
+	s.Go("c", nil, noop)
+	assert.ErrorContains(t, s.Start(context.Background()), "cycle among: a, b")
+
+	s = NewSupervisor(func() {}, NewWorkerStatus())
+	s.Go("a", nil, noop)
+	s.Go("a", nil, noop)
+	assert.ErrorContains(t, s.Start(context.Background()), "declared twice")
+}
+
+func TestSupervisor_StartsAfterDependencies(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	status := NewWorkerStatus()
+	s := NewSupervisor(cancel, status)
+
+	events := make(chan string, 10)
+	release := make(chan struct{})
+	s.Go("consumer", []string{"setup", "flaky"}, func(ctx context.Context) {
+		events <- "consumer"
+		<-ctx.Done()
+	})
+	s.Once("setup", nil, func(ctx context.Context) {
+		<-release
+		events <- "setup"
+	})
+	panicked := false
+	s.Go("flaky", nil, func(ctx context.Context) {
+		if !panicked {
+			panicked = true
+			panic("boom")
+		}
+		<-ctx.Done()
+	})
+	assert.NoError(t, s.Start(ctx))
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, events, "consumer waits for setup to complete")
+	close(release)
+	assert.Equal(t, "setup", <-events)
+	assert.Equal(t, "consumer", <-events)
+
+	workers := status.Workers()
+	assert.Equal(t, []string{"setup", "flaky"}, workers[0].Requires)
+	assert.Equal(t, WorkerRunning, workers[0].State)
+	assert.Equal(t, WorkerRestarting, workers[1].State, "flaky is in its retry backoff")
+	assert.Equal(t, 1, workers[1].Restarts)
+	assert.Equal(t, WorkerDone, workers[2].State)
+}
+
+func TestSupervisor_PauseAndResume(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	status := NewWorkerStatus()
+	s := NewSupervisor(cancel, status)
+
+	starts := make(chan struct{}, 10)
+	stops := make(chan struct{}, 10)
+	s.GoPausable("controller", nil, func(ctx context.Context) {
+		starts <- struct{}{}
+		<-ctx.Done()
+		stops <- struct{}{}
+	})
+	s.Once("setup", nil, func(ctx context.Context) {})
+	s.Go("sender", nil, func(ctx context.Context) { <-ctx.Done() })
+	assert.NoError(t, s.Start(ctx))
+	<-starts
+
+	assert.NoError(t, s.Pause("controller"))
+	<-stops
+	assert.Equal(t, []string{"controller"}, status.PausedWorkers())
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, starts, "stays stopped while paused")
+
+	assert.NoError(t, s.Resume("controller"))
+	<-starts
+	assert.Empty(t, status.PausedWorkers())
+	assert.Equal(t, WorkerRunning, status.Workers()[0].State)
+
+	assert.ErrorIs(t, s.Pause("missing"), errUnknownWorker)
+	assert.ErrorContains(t, s.Pause("setup"), "runs once")
+	assert.ErrorIs(t, s.Pause("sender"), errNotPausable)
+	assert.Empty(t, status.PausedWorkers())
+}
@@ -1,8 +1,9 @@
-package main
+package workers
 
 import (
 	"context"
 	"encoding/json"
+	"github.com/ryansname/powerctl/internal/stats"
 	"log"
 	"math"
 )
@@ -75,12 +76,12 @@ type TankLevelInput struct {
 // (or persistent garbage) still carries weight, so the value is not yet trustworthy
 // and must not be blended in — report "no data" instead.
 func adcTrimean(data DisplayData, topic string) float64 {
-	p25 := data.GetPercentile(topic, P25, Window5Min)
+	p25 := data.GetPercentile(topic, stats.P25, stats.Window5Min)
 	if p25 < 0 {
 		return -1
 	}
-	p50 := data.GetPercentile(topic, P50, Window5Min)
-	p75 := data.GetPercentile(topic, P75, Window5Min)
+	p50 := data.GetPercentile(topic, stats.P50, stats.Window5Min)
+	p75 := data.GetPercentile(topic, stats.P75, stats.Window5Min)
 	return (p25 + 2*p50 + p75) / 4
 }
 
@@ -1,8 +1,9 @@
-package main
+package workers
 
 import (
 	"testing"
 
+	"github.com/ryansname/powerctl/internal/stats"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -93,18 +94,18 @@ func TestComputeTankLevels_DegenerateCalibrationInvalid(t *testing.T) {
 func TestExtractTankLevelInput(t *testing.T) {
 	data := DisplayData{
 		TopicData: map[string]any{
-			TopicHeaderTankFullVoltage:   &FloatTopicData{Current: 4.76},
-			TopicHeaderTankEmptyVoltage:  &FloatTopicData{Current: 0.0},
-			TopicStorageTankFullVoltage:  &FloatTopicData{Current: 4.86},
-			TopicStorageTankEmptyVoltage: &FloatTopicData{Current: 0.2},
+			TopicHeaderTankFullVoltage:   &stats.FloatTopicData{Current: 4.76},
+			TopicHeaderTankEmptyVoltage:  &stats.FloatTopicData{Current: 0.0},
+			TopicStorageTankFullVoltage:  &stats.FloatTopicData{Current: 4.86},
+			TopicStorageTankEmptyVoltage: &stats.FloatTopicData{Current: 0.2},
 		},
 		Percentiles: map[PercentileKey]float64{
-			{TopicHeaderTankADC, P25, Window5Min}:  3.20,
-			{TopicHeaderTankADC, P50, Window5Min}:  3.23,
-			{TopicHeaderTankADC, P75, Window5Min}:  3.30,
-			{TopicStorageTankADC, P25, Window5Min}: 2.6,
-			{TopicStorageTankADC, P50, Window5Min}: 2.6,
-			{TopicStorageTankADC, P75, Window5Min}: 2.6,
+			{TopicHeaderTankADC, stats.P25, stats.Window5Min}:  3.20,
+			{TopicHeaderTankADC, stats.P50, stats.Window5Min}:  3.23,
+			{TopicHeaderTankADC, stats.P75, stats.Window5Min}:  3.30,
+			{TopicStorageTankADC, stats.P25, stats.Window5Min}: 2.6,
+			{TopicStorageTankADC, stats.P50, stats.Window5Min}: 2.6,
+			{TopicStorageTankADC, stats.P75, stats.Window5Min}: 2.6,
 		},
 	}
 
@@ -121,19 +122,19 @@ func TestExtractTankLevelInput(t *testing.T) {
 func TestExtractTankLevelInput_SentinelInLowerQuartile(t *testing.T) {
 	data := DisplayData{
 		TopicData: map[string]any{
-			TopicHeaderTankFullVoltage:   &FloatTopicData{Current: 4.76},
-			TopicHeaderTankEmptyVoltage:  &FloatTopicData{Current: 0.0},
-			TopicStorageTankFullVoltage:  &FloatTopicData{Current: 4.86},
-			TopicStorageTankEmptyVoltage: &FloatTopicData{Current: 0.2},
+			TopicHeaderTankFullVoltage:   &stats.FloatTopicData{Current: 4.76},
+			TopicHeaderTankEmptyVoltage:  &stats.FloatTopicData{Current: 0.0},
+			TopicStorageTankFullVoltage:  &stats.FloatTopicData{Current: 4.86},
+			TopicStorageTankEmptyVoltage: &stats.FloatTopicData{Current: 0.2},
 		},
 		Percentiles: map[PercentileKey]float64{
 			// Startup: the pre-seed sentinel still occupies the lower quartile.
-			{TopicHeaderTankADC, P25, Window5Min}:  -1,
-			{TopicHeaderTankADC, P50, Window5Min}:  3.23,
-			{TopicHeaderTankADC, P75, Window5Min}:  3.30,
-			{TopicStorageTankADC, P25, Window5Min}: -1,
-			{TopicStorageTankADC, P50, Window5Min}: -1,
-			{TopicStorageTankADC, P75, Window5Min}: -1,
+			{TopicHeaderTankADC, stats.P25, stats.Window5Min}:  -1,
+			{TopicHeaderTankADC, stats.P50, stats.Window5Min}:  3.23,
+			{TopicHeaderTankADC, stats.P75, stats.Window5Min}:  3.30,
+			{TopicStorageTankADC, stats.P25, stats.Window5Min}: -1,
+			{TopicStorageTankADC, stats.P50, stats.Window5Min}: -1,
+			{TopicStorageTankADC, stats.P75, stats.Window5Min}: -1,
 		},
 	}
 
@@ -0,0 +1,155 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+)
+
+// temperatureHysteresis is how far (°C) a reading must come back inside a limit before
+// a block or alert it caused is lifted.
+const temperatureHysteresis = 2.0
+
+// TemperatureConfig configures temperature derating for one battery. Temperatures in °C.
+type TemperatureConfig struct {
+	Topics           []string `json:"topics"`             // Cell and ambient sensors; the coldest and hottest reading are used
+	MinChargeTemp    float64  `json:"min_charge_temp"`    // Charging blocked below this (0 for LiFePO4)
+	MinDischargeTemp float64  `json:"min_discharge_temp"` // Discharge blocked below this
+	DerateTemp       float64  `json:"derate_temp"`        // Charge and discharge derate linearly from here...
+	MaxTemp          float64  `json:"max_temp"`           // ...to nothing here, which also raises the over-temperature alert
+}
+
+// temperatureDischargeDerateTopic returns the retained topic for a battery's allowed
+// discharge (% of its inverters). powerctl subscribes to it as well.
+func temperatureDischargeDerateTopic(batteryName string) string {
+	return batteryDerivedStateTopic(batteryName, "discharge_derate")
+}
+
+// temperatureChargeDerateTopic returns the retained topic for a battery's allowed
+// charge (% of the charge controller's maximum current).
+func temperatureChargeDerateTopic(batteryName string) string {
+	return batteryDerivedStateTopic(batteryName, "charge_derate")
+}
+
+// temperatureAlertTopic returns the retained state topic for a battery's
+// over-temperature binary sensor.
+func temperatureAlertTopic(batteryName string) string {
+	return NewTopicBuilder(batteryName).State("binary_sensor", "over_temperature")
+}
+
+// TemperatureState holds the blocks between evaluations so they release with hysteresis.
+type TemperatureState struct {
+	ChargeBlocked    bool // too cold to charge
+	DischargeBlocked bool // too cold to discharge
+	OverTemp         bool
+}
+
+// EvaluateTemperature returns the allowed discharge and charge (0-100%) for the coldest
+// and hottest readings. Above DerateTemp both fall linearly to 0 at MaxTemp.
+func EvaluateTemperature(
+	state *TemperatureState,
+	config TemperatureConfig,
+	coldest, hottest float64,
+) (discharge, charge float64) {
+	state.ChargeBlocked = belowWithHysteresis(coldest, config.MinChargeTemp, state.ChargeBlocked)
+	state.DischargeBlocked = belowWithHysteresis(coldest, config.MinDischargeTemp, state.DischargeBlocked)
+	state.OverTemp = hottest >= config.MaxTemp ||
+		(state.OverTemp && hottest > config.MaxTemp-temperatureHysteresis)
+
+	derate := 100.0
+	if state.OverTemp {
+		derate = 0
+	} else if hottest > config.DerateTemp && config.MaxTemp > config.DerateTemp {
+		derate = 100 * (config.MaxTemp - hottest) / (config.MaxTemp - config.DerateTemp)
+	}
+
+	discharge, charge = derate, derate
+	if state.DischargeBlocked {
+		discharge = 0
+	}
+	if state.ChargeBlocked {
+		charge = 0
+	}
+	return discharge, charge
+}
+
+// belowWithHysteresis reports whether value is below limit, staying true until it
+// recovers temperatureHysteresis above it.
+func belowWithHysteresis(value, limit float64, blocked bool) bool {
+	if blocked {
+		return value < limit+temperatureHysteresis
+	}
+	return value < limit
+}
+
+// temperatureDeratingWorker publishes a battery's allowed discharge and charge from its
+// temperature sensors. The baseline controller caps the inverter count and the charge
+// limit worker caps charge current from them; the over-temperature binary sensor is
+// for HA alerts.
+func temperatureDeratingWorker(
+	ctx context.Context,
+	dataChan <-chan DisplayData,
+	name string,
+	config TemperatureConfig,
+	sender *MQTTSender,
+	audit *AuditLog,
+) {
+	log.Printf("%s temperature derating worker started\n", name)
+
+	var state TemperatureState
+	started := false
+
+	for {
+		select {
+		case data := <-dataChan:
+			coldest, hottest := math.Inf(1), math.Inf(-1)
+			for _, topic := range config.Topics {
+				t := data.GetFloat(topic).Current
+				coldest = min(coldest, t)
+				hottest = max(hottest, t)
+			}
+
+			prev := state
+			discharge, charge := EvaluateTemperature(&state, config, coldest, hottest)
+			if started && state != prev {
+				log.Printf("%s: temperature %.1f–%.1f°C, charge blocked %v, discharge blocked %v, over temperature %v\n",
+					name, coldest, hottest, state.ChargeBlocked, state.DischargeBlocked, state.OverTemp)
+				audit.Record("temperature",
+					fmt.Sprintf("%s discharge %.0f%%, charge %.0f%%", name, discharge, charge),
+					map[string]float64{"coldest": coldest, "hottest": hottest})
+			}
+			started = true
+
+			// Whole percent, so sensor noise doesn't republish every update
+			sender.Send(MQTTMessage{
+				Topic:   temperatureDischargeDerateTopic(name),
+				Payload: []byte(strconv.FormatFloat(math.Floor(discharge), 'f', 0, 64)),
+				QoS:     1,
+				Retain:  true,
+			})
+			sender.Send(MQTTMessage{
+				Topic:   temperatureChargeDerateTopic(name),
+				Payload: []byte(strconv.FormatFloat(math.Floor(charge), 'f', 0, 64)),
+				QoS:     1,
+				Retain:  true,
+			})
+
+			payload := "OFF"
+			if state.OverTemp {
+				payload = "ON"
+			}
+			sender.Send(MQTTMessage{
+				Topic:   temperatureAlertTopic(name),
+				Payload: []byte(payload),
+				QoS:     1,
+				Retain:  true,
+			})
+
+		case <-ctx.Done():
+			log.Printf("%s temperature derating worker stopped\n", name)
+			return
+		}
+	}
+}
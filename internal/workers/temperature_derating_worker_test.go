@@ -0,0 +1,61 @@
+package workers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeTestTemperatureConfig() TemperatureConfig {
+	return TemperatureConfig{
+		Topics:           []string{"cell", "ambient"},
+		MinChargeTemp:    0,
+		MinDischargeTemp: -20,
+		DerateTemp:       45,
+		MaxTemp:          55,
+	}
+}
+
+func TestEvaluateTemperature_Normal(t *testing.T) {
+	var state TemperatureState
+	discharge, charge := EvaluateTemperature(&state, makeTestTemperatureConfig(), 15, 25)
+	assert.Equal(t, 100.0, discharge)
+	assert.Equal(t, 100.0, charge)
+}
+
+func TestEvaluateTemperature_FreezingBlocksChargeWithHysteresis(t *testing.T) {
+	var state TemperatureState
+	config := makeTestTemperatureConfig()
+
+	discharge, charge := EvaluateTemperature(&state, config, -0.5, 10)
+	assert.Equal(t, 100.0, discharge, "discharge is fine below freezing")
+	assert.Equal(t, 0.0, charge)
+
+	_, charge = EvaluateTemperature(&state, config, 1.0, 10)
+	assert.Equal(t, 0.0, charge, "held until 2°C above the limit")
+
+	_, charge = EvaluateTemperature(&state, config, 2.0, 10)
+	assert.Equal(t, 100.0, charge)
+}
+
+func TestEvaluateTemperature_HotDeratesThenAlerts(t *testing.T) {
+	var state TemperatureState
+	config := makeTestTemperatureConfig()
+
+	discharge, charge := EvaluateTemperature(&state, config, 20, 50)
+	assert.InDelta(t, 50.0, discharge, 1e-9)
+	assert.InDelta(t, 50.0, charge, 1e-9)
+	assert.False(t, state.OverTemp)
+
+	discharge, _ = EvaluateTemperature(&state, config, 20, 55)
+	assert.Equal(t, 0.0, discharge)
+	assert.True(t, state.OverTemp)
+
+	discharge, _ = EvaluateTemperature(&state, config, 20, 53.5)
+	assert.Equal(t, 0.0, discharge, "alert holds within the hysteresis")
+	assert.True(t, state.OverTemp)
+
+	discharge, _ = EvaluateTemperature(&state, config, 20, 52)
+	assert.InDelta(t, 30.0, discharge, 1e-9)
+	assert.False(t, state.OverTemp)
+}
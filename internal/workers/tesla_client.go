@@ -0,0 +1,181 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sync/atomic"
+)
+
+// defaultTeslaSiteID is the Powerwall 2 energy site, used when TESLA_SITE_ID is unset.
+const defaultTeslaSiteID = "2233628"
+
+// TeslaOperationMode is the Powerwall's default_real_mode.
+type TeslaOperationMode string
+
+const (
+	TeslaModeSelfConsumption TeslaOperationMode = "self_consumption"
+	TeslaModeAutonomous      TeslaOperationMode = "autonomous" // Time-Based Control
+)
+
+// TeslaExportRule is the site's customer_preferred_export_rule.
+type TeslaExportRule string
+
+const (
+	TeslaExportNever     TeslaExportRule = "never"
+	TeslaExportPVOnly    TeslaExportRule = "pv_only"
+	TeslaExportBatteryOK TeslaExportRule = "battery_ok"
+)
+
+// TeslaClient controls the Powerwall energy site. Implementations may queue the
+// command rather than confirm it, so a nil error means sent, not applied.
+type TeslaClient interface {
+	SetOperationMode(mode TeslaOperationMode) error
+	SetExportRule(rule TeslaExportRule) error
+	SetBackupReserve(percent float64) error
+	// SetTOUTariff writes a tariff_content_v2 structure (see buildTOUTariff).
+	SetTOUTariff(tariff map[string]any) error
+}
+
+// haTeslaClient drives the site through Home Assistant: tesla_custom.api service calls
+// and the backup reserve number entity. Calls are fire-and-forget through the sender.
+type haTeslaClient struct {
+	sender *MQTTSender
+	siteID string
+}
+
+// NewHATeslaClient returns a TeslaClient using the tesla_custom HA integration.
+func NewHATeslaClient(sender *MQTTSender, siteID string) TeslaClient {
+	return &haTeslaClient{sender: sender, siteID: siteID}
+}
+
+func (c *haTeslaClient) SetOperationMode(mode TeslaOperationMode) error {
+	c.api("OPERATION_MODE", map[string]any{"default_real_mode": string(mode)})
+	return nil
+}
+
+func (c *haTeslaClient) SetExportRule(rule TeslaExportRule) error {
+	c.api("ENERGY_SITE_IMPORT_EXPORT_CONFIG", map[string]any{"customer_preferred_export_rule": string(rule)})
+	return nil
+}
+
+func (c *haTeslaClient) SetBackupReserve(percent float64) error {
+	c.sender.CallService("number", "set_value", pw2BackupReserveEntity, map[string]any{
+		tariffKeyValue: percent,
+	})
+	return nil
+}
+
+func (c *haTeslaClient) SetTOUTariff(tariff map[string]any) error {
+	c.api("TIME_OF_USE_SETTINGS", map[string]any{
+		"tou_settings": map[string]any{"tariff_content_v2": tariff},
+	})
+	return nil
+}
+
+// api sends a tesla_custom.api service call. Body fields are merged into parameters
+// alongside path_vars, since the tesla_custom service pops path_vars and passes the
+// rest as kwargs.
+func (c *haTeslaClient) api(command string, body map[string]any) {
+	params := map[string]any{
+		"path_vars": map[string]any{
+			"site_id": c.siteID,
+		},
+	}
+	maps.Copy(params, body)
+	c.sender.CallService("tesla_custom", "api", "", map[string]any{
+		"command":    command,
+		"parameters": params,
+	})
+}
+
+// Errors for Powerwall commands TeslaGuard holds back.
+var (
+	errTeslaStandby   = errors.New("standby instance, command not sent")
+	errTeslaDisabled  = errors.New("powerctl disabled, command not sent")
+	errTeslaResyncing = errors.New("HA resyncing, command not sent")
+	errTeslaFailsafe  = errors.New("broker failsafe tripped, command not sent")
+)
+
+// TeslaGuard holds the filters mqttSenderWorker applies to actuation, for Powerwall
+// commands that don't pass through it. Safe for concurrent use.
+type TeslaGuard struct {
+	ForceEnable bool            // Bypass the powerctl_enabled switch
+	Leader      *LeaderElection // Optional; only the leader sends
+	Resync      *HAResync       // Optional; nothing is sent while HA resyncs
+	Failsafe    *BrokerFailsafe // Optional; nothing is sent while powerctl can't see the broker
+
+	disabled atomic.Bool // powerctl_enabled is off; enabled until told otherwise, as the sender
+}
+
+// Update follows the powerctl_enabled switch.
+func (g *TeslaGuard) Update(data DisplayData) {
+	g.disabled.Store(!data.GetBoolean(TopicPowerctlEnabledState))
+}
+
+// check returns why a command may not be sent now, or nil.
+func (g *TeslaGuard) check() error {
+	switch {
+	case !g.Leader.IsLeader():
+		return errTeslaStandby
+	case !g.ForceEnable && g.disabled.Load():
+		return errTeslaDisabled
+	case g.Resync.Holding():
+		return errTeslaResyncing
+	case g.Failsafe.Tripped():
+		return errTeslaFailsafe
+	}
+	return nil
+}
+
+// teslaGuardWorker keeps guard's enabled state current.
+func teslaGuardWorker(ctx context.Context, guard *TeslaGuard, dataChan <-chan DisplayData) {
+	for {
+		select {
+		case data := <-dataChan:
+			guard.Update(data)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// guardedTeslaClient passes commands on only while guard allows them. The Fleet API is
+// called directly, so the sender's filters never see its commands.
+type guardedTeslaClient struct {
+	next  TeslaClient
+	guard *TeslaGuard
+}
+
+// NewGuardedTeslaClient returns a TeslaClient sending through next while guard allows.
+func NewGuardedTeslaClient(next TeslaClient, guard *TeslaGuard) TeslaClient {
+	return &guardedTeslaClient{next: next, guard: guard}
+}
+
+func (c *guardedTeslaClient) SetOperationMode(mode TeslaOperationMode) error {
+	if err := c.guard.check(); err != nil {
+		return err
+	}
+	return c.next.SetOperationMode(mode)
+}
+
+func (c *guardedTeslaClient) SetExportRule(rule TeslaExportRule) error {
+	if err := c.guard.check(); err != nil {
+		return err
+	}
+	return c.next.SetExportRule(rule)
+}
+
+func (c *guardedTeslaClient) SetBackupReserve(percent float64) error {
+	if err := c.guard.check(); err != nil {
+		return err
+	}
+	return c.next.SetBackupReserve(percent)
+}
+
+func (c *guardedTeslaClient) SetTOUTariff(tariff map[string]any) error {
+	if err := c.guard.check(); err != nil {
+		return err
+	}
+	return c.next.SetTOUTariff(tariff)
+}
@@ -0,0 +1,162 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ryansname/powerctl/internal/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingTeslaClient records the commands sent to it.
+type recordingTeslaClient struct {
+	commands []string
+}
+
+func (c *recordingTeslaClient) SetOperationMode(mode TeslaOperationMode) error {
+	c.commands = append(c.commands, "mode="+string(mode))
+	return nil
+}
+
+func (c *recordingTeslaClient) SetExportRule(rule TeslaExportRule) error {
+	c.commands = append(c.commands, "export="+string(rule))
+	return nil
+}
+
+func (c *recordingTeslaClient) SetBackupReserve(percent float64) error {
+	c.commands = append(c.commands, "reserve="+strconv.FormatFloat(percent, 'f', -1, 64))
+	return nil
+}
+
+func (c *recordingTeslaClient) SetTOUTariff(tariff map[string]any) error {
+	c.commands = append(c.commands, "tariff="+tariff["name"].(string))
+	return nil
+}
+
+func TestStartStopDischarge_Commands(t *testing.T) {
+	tesla := &recordingTeslaClient{}
+	assert.NoError(t, stopDischarge(tesla, pw2DefaultReserve))
+	assert.Equal(t, []string{"tariff=Octopus", "mode=self_consumption", "export=never", "reserve=10"}, tesla.commands)
+
+	tesla.commands = nil
+	assert.NoError(t, startDischarge(tesla, 21, buildTOUTariff(DefaultTOUTariffConfig, time.Now(), 0)))
+	assert.Equal(t, "mode=autonomous", tesla.commands[1])
+	assert.Equal(t, "export=battery_ok", tesla.commands[2])
+	assert.Equal(t, "reserve=22", tesla.commands[3], "nudges off the current reserve")
+}
+
+func TestHATeslaClient_UsesConfiguredSiteID(t *testing.T) {
+	ch := make(chan MQTTMessage, 1)
+	tesla := NewHATeslaClient(NewMQTTSender(ch), "12345")
+	assert.NoError(t, tesla.SetExportRule(TeslaExportPVOnly))
+
+	var call proxyServiceCall
+	assert.NoError(t, json.Unmarshal((<-ch).Payload, &call))
+	assert.Equal(t, "tesla_custom", call.Domain)
+	params := call.Data["parameters"].(map[string]any)
+	assert.Equal(t, "12345", params["path_vars"].(map[string]any)["site_id"])
+	assert.Equal(t, "pv_only", params["customer_preferred_export_rule"])
+}
+
+func TestTeslaFleetClient_RefreshesAndRotatesToken(t *testing.T) {
+	refreshes := 0
+	var gotAuth, gotPath string
+	var gotBody map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			refreshes++
+			assert.NoError(t, r.ParseForm())
+			assert.Equal(t, "refresh_token", r.PostForm.Get("grant_type"))
+			_, _ = w.Write([]byte(`{"access_token":"access-1","refresh_token":"rotated","expires_in":28800}`))
+			return
+		}
+		gotAuth, gotPath = r.Header.Get("Authorization"), r.URL.Path
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&gotBody))
+		_, _ = w.Write([]byte(`{"response":{"code":201}}`))
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "refresh_token")
+	client := NewTeslaFleetClient(context.Background(), server.URL, "12345", "client", "original", tokenFile).(*teslaFleetClient)
+	client.tokens.authURL = server.URL + "/token"
+
+	assert.NoError(t, client.SetBackupReserve(50))
+	assert.Equal(t, "Bearer access-1", gotAuth)
+	assert.Equal(t, "/api/1/energy_sites/12345/backup", gotPath)
+	assert.Equal(t, 50.0, gotBody["backup_reserve_percent"])
+
+	saved, err := os.ReadFile(tokenFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "rotated\n", string(saved))
+
+	// The access token is reused until close to expiry
+	assert.NoError(t, client.SetOperationMode(TeslaModeAutonomous))
+	assert.Equal(t, 1, refreshes)
+	_, err = client.tokens.Token(context.Background(), time.Now().Add(8*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, refreshes)
+}
+
+func TestGuardedTeslaClient_StandbyMakesNoFleetCalls(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/token" {
+			_, _ = w.Write([]byte(`{"access_token":"access","expires_in":28800}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"response":{"code":201}}`))
+	}))
+	defer server.Close()
+
+	fleet := NewTeslaFleetClient(context.Background(), server.URL, "12345", "client", "refresh", "").(*teslaFleetClient)
+	fleet.tokens.authURL = server.URL + "/token"
+	leader := NewLeaderElection(LeaderConfig{InstanceID: "b", Lease: time.Minute})
+	tesla := NewGuardedTeslaClient(fleet, &TeslaGuard{Leader: leader})
+
+	assert.ErrorIs(t, stopDischarge(tesla, pw2DefaultReserve), errTeslaStandby)
+	assert.ErrorIs(t, startDischarge(tesla, 21, buildTOUTariff(DefaultTOUTariffConfig, time.Now(), 0)), errTeslaStandby)
+	assert.Zero(t, requests)
+
+	leader.Observe(LeaderClaim{Instance: "b"}, time.Now())
+	assert.NoError(t, tesla.SetBackupReserve(50))
+	assert.Equal(t, 2, requests, "token refresh and the command")
+}
+
+func TestTeslaGuard_AppliesSenderFilters(t *testing.T) {
+	recorder := &recordingTeslaClient{}
+	resync := NewHAResync(HAResyncConfig{CriticalTopics: []string{"homeassistant/sensor/a/state"}, Timeout: time.Minute})
+	failsafe := &BrokerFailsafe{Policy: FailsafeQueueOff, After: time.Minute}
+	guard := &TeslaGuard{Resync: resync, Failsafe: failsafe}
+	tesla := NewGuardedTeslaClient(recorder, guard)
+	enabled := func(on bool) DisplayData {
+		return DisplayData{TopicData: map[string]any{TopicPowerctlEnabledState: &stats.BooleanTopicData{Current: on}}}
+	}
+
+	guard.Update(enabled(false))
+	assert.ErrorIs(t, tesla.SetBackupReserve(50), errTeslaDisabled)
+	guard.ForceEnable = true
+	assert.NoError(t, tesla.SetBackupReserve(50))
+	guard.ForceEnable = false
+	guard.Update(enabled(true))
+
+	resync.Hold(time.Now())
+	assert.ErrorIs(t, tesla.SetOperationMode(TeslaModeAutonomous), errTeslaResyncing)
+	resync.Seen("homeassistant/sensor/a/state")
+
+	start := time.Now()
+	failsafe.Update(false, start)
+	failsafe.Update(false, start.Add(time.Minute))
+	assert.ErrorIs(t, tesla.SetExportRule(TeslaExportBatteryOK), errTeslaFailsafe)
+	failsafe.Update(true, start.Add(2*time.Minute))
+
+	assert.NoError(t, tesla.SetExportRule(TeslaExportBatteryOK))
+	assert.Equal(t, []string{"reserve=50", "export=battery_ok"}, recorder.commands)
+}
@@ -0,0 +1,187 @@
+package workers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultTeslaFleetURL is the Fleet API region used when TESLA_FLEET_URL is unset.
+	defaultTeslaFleetURL = "https://fleet-api.prd.na.vn.cloud.tesla.com"
+	// teslaAuthURL issues Fleet API access tokens.
+	teslaAuthURL = "https://auth.tesla.com/oauth2/v3/token"
+	// teslaRequestTimeout bounds each Fleet API and token request.
+	teslaRequestTimeout = 15 * time.Second
+	// teslaTokenRefreshMargin is how long before expiry an access token is replaced.
+	teslaTokenRefreshMargin = 5 * time.Minute
+)
+
+// teslaTokenSource hands out Fleet API access tokens, refreshing them with the OAuth
+// refresh token. Tesla rotates the refresh token on every refresh; with a token file
+// the latest one is saved there and preferred over the configured one on startup.
+type teslaTokenSource struct {
+	authURL      string
+	clientID     string
+	tokenFile    string
+	client       *http.Client
+	mu           sync.Mutex
+	refreshToken string
+	accessToken  string
+	expiry       time.Time
+}
+
+func newTeslaTokenSource(clientID, refreshToken, tokenFile string) *teslaTokenSource {
+	if tokenFile != "" {
+		if saved, err := os.ReadFile(tokenFile); err == nil && len(bytes.TrimSpace(saved)) > 0 {
+			refreshToken = string(bytes.TrimSpace(saved))
+		}
+	}
+	return &teslaTokenSource{
+		authURL:      teslaAuthURL,
+		clientID:     clientID,
+		tokenFile:    tokenFile,
+		client:       &http.Client{Timeout: teslaRequestTimeout},
+		refreshToken: refreshToken,
+	}
+}
+
+// Token returns a valid access token, refreshing it first if it is close to expiry.
+func (s *teslaTokenSource) Token(ctx context.Context, now time.Time) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.accessToken != "" && now.Before(s.expiry.Add(-teslaTokenRefreshMargin)) {
+		return s.accessToken, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {s.clientID},
+		"refresh_token": {s.refreshToken},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.authURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("tesla token refresh: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("tesla token refresh failed (%d): %s", resp.StatusCode, body)
+	}
+
+	var token struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("decode tesla token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("tesla token refresh returned no access token")
+	}
+
+	s.accessToken = token.AccessToken
+	s.expiry = now.Add(time.Duration(token.ExpiresIn) * time.Second)
+	if token.RefreshToken != "" && token.RefreshToken != s.refreshToken {
+		s.refreshToken = token.RefreshToken
+		if s.tokenFile != "" {
+			if err := os.WriteFile(s.tokenFile, []byte(token.RefreshToken+"\n"), 0o600); err != nil {
+				log.Printf("Failed to save rotated Tesla refresh token to %s: %v\n", s.tokenFile, err)
+			}
+		}
+	}
+	return s.accessToken, nil
+}
+
+// teslaFleetClient is a TeslaClient calling the Tesla Fleet API energy site endpoints
+// directly. Unlike haTeslaClient it reports whether Tesla accepted each command.
+type teslaFleetClient struct {
+	ctx     context.Context
+	baseURL string
+	siteID  string
+	tokens  *teslaTokenSource
+	client  *http.Client
+}
+
+// NewTeslaFleetClient returns a Fleet API TeslaClient whose requests are abandoned
+// once ctx is done. tokenFile may be empty.
+func NewTeslaFleetClient(ctx context.Context, baseURL, siteID, clientID, refreshToken, tokenFile string) TeslaClient {
+	return &teslaFleetClient{
+		ctx:     ctx,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		siteID:  siteID,
+		tokens:  newTeslaTokenSource(clientID, refreshToken, tokenFile),
+		client:  &http.Client{Timeout: teslaRequestTimeout},
+	}
+}
+
+func (c *teslaFleetClient) SetOperationMode(mode TeslaOperationMode) error {
+	return c.post("operation", map[string]any{"default_real_mode": string(mode)})
+}
+
+func (c *teslaFleetClient) SetExportRule(rule TeslaExportRule) error {
+	return c.post("grid_import_export", map[string]any{"customer_preferred_export_rule": string(rule)})
+}
+
+func (c *teslaFleetClient) SetBackupReserve(percent float64) error {
+	return c.post("backup", map[string]any{"backup_reserve_percent": int(percent)})
+}
+
+func (c *teslaFleetClient) SetTOUTariff(tariff map[string]any) error {
+	return c.post("time_of_use_settings", map[string]any{
+		"tou_settings": map[string]any{"tariff_content_v2": tariff},
+	})
+}
+
+// post sends body to an energy site command endpoint.
+func (c *teslaFleetClient) post(endpoint string, body map[string]any) error {
+	ctx, cancel := context.WithTimeout(c.ctx, teslaRequestTimeout)
+	defer cancel()
+
+	token, err := c.tokens.Token(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	u := fmt.Sprintf("%s/api/1/energy_sites/%s/%s", c.baseURL, c.siteID, endpoint)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("tesla %s: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("tesla %s failed (%d): %s", endpoint, resp.StatusCode, respBody)
+	}
+	return nil
+}
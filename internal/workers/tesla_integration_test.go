@@ -27,7 +27,7 @@
 //   - Setting "currency": "USD" is accepted; the API does not seem to enforce
 //     it against the account locale.
 
-package main
+package workers
 
 import (
 	"bytes"
@@ -43,9 +43,9 @@ import (
 )
 
 func TestMain(m *testing.M) {
-	// Load .env from the repo root (one level up from src/).
+	// Load .env from the repo root (two levels up from internal/workers/).
 	// Errors are ignored so the test still runs if vars are set in the shell.
-	_ = godotenv.Load("../.env")
+	_ = godotenv.Load("../../.env")
 	os.Exit(m.Run())
 }
 
@@ -159,7 +159,7 @@ func TestTeslaFetchCurrentTariff(t *testing.T) {
 // TestTeslaSendTOUTariff sends the force-sellback TOU tariff (same path as startDischarge)
 // to confirm the write endpoint still works with a known-good simple structure.
 func TestTeslaSendTOUTariff(t *testing.T) {
-	tariff := buildTOUTariff(time.Now())
+	tariff := buildTOUTariff(DefaultTOUTariffConfig, time.Now(), 0)
 	teslaTariffAPI(t, "TIME_OF_USE_SETTINGS", map[string]any{
 		"tou_settings": map[string]any{"tariff_content_v2": tariff},
 	}, true)
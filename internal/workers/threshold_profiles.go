@@ -0,0 +1,189 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"time"
+)
+
+// defaultProfileName is the active profile when no ThresholdProfile matches.
+const defaultProfileName = "default"
+
+// thresholdProfileSensorID is the enum sensor showing the active threshold profile.
+const thresholdProfileSensorID = "powerctl_threshold_profile"
+
+// TopicThresholdProfileState is the retained state topic of the threshold profile sensor.
+const TopicThresholdProfileState = "powerctl/sensor/" + thresholdProfileSensorID + "/state"
+
+// ThresholdOverrides replaces baseline controller thresholds while a profile is active.
+// Nil fields keep the configured value.
+type ThresholdOverrides struct {
+	PriceExportThreshold      *float64 `json:"price_export_threshold,omitempty"`
+	LowVoltageTurnOnStart     *float64 `json:"low_voltage_turn_on_start,omitempty"`
+	LowVoltageTurnOnEnd       *float64 `json:"low_voltage_turn_on_end,omitempty"`
+	LowVoltageTurnOffStart    *float64 `json:"low_voltage_turn_off_start,omitempty"`
+	LowVoltageTurnOffEnd      *float64 `json:"low_voltage_turn_off_end,omitempty"`
+	LowVoltageRecoveryVoltage *float64 `json:"low_voltage_recovery_voltage,omitempty"`
+	DrawdownReserveSOC        *float64 `json:"drawdown_reserve_soc,omitempty"`
+	// SOCReserve and IslandSOCReserve replace the whole ladder, e.g. a 30% winter floor
+	SOCReserve       *SOCReserve `json:"soc_reserve,omitempty"`
+	IslandSOCReserve *SOCReserve `json:"island_soc_reserve,omitempty"`
+	// OvernightReserve replaces the forecast-driven drawdown reserve, e.g. deeper in summer
+	OvernightReserve *OvernightReserve `json:"overnight_reserve,omitempty"`
+}
+
+// Apply returns config with the overridden thresholds replaced.
+func (o ThresholdOverrides) Apply(config BaselineInverterConfig) BaselineInverterConfig {
+	set := func(dst *float64, src *float64) {
+		if src != nil {
+			*dst = *src
+		}
+	}
+	set(&config.PriceExportThreshold, o.PriceExportThreshold)
+	set(&config.LowVoltageTurnOnStart, o.LowVoltageTurnOnStart)
+	set(&config.LowVoltageTurnOnEnd, o.LowVoltageTurnOnEnd)
+	set(&config.LowVoltageTurnOffStart, o.LowVoltageTurnOffStart)
+	set(&config.LowVoltageTurnOffEnd, o.LowVoltageTurnOffEnd)
+	set(&config.LowVoltageRecoveryVoltage, o.LowVoltageRecoveryVoltage)
+	set(&config.DrawdownReserveSOC, o.DrawdownReserveSOC)
+	if o.SOCReserve != nil {
+		config.SOCReserve = *o.SOCReserve
+	}
+	if o.IslandSOCReserve != nil {
+		config.IslandSOCReserve = *o.IslandSOCReserve
+	}
+	if o.OvernightReserve != nil {
+		config.OvernightReserve = *o.OvernightReserve
+	}
+	return config
+}
+
+// ThresholdProfile applies Overrides during the given months and local hours.
+type ThresholdProfile struct {
+	Name      string             `json:"name"`
+	Months    []time.Month       `json:"months"`    // 1–12; empty matches every month
+	FromHour  int                `json:"from_hour"` // inclusive, local time
+	ToHour    int                `json:"to_hour"`   // exclusive; may wrap midnight; equal to FromHour matches all day
+	Overrides ThresholdOverrides `json:"overrides"`
+}
+
+// Matches reports whether the profile applies at now (local time).
+func (p ThresholdProfile) Matches(now time.Time) bool {
+	if len(p.Months) > 0 && !slices.Contains(p.Months, now.Month()) {
+		return false
+	}
+	hour := now.Hour()
+	switch {
+	case p.FromHour == p.ToHour:
+		return true
+	case p.FromHour < p.ToHour:
+		return hour >= p.FromHour && hour < p.ToHour
+	default:
+		return hour >= p.FromHour || hour < p.ToHour
+	}
+}
+
+// ThresholdProfiles swaps baseline controller thresholds by season and time of day
+// (e.g. a higher low-voltage cut on winter nights). The first matching profile wins.
+type ThresholdProfiles struct {
+	Profiles []ThresholdProfile `json:"profiles"`
+}
+
+// Active returns the first profile matching now, or an empty profile named
+// defaultProfileName.
+func (p ThresholdProfiles) Active(now time.Time) ThresholdProfile {
+	for _, profile := range p.Profiles {
+		if profile.Matches(now) {
+			return profile
+		}
+	}
+	return ThresholdProfile{Name: defaultProfileName}
+}
+
+// Names returns defaultProfileName followed by each profile's name (the sensor's options).
+func (p ThresholdProfiles) Names() []string {
+	names := []string{defaultProfileName}
+	for _, profile := range p.Profiles {
+		names = append(names, profile.Name)
+	}
+	return names
+}
+
+// Validate checks each profile's schedule, and that its overrides applied to base
+// still leave the low-voltage turn-on thresholds above the turn-off thresholds and
+// valid SOC reserve ladders.
+func (p ThresholdProfiles) Validate(base BaselineInverterConfig) error {
+	var errs []error
+	seen := map[string]bool{defaultProfileName: true}
+	for _, profile := range p.Profiles {
+		if profile.Name == "" || seen[profile.Name] {
+			errs = append(errs, fmt.Errorf("profile %q: name must be unique and not %q", profile.Name, defaultProfileName))
+		}
+		seen[profile.Name] = true
+		for _, month := range profile.Months {
+			if month < time.January || month > time.December {
+				errs = append(errs, fmt.Errorf("profile %q: month %d not in 1–12", profile.Name, month))
+			}
+		}
+		if profile.FromHour < 0 || profile.FromHour > 23 || profile.ToHour < 0 || profile.ToHour > 23 {
+			errs = append(errs, fmt.Errorf("profile %q: hours must be 0–23", profile.Name))
+		}
+		c := profile.Overrides.Apply(base)
+		if c.LowVoltageTurnOnStart < c.LowVoltageTurnOffStart || c.LowVoltageTurnOnEnd < c.LowVoltageTurnOffEnd {
+			errs = append(errs, fmt.Errorf("profile %q: low-voltage turn-on thresholds (%.2f–%.2fV) below turn-off (%.2f–%.2fV)",
+				profile.Name, c.LowVoltageTurnOnStart, c.LowVoltageTurnOnEnd, c.LowVoltageTurnOffStart, c.LowVoltageTurnOffEnd))
+		}
+		if c.LowVoltageRecoveryVoltage <= 0 {
+			errs = append(errs, fmt.Errorf("profile %q: low-voltage recovery voltage must be positive", profile.Name))
+		}
+		if err := c.SOCReserve.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("profile %q: %w", profile.Name, err))
+		}
+		if err := c.IslandSOCReserve.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("profile %q: island: %w", profile.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LoadThresholdProfiles reads ThresholdProfiles from a JSON file and validates them
+// against base.
+func LoadThresholdProfiles(path string, base BaselineInverterConfig) (ThresholdProfiles, error) {
+	var profiles ThresholdProfiles
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return profiles, err
+	}
+	if err := json.Unmarshal(b, &profiles); err != nil {
+		return profiles, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return profiles, profiles.Validate(base)
+}
+
+// thresholdProfileWorker publishes the active profile name, retained, at startup and
+// whenever it changes. The baseline controller evaluates the profiles itself.
+func thresholdProfileWorker(ctx context.Context, profiles ThresholdProfiles, sender *MQTTSender) {
+	log.Println("Threshold profile worker started")
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	active := ""
+	for {
+		if name := profiles.Active(time.Now()).Name; name != active {
+			active = name
+			sender.Send(MQTTMessage{Topic: TopicThresholdProfileState, Payload: []byte(active), QoS: 1, Retain: true})
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			log.Println("Threshold profile worker stopped")
+			return
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package workers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ryansname/powerctl/governor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThresholdProfile_Matches(t *testing.T) {
+	winterNight := ThresholdProfile{
+		Name:     "winter-night",
+		Months:   []time.Month{time.June, time.July, time.August},
+		FromHour: 18,
+		ToHour:   6,
+	}
+	at := func(month time.Month, hour int) time.Time {
+		return time.Date(2026, month, 10, hour, 30, 0, 0, time.Local)
+	}
+
+	assert.True(t, winterNight.Matches(at(time.July, 18)))
+	assert.True(t, winterNight.Matches(at(time.July, 2)), "wraps midnight")
+	assert.False(t, winterNight.Matches(at(time.July, 6)), "ToHour is exclusive")
+	assert.False(t, winterNight.Matches(at(time.July, 12)))
+	assert.False(t, winterNight.Matches(at(time.January, 20)), "outside months")
+
+	allDay := ThresholdProfile{Name: "all-day"}
+	assert.True(t, allDay.Matches(at(time.March, 0)))
+	assert.True(t, allDay.Matches(at(time.March, 23)))
+}
+
+func TestThresholdProfiles_ActiveFirstMatchWins(t *testing.T) {
+	profiles := ThresholdProfiles{Profiles: []ThresholdProfile{
+		{Name: "evening", FromHour: 17, ToHour: 21},
+		{Name: "night", FromHour: 17, ToHour: 7},
+	}}
+	at := func(hour int) time.Time { return time.Date(2026, 1, 1, hour, 0, 0, 0, time.Local) }
+
+	assert.Equal(t, "evening", profiles.Active(at(18)).Name)
+	assert.Equal(t, "night", profiles.Active(at(22)).Name)
+	assert.Equal(t, defaultProfileName, profiles.Active(at(12)).Name)
+	assert.Equal(t, []string{defaultProfileName, "evening", "night"}, profiles.Names())
+}
+
+func TestThresholdOverrides_Apply(t *testing.T) {
+	base := makeScenarioBaselineConfig()
+	lv := 51.5
+	config := ThresholdOverrides{LowVoltageTurnOffStart: &lv}.Apply(base)
+	assert.Equal(t, 51.5, config.LowVoltageTurnOffStart)
+	assert.Equal(t, base.LowVoltageTurnOnStart, config.LowVoltageTurnOnStart, "unset fields keep the base value")
+	assert.Equal(t, base.PriceExportThreshold, config.PriceExportThreshold)
+}
+
+func TestApplyThresholdProfile_KeepsStep(t *testing.T) {
+	base := makeScenarioBaselineConfig()
+	state := &BaselineInverterState{
+		lowVoltage2:     &governor.SteppedHysteresis{Current: 1},
+		socLimit2:       &governor.SteppedHysteresis{Current: 9},
+		islandSOCLimit2: &governor.SteppedHysteresis{Current: 9},
+	}
+
+	// Rebuilding alone doesn't move the limit; the next reading uses the new thresholds
+	start, end := 52.0, 52.5
+	applyThresholdProfile(ThresholdOverrides{LowVoltageTurnOffStart: &start, LowVoltageTurnOffEnd: &end}.Apply(base), state)
+	assert.Equal(t, 1, state.lowVoltage2.Current)
+	assert.Equal(t, 0, state.lowVoltage2.Update(51.5), "below the raised cut-off")
+
+	applyThresholdProfile(base, state)
+	state.lowVoltage2.Current = 1
+	assert.Equal(t, 1, state.lowVoltage2.Update(51.5), "above the base cut-off")
+}
+
+func TestApplyThresholdProfile_WinterSOCReserve(t *testing.T) {
+	base := makeScenarioBaselineConfig()
+	state := &BaselineInverterState{
+		lowVoltage2:     &governor.SteppedHysteresis{Current: 9},
+		socLimit2:       base.SOCReserve.Hysteresis(9),
+		islandSOCLimit2: base.IslandSOCReserve.Hysteresis(9),
+	}
+	assert.Equal(t, 9, state.socLimit2.Update(27))
+
+	winter := SOCReserve{TurnOnStart: 32.5, TurnOnEnd: 42.5, TurnOffStart: 30, TurnOffEnd: 40}
+	applyThresholdProfile(ThresholdOverrides{SOCReserve: &winter}.Apply(base), state)
+	assert.Equal(t, 9, state.socLimit2.Current, "keeps the step")
+	assert.Equal(t, 0, state.socLimit2.Update(27), "below the winter floor")
+
+	applyThresholdProfile(base, state)
+	assert.Equal(t, 0, state.socLimit2.Update(11), "summer draws down to its floor")
+}
+
+func TestLoadThresholdProfiles(t *testing.T) {
+	base := makeScenarioBaselineConfig()
+	path := filepath.Join(t.TempDir(), "profiles.json")
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"profiles": [
+		{"name": "winter-night", "months": [6, 7, 8], "from_hour": 18, "to_hour": 6,
+		 "overrides": {"low_voltage_turn_off_start": 51.25, "price_export_threshold": 0.4}}
+	]}`), 0o600))
+	profiles, err := LoadThresholdProfiles(path, base)
+	assert.NoError(t, err)
+	if assert.Len(t, profiles.Profiles, 1) {
+		p := profiles.Profiles[0]
+		assert.Equal(t, []time.Month{time.June, time.July, time.August}, p.Months)
+		assert.Equal(t, 0.4, p.Overrides.Apply(base).PriceExportThreshold)
+	}
+
+	for name, body := range map[string]string{
+		"reserved name":     `{"profiles": [{"name": "default"}]}`,
+		"bad month":         `{"profiles": [{"name": "x", "months": [13]}]}`,
+		"bad hour":          `{"profiles": [{"name": "x", "from_hour": 24}]}`,
+		"turn-on below off": `{"profiles": [{"name": "x", "overrides": {"low_voltage_turn_on_start": 50}}]}`,
+		"soc reserve order": `{"profiles": [{"name": "x", "overrides": {"soc_reserve": {"turn_on_start": 30, "turn_on_end": 40, "turn_off_start": 35, "turn_off_end": 38}}}]}`,
+	} {
+		assert.NoError(t, os.WriteFile(path, []byte(body), 0o600))
+		_, err := LoadThresholdProfiles(path, base)
+		assert.Error(t, err, name)
+	}
+}
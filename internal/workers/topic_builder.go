@@ -0,0 +1,121 @@
+package workers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ryansname/powerctl/internal/ha"
+	"strings"
+)
+
+// entityFlagTopic returns the statestream topic for the entity ID given to flag name.
+// Empty stays empty, leaving the feature the flag enables off.
+func entityFlagTopic(name, entityID string) (string, error) {
+	if entityID == "" {
+		return "", nil
+	}
+	topic := ha.EntityStateTopic(entityID)
+	if topic == "" {
+		return "", fmt.Errorf("--%s: %q is not an entity ID (domain.object_id)", name, entityID)
+	}
+	return topic, nil
+}
+
+// TopicBuilder names the topics of one powerctl HA device (e.g. a battery), so the
+// topics powerctl publishes and the statestream topics it reads back are derived
+// the same way.
+type TopicBuilder struct {
+	deviceName string
+	deviceID   string
+}
+
+// NewTopicBuilder returns the builder for the device called deviceName.
+func NewTopicBuilder(deviceName string) TopicBuilder {
+	return TopicBuilder{deviceName: deviceName, deviceID: ha.Slugify(deviceName)}
+}
+
+// DeviceID is the device's identifier and the prefix of its object IDs.
+func (t TopicBuilder) DeviceID() string {
+	return t.deviceID
+}
+
+// ObjectID returns "<device>_<suffix>", or the device ID alone for an empty suffix.
+func (t TopicBuilder) ObjectID(suffix string) string {
+	if suffix == "" {
+		return t.deviceID
+	}
+	return t.deviceID + "_" + suffix
+}
+
+// State returns the topic powerctl publishes an entity's state on.
+func (t TopicBuilder) State(component, suffix string) string {
+	return "powerctl/" + component + "/" + t.ObjectID(suffix) + "/state"
+}
+
+// Attributes returns the topic powerctl publishes an entity's JSON attributes on.
+func (t TopicBuilder) Attributes(component, suffix string) string {
+	return "powerctl/" + component + "/" + t.ObjectID(suffix) + "/attributes"
+}
+
+// DiscoveryConfig returns the MQTT discovery topic for an entity.
+func (t TopicBuilder) DiscoveryConfig(component, suffix string) string {
+	return "homeassistant/" + component + "/" + t.ObjectID(suffix) + "/config"
+}
+
+// EntityObjectID returns the object ID HA gives the device's entity named entityName
+// (the slug of "<device name> <entity name>").
+func (t TopicBuilder) EntityObjectID(entityName string) string {
+	return ha.Slugify(t.deviceName + " " + entityName)
+}
+
+// Statestream returns the statestream topic for an attribute ("state" for the state)
+// of the device's entity named entityName.
+func (t TopicBuilder) Statestream(domain, entityName, attribute string) string {
+	return ha.StatestreamTopic(domain, t.EntityObjectID(entityName), attribute)
+}
+
+// batteryEntityNames are the names of the sensors powerctl creates on each battery's
+// HA device (see runDaemon).
+var batteryEntityNames = []string{
+	"State of Charge",
+	"Available Energy",
+	"Round Trip Efficiency",
+	"State of Health",
+	"Discharge Derate",
+	"Charge Derate",
+	"Lowest Cell Voltage",
+	"Highest Cell Voltage",
+	"Cell Delta",
+	"Time to Empty",
+	"Time to Full",
+	"Last Calibrated",
+	// Battery 3 only (Victron, see CreateBattery3*Entity)
+	"DC Power",
+	"DC Current",
+	"Charge Current Limit",
+	"Charge Voltage Limit",
+}
+
+// validateSelfPublishedTopics checks that every statestream topic subscribed under a
+// battery's device belongs to an entity powerctl creates for it, so a worker reading
+// its own output back can't be left waiting on a topic HA never publishes.
+func validateSelfPublishedTopics(batteries []BatteryConfig, subscribed []string) error {
+	var errs []error
+	for _, b := range batteries {
+		t := NewTopicBuilder(b.Name)
+		published := make(map[string]bool, len(batteryEntityNames))
+		for _, name := range batteryEntityNames {
+			published[t.EntityObjectID(name)] = true
+		}
+		for _, topic := range subscribed {
+			parts := strings.Split(topic, "/")
+			if len(parts) != 4 || parts[0] != "homeassistant" || !strings.HasPrefix(parts[2], t.DeviceID()+"_") {
+				continue
+			}
+			if !published[parts[2]] {
+				errs = append(errs, fmt.Errorf("%s: %s is not an entity powerctl publishes for %s",
+					topic, parts[2], b.Name))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
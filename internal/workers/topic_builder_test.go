@@ -0,0 +1,55 @@
+package workers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEntityFlagTopic(t *testing.T) {
+	topic, err := entityFlagTopic("export-price", "sensor.amber_feed_in_price")
+	assert.NoError(t, err)
+	assert.Equal(t, "homeassistant/sensor/amber_feed_in_price/state", topic)
+
+	topic, err = entityFlagTopic("export-price", "")
+	assert.NoError(t, err)
+	assert.Empty(t, topic, "unset leaves the feature off")
+
+	_, err = entityFlagTopic("export-price", "amber_feed_in_price")
+	assert.ErrorContains(t, err, "--export-price")
+}
+
+func TestTopicBuilder(t *testing.T) {
+	b := NewTopicBuilder("Battery 10")
+	assert.Equal(t, "battery_10", b.DeviceID())
+	assert.Equal(t, "powerctl/sensor/battery_10/state", b.State("sensor", ""))
+	assert.Equal(t, "powerctl/sensor/battery_10_charge_derate/attributes", b.Attributes("sensor", "charge_derate"))
+	assert.Equal(t, "homeassistant/sensor/battery_10_percentage/config", b.DiscoveryConfig("sensor", "percentage"))
+	assert.Equal(t, "homeassistant/sensor/battery_10_state_of_charge/state", b.Statestream("sensor", "State of Charge", "state"))
+}
+
+func TestTopicBuilder_MatchesDefaultTopics(t *testing.T) {
+	battery2, battery3 := DefaultBatteryConfigs()
+	assert.Equal(t, "homeassistant/sensor/battery_2_state_of_charge/state", battery2.SOCTopic())
+	assert.Equal(t, "homeassistant/sensor/battery_3_state_of_charge/calibration_inflows", battery3.CalibrationTopics.Inflows)
+	assert.Equal(t, "homeassistant/sensor/battery_2_state_of_health/cycles", sohHistoryTopic(battery2.Name))
+	assert.Equal(t, "powerctl/binary_sensor/battery_2_cell_undervoltage/state", bmsCellUndervoltageTopic(battery2.Name))
+	assert.Equal(t, "homeassistant/switch/powerhouse_inverter_1_switch_0/state",
+		BuildBaselineInverterConfig(battery2, battery3).Input.InverterStateTopics[0])
+}
+
+func TestValidateSelfPublishedTopics(t *testing.T) {
+	battery2, battery3 := DefaultBatteryConfigs()
+	batteries := []BatteryConfig{battery2, battery3}
+	subscribed := append(battery2.Topics(), BuildBaselineInverterConfig(battery2, battery3).Input.Topics()...)
+	assert.NoError(t, validateSelfPublishedTopics(batteries, subscribed))
+
+	// A hand-written topic that doesn't match the entity name HA derives
+	err := validateSelfPublishedTopics(batteries, []string{"homeassistant/sensor/battery_2_soc/state"})
+	assert.ErrorContains(t, err, "battery_2_soc")
+
+	// Battery 10's topics aren't mistaken for Battery 1's
+	battery1 := BatteryConfig{Name: "Battery 1"}
+	assert.NoError(t, validateSelfPublishedTopics([]BatteryConfig{battery1},
+		[]string{NewTopicBuilder("Battery 10").Statestream("sensor", "Anything", "state")}))
+}
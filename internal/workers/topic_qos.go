@@ -0,0 +1,123 @@
+package workers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TopicQoSRule overrides the QoS and/or retain flag for topics matching an MQTT filter
+// (+ and # wildcards). Unset fields keep what the subscriber or publishing worker chose.
+type TopicQoSRule struct {
+	Topic  string `json:"topic"`
+	QoS    *byte  `json:"qos,omitempty"`
+	Retain *bool  `json:"retain,omitempty"` // Publish rules only
+}
+
+// TopicQoSConfig holds per-topic QoS and retain overrides. The first matching rule wins.
+type TopicQoSConfig struct {
+	Subscribe []TopicQoSRule `json:"subscribe"`
+	Publish   []TopicQoSRule `json:"publish"`
+}
+
+// LoadTopicQoSConfig reads a TopicQoSConfig from a JSON file.
+func LoadTopicQoSConfig(path string) (TopicQoSConfig, error) {
+	var config TopicQoSConfig
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(b, &config); err != nil {
+		return config, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return config, config.Validate()
+}
+
+// Validate checks every rule has a well-formed filter and a QoS of 0-2, and that
+// subscribe rules don't set retain.
+func (c TopicQoSConfig) Validate() error {
+	var errs []error
+	check := func(kind string, rule TopicQoSRule) {
+		if err := validateTopicFilter(rule.Topic); err != nil {
+			errs = append(errs, fmt.Errorf("%s rule: %w", kind, err))
+		}
+		if rule.QoS != nil && *rule.QoS > 2 {
+			errs = append(errs, fmt.Errorf("%s rule %q: qos %d is not 0, 1 or 2", kind, rule.Topic, *rule.QoS))
+		}
+	}
+	for _, rule := range c.Subscribe {
+		check("subscribe", rule)
+		if rule.Retain != nil {
+			errs = append(errs, fmt.Errorf("subscribe rule %q: retain only applies to publishes", rule.Topic))
+		}
+	}
+	for _, rule := range c.Publish {
+		check("publish", rule)
+	}
+	return errors.Join(errs...)
+}
+
+// SubscribeQoS returns the QoS to subscribe to topic with, or base if no rule sets one.
+func (c TopicQoSConfig) SubscribeQoS(topic string, base byte) byte {
+	for _, rule := range c.Subscribe {
+		if mqttTopicMatches(rule.Topic, topic) {
+			if rule.QoS != nil {
+				return *rule.QoS
+			}
+			break
+		}
+	}
+	return base
+}
+
+// ApplyPublish returns msg with the QoS and retain flag of the first matching publish rule.
+func (c TopicQoSConfig) ApplyPublish(msg MQTTMessage) MQTTMessage {
+	for _, rule := range c.Publish {
+		if !mqttTopicMatches(rule.Topic, msg.Topic) {
+			continue
+		}
+		if rule.QoS != nil {
+			msg.QoS = *rule.QoS
+		}
+		if rule.Retain != nil {
+			msg.Retain = *rule.Retain
+		}
+		break
+	}
+	return msg
+}
+
+// validateTopicFilter checks filter is a non-empty MQTT filter: + and # must fill a
+// whole level, and # must be the last.
+func validateTopicFilter(filter string) error {
+	if filter == "" {
+		return errors.New("empty topic")
+	}
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if level != "+" && level != "#" && strings.ContainsAny(level, "+#") {
+			return fmt.Errorf("topic %q: wildcards must fill a whole level", filter)
+		}
+		if level == "#" && i != len(levels)-1 {
+			return fmt.Errorf("topic %q: # must be the last level", filter)
+		}
+	}
+	return nil
+}
+
+// mqttTopicMatches reports whether topic matches the MQTT filter.
+func mqttTopicMatches(filter, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) || (level != "+" && level != topicLevels[i]) {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
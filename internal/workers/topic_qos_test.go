@@ -0,0 +1,70 @@
+package workers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMQTTTopicMatches(t *testing.T) {
+	assert.True(t, mqttTopicMatches("homeassistant/sensor/battery_2/state", "homeassistant/sensor/battery_2/state"))
+	assert.True(t, mqttTopicMatches("homeassistant/sensor/+/state", "homeassistant/sensor/battery_2/state"))
+	assert.True(t, mqttTopicMatches("powerctl/#", "powerctl/sensor/x/attributes"))
+	assert.True(t, mqttTopicMatches("powerctl/#", "powerctl"), "# matches the parent level")
+	assert.False(t, mqttTopicMatches("homeassistant/sensor/+/state", "homeassistant/sensor/battery_2/attributes"))
+	assert.False(t, mqttTopicMatches("homeassistant/sensor/+", "homeassistant/sensor/battery_2/state"))
+	assert.False(t, mqttTopicMatches("homeassistant/sensor/battery_2/state/extra", "homeassistant/sensor/battery_2/state"))
+}
+
+func TestTopicQoSConfig_FirstMatchWins(t *testing.T) {
+	qos1, qos2, retain := byte(1), byte(2), true
+	config := TopicQoSConfig{
+		Subscribe: []TopicQoSRule{
+			{Topic: "homeassistant/switch/+/state", QoS: &qos2},
+			{Topic: "homeassistant/#", QoS: &qos1},
+		},
+		Publish: []TopicQoSRule{
+			{Topic: "homeassistant/sensor/battery_2/state", Retain: &retain},
+			{Topic: "homeassistant/sensor/#", QoS: &qos1},
+		},
+	}
+
+	assert.Equal(t, byte(2), config.SubscribeQoS("homeassistant/switch/inv_1/state", 0))
+	assert.Equal(t, byte(1), config.SubscribeQoS("homeassistant/sensor/x/state", 0))
+	assert.Equal(t, byte(1), config.SubscribeQoS("powerhouse_3/N/x", 1), "unmatched keeps the base")
+
+	msg := config.ApplyPublish(MQTTMessage{Topic: "homeassistant/sensor/battery_2/state"})
+	assert.True(t, msg.Retain)
+	assert.Equal(t, byte(0), msg.QoS, "first rule doesn't set QoS")
+
+	msg = config.ApplyPublish(MQTTMessage{Topic: "homeassistant/sensor/battery_3/state", Retain: true})
+	assert.Equal(t, byte(1), msg.QoS)
+	assert.True(t, msg.Retain, "unset retain keeps the worker's choice")
+}
+
+func TestLoadTopicQoSConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "qos.json")
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{
+		"subscribe": [{"topic": "homeassistant/switch/+/state", "qos": 1}],
+		"publish": [{"topic": "homeassistant/sensor/#", "qos": 1, "retain": true}]
+	}`), 0o600))
+	config, err := LoadTopicQoSConfig(path)
+	assert.NoError(t, err)
+	assert.Len(t, config.Subscribe, 1)
+	assert.Len(t, config.Publish, 1)
+
+	for name, body := range map[string]string{
+		"bad qos":          `{"publish": [{"topic": "a", "qos": 3}]}`,
+		"empty topic":      `{"publish": [{"qos": 1}]}`,
+		"partial wildcard": `{"subscribe": [{"topic": "a/b+"}]}`,
+		"# not last":       `{"subscribe": [{"topic": "a/#/b"}]}`,
+		"subscribe retain": `{"subscribe": [{"topic": "a", "retain": true}]}`,
+	} {
+		assert.NoError(t, os.WriteFile(path, []byte(body), 0o600))
+		_, err := LoadTopicQoSConfig(path)
+		assert.Error(t, err, name)
+	}
+}
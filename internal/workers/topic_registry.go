@@ -0,0 +1,74 @@
+package workers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+)
+
+// TopicRegistry collects the statestream topics each worker reads, so the MQTT
+// subscription (and statsWorker's startup wait) is built from the workers' own
+// declarations rather than a hand-maintained list.
+type TopicRegistry struct {
+	workers []string
+	topics  map[string][]string // worker -> topics, in registration order
+}
+
+// NewTopicRegistry creates an empty registry.
+func NewTopicRegistry() *TopicRegistry {
+	return &TopicRegistry{topics: make(map[string][]string)}
+}
+
+// Add declares topics read by worker. Calling it again for the same worker appends.
+func (r *TopicRegistry) Add(worker string, topics ...string) {
+	if _, ok := r.topics[worker]; !ok {
+		r.workers = append(r.workers, worker)
+	}
+	r.topics[worker] = append(r.topics[worker], topics...)
+}
+
+// Validate reports declarations that can't be subscribed, such as a config that
+// left a topic empty (the worker would otherwise silently read zeros).
+func (r *TopicRegistry) Validate() error {
+	var errs []error
+	for _, worker := range r.workers {
+		if len(r.topics[worker]) == 0 {
+			errs = append(errs, fmt.Errorf("%s: declares no topics", worker))
+		}
+		for i, topic := range r.topics[worker] {
+			if topic == "" {
+				errs = append(errs, fmt.Errorf("%s: topic %d is empty", worker, i))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// TopicsFor returns the topics declared by worker, or nil if it declared none.
+func (r *TopicRegistry) TopicsFor(worker string) []string {
+	return slices.Clone(r.topics[worker])
+}
+
+// Topics returns every declared topic, sorted and deduplicated.
+func (r *TopicRegistry) Topics() []string {
+	var all []string
+	for _, worker := range r.workers {
+		all = append(all, r.topics[worker]...)
+	}
+	slices.Sort(all)
+	return slices.Compact(all)
+}
+
+// unsubscribedReads records topics already warned about by warnUnsubscribedTopic.
+var unsubscribedReads sync.Map
+
+// warnUnsubscribedTopic logs (once per topic) a DisplayData read of a topic that
+// isn't in the snapshot. statsWorker only broadcasts once every subscribed topic has
+// a value, so this means a worker reads a topic nobody declared.
+func warnUnsubscribedTopic(topic string) {
+	if _, seen := unsubscribedReads.LoadOrStore(topic, true); !seen {
+		log.Printf("ERROR: read of unsubscribed topic %q (missing from TopicRegistry?)\n", topic)
+	}
+}
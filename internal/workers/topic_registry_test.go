@@ -0,0 +1,35 @@
+package workers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicRegistry_AggregatesAndDedupes(t *testing.T) {
+	r := NewTopicRegistry()
+	r.Add("a", "t/2", "t/1")
+	r.Add("b", "t/1", "t/3")
+	r.Add("a", "t/4")
+
+	assert.NoError(t, r.Validate())
+	assert.Equal(t, []string{"t/1", "t/2", "t/3", "t/4"}, r.Topics())
+}
+
+func TestTopicRegistry_ValidateEmptyTopics(t *testing.T) {
+	r := NewTopicRegistry()
+	r.Add("storm-mode", "")
+	r.Add("lights")
+
+	err := r.Validate()
+	assert.ErrorContains(t, err, "storm-mode: topic 0 is empty")
+	assert.ErrorContains(t, err, "lights: declares no topics")
+}
+
+func TestDefaultBatteryTopicsValid(t *testing.T) {
+	battery2, battery3 := DefaultBatteryConfigs()
+	r := NewTopicRegistry()
+	r.Add(battery2.Name, battery2.Topics()...)
+	r.Add(battery3.Name, battery3.Topics()...)
+	assert.NoError(t, r.Validate())
+}
@@ -0,0 +1,110 @@
+package workers
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// Unit is the unit a statestream topic reports in.
+type Unit string
+
+const (
+	UnitW       Unit = "W"
+	UnitKW      Unit = "kW"
+	UnitWh      Unit = "Wh"
+	UnitKWh     Unit = "kWh"
+	UnitV       Unit = "V"
+	UnitPercent Unit = "%"
+)
+
+// knownUnits are the units a topic may be declared in.
+var knownUnits = []Unit{UnitW, UnitKW, UnitWh, UnitKWh, UnitV, UnitPercent}
+
+// Normalized returns the unit downstream workers see after statsWorker converts a
+// reading: kW → W and kWh → Wh; everything else is unchanged.
+func (u Unit) Normalized() Unit {
+	switch u {
+	case UnitKW:
+		return UnitW
+	case UnitKWh:
+		return UnitWh
+	}
+	return u
+}
+
+// Scale is the factor that converts a reading in u to u.Normalized().
+func (u Unit) Scale() float64 {
+	if u == UnitKW || u == UnitKWh {
+		return 1000
+	}
+	return 1
+}
+
+// Plausible reports whether a normalized reading can be real: no negative voltages,
+// no percentages outside 0–100. Power and energy may be negative (charging, export).
+func (u Unit) Plausible(value float64) bool {
+	switch u.Normalized() {
+	case UnitV:
+		return value >= 0
+	case UnitPercent:
+		return value >= 0 && value <= 100
+	}
+	return true
+}
+
+// topicUnits declares the unit each numeric topic reports in. statsWorker normalizes
+// kW/kWh readings to W/Wh, so downstream workers always see base units, and drops
+// implausible readings. Topics not listed are passed through as is.
+var topicUnits = map[string]Unit{
+	// Tesla gateway (kW/kWh)
+	TopicPowerwallBatteryPower: UnitKW,
+	TopicSitePower:             UnitKW,
+	topicHouseLoadPower2:       UnitKW,
+	TopicBattery1Energy:        UnitKWh,
+	PowerwallSOCTopic:          UnitPercent,
+
+	// Solcast (kWh)
+	"homeassistant/sensor/solcast_pv_forecast_forecast_today/state": UnitKWh,
+	TopicSolcastForecastRemaining:                                   UnitKWh,
+	TopicSolcastForecastTomorrow:                                    UnitKWh,
+
+	TopicSolar1Power:    UnitW,
+	TopicBattery2Energy: UnitWh,
+	TopicBattery3Energy: UnitWh,
+
+	// Published by powerctl and read back
+	TopicEVReservedPower: UnitW,
+}
+
+// registerTopicUnit declares unit for a topic only known at runtime (e.g. from
+// BatteryConfig). Must be called before statsWorker starts.
+func registerTopicUnit(topic string, unit Unit) {
+	topicUnits[topic] = unit
+}
+
+// validateTopicUnits reports declarations with an unknown unit or an empty topic.
+func validateTopicUnits(units map[string]Unit) error {
+	topics := make([]string, 0, len(units))
+	for topic := range units {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	var errs []error
+	for _, topic := range topics {
+		if topic == "" {
+			errs = append(errs, fmt.Errorf("unit %q declared for an empty topic", units[topic]))
+		}
+		if !slices.Contains(knownUnits, units[topic]) {
+			errs = append(errs, fmt.Errorf("%s: unknown unit %q (want one of %v)", topic, units[topic], knownUnits))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// topicUnit returns the unit downstream workers see for topic, or "" if undeclared.
+func topicUnit(topic string) Unit {
+	return topicUnits[topic].Normalized()
+}
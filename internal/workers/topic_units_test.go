@@ -0,0 +1,56 @@
+package workers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnit_Normalization(t *testing.T) {
+	assert.Equal(t, UnitW, UnitKW.Normalized())
+	assert.Equal(t, UnitWh, UnitKWh.Normalized())
+	assert.Equal(t, UnitV, UnitV.Normalized())
+	assert.Equal(t, 1000.0, UnitKW.Scale())
+	assert.Equal(t, 1.0, UnitPercent.Scale())
+	assert.Equal(t, 1.0, Unit("").Scale())
+}
+
+func TestUnit_Plausible(t *testing.T) {
+	assert.True(t, UnitPercent.Plausible(100))
+	assert.False(t, UnitPercent.Plausible(100.5))
+	assert.False(t, UnitPercent.Plausible(-1))
+	assert.False(t, UnitV.Plausible(-0.1))
+	assert.True(t, UnitKW.Plausible(-3000), "power is negative while charging")
+	assert.True(t, Unit("").Plausible(-1e9))
+}
+
+func TestValidateTopicUnits(t *testing.T) {
+	assert.NoError(t, validateTopicUnits(topicUnits))
+	assert.NoError(t, validateTopicUnits(map[string]Unit{"t/power": UnitKW}))
+	assert.Error(t, validateTopicUnits(map[string]Unit{"t/power": "MW"}))
+	assert.Error(t, validateTopicUnits(map[string]Unit{"": UnitW}))
+}
+
+func TestStatsWorker_NormalizesDeclaredUnits(t *testing.T) {
+	registerTopicUnit("t/site_power", UnitKW)
+	registerTopicUnit("t/soc", UnitPercent)
+	t.Cleanup(func() {
+		delete(topicUnits, "t/site_power")
+		delete(topicUnits, "t/soc")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in := make(chan SensorMessage, 10)
+	out := make(chan DisplayData, 10)
+	go statsWorker(ctx, in, out, []string{"t/site_power", "t/soc"}, nil, nil)
+
+	in <- SensorMessage{Topic: "t/site_power", Value: "-1.25 kW"}
+	in <- SensorMessage{Topic: "t/site_power", Value: "-900 W"} // not the declared unit: keeps -1250
+	in <- SensorMessage{Topic: "t/soc", Value: "80%"}
+	in <- SensorMessage{Topic: "t/soc", Value: "250"} // implausible: keeps 80
+	data := <-out
+	assert.Equal(t, -1250.0, data.GetFloat("t/site_power").Current)
+	assert.Equal(t, 80.0, data.GetFloat("t/soc").Current)
+}
@@ -0,0 +1,230 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ryansname/powerctl/governor"
+	"github.com/ryansname/powerctl/internal/ha"
+)
+
+// TopicTOUDischargeState is the state topic for the powerctl_tou_discharge switch
+// that arms the time-of-use discharge scheduler.
+const TopicTOUDischargeState = "homeassistant/switch/powerctl_tou_discharge/state"
+
+// touVoteSource is the source name this scheduler uses on the discharge vote channel.
+const touVoteSource = "tou"
+
+// DischargeWindow is a daily local-time window, in minutes since midnight. End may be
+// before Start for windows that cross midnight.
+type DischargeWindow struct {
+	StartMinute  int
+	EndMinute    int
+	WeekdaysOnly bool
+}
+
+// UnmarshalJSON reads the window as {"start": "17:00", "end": "21:00", "weekdays_only": true}.
+func (w *DischargeWindow) UnmarshalJSON(b []byte) error {
+	var aux struct {
+		Start        string `json:"start"`
+		End          string `json:"end"`
+		WeekdaysOnly bool   `json:"weekdays_only"`
+	}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	start, err := time.Parse("15:04", aux.Start)
+	if err != nil {
+		return fmt.Errorf("invalid start %q: %w", aux.Start, err)
+	}
+	end, err := time.Parse("15:04", aux.End)
+	if err != nil {
+		return fmt.Errorf("invalid end %q: %w", aux.End, err)
+	}
+	w.StartMinute = start.Hour()*60 + start.Minute()
+	w.EndMinute = end.Hour()*60 + end.Minute()
+	w.WeekdaysOnly = aux.WeekdaysOnly
+	return nil
+}
+
+// contains reports whether t falls inside the window.
+func (w DischargeWindow) contains(t time.Time) bool {
+	if w.WeekdaysOnly && (t.Weekday() == time.Saturday || t.Weekday() == time.Sunday) {
+		return false
+	}
+	minute := t.Hour()*60 + t.Minute()
+	if w.StartMinute <= w.EndMinute {
+		return minute >= w.StartMinute && minute < w.EndMinute
+	}
+	return minute >= w.StartMinute || minute < w.EndMinute
+}
+
+// TOUSchedulerConfig configures the time-of-use discharge scheduler.
+type TOUSchedulerConfig struct {
+	Windows    []DischargeWindow `json:"windows"`
+	PriceTopic string            `json:"-"`         // HA electricity price sensor; empty disables the price gate
+	MinPrice   float64           `json:"min_price"` // Only discharge when price is at or above this
+	SOCOn      float64           `json:"soc_on"`    // Powerwall SOC needed to start discharging
+	SOCOff     float64           `json:"soc_off"`   // Powerwall SOC at which discharging stops
+}
+
+// DefaultTOUSchedulerConfig discharges over the weekday evening peak (17:00–21:00),
+// with no price gate.
+var DefaultTOUSchedulerConfig = TOUSchedulerConfig{
+	Windows: []DischargeWindow{{StartMinute: 17 * 60, EndMinute: 21 * 60, WeekdaysOnly: true}},
+	SOCOn:   60,
+	SOCOff:  40,
+}
+
+// UnmarshalJSON reads PriceTopic from a price_entity entity ID (e.g.
+// "sensor.electricity_price").
+func (c *TOUSchedulerConfig) UnmarshalJSON(b []byte) error {
+	type plain TOUSchedulerConfig
+	aux := struct {
+		*plain
+		PriceEntity *string `json:"price_entity"`
+	}{plain: (*plain)(c)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	if aux.PriceEntity != nil {
+		c.PriceTopic = ha.EntityStateTopic(*aux.PriceEntity)
+		if *aux.PriceEntity != "" && c.PriceTopic == "" {
+			return fmt.Errorf("price_entity %q is not an entity ID (domain.object_id)", *aux.PriceEntity)
+		}
+	}
+	return nil
+}
+
+// Validate reports windows and SOC levels the scheduler can't act on.
+func (c TOUSchedulerConfig) Validate() error {
+	var errs []error
+	if len(c.Windows) == 0 {
+		errs = append(errs, errors.New("at least one window is required"))
+	}
+	for i, w := range c.Windows {
+		if w.StartMinute == w.EndMinute {
+			errs = append(errs, fmt.Errorf("window %d is empty", i))
+		}
+	}
+	if c.SOCOff < 0 || c.SOCOn > 100 || c.SOCOff >= c.SOCOn {
+		errs = append(errs, fmt.Errorf("soc_off %.0f must be below soc_on %.0f, within 0-100", c.SOCOff, c.SOCOn))
+	}
+	if c.MinPrice < 0 {
+		errs = append(errs, errors.New("min_price must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// LoadTOUSchedulerConfig reads a TOUSchedulerConfig from a JSON file. Fields it leaves
+// out keep their DefaultTOUSchedulerConfig values.
+func LoadTOUSchedulerConfig(path string) (TOUSchedulerConfig, error) {
+	config := DefaultTOUSchedulerConfig
+	config.Windows = nil
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(b, &config); err != nil {
+		return config, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if config.Windows == nil {
+		config.Windows = DefaultTOUSchedulerConfig.Windows
+	}
+	return config, config.Validate()
+}
+
+// Topics returns the statestream topics the scheduler reads.
+func (c TOUSchedulerConfig) Topics() []string {
+	topics := []string{TopicTOUDischargeState, PowerwallSOCTopic}
+	if c.PriceTopic != "" {
+		topics = append(topics, c.PriceTopic)
+	}
+	return topics
+}
+
+// TOUInput holds the inputs for one scheduler evaluation.
+type TOUInput struct {
+	Armed bool
+	Price float64
+	SOC   float64
+}
+
+// EvaluateTOUDischarge returns the scheduler's vote for this tick. Outside a peak
+// window the scheduler has no opinion, so the arbiter's passive cleanup ends any
+// discharge it started.
+func EvaluateTOUDischarge(
+	config TOUSchedulerConfig,
+	socHysteresis *governor.SteppedHysteresis,
+	in TOUInput,
+	now time.Time,
+) (DischargeVote, string) {
+	if !in.Armed {
+		return VoteNoOpinion, "disarmed"
+	}
+
+	// Track SOC every tick so the hysteresis state is current when a window opens
+	socOK := socHysteresis.Update(in.SOC) > 0
+
+	inWindow := false
+	for _, w := range config.Windows {
+		if w.contains(now) {
+			inWindow = true
+			break
+		}
+	}
+	if !inWindow {
+		return VoteNoOpinion, "outside peak window"
+	}
+	if config.PriceTopic != "" && in.Price < config.MinPrice {
+		return VoteNoOpinion, fmt.Sprintf("price %.3f below %.3f", in.Price, config.MinPrice)
+	}
+	if !socOK {
+		return VoteNoOpinion, fmt.Sprintf("SOC %.1f%% too low", in.SOC)
+	}
+	return VoteOn, fmt.Sprintf("peak window, SOC %.1f%%", in.SOC)
+}
+
+// touDischargeScheduler votes for Powerwall discharge during configured peak windows
+// while armed, priced high enough and SOC permits.
+func touDischargeScheduler(
+	ctx context.Context,
+	dataChan <-chan DisplayData,
+	config TOUSchedulerConfig,
+	voteChan chan<- DischargeRequest,
+) {
+	log.Println("TOU discharge scheduler started")
+
+	socHysteresis := governor.NewSteppedHysteresis(1, true, config.SOCOn, config.SOCOn, config.SOCOff, config.SOCOff)
+	var lastVote DischargeVote = -1
+	var lastReason string
+
+	for {
+		select {
+		case data := <-dataChan:
+			in := TOUInput{
+				Armed: data.GetBoolean(TopicTOUDischargeState),
+				SOC:   data.GetFloat(PowerwallSOCTopic).Current,
+			}
+			if config.PriceTopic != "" {
+				in.Price = data.GetFloat(config.PriceTopic).Current
+			}
+
+			want, reason := EvaluateTOUDischarge(config, socHysteresis, in, time.Now())
+			req := DischargeRequest{Source: touVoteSource, Want: want, Reason: reason}
+			if (want != lastVote || reason != lastReason) && sendWithin(ctx, voteChan, req, sendTimeout, "TOU vote") {
+				lastVote = want
+				lastReason = reason
+			}
+
+		case <-ctx.Done():
+			log.Println("TOU discharge scheduler stopped")
+			return
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package workers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ryansname/powerctl/governor"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeTestTOUConfig() TOUSchedulerConfig {
+	return TOUSchedulerConfig{
+		Windows:    []DischargeWindow{{StartMinute: 17 * 60, EndMinute: 21 * 60, WeekdaysOnly: true}},
+		PriceTopic: "ha/sensor/price/state",
+		MinPrice:   0.30,
+		SOCOn:      60,
+		SOCOff:     40,
+	}
+}
+
+func makeTestTOUHysteresis(config TOUSchedulerConfig) *governor.SteppedHysteresis {
+	return governor.NewSteppedHysteresis(1, true, config.SOCOn, config.SOCOn, config.SOCOff, config.SOCOff)
+}
+
+// Wednesday
+var touTestEvening = time.Date(2025, 6, 4, 18, 0, 0, 0, time.Local)
+
+func TestEvaluateTOUDischarge_PeakVotesOn(t *testing.T) {
+	config := makeTestTOUConfig()
+	want, _ := EvaluateTOUDischarge(config, makeTestTOUHysteresis(config),
+		TOUInput{Armed: true, Price: 0.35, SOC: 80}, touTestEvening)
+	assert.Equal(t, VoteOn, want)
+}
+
+func TestEvaluateTOUDischarge_NoOpinionOutsideWindow(t *testing.T) {
+	config := makeTestTOUConfig()
+	in := TOUInput{Armed: true, Price: 0.35, SOC: 80}
+
+	want, _ := EvaluateTOUDischarge(config, makeTestTOUHysteresis(config), in, touTestEvening.Add(4*time.Hour))
+	assert.Equal(t, VoteNoOpinion, want, "22:00 is after the window")
+
+	saturday := time.Date(2025, 6, 7, 18, 0, 0, 0, time.Local)
+	want, _ = EvaluateTOUDischarge(config, makeTestTOUHysteresis(config), in, saturday)
+	assert.Equal(t, VoteNoOpinion, want, "weekday-only window")
+}
+
+func TestEvaluateTOUDischarge_PriceGate(t *testing.T) {
+	config := makeTestTOUConfig()
+	want, reason := EvaluateTOUDischarge(config, makeTestTOUHysteresis(config),
+		TOUInput{Armed: true, Price: 0.20, SOC: 80}, touTestEvening)
+	assert.Equal(t, VoteNoOpinion, want)
+	assert.Contains(t, reason, "price")
+}
+
+func TestEvaluateTOUDischarge_SOCHysteresis(t *testing.T) {
+	config := makeTestTOUConfig()
+	h := makeTestTOUHysteresis(config)
+
+	want, _ := EvaluateTOUDischarge(config, h, TOUInput{Armed: true, Price: 0.35, SOC: 61}, touTestEvening)
+	assert.Equal(t, VoteOn, want)
+
+	want, _ = EvaluateTOUDischarge(config, h, TOUInput{Armed: true, Price: 0.35, SOC: 50}, touTestEvening)
+	assert.Equal(t, VoteOn, want, "keeps discharging above the off threshold")
+
+	want, _ = EvaluateTOUDischarge(config, h, TOUInput{Armed: true, Price: 0.35, SOC: 39}, touTestEvening)
+	assert.Equal(t, VoteNoOpinion, want)
+}
+
+func TestEvaluateTOUDischarge_Disarmed(t *testing.T) {
+	config := makeTestTOUConfig()
+	want, reason := EvaluateTOUDischarge(config, makeTestTOUHysteresis(config),
+		TOUInput{Armed: false, Price: 0.35, SOC: 80}, touTestEvening)
+	assert.Equal(t, VoteNoOpinion, want)
+	assert.Equal(t, "disarmed", reason)
+}
+
+func TestDischargeWindow_CrossesMidnight(t *testing.T) {
+	w := DischargeWindow{StartMinute: 23 * 60, EndMinute: 2 * 60}
+	assert.True(t, w.contains(time.Date(2025, 6, 4, 23, 30, 0, 0, time.Local)))
+	assert.True(t, w.contains(time.Date(2025, 6, 4, 1, 0, 0, 0, time.Local)))
+	assert.False(t, w.contains(time.Date(2025, 6, 4, 2, 0, 0, 0, time.Local)))
+}
+
+func TestLoadTOUSchedulerConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedule.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{
+		"windows": [{"start": "22:30", "end": "06:00"}],
+		"price_entity": "sensor.electricity_price",
+		"min_price": 0.25,
+		"soc_on": 70
+	}`), 0o600))
+	config, err := LoadTOUSchedulerConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []DischargeWindow{{StartMinute: 22*60 + 30, EndMinute: 6 * 60}}, config.Windows)
+	assert.Equal(t, "homeassistant/sensor/electricity_price/state", config.PriceTopic)
+	assert.Equal(t, 0.25, config.MinPrice)
+	assert.Equal(t, 70.0, config.SOCOn)
+	assert.Equal(t, DefaultTOUSchedulerConfig.SOCOff, config.SOCOff, "missing fields keep defaults")
+	assert.Contains(t, config.Topics(), config.PriceTopic)
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"soc_on": 70}`), 0o600))
+	config, err = LoadTOUSchedulerConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultTOUSchedulerConfig.Windows, config.Windows)
+	assert.Empty(t, config.PriceTopic)
+
+	for _, invalid := range []string{
+		`{"soc_on": 30}`,
+		`{"windows": [{"start": "17:00", "end": "17:00"}]}`,
+		`{"windows": [{"start": "5pm", "end": "21:00"}]}`,
+		`{"price_entity": "electricity_price"}`,
+	} {
+		assert.NoError(t, os.WriteFile(path, []byte(invalid), 0o600))
+		_, err = LoadTOUSchedulerConfig(path)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,220 @@
+package workers
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// tuneParams are the baseline config fields `powerctl tune` can sweep.
+var tuneParams = map[string]func(c *BaselineInverterConfig, v float64){
+	"target_ramp_threshold":       func(c *BaselineInverterConfig, v float64) { c.TargetRampThreshold = v },
+	"overflow_soc_turn_on_start":  func(c *BaselineInverterConfig, v float64) { c.OverflowSOCTurnOnStart = v },
+	"overflow_soc_turn_on_end":    func(c *BaselineInverterConfig, v float64) { c.OverflowSOCTurnOnEnd = v },
+	"overflow_soc_turn_off_start": func(c *BaselineInverterConfig, v float64) { c.OverflowSOCTurnOffStart = v },
+	"overflow_soc_turn_off_end":   func(c *BaselineInverterConfig, v float64) { c.OverflowSOCTurnOffEnd = v },
+}
+
+// defaultTuneSweeps are swept when no --sweep is given: the slow ramp from none to two
+// inverter-minutes, and how far overflow lets SOC fall in float before shedding.
+var defaultTuneSweeps = []string{
+	"target_ramp_threshold=0:30600:7650",
+	"overflow_soc_turn_off_end=90:97:1",
+}
+
+// TuneSweep is one parameter's range, inclusive of Min and Max.
+type TuneSweep struct {
+	Param          string
+	Min, Max, Step float64
+}
+
+// Values returns the swept values from Min to Max.
+func (s TuneSweep) Values() []float64 {
+	var values []float64
+	for i := 0; ; i++ {
+		v := s.Min + float64(i)*s.Step
+		if v > s.Max+s.Step/1e6 {
+			return values
+		}
+		values = append(values, v)
+	}
+}
+
+// ParseTuneSweep parses "param=min:max:step".
+func ParseTuneSweep(spec string) (TuneSweep, error) {
+	param, rng, ok := strings.Cut(spec, "=")
+	if !ok {
+		return TuneSweep{}, fmt.Errorf("sweep %q: want param=min:max:step", spec)
+	}
+	if _, ok := tuneParams[param]; !ok {
+		return TuneSweep{}, fmt.Errorf("sweep %q: unknown parameter (have: %s)", spec, strings.Join(tuneParamNames(), ", "))
+	}
+	parts := strings.Split(rng, ":")
+	if len(parts) != 3 {
+		return TuneSweep{}, fmt.Errorf("sweep %q: want param=min:max:step", spec)
+	}
+	var nums [3]float64
+	for i, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return TuneSweep{}, fmt.Errorf("sweep %q: %w", spec, err)
+		}
+		nums[i] = n
+	}
+	sweep := TuneSweep{Param: param, Min: nums[0], Max: nums[1], Step: nums[2]}
+	if sweep.Step <= 0 || sweep.Max < sweep.Min {
+		return TuneSweep{}, fmt.Errorf("sweep %q: step must be positive and max at least min", spec)
+	}
+	return sweep, nil
+}
+
+func tuneParamNames() []string {
+	names := make([]string, 0, len(tuneParams))
+	for name := range tuneParams {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// TuneScore is how a configuration did over the simulated day; lower is better.
+type TuneScore struct {
+	WastedFloatWh   float64 // solar clipped with the battery full
+	Switches        int
+	MinutesBelowSOC float64 // time under the SOC floor
+}
+
+// dominates reports whether s is no worse than o on every score and better on one.
+func (s TuneScore) dominates(o TuneScore) bool {
+	noWorse := s.WastedFloatWh <= o.WastedFloatWh && s.Switches <= o.Switches && s.MinutesBelowSOC <= o.MinutesBelowSOC
+	better := s.WastedFloatWh < o.WastedFloatWh || s.Switches < o.Switches || s.MinutesBelowSOC < o.MinutesBelowSOC
+	return noWorse && better
+}
+
+// TuneRun is one point of the sweep.
+type TuneRun struct {
+	Values []float64 // in the order of the sweeps
+	Score  TuneScore
+}
+
+// scoreSimResult scores a run against socFloor (%).
+func scoreSimResult(result SimResult, step float64, socFloor float64) TuneScore {
+	score := TuneScore{WastedFloatWh: result.ClippedWh, Switches: result.Switches}
+	for _, s := range result.Samples {
+		if s.SOC < socFloor {
+			score.MinutesBelowSOC += step
+		}
+	}
+	return score
+}
+
+// sweepConfigs runs every combination of the sweeps' values through run and returns
+// the scored runs.
+func sweepConfigs(base BaselineInverterConfig, sweeps []TuneSweep, run func(BaselineInverterConfig) TuneScore) []TuneRun {
+	runs := []TuneRun{{}}
+	for _, sweep := range sweeps {
+		var next []TuneRun
+		for _, r := range runs {
+			for _, v := range sweep.Values() {
+				next = append(next, TuneRun{Values: append(slices.Clone(r.Values), v)})
+			}
+		}
+		runs = next
+	}
+	for i := range runs {
+		config := base
+		for j, sweep := range sweeps {
+			tuneParams[sweep.Param](&config, runs[i].Values[j])
+		}
+		runs[i].Score = run(config)
+	}
+	return runs
+}
+
+// paretoFront returns the runs no other run dominates, by wasted energy then switches.
+func paretoFront(runs []TuneRun) []TuneRun {
+	var front []TuneRun
+	for i, r := range runs {
+		dominated := slices.ContainsFunc(runs, func(o TuneRun) bool { return o.Score.dominates(r.Score) })
+		// Keep the first of identically scored runs
+		duplicate := slices.ContainsFunc(runs[:i], func(o TuneRun) bool { return o.Score == r.Score })
+		if !dominated && !duplicate {
+			front = append(front, r)
+		}
+	}
+	slices.SortStableFunc(front, func(a, b TuneRun) int {
+		if a.Score.WastedFloatWh != b.Score.WastedFloatWh {
+			if a.Score.WastedFloatWh < b.Score.WastedFloatWh {
+				return -1
+			}
+			return 1
+		}
+		return a.Score.Switches - b.Score.Switches
+	})
+	return front
+}
+
+// printParetoFront prints the front as a table.
+func printParetoFront(w io.Writer, sweeps []TuneSweep, front []TuneRun) {
+	for _, sweep := range sweeps {
+		fmt.Fprintf(w, "%-28s ", sweep.Param)
+	}
+	fmt.Fprintf(w, "%12s %8s %12s\n", "WASTED kWh", "SWITCHES", "MIN < FLOOR")
+	for _, r := range front {
+		for _, v := range r.Values {
+			fmt.Fprintf(w, "%-28s ", strconv.FormatFloat(v, 'f', -1, 64))
+		}
+		fmt.Fprintf(w, "%12.2f %8d %12.0f\n", r.Score.WastedFloatWh/1000, r.Score.Switches, r.Score.MinutesBelowSOC)
+	}
+}
+
+// runTuneCommand implements `powerctl tune`: sweep baseline config parameters over a
+// simulated day and report the Pareto-best configurations by solar wasted in float,
+// inverter switches and time below an SOC floor.
+func runTuneCommand(args []string) int {
+	fs := flag.NewFlagSet("tune", flag.ContinueOnError)
+	sim := addSimFlags(fs)
+	socFloor := fs.Float64("soc-floor", 20, "SOC (%) below which time counts against a configuration")
+	var specs []string
+	fs.Func("sweep", "Parameter range param=min:max:step, repeatable (default: "+strings.Join(defaultTuneSweeps, ", ")+
+		"; params: "+strings.Join(tuneParamNames(), ", ")+")", func(s string) error {
+		specs = append(specs, s)
+		return nil
+	})
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if len(specs) == 0 {
+		specs = defaultTuneSweeps
+	}
+	var sweeps []TuneSweep
+	for _, spec := range specs {
+		sweep, err := ParseTuneSweep(spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "tune: %v\n", err)
+			return 2
+		}
+		sweeps = append(sweeps, sweep)
+	}
+
+	setup, code, err := sim.load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tune: %v\n", err)
+		return code
+	}
+	defer log.SetOutput(os.Stderr)
+
+	runs := sweepConfigs(setup.config, sweeps, func(config BaselineInverterConfig) TuneScore {
+		return scoreSimResult(setup.run(config), setup.step.Minutes(), *socFloor)
+	})
+	front := paretoFront(runs)
+	fmt.Printf("Simulated %s from %.1f%% SOC: %d configurations, %d Pareto-best\n",
+		setup.start.Format("2006-01-02"), setup.model.StartSOC, len(runs), len(front))
+	printParetoFront(os.Stdout, sweeps, front)
+	return 0
+}
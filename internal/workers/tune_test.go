@@ -0,0 +1,61 @@
+package workers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTuneSweep(t *testing.T) {
+	sweep, err := ParseTuneSweep("overflow_soc_turn_off_end=90:95:2.5")
+	assert.NoError(t, err)
+	assert.Equal(t, "overflow_soc_turn_off_end", sweep.Param)
+	assert.Equal(t, []float64{90, 92.5, 95}, sweep.Values())
+
+	_, err = ParseTuneSweep("nope=1:2:1")
+	assert.ErrorContains(t, err, "unknown parameter")
+	_, err = ParseTuneSweep("target_ramp_threshold=1:2")
+	assert.ErrorContains(t, err, "want param=min:max:step")
+	_, err = ParseTuneSweep("target_ramp_threshold=2:1:1")
+	assert.ErrorContains(t, err, "step must be positive")
+}
+
+func TestParetoFront(t *testing.T) {
+	runs := []TuneRun{
+		{Values: []float64{1}, Score: TuneScore{WastedFloatWh: 100, Switches: 10}},
+		{Values: []float64{2}, Score: TuneScore{WastedFloatWh: 200, Switches: 4}},
+		{Values: []float64{3}, Score: TuneScore{WastedFloatWh: 200, Switches: 12}}, // dominated by 1
+		{Values: []float64{4}, Score: TuneScore{WastedFloatWh: 50, Switches: 20, MinutesBelowSOC: 30}},
+		{Values: []float64{5}, Score: TuneScore{WastedFloatWh: 100, Switches: 10}}, // same as 1
+	}
+	front := paretoFront(runs)
+	var values []float64
+	for _, r := range front {
+		values = append(values, r.Values[0])
+	}
+	assert.Equal(t, []float64{4, 1, 2}, values)
+}
+
+func TestSweepConfigs(t *testing.T) {
+	day := time.Date(2026, 3, 4, 0, 0, 0, 0, time.Local)
+	b2, b3 := DefaultBatteryConfigs()
+	model := NewSimModel(b2, makeSimForecast(day, 1.0), 40)
+	sweeps := []TuneSweep{
+		{Param: "target_ramp_threshold", Min: 0, Max: 15300, Step: 15300},
+		{Param: "overflow_soc_turn_off_end", Min: 90, Max: 96, Step: 6},
+	}
+
+	var seen [][2]float64
+	runs := sweepConfigs(BuildBaselineInverterConfig(b2, b3), sweeps, func(config BaselineInverterConfig) TuneScore {
+		seen = append(seen, [2]float64{config.TargetRampThreshold, config.OverflowSOCTurnOffEnd})
+		return scoreSimResult(simulate(config, model, day, 24*time.Hour, time.Minute), 1, 20)
+	})
+
+	assert.Equal(t, [][2]float64{{0, 90}, {0, 96}, {15300, 90}, {15300, 96}}, seen)
+	assert.Len(t, runs, 4)
+	assert.NotEmpty(t, paretoFront(runs))
+	for _, r := range runs {
+		assert.Positive(t, r.Score.Switches)
+	}
+}
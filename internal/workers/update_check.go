@@ -0,0 +1,164 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TopicUpdateAvailableState is the retained state topic for the binary sensor that turns
+// on while a newer release than the running build is published.
+const TopicUpdateAvailableState = "powerctl/binary_sensor/powerctl_update_available/state"
+
+// latestVersionSensorID is the diagnostic sensor showing the newest release seen.
+const latestVersionSensorID = "powerctl_latest_version"
+
+// defaultReleaseURL is the GitHub latest-release endpoint checked by --update-check.
+const defaultReleaseURL = "https://api.github.com/repos/ryansname/powerctl/releases/latest"
+
+// UpdateCheckConfig configures the release check.
+type UpdateCheckConfig struct {
+	URL      string // GitHub latest-release endpoint
+	Interval time.Duration
+}
+
+// release is the part of a GitHub release we use.
+type release struct {
+	TagName string `json:"tag_name"`
+	HTMLURL string `json:"html_url"`
+}
+
+// fetchLatestRelease calls the latest-release endpoint.
+func fetchLatestRelease(ctx context.Context, client *http.Client, url string) (release, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return release{}, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return release{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return release{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return release{}, fmt.Errorf("release feed returned %s", resp.Status)
+	}
+	var r release
+	if err := json.Unmarshal(body, &r); err != nil {
+		return release{}, fmt.Errorf("parse release: %w", err)
+	}
+	if r.TagName == "" {
+		return release{}, fmt.Errorf("release has no tag")
+	}
+	return r, nil
+}
+
+// parseVersion splits a dotted version ("v1.2.3", "0.4") into its numbers. A
+// pre-release or build suffix ("1.2.3-rc1") is ignored.
+func parseVersion(v string) ([]int, bool) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	if v == "" {
+		return nil, false
+	}
+	parts := strings.Split(v, ".")
+	nums := make([]int, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		nums[i] = n
+	}
+	return nums, true
+}
+
+// updateAvailable reports whether latest is a newer version than current. A build that
+// isn't a release version (such as "dev") is never reported as out of date.
+func updateAvailable(current, latest string) bool {
+	cur, ok := parseVersion(current)
+	if !ok {
+		return false
+	}
+	lat, ok := parseVersion(latest)
+	if !ok {
+		return false
+	}
+	for i := range max(len(cur), len(lat)) {
+		var c, l int
+		if i < len(cur) {
+			c = cur[i]
+		}
+		if i < len(lat) {
+			l = lat[i]
+		}
+		if c != l {
+			return l > c
+		}
+	}
+	return false
+}
+
+// updateCheckWorker checks the release feed every Interval, publishing the newest tag
+// and raising the update available binary sensor while it is newer than version.
+// Failed checks are logged and leave the last result in place.
+func updateCheckWorker(ctx context.Context, config UpdateCheckConfig, sender *MQTTSender) {
+	log.Println("Update check worker started")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	notified := ""
+
+	check := func() {
+		r, err := fetchLatestRelease(ctx, client, config.URL)
+		if err != nil {
+			log.Printf("Update check: failed, retrying in %v: %v\n", config.Interval, err)
+			return
+		}
+		available := updateAvailable(version, r.TagName)
+		if available && r.TagName != notified {
+			log.Printf("Update check: %s is available (running %s): %s\n", r.TagName, version, r.HTMLURL)
+			notified = r.TagName
+		}
+
+		payload := "OFF"
+		if available {
+			payload = "ON"
+		}
+		sender.Send(MQTTMessage{Topic: TopicUpdateAvailableState, Payload: []byte(payload), QoS: 1, Retain: true})
+		sender.Send(MQTTMessage{
+			Topic:   "powerctl/sensor/" + latestVersionSensorID + "/state",
+			Payload: []byte(r.TagName),
+			QoS:     1,
+			Retain:  true,
+		})
+	}
+
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+	check()
+
+	for {
+		select {
+		case <-ticker.C:
+			check()
+
+		case <-ctx.Done():
+			log.Println("Update check worker stopped")
+			return
+		}
+	}
+}
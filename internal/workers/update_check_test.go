@@ -0,0 +1,44 @@
+package workers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateAvailable(t *testing.T) {
+	assert.True(t, updateAvailable("0.1.0", "v0.2.0"))
+	assert.True(t, updateAvailable("v0.9.9", "1.0"))
+	assert.True(t, updateAvailable("1.2", "1.2.1"))
+	assert.False(t, updateAvailable("0.2.0", "v0.2.0"))
+	assert.False(t, updateAvailable("0.3.0", "v0.2.9"))
+	assert.False(t, updateAvailable("1.2.0", "1.2"), "a missing component is zero")
+	assert.False(t, updateAvailable("0.1.0-rc1", "0.1.0"), "suffixes are ignored")
+	assert.False(t, updateAvailable("dev", "v9.0.0"), "dev builds are never out of date")
+	assert.False(t, updateAvailable("0.1.0", "nightly"))
+}
+
+func TestFetchLatestRelease(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"tag_name":"v0.2.0","html_url":"https://example.com/v0.2.0"}`))
+	}))
+	defer server.Close()
+
+	r, err := fetchLatestRelease(context.Background(), server.Client(), server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "v0.2.0", r.TagName)
+	assert.Equal(t, "https://example.com/v0.2.0", r.HTMLURL)
+}
+
+func TestFetchLatestRelease_NotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	_, err := fetchLatestRelease(context.Background(), server.Client(), server.URL)
+	assert.Error(t, err)
+}
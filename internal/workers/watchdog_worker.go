@@ -0,0 +1,132 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TopicWorkerStuckState is the state topic for the binary sensor that turns on while
+// any worker's heartbeat is older than the watchdog threshold.
+const TopicWorkerStuckState = "powerctl/binary_sensor/powerctl_worker_stuck/state"
+
+// Heartbeats records when each worker last showed progress. Safe for concurrent use.
+type Heartbeats struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+// NewHeartbeats creates an empty heartbeat registry.
+func NewHeartbeats() *Heartbeats {
+	return &Heartbeats{last: make(map[string]time.Time)}
+}
+
+// Beat records progress for name. A nil registry ignores beats.
+func (h *Heartbeats) Beat(name string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	h.last[name] = time.Now()
+	h.mu.Unlock()
+}
+
+// Last returns the last beat for name, or the zero time if it has never beaten.
+func (h *Heartbeats) Last(name string) time.Time {
+	if h == nil {
+		return time.Time{}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.last[name]
+}
+
+// Stale returns the workers whose last beat is older than threshold, sorted.
+func (h *Heartbeats) Stale(now time.Time, threshold time.Duration) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var stale []string
+	for name, last := range h.last {
+		if now.Sub(last) > threshold {
+			stale = append(stale, name)
+		}
+	}
+	slices.Sort(stale)
+	return stale
+}
+
+// WatchdogConfig configures stuck worker detection.
+type WatchdogConfig struct {
+	Threshold     time.Duration // Heartbeat age at which a worker counts as stuck
+	CheckInterval time.Duration
+	ExitOnStuck   bool // Shut down (for the service manager to restart) instead of only alerting
+}
+
+// watchdogWorker catches deadlocks the supervisor can't: a worker blocked forever stops
+// beating. Consumers beat whenever broadcastWorker finds room in their channel, so a
+// stuck consumer is caught once its buffer fills. Workers the supervisor has held
+// pending (a dependency never came up) or restarting for longer than the threshold
+// count as stuck too. Stuck workers are logged and raise the powerctl_worker_stuck
+// binary sensor; with ExitOnStuck the app shuts down, as it does when a worker runs
+// out of retries. A goroutine can't be killed, so restarting
+// the process is the only reliable recovery. Heartbeats are keyed by broadcast consumer
+// rather than worker name, so they aren't checked while any worker is paused.
+func watchdogWorker(
+	ctx context.Context,
+	cancel context.CancelFunc,
+	heartbeats *Heartbeats,
+	status *WorkerStatus,
+	config WatchdogConfig,
+	sender *MQTTSender,
+) {
+	log.Println("Watchdog worker started")
+
+	ticker := time.NewTicker(config.CheckInterval)
+	defer ticker.Stop()
+
+	var lastStuck []string
+	publish := func(stuck bool) {
+		payload := "OFF"
+		if stuck {
+			payload = "ON"
+		}
+		sender.Send(MQTTMessage{Topic: TopicWorkerStuckState, Payload: []byte(payload), QoS: 1, Retain: true})
+	}
+	publish(false)
+
+	for {
+		select {
+		case now := <-ticker.C:
+			var stuck []string
+			if len(status.PausedWorkers()) == 0 {
+				stuck = heartbeats.Stale(now, config.Threshold)
+			}
+			stuck = append(stuck, status.Stalled(now, config.Threshold)...)
+			slices.Sort(stuck)
+			stuck = slices.Compact(stuck)
+			if slices.Equal(stuck, lastStuck) {
+				continue
+			}
+			if len(stuck) > 0 {
+				log.Printf("ERROR: watchdog: no progress for %s from: %s\n", config.Threshold, strings.Join(stuck, ", "))
+			} else {
+				log.Println("Watchdog: all workers progressing again")
+			}
+			publish(len(stuck) > 0)
+			lastStuck = stuck
+
+			if len(stuck) > 0 && config.ExitOnStuck {
+				log.Println("Watchdog: shutting down so the service manager restarts powerctl")
+				cancel()
+				return
+			}
+
+		case <-ctx.Done():
+			log.Println("Watchdog worker stopped")
+			return
+		}
+	}
+}
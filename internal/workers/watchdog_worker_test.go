@@ -0,0 +1,97 @@
+package workers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeartbeats_Stale(t *testing.T) {
+	h := NewHeartbeats()
+	h.Beat("b")
+	h.Beat("a")
+	now := time.Now()
+
+	assert.Empty(t, h.Stale(now, time.Minute))
+	assert.Equal(t, []string{"a", "b"}, h.Stale(now.Add(2*time.Minute), time.Minute))
+
+	h.last["b"] = now.Add(-time.Hour)
+	assert.Equal(t, []string{"b"}, h.Stale(now, time.Minute))
+}
+
+func TestHeartbeats_NilIgnoresBeats(t *testing.T) {
+	var h *Heartbeats
+	assert.NotPanics(t, func() { h.Beat("a") })
+}
+
+func TestWatchdogWorker_ExitOnStuck(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h := NewHeartbeats()
+	h.Beat("stuck-worker")
+	out := make(chan MQTTMessage, 10)
+
+	done := make(chan struct{})
+	go func() {
+		watchdogWorker(ctx, cancel, h, NewWorkerStatus(), WatchdogConfig{
+			Threshold:     time.Millisecond,
+			CheckInterval: 5 * time.Millisecond,
+			ExitOnStuck:   true,
+		}, NewMQTTSender(out))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("watchdog did not shut down")
+	}
+	assert.Error(t, ctx.Err())
+	assert.Equal(t, "OFF", string((<-out).Payload))
+	assert.Equal(t, "ON", string((<-out).Payload))
+}
+
+func TestWatchdogWorker_StalledWorkerIsStuck(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	status := NewWorkerStatus()
+	status.Declared("waits-forever", []string{"never-starts"})
+	out := make(chan MQTTMessage, 10)
+
+	go watchdogWorker(ctx, cancel, NewHeartbeats(), status, WatchdogConfig{
+		Threshold:     time.Millisecond,
+		CheckInterval: 5 * time.Millisecond,
+	}, NewMQTTSender(out))
+
+	assert.Equal(t, "OFF", string((<-out).Payload))
+	select {
+	case msg := <-out:
+		assert.Equal(t, "ON", string(msg.Payload))
+	case <-time.After(time.Second):
+		t.Fatal("pending worker not flagged")
+	}
+}
+
+func TestWatchdogWorker_IgnoresHeartbeatsWhilePaused(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h := NewHeartbeats()
+	h.Beat("paused-consumer")
+	status := NewWorkerStatus()
+	status.Paused("paused-worker")
+	out := make(chan MQTTMessage, 10)
+
+	go watchdogWorker(ctx, cancel, h, status, WatchdogConfig{
+		Threshold:     time.Millisecond,
+		CheckInterval: 5 * time.Millisecond,
+	}, NewMQTTSender(out))
+
+	assert.Equal(t, "OFF", string((<-out).Payload))
+	select {
+	case msg := <-out:
+		t.Fatalf("flagged stuck while paused: %s", msg.Payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
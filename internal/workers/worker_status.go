@@ -0,0 +1,187 @@
+package workers
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// WorkerState is where a supervised worker is in its lifecycle.
+type WorkerState string
+
+const (
+	WorkerPending    WorkerState = "pending" // Waiting for the workers it requires
+	WorkerRunning    WorkerState = "running"
+	WorkerRestarting WorkerState = "restarting" // Panicked, waiting out the retry backoff
+	WorkerPaused     WorkerState = "paused"     // Stopped by Supervisor.Pause
+	WorkerDone       WorkerState = "done"       // Returned normally
+	WorkerFailed     WorkerState = "failed"     // Ran out of retries
+)
+
+// WorkerInfo is what the supervisor knows about a worker.
+type WorkerInfo struct {
+	Name      string
+	Requires  []string
+	State     WorkerState
+	Since     time.Time // latest state change
+	Started   time.Time // latest (re)start
+	Restarts  int       // panics recovered by the supervisor
+	LastPanic string
+}
+
+// Decision is a controller's most recent evaluation: what it was given and what it chose.
+type Decision struct {
+	At      time.Time
+	Inputs  any
+	Outputs any
+}
+
+// WorkerStatus records supervised workers and each controller's latest Decision for the
+// debug REPL's workers and why commands. Safe for concurrent use.
+type WorkerStatus struct {
+	mu        sync.Mutex
+	workers   map[string]*WorkerInfo
+	decisions map[string]Decision
+}
+
+// workerStatus is the process-wide registry; the supervisor reports to it.
+var workerStatus = NewWorkerStatus()
+
+// NewWorkerStatus creates an empty registry.
+func NewWorkerStatus() *WorkerStatus {
+	return &WorkerStatus{
+		workers:   make(map[string]*WorkerInfo),
+		decisions: make(map[string]Decision),
+	}
+}
+
+// worker returns name's entry, creating it if needed. Callers hold mu.
+func (s *WorkerStatus) worker(name string) *WorkerInfo {
+	w, ok := s.workers[name]
+	if !ok {
+		w = &WorkerInfo{Name: name}
+		s.workers[name] = w
+	}
+	return w
+}
+
+func (w *WorkerInfo) setState(state WorkerState, now time.Time) {
+	w.State = state
+	w.Since = now
+}
+
+// Declared records that name is waiting to start once requires are up.
+func (s *WorkerStatus) Declared(name string, requires []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := s.worker(name)
+	w.Requires = requires
+	w.setState(WorkerPending, time.Now())
+}
+
+// Started records that name is running.
+func (s *WorkerStatus) Started(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := s.worker(name)
+	now := time.Now()
+	w.Started = now
+	w.setState(WorkerRunning, now)
+}
+
+// Paused records that name was paused by the operator.
+func (s *WorkerStatus) Paused(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.worker(name).setState(WorkerPaused, time.Now())
+}
+
+// PausedWorkers returns the paused workers, sorted.
+func (s *WorkerStatus) PausedWorkers() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var paused []string
+	for name, w := range s.workers {
+		if w.State == WorkerPaused {
+			paused = append(paused, name)
+		}
+	}
+	slices.Sort(paused)
+	return paused
+}
+
+// Stopped records that name returned or panicked; a panic counts as a restart.
+func (s *WorkerStatus) Stopped(name string, panicValue any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, ok := s.workers[name]
+	if !ok {
+		return
+	}
+	if panicValue == nil {
+		w.setState(WorkerDone, time.Now())
+		return
+	}
+	w.Restarts++
+	w.LastPanic = fmt.Sprint(panicValue)
+	w.setState(WorkerRestarting, time.Now())
+}
+
+// Failed records that name ran out of retries.
+func (s *WorkerStatus) Failed(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.worker(name).setState(WorkerFailed, time.Now())
+}
+
+// Stalled returns the workers that have been pending or restarting for longer than
+// threshold, sorted: ones whose dependencies never came up, or that keep panicking.
+func (s *WorkerStatus) Stalled(now time.Time, threshold time.Duration) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var stalled []string
+	for name, w := range s.workers {
+		if (w.State == WorkerPending || w.State == WorkerRestarting) && now.Sub(w.Since) > threshold {
+			stalled = append(stalled, name)
+		}
+	}
+	slices.Sort(stalled)
+	return stalled
+}
+
+// Workers returns every worker seen, sorted by name.
+func (s *WorkerStatus) Workers() []WorkerInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := slices.Sorted(maps.Keys(s.workers))
+	workers := make([]WorkerInfo, 0, len(names))
+	for _, name := range names {
+		workers = append(workers, *s.workers[name])
+	}
+	return workers
+}
+
+// RecordDecision stores worker's latest decision. inputs and outputs must not be
+// modified afterwards.
+func (s *WorkerStatus) RecordDecision(worker string, inputs, outputs any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.decisions[worker] = Decision{At: time.Now(), Inputs: inputs, Outputs: outputs}
+}
+
+// LastDecision returns worker's latest decision, if it has recorded one.
+func (s *WorkerStatus) LastDecision(worker string) (Decision, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.decisions[worker]
+	return d, ok
+}
+
+// DecisionWorkers returns the workers that have recorded a decision, sorted.
+func (s *WorkerStatus) DecisionWorkers() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Sorted(maps.Keys(s.decisions))
+}
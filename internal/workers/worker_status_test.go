@@ -0,0 +1,71 @@
+package workers
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerStatus_CountsRestarts(t *testing.T) {
+	s := NewWorkerStatus()
+	s.Started("b")
+	s.Started("a")
+	s.Stopped("a", "boom")
+	s.Started("a")
+
+	workers := s.Workers()
+	assert.Len(t, workers, 2)
+	assert.Equal(t, "a", workers[0].Name)
+	assert.Equal(t, 1, workers[0].Restarts)
+	assert.Equal(t, "boom", workers[0].LastPanic)
+	assert.Equal(t, WorkerRunning, workers[0].State)
+
+	s.Stopped("b", nil)
+	assert.Equal(t, WorkerDone, s.Workers()[1].State)
+	assert.Equal(t, 0, s.Workers()[1].Restarts, "a clean return isn't a restart")
+}
+
+func TestWorkerStatus_Stalled(t *testing.T) {
+	s := NewWorkerStatus()
+	s.Declared("pending", []string{"dep"})
+	s.Declared("restarting", nil)
+	s.Started("restarting")
+	s.Stopped("restarting", "boom")
+	s.Declared("running", nil)
+	s.Started("running")
+	s.Declared("failed", nil)
+	s.Failed("failed")
+	now := time.Now()
+
+	assert.Empty(t, s.Stalled(now, time.Minute))
+	assert.Equal(t, []string{"pending", "restarting"}, s.Stalled(now.Add(2*time.Minute), time.Minute))
+	assert.Equal(t, []string{"dep"}, s.Workers()[1].Requires)
+}
+
+func TestWorkerStatus_LastDecision(t *testing.T) {
+	s := NewWorkerStatus()
+	_, ok := s.LastDecision("baseline-inverter-control")
+	assert.False(t, ok)
+
+	s.RecordDecision("baseline-inverter-control", BaselineInput{Battery2SOC: 50}, 2)
+	s.RecordDecision("baseline-inverter-control", BaselineInput{Battery2SOC: 51}, 3)
+	d, ok := s.LastDecision("baseline-inverter-control")
+	assert.True(t, ok)
+	assert.Equal(t, 51.0, d.Inputs.(BaselineInput).Battery2SOC)
+	assert.Equal(t, 3, d.Outputs)
+	assert.Equal(t, []string{"baseline-inverter-control"}, s.DecisionWorkers())
+}
+
+func TestFormatDecision_FallsBackForNaN(t *testing.T) {
+	assert.Contains(t, formatDecision(struct{ Watts float64 }{255}), `"Watts": 255`)
+	assert.Equal(t, "{Watts:NaN}", formatDecision(struct{ Watts float64 }{math.NaN()}))
+}
+
+func TestHeartbeats_Last(t *testing.T) {
+	h := NewHeartbeats()
+	assert.True(t, h.Last("stats-worker").IsZero())
+	h.Beat("stats-worker")
+	assert.WithinDuration(t, time.Now(), h.Last("stats-worker"), time.Second)
+}
@@ -0,0 +1,142 @@
+package sankey
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Enum names used in config files. Section names follow the diagram left to right;
+// the rest match the ha-sankey-chart option values emitted by the generator.
+var (
+	sectionNames       = []string{"powerhouse_in", "powerhouse", "powerhouse_out", "house_mains_in", "house_mains", "house_mains_out"}
+	templateTypeNames  = []string{"formula", "sum"}
+	shouldBeNames      = []string{"equal", "equal_or_less", "equal_or_more"}
+	reconcileToNames   = []string{"min", "max", "mean", "latest"}
+	remainderTypeNames = []string{"remaining_parent_state", "remaining_child_state"}
+)
+
+func enumText(names []string, v int) ([]byte, error) {
+	if v < 0 || v >= len(names) {
+		return nil, fmt.Errorf("value %d out of range", v)
+	}
+	return []byte(names[v]), nil
+}
+
+func parseEnum(names []string, text []byte) (int, error) {
+	for i, name := range names {
+		if string(text) == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown value %q (want one of %v)", text, names)
+}
+
+func (s Section) MarshalText() ([]byte, error) { return enumText(sectionNames, int(s)) }
+
+func (s *Section) UnmarshalText(text []byte) error {
+	v, err := parseEnum(sectionNames, text)
+	*s = Section(v)
+	return err
+}
+
+func (t TemplateType) MarshalText() ([]byte, error) { return enumText(templateTypeNames, int(t)) }
+
+func (t *TemplateType) UnmarshalText(text []byte) error {
+	v, err := parseEnum(templateTypeNames, text)
+	*t = TemplateType(v)
+	return err
+}
+
+func (s ShouldBe) MarshalText() ([]byte, error) { return enumText(shouldBeNames, int(s)) }
+
+func (s *ShouldBe) UnmarshalText(text []byte) error {
+	v, err := parseEnum(shouldBeNames, text)
+	*s = ShouldBe(v)
+	return err
+}
+
+func (r ReconcileTo) MarshalText() ([]byte, error) { return enumText(reconcileToNames, int(r)) }
+
+func (r *ReconcileTo) UnmarshalText(text []byte) error {
+	v, err := parseEnum(reconcileToNames, text)
+	*r = ReconcileTo(v)
+	return err
+}
+
+func (r RemainderType) MarshalText() ([]byte, error) { return enumText(remainderTypeNames, int(r)) }
+
+func (r *RemainderType) UnmarshalText(text []byte) error {
+	v, err := parseEnum(remainderTypeNames, text)
+	*r = RemainderType(v)
+	return err
+}
+
+// Validate checks structural consistency: unique node ids, resolvable children and
+// template sensors that carry the field their type needs.
+func (cfg Config) Validate() error {
+	var errs []error
+
+	seen := map[string]bool{}
+	groupNames := map[string]bool{}
+	for _, g := range cfg.Groups {
+		groupNames[g.Name] = true
+		for _, id := range groupEntityIDs(g) {
+			if seen[id] {
+				errs = append(errs, fmt.Errorf("node id %q appears more than once", id))
+			}
+			seen[id] = true
+		}
+	}
+	for _, g := range cfg.Groups {
+		for _, child := range g.Children {
+			if !groupNames[child] {
+				errs = append(errs, fmt.Errorf("group %q references unknown child group %q", g.Name, child))
+			}
+		}
+	}
+	for _, s := range cfg.Sensors {
+		switch {
+		case s.Type == TemplateFormula && s.Formula == "":
+			errs = append(errs, fmt.Errorf("template sensor %q has no formula", s.Name))
+		case s.Type == TemplateSum && len(s.Entities) == 0:
+			errs = append(errs, fmt.Errorf("template sensor %q has no entities", s.Name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ParseConfig decodes and validates a JSON diagram definition. Unknown fields are
+// rejected so typos don't silently drop part of the diagram.
+func ParseConfig(data []byte) (Config, error) {
+	var cfg Config
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return Config{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// LoadConfig reads a JSON diagram definition from path.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg, err := ParseConfig(data)
+	if err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// MarshalConfig renders cfg as indented JSON, e.g. to seed a config file from DefaultConfig.
+func MarshalConfig(cfg Config) ([]byte, error) {
+	return json.MarshalIndent(cfg, "", "  ")
+}
@@ -0,0 +1,77 @@
+package sankey
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefaultConfigRoundTripsThroughJSON(t *testing.T) {
+	data, err := MarshalConfig(DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := ParseConfig(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Generate()
+	got := GenerateFrom(cfg)
+	if got.SankeyConfig != want.SankeyConfig {
+		t.Error("sankey card differs after JSON round trip")
+	}
+	if got.Templates != want.Templates {
+		t.Error("templates differ after JSON round trip")
+	}
+}
+
+func TestParseConfigEnumNames(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`{
+		"sensors": [{"name": "lights", "type": "sum", "entities": ["sensor.a", "sensor.b"]}],
+		"groups": [{
+			"name": "house", "section": "house_mains",
+			"sensors": [{"name": "sensor.house"}],
+			"other": {"key": "other", "label": "Other", "type": "remaining_parent_state",
+				"children_sum": {"should_be": "equal_or_less", "reconcile_to": "max"}}
+		}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Groups[0].Section != SectionHouseMains {
+		t.Errorf("section = %d, want %d", cfg.Groups[0].Section, SectionHouseMains)
+	}
+	if cfg.Sensors[0].Type != TemplateSum {
+		t.Errorf("template type = %d, want sum", cfg.Sensors[0].Type)
+	}
+	if cs := cfg.Groups[0].Other.ChildrenSum; cs.ShouldBe != ShouldBeEqualOrLess || cs.ReconcileTo != ReconcileToMax {
+		t.Errorf("children_sum = %+v", cs)
+	}
+}
+
+func TestParseConfigRejectsMistakes(t *testing.T) {
+	cases := map[string]string{
+		"unknown section": `{"groups": [{"name": "a", "section": "attic"}]}`,
+		"unknown field":   `{"groups": [{"name": "a", "section": "powerhouse", "sensor": []}]}`,
+		"unknown child":   `{"groups": [{"name": "a", "section": "powerhouse", "children": ["b"]}]}`,
+		"duplicate node": `{"groups": [
+			{"name": "a", "section": "powerhouse", "sensors": [{"name": "sensor.x"}]},
+			{"name": "b", "section": "powerhouse_out", "sensors": [{"name": "sensor.x"}]}]}`,
+		"empty formula": `{"sensors": [{"name": "s", "type": "formula"}], "groups": []}`,
+	}
+	for name, data := range cases {
+		if _, err := ParseConfig([]byte(data)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestMarshalConfigUsesNames(t *testing.T) {
+	data, err := MarshalConfig(DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"section": "powerhouse_in"`) {
+		t.Error("expected section names in marshalled config")
+	}
+}
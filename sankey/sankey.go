@@ -8,7 +8,11 @@ type GeneratedConfigs struct {
 
 // Generate produces both YAML configurations from the default config
 func Generate() GeneratedConfigs {
-	cfg := DefaultConfig()
+	return GenerateFrom(DefaultConfig())
+}
+
+// GenerateFrom produces both YAML configurations from cfg
+func GenerateFrom(cfg Config) GeneratedConfigs {
 	return GeneratedConfigs{
 		SankeyConfig: GenerateSankeyYAML(cfg),
 		Templates:    GenerateTemplatesYAML(cfg),
@@ -22,16 +22,16 @@ const (
 
 // SensorTemplate defines a calculated sensor template
 type SensorTemplate struct {
-	Name     string
-	Type     TemplateType
-	Formula  string   // Used when Type == TemplateFormula
-	Entities []string // Used when Type == TemplateSum
+	Name     string       `json:"name"`
+	Type     TemplateType `json:"type"`
+	Formula  string       `json:"formula,omitempty"`  // Used when Type == TemplateFormula
+	Entities []string     `json:"entities,omitempty"` // Used when Type == TemplateSum
 }
 
 // Sensor represents a sensor entity in a group
 type Sensor struct {
-	Name  string
-	Label string // Optional display label
+	Name  string `json:"name"`
+	Label string `json:"label,omitempty"` // Optional display label
 }
 
 // ShouldBe represents the comparison type for reconciliation
@@ -83,8 +83,8 @@ func (r ReconcileTo) String() string {
 
 // Reconcile represents validation/correction rules
 type Reconcile struct {
-	ShouldBe    ShouldBe
-	ReconcileTo ReconcileTo
+	ShouldBe    ShouldBe    `json:"should_be"`
+	ReconcileTo ReconcileTo `json:"reconcile_to"`
 }
 
 // RemainderType represents the type of remainder calculation
@@ -108,24 +108,24 @@ func (r RemainderType) String() string {
 
 // RemainderStrategy defines a calculated remainder entity
 type RemainderStrategy struct {
-	Key         string
-	Label       string
-	Type        RemainderType
-	ChildrenSum *Reconcile // Optional
-	ParentsSum  *Reconcile // Optional
+	Key         string        `json:"key"`
+	Label       string        `json:"label"`
+	Type        RemainderType `json:"type"`
+	ChildrenSum *Reconcile    `json:"children_sum,omitempty"` // Optional
+	ParentsSum  *Reconcile    `json:"parents_sum,omitempty"`  // Optional
 }
 
 // Group represents a group of sensors in a section
 type Group struct {
-	Name     string
-	Section  Section
-	Sensors  []Sensor
-	Other    *RemainderStrategy // Optional remainder entity
-	Children []string           // Child group names
+	Name     string             `json:"name"`
+	Section  Section            `json:"section"`
+	Sensors  []Sensor           `json:"sensors,omitempty"`
+	Other    *RemainderStrategy `json:"other,omitempty"`    // Optional remainder entity
+	Children []string           `json:"children,omitempty"` // Child group names
 }
 
 // Config holds the complete sankey configuration
 type Config struct {
-	Sensors []SensorTemplate
-	Groups  []Group
+	Sensors []SensorTemplate `json:"sensors"`
+	Groups  []Group          `json:"groups"`
 }
@@ -0,0 +1,108 @@
+package sankey
+
+import (
+	"regexp"
+	"slices"
+)
+
+// formulaEntityPattern matches entity IDs referenced from Jinja formulas, e.g. states('sensor.x').
+var formulaEntityPattern = regexp.MustCompile(`'([a-z_]+\.[a-z0-9_]+)'`)
+
+// MissingEntity is a referenced entity that doesn't exist, with the closest known
+// entity ID when one is near enough to be a likely misspelling.
+type MissingEntity struct {
+	ID         string
+	Suggestion string
+}
+
+// ReferencedEntities returns every HA entity ID the generated card and templates
+// read, sorted and deduplicated. Entities the templates themselves create are excluded.
+func ReferencedEntities(cfg Config) []string {
+	provided := providedEntities(cfg)
+
+	var ids []string
+	add := func(id string) {
+		if !provided[id] {
+			ids = append(ids, id)
+		}
+	}
+	for _, s := range cfg.Sensors {
+		for _, e := range s.Entities {
+			add(e)
+		}
+		for _, m := range formulaEntityPattern.FindAllStringSubmatch(s.Formula, -1) {
+			add(m[1])
+		}
+	}
+	for _, g := range cfg.Groups {
+		for _, s := range g.Sensors {
+			add(s.Name)
+		}
+	}
+
+	slices.Sort(ids)
+	return slices.Compact(ids)
+}
+
+// providedEntities returns the sensor entity IDs created by the generated templates.
+func providedEntities(cfg Config) map[string]bool {
+	provided := make(map[string]bool, len(cfg.Sensors))
+	for _, s := range cfg.Sensors {
+		provided["sensor."+s.Name] = true
+	}
+	return provided
+}
+
+// MissingEntities cross-checks every referenced entity against known (e.g. the
+// entity list from HA's REST API) and returns the ones that don't exist.
+func MissingEntities(cfg Config, known []string) []MissingEntity {
+	knownSet := make(map[string]bool, len(known))
+	for _, id := range known {
+		knownSet[id] = true
+	}
+
+	var missing []MissingEntity
+	for _, id := range ReferencedEntities(cfg) {
+		if !knownSet[id] {
+			missing = append(missing, MissingEntity{ID: id, Suggestion: closestEntity(id, known)})
+		}
+	}
+	return missing
+}
+
+// maxSuggestionDistance is the largest edit distance still treated as a likely typo.
+const maxSuggestionDistance = 3
+
+// closestEntity returns the known entity with the smallest edit distance to id, or ""
+// if none is within maxSuggestionDistance.
+func closestEntity(id string, known []string) string {
+	best := ""
+	bestDist := maxSuggestionDistance + 1
+	for _, k := range known {
+		if d := editDistance(id, k); d < bestDist {
+			best, bestDist = k, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
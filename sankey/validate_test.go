@@ -0,0 +1,67 @@
+package sankey
+
+import (
+	"slices"
+	"testing"
+)
+
+func testValidateConfig() Config {
+	return Config{
+		Sensors: []SensorTemplate{
+			{Name: "inverter_inverted", Type: TemplateFormula, Formula: "states('sensor.inverter_power') | multiply(-1)"},
+			{Name: "all_lights", Type: TemplateSum, Entities: []string{"sensor.lamp_power", "sensor.downlight_power"}},
+		},
+		Groups: []Group{
+			{Name: "out", Section: SectionPowerhouseOut, Sensors: []Sensor{
+				{Name: "sensor.inverter_inverted"}, // created by the template above
+				{Name: "sensor.solar_power"},
+			}},
+			{Name: "house", Section: SectionHouseMains, Sensors: []Sensor{{Name: "sensor.lamp_power"}}},
+		},
+	}
+}
+
+func TestReferencedEntities(t *testing.T) {
+	got := ReferencedEntities(testValidateConfig())
+	want := []string{"sensor.downlight_power", "sensor.inverter_power", "sensor.lamp_power", "sensor.solar_power"}
+	if !slices.Equal(got, want) {
+		t.Errorf("ReferencedEntities = %v, want %v", got, want)
+	}
+}
+
+func TestMissingEntitiesSuggestsMisspelling(t *testing.T) {
+	known := []string{"sensor.inverter_power", "sensor.lamp_power", "sensor.downlights_power", "sensor.garage_door"}
+	missing := MissingEntities(testValidateConfig(), known)
+
+	want := []MissingEntity{
+		{ID: "sensor.downlight_power", Suggestion: "sensor.downlights_power"},
+		{ID: "sensor.solar_power", Suggestion: ""},
+	}
+	if !slices.Equal(missing, want) {
+		t.Errorf("MissingEntities = %+v, want %+v", missing, want)
+	}
+}
+
+func TestDefaultConfigReferencesOnlySensors(t *testing.T) {
+	for _, id := range ReferencedEntities(DefaultConfig()) {
+		if len(id) < len("sensor.") || id[:len("sensor.")] != "sensor." {
+			t.Errorf("unexpected non-sensor entity %q", id)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+		{"same", "same", 0},
+	}
+	for _, c := range cases {
+		if got := editDistance(c.a, c.b); got != c.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
@@ -1,207 +0,0 @@
-package main
-
-import (
-	"strings"
-)
-
-// solarForecastMultiplier scales the single-site Solcast forecast to the actual array output.
-// Shared by the Battery 2 baseline forecast-excess mode and the Battery 3 dynamic charge limit.
-const solarForecastMultiplier = 3.9
-
-// BatteryConfig holds shared configuration for a battery
-type BatteryConfig struct {
-	Name                 string
-	CapacityKWh          float64
-	Manufacturer         string
-	InflowEnergyTopics   []string // Cumulative energy (kWh)
-	OutflowEnergyTopics  []string // Cumulative energy (kWh)
-	InflowPowerTopics    []string // Instantaneous power (W)
-	OutflowPowerTopics   []string // Instantaneous power (W)
-	ChargeStateTopic     string
-	BatteryVoltageTopic  string
-	CalibrationTopics    CalibrationTopics
-	HighVoltageThreshold float64
-	FloatChargeState     string
-	ConversionLossRate   float64
-	InverterSwitchIDs    []string
-	CerboSOCTopic        string // If set, SOC entity reads from this Cerbo MQTT topic instead of powerctl state
-}
-
-// CalibrationTopics holds statestream topic paths for calibration data
-type CalibrationTopics struct {
-	Inflows  string
-	Outflows string
-}
-
-// BatteryCalibConfig holds configuration for the calibration worker
-type BatteryCalibConfig struct {
-	Name                 string
-	ChargeStateTopic     string
-	BatteryVoltageTopic  string
-	InflowEnergyTopics   []string // Cumulative energy (kWh)
-	OutflowEnergyTopics  []string // Cumulative energy (kWh)
-	InflowPowerTopics    []string // Instantaneous power (W)
-	OutflowPowerTopics   []string // Instantaneous power (W)
-	HighVoltageThreshold float64
-	FloatChargeState     string
-	CalibrationTopics    CalibrationTopics // To read/write calibration values
-	SOCTopic             string            // To read current SOC from DisplayData
-}
-
-// BatterySOCConfig holds configuration for the SOC worker
-type BatterySOCConfig struct {
-	Name                string
-	CapacityKWh         float64
-	InflowEnergyTopics  []string
-	OutflowEnergyTopics []string
-	CalibrationTopics   CalibrationTopics
-	ConversionLossRate  float64
-}
-
-// CalibConfig creates a BatteryCalibConfig from the shared BatteryConfig
-func (c *BatteryConfig) CalibConfig() BatteryCalibConfig {
-	deviceID := strings.ReplaceAll(strings.ToLower(c.Name), " ", "_")
-	return BatteryCalibConfig{
-		Name:                 c.Name,
-		ChargeStateTopic:     c.ChargeStateTopic,
-		BatteryVoltageTopic:  c.BatteryVoltageTopic,
-		InflowEnergyTopics:   c.InflowEnergyTopics,
-		OutflowEnergyTopics:  c.OutflowEnergyTopics,
-		InflowPowerTopics:    c.InflowPowerTopics,
-		OutflowPowerTopics:   c.OutflowPowerTopics,
-		HighVoltageThreshold: c.HighVoltageThreshold,
-		FloatChargeState:     c.FloatChargeState,
-		CalibrationTopics:    c.CalibrationTopics,
-		SOCTopic:             "homeassistant/sensor/" + deviceID + "_state_of_charge/state",
-	}
-}
-
-// AvailableEnergyFromSOCConfig creates a BatteryAvailableEnergyConfig for batteries
-// whose SOC is published by an external source (e.g. Cerbo GX via HA entity).
-func (c *BatteryConfig) AvailableEnergyFromSOCConfig() BatteryAvailableEnergyConfig {
-	deviceID := strings.ReplaceAll(strings.ToLower(c.Name), " ", "_")
-	return BatteryAvailableEnergyConfig{
-		Name:        c.Name,
-		SOCTopic:    "homeassistant/sensor/" + deviceID + "_state_of_charge/state",
-		CapacityKWh: c.CapacityKWh,
-	}
-}
-
-// SOCConfig creates a BatterySOCConfig from the shared BatteryConfig
-func (c *BatteryConfig) SOCConfig() BatterySOCConfig {
-	return BatterySOCConfig{
-		Name:                c.Name,
-		CapacityKWh:         c.CapacityKWh,
-		InflowEnergyTopics:  c.InflowEnergyTopics,
-		OutflowEnergyTopics: c.OutflowEnergyTopics,
-		CalibrationTopics:   c.CalibrationTopics,
-		ConversionLossRate:  c.ConversionLossRate,
-	}
-}
-
-// buildInverterGroup converts a BatteryConfig to a BatteryInverterGroup.
-func buildInverterGroup(b BatteryConfig, availableEnergyTopic string) BatteryInverterGroup {
-	inverters := make([]InverterInfo, len(b.InverterSwitchIDs))
-	for i, entityID := range b.InverterSwitchIDs {
-		parts := strings.SplitN(entityID, ".", 2)
-		stateTopic := ""
-		if len(parts) == 2 {
-			stateTopic = "homeassistant/" + parts[0] + "/" + parts[1] + "/state"
-		}
-		inverters[i] = InverterInfo{EntityID: entityID, StateTopic: stateTopic}
-	}
-	deviceID := strings.ReplaceAll(strings.ToLower(b.Name), " ", "_")
-	return BatteryInverterGroup{
-		Name:                 b.Name,
-		Inverters:            inverters,
-		ChargeStateTopic:     b.ChargeStateTopic,
-		SOCTopic:             "homeassistant/sensor/" + deviceID + "_state_of_charge/state",
-		BatteryVoltageTopic:  b.BatteryVoltageTopic,
-		CapacityWh:           b.CapacityKWh * 1000,
-		SolarMultiplier:      solarForecastMultiplier,
-		AvailableEnergyTopic: availableEnergyTopic,
-	}
-}
-
-// BuildBaselineInverterConfig creates configuration for the baseline inverter controller.
-func BuildBaselineInverterConfig(battery2, battery3 BatteryConfig) BaselineInverterConfig {
-	group := buildInverterGroup(battery2, TopicBattery2Energy)
-	deviceID2 := strings.ReplaceAll(strings.ToLower(battery2.Name), " ", "_")
-
-	inverterStateTopics := make([]string, len(battery2.InverterSwitchIDs))
-	for i, entityID := range battery2.InverterSwitchIDs {
-		parts := strings.SplitN(entityID, ".", 2)
-		if len(parts) == 2 {
-			inverterStateTopics[i] = "homeassistant/" + parts[0] + "/" + parts[1] + "/state"
-		}
-	}
-
-	input := BaselineInputConfig{
-		Battery2SOCTopic:         "homeassistant/sensor/" + deviceID2 + "_state_of_charge/state",
-		Battery2ChargeStateTopic: battery2.ChargeStateTopic,
-		Battery2VoltageTopic:     battery2.BatteryVoltageTopic,
-		Battery2EnergyTopic:      TopicBattery2Energy,
-		Solar1PowerTopic:         TopicSolar1Power,
-		Solar2PowerTopic:         topicSolar2ACPower,
-		HouseLoadTopic:           topicHouseLoadPower2,
-		GridStatusTopic:          "homeassistant/binary_sensor/home_sweet_home_grid_status_2/state",
-		ACFrequencyTopic:         topicACFrequency,
-		ForecastRemainingTopic:   TopicSolcastForecastRemaining,
-		DetailedForecastTopic:    TopicSolcastDetailedForecast,
-		InverterStateTopics:      inverterStateTopics,
-		Battery3SOCTopic:         "homeassistant/sensor/" + strings.ReplaceAll(strings.ToLower(battery3.Name), " ", "_") + "_state_of_charge/state",
-		PowerwallSOCTopic:        "homeassistant/sensor/home_sweet_home_charge/state",
-		ExpectingPowerCutsTopic:  TopicExpectingPowerCutsState,
-	}
-
-	return BaselineInverterConfig{
-		Input:                   input,
-		Battery2:                group,
-		WattsPerInverter:        255.0,
-		MaxTransferPower:        5000.0,
-		MaxBaselineWatts:        500.0,
-		OverflowSOCTurnOffStart: 98.5,
-		OverflowSOCTurnOffEnd:   95.0,
-		OverflowSOCTurnOnStart:  95.75,
-		OverflowSOCTurnOnEnd:    99.5,
-		LowVoltageTurnOnStart:   52.0,
-		LowVoltageTurnOnEnd:     53.0,
-		LowVoltageTurnOffStart:  50.75,
-		LowVoltageTurnOffEnd:    52.0,
-	}
-}
-
-// BuildDynamicInverterConfig creates configuration for the dynamic (Multiplus) inverter controller.
-func BuildDynamicInverterConfig(battery2, battery3 BatteryConfig) DynamicInverterConfig {
-	return DynamicInverterConfig{
-		Input: DynamicInputConfig{
-			HouseLoadTopic:            topicHouseLoadPower2,
-			Solar1PowerTopic:          TopicSolar1Power,
-			Solar2PowerTopic:          topicSolar2ACPower,
-			Inverter1to9PowerTopics:   battery2.OutflowPowerTopics,
-			MultiplusACPowerTopic:     "homeassistant/sensor/powerhouse_inverter_10_ac_power/state",
-			Battery3SOCTopic:          "homeassistant/sensor/" + strings.ReplaceAll(strings.ToLower(battery3.Name), " ", "_") + "_state_of_charge/state",
-			GridStatusTopic:           "homeassistant/binary_sensor/home_sweet_home_grid_status_2/state",
-			ACFrequencyTopic:          topicACFrequency,
-			PowerwallSOCTopic:         "homeassistant/sensor/home_sweet_home_charge/state",
-			DynamicAutoTopic:          TopicDynamicAutoState,
-			MultiplusSetpointCmdTopic: TopicInverter10SetpointCmd,
-			CarChargingEnabledTopic:   TopicCarChargingEnabledState,
-			CarChargingActiveTopic:    "homeassistant/binary_sensor/plb942_charging/state",
-			CarBatterySOCTopic:        "homeassistant/sensor/plb942_battery/state",
-			CarBattery3CutoffTopic:    TopicCarChargingBattery3CutoffState,
-			Solar34PowerTopics:        battery3.InflowPowerTopics,
-			Battery3DCCurrentTopic:    "homeassistant/sensor/battery_3_dc_current/state",
-			Battery3CCLTopic:          "homeassistant/sensor/battery_3_charge_current_limit/state",
-			Battery3CVLTopic:          "homeassistant/sensor/battery_3_charge_voltage_limit/state",
-			Battery3VoltageTopic:      "homeassistant/sensor/solar_3_battery_voltage/state",
-			Solar3BatteryCurrentTopic: "homeassistant/sensor/solar_3_battery_current/state",
-			Solar4BatteryCurrentTopic: "homeassistant/sensor/solar_4_battery_current/state",
-			PowerhouseNetPowerTopic:   "homeassistant/sensor/powerhouse_net_power/state",
-			ForecastRemainingTopic:    TopicSolcastForecastRemaining,
-			DetailedForecastTopic:     TopicSolcastDetailedForecast,
-			Battery3CapacityWh:        battery3.CapacityKWh * 1000,
-			SolarMultiplier:           solarForecastMultiplier,
-		},
-	}
-}
@@ -1,1166 +0,0 @@
-package main
-
-import (
-	"bytes"
-	"context"
-	"encoding/json"
-	"fmt"
-	"log"
-	"strconv"
-	"strings"
-	"time"
-
-	mqtt "github.com/eclipse/paho.mqtt.golang"
-)
-
-type lastSentInfo struct {
-	payload []byte
-	sentAt  time.Time
-}
-
-const resendInterval = 5 * time.Minute
-
-const (
-	deviceNamePowerctl       = "Powerctl"
-	deviceManufacturerCustom = "Custom"
-	deviceIDBattery3         = "battery_3"
-	deviceNameBattery3       = "Battery 3"
-	deviceIDInverter10       = "powerhouse_inverter_10"
-	deviceNameInverter10     = "Powerhouse Inverter 10"
-	deviceModelMultiplus2    = "Multiplus II 48/5000/70"
-	deviceClassCurrent       = "current"
-	deviceIDPowerctl         = "powerctl"
-	deviceIDWaterTanks       = "water_tanks"
-	deviceNameWaterTanks     = "Water Tanks"
-	stateClassMeasurement    = "measurement"
-	valueTemplateJSONValue   = "{{ value_json.value }}"
-	haServiceValueKey        = "value"
-)
-
-// MQTTMessage represents an outgoing MQTT message
-type MQTTMessage struct {
-	Topic   string
-	Payload []byte
-	QoS     byte
-	Retain  bool
-}
-
-// MQTTSender wraps a channel for sending MQTT messages with helper methods
-type MQTTSender struct {
-	ch chan<- MQTTMessage
-}
-
-// NewMQTTSender creates a new MQTTSender wrapping the given channel
-func NewMQTTSender(ch chan<- MQTTMessage) *MQTTSender {
-	return &MQTTSender{ch: ch}
-}
-
-// Send sends a raw MQTTMessage
-func (s *MQTTSender) Send(msg MQTTMessage) {
-	s.ch <- msg
-}
-
-// TopicCallServiceProxy is the MQTT topic an HA automation listens on to make
-// service calls on powerctl's behalf (replaces the old nodered/proxy flow).
-const TopicCallServiceProxy = "powerctl/ha/call_service"
-
-// CallService sends a Home Assistant service call via the MQTT call_service proxy
-func (s *MQTTSender) CallService(domain, service, entityID string, data map[string]any) {
-	payload := map[string]any{
-		"domain":  domain,
-		"service": service,
-	}
-	if entityID != "" {
-		payload["entity_id"] = entityID
-	}
-	if data != nil {
-		payload["data"] = data
-	}
-	payloadBytes, _ := json.Marshal(payload)
-
-	s.ch <- MQTTMessage{
-		Topic:   TopicCallServiceProxy,
-		Payload: payloadBytes,
-		QoS:     1,
-		Retain:  false,
-	}
-}
-
-// CreateBatteryEntity creates a Home Assistant battery entity via MQTT discovery
-func (s *MQTTSender) CreateBatteryEntity(
-	batteryName string,
-	capacityKWh float64,
-	manufacturer string,
-	entityName, entityClass, entityMeasure, jsonKey string,
-	displayPrecision int,
-) error {
-	type haDeviceConfig struct {
-		Identifiers  []string `json:"identifiers"`
-		Name         string   `json:"name"`
-		Manufacturer string   `json:"manufacturer,omitempty"`
-		Model        string   `json:"model,omitempty"`
-	}
-
-	type haEntityConfig struct {
-		Name                string         `json:"name,omitempty"`
-		DeviceClass         string         `json:"device_class"`
-		StateTopic          string         `json:"state_topic"`
-		JsonAttributesTopic string         `json:"json_attributes_topic,omitempty"`
-		UnitOfMeasure       string         `json:"unit_of_measurement,omitempty"`
-		ValueTemplate       string         `json:"value_template"`
-		UniqueId            string         `json:"unique_id"`
-		ExpireAfter         uint           `json:"expire_after,omitempty"`
-		StateClass          string         `json:"state_class,omitempty"`
-		DisplayPrecision    int            `json:"suggested_display_precision,omitempty"`
-		Device              haDeviceConfig `json:"device"`
-	}
-
-	deviceId := strings.ReplaceAll(strings.ToLower(batteryName), " ", "_")
-
-	config := haEntityConfig{
-		Name:                entityName,
-		DeviceClass:         entityClass,
-		StateTopic:          "powerctl/sensor/" + deviceId + "/state",
-		JsonAttributesTopic: "powerctl/sensor/" + deviceId + "/attributes",
-		UnitOfMeasure:       entityMeasure,
-		ValueTemplate:       "{{ value_json." + jsonKey + "}}",
-		UniqueId:            deviceId + "_" + jsonKey,
-		ExpireAfter:         60 * 30, // 30 minutes
-		StateClass:          stateClassMeasurement,
-		DisplayPrecision:    displayPrecision,
-		Device: haDeviceConfig{
-			Identifiers:  []string{deviceId},
-			Name:         batteryName,
-			Manufacturer: manufacturer,
-			Model:        fmt.Sprintf("%.0f kWh", capacityKWh),
-		},
-	}
-
-	configTopic := "homeassistant/sensor/" + deviceId + "_" + jsonKey + "/config"
-
-	payload, err := json.Marshal(config)
-	if err != nil {
-		return err
-	}
-
-	s.Send(MQTTMessage{
-		Topic:   configTopic,
-		Payload: payload,
-		QoS:     2,
-		Retain:  true,
-	})
-
-	return nil
-}
-
-// CreateBatterySOCEntityFromCerbo creates a battery SOC entity that reads directly
-// from a Cerbo GX MQTT topic ({"value": N} format) instead of powerctl state.
-func (s *MQTTSender) CreateBatterySOCEntityFromCerbo(
-	batteryName string,
-	capacityKWh float64,
-	manufacturer string,
-	cerboSOCTopic string,
-) error {
-	type haDeviceConfig struct {
-		Identifiers  []string `json:"identifiers"`
-		Name         string   `json:"name"`
-		Manufacturer string   `json:"manufacturer,omitempty"`
-		Model        string   `json:"model,omitempty"`
-	}
-
-	type haEntityConfig struct {
-		Name             string         `json:"name,omitempty"`
-		DeviceClass      string         `json:"device_class"`
-		StateTopic       string         `json:"state_topic"`
-		UnitOfMeasure    string         `json:"unit_of_measurement,omitempty"`
-		ValueTemplate    string         `json:"value_template"`
-		UniqueId         string         `json:"unique_id"`
-		ExpireAfter      uint           `json:"expire_after,omitempty"`
-		StateClass       string         `json:"state_class,omitempty"`
-		DisplayPrecision int            `json:"suggested_display_precision,omitempty"`
-		Device           haDeviceConfig `json:"device"`
-	}
-
-	deviceId := strings.ReplaceAll(strings.ToLower(batteryName), " ", "_")
-
-	config := haEntityConfig{
-		Name:             "State of Charge",
-		DeviceClass:      "battery",
-		StateTopic:       cerboSOCTopic,
-		UnitOfMeasure:    "%",
-		ValueTemplate:    valueTemplateJSONValue,
-		UniqueId:         deviceId + "_percentage",
-		ExpireAfter:      60 * 30,
-		StateClass:       stateClassMeasurement,
-		DisplayPrecision: 1,
-		Device: haDeviceConfig{
-			Identifiers:  []string{deviceId},
-			Name:         batteryName,
-			Manufacturer: manufacturer,
-			Model:        fmt.Sprintf("%.0f kWh", capacityKWh),
-		},
-	}
-
-	payload, err := json.Marshal(config)
-	if err != nil {
-		return err
-	}
-
-	s.Send(MQTTMessage{
-		Topic:   "homeassistant/sensor/" + deviceId + "_percentage/config",
-		Payload: payload,
-		QoS:     2,
-		Retain:  true,
-	})
-
-	return nil
-}
-
-// CreateDebugSensor creates a simple debug sensor via MQTT discovery
-func (s *MQTTSender) CreateDebugSensor(sensorID, name, unit string, precision int) error {
-	type haDeviceConfig struct {
-		Identifiers  []string `json:"identifiers"`
-		Name         string   `json:"name"`
-		Manufacturer string   `json:"manufacturer,omitempty"`
-	}
-
-	type haEntityConfig struct {
-		Name             string         `json:"name"`
-		StateTopic       string         `json:"state_topic"`
-		UnitOfMeasure    string         `json:"unit_of_measurement,omitempty"`
-		UniqueId         string         `json:"unique_id"`
-		StateClass       string         `json:"state_class,omitempty"`
-		DisplayPrecision int            `json:"suggested_display_precision,omitempty"`
-		Device           haDeviceConfig `json:"device"`
-	}
-
-	config := haEntityConfig{
-		Name:             name,
-		StateTopic:       "powerctl/sensor/" + sensorID + "/state",
-		UnitOfMeasure:    unit,
-		UniqueId:         sensorID,
-		StateClass:       stateClassMeasurement,
-		DisplayPrecision: precision,
-		Device: haDeviceConfig{
-			Identifiers:  []string{deviceIDPowerctl},
-			Name:         deviceNamePowerctl,
-			Manufacturer: "DIY",
-		},
-	}
-
-	configTopic := "homeassistant/sensor/" + sensorID + "/config"
-
-	payload, err := json.Marshal(config)
-	if err != nil {
-		return err
-	}
-
-	s.Send(MQTTMessage{
-		Topic:   configTopic,
-		Payload: payload,
-		QoS:     2,
-		Retain:  true,
-	})
-
-	return nil
-}
-
-// PublishDebugSensor publishes a value to a debug sensor.
-// Uses powerctl/ prefix to avoid conflicts with HA statestream.
-func (s *MQTTSender) PublishDebugSensor(sensorID string, value float64) {
-	s.Send(MQTTMessage{
-		Topic:   "powerctl/sensor/" + sensorID + "/state",
-		Payload: []byte(strconv.FormatFloat(value, 'f', 1, 64)),
-		QoS:     0,
-		Retain:  false,
-	})
-}
-
-// createSwitch creates a Home Assistant switch via MQTT discovery.
-// NOTE: The stateTopic must also be added to selfPublishedBoolTopics in stats.go
-// and expectedTopics in main.go, or startup will block/error on first run.
-func (s *MQTTSender) createSwitch(uniqueID, name, icon, stateTopic string) error {
-	type haDeviceConfig struct {
-		Identifiers  []string `json:"identifiers"`
-		Name         string   `json:"name"`
-		Manufacturer string   `json:"manufacturer,omitempty"`
-	}
-
-	type haSwitchConfig struct {
-		Name         string         `json:"name"`
-		StateTopic   string         `json:"state_topic"`
-		CommandTopic string         `json:"command_topic"`
-		UniqueId     string         `json:"unique_id"`
-		Icon         string         `json:"icon,omitempty"`
-		Optimistic   bool           `json:"optimistic"`
-		Device       haDeviceConfig `json:"device"`
-	}
-
-	config := haSwitchConfig{
-		Name:         name,
-		StateTopic:   stateTopic,
-		CommandTopic: "powerctl/switch/" + uniqueID + "/set",
-		UniqueId:     uniqueID,
-		Icon:         icon,
-		Optimistic:   true,
-		Device: haDeviceConfig{
-			Identifiers:  []string{deviceIDPowerctl},
-			Name:         deviceNamePowerctl,
-			Manufacturer: deviceManufacturerCustom,
-		},
-	}
-
-	payload, err := json.Marshal(config)
-	if err != nil {
-		return err
-	}
-
-	s.Send(MQTTMessage{
-		Topic:   "homeassistant/switch/" + uniqueID + "/config",
-		Payload: payload,
-		QoS:     2,
-		Retain:  true,
-	})
-
-	return nil
-}
-
-// createButton creates a stateless Home Assistant button via MQTT discovery.
-// Pressing it (in the HA UI or via button.press) publishes to commandTopic;
-// powerctl routes that topic straight to the relevant worker.
-func (s *MQTTSender) createButton(uniqueID, name, icon, commandTopic string) error {
-	type haDeviceConfig struct {
-		Identifiers  []string `json:"identifiers"`
-		Name         string   `json:"name"`
-		Manufacturer string   `json:"manufacturer,omitempty"`
-	}
-
-	type haButtonConfig struct {
-		Name         string         `json:"name"`
-		CommandTopic string         `json:"command_topic"`
-		UniqueId     string         `json:"unique_id"`
-		ObjectId     string         `json:"object_id"`
-		Icon         string         `json:"icon,omitempty"`
-		Device       haDeviceConfig `json:"device"`
-	}
-
-	// object_id pins the entity_id (button.<uniqueID>) instead of letting HA
-	// derive it from the device+entity name.
-	config := haButtonConfig{
-		Name:         name,
-		CommandTopic: commandTopic,
-		UniqueId:     uniqueID,
-		ObjectId:     uniqueID,
-		Icon:         icon,
-		Device: haDeviceConfig{
-			Identifiers:  []string{deviceIDPowerctl},
-			Name:         deviceNamePowerctl,
-			Manufacturer: deviceManufacturerCustom,
-		},
-	}
-
-	payload, err := json.Marshal(config)
-	if err != nil {
-		return err
-	}
-
-	s.Send(MQTTMessage{
-		Topic:   "homeassistant/button/" + uniqueID + "/config",
-		Payload: payload,
-		QoS:     2,
-		Retain:  true,
-	})
-
-	return nil
-}
-
-func (s *MQTTSender) createSelect(uniqueID, name, icon, stateTopic string, options []string) error {
-	type haDeviceConfig struct {
-		Identifiers  []string `json:"identifiers"`
-		Name         string   `json:"name"`
-		Manufacturer string   `json:"manufacturer,omitempty"`
-	}
-
-	type haSelectConfig struct {
-		Name         string         `json:"name"`
-		StateTopic   string         `json:"state_topic"`
-		CommandTopic string         `json:"command_topic"`
-		UniqueId     string         `json:"unique_id"`
-		Icon         string         `json:"icon,omitempty"`
-		Options      []string       `json:"options"`
-		Optimistic   bool           `json:"optimistic"`
-		Device       haDeviceConfig `json:"device"`
-	}
-
-	config := haSelectConfig{
-		Name:         name,
-		StateTopic:   stateTopic,
-		CommandTopic: "powerctl/select/" + uniqueID + "/set",
-		UniqueId:     uniqueID,
-		Icon:         icon,
-		Options:      options,
-		Optimistic:   true,
-		Device: haDeviceConfig{
-			Identifiers:  []string{deviceIDPowerctl},
-			Name:         deviceNamePowerctl,
-			Manufacturer: deviceManufacturerCustom,
-		},
-	}
-
-	payload, err := json.Marshal(config)
-	if err != nil {
-		return err
-	}
-
-	s.Send(MQTTMessage{
-		Topic:   "homeassistant/select/" + uniqueID + "/config",
-		Payload: payload,
-		QoS:     2,
-		Retain:  true,
-	})
-
-	return nil
-}
-
-// CreatePowerctlSwitch creates the powerctl_enabled switch via MQTT discovery
-func (s *MQTTSender) CreatePowerctlSwitch() error {
-	return s.createSwitch("powerctl_enabled", "Enabled", "mdi:power", TopicPowerctlEnabledState)
-}
-
-// CreatePowerhouseInvertersSwitch creates the powerctl_inverter_enabled switch via MQTT discovery
-func (s *MQTTSender) CreatePowerhouseInvertersSwitch() error {
-	return s.createSwitch("powerctl_inverter_enabled", "Inverter Enabled", "mdi:power-plug", TopicPowerhouseInvertersEnabledState)
-}
-
-// CreatePW2DischargeModeSelect creates the powerctl_pw2_discharge_mode select via MQTT discovery.
-// Tri-state: Auto (delegate to automation), Force On (always discharge), Force Off (never discharge).
-func (s *MQTTSender) CreatePW2DischargeModeSelect() error {
-	return s.createSelect(
-		"powerctl_pw2_discharge_mode",
-		"PW2 Discharge Mode",
-		"mdi:battery-arrow-down",
-		TopicPW2DischargeMode,
-		[]string{PW2DischargeModeAuto, PW2DischargeModeForceOn, PW2DischargeModeForceOff},
-	)
-}
-
-// DeleteOldEntities removes obsolete HA entities by publishing empty retained discovery
-// configs. Add an entry here whenever an entity is renamed or retired so old installs
-// don't keep a ghost copy. Safe to call repeatedly.
-func (s *MQTTSender) DeleteOldEntities() {
-	obsolete := []string{
-		"homeassistant/switch/powerctl_pw2_discharge/config", // superseded by powerctl_pw2_discharge_mode select
-	}
-	for _, topic := range obsolete {
-		s.Send(MQTTMessage{
-			Topic:   topic,
-			Payload: []byte{},
-			QoS:     2,
-			Retain:  true,
-		})
-	}
-}
-
-// CreateExpectingPowerCutsSwitch creates the expecting power cuts switch via MQTT discovery
-func (s *MQTTSender) CreateExpectingPowerCutsSwitch() error {
-	return s.createSwitch("powerctl_expecting_power_cuts", "Expecting Power Cuts", "mdi:transmission-tower-off", TopicExpectingPowerCutsState)
-}
-
-// CreateDynamicAutoSwitch creates the powerctl_dynamic_auto switch via MQTT discovery.
-// When on, the dynamic controller calculates the setpoint automatically.
-// When off, the user controls the setpoint via the HA number entity.
-func (s *MQTTSender) CreateDynamicAutoSwitch() error {
-	return s.createSwitch("powerctl_dynamic_auto", "Dynamic Auto", "mdi:robot", TopicDynamicAutoState)
-}
-
-// CreateCarChargingSwitch creates the powerctl_car_charging switch via MQTT discovery.
-// When on, the dynamic controller pushes Multiplus discharge to its safe maximum to supply
-// the car charger from Battery 3 / solar instead of grid.
-func (s *MQTTSender) CreateCarChargingSwitch() error {
-	return s.createSwitch("powerctl_car_charging", "Car Charging", "mdi:car-electric", TopicCarChargingEnabledState)
-}
-
-// CreateCarChargingBattery3CutoffEntity creates the Battery 3 SOC cutoff number entity
-// for the car-charging feature. Below this SOC, car charging is suppressed and auto-disabled.
-func (s *MQTTSender) CreateCarChargingBattery3CutoffEntity() error {
-	type haDeviceConfig struct {
-		Identifiers  []string `json:"identifiers"`
-		Name         string   `json:"name"`
-		Manufacturer string   `json:"manufacturer,omitempty"`
-	}
-
-	type haNumberConfig struct {
-		Name          string         `json:"name"`
-		UniqueId      string         `json:"unique_id"`
-		CommandTopic  string         `json:"command_topic"`
-		StateTopic    string         `json:"state_topic"`
-		UnitOfMeasure string         `json:"unit_of_measurement"`
-		Min           float64        `json:"min"`
-		Max           float64        `json:"max"`
-		Step          float64        `json:"step"`
-		Mode          string         `json:"mode"`
-		Icon          string         `json:"icon,omitempty"`
-		Optimistic    bool           `json:"optimistic"`
-		Device        haDeviceConfig `json:"device"`
-	}
-
-	config := haNumberConfig{
-		Name:          "Car Charging B3 Cutoff",
-		UniqueId:      "powerctl_car_charging_battery3_cutoff",
-		CommandTopic:  TopicCarChargingBattery3CutoffCmd,
-		StateTopic:    TopicCarChargingBattery3CutoffState,
-		UnitOfMeasure: "%",
-		Min:           0,
-		Max:           100,
-		Step:          1,
-		Mode:          "slider",
-		Icon:          "mdi:battery-alert",
-		Optimistic:    true,
-		Device: haDeviceConfig{
-			Identifiers:  []string{deviceIDPowerctl},
-			Name:         deviceNamePowerctl,
-			Manufacturer: deviceManufacturerCustom,
-		},
-	}
-
-	payload, err := json.Marshal(config)
-	if err != nil {
-		return err
-	}
-
-	s.Send(MQTTMessage{
-		Topic:   "homeassistant/number/powerctl_car_charging_battery3_cutoff/config",
-		Payload: payload,
-		QoS:     2,
-		Retain:  true,
-	})
-
-	return nil
-}
-
-// CreateInverter10ACSetpointEntity creates the Multiplus II AC setpoint number entity via MQTT discovery
-func (s *MQTTSender) CreateInverter10ACSetpointEntity() error {
-	type haDeviceConfig struct {
-		Identifiers []string `json:"identifiers"`
-		Name        string   `json:"name"`
-		Model       string   `json:"model,omitempty"`
-	}
-
-	type haNumberConfig struct {
-		Name          string         `json:"name"`
-		UniqueId      string         `json:"unique_id"`
-		StateTopic    string         `json:"state_topic"`
-		ValueTemplate string         `json:"value_template"`
-		CommandTopic  string         `json:"command_topic"`
-		UnitOfMeasure string         `json:"unit_of_measurement"`
-		Min           float64        `json:"min"`
-		Max           float64        `json:"max"`
-		Step          float64        `json:"step"`
-		Mode          string         `json:"mode"`
-		Device        haDeviceConfig `json:"device"`
-	}
-
-	config := haNumberConfig{
-		Name:          "AC Setpoint",
-		UniqueId:      "powerhouse_inverter_10_ac_setpoint",
-		StateTopic:    TopicMultiplusSetpointRead,
-		ValueTemplate: valueTemplateJSONValue,
-		CommandTopic:  TopicInverter10SetpointCmd,
-		UnitOfMeasure: "W",
-		Min:           -3000,
-		Max:           3500,
-		Step:          10,
-		Mode:          "slider",
-		Device: haDeviceConfig{
-			Identifiers: []string{deviceIDInverter10},
-			Name:        deviceNameInverter10,
-			Model:       deviceModelMultiplus2,
-		},
-	}
-
-	payload, err := json.Marshal(config)
-	if err != nil {
-		return err
-	}
-
-	s.Send(MQTTMessage{
-		Topic:   "homeassistant/number/powerhouse_inverter_10_ac_setpoint/config",
-		Payload: payload,
-		QoS:     2,
-		Retain:  true,
-	})
-
-	return nil
-}
-
-// CreateMultiplusACPowerEntity creates the Multiplus II AC output power sensor entity via MQTT discovery
-func (s *MQTTSender) CreateMultiplusACPowerEntity() error {
-	type haDeviceConfig struct {
-		Identifiers []string `json:"identifiers"`
-		Name        string   `json:"name"`
-		Model       string   `json:"model,omitempty"`
-	}
-
-	type haSensorConfig struct {
-		Name          string         `json:"name"`
-		UniqueId      string         `json:"unique_id"`
-		StateTopic    string         `json:"state_topic"`
-		ValueTemplate string         `json:"value_template"`
-		UnitOfMeasure string         `json:"unit_of_measurement"`
-		DeviceClass   string         `json:"device_class"`
-		StateClass    string         `json:"state_class"`
-		Device        haDeviceConfig `json:"device"`
-	}
-
-	config := haSensorConfig{
-		Name:          "AC Power",
-		UniqueId:      "powerhouse_inverter_10_ac_power",
-		StateTopic:    TopicMultiplusACPower,
-		ValueTemplate: valueTemplateJSONValue,
-		UnitOfMeasure: "W",
-		DeviceClass:   "power",
-		StateClass:    stateClassMeasurement,
-		Device: haDeviceConfig{
-			Identifiers: []string{deviceIDInverter10},
-			Name:        deviceNameInverter10,
-			Model:       deviceModelMultiplus2,
-		},
-	}
-
-	payload, err := json.Marshal(config)
-	if err != nil {
-		return err
-	}
-
-	s.Send(MQTTMessage{
-		Topic:   "homeassistant/sensor/powerhouse_inverter_10_ac_power/config",
-		Payload: payload,
-		QoS:     2,
-		Retain:  true,
-	})
-
-	return nil
-}
-
-// CreateMultiplusDCCurrentEntity creates the Multiplus II DC current sensor entity via MQTT discovery.
-// Reads the inverter's own DC (battery-side) current from the Cerbo vebus topic — the Multiplus's
-// contribution to battery current, distinct from battery_3_dc_current (system total).
-func (s *MQTTSender) CreateMultiplusDCCurrentEntity() error {
-	type haDeviceConfig struct {
-		Identifiers []string `json:"identifiers"`
-		Name        string   `json:"name"`
-		Model       string   `json:"model,omitempty"`
-	}
-
-	type haSensorConfig struct {
-		Name          string         `json:"name"`
-		UniqueId      string         `json:"unique_id"`
-		StateTopic    string         `json:"state_topic"`
-		ValueTemplate string         `json:"value_template"`
-		UnitOfMeasure string         `json:"unit_of_measurement"`
-		DeviceClass   string         `json:"device_class"`
-		StateClass    string         `json:"state_class"`
-		Device        haDeviceConfig `json:"device"`
-	}
-
-	config := haSensorConfig{
-		Name:          "DC Current",
-		UniqueId:      "powerhouse_inverter_10_dc_current",
-		StateTopic:    TopicMultiplusDCCurrent,
-		ValueTemplate: valueTemplateJSONValue,
-		UnitOfMeasure: "A",
-		DeviceClass:   deviceClassCurrent,
-		StateClass:    stateClassMeasurement,
-		Device: haDeviceConfig{
-			Identifiers: []string{deviceIDInverter10},
-			Name:        deviceNameInverter10,
-			Model:       deviceModelMultiplus2,
-		},
-	}
-
-	payload, err := json.Marshal(config)
-	if err != nil {
-		return err
-	}
-
-	s.Send(MQTTMessage{
-		Topic:   "homeassistant/sensor/powerhouse_inverter_10_dc_current/config",
-		Payload: payload,
-		QoS:     2,
-		Retain:  true,
-	})
-
-	return nil
-}
-
-// CreateBattery3DCPowerEntity creates a Battery 3 DC power sensor that reads from the Cerbo
-// system battery power topic via MQTT discovery.
-func (s *MQTTSender) CreateBattery3DCPowerEntity() error {
-	type haDeviceConfig struct {
-		Identifiers []string `json:"identifiers"`
-		Name        string   `json:"name"`
-	}
-
-	type haSensorConfig struct {
-		Name          string         `json:"name"`
-		UniqueId      string         `json:"unique_id"`
-		StateTopic    string         `json:"state_topic"`
-		ValueTemplate string         `json:"value_template"`
-		UnitOfMeasure string         `json:"unit_of_measurement"`
-		DeviceClass   string         `json:"device_class"`
-		StateClass    string         `json:"state_class"`
-		Device        haDeviceConfig `json:"device"`
-	}
-
-	config := haSensorConfig{
-		Name:          "DC Power",
-		UniqueId:      "battery_3_dc_power",
-		StateTopic:    TopicCerboBatteryDCPower,
-		ValueTemplate: valueTemplateJSONValue,
-		UnitOfMeasure: "W",
-		DeviceClass:   "power",
-		StateClass:    stateClassMeasurement,
-		Device: haDeviceConfig{
-			Identifiers: []string{deviceIDBattery3},
-			Name:        deviceNameBattery3,
-		},
-	}
-
-	payload, err := json.Marshal(config)
-	if err != nil {
-		return err
-	}
-
-	s.Send(MQTTMessage{
-		Topic:   "homeassistant/sensor/battery_3_dc_power/config",
-		Payload: payload,
-		QoS:     2,
-		Retain:  true,
-	})
-
-	return nil
-}
-
-// CreateBattery3CurrentEntity creates a Battery 3 DC current sensor (positive = discharging)
-// that reads from the Cerbo system battery current topic via MQTT discovery.
-func (s *MQTTSender) CreateBattery3CurrentEntity() error {
-	type haDeviceConfig struct {
-		Identifiers []string `json:"identifiers"`
-		Name        string   `json:"name"`
-	}
-	type haSensorConfig struct {
-		Name          string         `json:"name"`
-		UniqueId      string         `json:"unique_id"`
-		StateTopic    string         `json:"state_topic"`
-		ValueTemplate string         `json:"value_template"`
-		UnitOfMeasure string         `json:"unit_of_measurement"`
-		DeviceClass   string         `json:"device_class"`
-		StateClass    string         `json:"state_class"`
-		Device        haDeviceConfig `json:"device"`
-	}
-
-	config := haSensorConfig{
-		Name:          "DC Current",
-		UniqueId:      "battery_3_dc_current",
-		StateTopic:    TopicCerboBatteryCurrent,
-		ValueTemplate: valueTemplateJSONValue,
-		UnitOfMeasure: "A",
-		DeviceClass:   deviceClassCurrent,
-		StateClass:    stateClassMeasurement,
-		Device: haDeviceConfig{
-			Identifiers: []string{deviceIDBattery3},
-			Name:        deviceNameBattery3,
-		},
-	}
-
-	payload, err := json.Marshal(config)
-	if err != nil {
-		return err
-	}
-
-	s.Send(MQTTMessage{
-		Topic:   "homeassistant/sensor/battery_3_dc_current/config",
-		Payload: payload,
-		QoS:     2,
-		Retain:  true,
-	})
-
-	return nil
-}
-
-// CreateBattery3CCLEntity creates a Battery 3 charge current limit sensor
-// that reads from the Cerbo BMS MaxChargeCurrent topic via MQTT discovery.
-func (s *MQTTSender) CreateBattery3CCLEntity() error {
-	type haDeviceConfig struct {
-		Identifiers []string `json:"identifiers"`
-		Name        string   `json:"name"`
-	}
-	type haSensorConfig struct {
-		Name          string         `json:"name"`
-		UniqueId      string         `json:"unique_id"`
-		StateTopic    string         `json:"state_topic"`
-		ValueTemplate string         `json:"value_template"`
-		UnitOfMeasure string         `json:"unit_of_measurement"`
-		DeviceClass   string         `json:"device_class"`
-		StateClass    string         `json:"state_class"`
-		Device        haDeviceConfig `json:"device"`
-	}
-
-	config := haSensorConfig{
-		Name:          "Charge Current Limit",
-		UniqueId:      "battery_3_ccl",
-		StateTopic:    TopicCerboBatteryCCL,
-		ValueTemplate: valueTemplateJSONValue,
-		UnitOfMeasure: "A",
-		DeviceClass:   deviceClassCurrent,
-		StateClass:    stateClassMeasurement,
-		Device: haDeviceConfig{
-			Identifiers: []string{deviceIDBattery3},
-			Name:        deviceNameBattery3,
-		},
-	}
-
-	payload, err := json.Marshal(config)
-	if err != nil {
-		return err
-	}
-
-	s.Send(MQTTMessage{
-		Topic:   "homeassistant/sensor/battery_3_ccl/config",
-		Payload: payload,
-		QoS:     2,
-		Retain:  true,
-	})
-
-	return nil
-}
-
-// CreateBattery3CVLEntity creates a Battery 3 charge voltage limit sensor
-// that reads from the Cerbo BMS MaxChargeVoltage topic via MQTT discovery.
-func (s *MQTTSender) CreateBattery3CVLEntity() error {
-	type haDeviceConfig struct {
-		Identifiers []string `json:"identifiers"`
-		Name        string   `json:"name"`
-	}
-	type haSensorConfig struct {
-		Name          string         `json:"name"`
-		UniqueId      string         `json:"unique_id"`
-		StateTopic    string         `json:"state_topic"`
-		ValueTemplate string         `json:"value_template"`
-		UnitOfMeasure string         `json:"unit_of_measurement"`
-		DeviceClass   string         `json:"device_class"`
-		StateClass    string         `json:"state_class"`
-		Device        haDeviceConfig `json:"device"`
-	}
-
-	config := haSensorConfig{
-		Name:          "Charge Voltage Limit",
-		UniqueId:      "battery_3_cvl",
-		StateTopic:    TopicCerboBatteryCVL,
-		ValueTemplate: valueTemplateJSONValue,
-		UnitOfMeasure: "V",
-		DeviceClass:   "voltage",
-		StateClass:    stateClassMeasurement,
-		Device: haDeviceConfig{
-			Identifiers: []string{deviceIDBattery3},
-			Name:        deviceNameBattery3,
-		},
-	}
-
-	payload, err := json.Marshal(config)
-	if err != nil {
-		return err
-	}
-
-	s.Send(MQTTMessage{
-		Topic:   "homeassistant/sensor/battery_3_cvl/config",
-		Payload: payload,
-		QoS:     2,
-		Retain:  true,
-	})
-
-	return nil
-}
-
-// CreateSolarMpptModeEntity creates an MPPT operating mode sensor for a solar charger,
-// reading from the Cerbo solarcharger topic via MQTT discovery.
-func (s *MQTTSender) CreateSolarMpptModeEntity(
-	solarName string,
-	cerboTopic string,
-) error {
-	type haDeviceConfig struct {
-		Identifiers []string `json:"identifiers"`
-		Name        string   `json:"name"`
-	}
-
-	type haSensorConfig struct {
-		Name          string         `json:"name"`
-		UniqueId      string         `json:"unique_id"`
-		StateTopic    string         `json:"state_topic"`
-		ValueTemplate string         `json:"value_template"`
-		StateClass    string         `json:"state_class"`
-		Device        haDeviceConfig `json:"device"`
-	}
-
-	entityId := strings.ReplaceAll(strings.ToLower(solarName), " ", "_") + "_mppt_mode"
-
-	config := haSensorConfig{
-		Name:          "MPPT Mode",
-		UniqueId:      entityId,
-		StateTopic:    cerboTopic,
-		ValueTemplate: valueTemplateJSONValue,
-		StateClass:    stateClassMeasurement,
-		Device: haDeviceConfig{
-			Identifiers: []string{solarName},
-			Name:        solarName,
-		},
-	}
-
-	payload, err := json.Marshal(config)
-	if err != nil {
-		return err
-	}
-
-	s.Send(MQTTMessage{
-		Topic:   "homeassistant/sensor/" + entityId + "/config",
-		Payload: payload,
-		QoS:     2,
-		Retain:  true,
-	})
-
-	return nil
-}
-
-// createPercentSensor creates a percentage sensor on the Water Tanks device via MQTT discovery.
-// The sensor expires to unavailable if powerctl stops publishing (e.g. tank sensor offline).
-func (s *MQTTSender) createPercentSensor(uniqueID, name, stateTopic, jsonKey string) error {
-	type haDeviceConfig struct {
-		Identifiers  []string `json:"identifiers"`
-		Name         string   `json:"name"`
-		Manufacturer string   `json:"manufacturer,omitempty"`
-	}
-
-	type haSensorConfig struct {
-		Name             string         `json:"name"`
-		StateTopic       string         `json:"state_topic"`
-		UnitOfMeasure    string         `json:"unit_of_measurement"`
-		ValueTemplate    string         `json:"value_template"`
-		UniqueId         string         `json:"unique_id"`
-		ExpireAfter      uint           `json:"expire_after,omitempty"`
-		StateClass       string         `json:"state_class,omitempty"`
-		DisplayPrecision int            `json:"suggested_display_precision,omitempty"`
-		Device           haDeviceConfig `json:"device"`
-	}
-
-	config := haSensorConfig{
-		Name:             name,
-		StateTopic:       stateTopic,
-		UnitOfMeasure:    "%",
-		ValueTemplate:    "{{ value_json." + jsonKey + " }}",
-		UniqueId:         uniqueID,
-		ExpireAfter:      60 * 30, // 30 minutes
-		StateClass:       stateClassMeasurement,
-		DisplayPrecision: 1,
-		Device: haDeviceConfig{
-			Identifiers:  []string{deviceIDWaterTanks},
-			Name:         deviceNameWaterTanks,
-			Manufacturer: deviceManufacturerCustom,
-		},
-	}
-
-	payload, err := json.Marshal(config)
-	if err != nil {
-		return err
-	}
-
-	s.Send(MQTTMessage{
-		Topic:   "homeassistant/sensor/" + uniqueID + "/config",
-		Payload: payload,
-		QoS:     2,
-		Retain:  true,
-	})
-
-	return nil
-}
-
-// CreateWaterTankEntities creates the five tank fill sensors published by tankLevelsWorker.
-func (s *MQTTSender) CreateWaterTankEntities() error {
-	sensors := []struct {
-		uniqueID, name, stateTopic, jsonKey string
-	}{
-		{"header_tank_percent_full", "Header Tank Percent Full", TopicHeaderTankLevelsState, "percent_full"},
-		{"storage_tank_percent_full", "Storage Tank Percent Full", TopicStorageTankLevelsState, "percent_full"},
-		{"storage_tank_1_percent_full", "Storage Tank 1 Percent Full", TopicStorageTankLevelsState, "tank_1_percent_full"},
-		{"storage_tank_2_percent_full", "Storage Tank 2 Percent Full", TopicStorageTankLevelsState, "tank_2_percent_full"},
-		{"storage_tank_3_percent_full", "Storage Tank 3 Percent Full", TopicStorageTankLevelsState, "tank_3_percent_full"},
-	}
-	for _, sensor := range sensors {
-		if err := s.createPercentSensor(sensor.uniqueID, sensor.name, sensor.stateTopic, sensor.jsonKey); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-// createBinarySensor creates a Home Assistant binary sensor via MQTT discovery.
-// Read-only counterpart of createSwitch (no command topic).
-func (s *MQTTSender) createBinarySensor(uniqueID, name, icon, stateTopic string) error {
-	type haDeviceConfig struct {
-		Identifiers  []string `json:"identifiers"`
-		Name         string   `json:"name"`
-		Manufacturer string   `json:"manufacturer,omitempty"`
-	}
-
-	type haBinarySensorConfig struct {
-		Name       string         `json:"name"`
-		StateTopic string         `json:"state_topic"`
-		UniqueId   string         `json:"unique_id"`
-		Icon       string         `json:"icon,omitempty"`
-		Device     haDeviceConfig `json:"device"`
-	}
-
-	config := haBinarySensorConfig{
-		Name:       name,
-		StateTopic: stateTopic,
-		UniqueId:   uniqueID,
-		Icon:       icon,
-		Device: haDeviceConfig{
-			Identifiers:  []string{deviceIDPowerctl},
-			Name:         deviceNamePowerctl,
-			Manufacturer: deviceManufacturerCustom,
-		},
-	}
-
-	payload, err := json.Marshal(config)
-	if err != nil {
-		return err
-	}
-
-	s.Send(MQTTMessage{
-		Topic:   "homeassistant/binary_sensor/" + uniqueID + "/config",
-		Payload: payload,
-		QoS:     2,
-		Retain:  true,
-	})
-
-	return nil
-}
-
-// CreateTankFlushModeBinarySensor creates the tank flush mode binary sensor via MQTT discovery.
-// On during the first fortnight of every third month (see IsFlushMode).
-func (s *MQTTSender) CreateTankFlushModeBinarySensor() error {
-	return s.createBinarySensor("powerctl_tank_flush_mode", "Tank Flush Mode", "mdi:water-sync", TopicTankFlushModeState)
-}
-
-// isDiscoveryTopic checks if a topic is an MQTT discovery config topic
-func isDiscoveryTopic(topic string) bool {
-	return strings.HasSuffix(topic, "/config")
-}
-
-// TopicPowerctlEnabledState is the state topic for the powerctl_enabled switch.
-// Statestream publishes here, powerctl reads to check enabled state.
-const TopicPowerctlEnabledState = "homeassistant/switch/powerctl_enabled/state"
-
-// TopicPowerhouseInvertersEnabledState is the state topic for the powerctl_inverter_enabled switch.
-// Controls whether unifiedInverterEnabler messages are forwarded.
-const TopicPowerhouseInvertersEnabledState = "homeassistant/switch/powerctl_inverter_enabled/state"
-
-// mqttSenderWorker handles outgoing MQTT messages with queuing and filtering
-func mqttSenderWorker(
-	ctx context.Context,
-	outgoingChan <-chan MQTTMessage,
-	clientChan <-chan mqtt.Client,
-	dataChan <-chan DisplayData,
-	forceEnable bool,
-	multiplusOnly bool,
-) {
-	log.Println("MQTT sender worker started")
-
-	var client mqtt.Client
-	var messageQueue []MQTTMessage
-	enabled := true // Default to enabled
-	lastSent := make(map[string]lastSentInfo)
-
-	for {
-		select {
-		case data := <-dataChan:
-			// Read enabled state using GetBoolean (parsed by statsWorker)
-			newEnabled := data.GetBoolean(TopicPowerctlEnabledState)
-			if newEnabled != enabled {
-				log.Printf("Powerctl enabled: %v\n", newEnabled)
-				enabled = newEnabled
-			}
-
-		case newClient := <-clientChan:
-			log.Println("MQTT sender worker received new client")
-			client = newClient
-
-			// Process any queued messages now that we have a client
-			if client != nil && client.IsConnected() {
-				queuedCount := len(messageQueue)
-				for _, msg := range messageQueue {
-					token := client.Publish(msg.Topic, msg.QoS, msg.Retain, msg.Payload)
-					token.Wait()
-					if token.Error() != nil {
-						log.Printf("Failed to publish queued message to %s: %v\n", msg.Topic, token.Error())
-					}
-					lastSent[msg.Topic] = lastSentInfo{
-						payload: bytes.Clone(msg.Payload),
-						sentAt:  time.Now(),
-					}
-				}
-				messageQueue = nil // Clear the queue
-				if queuedCount > 0 {
-					log.Printf("MQTT sender worker processed %d queued messages\n", queuedCount)
-				}
-			}
-
-		case msg := <-outgoingChan:
-			// Multiplus-only isolation: drop everything outside the Cerbo namespace,
-			// except discovery config topics which register HA entities.
-			if multiplusOnly && !strings.HasPrefix(msg.Topic, "powerhouse_3/") && !isDiscoveryTopic(msg.Topic) {
-				continue
-			}
-
-			// Check if message should be published
-			isEnabled := forceEnable || enabled || isDiscoveryTopic(msg.Topic)
-			if !isEnabled {
-				log.Printf("Powerctl disabled, dropping message to %s\n", msg.Topic)
-				continue
-			}
-
-			// Change detection: skip if payload unchanged and recently sent.
-			// Service calls and Victron read/write topics are commands that must always be forwarded.
-			if msg.Topic != TopicCallServiceProxy &&
-				!strings.HasPrefix(msg.Topic, "powerhouse_3/W/") &&
-				!strings.HasPrefix(msg.Topic, "powerhouse_3/R/") {
-				if last, ok := lastSent[msg.Topic]; ok {
-					if bytes.Equal(last.payload, msg.Payload) && time.Since(last.sentAt) < resendInterval {
-						continue
-					}
-				}
-			}
-
-			if client != nil && client.IsConnected() {
-				// We have a client, publish immediately
-				token := client.Publish(msg.Topic, msg.QoS, msg.Retain, msg.Payload)
-				token.Wait()
-				if token.Error() != nil {
-					log.Printf("Failed to publish to %s: %v\n", msg.Topic, token.Error())
-				}
-				lastSent[msg.Topic] = lastSentInfo{
-					payload: bytes.Clone(msg.Payload),
-					sentAt:  time.Now(),
-				}
-			} else {
-				// No client yet, queue the message
-				messageQueue = append(messageQueue, msg)
-				log.Printf("MQTT sender worker queued message (total queued: %d)\n", len(messageQueue))
-			}
-
-		case <-ctx.Done():
-			log.Println("MQTT sender worker stopped")
-			return
-		}
-	}
-}
@@ -1,105 +0,0 @@
-package main
-
-import (
-	"context"
-	"fmt"
-	"log"
-	"time"
-
-	mqtt "github.com/eclipse/paho.mqtt.golang"
-)
-
-// TopicRoute binds a set of subscribed topics to a destination channel.
-// mqttWorker subscribes to every topic in Topics and forwards each incoming
-// message on that topic to Channel.
-type TopicRoute struct {
-	Topics  []string
-	Channel chan<- SensorMessage
-}
-
-// mqttWorker manages MQTT connection and forwards messages to routed channels.
-func mqttWorker(
-	ctx context.Context,
-	broker string,
-	port int,
-	routes []TopicRoute,
-	username, password, clientID string,
-	clientChan chan<- mqtt.Client,
-) {
-	// Connect to MQTT broker
-	opts := mqtt.NewClientOptions()
-	opts.AddBroker(fmt.Sprintf("tcp://%s:%d", broker, port))
-	opts.SetClientID(clientID)
-	opts.SetUsername(username)
-	opts.SetPassword(password)
-	opts.SetAutoReconnect(true)
-	opts.SetConnectRetryInterval(5 * time.Second)
-
-	// Set up connection lost handler
-	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
-		log.Printf("MQTT connection lost: %v\n", err)
-	})
-
-	// Set up connection handler
-	opts.SetOnConnectHandler(func(client mqtt.Client) {
-		log.Printf("Connected to MQTT broker at %s\n", broker) //nolint:gosec // broker host from operator-set env config, not untrusted input
-
-		// Send the new client to the sender worker
-		select {
-		case clientChan <- client:
-			log.Println("Sent new MQTT client to sender worker")
-		case <-ctx.Done():
-			return
-		}
-
-		// Subscribe to all routed topics
-		for _, route := range routes {
-			ch := route.Channel
-			for _, topic := range route.Topics {
-				token := client.Subscribe(topic, 0, func(client mqtt.Client, msg mqtt.Message) {
-					value := string(msg.Payload())
-
-					// Skip invalid values from HA - sensor has dropped out
-					// TODO: Track how long sensors have been invalid and send notification
-					if value == "Undefined" || value == "unavailable" || value == "unknown" {
-						return
-					}
-
-					sensorMsg := SensorMessage{
-						Topic: msg.Topic(),
-						Value: value,
-					}
-					select {
-					case ch <- sensorMsg:
-					case <-ctx.Done():
-						return
-					}
-				})
-
-				if token.Wait() && token.Error() != nil {
-					log.Printf("Failed to subscribe to topic %s: %v\n", topic, token.Error())
-				} else {
-					log.Printf("Subscribed to topic: %s\n", topic)
-				}
-			}
-		}
-	})
-
-	client := mqtt.NewClient(opts)
-
-	// Connect to broker
-	log.Printf("Connecting to MQTT broker at %s...\n", broker) //nolint:gosec // broker host from operator-set env config, not untrusted input
-	if token := client.Connect(); token.Wait() && token.Error() != nil {
-		log.Printf("Failed to connect to MQTT broker: %v\n", token.Error())
-		return
-	}
-
-	// Keep worker alive until context is done
-	<-ctx.Done()
-
-	// Cleanup
-	if client.IsConnected() {
-		client.Disconnect(250)
-		log.Println("Disconnected from MQTT broker")
-	}
-}
@@ -1,521 +0,0 @@
-package main
-
-import (
-	"context"
-	"log"
-	"sort"
-	"strconv"
-	"strings"
-	"time"
-)
-
-// Window constants for GetPercentile
-const (
-	Window5Min  = 5 * time.Minute
-	Window15Min = 15 * time.Minute
-)
-
-// Percentile constants for GetPercentile
-const (
-	P1   = 1
-	P25  = 25
-	P50  = 50
-	P66  = 66
-	P75  = 75
-	P90  = 90
-	P99  = 99
-	P100 = 100
-)
-
-const (
-	topicHouseLoadPower2 = "homeassistant/sensor/home_sweet_home_load_power_2/state"
-	topicACFrequency     = "homeassistant/sensor/lounge_ac_frequency/state"
-	topicSolar2ACPower   = "homeassistant/sensor/primo_5_0_ac_power/state"
-)
-
-// Topics that report in kW or kWh and need conversion to W or Wh (multiply by 1000)
-// This centralizes unit conversion so downstream workers always see W and Wh
-var kiloToBaseUnitTopics = map[string]bool{
-	// Power sensors (kW → W)
-	"homeassistant/sensor/home_sweet_home_battery_power_2/state": true,
-	"homeassistant/sensor/home_sweet_home_site_power/state":      true,
-	topicHouseLoadPower2: true,
-	// Energy sensors (kWh → Wh)
-	"homeassistant/sensor/home_sweet_home_tg118095000r1a_battery_remaining/state": true,
-	"homeassistant/sensor/solcast_pv_forecast_forecast_today/state":               true,
-	TopicSolcastForecastRemaining:                                                 true,
-}
-
-// PercentileSpec defines a specific percentile and time window combination
-type PercentileSpec struct {
-	Percentile int           // 1, 50, 66, or 99
-	Window     time.Duration // 1, 5, or 15 minutes
-}
-
-// requiredPercentiles maps topics to the specific percentile/window combinations they need.
-// Topics not in this map will only have their Current value tracked (no percentile calculations).
-// This dramatically reduces computation by only calculating what's actually used.
-var requiredPercentiles = map[string][]PercentileSpec{
-	// Solar 1 power - P50 used by power_excess_calculator; P90 used by baseline_inverter_control
-	TopicSolar1Power: {
-		{50, 5 * time.Minute},
-		{90, 15 * time.Minute},
-	},
-
-	// Tesla battery remaining - used by powerExcessCalculator for P50._5
-	"homeassistant/sensor/home_sweet_home_tg118095000r1a_battery_remaining/state": {{50, 5 * time.Minute}},
-
-	// Battery available energy - used by powerExcessCalculator for P50._5
-	TopicBattery2Energy: {{50, 5 * time.Minute}},
-
-	// AC frequency - used by baseline/dynamic controllers for high frequency protection (P100._5)
-	topicACFrequency: {{100, 5 * time.Minute}},
-
-	// Tank ADC voltages - quartiles feed tank_levels_worker's 5-minute Tukey trimean
-	TopicHeaderTankADC:  {{25, 5 * time.Minute}, {50, 5 * time.Minute}, {75, 5 * time.Minute}},
-	TopicStorageTankADC: {{25, 5 * time.Minute}, {50, 5 * time.Minute}, {75, 5 * time.Minute}},
-}
-
-// Reading represents a timestamped sensor reading
-type Reading struct {
-	Value     float64
-	Timestamp time.Time
-}
-
-// Readings is a collection of timestamped readings
-type Readings []Reading
-
-// FloatTopicData holds the current value for a float topic
-type FloatTopicData struct {
-	Current float64
-}
-
-// PercentileKey identifies a specific percentile calculation
-type PercentileKey struct {
-	Topic      string
-	Percentile int
-	Window     time.Duration
-}
-
-// StringTopicData holds current value for a string topic
-type StringTopicData struct {
-	Current string
-}
-
-// BooleanTopicData holds current value for a boolean topic (on/off switches)
-type BooleanTopicData struct {
-	Current bool
-	Raw     string
-}
-
-// weightedValue represents a value with its duration weight for percentile calculation
-type weightedValue struct {
-	value    float64
-	duration float64
-}
-
-// calculateSelectedPercentile calculates a single time-weighted percentile for a window.
-// The percentile parameter should be 1, 50, 66, or 99.
-func calculateSelectedPercentile(
-	pairs []weightedValue,
-	totalDuration float64,
-	percentile int,
-	fallbackValue float64,
-) float64 {
-	if len(pairs) == 0 {
-		return fallbackValue
-	}
-	if len(pairs) == 1 {
-		return pairs[0].value
-	}
-
-	target := totalDuration * float64(percentile) / 100.0
-	var cumulative float64
-
-	for _, pair := range pairs {
-		cumulative += pair.duration
-		if cumulative >= target {
-			return pair.value
-		}
-	}
-
-	return pairs[len(pairs)-1].value
-}
-
-// prepareWindowData filters readings for a time window and prepares sorted weighted pairs.
-// Returns the sorted pairs, total duration, and fallback value for empty windows.
-func prepareWindowData(
-	readings Readings,
-	windowDuration time.Duration,
-	now time.Time,
-) (pairs []weightedValue, totalDuration float64, fallbackValue float64) {
-	if len(readings) == 0 {
-		return nil, 0, 0
-	}
-
-	// Capture last reading for fallback
-	lastReading := readings[len(readings)-1]
-	fallbackValue = lastReading.Value
-
-	cutoff := now.Add(-windowDuration)
-
-	// Filter readings within the window
-	var windowReadings Readings
-	for _, r := range readings {
-		if r.Timestamp.After(cutoff) {
-			windowReadings = append(windowReadings, r)
-		}
-	}
-
-	// If 0 or 1 readings in window, use fallback
-	if len(windowReadings) <= 1 {
-		return nil, 0, fallbackValue
-	}
-
-	// Build weighted value pairs
-	pairs = make([]weightedValue, 0, len(windowReadings))
-
-	for i := 0; i < len(windowReadings); i++ {
-		value := windowReadings[i].Value
-
-		var duration float64
-		if i < len(windowReadings)-1 {
-			duration = windowReadings[i+1].Timestamp.Sub(windowReadings[i].Timestamp).Seconds()
-		} else {
-			duration = now.Sub(windowReadings[i].Timestamp).Seconds()
-		}
-
-		pairs = append(pairs, weightedValue{value: value, duration: duration})
-		totalDuration += duration
-	}
-
-	// Sort pairs by value for percentile calculation
-	sort.Slice(pairs, func(i, j int) bool {
-		return pairs[i].value < pairs[j].value
-	})
-
-	return pairs, totalDuration, fallbackValue
-}
-
-// calculateRequiredStats calculates only the percentiles specified in the registry for a topic.
-// Results are written to the percentiles map.
-func calculateRequiredStats(topic string, readings Readings, percentiles map[PercentileKey]float64) {
-	specs, needsPercentiles := requiredPercentiles[topic]
-	if !needsPercentiles || len(readings) == 0 {
-		return
-	}
-
-	now := time.Now()
-
-	// Group specs by window to avoid redundant filtering/sorting
-	type windowWork struct {
-		pairs         []weightedValue
-		totalDuration float64
-		fallback      float64
-	}
-	windowCache := make(map[time.Duration]*windowWork)
-
-	for _, spec := range specs {
-		// Prepare window data (cached per window duration)
-		work, exists := windowCache[spec.Window]
-		if !exists {
-			pairs, totalDuration, fallback := prepareWindowData(readings, spec.Window, now)
-			work = &windowWork{
-				pairs:         pairs,
-				totalDuration: totalDuration,
-				fallback:      fallback,
-			}
-			windowCache[spec.Window] = work
-		}
-
-		// Calculate the specific percentile
-		var value float64
-		if work.pairs == nil {
-			value = work.fallback
-		} else {
-			value = calculateSelectedPercentile(work.pairs, work.totalDuration, spec.Percentile, work.fallback)
-		}
-
-		// Store in the percentiles map
-		percentiles[PercentileKey{topic, spec.Percentile, spec.Window}] = value
-	}
-}
-
-// cloneTopicData creates a deep copy of topicData for safe concurrent access
-func cloneTopicData(topicData map[string]any) map[string]any {
-	clone := make(map[string]any, len(topicData))
-	for topic, data := range topicData {
-		switch d := data.(type) {
-		case *FloatTopicData:
-			clone[topic] = &FloatTopicData{Current: d.Current}
-		case *StringTopicData:
-			clone[topic] = &StringTopicData{Current: d.Current}
-		case *BooleanTopicData:
-			clone[topic] = &BooleanTopicData{Current: d.Current, Raw: d.Raw}
-		}
-	}
-	return clone
-}
-
-// clonePercentiles creates a copy of the percentiles map for safe concurrent access
-func clonePercentiles(percentiles map[PercentileKey]float64) map[PercentileKey]float64 {
-	clone := make(map[PercentileKey]float64, len(percentiles))
-	for k, v := range percentiles {
-		clone[k] = v
-	}
-	return clone
-}
-
-func allExpectedTopicsReceived(topicData map[string]any, expectedTopics []string) bool {
-	for _, topic := range expectedTopics {
-		if _, ok := topicData[topic]; !ok {
-			return false
-		}
-	}
-	return true
-}
-
-// Topics pre-seeded into msgChan at startup so statsWorker doesn't block waiting
-// for values that may be absent from the broker. Real broker values override these
-// on connection. Unlike the selfPublished* defaults below, these take effect
-// immediately rather than after the startup timeout — use them when waiting would
-// block the first broadcast (e.g. topics powerctl itself publishes unretained).
-var preSeededTopics = []SensorMessage{
-	{Topic: TopicInverter10SetpointCmd, Value: "0"},
-	// Tank ADC sentinel: real readings are >= 0, so negative means "no data yet"
-	{Topic: TopicHeaderTankADC, Value: "-1"},
-	{Topic: TopicStorageTankADC, Value: "-1"},
-	// Calibration defaults mirror the HA input_number values; statestream only
-	// republishes input_numbers on change, so they may never arrive after connect.
-	// TODO: fetch the live input_number values from HA at startup instead of hardcoding.
-	{Topic: TopicHeaderTankFullVoltage, Value: "4.76"},
-	{Topic: TopicHeaderTankEmptyVoltage, Value: "0.0"},
-	{Topic: TopicStorageTankFullVoltage, Value: "4.86"},
-	{Topic: TopicStorageTankEmptyVoltage, Value: "0.2"},
-	// Header tank level sentinel: powerctl's own publishes aren't retained, and
-	// tankLevelsWorker can't publish until the first broadcast, so a selfPublished*
-	// timeout default would stall every startup. Pre-seeding marks "no data yet"
-	// for the pump controller instantly.
-	{Topic: TopicHeaderTankLevelsState, Value: `{"percent_full": -1000}`},
-	// Ryan's lights brightness is null (statestream may not publish) while the
-	// light is off; seed 0 so the lights worker's dim doesn't block startup.
-	{Topic: TopicLightRyansBrightness, Value: "0"},
-	// Car-charging B3 SOC cutoff: a powerctl-owned number whose retained value
-	// may not arrive after connect. 20% is a placeholder default; not ideal.
-	// TODO: revisit — likely remove or rework how this cutoff is sourced.
-	{Topic: TopicCarChargingBattery3CutoffState, Value: "20"},
-	// Battery 3 SOC comes from the Cerbo via an HA entity (statestream may not
-	// republish promptly, and the Cerbo can go quiet overnight). Seed 50% rather
-	// than letting it default to 0: at 0 the controller treats B3 as empty and
-	// refuses to discharge, stranding it. Real values override this on connect.
-	{Topic: "homeassistant/sensor/battery_3_state_of_charge/state", Value: "50"},
-}
-
-// Topics that should be initialized to 0.0 if not received within timeout
-// These are self-published topics that won't exist on first startup
-var selfPublishedFloatTopics = []string{
-	TopicBattery2Energy,
-	"homeassistant/sensor/battery_2_state_of_charge/state",
-	TopicBattery3Energy,
-	// battery_3_state_of_charge is pre-seeded to 50% instead (see preSeededTopics):
-	// a 0.0 default strands B3 because the controller won't discharge what it
-	// thinks is an empty battery.
-	// Solar 2 inverter goes unavailable at night; default to 0 so startup isn't blocked
-	topicSolar2ACPower,
-}
-
-// String topics that should be initialized to a default if not received within timeout
-var selfPublishedStringTopics = map[string]string{
-	TopicMinerWorkmode:    WorkmodeOff,          // dump_load_enabler controls this; default to off
-	TopicPW2DischargeMode: PW2DischargeModeAuto, // arbiter delegates to automation by default
-}
-
-// Boolean topics that should be initialized to true if not received within timeout
-var selfPublishedBoolTopics = []string{
-	TopicPowerctlEnabledState,
-	TopicPowerhouseInvertersEnabledState,
-	TopicExpectingPowerCutsState,
-	TopicDynamicAutoState,
-}
-
-// statsWorker receives messages, maintains statistics, and sends to output channel
-func statsWorker(ctx context.Context, msgChan <-chan SensorMessage, outputChan chan<- DisplayData, expectedTopics []string) {
-	// Map of topic -> data (can be *FloatTopicData or *StringTopicData)
-	topicData := make(map[string]any)
-	// Map of topic -> readings (for float topics only, internal to stats worker)
-	topicReadings := make(map[string]Readings)
-	// Percentiles for registered topics
-	percentiles := make(map[PercentileKey]float64)
-
-	// Ready state tracking
-	allTopicsReceived := false
-	startupCheckTicker := time.NewTicker(30 * time.Second)
-	defer startupCheckTicker.Stop()
-
-	// Timer to initialize self-published topics if not received
-	selfPublishedTimer := time.NewTimer(20 * time.Second)
-	defer selfPublishedTimer.Stop()
-
-	// Cleanup ticker to remove old readings beyond 15 minutes
-	cleanupTicker := time.NewTicker(30 * time.Second)
-	defer cleanupTicker.Stop()
-
-	// Percentile refresh ticker for live updates and downstream broadcast
-	percentileTicker := time.NewTicker(1 * time.Second)
-	defer percentileTicker.Stop()
-
-	for {
-		select {
-		case msg := <-msgChan:
-			// Try to parse as float first
-			value, err := strconv.ParseFloat(msg.Value, 64)
-			if err == nil {
-				// Apply kW/kWh to W/Wh conversion if needed
-				if kiloToBaseUnitTopics[msg.Topic] {
-					value *= 1000
-				}
-
-				// Handle as float topic
-				data, _ := topicData[msg.Topic].(*FloatTopicData)
-				if data == nil {
-					data = &FloatTopicData{}
-					topicData[msg.Topic] = data
-				}
-
-				data.Current = value
-
-				// Add new reading to internal storage (percentiles calculated on ticker)
-				reading := Reading{
-					Value:     value,
-					Timestamp: time.Now(),
-				}
-				topicReadings[msg.Topic] = append(topicReadings[msg.Topic], reading)
-			} else {
-				// Check if value is a boolean (case-insensitive "on" or "off")
-				lowerValue := strings.ToLower(msg.Value)
-				if lowerValue == "on" || lowerValue == "off" {
-					data, _ := topicData[msg.Topic].(*BooleanTopicData)
-					if data == nil {
-						data = &BooleanTopicData{}
-						topicData[msg.Topic] = data
-					}
-					data.Current = lowerValue == "on"
-					data.Raw = msg.Value
-				} else {
-					data, _ := topicData[msg.Topic].(*StringTopicData)
-					if data == nil {
-						data = &StringTopicData{}
-						topicData[msg.Topic] = data
-					}
-					data.Current = msg.Value
-				}
-			}
-
-			// Check if we've received all expected topics
-			if !allTopicsReceived && allExpectedTopicsReceived(topicData, expectedTopics) {
-				allTopicsReceived = true
-				startupCheckTicker.Stop()
-				log.Printf("Stats worker ready: received data for all %d topics\n", len(expectedTopics))
-			}
-
-		case <-startupCheckTicker.C:
-			log.Printf("Startup check: received %d/%d topics\n", len(topicData), len(expectedTopics))
-
-			// Periodically check for missing topics
-			if allTopicsReceived {
-				continue
-			}
-
-			receivedTopics := make(map[string]bool)
-			for topic := range topicData {
-				receivedTopics[topic] = true
-			}
-
-			var missingTopics []string
-			for _, topic := range expectedTopics {
-				if !receivedTopics[topic] {
-					missingTopics = append(missingTopics, topic)
-				}
-			}
-
-			if len(missingTopics) > 0 {
-				log.Printf("WARNING: Still waiting for topics. Missing %d/%d:\n",
-					len(missingTopics), len(expectedTopics))
-				for _, topic := range missingTopics {
-					log.Printf("  - %s\n", topic)
-				}
-			}
-
-		case <-selfPublishedTimer.C:
-			// Initialize self-published float topics to 0.0 if not yet received
-			for _, topic := range selfPublishedFloatTopics {
-				if _, exists := topicData[topic]; !exists {
-					log.Printf("Initializing missing self-published topic to 0.0: %s\n", topic)
-					topicData[topic] = &FloatTopicData{Current: 0.0}
-					topicReadings[topic] = Readings{{Value: 0.0, Timestamp: time.Now()}}
-				}
-			}
-			// Initialize self-published string topics to defaults if not yet received
-			for topic, defaultValue := range selfPublishedStringTopics {
-				if _, exists := topicData[topic]; !exists {
-					log.Printf("Initializing missing self-published topic to %q: %s\n", defaultValue, topic)
-					topicData[topic] = &StringTopicData{Current: defaultValue}
-				}
-			}
-			// Initialize self-published boolean topics to true if not yet received
-			for _, topic := range selfPublishedBoolTopics {
-				if _, exists := topicData[topic]; !exists {
-					log.Printf("Initializing missing self-published topic to true: %s\n", topic)
-					topicData[topic] = &BooleanTopicData{Current: true}
-				}
-			}
-
-		case <-percentileTicker.C:
-			// Recalculate percentiles for registered topics (live updates as time passes)
-			if !allTopicsReceived {
-				continue
-			}
-
-			for topic := range requiredPercentiles {
-				calculateRequiredStats(topic, topicReadings[topic], percentiles)
-			}
-
-			// Send updated data (non-blocking to avoid stalling if downstream is slow)
-			select {
-			case outputChan <- DisplayData{
-				TopicData:   cloneTopicData(topicData),
-				Percentiles: clonePercentiles(percentiles),
-			}:
-			default:
-				// Channel full, skip this update
-			}
-
-		case <-cleanupTicker.C:
-			// Remove readings older than 15 minutes for float topics
-			// Always keep at least one reading (the most recent) for last known value
-			cutoff := time.Now().Add(-15 * time.Minute)
-			for topic, readings := range topicReadings {
-				if len(readings) == 0 {
-					continue
-				}
-
-				newReadings := make(Readings, 0, len(readings))
-				for _, r := range readings {
-					if r.Timestamp.After(cutoff) {
-						newReadings = append(newReadings, r)
-					}
-				}
-
-				// If all readings were removed, keep the most recent one
-				if len(newReadings) == 0 {
-					newReadings = append(newReadings, readings[len(readings)-1])
-				}
-
-				topicReadings[topic] = newReadings
-			}
-
-		case <-ctx.Done():
-			return
-		}
-	}
-}